@@ -29,6 +29,29 @@
 #define ETH_P_IP	0x0800		/* Internet Protocol packet	*/
 // ETH_P_IPV6 value as defined in IEEE 802: https://www.iana.org/assignments/ieee-802-numbers/ieee-802-numbers.xhtml
 #define ETH_P_IPV6	0x86DD		/* IPv6 over bluebook		*/
+// IPPROTO_ICMPV6 is defined as a macro in uapi/linux/in6.h, so it's not in vmlinux.h
+#define IPPROTO_ICMPV6	58		/* ICMPv6 */
+#define ETH_P_8021Q	0x8100		/* 802.1Q VLAN Extended Header	*/
+#define ETH_P_8021AD	0x88A8		/* 802.1ad Service VLAN		*/
+#define ETH_P_TEB	0x6558		/* Trans Ether Bridging		*/
+// maximum number of stacked VLAN tags (e.g. 802.1ad QinQ) to unwrap
+#define MAX_VLAN_DEPTH 2
+// UDP ports of the VXLAN and Geneve overlay network encapsulations
+#define VXLAN_PORT	4789
+// Linux default VXLAN port, used by CNIs like Flannel
+#define VXLAN_LINUX_PORT	8472
+#define GENEVE_PORT	6081
+// VXLAN flag indicating a valid VNI
+#define VXLAN_FLAG_VNI	0x08
+// IPv6 extension headers, as defined in include/net/ipv6.h
+#define NEXTHDR_HOP		0	/* Hop-by-hop option header. */
+#define NEXTHDR_ROUTING		43	/* Routing header. */
+#define NEXTHDR_FRAGMENT	44	/* Fragmentation/reassembly header. */
+#define NEXTHDR_AUTH		51	/* Authentication header. */
+#define NEXTHDR_DEST		60	/* Destination options header. */
+#define NEXTHDR_MOBILITY	135	/* Mobility header. */
+// maximum number of IPv6 extension headers to skip before reaching the L4 header
+#define MAX_IPV6_EXT_HEADERS 6
 typedef __u8 u8;
 typedef __u16 u16;
 typedef __u32 u32;
@@ -62,6 +85,9 @@ typedef struct flow_id_t {
     u16 eth_protocol;
     u8 direction;
     // L4 transport layer
+    // For ICMP and ICMPv6 flows, there are no ports: src_port stores the ICMP type
+    // and dst_port stores the ICMP code, so echo requests, replies and errors
+    // are accounted as different flows
     u16 src_port;
     u16 dst_port;
     u8 transport_protocol;
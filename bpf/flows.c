@@ -51,8 +51,54 @@ static inline void set_flags(struct tcphdr *th, u16 *flags) {
         *flags |= CWR_FLAG;
     }
 }
-// sets flow fields from IPv4 header information
-static inline int fill_iphdr(struct iphdr *ip, void *data_end, flow_id *id, u16 *flags) {
+// ICMP messages do not have ports, so we store the ICMP type and code in the
+// port fields of the flow, to account each type/code as a different flow
+static inline void set_icmp_type_code(flow_id *id, u8 type, u8 code) {
+    id->src_port = type;
+    id->dst_port = code;
+}
+
+struct __vxlanhdr {
+    u8 flags;
+    u8 reserved1[3];
+    u8 vni[3];
+    u8 reserved2;
+};
+
+struct __genevehdr {
+    u8 ver_opt_len; // 2 bits version, 6 bits options length (in 4-byte multiples)
+    u8 flags;
+    __be16 proto_type;
+    u8 vni[3];
+    u8 reserved;
+};
+
+// if the UDP datagram is a VXLAN or Geneve encapsulation, returns a pointer to the
+// encapsulated Ethernet frame. Otherwise it returns NULL
+static inline void *tunnel_payload(struct udphdr *udp, void *data_end) {
+    void *payload = (void *)udp + sizeof(*udp);
+    u16 dport = __bpf_ntohs(udp->dest);
+    if (dport == VXLAN_PORT || dport == VXLAN_LINUX_PORT) {
+        struct __vxlanhdr *vxlan = (struct __vxlanhdr *)payload;
+        if ((void *)vxlan + sizeof(*vxlan) > data_end || !(vxlan->flags & VXLAN_FLAG_VNI)) {
+            return NULL;
+        }
+        return (void *)vxlan + sizeof(*vxlan);
+    }
+    if (dport == GENEVE_PORT) {
+        struct __genevehdr *geneve = (struct __genevehdr *)payload;
+        if ((void *)geneve + sizeof(*geneve) > data_end
+            || geneve->proto_type != __bpf_htons(ETH_P_TEB)) {
+            return NULL;
+        }
+        return (void *)geneve + sizeof(*geneve) + (geneve->ver_opt_len & 0x3f) * 4;
+    }
+    return NULL;
+}
+
+// sets flow fields from IPv4 header information.
+// If the packet is a VXLAN/Geneve tunnel, inner points to the encapsulated frame.
+static inline int fill_iphdr(struct iphdr *ip, void *data_end, flow_id *id, u16 *flags, void **inner) {
     if ((void *)ip + sizeof(*ip) > data_end) {
         return DISCARD;
     }
@@ -78,6 +124,20 @@ static inline int fill_iphdr(struct iphdr *ip, void *data_end, flow_id *id, u16
         if ((void *)udp + sizeof(*udp) <= data_end) {
             id->src_port = __bpf_ntohs(udp->source);
             id->dst_port = __bpf_ntohs(udp->dest);
+            *inner = tunnel_payload(udp, data_end);
+        }
+    } break;
+    case IPPROTO_SCTP: {
+        struct sctphdr *sctp = (struct sctphdr *)((void *)ip + sizeof(*ip));
+        if ((void *)sctp + sizeof(*sctp) <= data_end) {
+            id->src_port = __bpf_ntohs(sctp->source);
+            id->dst_port = __bpf_ntohs(sctp->dest);
+        }
+    } break;
+    case IPPROTO_ICMP: {
+        struct icmphdr *icmp = (struct icmphdr *)((void *)ip + sizeof(*ip));
+        if ((void *)icmp + sizeof(*icmp) <= data_end) {
+            set_icmp_type_code(id, icmp->type, icmp->code);
         }
     } break;
     default:
@@ -86,20 +146,66 @@ static inline int fill_iphdr(struct iphdr *ip, void *data_end, flow_id *id, u16
     return SUBMIT;
 }
 
-// sets flow fields from IPv6 header information
-static inline int fill_ip6hdr(struct ipv6hdr *ip, void *data_end, flow_id *id, u16 *flags) {
+// sets the transport fields of an IPv6 flow whose L4 header follows extension headers.
+// The headers are read with bpf_skb_load_bytes, as walking them with direct packet access
+// makes the verification of the program exceed the complexity limits.
+// VXLAN/Geneve tunnels are not unwrapped in this case.
+static inline void fill_ip6_ext_l4(struct __sk_buff *skb, u32 l4_off, u8 nexthdr, flow_id *id, u16 *flags) {
+    bool l4_found = false;
+    u8 proto = skip_ipv6_ext_headers(skb, &l4_off, nexthdr, &l4_found);
+    id->transport_protocol = proto;
+    if (!l4_found) {
+        return;
+    }
+    switch (proto) {
+    case IPPROTO_TCP: {
+        struct tcphdr tcp;
+        if (bpf_skb_load_bytes(skb, l4_off, &tcp, sizeof(tcp)) == 0) {
+            id->src_port = __bpf_ntohs(tcp.source);
+            id->dst_port = __bpf_ntohs(tcp.dest);
+            set_flags(&tcp, flags);
+        }
+    } break;
+    case IPPROTO_UDP:
+    case IPPROTO_SCTP: {
+        // source and destination ports are the first fields of both UDP and SCTP headers
+        __be16 ports[2];
+        if (bpf_skb_load_bytes(skb, l4_off, ports, sizeof(ports)) == 0) {
+            id->src_port = __bpf_ntohs(ports[0]);
+            id->dst_port = __bpf_ntohs(ports[1]);
+        }
+    } break;
+    case IPPROTO_ICMPV6: {
+        u8 type_code[2];
+        if (bpf_skb_load_bytes(skb, l4_off, type_code, sizeof(type_code)) == 0) {
+            set_icmp_type_code(id, type_code[0], type_code[1]);
+        }
+    } break;
+    default:
+        break;
+    }
+}
+
+// sets flow fields from IPv6 header information.
+// If the packet is a VXLAN/Geneve tunnel, inner points to the encapsulated frame.
+static __always_inline int fill_ip6hdr(struct __sk_buff *skb, struct ipv6hdr *ip, void *data_end, flow_id *id, u16 *flags, void **inner) {
     if ((void *)ip + sizeof(*ip) > data_end) {
         return DISCARD;
     }
 
     id->src_ip = ip->saddr;
     id->dst_ip = ip->daddr;
-    id->transport_protocol = ip->nexthdr;
     id->src_port = 0;
     id->dst_port = 0;
+    id->transport_protocol = ip->nexthdr;
+    void *l4 = (void *)ip + sizeof(*ip);
+    if (is_ipv6_ext_header(ip->nexthdr)) {
+        fill_ip6_ext_l4(skb, l4 - (void *)(long)skb->data, ip->nexthdr, id, flags);
+        return SUBMIT;
+    }
     switch (ip->nexthdr) {
     case IPPROTO_TCP: {
-        struct tcphdr *tcp = (struct tcphdr *)((void *)ip + sizeof(*ip));
+        struct tcphdr *tcp = (struct tcphdr *)l4;
         if ((void *)tcp + sizeof(*tcp) <= data_end) {
             id->src_port = __bpf_ntohs(tcp->source);
             id->dst_port = __bpf_ntohs(tcp->dest);
@@ -107,10 +213,24 @@ static inline int fill_ip6hdr(struct ipv6hdr *ip, void *data_end, flow_id *id, u
         }
     } break;
     case IPPROTO_UDP: {
-        struct udphdr *udp = (struct udphdr *)((void *)ip + sizeof(*ip));
+        struct udphdr *udp = (struct udphdr *)l4;
         if ((void *)udp + sizeof(*udp) <= data_end) {
             id->src_port = __bpf_ntohs(udp->source);
             id->dst_port = __bpf_ntohs(udp->dest);
+            *inner = tunnel_payload(udp, data_end);
+        }
+    } break;
+    case IPPROTO_SCTP: {
+        struct sctphdr *sctp = (struct sctphdr *)l4;
+        if ((void *)sctp + sizeof(*sctp) <= data_end) {
+            id->src_port = __bpf_ntohs(sctp->source);
+            id->dst_port = __bpf_ntohs(sctp->dest);
+        }
+    } break;
+    case IPPROTO_ICMPV6: {
+        struct icmp6hdr *icmp = (struct icmp6hdr *)l4;
+        if ((void *)icmp + sizeof(*icmp) <= data_end) {
+            set_icmp_type_code(id, icmp->icmp6_type, icmp->icmp6_code);
         }
     } break;
     default:
@@ -118,20 +238,36 @@ static inline int fill_ip6hdr(struct ipv6hdr *ip, void *data_end, flow_id *id, u
     }
     return SUBMIT;
 }
-// sets flow fields from Ethernet header information
-static inline int fill_ethhdr(struct ethhdr *eth, void *data_end, flow_id *id, u16 *flags) {
+// sets flow fields from Ethernet header information.
+// VLAN tags are unwrapped, and the flow is accounted with the encapsulated ethertype.
+// If the packet is a VXLAN/Geneve tunnel, inner points to the encapsulated frame.
+static __always_inline int fill_ethhdr(struct __sk_buff *skb, struct ethhdr *eth, void *data_end, flow_id *id, u16 *flags, void **inner) {
     if ((void *)eth + sizeof(*eth) > data_end) {
         return DISCARD;
     }
 
-    id->eth_protocol = __bpf_ntohs(eth->h_proto);
+    void *l3 = (void *)eth + sizeof(*eth);
+    u16 proto = __bpf_ntohs(eth->h_proto);
+    #pragma unroll
+    for (int i = 0; i < MAX_VLAN_DEPTH; i++) {
+        if (proto != ETH_P_8021Q && proto != ETH_P_8021AD) {
+            break;
+        }
+        struct vlan_hdr *vlan = (struct vlan_hdr *)l3;
+        if ((void *)vlan + sizeof(*vlan) > data_end) {
+            return DISCARD;
+        }
+        proto = __bpf_ntohs(vlan->h_vlan_encapsulated_proto);
+        l3 = (void *)vlan + sizeof(*vlan);
+    }
+    id->eth_protocol = proto;
 
     if (id->eth_protocol == ETH_P_IP) {
-        struct iphdr *ip = (struct iphdr *)((void *)eth + sizeof(*eth));
-        return fill_iphdr(ip, data_end, id, flags);
+        struct iphdr *ip = (struct iphdr *)l3;
+        return fill_iphdr(ip, data_end, id, flags, inner);
     } else if (id->eth_protocol == ETH_P_IPV6) {
-        struct ipv6hdr *ip6 = (struct ipv6hdr *)((void *)eth + sizeof(*eth));
-        return fill_ip6hdr(ip6, data_end, id, flags);
+        struct ipv6hdr *ip6 = (struct ipv6hdr *)l3;
+        return fill_ip6hdr(skb, ip6, data_end, id, flags, inner);
     } else {
         // TODO : Need to implement other specific ethertypes if needed
         // For now other parts of flow id remain zero
@@ -144,33 +280,17 @@ static inline int fill_ethhdr(struct ethhdr *eth, void *data_end, flow_id *id, u
     return SUBMIT;
 }
 
-static inline int flow_monitor(struct __sk_buff *skb, u8 direction) {
-    // If sampling is defined, will only parse 1 out of "sampling" flows
-    if (sampling != 0 && (bpf_get_prandom_u32() % sampling) != 0) {
-        return TC_ACT_OK;
-    }
-    void *data_end = (void *)(long)skb->data_end;
-    void *data = (void *)(long)skb->data;
-
-    flow_id id;
-    __builtin_memset(&id, 0, sizeof(id));
-    struct ethhdr *eth = (struct ethhdr *)data;
-    u16 flags = 0;
-    if (fill_ethhdr(eth, data_end, &id, &flags) == DISCARD) {
-        return TC_ACT_OK;
-    }
-    id.if_index = skb->ifindex;
-
+// accounts a packet into the flow identified by id, either aggregating it in the
+// aggregated_flows map or, if not possible, submitting it via ringbuffer
+static inline void account_flow(flow_id *id, u64 bytes, u16 flags) {
     u64 current_time = bpf_ktime_get_ns();
-    //Set extra fields    
-    id.direction = direction;
 
     // TODO: we need to add spinlock here when we deprecate versions prior to 5.1, or provide
     // a spinlocked alternative version and use it selectively https://lwn.net/Articles/779120/
-    flow_metrics *aggregate_flow = (flow_metrics *)bpf_map_lookup_elem(&aggregated_flows, &id);
+    flow_metrics *aggregate_flow = (flow_metrics *)bpf_map_lookup_elem(&aggregated_flows, id);
     if (aggregate_flow != NULL) {
         aggregate_flow->packets += 1;
-        aggregate_flow->bytes += skb->len;
+        aggregate_flow->bytes += bytes;
         aggregate_flow->end_mono_time_ns = current_time;
         // it might happen that start_mono_time hasn't been set due to
         // the way percpu hashmap deal with concurrent map entries
@@ -179,7 +299,7 @@ static inline int flow_monitor(struct __sk_buff *skb, u8 direction) {
         }
         aggregate_flow->flags |= flags;
 
-        long ret = bpf_map_update_elem(&aggregated_flows, &id, aggregate_flow, BPF_ANY);
+        long ret = bpf_map_update_elem(&aggregated_flows, id, aggregate_flow, BPF_ANY);
         if (trace_messages && ret != 0) {
             // usually error -16 (-EBUSY) is printed here.
             // In this case, the flow is dropped, as submitting it to the ringbuffer would cause
@@ -192,7 +312,7 @@ static inline int flow_monitor(struct __sk_buff *skb, u8 direction) {
         // Key does not exist in the map, and will need to create a new entry.
         flow_metrics new_flow = {
             .packets = 1,
-            .bytes = skb->len,
+            .bytes = bytes,
             .start_mono_time_ns = current_time,
             .end_mono_time_ns = current_time,
             .flags = flags, 
@@ -200,7 +320,7 @@ static inline int flow_monitor(struct __sk_buff *skb, u8 direction) {
 
         // even if we know that the entry is new, another CPU might be concurrently inserting a flow
         // so we need to specify BPF_ANY
-        long ret = bpf_map_update_elem(&aggregated_flows, &id, &new_flow, BPF_ANY);
+        long ret = bpf_map_update_elem(&aggregated_flows, id, &new_flow, BPF_ANY);
         if (ret != 0) {
             // usually error -16 (-EBUSY) or -7 (E2BIG) is printed here.
             // In this case, we send the single-packet flow via ringbuffer as in the worst case we can have
@@ -217,14 +337,55 @@ static inline int flow_monitor(struct __sk_buff *skb, u8 direction) {
                 if (trace_messages) {
                     bpf_printk("couldn't reserve space in the ringbuf. Dropping flow");
                 }
-                return TC_ACT_OK;
+                return;
             }
-            record->id = id;
+            record->id = *id;
             record->metrics = new_flow;
             bpf_ringbuf_submit(record, 0);
         }
     }
+}
+
+static inline int flow_monitor(struct __sk_buff *skb, u8 direction) {
+    // If sampling is defined, will only parse 1 out of "sampling" flows
+    if (sampling != 0 && (bpf_get_prandom_u32() % sampling) != 0) {
+        return TC_ACT_OK;
+    }
+    void *data_end = (void *)(long)skb->data_end;
+    void *data = (void *)(long)skb->data;
+
+    flow_id id;
+    __builtin_memset(&id, 0, sizeof(id));
+    struct ethhdr *eth = (struct ethhdr *)data;
+    u16 flags = 0;
+    void *inner = NULL;
+    if (fill_ethhdr(skb, eth, data_end, &id, &flags, &inner) == DISCARD) {
+        return TC_ACT_OK;
+    }
+    //Set extra fields
+    id.if_index = skb->ifindex;
+    id.direction = direction;
+    u64 bytes = skb->len;
+
+    if (inner != NULL) {
+        // VXLAN/Geneve encapsulated packet. The outer (node to node) flow is only
+        // accounted on demand, and the packet is accounted to the encapsulated flow
+        // with the size of the encapsulated frame.
+        if (report_tunnel_outer) {
+            account_flow(&id, bytes, flags);
+        }
+        __builtin_memset(&id, 0, sizeof(id));
+        flags = 0;
+        void *nested = NULL;
+        if (fill_ethhdr(skb, (struct ethhdr *)inner, data_end, &id, &flags, &nested) == DISCARD) {
+            return TC_ACT_OK;
+        }
+        id.if_index = skb->ifindex;
+        id.direction = direction;
+        bytes = skb->len - (inner - data);
+    }
 
+    account_flow(&id, bytes, flags);
     return TC_ACT_OK;
 }
 
@@ -49,6 +49,68 @@ const u8 ip4in6[] = {0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff};
 // Constant definitions, to be overridden by the invoker
 volatile const u32 sampling = 0;
 volatile const u8 trace_messages = 0;
+// if set, the outer flows of VXLAN/Geneve tunnels are reported besides the encapsulated flows
+volatile const u8 report_tunnel_outer = 0;
+
+// generic IPv6 extension header. The length is expressed in 8-byte units, not including
+// the first 8 bytes, excepting the Authentication Header, which uses 4-byte units
+// not including the first 8 bytes (RFC 4302)
+struct __ipv6_ext_hdr {
+    u8 nexthdr;
+    u8 hdrlen;
+};
+
+struct __ipv6_frag_hdr {
+    u8 nexthdr;
+    u8 reserved;
+    __be16 frag_off;
+    __be32 identification;
+};
+
+static __always_inline bool is_ipv6_ext_header(u8 nexthdr) {
+    return nexthdr == NEXTHDR_HOP || nexthdr == NEXTHDR_ROUTING || nexthdr == NEXTHDR_FRAGMENT
+        || nexthdr == NEXTHDR_AUTH || nexthdr == NEXTHDR_DEST || nexthdr == NEXTHDR_MOBILITY;
+}
+
+static __always_inline u32 ipv6_ext_header_len(u8 nexthdr, u8 hdrlen) {
+    switch (nexthdr) {
+    case NEXTHDR_FRAGMENT:
+        return sizeof(struct __ipv6_frag_hdr);
+    case NEXTHDR_AUTH:
+        return ((u32)hdrlen + 2) * 4;
+    default:
+        return ((u32)hdrlen + 1) * 8;
+    }
+}
+
+// skips the IPv6 extension headers, updating hdr_len to the offset of the L4 header
+// and returning its protocol. Sets l4_found to false if the L4 header can't be located
+// (too many extension headers, or non-first fragments).
+static __always_inline u8 skip_ipv6_ext_headers(struct __sk_buff *skb, u32 *hdr_len, u8 proto, bool *l4_found) {
+    *l4_found = false;
+    for (int i = 0; i < MAX_IPV6_EXT_HEADERS; i++) {
+        if (!is_ipv6_ext_header(proto)) {
+            *l4_found = true;
+            return proto;
+        }
+        struct __ipv6_ext_hdr ext;
+        if (bpf_skb_load_bytes(skb, *hdr_len, &ext, sizeof(ext)) != 0) {
+            return proto;
+        }
+        if (proto == NEXTHDR_FRAGMENT) {
+            __be16 frag_off;
+            bpf_skb_load_bytes(skb, *hdr_len + offsetof(struct __ipv6_frag_hdr, frag_off), &frag_off, sizeof(frag_off));
+            // only the first fragment (offset == 0) contains the L4 header
+            if (frag_off & __bpf_htons(0xfff8)) {
+                return ext.nexthdr;
+            }
+        }
+        *hdr_len += ipv6_ext_header_len(proto, ext.hdrlen);
+        proto = ext.nexthdr;
+    }
+    *l4_found = !is_ipv6_ext_header(proto);
+    return proto;
+}
 
 
 #endif //__FLOW_HELPERS_H__
\ No newline at end of file
@@ -43,6 +43,13 @@ struct __udphdr {
 	__sum16 check;
 };
 
+struct __sctphdr {
+	__be16 source;
+	__be16 dest;
+	__be32 vtag;
+	__le32 checksum;
+};
+
 static __always_inline bool read_sk_buff(struct __sk_buff *skb, flow_id *id, u16 *custom_flags) {
     // we read the protocol just like here linux/samples/bpf/parse_ldabs.c
     u16 h_proto;
@@ -50,16 +57,18 @@ static __always_inline bool read_sk_buff(struct __sk_buff *skb, flow_id *id, u16
     h_proto = __bpf_htons(h_proto);
     id->eth_protocol = h_proto;
 
-    u8 hdr_len;
+    // u32 is required, as IPv6 extension headers can make the L4 header offset larger than 255
+    u32 hdr_len;
     u8 proto = 0;
+    bool l4_found = true;
     // do something similar as linux/samples/bpf/parse_varlen.c
     switch (h_proto) {
     case ETH_P_IP: {
         // ip4 header lengths are variable
         // access ihl as a u8 (linux/include/linux/skbuff.h)
-        bpf_skb_load_bytes(skb, ETH_HLEN, &hdr_len, sizeof(hdr_len));
-        hdr_len &= 0x0f;
-        hdr_len *= 4;
+        u8 ihl;
+        bpf_skb_load_bytes(skb, ETH_HLEN, &ihl, sizeof(ihl));
+        hdr_len = (ihl & 0x0f) * 4;
 
         /* verify hlen meets minimum size requirements */
         if (hdr_len < sizeof(struct iphdr)) {
@@ -91,6 +100,7 @@ static __always_inline bool read_sk_buff(struct __sk_buff *skb, flow_id *id, u16
         bpf_skb_load_bytes(skb, ETH_HLEN + offsetof(struct ipv6hdr, daddr), &id->dst_ip.s6_addr, sizeof(id->dst_ip.s6_addr));
 
         hdr_len = ETH_HLEN + sizeof(struct ipv6hdr);
+        proto = skip_ipv6_ext_headers(skb, &hdr_len, proto, &l4_found);
         break;
     default:
         return false;
@@ -99,6 +109,9 @@ static __always_inline bool read_sk_buff(struct __sk_buff *skb, flow_id *id, u16
     id->src_port = 0;
     id->dst_port = 0;
     id->transport_protocol = proto;
+    if (!l4_found) {
+        return true;
+    }
 
     switch(proto) {
         case IPPROTO_TCP: {
@@ -133,6 +146,29 @@ static __always_inline bool read_sk_buff(struct __sk_buff *skb, flow_id *id, u16
             id->src_port = __bpf_htons(port);
             bpf_skb_load_bytes(skb, hdr_len + offsetof(struct __udphdr, dest), &port, sizeof(port));
             id->dst_port = __bpf_htons(port);
+            break;
+        }
+        case IPPROTO_SCTP: {
+            // Ports are read from the SCTP common header. Since flows are identified by
+            // their IP addresses and ports, each path of a multi-homed association is
+            // accounted as a different flow.
+            u16 port;
+            bpf_skb_load_bytes(skb, hdr_len + offsetof(struct __sctphdr, source), &port, sizeof(port));
+            id->src_port = __bpf_htons(port);
+            bpf_skb_load_bytes(skb, hdr_len + offsetof(struct __sctphdr, dest), &port, sizeof(port));
+            id->dst_port = __bpf_htons(port);
+            break;
+        }
+        case IPPROTO_ICMP:
+        case IPPROTO_ICMPV6: {
+            // ICMP messages do not have ports. We store the ICMP type and code in the
+            // port fields of the flow, to account each type/code as a different flow.
+            // Type and code are the first two bytes in both ICMP and ICMPv6 headers.
+            u8 type_code[2];
+            bpf_skb_load_bytes(skb, hdr_len, type_code, sizeof(type_code));
+            id->src_port = type_code[0];
+            id->dst_port = type_code[1];
+            break;
         }
     }
 
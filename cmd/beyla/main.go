@@ -6,8 +6,6 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
-	"net/http"
-	_ "net/http/pprof"
 	"os"
 	"os/signal"
 	"syscall"
@@ -27,37 +25,36 @@ func main() {
 		Level: &lvl,
 	})))
 
-	slog.Info("Grafana Beyla", "Version", buildinfo.Version, "Revision", buildinfo.Revision, "OpenTelemetry SDK Version", otelsdk.Version())
-
-	if err := beyla.CheckOSSupport(); err != nil {
-		slog.Error("can't start Beyla", "error", err)
-		os.Exit(-1)
-	}
-
 	configPath := flag.String("config", "", "path to the configuration file")
+	validate := flag.Bool("validate", false, "validate the configuration, print the effective configuration"+
+		" and exit. It exits with a non-zero code if the configuration has any problem")
 	flag.Parse()
 
 	if cfg := os.Getenv("BEYLA_CONFIG_PATH"); cfg != "" {
 		configPath = &cfg
 	}
 
-	config := loadConfig(configPath)
-	if err := config.Validate(); err != nil {
-		slog.Error("wrong Beyla configuration", "error", err)
+	if *validate {
+		os.Exit(validateConfig(*configPath, os.Stdout, os.Stderr))
+	}
+
+	slog.Info("Grafana Beyla", "Version", buildinfo.Version, "Revision", buildinfo.Revision, "OpenTelemetry SDK Version", otelsdk.Version())
+
+	if err := beyla.CheckOSSupport(); err != nil {
+		slog.Error("can't start Beyla", "error", err)
 		os.Exit(-1)
 	}
 
-	if err := lvl.UnmarshalText([]byte(config.LogLevel)); err != nil {
-		slog.Error("unknown log level specified, choices are [DEBUG, INFO, WARN, ERROR]", err)
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		slog.Error("wrong Beyla configuration", "error", err)
 		os.Exit(-1)
 	}
 
-	if config.ProfilePort != 0 {
-		go func() {
-			slog.Info("starting PProf HTTP listener", "port", config.ProfilePort)
-			err := http.ListenAndServe(fmt.Sprintf(":%d", config.ProfilePort), nil)
-			slog.Error("PProf HTTP listener stopped working", err)
-		}()
+	logControls, err := components.SetupLogger(config, os.Stdout)
+	if err != nil {
+		slog.Error("wrong logging configuration", "error", err)
+		os.Exit(-1)
 	}
 
 	// Adding shutdown hook for graceful stop.
@@ -65,7 +62,9 @@ func main() {
 	// child process isn't found.
 	ctx, _ := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
-	components.RunBeyla(ctx, config)
+	components.RunBeylaWithReload(ctx, config, *configPath, func() (*beyla.Config, error) {
+		return loadConfig(*configPath)
+	}, logControls)
 
 	if gc := os.Getenv("GOCOVERDIR"); gc != "" {
 		slog.Info("Waiting 1s to collect coverage data...")
@@ -73,21 +72,58 @@ func main() {
 	}
 }
 
-func loadConfig(configPath *string) *beyla.Config {
+// loadConfig reads and validates the configuration from the provided file, or from
+// the environment variables if the file is not provided
+func loadConfig(configPath string) (*beyla.Config, error) {
+	config, err := readConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func readConfig(configPath string) (*beyla.Config, error) {
 	var configReader io.ReadCloser
-	if configPath != nil && *configPath != "" {
+	if configPath != "" {
 		var err error
-		if configReader, err = os.Open(*configPath); err != nil {
-			slog.Error("can't open "+*configPath, err)
-			os.Exit(-1)
+		if configReader, err = os.Open(configPath); err != nil {
+			return nil, fmt.Errorf("can't open %s: %w", configPath, err)
 		}
 		defer configReader.Close()
 	}
-	config, err := beyla.LoadConfig(configReader)
+	return beyla.LoadConfig(configReader)
+}
+
+// validateConfig reads the configuration and writes the effective configuration into the
+// provided output, and all the configuration problems into the error output. It does not
+// access the eBPF subsystem nor the network. It returns the exit code of the validation.
+func validateConfig(configPath string, out, errOut io.Writer) int {
+	config, err := readConfig(configPath)
 	if err != nil {
-		slog.Error("wrong configuration", err)
-		// nolint:gocritic
-		os.Exit(-1)
+		fmt.Fprintln(errOut, "ERROR:", err)
+		return 1
+	}
+	effective, err := config.EffectiveYAML()
+	if err != nil {
+		fmt.Fprintln(errOut, "ERROR: can't print the effective configuration:", err)
+		return 1
+	}
+	_, _ = out.Write(effective)
+	problems := config.Problems()
+	for _, problem := range problems {
+		if _, ok := problem.(beyla.ConfigWarning); ok {
+			fmt.Fprintln(errOut, "WARNING:", problem)
+		} else {
+			fmt.Fprintln(errOut, "ERROR:", problem)
+		}
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(errOut, "the configuration has %d problem(s)\n", len(problems))
+		return 1
 	}
-	return config
+	fmt.Fprintln(errOut, "the configuration is valid")
+	return 0
 }
@@ -3,6 +3,10 @@ package beyla
 import (
 	"fmt"
 	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"net/url"
 	"os"
 	"time"
 
@@ -10,14 +14,27 @@ import (
 	otelconsumer "go.opentelemetry.io/collector/consumer"
 	"gopkg.in/yaml.v3"
 
+	"github.com/grafana/beyla/pkg/internal/capture"
 	ebpfcommon "github.com/grafana/beyla/pkg/internal/ebpf/common"
+	"github.com/grafana/beyla/pkg/internal/export/alias"
 	"github.com/grafana/beyla/pkg/internal/export/debug"
 	"github.com/grafana/beyla/pkg/internal/export/metric"
+	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
 	"github.com/grafana/beyla/pkg/internal/export/otel"
 	"github.com/grafana/beyla/pkg/internal/export/prom"
 	"github.com/grafana/beyla/pkg/internal/filter"
+	"github.com/grafana/beyla/pkg/internal/health"
+	"github.com/grafana/beyla/pkg/internal/helpers"
 	"github.com/grafana/beyla/pkg/internal/imetrics"
+	"github.com/grafana/beyla/pkg/internal/leader"
+	"github.com/grafana/beyla/pkg/internal/loadshed"
+	"github.com/grafana/beyla/pkg/internal/logs"
+	"github.com/grafana/beyla/pkg/internal/memlimit"
+	"github.com/grafana/beyla/pkg/internal/pipe/queue"
+	"github.com/grafana/beyla/pkg/internal/pipe/shard"
+	"github.com/grafana/beyla/pkg/internal/profile"
 	"github.com/grafana/beyla/pkg/internal/traces"
+	"github.com/grafana/beyla/pkg/internal/transform/route"
 	"github.com/grafana/beyla/pkg/services"
 	"github.com/grafana/beyla/pkg/transform"
 )
@@ -39,11 +56,17 @@ const (
 var DefaultConfig = Config{
 	ChannelBufferLen: 10,
 	LogLevel:         "INFO",
+	LogFormat:        logs.FormatText,
+	LogDedup: logs.DedupConfig{
+		Burst:  10,
+		Period: time.Minute,
+	},
 	EBPF: ebpfcommon.TracerConfig{
-		BatchLength:  100,
-		BatchTimeout: time.Second,
-		BpfBaseDir:   "/var/run/beyla",
-		BpfPath:      fmt.Sprintf("beyla-%d", os.Getpid()),
+		BatchLength:           100,
+		BatchTimeout:          time.Second,
+		BpfBaseDir:            "/var/run/beyla",
+		BpfPath:               fmt.Sprintf("beyla-%d", os.Getpid()),
+		AttachmentCheckPeriod: 30 * time.Second,
 	},
 	Grafana: otel.GrafanaConfig{
 		OTLP: otel.GrafanaOTLP{
@@ -54,6 +77,11 @@ var DefaultConfig = Config{
 	NameResolver: &transform.NameResolverConfig{
 		CacheLen: 1024,
 		CacheTTL: 5 * time.Minute,
+		Prefer:   transform.PreferService,
+		ReverseDNS: transform.ReverseDNSConfig{
+			Workers:  4,
+			QueueLen: 256,
+		},
 	},
 	Metrics: otel.MetricsConfig{
 		Protocol:             otel.ProtocolUnset,
@@ -66,11 +94,15 @@ var DefaultConfig = Config{
 		TTL:                  defaultMetricsTTL,
 	},
 	Traces: otel.TracesConfig{
-		Protocol:           otel.ProtocolUnset,
-		TracesProtocol:     otel.ProtocolUnset,
-		MaxQueueSize:       4096,
-		MaxExportBatchSize: 4096,
-		ReportersCacheLen:  ReporterLRUSize,
+		Protocol:                otel.ProtocolUnset,
+		TracesProtocol:          otel.ProtocolUnset,
+		MaxQueueSize:            16384,
+		QueueErrorSpansFraction: 0.5,
+		RetryMaxElapsedTime:     time.Minute,
+		MaxExportBatchSize:      4096,
+		MaxExportBatchBytes:     3 * 1024 * 1024,
+		BatchTimeout:            time.Second,
+		ReportersCacheLen:       ReporterLRUSize,
 	},
 	Prometheus: prom.PrometheusConfig{
 		Path:                        "/metrics",
@@ -78,26 +110,90 @@ var DefaultConfig = Config{
 		Features:                    []string{otel.FeatureNetwork, otel.FeatureApplication},
 		TTL:                         defaultMetricsTTL,
 		SpanMetricsServiceCacheSize: 10000,
+		UnixSocketMode:              0o660,
 	},
 	Printer: false,
 	Noop:    false,
+	Capture: capture.Config{
+		Redact: []capture.Field{capture.RedactURLQuery},
+	},
 	InternalMetrics: imetrics.Config{
 		Prometheus: imetrics.PrometheusConfig{
-			Port: 0, // disabled by default
-			Path: "/internal/metrics",
+			Port:           0, // disabled by default
+			Path:           "/internal/metrics",
+			UnixSocketMode: 0o660,
 		},
 	},
+	Health: health.Config{
+		Port:            0, // uses the internal metrics port by default
+		CheckPeriod:     5 * time.Second,
+		DeadlockTimeout: time.Minute,
+	},
 	Attributes: Attributes{
 		InstanceID: traces.InstanceIDConfig{
 			HostnameDNSResolution: true,
 		},
 		Kubernetes: transform.KubernetesDecorator{
-			Enable:               transform.EnabledDefault,
-			InformersSyncTimeout: 30 * time.Second,
+			Enable:                       transform.EnabledDefault,
+			InformersSyncTimeout:         30 * time.Second,
+			MetadataSource:               transform.MetadataSourceInformers,
+			KubeletEndpoint:              "https://localhost:10250",
+			KubeletRefresh:               10 * time.Second,
+			DecorationWorkers:            1,
+			MetadataWait:                 5 * time.Second,
+			PodsCacheTTL:                 5 * time.Minute,
+			DeletedPodsGracePeriod:       30 * time.Second,
+			ProcessesSweepInterval:       time.Minute,
+			UnknownIPsCacheLen:           1024,
+			UnknownIPsCacheTTL:           time.Minute,
+			ExternalNamesRefresh:         30 * time.Second,
+			ExcludedNamespacesDecoration: transform.ExcludedDecorationNone,
+			MetadataSnapshotPeriod:       time.Minute,
+			MetadataSnapshotGrace:        time.Minute,
 		},
+		SemConv:         attr.SemConvStable,
+		DeprecatedNames: alias.None,
+	},
+	ConfigReload: ReloadConfig{
+		CheckPeriod: 10 * time.Second,
+	},
+	ShutdownTimeout: 10 * time.Second,
+	Routes:          &transform.RoutesConfig{},
+	NetworkFlows:    defaultNetworkConfig,
+	Memory: memlimit.Config{
+		LimitRatio:    0.9,
+		PressureRatio: 0.9,
+		CheckPeriod:   5 * time.Second,
+	},
+	// under pressure, the metrics generation is prioritized over the export of traces
+	PipelineQueues: map[string]queue.Config{
+		"appo11y.otel_traces":  {Overflow: queue.DropOldest},
+		"appo11y.alloy_traces": {Overflow: queue.DropOldest},
+	},
+	PipelineShards: shard.Config{
+		Count:    1,
+		Overflow: queue.DropOldest,
+	},
+	LoadShedding: loadshed.Config{
+		CheckPeriod:   time.Second,
+		BacklogHigh:   0.8,
+		BacklogLow:    0.2,
+		RecoveryDelay: 30 * time.Second,
+	},
+	LeaderElection: leader.Config{
+		LeaseName:     "beyla-leader",
+		LeaseDuration: 15 * time.Second,
+		RenewDeadline: 10 * time.Second,
+		RetryPeriod:   2 * time.Second,
 	},
-	Routes:       &transform.RoutesConfig{},
-	NetworkFlows: defaultNetworkConfig,
+}
+
+// ReloadConfig enables the reload of the configuration on SIGHUP or when the configuration file changes
+type ReloadConfig struct {
+	Enabled bool `yaml:"enabled" env:"BEYLA_CONFIG_RELOAD_ENABLED"`
+	// CheckPeriod is the time between two consecutive checks of changes in the configuration file.
+	// Zero disables the checks, so the configuration is only reloaded on SIGHUP.
+	CheckPeriod time.Duration `yaml:"check_period" env:"BEYLA_CONFIG_RELOAD_CHECK_PERIOD"`
 }
 
 type Config struct {
@@ -139,14 +235,54 @@ type Config struct {
 	Discovery services.DiscoveryConfig `yaml:"discovery"`
 
 	LogLevel string `yaml:"log_level" env:"BEYLA_LOG_LEVEL"`
+	// LogLevels overrides the LogLevel of the components (e.g. kube.Database) and their subcomponents
+	LogLevels map[string]string `yaml:"log_levels" env:"BEYLA_LOG_LEVELS"`
+	// LogFormat can be text or json
+	LogFormat string `yaml:"log_format" env:"BEYLA_LOG_FORMAT"`
+	// LogDedup limits the repeated warning and error messages
+	LogDedup logs.DedupConfig `yaml:"log_dedup"`
+
+	// ConfigReload allows updating some configuration properties without restarting Beyla
+	ConfigReload ReloadConfig `yaml:"config_reload"`
+
+	// ShutdownTimeout is the maximum time that Beyla waits, after receiving the SIGTERM signal,
+	// for the pipelines to forward and export their pending data.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"BEYLA_SHUTDOWN_TIMEOUT"`
+
+	// Memory sets the Go memory limit from the container memory limit, and reduces the memory
+	// usage of Beyla when it approaches the limit
+	Memory memlimit.Config `yaml:"memory"`
+
+	// PipelineQueues configures the size and the overflow policy of the input queue of the pipeline
+	// stages, by stage name
+	PipelineQueues map[string]queue.Config `yaml:"pipeline_queues"`
+
+	// PipelineShards splits the processing of the application spans in shards, by service, so a
+	// service with a huge volume of spans does not slow down the processing of the rest of services
+	PipelineShards shard.Config `yaml:"pipeline_shards"`
+
+	// LoadShedding progressively disables the most expensive processing of the application spans
+	// when Beyla falls behind the captured events, preserving the RED metrics as long as possible
+	LoadShedding loadshed.Config `yaml:"load_shedding"`
+
+	// LeaderElection elects a leader among the Beyla instances of a Kubernetes cluster, which runs
+	// the responsibilities that only need to happen once per cluster
+	LeaderElection leader.Config `yaml:"leader_election"`
+
+	// Capture records the spans that are read from the eBPF tracers, or replays a recording of them,
+	// to reproduce the issues of the decoration and the exporters in another environment
+	Capture capture.Config `yaml:"capture"`
 
 	// From this comment, the properties below will remain undocumented, as they
 	// are useful for development purposes. They might be helpful for customer support.
 
 	ChannelBufferLen int               `yaml:"channel_buffer_len" env:"BEYLA_CHANNEL_BUFFER_LEN"`
 	Noop             debug.NoopEnabled `yaml:"noop" env:"BEYLA_NOOP_TRACES"`
-	ProfilePort      int               `yaml:"profile_port" env:"BEYLA_PROFILE_PORT"`
-	InternalMetrics  imetrics.Config   `yaml:"internal_metrics"`
+	// Deprecated: use Profile.Port instead
+	ProfilePort     int             `yaml:"profile_port"`
+	Profile         profile.Config  `yaml:"profile"`
+	InternalMetrics imetrics.Config `yaml:"internal_metrics"`
+	Health          health.Config   `yaml:"health"`
 
 	// Grafana Agent specific configuration
 	TracesReceiver TracesReceiverConfig `yaml:"-"`
@@ -170,6 +306,10 @@ type Attributes struct {
 	Kubernetes transform.KubernetesDecorator `yaml:"kubernetes"`
 	InstanceID traces.InstanceIDConfig       `yaml:"instance_id"`
 	Select     metric.Selection              `yaml:"select"`
+	// SemConv selects the semantic conventions of the reported HTTP and RPC attributes: stable, old or both
+	SemConv attr.SemConvStability `yaml:"semconv" env:"BEYLA_SEMCONV_STABILITY"`
+	// DeprecatedNames reports the former names of the renamed Beyla metrics and attributes: none, both or only
+	DeprecatedNames alias.Mode `yaml:"deprecated_names" env:"BEYLA_DEPRECATED_NAMES"`
 }
 
 type ConfigError string
@@ -178,38 +318,213 @@ func (e ConfigError) Error() string {
 	return string(e)
 }
 
-// nolint:cyclop
+// ConfigWarning is a configuration problem that does not prevent Beyla from running, but
+// probably does not behave as the user expects (e.g. an attribute selector that does not match
+// any attribute).
+type ConfigWarning string
+
+func (e ConfigWarning) Error() string {
+	return string(e)
+}
+
+// Validate returns the first error found in the configuration, if any. The problems that don't
+// prevent Beyla from running (ConfigWarning) are logged.
 func (c *Config) Validate() error {
+	var warnings []error
+	for _, problem := range c.Problems() {
+		if _, ok := problem.(ConfigWarning); ok {
+			warnings = append(warnings, problem)
+			continue
+		}
+		return problem
+	}
+	for _, warning := range warnings {
+		slog.Warn("configuration problem", "problem", warning.Error())
+	}
+	if c.Enabled(FeatureNetO11y) && c.NetworkFlows.FlowHistograms {
+		c.logFlowHistogramsSeries()
+	}
+	return nil
+}
+
+// Problems returns all the problems found in the configuration, as ConfigError or ConfigWarning,
+// without accessing the eBPF subsystem or the network. When a problem can be located, its
+// message starts with the YAML path of the wrong property.
+// nolint:cyclop
+func (c *Config) Problems() []error {
+	var problems []error
+	located := func(path, format string, args ...any) string {
+		msg := fmt.Sprintf(format, args...)
+		if path != "" {
+			msg = path + ": " + msg
+		}
+		return msg
+	}
+	problem := func(path, format string, args ...any) {
+		problems = append(problems, ConfigError(located(path, format, args...)))
+	}
+	warning := func(path, format string, args ...any) {
+		problems = append(problems, ConfigWarning(located(path, format, args...)))
+	}
 	if err := c.Discovery.Services.Validate(); err != nil {
-		return ConfigError(fmt.Sprintf("error in services YAML property: %s", err.Error()))
+		problem("", "%s", err.Error())
 	}
 	if !c.Enabled(FeatureNetO11y) && !c.Enabled(FeatureAppO11y) {
-		return ConfigError("missing at least one of BEYLA_NETWORK_METRICS, BEYLA_EXECUTABLE_NAME or BEYLA_OPEN_PORT property")
+		problem("", "missing at least one of BEYLA_NETWORK_METRICS, BEYLA_EXECUTABLE_NAME or BEYLA_OPEN_PORT property")
 	}
 	if (c.Port.Len() > 0 || c.Exec.IsSet() || len(c.Discovery.Services) > 0) && c.Discovery.SystemWide {
-		return ConfigError("you can't use BEYLA_SYSTEM_WIDE if any of BEYLA_EXECUTABLE_NAME, BEYLA_OPEN_PORT or services (YAML) are set")
+		problem("discovery.system_wide", "you can't use BEYLA_SYSTEM_WIDE if any of BEYLA_EXECUTABLE_NAME, BEYLA_OPEN_PORT or services (YAML) are set")
 	}
 	if c.EBPF.BatchLength == 0 {
-		return ConfigError("BEYLA_BPF_BATCH_LENGTH must be at least 1")
+		problem("ebpf.batch_length", "BEYLA_BPF_BATCH_LENGTH must be at least 1")
 	}
 
 	if c.Enabled(FeatureNetO11y) && !c.Grafana.OTLP.MetricsEnabled() && !c.Metrics.Enabled() &&
 		!c.Prometheus.Enabled() && !c.NetworkFlows.Print {
-		return ConfigError("enabling network metrics requires to enable at least the OpenTelemetry" +
-			" metrics exporter: grafana, otel_metrics_export or prometheus_export sections in the YAML configuration file; or the" +
-			" OTEL_EXPORTER_OTLP_ENDPOINT, OTEL_EXPORTER_OTLP_METRICS_ENDPOINT or BEYLA_PROMETHEUS_PORT environment variables. For debugging" +
+		problem("", "enabling network metrics requires to enable at least the OpenTelemetry"+
+			" metrics exporter: grafana, otel_metrics_export or prometheus_export sections in the YAML configuration file; or the"+
+			" OTEL_EXPORTER_OTLP_ENDPOINT, OTEL_EXPORTER_OTLP_METRICS_ENDPOINT or BEYLA_PROMETHEUS_PORT environment variables. For debugging"+
 			" purposes, you can also set BEYLA_NETWORK_PRINT_FLOWS=true")
 	}
+	for _, cidr := range c.NetworkFlows.CIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			problem("network.cidrs", "invalid CIDR %q", cidr)
+		}
+	}
+
+	if _, err := logs.ParseLevel(c.LogLevel); err != nil {
+		problem("log_level", "%s", err.Error())
+	}
+	for _, component := range helpers.SortedKeys(c.LogLevels) {
+		if _, err := logs.ParseLevel(c.LogLevels[component]); err != nil {
+			problem("log_levels."+component, "%s", err.Error())
+		}
+	}
+	if c.LogFormat != logs.FormatText && c.LogFormat != logs.FormatJSON {
+		problem("log_format", "unknown log format %q, choices are [%s, %s]",
+			c.LogFormat, logs.FormatText, logs.FormatJSON)
+	}
+
+	if c.NameResolver != nil {
+		if err := c.NameResolver.Validate(); err != nil {
+			problem("name_resolver.prefer", "%s", err.Error())
+		}
+	}
+
+	if err := c.Memory.Validate(); err != nil {
+		problem("memory", "%s", err.Error())
+	}
+	for _, stage := range helpers.SortedKeys(c.PipelineQueues) {
+		q := c.PipelineQueues[stage]
+		if err := q.Validate(); err != nil {
+			problem("pipeline_queues."+stage, "%s", err.Error())
+		}
+	}
+	if err := c.PipelineShards.Validate(); err != nil {
+		problem("pipeline_shards", "%s", err.Error())
+	}
+	if err := c.LoadShedding.Validate(); err != nil {
+		problem("load_shedding", "%s", err.Error())
+	}
+	if err := c.Attributes.Kubernetes.Validate(); err != nil {
+		problem("attributes.kubernetes.service_name_sources", "%s", err.Error())
+	}
+	if err := c.LeaderElection.Validate(); err != nil {
+		problem("leader_election", "%s", err.Error())
+	}
+	if err := c.Capture.Validate(); err != nil {
+		problem("capture", "%s", err.Error())
+	}
+
+	if c.Routes != nil {
+		for _, pattern := range c.Routes.Patterns {
+			if err := route.ValidatePattern(pattern); err != nil {
+				warning("routes.patterns", "%s", err.Error())
+			}
+		}
+		for _, pattern := range c.Routes.IgnorePatterns {
+			if err := route.ValidatePattern(pattern); err != nil {
+				warning("routes.ignored_patterns", "%s", err.Error())
+			}
+		}
+	}
+	if err := c.Attributes.SemConv.Validate(); err != nil {
+		problem("attributes.semconv", "%s", err.Error())
+	}
+	if err := c.Attributes.DeprecatedNames.Validate(); err != nil {
+		problem("attributes.deprecated_names", "%s", err.Error())
+	}
+	for _, err := range c.Attributes.Select.Validate(c.Attributes.Kubernetes.NamespaceLabelAttributes()...) {
+		warning("attributes.select", "%s", err.Error())
+	}
+
+	if c.Profile.InternalPort && !c.InternalMetrics.Prometheus.Enabled() {
+		problem("profile.internal_port", "serving the profiling endpoints from the internal metrics port requires"+
+			" to define BEYLA_INTERNAL_METRICS_PROMETHEUS_PORT or BEYLA_INTERNAL_METRICS_PROMETHEUS_UNIX_SOCKET")
+	}
+
+	if c.Attributes.Kubernetes.DebugEndpoint && !c.InternalMetrics.Prometheus.Enabled() {
+		problem("attributes.kubernetes.debug_endpoint", "serving the Kubernetes debug endpoint requires"+
+			" to define BEYLA_INTERNAL_METRICS_PROMETHEUS_PORT or BEYLA_INTERNAL_METRICS_PROMETHEUS_UNIX_SOCKET")
+	}
 
 	if c.Enabled(FeatureAppO11y) && !c.Noop.Enabled() && !c.Printer.Enabled() &&
 		!c.Grafana.OTLP.MetricsEnabled() && !c.Grafana.OTLP.TracesEnabled() &&
 		!c.Metrics.Enabled() && !c.Traces.Enabled() &&
 		!c.Prometheus.Enabled() {
-		return ConfigError("you need to define at least one exporter: print_traces," +
+		problem("", "you need to define at least one exporter: print_traces,"+
 			" grafana, otel_metrics_export, otel_traces_export or prometheus_export")
 	}
+	metrics := c.Metrics
+	metrics.Grafana = &c.Grafana.OTLP
+	if metrics.EndpointEnabled() {
+		if _, err := metrics.EndpointAddress(); err != nil {
+			problem("otel_metrics_export.endpoint", "%s", err.Error())
+		}
+	}
+	traces := c.Traces
+	traces.Grafana = &c.Grafana.OTLP
+	if traces.Enabled() {
+		if _, err := traces.EndpointAddress(); err != nil {
+			problem("otel_traces_export.endpoint", "%s", err.Error())
+		}
+	}
+	for _, b := range []struct {
+		path    string
+		buckets []float64
+	}{
+		{path: "otel_metrics_export.buckets.duration_histogram", buckets: c.Metrics.Buckets.DurationHistogram},
+		{path: "otel_metrics_export.buckets.request_size_histogram", buckets: c.Metrics.Buckets.RequestSizeHistogram},
+		{path: "prometheus_export.buckets.duration_histogram", buckets: c.Prometheus.Buckets.DurationHistogram},
+		{path: "prometheus_export.buckets.request_size_histogram", buckets: c.Prometheus.Buckets.RequestSizeHistogram},
+	} {
+		for i := 1; i < len(b.buckets); i++ {
+			if b.buckets[i] <= b.buckets[i-1] {
+				problem(b.path, "bucket boundaries must be in increasing order. Got %v after %v", b.buckets[i], b.buckets[i-1])
+				break
+			}
+		}
+	}
 
-	return nil
+	return problems
+}
+
+// logFlowHistogramsSeries warns about the number of series that the network flow histograms
+// add to each combination of the network metrics attributes
+func (c *Config) logFlowHistogramsSeries() {
+	buckets := c.Metrics.Buckets
+	if c.Prometheus.Enabled() {
+		buckets = c.Prometheus.Buckets
+	}
+	// each histogram reports a series for each bucket, plus the +Inf bucket, the sum and the count
+	sizeSeries := len(buckets.RequestSizeHistogram) + 3
+	durationSeries := len(buckets.DurationHistogram) + 3
+	slog.Warn("network flow histograms are enabled. Each combination of network attributes"+
+		" is reported in multiple series. Consider reducing the number of attributes or buckets",
+		"flowBytesSeries", 1,
+		"flowSizeSeries", sizeSeries,
+		"flowDurationSeries", durationSeries,
+		"totalSeries", 1+sizeSeries+durationSeries)
 }
 
 // Enabled checks if a given Beyla feature is enabled according to the global configuration
@@ -218,7 +533,8 @@ func (c *Config) Enabled(feature Feature) bool {
 	case FeatureNetO11y:
 		return c.NetworkFlows.Enable
 	case FeatureAppO11y:
-		return c.Port.Len() > 0 || c.Exec.IsSet() || len(c.Discovery.Services) > 0 || c.Discovery.SystemWide
+		return c.Port.Len() > 0 || c.Exec.IsSet() || len(c.Discovery.Services) > 0 || c.Discovery.SystemWide ||
+			c.Capture.ReplayFile != ""
 	}
 	return false
 }
@@ -229,6 +545,11 @@ func (c *Config) Enabled(feature Feature) bool {
 // 3 - Environment variables
 func LoadConfig(file io.Reader) (*Config, error) {
 	cfg := DefaultConfig
+	// copy the default values that are referenced by pointers, so loading a configuration
+	// does not override the default values of further loads (e.g. on configuration reload)
+	routes, nameResolver := *DefaultConfig.Routes, *DefaultConfig.NameResolver
+	cfg.Routes, cfg.NameResolver = &routes, &nameResolver
+	cfg.PipelineQueues = maps.Clone(DefaultConfig.PipelineQueues)
 	if file != nil {
 		cfgBuf, err := io.ReadAll(file)
 		if err != nil {
@@ -249,3 +570,24 @@ func LoadConfig(file io.Reader) (*Config, error) {
 
 	return &cfg, nil
 }
+
+// EffectiveYAML returns the YAML representation of the configuration, after applying the default
+// values and the environment variables. The secrets are redacted.
+func (c *Config) EffectiveYAML() ([]byte, error) {
+	effective := *c
+	if effective.Grafana.OTLP.APIKey != "" {
+		effective.Grafana.OTLP.APIKey = "<redacted>"
+	}
+	effective.Metrics.MetricsEndpoint = redactURL(effective.Metrics.MetricsEndpoint)
+	effective.Traces.TracesEndpoint = redactURL(effective.Traces.TracesEndpoint)
+	return yaml.Marshal(&effective)
+}
+
+// redactURL hides the password of the URL, if any
+func redactURL(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	return u.Redacted()
+}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/grafana/beyla/pkg/internal/netolly/flow"
 	"github.com/grafana/beyla/pkg/internal/netolly/transform/cidr"
+	"github.com/grafana/beyla/pkg/internal/netolly/transform/process"
 )
 
 const (
@@ -101,12 +102,30 @@ type NetworkConfig struct {
 	// ListenInterfaces value is set to "poll".
 	ListenPollPeriod time.Duration `yaml:"listen_poll_period" env:"BEYLA_NETWORK_LISTEN_POLL_PERIOD"`
 
+	// ReportTunnelOuterFlows, if true, reports the outer (node to node) flows of VXLAN and Geneve
+	// encapsulated traffic, besides the flows of the encapsulated packets.
+	// Only supported when the Source is "tc".
+	ReportTunnelOuterFlows bool `yaml:"report_tunnel_outer_flows" env:"BEYLA_NETWORK_REPORT_TUNNEL_OUTER_FLOWS"`
+
 	// ReverseDNS allows flows that haven't been previously decorated with any source/destination name
 	// to override the name with the network hostname of the source and destination IPs.
 	// This is an experimental feature and it is not guaranteed to work on most virtualized environments
 	// for external traffic.
 	ReverseDNS flow.ReverseDNS `yaml:"reverse_dns"`
 
+	// ICMPEchoRTT enables the estimation of the round-trip time between the ICMP Echo Request
+	// and Echo Reply flows, reported in the beyla.network.icmp.rtt histogram metric.
+	ICMPEchoRTT flow.ICMPEchoRTT `yaml:"icmp_echo_rtt"`
+
+	// FlowHistograms enables the beyla.network.flow.size and beyla.network.flow.duration histograms,
+	// which record the size and duration of each flow as observed when it is evicted from the
+	// accounting cache.
+	FlowHistograms bool `yaml:"flow_histograms" env:"BEYLA_NETWORK_FLOW_HISTOGRAMS"`
+
+	// ProcessAttribution decorates the flows with the name of the local processes that own the
+	// source and destination sockets, as the "src.process.name" and "dst.process.name" attributes.
+	ProcessAttribution process.Attribution `yaml:"process_attribution"`
+
 	// Print the network flows in the Standard Output, if true
 	Print bool `yaml:"print_flows" env:"BEYLA_NETWORK_PRINT_FLOWS"`
 
@@ -135,4 +154,10 @@ var defaultNetworkConfig = NetworkConfig{
 		CacheLen: 256,
 		CacheTTL: time.Hour,
 	},
+	ICMPEchoRTT: flow.ICMPEchoRTT{
+		MaxWait: 10 * time.Second,
+	},
+	ProcessAttribution: process.Attribution{
+		RefreshPeriod: 5 * time.Second,
+	},
 }
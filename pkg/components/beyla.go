@@ -2,31 +2,111 @@ package components
 
 import (
 	"context"
+	"io"
 	"log/slog"
+	"net"
 	"os"
+	"slices"
+	"strconv"
 	"sync"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
 
 	"github.com/grafana/beyla/pkg/beyla"
 	"github.com/grafana/beyla/pkg/internal/appolly"
+	"github.com/grafana/beyla/pkg/internal/capabilities"
 	"github.com/grafana/beyla/pkg/internal/connector"
+	"github.com/grafana/beyla/pkg/internal/ebpf/attachment"
+	ebpfcommon "github.com/grafana/beyla/pkg/internal/ebpf/common"
+	"github.com/grafana/beyla/pkg/internal/ebpf/diagnostics"
+	"github.com/grafana/beyla/pkg/internal/export/alias"
 	"github.com/grafana/beyla/pkg/internal/export/metric"
+	"github.com/grafana/beyla/pkg/internal/goexec"
+	"github.com/grafana/beyla/pkg/internal/health"
 	"github.com/grafana/beyla/pkg/internal/imetrics"
+	"github.com/grafana/beyla/pkg/internal/kube"
+	"github.com/grafana/beyla/pkg/internal/leader"
+	"github.com/grafana/beyla/pkg/internal/logs"
+	"github.com/grafana/beyla/pkg/internal/memlimit"
 	"github.com/grafana/beyla/pkg/internal/netolly/agent"
 	"github.com/grafana/beyla/pkg/internal/netolly/flow"
 	"github.com/grafana/beyla/pkg/internal/pipe/global"
+	"github.com/grafana/beyla/pkg/internal/profile"
+	"github.com/grafana/beyla/pkg/internal/reload"
+	"github.com/grafana/beyla/pkg/transform"
 )
 
 // RunBeyla in the foreground process. This is a blocking function and won't exit
 // until both the AppO11y and NetO11y components end
 func RunBeyla(ctx context.Context, cfg *beyla.Config) {
+	RunBeylaWithReload(ctx, cfg, "", nil, nil)
+}
+
+// SetupLogger replaces the default logger with a logger that writes into the provided output,
+// according to the logging options of the configuration: format, global and per-component log levels,
+// and deduplication of repeated messages. The returned controls can be passed to RunBeylaWithReload
+// to update the logger at runtime.
+func SetupLogger(cfg *beyla.Config, out io.Writer) (*logs.Controls, error) {
+	levels, err := logs.NewLevels(cfg.LogLevel, cfg.LogLevels)
+	if err != nil {
+		return nil, err
+	}
+	controls := &logs.Controls{Levels: levels}
+	if cfg.LogDedup.Burst > 0 {
+		controls.Dedup = logs.NewDedup(&cfg.LogDedup)
+	}
+	handler, err := logs.NewHandler(out, cfg.LogFormat, levels, controls.Dedup)
+	if err != nil {
+		return nil, err
+	}
+	slog.SetDefault(slog.New(handler))
+	return controls, nil
+}
+
+// RunBeylaWithReload runs Beyla as RunBeyla, but if the configuration reload is enabled, it
+// reloads the configuration with the provided function each time Beyla receives the SIGHUP
+// signal or the provided configuration file changes. If not nil, the provided logger controls
+// are updated when the log_level or log_levels properties change.
+func RunBeylaWithReload(
+	ctx context.Context, cfg *beyla.Config,
+	configFile string, load func() (*beyla.Config, error), logControls *logs.Controls,
+) {
 	ctxInfo := buildCommonContextInfo(cfg)
+	if logControls != nil && logControls.Dedup != nil {
+		logControls.Dedup.ReportTo(ctxInfo.Metrics.LogSuppressed)
+		go logControls.Dedup.Start(ctx)
+	}
+	// the exporters keep working after the main context is canceled, until the pipelines
+	// are drained or the shutdown timeout expires
+	exportCtx, stopExport := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopExport()
+	ctxInfo.ExportCtx = exportCtx
+	startMemoryMonitor(ctx, cfg, ctxInfo)
+	startLeaderElection(ctx, cfg, ctxInfo)
+	resolveClusterName(ctx, cfg, ctxInfo)
+	caps, disabled := checkCapabilities(cfg)
+	app, net := enabledFeatures(cfg, disabled)
+	ctxInfo.Build = global.BuildInfo{
+		Features:      featureNames(app, net),
+		KernelRelease: ebpfcommon.KernelRelease(),
+	}
+	startReport(ctx, cfg, ctxInfo, caps, disabled)
+	startAttachmentWatchdog(ctx, cfg, ctxInfo)
+	startProfiling(ctx, cfg, ctxInfo)
+	startHealth(ctx, cfg, ctxInfo)
+	if cfg.ConfigReload.Enabled && load != nil {
+		ctxInfo.Reload = reload.NewAppliers()
+		if logControls != nil {
+			reload.OnChange(ctxInfo.Reload, "log_level", logControls.Levels.SetGlobal)
+			reload.OnChange(ctxInfo.Reload, "log_levels", logControls.Levels.SetComponents)
+		}
+	}
 
 	wg := sync.WaitGroup{}
-	app := cfg.Enabled(beyla.FeatureAppO11y)
 	if app {
 		wg.Add(1)
 	}
-	net := cfg.Enabled(beyla.FeatureNetO11y)
 	if net {
 		wg.Add(1)
 	}
@@ -43,7 +123,198 @@ func RunBeyla(ctx context.Context, cfg *beyla.Config) {
 			setupNetO11y(ctx, ctxInfo, cfg)
 		}()
 	}
-	wg.Wait()
+	startReload(ctx, cfg, ctxInfo, configFile, load)
+	waitForShutdown(ctx, cfg.ShutdownTimeout, &wg, stopExport)
+}
+
+// waitForShutdown waits for the pipelines to end. Once the main context is canceled, the
+// pipelines stop reading new events, and forward and export their pending data until they are
+// drained, or the timeout expires. Then the exporters are stopped.
+func waitForShutdown(ctx context.Context, timeout time.Duration, wg *sync.WaitGroup, stopExport func()) {
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return
+	case <-ctx.Done():
+	}
+	start := time.Now()
+	slog.Info("stopping Beyla. Flushing pending data", "timeout", timeout)
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	deadlineExceeded := false
+	select {
+	case <-drained:
+	case <-deadline.C:
+		deadlineExceeded = true
+	}
+	stopExport()
+	slog.Info("Beyla stopped", "shutdownDuration", time.Since(start), "deadlineExceeded", deadlineExceeded)
+}
+
+// startMemoryMonitor sets the Go memory limit from the container memory limit and, if the memory
+// is limited, notifies the components when the memory usage approaches the limit
+func startMemoryMonitor(ctx context.Context, cfg *beyla.Config, ctxInfo *global.ContextInfo) {
+	limit := memlimit.SetLimit(&cfg.Memory)
+	if limit <= 0 {
+		return
+	}
+	ctxInfo.MemoryPressure = memlimit.NewPressure()
+	memlimit.NewMonitor(&cfg.Memory, limit, ctxInfo.MemoryPressure, ctxInfo.Metrics).Start(ctx)
+}
+
+// checkCapabilities probes the capabilities of the Beyla process and disables the enabled features
+// that they don't permit, reporting which capability is missing for each of them
+func checkCapabilities(cfg *beyla.Config) (capabilities.Set, []capabilities.Disabled) {
+	caps, err := capabilities.Current()
+	if err != nil {
+		slog.Warn("can't check the capabilities of Beyla. Assuming that they permit all the features",
+			"error", err)
+		return caps, nil
+	}
+	slog.Debug("checking Beyla capabilities", "effective", caps)
+	var features []capabilities.Feature
+	if cfg.Enabled(beyla.FeatureAppO11y) {
+		features = append(features,
+			capabilities.FeatureAppO11y,
+			capabilities.FeatureAppSocketFilter,
+			capabilities.FeatureAppLibraries,
+			capabilities.FeatureContextPropagation)
+	}
+	if cfg.Enabled(beyla.FeatureNetO11y) {
+		if cfg.NetworkFlows.Source == beyla.EbpfSourceSock {
+			features = append(features, capabilities.FeatureNetO11ySocketFilter)
+		} else {
+			features = append(features, capabilities.FeatureNetO11yTC)
+		}
+	}
+	disabled := caps.Check(features...)
+	for _, d := range disabled {
+		slog.Warn("feature disabled because of missing capabilities", "feature", d.Feature, "missing", d.Missing)
+		switch d.Feature {
+		case capabilities.FeatureAppSocketFilter:
+			ebpfcommon.SocketFiltersDisabled = true
+		case capabilities.FeatureAppLibraries:
+			ebpfcommon.SharedLibrariesDisabled = true
+		case capabilities.FeatureContextPropagation:
+			ebpfcommon.IntegrityModeOverride = true
+		}
+	}
+	return caps, disabled
+}
+
+// enabledFeatures returns whether the application and network observability features are
+// enabled by the configuration and permitted by the capabilities of Beyla
+func enabledFeatures(cfg *beyla.Config, disabled []capabilities.Disabled) (app, net bool) {
+	app = cfg.Enabled(beyla.FeatureAppO11y) && !isDisabled(disabled, capabilities.FeatureAppO11y)
+	net = cfg.Enabled(beyla.FeatureNetO11y) &&
+		!isDisabled(disabled, capabilities.FeatureNetO11yTC, capabilities.FeatureNetO11ySocketFilter)
+	return app, net
+}
+
+// featureNames returns the names of the enabled features, as reported in the runtime report
+// and the build information
+func featureNames(app, net bool) []string {
+	names := []string{}
+	if app {
+		names = append(names, "application")
+	}
+	if net {
+		names = append(names, "network")
+	}
+	return names
+}
+
+func isDisabled(disabled []capabilities.Disabled, features ...capabilities.Feature) bool {
+	for _, d := range disabled {
+		if slices.Contains(features, d.Feature) {
+			return true
+		}
+	}
+	return false
+}
+
+// startLeaderElection competes for the leadership of the cluster-scoped responsibilities, if the
+// leader election is enabled. If it can't be started, the responsibilities run in this instance.
+func startLeaderElection(ctx context.Context, cfg *beyla.Config, ctxInfo *global.ContextInfo) {
+	if !cfg.LeaderElection.Enable {
+		return
+	}
+	identity, err := os.Hostname()
+	if err != nil {
+		slog.Error("can't get the identity for the leader election. Disabling it", "error", err)
+		return
+	}
+	kubeConfig, err := cfg.Attributes.Kubernetes.ClientConfig().Load()
+	if err != nil {
+		slog.Error("can't read kubernetes config. Disabling the leader election", "error", err)
+		return
+	}
+	client, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		slog.Error("can't init Kubernetes client. Disabling the leader election", "error", err)
+		return
+	}
+	elector := leader.NewElector(&cfg.LeaderElection, identity, ctxInfo.Metrics)
+	if err := elector.Start(ctx, client); err != nil {
+		slog.Error("can't start the leader election. Disabling it", "error", err)
+		return
+	}
+	ctxInfo.Leader = elector
+}
+
+// resolveClusterName starts resolving in background the name of the Kubernetes cluster, which is shared by
+// the decoration of the spans and the network flows, so both report the same name
+func resolveClusterName(ctx context.Context, cfg *beyla.Config, ctxInfo *global.ContextInfo) {
+	if !ctxInfo.K8sEnabled {
+		return
+	}
+	k8sCfg := &cfg.Attributes.Kubernetes
+	// without access to the API server, the cloud provider metadata is the only source of the name
+	var client kubernetes.Interface
+	if k8sCfg.ClusterName == "" && k8sCfg.MetadataSource != transform.MetadataSourceKubelet {
+		if kubeConfig, err := k8sCfg.ClientConfig().Load(); err != nil {
+			slog.Debug("can't read kubernetes config. The cluster name is only fetched from the cloud provider", "error", err)
+		} else if clientset, err := kubernetes.NewForConfig(kubeConfig); err != nil {
+			slog.Debug("can't init Kubernetes client. The cluster name is only fetched from the cloud provider", "error", err)
+		} else {
+			client = clientset
+		}
+	}
+	ctxInfo.K8sClusterName = kube.ResolveClusterName(ctx, client, k8sCfg.ClusterName)
+}
+
+// startAttachmentWatchdog verifies periodically that the eBPF programs are still attached, if the
+// verification is enabled, and reports readiness failure when they can't be re-attached
+func startAttachmentWatchdog(ctx context.Context, cfg *beyla.Config, ctxInfo *global.ContextInfo) {
+	if cfg.EBPF.AttachmentCheckPeriod <= 0 {
+		return
+	}
+	ctxInfo.Attachments = attachment.NewWatchdog(cfg.EBPF.AttachmentCheckPeriod, ctxInfo.Metrics)
+	ctxInfo.Health.Readiness("ebpf.attachments", ctxInfo.Attachments.Check)
+	ctxInfo.Attachments.Start(ctx)
+}
+
+// startReload starts watching for configuration changes, once all the components have had the
+// chance to register their appliers. Changes received before the components register their appliers
+// are logged as requiring a restart.
+func startReload(
+	ctx context.Context, cfg *beyla.Config, ctxInfo *global.ContextInfo,
+	configFile string, load func() (*beyla.Config, error),
+) {
+	if ctxInfo.Reload == nil {
+		return
+	}
+	reloader, err := reload.NewReloader(ctxInfo.Reload, ctxInfo.Metrics, load)
+	if err != nil {
+		slog.Error("can't enable configuration reload", "error", err)
+		return
+	}
+	slog.Info("configuration reload enabled", "file", configFile, "checkPeriod", cfg.ConfigReload.CheckPeriod)
+	reloader.Start(ctx, configFile, cfg.ConfigReload.CheckPeriod)
 }
 
 func setupAppO11y(ctx context.Context, ctxInfo *global.ContextInfo, config *beyla.Config) {
@@ -53,6 +324,9 @@ func setupAppO11y(ctx context.Context, ctxInfo *global.ContextInfo, config *beyl
 	// 1st process (privileged) - Invoke FindTarget, which also mounts the BPF maps
 	// 2nd executable (unprivileged) - Invoke ReadAndForward, receiving the BPF map mountpoint as argument
 
+	if config.EBPF.GoOffsetsFile != "" {
+		goexec.WatchExternalOffsets(ctx, config.EBPF.GoOffsetsFile)
+	}
 	instr := appolly.New(ctx, ctxInfo, config)
 	if err := instr.FindAndInstrument(); err != nil {
 		slog.Error("Beyla couldn't find target process", "error", err)
@@ -86,8 +360,13 @@ func buildCommonContextInfo(
 	ctxInfo := &global.ContextInfo{
 		Prometheus: promMgr,
 		K8sEnabled: config.Attributes.Kubernetes.Enabled(),
+		SemConv:    config.Attributes.SemConv,
+		Aliases:    alias.New(config.Attributes.DeprecatedNames),
 	}
-	if config.InternalMetrics.Prometheus.Port != 0 {
+	if ctxInfo.Aliases != nil {
+		promMgr.GatherWith(ctxInfo.Aliases.Gatherer)
+	}
+	if config.InternalMetrics.Prometheus.Enabled() {
 		slog.Debug("reporting internal metrics as Prometheus")
 		ctxInfo.Metrics = imetrics.NewPrometheusReporter(&config.InternalMetrics.Prometheus, promMgr)
 		// Prometheus manager also has its own internal metrics, so we need to pass the imetrics reporter
@@ -98,16 +377,91 @@ func buildCommonContextInfo(
 		ctxInfo.Metrics = imetrics.NoopReporter{}
 	}
 
+	ctxInfo.Diagnostics = diagnostics.NewReporter(config.EBPF.BpfDebug, ctxInfo.Metrics)
+	ctxInfo.Health = health.NewReporter(&config.Health)
+	ctxInfo.Health.Readiness("exporters", exportersCheck(config))
+
 	attributeGroups(config, ctxInfo)
 
 	return ctxInfo
 }
 
+// startHealth serves the liveness and readiness endpoints from the health port or,
+// if it is not defined, from the internal metrics port and Unix socket.
+func startHealth(ctx context.Context, config *beyla.Config, ctxInfo *global.ContextInfo) {
+	port := config.Health.Port
+	if port == 0 {
+		if !config.InternalMetrics.Prometheus.Enabled() {
+			slog.Debug("not serving health endpoints")
+			return
+		}
+		port = config.InternalMetrics.Prometheus.Port
+	}
+	slog.Debug("serving health endpoints", "port", port)
+	ctxInfo.Prometheus.Handle(port, health.LivenessPath, ctxInfo.Health.LivenessHandler())
+	ctxInfo.Prometheus.Handle(port, health.ReadinessPath, ctxInfo.Health.ReadinessHandler())
+	go ctxInfo.Health.Start(ctx)
+	ctxInfo.Prometheus.StartHTTP(ctx)
+}
+
+// startProfiling enables the profiling features, and serves the pprof endpoints from the
+// internal metrics port if required
+func startProfiling(ctx context.Context, config *beyla.Config, ctxInfo *global.ContextInfo) {
+	cfg := config.Profile
+	if cfg.Port == 0 && config.ProfilePort != 0 {
+		slog.Warn("profile_port is deprecated. Use profile.port instead")
+		cfg.Port = config.ProfilePort
+	}
+	profile.Start(ctx, &cfg)
+	if cfg.InternalPort {
+		slog.Debug("serving pprof endpoints from the internal metrics port")
+		ctxInfo.Prometheus.Handle(config.InternalMetrics.Prometheus.Port, profile.Path, profile.Handler())
+		ctxInfo.Prometheus.StartHTTP(ctx)
+	}
+}
+
+// exportersCheck verifies that at least one of the configured exporters is reachable
+func exportersCheck(config *beyla.Config) health.Check {
+	if config.Printer.Enabled() || config.Noop.Enabled() || config.NetworkFlows.Print || config.TracesReceiver.Enabled() {
+		// these exporters don't require any connection
+		return func(_ context.Context) error { return nil }
+	}
+	var addrs []string
+	metrics := config.Metrics
+	metrics.Grafana = &config.Grafana.OTLP
+	if metrics.EndpointEnabled() {
+		if addr, err := metrics.EndpointAddress(); err != nil {
+			slog.Warn("can't check the availability of the OTEL metrics endpoint", "error", err)
+		} else {
+			addrs = append(addrs, addr)
+		}
+	}
+	traces := config.Traces
+	traces.Grafana = &config.Grafana.OTLP
+	if traces.Enabled() {
+		if addr, err := traces.EndpointAddress(); err != nil {
+			slog.Warn("can't check the availability of the OTEL traces endpoint", "error", err)
+		} else {
+			addrs = append(addrs, addr)
+		}
+	}
+	if config.Prometheus.Enabled() {
+		if config.Prometheus.Port != 0 {
+			addrs = append(addrs, net.JoinHostPort("localhost", strconv.Itoa(config.Prometheus.Port)))
+		}
+		if config.Prometheus.UnixSocket != "" {
+			addrs = append(addrs, health.UnixPrefix+config.Prometheus.UnixSocket)
+		}
+	}
+	return health.Dial(addrs...)
+}
+
 // attributeGroups specifies, based in the provided configuration, which groups of attributes
 // need to be enabled by default for the diverse metrics
 func attributeGroups(config *beyla.Config, ctxInfo *global.ContextInfo) {
 	if ctxInfo.K8sEnabled {
 		ctxInfo.MetricAttributeGroups.Add(metric.GroupKubernetes)
+		ctxInfo.MetricNamespaceLabels = config.Attributes.Kubernetes.NamespaceLabelAttributes()
 	}
 	if config.Routes != nil {
 		ctxInfo.MetricAttributeGroups.Add(metric.GroupHTTPRoutes)
@@ -124,4 +478,7 @@ func attributeGroups(config *beyla.Config, ctxInfo *global.ContextInfo) {
 	if config.NetworkFlows.CIDRs.Enabled() {
 		ctxInfo.MetricAttributeGroups.Add(metric.GroupNetCIDR)
 	}
+	if config.NetworkFlows.ProcessAttribution.Enable {
+		ctxInfo.MetricAttributeGroups.Add(metric.GroupNetProcess)
+	}
 }
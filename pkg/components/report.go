@@ -0,0 +1,146 @@
+package components
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/grafana/beyla/pkg/beyla"
+	"github.com/grafana/beyla/pkg/buildinfo"
+	"github.com/grafana/beyla/pkg/internal/capabilities"
+	"github.com/grafana/beyla/pkg/internal/discover"
+	"github.com/grafana/beyla/pkg/internal/pipe/global"
+	"github.com/grafana/beyla/pkg/internal/report"
+)
+
+// protocols that are decoded by the application observability instrumentation
+var appProtocols = []string{"http", "https", "http2", "grpc", "sql"}
+
+// startReport logs the report of what Beyla is doing in the host, and serves it from the
+// internal metrics port, if defined, so it can be checked after the probes are attached
+func startReport(
+	ctx context.Context, cfg *beyla.Config, ctxInfo *global.ContextInfo,
+	caps capabilities.Set, disabled []capabilities.Disabled,
+) {
+	ctxInfo.Probes = report.NewProbes()
+	kernel := report.KernelInfo()
+	capInfo := capabilitiesInfo(caps, disabled)
+	build := func() (*report.Report, error) {
+		return buildReport(cfg, kernel, capInfo, ctxInfo.Build.Features, ctxInfo.Probes)
+	}
+	if rep, err := build(); err != nil {
+		slog.Warn("can't build the startup report", "error", err)
+	} else if content, err := json.Marshal(rep); err != nil {
+		slog.Warn("can't marshal the startup report", "error", err)
+	} else {
+		slog.Info("startup report", "report", string(content))
+	}
+	if cfg.InternalMetrics.Prometheus.Enabled() {
+		port := cfg.InternalMetrics.Prometheus.Port
+		slog.Debug("serving the report from the internal metrics port", "port", port, "path", report.Path)
+		ctxInfo.Prometheus.Handle(port, report.Path, report.Handler(build))
+		ctxInfo.Prometheus.StartHTTP(ctx)
+	}
+}
+
+func buildReport(
+	cfg *beyla.Config, kernel report.Kernel, caps report.Capabilities, features []string, probes *report.Probes,
+) (*report.Report, error) {
+	effective, err := cfg.EffectiveYAML()
+	if err != nil {
+		return nil, fmt.Errorf("marshalling effective configuration: %w", err)
+	}
+	config, err := report.FromYAML(effective)
+	if err != nil {
+		return nil, err
+	}
+	criteria, err := yaml.Marshal(discover.FindingCriteria(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("marshalling discovery criteria: %w", err)
+	}
+	discovery, err := report.FromYAML(criteria)
+	if err != nil {
+		return nil, err
+	}
+	rep := &report.Report{
+		Timestamp:    time.Now(),
+		Version:      buildinfo.Version,
+		Revision:     buildinfo.Revision,
+		Kernel:       kernel,
+		Capabilities: caps,
+		Features:     features,
+		Protocols:    []string{},
+		Exporters:    activeExporters(cfg),
+		Discovery:    discovery,
+		Probes:       probes.List(),
+		Config:       config,
+	}
+	if slices.Contains(features, "application") {
+		rep.Protocols = appProtocols
+	}
+	return rep, nil
+}
+
+func capabilitiesInfo(caps capabilities.Set, disabled []capabilities.Disabled) report.Capabilities {
+	info := report.Capabilities{Effective: caps.List()}
+	if len(disabled) > 0 {
+		info.Disabled = map[string][]string{}
+	}
+	for _, d := range disabled {
+		for _, missing := range d.Missing {
+			info.Disabled[string(d.Feature)] = append(info.Disabled[string(d.Feature)], missing.String())
+		}
+	}
+	return info
+}
+
+func activeExporters(cfg *beyla.Config) []report.Exporter {
+	exporters := []report.Exporter{}
+	metrics := cfg.Metrics
+	metrics.Grafana = &cfg.Grafana.OTLP
+	if metrics.EndpointEnabled() {
+		exporter := report.Exporter{Name: "otel_metrics_export", Features: metrics.Features}
+		if endpoint, err := metrics.RedactedEndpoint(); err == nil {
+			exporter.Endpoint = endpoint
+			exporter.Protocol = string(metrics.GetProtocol())
+		}
+		exporters = append(exporters, exporter)
+	}
+	traces := cfg.Traces
+	traces.Grafana = &cfg.Grafana.OTLP
+	if traces.Enabled() {
+		exporter := report.Exporter{Name: "otel_traces_export"}
+		if endpoint, err := traces.RedactedEndpoint(); err == nil {
+			exporter.Endpoint = endpoint
+			exporter.Protocol = string(traces.GetProtocol())
+		}
+		exporters = append(exporters, exporter)
+	}
+	if cfg.Prometheus.Enabled() {
+		exporter := report.Exporter{Name: "prometheus_export", Features: cfg.Prometheus.Features}
+		if cfg.Prometheus.Port != 0 {
+			exporter.Endpoint = fmt.Sprintf("http://localhost:%d%s", cfg.Prometheus.Port, cfg.Prometheus.Path)
+		} else if cfg.Prometheus.UnixSocket != "" {
+			exporter.Endpoint = fmt.Sprintf("unix:%s%s", cfg.Prometheus.UnixSocket, cfg.Prometheus.Path)
+		}
+		exporters = append(exporters, exporter)
+	}
+	if cfg.Printer.Enabled() {
+		exporters = append(exporters, report.Exporter{Name: "print_traces"})
+	}
+	if cfg.NetworkFlows.Print {
+		exporters = append(exporters, report.Exporter{Name: "network.print_flows"})
+	}
+	if cfg.Noop.Enabled() {
+		exporters = append(exporters, report.Exporter{Name: "noop"})
+	}
+	if cfg.TracesReceiver.Enabled() {
+		exporters = append(exporters, report.Exporter{Name: "traces_receiver"})
+	}
+	return exporters
+}
@@ -4,14 +4,20 @@ package appolly
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"k8s.io/client-go/kubernetes"
 
 	"github.com/grafana/beyla/pkg/beyla"
+	"github.com/grafana/beyla/pkg/internal/capture"
 	"github.com/grafana/beyla/pkg/internal/discover"
+	"github.com/grafana/beyla/pkg/internal/ebpf"
+	"github.com/grafana/beyla/pkg/internal/health"
 	kube2 "github.com/grafana/beyla/pkg/internal/kube"
+	"github.com/grafana/beyla/pkg/internal/loadshed"
 	"github.com/grafana/beyla/pkg/internal/pipe"
 	"github.com/grafana/beyla/pkg/internal/pipe/global"
 	"github.com/grafana/beyla/pkg/internal/request"
@@ -35,27 +41,52 @@ type Instrumenter struct {
 	// TODO: When we split beyla into two executables, probably the BPF map
 	// should be the traces' communication mechanism instead of a native channel
 	tracesInput chan []request.Span
+
+	// discovery reports readiness once the processes discovery has started
+	discovery *health.Status
+	// attachedTracers counts the running eBPF process tracers. Having none is not a readiness
+	// failure, as the processes to instrument might not have started yet.
+	attachedTracers *health.Counter
 }
 
 // New Instrumenter, given a Config
 func New(ctx context.Context, ctxInfo *global.ContextInfo, config *beyla.Config) *Instrumenter {
 	setupFeatureContextInfo(ctx, ctxInfo, config)
+	discovery := health.NewStatus(errors.New("process discovery not started"))
+	attachedTracers := health.NewCounter(health.Note("no matching process yet"))
+	ctxInfo.Health.Readiness("appo11y.ebpf", func(ctx context.Context) error {
+		if err := discovery.Check(ctx); err != nil {
+			return err
+		}
+		return attachedTracers.Check(ctx)
+	})
+	tracesInput := make(chan []request.Span, config.ChannelBufferLen)
+	// the captured events that are waiting in the input channel are the backlog of the pipeline
+	ctxInfo.AppO11y.LoadShedding.Start(ctx, func() float64 {
+		return float64(len(tracesInput)) / float64(max(cap(tracesInput), 1))
+	})
 	return &Instrumenter{
-		ctx:         ctx,
-		config:      config,
-		ctxInfo:     ctxInfo,
-		tracesInput: make(chan []request.Span, config.ChannelBufferLen),
+		ctx:             ctx,
+		config:          config,
+		ctxInfo:         ctxInfo,
+		tracesInput:     tracesInput,
+		discovery:       discovery,
+		attachedTracers: attachedTracers,
 	}
 }
 
 // FindAndInstrument searches in background for any new executable matching the
-// selection criteria.
+// selection criteria. If a recording is replayed, it sends its spans instead.
 func (i *Instrumenter) FindAndInstrument() error {
+	if i.config.Capture.ReplayFile != "" {
+		return i.replay()
+	}
 	finder := discover.NewProcessFinder(i.ctx, i.config, i.ctxInfo)
 	foundProcesses, deletedProcesses, err := finder.Start()
 	if err != nil {
 		return fmt.Errorf("couldn't start Process Finder: %w", err)
 	}
+	i.discovery.Set(nil)
 	// In background, listen indefinitely for each new process and run its
 	// associated ebpf.ProcessTracer once it is found.
 	go func() {
@@ -78,7 +109,7 @@ func (i *Instrumenter) FindAndInstrument() error {
 					cctx.ctx, cctx.cancel = context.WithCancel(i.ctx)
 					contexts[pt.ELFInfo.Ino] = cctx
 				}
-				go pt.Run(cctx.ctx, i.tracesInput)
+				go i.runTracer(cctx.ctx, pt)
 			case dp := <-deletedProcesses:
 				log.Debug("stopping ProcessTracer because there are no more instances of such process",
 					"inode", dp.FileInfo.Ino, "pid", dp.FileInfo.Pid, "exec", dp.FileInfo.CmdExePath)
@@ -93,6 +124,29 @@ func (i *Instrumenter) FindAndInstrument() error {
 	return nil
 }
 
+// replay the recorded spans instead of instrumenting any process
+func (i *Instrumenter) replay() error {
+	recording, err := capture.Load(i.config.Capture.ReplayFile)
+	if err != nil {
+		return err
+	}
+	i.ctxInfo.AppO11y.Replay = recording
+	i.discovery.Set(nil)
+	i.attachedTracers.Inc()
+	go recording.Replay(i.ctx, i.tracesInput)
+	return nil
+}
+
+// runTracer runs the process tracer, accounting it as attached until its context is canceled
+func (i *Instrumenter) runTracer(ctx context.Context, pt *ebpf.ProcessTracer) {
+	if err := pt.Run(ctx, i.tracesInput); err != nil {
+		return
+	}
+	i.attachedTracers.Inc()
+	<-ctx.Done()
+	i.attachedTracers.Dec()
+}
+
 // ReadAndForward keeps listening for traces in the BPF map, then reads,
 // processes and forwards them
 func (i *Instrumenter) ReadAndForward() error {
@@ -101,7 +155,19 @@ func (i *Instrumenter) ReadAndForward() error {
 
 	// TODO: when we split the executable, tracer should be reconstructed somehow
 	// from this instance
-	bp, err := pipe.Build(i.ctx, i.config, i.ctxInfo, i.tracesInput)
+	var tracesInput <-chan []request.Span = i.tracesInput
+	if i.config.Capture.RecordFile != "" {
+		var pods capture.PodSource
+		if i.ctxInfo.AppO11y.K8sDatabase != nil {
+			pods = i.ctxInfo.AppO11y.K8sDatabase
+		}
+		var err error
+		if tracesInput, err = capture.Record(&i.config.Capture, pods, i.tracesInput); err != nil {
+			return err
+		}
+	}
+
+	bp, err := pipe.Build(i.ctx, i.config, i.ctxInfo, tracesInput)
 	if err != nil {
 		return fmt.Errorf("can't instantiate instrumentation pipeline: %w", err)
 	}
@@ -117,43 +183,103 @@ func (i *Instrumenter) ReadAndForward() error {
 
 func setupFeatureContextInfo(ctx context.Context, ctxInfo *global.ContextInfo, config *beyla.Config) {
 	ctxInfo.AppO11y.ReportRoutes = config.Routes != nil
-	setupKubernetes(ctx, ctxInfo, &config.Attributes.Kubernetes)
+	ctxInfo.AppO11y.LoadShedding = loadshed.New(&config.LoadShedding, ctxInfo.Metrics)
+	// the replayed spans are decorated with the recorded Kubernetes metadata
+	if config.Capture.ReplayFile == "" {
+		setupKubernetes(ctx, ctxInfo, &config.Attributes.Kubernetes)
+	}
+	if ctxInfo.AppO11y.K8sDatabase != nil && config.Attributes.Kubernetes.DebugEndpoint {
+		port := config.InternalMetrics.Prometheus.Port
+		slog.Debug("serving the Kubernetes database from the internal metrics port", "port", port, "path", kube.DebugPath)
+		ctxInfo.Prometheus.Handle(port, kube.DebugPath, ctxInfo.AppO11y.K8sDatabase.DebugHandler())
+		ctxInfo.Prometheus.StartHTTP(ctx)
+	}
 }
 
-// setupKubernetes sets up common Kubernetes database and API clients that need to be accessed
-// from different stages in the Beyla pipeline
-func setupKubernetes(ctx context.Context, ctxInfo *global.ContextInfo, k8sCfg *transform.KubernetesDecorator) {
-	if !ctxInfo.K8sEnabled {
-		return
+// initKubeMetadata starts the informers, which are fed from the API server or, with the kubelet
+// metadata source, from the kubelet of the local node
+func initKubeMetadata(ctx context.Context, informer *kube2.Metadata, k8sCfg *transform.KubernetesDecorator) error {
+	if k8sCfg.MetadataSource == transform.MetadataSourceKubelet {
+		informer.Kubelet = &kube2.KubeletConfig{
+			Endpoint:           k8sCfg.KubeletEndpoint,
+			TokenPath:          kube2.InClusterTokenPath,
+			CAPath:             kube2.InClusterCAPath,
+			InsecureSkipVerify: k8sCfg.KubeletInsecureSkipVerify,
+			Refresh:            k8sCfg.KubeletRefresh,
+		}
+		return informer.InitFromKubelet(ctx, k8sCfg.InformersSyncTimeout)
 	}
-	config, err := kube2.LoadConfig(k8sCfg.KubeconfigPath)
+	// the informers keep retrying to connect to an unreachable API server, such as the API server of a remote
+	// cluster, so the decoration starts without metadata, which is added once the connection succeeds
+	config, err := k8sCfg.ClientConfig().Load()
 	if err != nil {
-		slog.Error("can't read kubernetes config. You can't setup Kubernetes discovery and your"+
-			" traces won't be decorated with Kubernetes metadata", "error", err)
-		ctxInfo.K8sEnabled = false
-		return
+		return fmt.Errorf("can't read kubernetes config: %w", err)
 	}
-
 	kubeClient, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		slog.Error("can't init Kubernetes client. You can't setup Kubernetes discovery and your"+
-			" traces won't be decorated with Kubernetes metadata", "error", err)
-		ctxInfo.K8sEnabled = false
-		return
+		return fmt.Errorf("can't init Kubernetes client: %w", err)
 	}
+	return informer.InitFromClient(ctx, kubeClient, k8sCfg.InformersSyncTimeout)
+}
 
-	ctxInfo.AppO11y.K8sInformer = &kube2.Metadata{}
-	if err := ctxInfo.AppO11y.K8sInformer.InitFromClient(ctx, kubeClient, k8sCfg.InformersSyncTimeout); err != nil {
+// setupKubernetes sets up common Kubernetes database and API clients that need to be accessed
+// from different stages in the Beyla pipeline
+func setupKubernetes(ctx context.Context, ctxInfo *global.ContextInfo, k8sCfg *transform.KubernetesDecorator) {
+	if !ctxInfo.K8sEnabled {
+		return
+	}
+	ctxInfo.AppO11y.K8sInformer = &kube2.Metadata{
+		WatchEndpointSlices:            k8sCfg.ServicesFromEndpoints,
+		WatchServices:                  k8sCfg.ExternalNameServices || k8sCfg.ServicesFromSelectors,
+		WatchNamespaceLabels:           len(k8sCfg.NamespaceLabels) > 0,
+		WatchNodes:                     k8sCfg.NodeTopology,
+		Namespaces:                     k8sCfg.Namespaces,
+		ClusterName:                    ctxInfo.K8sClusterName,
+		DeploymentsFromReplicaSetNames: k8sCfg.DeploymentsFromReplicaSetNames,
+		ReplicaSetLookupCacheLen:       k8sCfg.ReplicaSetLookupCacheLen,
+		JobLookupCacheLen:              k8sCfg.JobLookupCacheLen,
+	}
+	// the configuration was already validated
+	ctxInfo.AppO11y.K8sInformer.DecoratedNamespaces, _ = kube2.NewNamespaceFilter(
+		k8sCfg.IncludeNamespaces, k8sCfg.ExcludeNamespaces)
+	if err := initKubeMetadata(ctx, ctxInfo.AppO11y.K8sInformer, k8sCfg); err != nil {
 		slog.Error("can't init Kubernetes informer. You can't setup Kubernetes discovery and your"+
 			" traces won't be decorated with Kubernetes metadata", "error", err)
 		ctxInfo.AppO11y.K8sInformer = nil
 		ctxInfo.K8sEnabled = false
 		return
 	}
+	ctxInfo.Health.Readiness("appo11y.kubernetes", ctxInfo.AppO11y.K8sInformer.Synced)
+	// the cluster name is awaited, so the first spans already report it
+	ctxInfo.K8sClusterName.Wait(ctx, k8sCfg.InformersSyncTimeout)
 
-	if ctxInfo.AppO11y.K8sDatabase, err = kube.StartDatabase(ctxInfo.AppO11y.K8sInformer); err != nil {
+	// the ExternalName Services are opt-in, as resolving their hostnames involves DNS lookups from Beyla
+	var externalNamesRefresh time.Duration
+	if k8sCfg.ExternalNameServices {
+		externalNamesRefresh = k8sCfg.ExternalNamesRefresh
+	}
+	var err error
+	if ctxInfo.AppO11y.K8sDatabase, err = kube.StartDatabase(
+		ctx, ctxInfo.AppO11y.K8sInformer, ctxInfo.Metrics, kube.DatabaseConfig{
+			PodsCacheTTL:          k8sCfg.PodsCacheTTL,
+			DeletedPodsGrace:      k8sCfg.DeletedPodsGracePeriod,
+			UnknownIPsCacheLen:    k8sCfg.UnknownIPsCacheLen,
+			UnknownIPsCacheTTL:    k8sCfg.UnknownIPsCacheTTL,
+			ExternalNamesRefresh:  externalNamesRefresh,
+			NamespaceOnlyExcluded: k8sCfg.ExcludedNamespacesDecoration == transform.ExcludedDecorationNamespace,
+			ProcessesSweep:        k8sCfg.ProcessesSweepInterval,
+			RemoteCluster:         k8sCfg.RemoteCluster,
+			Snapshot: kube.SnapshotConfig{
+				Path:   k8sCfg.MetadataSnapshotPath,
+				Period: k8sCfg.MetadataSnapshotPeriod,
+				Grace:  k8sCfg.MetadataSnapshotGrace,
+			},
+		},
+	); err != nil {
 		slog.Error("can't setup Kubernetes database. Your traces won't be decorated with Kubernetes metadata",
 			"error", err)
 		ctxInfo.K8sEnabled = false
+		return
 	}
+	ctxInfo.MemoryPressure.OnHigh("kube_pods_cache_clear", ctxInfo.AppO11y.K8sDatabase.ClearPodsCache)
 }
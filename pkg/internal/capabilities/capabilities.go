@@ -0,0 +1,156 @@
+// Package capabilities maps the features of Beyla to the Linux capabilities that they require, so
+// Beyla can run with an explicit set of capabilities instead of as a privileged container.
+// At startup, Beyla checks which capabilities it has and disables the features that they don't permit.
+package capabilities
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/grafana/beyla/pkg/internal/report"
+)
+
+// Capability of Linux, as numbered in linux/capability.h
+type Capability uint
+
+const (
+	DACReadSearch     Capability = 2
+	NetAdmin          Capability = 12
+	NetRaw            Capability = 13
+	SysPtrace         Capability = 19
+	SysAdmin          Capability = 21
+	Perfmon           Capability = 38
+	BPF               Capability = 39
+	CheckpointRestore Capability = 40
+)
+
+var names = map[Capability]string{
+	DACReadSearch:     "CAP_DAC_READ_SEARCH",
+	NetAdmin:          "CAP_NET_ADMIN",
+	NetRaw:            "CAP_NET_RAW",
+	SysPtrace:         "CAP_SYS_PTRACE",
+	SysAdmin:          "CAP_SYS_ADMIN",
+	Perfmon:           "CAP_PERFMON",
+	BPF:               "CAP_BPF",
+	CheckpointRestore: "CAP_CHECKPOINT_RESTORE",
+}
+
+func (c Capability) String() string {
+	if name, ok := names[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("CAP_%d", uint(c))
+}
+
+// Feature of Beyla that can be individually disabled when its capabilities are missing
+type Feature string
+
+const (
+	// FeatureAppO11y instruments the applications with kprobes, uprobes and tracepoints. It needs
+	// to inspect the executables of other processes and their namespaces.
+	FeatureAppO11y Feature = "application"
+	// FeatureAppSocketFilter captures the HTTP requests with socket filters, as a fallback
+	// for the requests that are not captured by the kprobes
+	FeatureAppSocketFilter Feature = "application.socket_filter"
+	// FeatureAppLibraries instruments the shared libraries (e.g. libssl) through the
+	// /proc/<pid>/map_files entries of the instrumented processes
+	FeatureAppLibraries Feature = "application.shared_libraries"
+	// FeatureContextPropagation writes the trace context into the memory of the instrumented
+	// Go applications, which requires the bpf_probe_write_user helper
+	FeatureContextPropagation Feature = "application.context_propagation"
+	// FeatureNetO11yTC captures the network flows from the Traffic Control hooks
+	FeatureNetO11yTC Feature = "network.tc"
+	// FeatureNetO11ySocketFilter captures the network flows with socket filters
+	FeatureNetO11ySocketFilter Feature = "network.socket_filter"
+)
+
+// Required capabilities of each feature. This is the only place where the capabilities of Beyla
+// are defined: any new eBPF probe must belong to a feature (see ProbeFeatures), and any feature
+// that requires CAP_SYS_ADMIN must be explicitly allowed in the tests.
+var Required = map[Feature][]Capability{
+	FeatureAppO11y:             {BPF, Perfmon, SysPtrace, DACReadSearch},
+	FeatureAppSocketFilter:     {BPF, NetRaw},
+	FeatureAppLibraries:        {CheckpointRestore},
+	FeatureContextPropagation:  {SysAdmin},
+	FeatureNetO11yTC:           {BPF, Perfmon, NetAdmin},
+	FeatureNetO11ySocketFilter: {BPF, NetRaw},
+}
+
+// ProbeFeatures maps each type of eBPF probe to the feature that attaches it, so the capabilities
+// that are required by any type of probe are defined in the Required map
+var ProbeFeatures = map[string]Feature{
+	report.ProbeKprobe:       FeatureAppO11y,
+	report.ProbeKretprobe:    FeatureAppO11y,
+	report.ProbeUprobe:       FeatureAppO11y,
+	report.ProbeUretprobe:    FeatureAppO11y,
+	report.ProbeGoUprobe:     FeatureAppO11y,
+	report.ProbeGoReturn:     FeatureAppO11y,
+	report.ProbeTracepoint:   FeatureAppO11y,
+	report.ProbeSocketFilter: FeatureAppSocketFilter,
+	report.ProbeTC:           FeatureNetO11yTC,
+}
+
+// Set of capabilities
+type Set uint64
+
+func SetOf(caps ...Capability) Set {
+	s := Set(0)
+	for _, c := range caps {
+		s |= 1 << c
+	}
+	return s
+}
+
+// Has returns whether the set contains the provided capability. CAP_SYS_ADMIN implies CAP_BPF and
+// CAP_PERFMON, which were split from it in Linux 5.8.
+func (s Set) Has(c Capability) bool {
+	if s&(1<<c) != 0 {
+		return true
+	}
+	return (c == BPF || c == Perfmon) && s&(1<<SysAdmin) != 0
+}
+
+// Missing returns the capabilities that the provided feature requires, and are not in the set
+func (s Set) Missing(feature Feature) []Capability {
+	var missing []Capability
+	for _, c := range Required[feature] {
+		if !s.Has(c) {
+			missing = append(missing, c)
+		}
+	}
+	return missing
+}
+
+// List the known capabilities that are in the set, sorted by name
+func (s Set) List() []string {
+	var list []string
+	for c, name := range names {
+		if s&(1<<c) != 0 {
+			list = append(list, name)
+		}
+	}
+	slices.Sort(list)
+	return list
+}
+
+func (s Set) String() string {
+	return strings.Join(s.List(), ",")
+}
+
+// Disabled is a feature that is not permitted by the capabilities of Beyla
+type Disabled struct {
+	Feature Feature
+	Missing []Capability
+}
+
+// Check returns the features, among the provided ones, that are not permitted by the set
+func (s Set) Check(features ...Feature) []Disabled {
+	var disabled []Disabled
+	for _, f := range features {
+		if missing := s.Missing(f); len(missing) > 0 {
+			disabled = append(disabled, Disabled{Feature: f, Missing: missing})
+		}
+	}
+	return disabled
+}
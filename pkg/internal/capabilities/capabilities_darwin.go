@@ -0,0 +1,8 @@
+package capabilities
+
+import "errors"
+
+// Current is not supported outside Linux
+func Current() (Set, error) {
+	return 0, errors.New("capabilities are only supported in Linux")
+}
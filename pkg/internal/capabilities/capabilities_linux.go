@@ -0,0 +1,17 @@
+package capabilities
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// Current returns the effective capabilities of the Beyla process
+func Current() (Set, error) {
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&hdr, &data[0]); err != nil {
+		return 0, fmt.Errorf("getting process capabilities: %w", err)
+	}
+	return Set(uint64(data[1].Effective)<<32 | uint64(data[0].Effective)), nil
+}
@@ -0,0 +1,81 @@
+package capabilities
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// features that are allowed to require CAP_SYS_ADMIN. Any other feature must run with
+// a more restrictive set of capabilities.
+var privileged = map[Feature]struct{}{
+	FeatureContextPropagation: {},
+}
+
+func TestRequired_NoPrivilegedFeatures(t *testing.T) {
+	for feature, caps := range Required {
+		if _, ok := privileged[feature]; ok {
+			continue
+		}
+		assert.NotContainsf(t, caps, SysAdmin,
+			"feature %q can't require CAP_SYS_ADMIN. Please look for a more restrictive capability", feature)
+	}
+}
+
+func TestProbeFeatures_AllProbesHaveCapabilities(t *testing.T) {
+	// parse the probe types that are defined in the report package, so any new
+	// type of probe fails this test until its feature is defined
+	file, err := parser.ParseFile(token.NewFileSet(), "../report/probes.go", nil, 0)
+	require.NoError(t, err)
+	var probeTypes []string
+	ast.Inspect(file, func(node ast.Node) bool {
+		spec, ok := node.(*ast.ValueSpec)
+		if !ok {
+			return true
+		}
+		for i, name := range spec.Names {
+			if !strings.HasPrefix(name.Name, "Probe") || i >= len(spec.Values) {
+				continue
+			}
+			if lit, ok := spec.Values[i].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				value, err := strconv.Unquote(lit.Value)
+				require.NoError(t, err)
+				probeTypes = append(probeTypes, value)
+			}
+		}
+		return true
+	})
+	require.NotEmpty(t, probeTypes)
+
+	for _, probeType := range probeTypes {
+		feature, ok := ProbeFeatures[probeType]
+		if assert.Truef(t, ok, "probe type %q does not belong to any feature in ProbeFeatures", probeType) {
+			assert.NotEmptyf(t, Required[feature], "feature %q does not define its required capabilities", feature)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	set := SetOf(BPF, Perfmon, SysPtrace, DACReadSearch, NetRaw)
+	assert.True(t, set.Has(BPF))
+	assert.False(t, set.Has(NetAdmin))
+	assert.Equal(t, "CAP_BPF,CAP_DAC_READ_SEARCH,CAP_NET_RAW,CAP_PERFMON,CAP_SYS_PTRACE", set.String())
+
+	assert.Equal(t, []Disabled{
+		{Feature: FeatureContextPropagation, Missing: []Capability{SysAdmin}},
+		{Feature: FeatureNetO11yTC, Missing: []Capability{NetAdmin}},
+	}, set.Check(FeatureAppO11y, FeatureAppSocketFilter, FeatureContextPropagation, FeatureNetO11yTC))
+}
+
+func TestSet_SysAdminImpliesBPF(t *testing.T) {
+	// kernels older than 5.8 don't have CAP_BPF nor CAP_PERFMON
+	set := SetOf(SysAdmin, SysPtrace, DACReadSearch, NetAdmin)
+	assert.Empty(t, set.Check(FeatureAppO11y, FeatureContextPropagation, FeatureNetO11yTC))
+	assert.Equal(t, []Capability{NetRaw}, set.Missing(FeatureNetO11ySocketFilter))
+}
@@ -0,0 +1,171 @@
+// Package capture records the spans that are read from the eBPF tracers into a file, and replays them later
+// through the processing pipeline. It allows reproducing the decoration or parsing issues of a Beyla instance
+// in another environment, as well as building regression tests from real traffic.
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/grafana/beyla/pkg/internal/kube"
+	"github.com/grafana/beyla/pkg/internal/request"
+)
+
+func clog() *slog.Logger {
+	return slog.With("component", "capture.Recorder")
+}
+
+// Field of the spans whose value is redacted before it is recorded
+type Field string
+
+const (
+	// RedactURLQuery removes the query string from the URL path of the HTTP spans
+	RedactURLQuery = Field("url_query")
+	// RedactAddresses replaces the addresses and host names of the client and the server
+	RedactAddresses = Field("addresses")
+)
+
+// redacted replaces the values of the redacted fields
+const redacted = "<redacted>"
+
+// Config of the recording and the replay of the captured spans
+type Config struct {
+	// RecordFile, if set, is the file where the spans read from the eBPF tracers are recorded,
+	// before they are decorated
+	RecordFile string `yaml:"record_file" env:"BEYLA_CAPTURE_RECORD_FILE"`
+	// ReplayFile, if set, is a recorded file whose spans are sent through the pipeline. Then
+	// Beyla does not instrument any process.
+	ReplayFile string `yaml:"replay_file" env:"BEYLA_CAPTURE_REPLAY_FILE"`
+	// Redact the values of the given fields before recording them
+	Redact []Field `yaml:"redact" env:"BEYLA_CAPTURE_REDACT" envSeparator:","`
+}
+
+func (c *Config) Validate() error {
+	if c.RecordFile != "" && c.ReplayFile != "" {
+		return fmt.Errorf("record_file and replay_file can't be set at the same time")
+	}
+	for _, f := range c.Redact {
+		switch f {
+		case RedactURLQuery, RedactAddresses:
+		default:
+			return fmt.Errorf("unknown redacted field %q, choices are [%s, %s]", f, RedactURLQuery, RedactAddresses)
+		}
+	}
+	return nil
+}
+
+// Entry of a recording file. Each line of the file contains an Entry, encoded as JSON.
+type Entry struct {
+	// Monotime is the monotonic clock, in nanoseconds, when the spans were read. It is the same
+	// clock as the start and end times of the spans, so they can be shifted when they are replayed.
+	Monotime int64
+	// Time is the wall clock when the spans were read
+	Time time.Time
+	// Pods that have been found for the PID namespaces of the spans, by namespace. They are
+	// recorded once, before the first spans of the namespace.
+	Pods map[uint32]*PodMetadata
+	// Spans that were read from the eBPF tracers, as a batch
+	Spans []request.Span
+}
+
+// jsonEntry is the JSON encoding of an Entry. The trace and span IDs are marshalled
+// by OpenTelemetry as hex strings, but they can't be unmarshalled back.
+type jsonEntry struct {
+	Monotime int64                   `json:"monotime"`
+	Time     time.Time               `json:"time"`
+	Pods     map[uint32]*PodMetadata `json:"pods,omitempty"`
+	Spans    []jsonSpan              `json:"spans,omitempty"`
+}
+
+type jsonSpan struct {
+	request.Span
+	TraceID      string `json:"TraceID,omitempty"`
+	SpanID       string `json:"SpanID,omitempty"`
+	ParentSpanID string `json:"ParentSpanID,omitempty"`
+}
+
+func (e *Entry) MarshalJSON() ([]byte, error) {
+	je := jsonEntry{Monotime: e.Monotime, Time: e.Time, Pods: e.Pods, Spans: make([]jsonSpan, 0, len(e.Spans))}
+	for i := range e.Spans {
+		js := jsonSpan{Span: e.Spans[i]}
+		if js.Span.TraceID.IsValid() {
+			js.TraceID = js.Span.TraceID.String()
+		}
+		if js.Span.SpanID.IsValid() {
+			js.SpanID = js.Span.SpanID.String()
+		}
+		if js.Span.ParentSpanID.IsValid() {
+			js.ParentSpanID = js.Span.ParentSpanID.String()
+		}
+		je.Spans = append(je.Spans, js)
+	}
+	return json.Marshal(&je)
+}
+
+func (e *Entry) UnmarshalJSON(data []byte) error {
+	je := jsonEntry{}
+	if err := json.Unmarshal(data, &je); err != nil {
+		return err
+	}
+	*e = Entry{Monotime: je.Monotime, Time: je.Time, Pods: je.Pods, Spans: make([]request.Span, 0, len(je.Spans))}
+	for i := range je.Spans {
+		span := je.Spans[i].Span
+		var err error
+		if je.Spans[i].TraceID != "" {
+			if span.TraceID, err = trace.TraceIDFromHex(je.Spans[i].TraceID); err != nil {
+				return fmt.Errorf("invalid TraceID: %w", err)
+			}
+		}
+		if je.Spans[i].SpanID != "" {
+			if span.SpanID, err = trace.SpanIDFromHex(je.Spans[i].SpanID); err != nil {
+				return fmt.Errorf("invalid SpanID: %w", err)
+			}
+		}
+		if je.Spans[i].ParentSpanID != "" {
+			if span.ParentSpanID, err = trace.SpanIDFromHex(je.Spans[i].ParentSpanID); err != nil {
+				return fmt.Errorf("invalid ParentSpanID: %w", err)
+			}
+		}
+		e.Spans = append(e.Spans, span)
+	}
+	return nil
+}
+
+// PodMetadata of a PID namespace, as it was stored in the Kubernetes database
+type PodMetadata struct {
+	Pod         *kube.PodInfo `json:"pod"`
+	ContainerID string        `json:"containerID,omitempty"`
+}
+
+func (c *Config) redact(spans []request.Span) []request.Span {
+	if len(c.Redact) == 0 {
+		return spans
+	}
+	redactedSpans := make([]request.Span, len(spans))
+	copy(redactedSpans, spans)
+	for _, f := range c.Redact {
+		for i := range redactedSpans {
+			span := &redactedSpans[i]
+			switch f {
+			case RedactURLQuery:
+				if span.Type == request.EventTypeHTTP || span.Type == request.EventTypeHTTPClient {
+					if q := strings.IndexByte(span.Path, '?'); q >= 0 {
+						span.Path = span.Path[:q+1] + redacted
+					}
+				}
+			case RedactAddresses:
+				for _, address := range []*string{&span.Peer, &span.PeerName, &span.Host, &span.HostName} {
+					if *address != "" {
+						*address = redacted
+					}
+				}
+			}
+		}
+	}
+	return redactedSpans
+}
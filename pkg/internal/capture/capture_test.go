@@ -0,0 +1,185 @@
+package capture
+
+import (
+	"context"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/grafana/beyla/pkg/internal/kube"
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+	"github.com/grafana/beyla/pkg/internal/testutil"
+)
+
+const timeout = 5 * time.Second
+
+type fakePods map[uint32]*PodMetadata
+
+func (f fakePods) OwnerPodInfo(pidNamespace, _ uint32) (*kube.PodInfo, bool) {
+	pm, ok := f[pidNamespace]
+	if !ok {
+		return nil, false
+	}
+	return pm.Pod, true
+}
+
+func (f fakePods) ContainerID(pidNamespace, _ uint32) (string, bool) {
+	pm, ok := f[pidNamespace]
+	if !ok {
+		return "", false
+	}
+	return pm.ContainerID, true
+}
+
+func httpSpan(path string, ns uint32, start int64) request.Span {
+	return request.Span{
+		Type:         request.EventTypeHTTP,
+		Method:       "GET",
+		Path:         path,
+		Peer:         "1.2.3.4",
+		Host:         "5.6.7.8",
+		RequestStart: start,
+		Start:        start + 10,
+		End:          start + 100,
+		ServiceID:    svc.ID{Name: "my-service"},
+		Pid:          request.PidInfo{HostPID: 33, UserPID: 1, Namespace: ns},
+		TraceID:      trace.TraceID{1, 2, 3},
+		SpanID:       trace.SpanID{4, 5, 6},
+	}
+}
+
+func record(t *testing.T, cfg *Config, pods PodSource, batches ...[]request.Span) {
+	t.Helper()
+	in := make(chan []request.Span, len(batches))
+	out, err := Record(cfg, pods, in)
+	require.NoError(t, err)
+	for _, b := range batches {
+		in <- b
+		// spans are forwarded unmodified
+		assert.Equal(t, b, testutil.ReadChannel(t, out, timeout))
+	}
+	close(in)
+	// the output is closed once the recording finishes
+	select {
+	case _, ok := <-out:
+		require.False(t, ok)
+	case <-time.After(timeout):
+		require.Fail(t, "timeout while waiting for the recording to finish")
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	// GIVEN a recording of two batches of spans, whose PID namespaces belong to a known pod
+	cfg := &Config{RecordFile: path.Join(t.TempDir(), "capture.json")}
+	pods := fakePods{123: {
+		Pod:         &kube.PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "my-pod", Namespace: "default"}},
+		ContainerID: "container-1",
+	}}
+	first := []request.Span{httpSpan("/foo", 123, 1000), httpSpan("/bar", 456, 2000)}
+	second := []request.Span{httpSpan("/baz", 123, 3000)}
+	record(t, cfg, pods, first, second)
+
+	// WHEN the recording is loaded
+	rec, err := Load(cfg.RecordFile)
+	require.NoError(t, err)
+
+	// THEN it contains the Kubernetes metadata of the recorded spans, once per namespace
+	require.Len(t, rec.Entries, 2)
+	assert.Len(t, rec.Entries[0].Pods, 1)
+	assert.Empty(t, rec.Entries[1].Pods)
+	assert.False(t, rec.Snapshot.Empty())
+	pod, ok := rec.Snapshot.OwnerPodInfo(123, 0)
+	require.True(t, ok)
+	assert.Equal(t, "my-pod", pod.Name)
+	containerID, ok := rec.Snapshot.ContainerID(123, 0)
+	require.True(t, ok)
+	assert.Equal(t, "container-1", containerID)
+	_, ok = rec.Snapshot.OwnerPodInfo(456, 0)
+	assert.False(t, ok)
+
+	// AND WHEN the recording is replayed
+	out := make(chan []request.Span, 10)
+	rec.Replay(context.Background(), out)
+
+	// THEN the spans are sent in the same order, with their times shifted by the same amount
+	replayedFirst := testutil.ReadChannel(t, out, timeout)
+	replayedSecond := testutil.ReadChannel(t, out, timeout)
+	require.Len(t, replayedFirst, 2)
+	require.Len(t, replayedSecond, 1)
+	assert.Equal(t, "/foo", replayedFirst[0].Path)
+	assert.Equal(t, "/bar", replayedFirst[1].Path)
+	assert.Equal(t, "/baz", replayedSecond[0].Path)
+	assert.Equal(t, svc.ID{Name: "my-service"}, replayedSecond[0].ServiceID)
+	assert.Equal(t, first[1].TraceID, replayedFirst[1].TraceID)
+	assert.Equal(t, first[1].SpanID, replayedFirst[1].SpanID)
+	assert.False(t, replayedFirst[1].ParentSpanID.IsValid())
+	shift := replayedFirst[0].RequestStart - first[0].RequestStart
+	assert.Positive(t, shift)
+	assert.Equal(t, first[0].Start+shift, replayedFirst[0].Start)
+	assert.Equal(t, first[0].End+shift, replayedFirst[0].End)
+	assert.Equal(t, second[0].End+shift, replayedSecond[0].End)
+	// AND the channel is closed after the last batch
+	_, ok = <-out
+	assert.False(t, ok)
+}
+
+func TestRecord_Redact(t *testing.T) {
+	// GIVEN a recording that redacts the URL queries and the addresses
+	cfg := &Config{
+		RecordFile: path.Join(t.TempDir(), "capture.json"),
+		Redact:     []Field{RedactURLQuery, RedactAddresses},
+	}
+	sql := request.Span{Type: request.EventTypeSQLClient, Path: "SELECT * FROM users WHERE a = '?'"}
+	record(t, cfg, nil, []request.Span{httpSpan("/foo?user=me&pass=1234", 123, 1000), sql})
+
+	// WHEN the recording is loaded
+	rec, err := Load(cfg.RecordFile)
+	require.NoError(t, err)
+
+	// THEN the values of the redacted fields are not recorded
+	require.Len(t, rec.Entries, 1)
+	spans := rec.Entries[0].Spans
+	require.Len(t, spans, 2)
+	assert.Equal(t, "/foo?<redacted>", spans[0].Path)
+	assert.Equal(t, "<redacted>", spans[0].Peer)
+	assert.Equal(t, "<redacted>", spans[0].Host)
+	assert.Empty(t, spans[0].PeerName)
+	// AND only the query of the HTTP spans is redacted
+	assert.Equal(t, sql.Path, spans[1].Path)
+	// AND no Kubernetes metadata is recorded without a pods source
+	assert.True(t, rec.Snapshot.Empty())
+}
+
+func TestReplay_Canceled(t *testing.T) {
+	rec := &Recording{Entries: []Entry{
+		{Spans: []request.Span{httpSpan("/foo", 1, 1000)}},
+		{Spans: []request.Span{httpSpan("/bar", 1, 2000)}},
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	out := make(chan []request.Span)
+	done := make(chan struct{})
+	go func() {
+		rec.Replay(ctx, out)
+		close(done)
+	}()
+	testutil.ReadChannel(t, done, timeout)
+}
+
+func TestLoad_Errors(t *testing.T) {
+	_, err := Load(path.Join(t.TempDir(), "not-found.json"))
+	assert.Error(t, err)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.NoError(t, (&Config{}).Validate())
+	assert.NoError(t, (&Config{RecordFile: "foo", Redact: []Field{RedactURLQuery, RedactAddresses}}).Validate())
+	assert.Error(t, (&Config{RecordFile: "foo", ReplayFile: "bar"}).Validate())
+	assert.Error(t, (&Config{Redact: []Field{"passwords"}}).Validate())
+}
@@ -0,0 +1,86 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gavv/monotime"
+
+	"github.com/grafana/beyla/pkg/internal/kube"
+	"github.com/grafana/beyla/pkg/internal/request"
+)
+
+// PodSource provides the Kubernetes metadata of the PID namespaces. It is implemented by the
+// Kubernetes database, as well as by the Snapshot of a recording. The host PID identifies the pod
+// of the process when its PID namespace is shared by multiple pods.
+type PodSource interface {
+	OwnerPodInfo(pidNamespace, hostPID uint32) (*kube.PodInfo, bool)
+	ContainerID(pidNamespace, hostPID uint32) (string, bool)
+}
+
+// Record writes the spans from the input channel into the configured file, and forwards them
+// to the returned channel. If the pods source is not nil, the Kubernetes metadata of the spans
+// is also recorded, so the recording can be decorated when it is replayed.
+func Record(cfg *Config, pods PodSource, in <-chan []request.Span) (<-chan []request.Span, error) {
+	file, err := os.Create(cfg.RecordFile)
+	if err != nil {
+		return nil, fmt.Errorf("creating capture file: %w", err)
+	}
+	clog().Info("recording the captured spans", "file", cfg.RecordFile, "redact", cfg.Redact)
+	out := make(chan []request.Span, cap(in))
+	r := recorder{cfg: cfg, pods: pods, recordedNS: map[uint32]struct{}{}}
+	go func() {
+		defer close(out)
+		defer file.Close()
+		buf := bufio.NewWriter(file)
+		defer buf.Flush()
+		enc := json.NewEncoder(buf)
+		for spans := range in {
+			if err := enc.Encode(r.entry(spans)); err != nil {
+				clog().Error("can't record spans", "error", err)
+			}
+			out <- spans
+		}
+		clog().Debug("input channel closed. Stopping the recording")
+	}()
+	return out, nil
+}
+
+type recorder struct {
+	cfg  *Config
+	pods PodSource
+	// PID namespaces whose Kubernetes metadata is already recorded
+	recordedNS map[uint32]struct{}
+}
+
+func (r *recorder) entry(spans []request.Span) *Entry {
+	entry := &Entry{
+		Monotime: int64(monotime.Now()),
+		Time:     time.Now(),
+		Spans:    r.cfg.redact(spans),
+	}
+	if r.pods == nil {
+		return entry
+	}
+	for i := range spans {
+		ns := spans[i].Pid.Namespace
+		if _, ok := r.recordedNS[ns]; ok {
+			continue
+		}
+		pod, ok := r.pods.OwnerPodInfo(ns, spans[i].Pid.HostPID)
+		if !ok {
+			// the metadata might be available in later spans
+			continue
+		}
+		r.recordedNS[ns] = struct{}{}
+		if entry.Pods == nil {
+			entry.Pods = map[uint32]*PodMetadata{}
+		}
+		containerID, _ := r.pods.ContainerID(ns, spans[i].Pid.HostPID)
+		entry.Pods[ns] = &PodMetadata{Pod: pod, ContainerID: containerID}
+	}
+	return entry
+}
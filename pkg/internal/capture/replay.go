@@ -0,0 +1,108 @@
+package capture
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gavv/monotime"
+
+	"github.com/grafana/beyla/pkg/internal/kube"
+	"github.com/grafana/beyla/pkg/internal/request"
+)
+
+// maxEntrySize of a line in the recording file
+const maxEntrySize = 64 * 1024 * 1024
+
+// Recording of captured spans, to be replayed
+type Recording struct {
+	Entries []Entry
+	// Snapshot of the Kubernetes metadata that was recorded with the spans
+	Snapshot *Snapshot
+}
+
+// Load a recording file
+func Load(path string) (*Recording, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening capture file: %w", err)
+	}
+	defer file.Close()
+	rec := &Recording{Snapshot: &Snapshot{pods: map[uint32]*PodMetadata{}}}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxEntrySize)
+	for line := 1; scanner.Scan(); line++ {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("reading capture file %s:%d: %w", path, line, err)
+		}
+		for ns, pod := range entry.Pods {
+			rec.Snapshot.pods[ns] = pod
+		}
+		rec.Entries = append(rec.Entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading capture file: %w", err)
+	}
+	return rec, nil
+}
+
+// Replay sends the recorded spans to the output channel, in the same order that they were recorded,
+// and closes it afterwards. The spans are sent as fast as they are accepted by the channel, so the
+// replay is deterministic. Their start and end times are shifted, as if they were captured now.
+func (r *Recording) Replay(ctx context.Context, out chan<- []request.Span) {
+	defer close(out)
+	if len(r.Entries) == 0 {
+		return
+	}
+	log := clog().With("entries", len(r.Entries))
+	log.Info("replaying the captured spans")
+	shift := int64(monotime.Now()) - r.Entries[len(r.Entries)-1].Monotime
+	for i := range r.Entries {
+		spans := make([]request.Span, len(r.Entries[i].Spans))
+		copy(spans, r.Entries[i].Spans)
+		for s := range spans {
+			spans[s].RequestStart += shift
+			spans[s].Start += shift
+			spans[s].End += shift
+		}
+		select {
+		case out <- spans:
+		case <-ctx.Done():
+			log.Debug("context canceled. Stopping the replay")
+			return
+		}
+	}
+	log.Info("replay finished")
+}
+
+// Snapshot of the Kubernetes metadata of a recording. It replaces the Kubernetes database
+// when the recording is replayed.
+type Snapshot struct {
+	pods map[uint32]*PodMetadata
+}
+
+// Empty returns true if the recording does not contain any Kubernetes metadata
+func (s *Snapshot) Empty() bool {
+	return len(s.pods) == 0
+}
+
+// OwnerPodInfo returns the recorded pod of the PID namespace. The recordings are indexed by namespace,
+// so the host PID is ignored.
+func (s *Snapshot) OwnerPodInfo(pidNamespace, _ uint32) (*kube.PodInfo, bool) {
+	pm, ok := s.pods[pidNamespace]
+	if !ok {
+		return nil, false
+	}
+	return pm.Pod, true
+}
+
+func (s *Snapshot) ContainerID(pidNamespace, _ uint32) (string, bool) {
+	pm, ok := s.pods[pidNamespace]
+	if !ok || pm.ContainerID == "" {
+		return "", false
+	}
+	return pm.ContainerID, true
+}
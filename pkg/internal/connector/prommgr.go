@@ -9,7 +9,7 @@ import (
 	"log/slog"
 	"net/http"
 	"strconv"
-	"sync/atomic"
+	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -21,12 +21,24 @@ func log() *slog.Logger {
 
 // PrometheusManager allows exporting metrics from different sources (instrumented metrics, internal metrics...)
 // sharing the same port and path, or using different ones, depending on the configuration provided by the registrars.
+// It also allows serving other HTTP handlers (e.g. health checks) from the same ports.
+// The endpoints of a port can also be served from Unix domain sockets. Port 0 is not served
+// through TCP, so it can be used for the endpoints that are only served from Unix sockets.
 type PrometheusManager struct {
-	started atomic.Bool
+	mt sync.Mutex
 	// key 1: port. Key 2: path
 	registries map[int]map[string]*prometheus.Registry
+	handlers   map[int]map[string]http.Handler
+	// key 1: port. Key 2: socket path
+	sockets map[int]map[string]FileMode
+	// ServeMux of each port that is already being served
+	servers map[int]*http.ServeMux
+	// sockets that are already being served
+	servedSockets map[string]struct{}
 
 	metrics internalIntrumenter
+	// transforms the gathered metrics before serving them
+	gatherer func(prometheus.Gatherer) prometheus.Gatherer
 }
 
 type internalIntrumenter interface {
@@ -37,11 +49,19 @@ func (pm *PrometheusManager) InstrumentWith(ii internalIntrumenter) {
 	pm.metrics = ii
 }
 
+// GatherWith transforms the metrics of all the registries before they are served. It must be
+// invoked before registering any collector.
+func (pm *PrometheusManager) GatherWith(transform func(prometheus.Gatherer) prometheus.Gatherer) {
+	pm.gatherer = transform
+}
+
 // Register a set of prometheus metrics to be accessible through an HTTP port/path.
-// This method is not thread-safe
+// If the port is already being served, the path is served immediately.
 func (pm *PrometheusManager) Register(port int, path string, collectors ...prometheus.Collector) {
 	log().Debug("registering Prometheus metrics collectors",
 		"len", len(collectors), "port", port, "path", path)
+	pm.mt.Lock()
+	defer pm.mt.Unlock()
 	if pm.registries == nil {
 		pm.registries = map[int]map[string]*prometheus.Registry{}
 	}
@@ -54,29 +74,109 @@ func (pm *PrometheusManager) Register(port int, path string, collectors ...prome
 	if !ok {
 		reg = prometheus.NewRegistry()
 		paths[path] = reg
+		if mux, ok := pm.servers[port]; ok {
+			pm.handleRegistry(mux, port, path, reg)
+		}
 	}
 	reg.MustRegister(collectors...)
 }
 
-// StartHTTP serves metrics in background. Its invocation won't have effect if it has been invoked previously,
-// so invoke it only after you are sure that all the collectors have been registered via the Register method.
+// Handle registers an HTTP handler to be served in the provided port/path.
+// If the port is already being served, the handler is served immediately.
+func (pm *PrometheusManager) Handle(port int, path string, handler http.Handler) {
+	log().Debug("registering HTTP handler", "port", port, "path", path)
+	pm.mt.Lock()
+	defer pm.mt.Unlock()
+	if pm.handlers == nil {
+		pm.handlers = map[int]map[string]http.Handler{}
+	}
+	paths, ok := pm.handlers[port]
+	if !ok {
+		paths = map[string]http.Handler{}
+		pm.handlers[port] = paths
+	}
+	paths[path] = handler
+	if mux, ok := pm.servers[port]; ok {
+		mux.Handle(path, handler)
+	}
+}
+
+// UnixSocket serves all the endpoints of the provided port also from a Unix domain socket,
+// whose file is created with the provided permissions. If the port is 0, the endpoints are
+// only served from the Unix sockets.
+// If the port is already being served, the socket is served in the next invocation of StartHTTP.
+func (pm *PrometheusManager) UnixSocket(port int, socket string, mode FileMode) {
+	log().Debug("registering Unix socket", "port", port, "socket", socket, "mode", mode)
+	pm.mt.Lock()
+	defer pm.mt.Unlock()
+	if pm.sockets == nil {
+		pm.sockets = map[int]map[string]FileMode{}
+	}
+	sockets, ok := pm.sockets[port]
+	if !ok {
+		sockets = map[string]FileMode{}
+		pm.sockets[port] = sockets
+	}
+	sockets[socket] = mode
+}
+
+// StartHTTP serves metrics in background, for all the ports that have been registered
+// and are not being served yet. Successive invocations will only start serving
+// the ports that have been registered after the previous invocations.
 func (pm *PrometheusManager) StartHTTP(ctx context.Context) {
-	if pm.started.Swap(true) {
-		return
+	pm.mt.Lock()
+	defer pm.mt.Unlock()
+	if pm.servers == nil {
+		pm.servers = map[int]*http.ServeMux{}
+	}
+	if pm.servedSockets == nil {
+		pm.servedSockets = map[string]struct{}{}
+	}
+	// sockets that were registered for ports that are already being served
+	for port, mux := range pm.servers {
+		pm.serveSockets(ctx, port, mux)
 	}
-	log := log()
 	// Creating a serve mux for each port
 	for port, paths := range pm.registries {
+		if _, ok := pm.servers[port]; ok {
+			continue
+		}
 		mux := http.NewServeMux()
 		for path, registry := range paths {
-			log.With("port", port, "path", path).Info("opening prometheus scrape endpoint")
-			promHandler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
-			promHandler = wrapDebugHandler(log, promHandler)
-			promHandler = wrapInstrumentedHandler(pm.metrics, port, path, promHandler)
-			mux.Handle(path, promHandler)
+			pm.handleRegistry(mux, port, path, registry)
 		}
+		for path, handler := range pm.handlers[port] {
+			mux.Handle(path, handler)
+		}
+		pm.servers[port] = mux
+		pm.listenAndServe(ctx, port, mux)
+		pm.serveSockets(ctx, port, mux)
+	}
+	for port, paths := range pm.handlers {
+		if _, ok := pm.servers[port]; ok {
+			continue
+		}
+		mux := http.NewServeMux()
+		for path, handler := range paths {
+			mux.Handle(path, handler)
+		}
+		pm.servers[port] = mux
 		pm.listenAndServe(ctx, port, mux)
+		pm.serveSockets(ctx, port, mux)
+	}
+}
+
+func (pm *PrometheusManager) handleRegistry(mux *http.ServeMux, port int, path string, registry *prometheus.Registry) {
+	log := log()
+	log.With("port", port, "path", path).Info("opening prometheus scrape endpoint")
+	var gatherer prometheus.Gatherer = registry
+	if pm.gatherer != nil {
+		gatherer = pm.gatherer(registry)
 	}
+	promHandler := promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{Registry: registry})
+	promHandler = wrapDebugHandler(log, promHandler)
+	promHandler = wrapInstrumentedHandler(pm.metrics, port, path, promHandler)
+	mux.Handle(path, promHandler)
 }
 
 func wrapInstrumentedHandler(metrics internalIntrumenter, port int, path string, promHandler http.Handler) http.HandlerFunc {
@@ -103,15 +203,43 @@ func wrapDebugHandler(log *slog.Logger, promHandler http.Handler) http.HandlerFu
 }
 
 func (pm *PrometheusManager) listenAndServe(ctx context.Context, port int, handler http.Handler) {
+	if port == 0 {
+		// endpoints that are only served from Unix sockets
+		return
+	}
 	// TODO: support TLS configuration
-	server := http.Server{Addr: fmt.Sprintf(":%d", port), Handler: handler}
-	log := log().With("port", port)
+	server := &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: handler}
+	serve(ctx, log().With("port", port), server, server.ListenAndServe)
+}
+
+func (pm *PrometheusManager) serveSockets(ctx context.Context, port int, handler http.Handler) {
+	for socket, mode := range pm.sockets[port] {
+		if _, ok := pm.servedSockets[socket]; ok {
+			continue
+		}
+		pm.servedSockets[socket] = struct{}{}
+		log := log().With("port", port, "socket", socket)
+		listener, err := listenUnix(socket, mode)
+		if err != nil {
+			log.Error("can't listen on Unix socket", "error", err)
+			continue
+		}
+		log.Info("serving HTTP endpoints from Unix socket")
+		server := &http.Server{Handler: handler}
+		serve(ctx, log, server, func() error {
+			return server.Serve(listener)
+		})
+	}
+}
+
+// serve runs the server in background until the context is done
+func serve(ctx context.Context, log *slog.Logger, server *http.Server, run func() error) {
 	go func() {
-		err := server.ListenAndServe()
+		err := run()
 		if errors.Is(err, http.ErrServerClosed) {
 			log.Debug("HTTP server was closed", "err", err)
 		} else {
-			log.Error("HTTP service ended unexpectedly", err)
+			log.Error("HTTP service ended unexpectedly", "error", err)
 		}
 	}()
 	go func() {
@@ -0,0 +1,77 @@
+package connector
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileMode holds the permissions of a file. It is unmarshalled from its octal
+// representation (e.g. "0660").
+type FileMode os.FileMode
+
+func (m *FileMode) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.ScalarNode {
+		return fmt.Errorf("FileMode: unexpected YAML node kind %d", value.Kind)
+	}
+	return m.UnmarshalText([]byte(value.Value))
+}
+
+func (m *FileMode) UnmarshalText(text []byte) error {
+	mode, err := strconv.ParseUint(string(text), 8, 32)
+	if err != nil || mode > uint64(fs.ModePerm) {
+		return fmt.Errorf("invalid file mode %q. Must be octal permissions (e.g. 0660)", string(text))
+	}
+	*m = FileMode(mode)
+	return nil
+}
+
+func (m FileMode) String() string {
+	return fmt.Sprintf("%#o", uint32(m))
+}
+
+// listenUnix listens on a Unix domain socket, whose file is created with the provided permissions.
+// The socket file is removed when the listener is closed.
+func listenUnix(socket string, mode FileMode) (net.Listener, error) {
+	if err := removeStaleSocket(socket); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("listening on Unix socket: %w", err)
+	}
+	if err := os.Chmod(socket, os.FileMode(mode)); err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("setting the permissions of the Unix socket: %w", err)
+	}
+	return listener, nil
+}
+
+// removeStaleSocket removes the socket file that might have been left by a previous execution
+// of Beyla that wasn't gracefully stopped. It refuses to remove files that aren't sockets, or
+// sockets that still accept connections.
+func removeStaleSocket(socket string) error {
+	info, err := os.Lstat(socket)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("checking the Unix socket file: %w", err)
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("%s already exists and is not a Unix socket", socket)
+	}
+	if conn, err := net.Dial("unix", socket); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("%s is already in use by another process", socket)
+	}
+	log().Debug("removing stale Unix socket", "socket", socket)
+	if err := os.Remove(socket); err != nil {
+		return fmt.Errorf("removing stale Unix socket: %w", err)
+	}
+	return nil
+}
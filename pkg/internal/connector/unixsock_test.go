@@ -0,0 +1,182 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mariomac/guara/pkg/test"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const timeout = 5 * time.Second
+
+// unixClient returns an HTTP client that connects to the provided Unix socket, as a sidecar
+// scraper would do
+func unixClient(socket string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+}
+
+func scrape(t require.TestingT, client *http.Client, path string) string {
+	resp, err := client.Get("http://unix" + path)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func testCounter(name string) prometheus.Counter {
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: name})
+	counter.Add(3)
+	return counter
+}
+
+func TestUnixSocket(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	socket := filepath.Join(t.TempDir(), "metrics.sock")
+
+	// GIVEN metrics and handlers that are only served from a Unix socket
+	pm := &PrometheusManager{}
+	pm.Register(0, "/metrics", testCounter("app_requests_total"))
+	pm.Register(0, "/internal/metrics", testCounter("internal_requests_total"))
+	pm.Handle(0, "/readyz", http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	}))
+	pm.UnixSocket(0, socket, 0o600)
+
+	// WHEN the HTTP endpoints are started
+	pm.StartHTTP(ctx)
+
+	// THEN the socket file is created with the configured permissions
+	client := unixClient(socket)
+	test.Eventually(t, timeout, func(t require.TestingT) {
+		info, err := os.Stat(socket)
+		require.NoError(t, err)
+		require.Equal(t, fs.FileMode(0o600), info.Mode().Perm())
+		require.Equal(t, fs.ModeSocket, info.Mode().Type())
+	})
+	// AND all the endpoints can be scraped through it
+	assert.Contains(t, scrape(t, client, "/metrics"), "app_requests_total 3")
+	assert.Contains(t, scrape(t, client, "/internal/metrics"), "internal_requests_total 3")
+	scrape(t, client, "/readyz")
+
+	// AND the handlers that are registered later are also served
+	pm.Handle(0, "/debug/report", http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		_, _ = rw.Write([]byte("report"))
+	}))
+	assert.Equal(t, "report", scrape(t, client, "/debug/report"))
+
+	// AND WHEN the context is cancelled
+	cancel()
+
+	// THEN the socket file is removed
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(socket)
+		return errors.Is(err, fs.ErrNotExist)
+	}, timeout, 10*time.Millisecond)
+}
+
+func TestUnixSocket_AndPort(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	socket := filepath.Join(t.TempDir(), "metrics.sock")
+	port := freePort(t)
+
+	// GIVEN metrics that are served from both a port and a Unix socket
+	pm := &PrometheusManager{}
+	pm.Register(port, "/metrics", testCounter("app_requests_total"))
+	pm.UnixSocket(port, socket, 0o660)
+	pm.StartHTTP(ctx)
+
+	// THEN the metrics can be scraped from both
+	test.Eventually(t, timeout, func(t require.TestingT) {
+		require.Contains(t, scrape(t, unixClient(socket), "/metrics"), "app_requests_total 3")
+		resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/metrics", port))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestUnixSocket_StaleFile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	socket := filepath.Join(t.TempDir(), "metrics.sock")
+
+	// GIVEN a socket file that was left by a process that was not gracefully stopped
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: socket, Net: "unix"})
+	require.NoError(t, err)
+	stale.SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+	require.FileExists(t, socket)
+
+	// WHEN the Unix socket is served
+	pm := &PrometheusManager{}
+	pm.Register(0, "/metrics", testCounter("app_requests_total"))
+	pm.UnixSocket(0, socket, 0o660)
+	pm.StartHTTP(ctx)
+
+	// THEN the stale file is replaced
+	test.Eventually(t, timeout, func(t require.TestingT) {
+		require.Contains(t, scrape(t, unixClient(socket), "/metrics"), "app_requests_total 3")
+	})
+}
+
+func TestRemoveStaleSocket(t *testing.T) {
+	dir := t.TempDir()
+
+	// a missing file is not an error
+	require.NoError(t, removeStaleSocket(filepath.Join(dir, "missing.sock")))
+
+	// files that are not sockets are never removed
+	regular := filepath.Join(dir, "regular.sock")
+	require.NoError(t, os.WriteFile(regular, []byte("data"), 0o600))
+	require.Error(t, removeStaleSocket(regular))
+	require.FileExists(t, regular)
+
+	// sockets that still accept connections are never removed
+	inUse := filepath.Join(dir, "inuse.sock")
+	listener, err := net.Listen("unix", inUse)
+	require.NoError(t, err)
+	defer listener.Close()
+	require.Error(t, removeStaleSocket(inUse))
+	require.FileExists(t, inUse)
+}
+
+func TestFileMode(t *testing.T) {
+	var mode FileMode
+	require.NoError(t, mode.UnmarshalText([]byte("0640")))
+	assert.Equal(t, FileMode(0o640), mode)
+	assert.Equal(t, "0640", mode.String())
+
+	require.NoError(t, yaml.Unmarshal([]byte("660"), &mode))
+	assert.Equal(t, FileMode(0o660), mode)
+
+	require.Error(t, mode.UnmarshalText([]byte("rw-rw----")))
+	require.Error(t, mode.UnmarshalText([]byte("7777")))
+}
+
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
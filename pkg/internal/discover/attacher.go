@@ -10,9 +10,13 @@ import (
 
 	"github.com/grafana/beyla/pkg/beyla"
 	"github.com/grafana/beyla/pkg/internal/ebpf"
+	"github.com/grafana/beyla/pkg/internal/ebpf/attachment"
+	"github.com/grafana/beyla/pkg/internal/ebpf/diagnostics"
+	"github.com/grafana/beyla/pkg/internal/exec"
 	"github.com/grafana/beyla/pkg/internal/goexec"
 	"github.com/grafana/beyla/pkg/internal/helpers"
 	"github.com/grafana/beyla/pkg/internal/imetrics"
+	"github.com/grafana/beyla/pkg/internal/report"
 	"github.com/grafana/beyla/pkg/internal/svc"
 )
 
@@ -26,6 +30,9 @@ type TraceAttacher struct {
 	DiscoveredTracers chan *ebpf.ProcessTracer
 	DeleteTracers     chan *Instrumentable
 	Metrics           imetrics.Reporter
+	Probes            *report.Probes
+	Attachments       *attachment.Watchdog
+	Diagnostics       *diagnostics.Reporter
 	pinPath           string
 
 	// processInstances keeps track of the instances of each process. This will help making sure
@@ -36,6 +43,22 @@ type TraceAttacher struct {
 	// keeps a copy of all the tracers for a given executable path
 	existingTracers map[uint64]*ebpf.ProcessTracer
 	reusableTracer  *ebpf.ProcessTracer
+
+	// instrumented processes by PID, to report them as uninstrumented with the same labels
+	instrumented map[int32]instrumentedProcess
+}
+
+// Instrumentation types of the processes, as reported by the internal metrics
+const (
+	instrumentationGo      = "go-uprobes"
+	instrumentationKprobes = "kprobes"
+	// the process is instrumented with kprobes, and its TLS library also with uprobes
+	instrumentationTLS = "tls"
+)
+
+type instrumentedProcess struct {
+	service         string
+	instrumentation string
 }
 
 func TraceAttacherProvider(ta *TraceAttacher) pipe.FinalProvider[[]Event[Instrumentable]] {
@@ -45,6 +68,7 @@ func TraceAttacherProvider(ta *TraceAttacher) pipe.FinalProvider[[]Event[Instrum
 func (ta *TraceAttacher) attacherLoop() (pipe.FinalFunc[[]Event[Instrumentable]], error) {
 	ta.log = slog.With("component", "discover.TraceAttacher")
 	ta.existingTracers = map[uint64]*ebpf.ProcessTracer{}
+	ta.instrumented = map[int32]instrumentedProcess{}
 	ta.processInstances = helpers.MultiCounter[uint64]{}
 	ta.pinPath = BuildPinPath(ta.Cfg)
 
@@ -92,6 +116,7 @@ func (ta *TraceAttacher) getTracer(ie *Instrumentable) (*ebpf.ProcessTracer, boo
 		if tracer.Type == ebpf.Generic {
 			monitorPIDs(ta.reusableTracer, ie)
 		}
+		ta.instrumentProcess(tracer, ie)
 		ta.log.Debug(".done")
 		return nil, false
 	}
@@ -145,13 +170,16 @@ func (ta *TraceAttacher) getTracer(ie *Instrumentable) (*ebpf.ProcessTracer, boo
 	}
 
 	tracer := &ebpf.ProcessTracer{
-		Programs:   programs,
-		ELFInfo:    ie.FileInfo,
-		Goffsets:   ie.Offsets,
-		Exe:        exe,
-		PinPath:    BuildPinPath(ta.Cfg),
-		SystemWide: ta.Cfg.Discovery.SystemWide,
-		Type:       tracerType,
+		Programs:    programs,
+		ELFInfo:     ie.FileInfo,
+		Goffsets:    ie.Offsets,
+		Exe:         exe,
+		PinPath:     BuildPinPath(ta.Cfg),
+		Probes:      ta.Probes,
+		Attachments: ta.Attachments,
+		Diagnostics: ta.Diagnostics,
+		SystemWide:  ta.Cfg.Discovery.SystemWide,
+		Type:        tracerType,
 	}
 	ta.log.Debug("new executable for discovered process",
 		"pid", ie.FileInfo.Pid,
@@ -167,10 +195,30 @@ func (ta *TraceAttacher) getTracer(ie *Instrumentable) (*ebpf.ProcessTracer, boo
 			ta.reusableTracer = tracer
 		}
 	}
+	ta.instrumentProcess(tracer, ie)
 	ta.log.Debug(".done")
 	return tracer, true
 }
 
+func (ta *TraceAttacher) instrumentProcess(tracer *ebpf.ProcessTracer, ie *Instrumentable) {
+	ip := instrumentedProcess{
+		service:         ie.FileInfo.Service.Name,
+		instrumentation: instrumentationType(tracer, ie.FileInfo.Pid),
+	}
+	ta.instrumented[ie.FileInfo.Pid] = ip
+	ta.Metrics.InstrumentProcess(ip.service, ip.instrumentation)
+}
+
+func instrumentationType(tracer *ebpf.ProcessTracer, pid int32) string {
+	if tracer.Type == ebpf.Go {
+		return instrumentationGo
+	}
+	if maps, err := exec.FindLibMaps(pid); err == nil && exec.LibPath("libssl.so", maps) != nil {
+		return instrumentationTLS
+	}
+	return instrumentationKprobes
+}
+
 func monitorPIDs(tracer *ebpf.ProcessTracer, ie *Instrumentable) {
 	// If the user does not override the service name via configuration
 	// the service name is the name of the found executable
@@ -206,6 +254,10 @@ func (ta *TraceAttacher) notifyProcessDeletion(ie *Instrumentable) {
 		// to avoid that a new process reusing this PID could send traces
 		// unless explicitly allowed
 		tracer.BlockPID(uint32(ie.FileInfo.Pid))
+		if ip, ok := ta.instrumented[ie.FileInfo.Pid]; ok {
+			delete(ta.instrumented, ie.FileInfo.Pid)
+			ta.Metrics.UninstrumentProcess(ip.service, ip.instrumentation)
+		}
 
 		// if there are no more trace instances for a Go program, we need to notify that
 		// the tracer needs to be stopped and deleted.
@@ -67,7 +67,7 @@ func (pf *ProcessFinder) Start() (<-chan *ebpf.ProcessTracer, <-chan *Instrument
 	discoveredTracers, deleteTracers := make(chan *ebpf.ProcessTracer), make(chan *Instrumentable)
 
 	gb := pipe.NewBuilder(&nodesMap{}, pipe.ChannelBufferLen(pf.cfg.ChannelBufferLen))
-	pipe.AddStart(gb, processWatcher, ProcessWatcherFunc(pf.ctx, pf.cfg))
+	pipe.AddStart(gb, processWatcher, ProcessWatcherFunc(pf.ctx, pf.cfg, pf.ctxInfo.Diagnostics))
 	pipe.AddMiddleProvider(gb, ptrWatcherKubeEnricher,
 		WatcherKubeEnricherProvider(pf.ctxInfo.K8sEnabled, pf.ctxInfo.AppO11y.K8sInformer))
 	pipe.AddMiddleProvider(gb, criteriaMatcher, CriteriaMatcherProvider(pf.cfg))
@@ -80,6 +80,9 @@ func (pf *ProcessFinder) Start() (<-chan *ebpf.ProcessTracer, <-chan *Instrument
 		DiscoveredTracers: discoveredTracers,
 		DeleteTracers:     deleteTracers,
 		Metrics:           pf.ctxInfo.Metrics,
+		Probes:            pf.ctxInfo.Probes,
+		Attachments:       pf.ctxInfo.Attachments,
+		Diagnostics:       pf.ctxInfo.Diagnostics,
 	}))
 	pipeline, err := gb.Build()
 	if err != nil {
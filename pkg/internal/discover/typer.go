@@ -151,6 +151,15 @@ func (t *typer) inspectOffsets(execElf *exec.FileInfo) (*goexec.Offsets, bool, e
 				t.log.Debug("couldn't find go specific tracers", "error", err)
 				return nil, false, err
 			}
+			if len(offsets.FieldSources) == 0 {
+				t.metrics.GoOffsetsUnresolved()
+				t.log.Warn("can't resolve the offsets of the Go structs. Instrumentation might not work."+
+					" If the executable was built with a recent Go version, you can provide updated offsets"+
+					" with the BEYLA_BPF_GO_OFFSETS_FILE option", "pid", execElf.Pid, "comm", execElf.CmdExePath)
+			} else {
+				t.log.Info("resolved the offsets of the Go structs", "pid", execElf.Pid,
+					"comm", execElf.CmdExePath, "sources", offsets.FieldSources)
+			}
 			return offsets, true, nil
 		}
 	}
@@ -22,8 +22,8 @@ var (
 type kubeMetadata interface {
 	FetchPodOwnerInfo(pod *kube.PodInfo)
 	GetContainerPod(containerID string) (*kube.PodInfo, bool)
-	AddPodEventHandler(handler cache.ResourceEventHandler) error
-	AddReplicaSetEventHandler(handler cache.ResourceEventHandler) error
+	AddPodEventHandler(handler cache.ResourceEventHandler) (*kube.EventHandlerRegistration, error)
+	AddReplicaSetEventHandler(handler cache.ResourceEventHandler) (*kube.EventHandlerRegistration, error)
 }
 
 // watcherKubeEnricher keeps an update relational snapshot of the in-host process-pods-deployments,
@@ -73,7 +73,7 @@ func (wk *watcherKubeEnricher) init() error {
 
 	// the podsInfoCh channel will receive any update about pods being created or deleted
 	wk.podsInfoCh = make(chan Event[*kube.PodInfo], 10)
-	if err := wk.informer.AddPodEventHandler(cache.ResourceEventHandlerFuncs{
+	if _, err := wk.informer.AddPodEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			wk.podsInfoCh <- Event[*kube.PodInfo]{Type: EventCreated, Obj: obj.(*kube.PodInfo)}
 		},
@@ -81,7 +81,9 @@ func (wk *watcherKubeEnricher) init() error {
 			wk.podsInfoCh <- Event[*kube.PodInfo]{Type: EventCreated, Obj: newObj.(*kube.PodInfo)}
 		},
 		DeleteFunc: func(obj interface{}) {
-			wk.podsInfoCh <- Event[*kube.PodInfo]{Type: EventDeleted, Obj: obj.(*kube.PodInfo)}
+			if pod, ok := kube.DeletedObject[*kube.PodInfo](obj); ok {
+				wk.podsInfoCh <- Event[*kube.PodInfo]{Type: EventDeleted, Obj: pod}
+			}
 		},
 	}); err != nil {
 		return fmt.Errorf("can't register watcherKubeEnricher as Pod event handler in the K8s informer: %w", err)
@@ -89,7 +91,7 @@ func (wk *watcherKubeEnricher) init() error {
 
 	// the rsInfoCh channel will receive any update about replicasets being created or deleted
 	wk.rsInfoCh = make(chan Event[*kube.ReplicaSetInfo], 10)
-	if err := wk.informer.AddReplicaSetEventHandler(cache.ResourceEventHandlerFuncs{
+	if _, err := wk.informer.AddReplicaSetEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			wk.rsInfoCh <- Event[*kube.ReplicaSetInfo]{Type: EventCreated, Obj: obj.(*kube.ReplicaSetInfo)}
 		},
@@ -97,7 +99,9 @@ func (wk *watcherKubeEnricher) init() error {
 			wk.rsInfoCh <- Event[*kube.ReplicaSetInfo]{Type: EventCreated, Obj: newObj.(*kube.ReplicaSetInfo)}
 		},
 		DeleteFunc: func(obj interface{}) {
-			wk.rsInfoCh <- Event[*kube.ReplicaSetInfo]{Type: EventDeleted, Obj: obj.(*kube.ReplicaSetInfo)}
+			if rs, ok := kube.DeletedObject[*kube.ReplicaSetInfo](obj); ok {
+				wk.rsInfoCh <- Event[*kube.ReplicaSetInfo]{Type: EventDeleted, Obj: rs}
+			}
 		},
 	}); err != nil {
 		return fmt.Errorf("can't register watcherKubeEnricher as ReplicaSet event handler in the K8s informer: %w", err)
@@ -16,6 +16,7 @@ import (
 
 	"github.com/grafana/beyla/pkg/beyla"
 	"github.com/grafana/beyla/pkg/internal/ebpf"
+	"github.com/grafana/beyla/pkg/internal/ebpf/diagnostics"
 	"github.com/grafana/beyla/pkg/internal/ebpf/watcher"
 	"github.com/grafana/beyla/pkg/services"
 )
@@ -51,10 +52,13 @@ func wplog() *slog.Logger {
 
 // ProcessWatcherFunc polls every PollInterval for new processes and forwards either new or deleted process PIDs
 // as well as PIDs from processes that setup a new connection
-func ProcessWatcherFunc(ctx context.Context, cfg *beyla.Config) pipe.StartFunc[[]Event[processAttrs]] {
+func ProcessWatcherFunc(
+	ctx context.Context, cfg *beyla.Config, diag *diagnostics.Reporter,
+) pipe.StartFunc[[]Event[processAttrs]] {
 	acc := pollAccounter{
 		ctx:               ctx,
 		cfg:               cfg,
+		diagnostics:       diag,
 		interval:          cfg.Discovery.PollInterval,
 		pids:              map[PID]processAttrs{},
 		pidPorts:          map[pidPort]processAttrs{},
@@ -95,6 +99,8 @@ type pollAccounter struct {
 	executableReady func(PID) bool
 	// injectable function to load the bpf program
 	loadBPFWatcher func(cfg *beyla.Config, events chan<- watcher.Event) error
+	// diagnostics reports the cause of the failure to load the bpf program
+	diagnostics *diagnostics.Reporter
 	// we use these to ensure we poll for the open ports effectively
 	stateMux          sync.Mutex
 	bpfWatcherEnabled bool
@@ -108,6 +114,7 @@ func (pa *pollAccounter) Run(out chan<- []Event[processAttrs]) {
 	bpfWatchEvents := make(chan watcher.Event, 100)
 	if err := pa.loadBPFWatcher(pa.cfg, bpfWatchEvents); err != nil {
 		log.Error("Unable to load eBPF watcher for process events", "error", err)
+		pa.diagnostics.Report(log, err)
 	}
 
 	go pa.watchForProcessEvents(log, bpfWatchEvents)
@@ -0,0 +1,107 @@
+package attachment
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+)
+
+// Link is the Attachment of a program through an eBPF link (kprobes, uprobes, tracepoints...)
+type Link struct {
+	attach func() (link.Link, error)
+
+	mt   sync.Mutex
+	link link.Link
+	// program that was attached through the link, if the kernel allows querying it
+	program ebpf.ProgramID
+}
+
+// NewLink attaches a program with the provided function, which is invoked again to re-attach it
+func NewLink(attach func() (link.Link, error)) (*Link, error) {
+	l := &Link{attach: attach}
+	if err := l.Reattach(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Check that the link is still valid and keeps the attached program
+func (l *Link) Check() error {
+	l.mt.Lock()
+	defer l.mt.Unlock()
+	if l.link == nil {
+		return errors.New("link is closed")
+	}
+	info, err := l.link.Info()
+	if errors.Is(err, link.ErrNotSupported) {
+		// some links (e.g. perf events attached through ioctl in kernels older than 5.15)
+		// can't be queried, so they are assumed to be valid
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("querying link: %w", err)
+	}
+	if l.program != 0 && info.Program != l.program {
+		return fmt.Errorf("link points to program %d, expected %d", info.Program, l.program)
+	}
+	return nil
+}
+
+// Reattach closes the current link, if any, and attaches the program again
+func (l *Link) Reattach() error {
+	l.mt.Lock()
+	defer l.mt.Unlock()
+	if l.link != nil {
+		_ = l.link.Close()
+		l.link = nil
+	}
+	lnk, err := l.attach()
+	if err != nil {
+		return err
+	}
+	l.link = lnk
+	l.program = 0
+	if info, err := lnk.Info(); err == nil {
+		l.program = info.Program
+	}
+	return nil
+}
+
+// Close the current link
+func (l *Link) Close() error {
+	l.mt.Lock()
+	defer l.mt.Unlock()
+	if l.link == nil {
+		return nil
+	}
+	err := l.link.Close()
+	l.link = nil
+	return err
+}
+
+// AttachLink attaches a program with the provided function, and watches it until the returned
+// closer is closed. The closer also closes the link.
+func (w *Watchdog) AttachLink(probeType, name string, attach func() (link.Link, error)) (io.Closer, error) {
+	if w == nil {
+		return attach()
+	}
+	l, err := NewLink(attach)
+	if err != nil {
+		return nil, err
+	}
+	return &watchedCloser{Closer: l, unwatch: w.Watch(probeType, name, l)}, nil
+}
+
+type watchedCloser struct {
+	io.Closer
+	unwatch func()
+}
+
+func (c *watchedCloser) Close() error {
+	c.unwatch()
+	return c.Closer.Close()
+}
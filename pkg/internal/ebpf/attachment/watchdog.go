@@ -0,0 +1,174 @@
+// Package attachment verifies periodically that the eBPF programs of Beyla are still attached to
+// their hooks, and re-attaches them when they aren't. For example, another tool could flush the
+// Traffic Control filters of a network interface, or the link to a probe could become invalid.
+package attachment
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+)
+
+func wlog() *slog.Logger {
+	return slog.With("component", "attachment.Watchdog")
+}
+
+// Attachment of an eBPF program to its hook
+type Attachment interface {
+	// Check returns an error if the program is not attached to its hook anymore. It must be cheap,
+	// as it is invoked periodically for all the attachments.
+	Check() error
+	// Reattach the program to its hook
+	Reattach() error
+}
+
+// Watchdog verifies periodically the watched attachments, re-attaching the programs that are
+// found detached.
+// A nil Watchdog is valid: it does not watch anything.
+type Watchdog struct {
+	period  time.Duration
+	metrics imetrics.Reporter
+
+	mt      sync.Mutex
+	watched map[*watched]struct{}
+	// names of the attachments that are detached and could not be re-attached
+	failed []string
+}
+
+type watched struct {
+	probeType string
+	name      string
+	att       Attachment
+	// mt prevents a program from being re-attached while it is being detached on purpose
+	mt        sync.Mutex
+	unwatched bool
+	failed    bool
+}
+
+func NewWatchdog(period time.Duration, metrics imetrics.Reporter) *Watchdog {
+	return &Watchdog{
+		period:  period,
+		metrics: metrics,
+		watched: map[*watched]struct{}{},
+	}
+}
+
+// Watch starts verifying the provided attachment of a program of the given type (kprobe, uprobe, tc...).
+// The returned function stops watching it, and must be invoked before the program is detached on
+// purpose (e.g. because its instrumented process ended, or the configuration changed), so the
+// Watchdog does not re-attach it.
+func (w *Watchdog) Watch(probeType, name string, att Attachment) (unwatch func()) {
+	if w == nil {
+		return func() {}
+	}
+	wt := &watched{probeType: probeType, name: name, att: att}
+	w.mt.Lock()
+	w.watched[wt] = struct{}{}
+	w.mt.Unlock()
+	return func() {
+		// waits for any ongoing verification of the attachment
+		wt.mt.Lock()
+		wt.unwatched = true
+		wt.mt.Unlock()
+		w.mt.Lock()
+		delete(w.watched, wt)
+		w.mt.Unlock()
+	}
+}
+
+// Start verifying the watched attachments periodically, until the context is canceled
+func (w *Watchdog) Start(ctx context.Context) {
+	if w == nil || w.period <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(w.period)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				w.verify()
+			}
+		}
+	}()
+}
+
+// verify all the watched attachments, re-attaching the programs that are detached
+func (w *Watchdog) verify() {
+	log := wlog()
+	w.mt.Lock()
+	all := make([]*watched, 0, len(w.watched))
+	for wt := range w.watched {
+		all = append(all, wt)
+	}
+	w.mt.Unlock()
+
+	var failed []string
+	for _, wt := range all {
+		if wt.verify(log, w.metrics) {
+			failed = append(failed, wt.probeType+" "+wt.name)
+		}
+	}
+	sort.Strings(failed)
+	w.metrics.EBPFDetached(len(failed))
+	w.mt.Lock()
+	w.failed = failed
+	w.mt.Unlock()
+}
+
+// verify returns true if the program is detached and could not be re-attached
+func (wt *watched) verify(log *slog.Logger, metrics imetrics.Reporter) bool {
+	wt.mt.Lock()
+	defer wt.mt.Unlock()
+	if wt.unwatched {
+		return false
+	}
+	err := wt.att.Check()
+	if err == nil {
+		if wt.failed {
+			log.Info("eBPF program is attached again", "type", wt.probeType, "name", wt.name)
+			wt.failed = false
+		}
+		return false
+	}
+	if wt.failed {
+		// we already tried and reported it. Trying again silently
+		if wt.att.Reattach() == nil {
+			log.Info("eBPF program re-attached", "type", wt.probeType, "name", wt.name)
+			metrics.EBPFReattach(wt.probeType, true)
+			wt.failed = false
+		}
+		return wt.failed
+	}
+	log.Warn("eBPF program is detached. Re-attaching it", "type", wt.probeType, "name", wt.name, "reason", err)
+	if err := wt.att.Reattach(); err != nil {
+		log.Error("can't re-attach eBPF program", "type", wt.probeType, "name", wt.name, "error", err)
+		metrics.EBPFReattach(wt.probeType, false)
+		wt.failed = true
+		return true
+	}
+	metrics.EBPFReattach(wt.probeType, true)
+	return false
+}
+
+// Check is a health.Check that fails if, in the last verification, any program was detached
+// and could not be re-attached
+func (w *Watchdog) Check(_ context.Context) error {
+	if w == nil {
+		return nil
+	}
+	w.mt.Lock()
+	defer w.mt.Unlock()
+	if len(w.failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("detached eBPF programs: %s", strings.Join(w.failed, ", "))
+}
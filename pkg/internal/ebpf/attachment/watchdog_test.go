@@ -0,0 +1,157 @@
+package attachment
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mariomac/guara/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+)
+
+type fakeAttachment struct {
+	mt        sync.Mutex
+	attached  bool
+	canAttach bool
+	attempts  int
+}
+
+func (f *fakeAttachment) Check() error {
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	if !f.attached {
+		return errors.New("detached")
+	}
+	return nil
+}
+
+func (f *fakeAttachment) Reattach() error {
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	f.attempts++
+	if !f.canAttach {
+		return errors.New("can't attach")
+	}
+	f.attached = true
+	return nil
+}
+
+func (f *fakeAttachment) set(attached, canAttach bool) {
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	f.attached, f.canAttach = attached, canAttach
+}
+
+func (f *fakeAttachment) reattachments() int {
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	return f.attempts
+}
+
+type fakeMetrics struct {
+	imetrics.NoopReporter
+	mt       sync.Mutex
+	results  map[bool]int
+	detached int
+}
+
+func (f *fakeMetrics) EBPFReattach(_ string, success bool) {
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	f.results[success]++
+}
+
+func (f *fakeMetrics) EBPFDetached(programs int) {
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	f.detached = programs
+}
+
+func TestWatchdog(t *testing.T) {
+	metrics := &fakeMetrics{results: map[bool]int{}}
+	wd := NewWatchdog(time.Hour, metrics)
+	kprobe := &fakeAttachment{attached: true, canAttach: true}
+	tc := &fakeAttachment{attached: true, canAttach: true}
+	wd.Watch("kprobe", "tcp_connect", kprobe)
+	wd.Watch("tc", "eth0", tc)
+
+	// WHEN all the programs are attached
+	wd.verify()
+	// THEN nothing is re-attached
+	assert.Zero(t, kprobe.reattachments())
+	assert.Zero(t, tc.reattachments())
+	require.NoError(t, wd.Check(context.Background()))
+
+	// WHEN a program is detached and can be re-attached
+	tc.set(false, true)
+	wd.verify()
+	// THEN it is re-attached
+	assert.Equal(t, 1, tc.reattachments())
+	require.NoError(t, tc.Check())
+	require.NoError(t, wd.Check(context.Background()))
+	assert.Equal(t, map[bool]int{true: 1}, metrics.results)
+
+	// WHEN a program is detached and can't be re-attached
+	kprobe.set(false, false)
+	wd.verify()
+	// THEN the readiness check fails
+	assert.Equal(t, 1, kprobe.reattachments())
+	require.ErrorContains(t, wd.Check(context.Background()), "kprobe tcp_connect")
+	assert.Equal(t, map[bool]int{true: 1, false: 1}, metrics.results)
+	assert.Equal(t, 1, metrics.detached)
+
+	// WHEN the program can be re-attached again
+	kprobe.set(false, true)
+	wd.verify()
+	// THEN it is re-attached and the readiness check succeeds
+	assert.Equal(t, 2, kprobe.reattachments())
+	require.NoError(t, wd.Check(context.Background()))
+	assert.Equal(t, map[bool]int{true: 2, false: 1}, metrics.results)
+	assert.Zero(t, metrics.detached)
+}
+
+func TestWatchdog_Unwatch(t *testing.T) {
+	wd := NewWatchdog(time.Hour, imetrics.NoopReporter{})
+	att := &fakeAttachment{attached: true, canAttach: true}
+	unwatch := wd.Watch("uprobe", "SSL_read", att)
+
+	// WHEN the program is detached on purpose
+	unwatch()
+	att.set(false, true)
+	wd.verify()
+
+	// THEN it is not re-attached
+	assert.Zero(t, att.reattachments())
+	require.NoError(t, wd.Check(context.Background()))
+}
+
+func TestWatchdog_Start(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wd := NewWatchdog(10*time.Millisecond, imetrics.NoopReporter{})
+	att := &fakeAttachment{attached: true, canAttach: true}
+	wd.Watch("tracepoint", "syscalls/sys_enter_exit", att)
+	wd.Start(ctx)
+
+	// WHEN the program is detached
+	att.set(false, true)
+
+	// THEN it is eventually re-attached
+	test.Eventually(t, 5*time.Second, func(t require.TestingT) {
+		require.Equal(t, 1, att.reattachments())
+		require.NoError(t, att.Check())
+	})
+}
+
+func TestWatchdog_Nil(t *testing.T) {
+	var wd *Watchdog
+	att := &fakeAttachment{}
+	wd.Watch("kprobe", "tcp_connect", att)()
+	wd.Start(context.Background())
+	require.NoError(t, wd.Check(context.Background()))
+}
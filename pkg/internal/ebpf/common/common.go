@@ -32,6 +32,13 @@ const EventTypeKHTTP2 = 7 // HTTP2/gRPC Events generated by kprobes
 
 var IntegrityModeOverride = false
 
+// SocketFiltersDisabled is set when Beyla lacks the capabilities to attach socket filters
+var SocketFiltersDisabled = false
+
+// SharedLibrariesDisabled is set when Beyla lacks the capabilities to instrument the shared
+// libraries of the processes
+var SharedLibrariesDisabled = false
+
 var ActiveNamespaces = make(map[uint32]uint32)
 
 // TracerConfig configuration for eBPF programs
@@ -62,6 +69,14 @@ type TracerConfig struct {
 	// If enabled, the kprobes based HTTP request tracking will start tracking the request
 	// headers to process any 'Traceparent' fields.
 	TrackRequestHeaders bool `yaml:"track_request_headers" env:"BEYLA_BPF_TRACK_REQUEST_HEADERS"`
+
+	// GoOffsetsFile is the path or the HTTP(S) URL of a Go offsets database that augments or
+	// overrides the offsets that are embedded in Beyla. It is reloaded on SIGHUP.
+	GoOffsetsFile string `yaml:"go_offsets_file" env:"BEYLA_BPF_GO_OFFSETS_FILE"`
+
+	// AttachmentCheckPeriod specifies how often Beyla verifies that its eBPF programs are still
+	// attached to their hooks, re-attaching them if needed. Zero disables the verification.
+	AttachmentCheckPeriod time.Duration `yaml:"attachment_check_period" env:"BEYLA_BPF_ATTACHMENT_CHECK_PERIOD"`
 }
 
 // Probe holds the information of the instrumentation points of a given function: its start and end offsets and
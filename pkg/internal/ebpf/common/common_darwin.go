@@ -3,3 +3,7 @@ package ebpfcommon
 func KernelVersion() (major, minor int) {
 	return 0, 0
 }
+
+func KernelRelease() string {
+	return ""
+}
@@ -10,6 +10,15 @@ func (f *Filter) Close() error {
 	return syscall.SetsockoptInt(f.Fd, unix.SOL_SOCKET, unix.SO_DETACH_BPF, 0)
 }
 
+// KernelRelease returns the release of the running kernel (e.g. 6.1.0-13-amd64)
+func KernelRelease() string {
+	var uname unix.Utsname
+	if err := unix.Uname(&uname); err != nil {
+		return ""
+	}
+	return unix.ByteSliceToString(uname.Release[:])
+}
+
 // Copied from https://github.com/golang/go/blob/go1.21.3/src/internal/syscall/unix/kernel_version_linux.go
 func KernelVersion() (major, minor int) {
 	var uname syscall.Utsname
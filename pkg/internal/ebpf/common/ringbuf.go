@@ -29,6 +29,8 @@ var readerFactory = func(rb *ebpf.Map) (ringBufReader, error) {
 }
 
 type ringBufForwarder struct {
+	// name of the tracer, used to label the internal metrics
+	tracer     string
 	cfg        *TracerConfig
 	logger     *slog.Logger
 	ringbuffer *ebpf.Map
@@ -42,8 +44,18 @@ type ringBufForwarder struct {
 	// belong to a process that does not match the discovery policies
 	filter  func([]request.Span) []request.Span
 	metrics imetrics.Reporter
+	// assembly accumulates the time spent decoding the events of the current batch
+	assembly time.Duration
 }
 
+// sharedTracer labels the internal metrics of the ring buffer that is shared by the
+// HTTP, gRPC and SQL tracers
+const sharedTracer = "shared"
+
+// assemblyStage labels the internal metrics about the decoding of the eBPF events into spans,
+// which precedes the application observability pipeline
+const assemblyStage = "appo11y.protocol_assembly"
+
 var singleRbf *ringBufForwarder
 var singleRbfLock sync.Mutex
 
@@ -64,8 +76,11 @@ func SharedRingbuf(
 	}
 
 	log := slog.With("component", "ringbuf.Tracer")
+	if metrics == nil {
+		metrics = imetrics.NoopReporter{}
+	}
 	rbf := ringBufForwarder{
-		cfg: cfg, logger: log, ringbuffer: ringbuffer,
+		tracer: sharedTracer, cfg: cfg, logger: log, ringbuffer: ringbuffer,
 		closers: nil, reader: ReadHTTPRequestTraceAsSpan,
 		filter: filter.Filter, metrics: metrics,
 	}
@@ -74,6 +89,7 @@ func SharedRingbuf(
 }
 
 func ForwardRingbuf(
+	tracer string,
 	cfg *TracerConfig,
 	ringbuffer *ebpf.Map,
 	filter ServiceFilter,
@@ -82,8 +98,11 @@ func ForwardRingbuf(
 	metrics imetrics.Reporter,
 	closers ...io.Closer,
 ) func(context.Context, chan<- []request.Span) {
+	if metrics == nil {
+		metrics = imetrics.NoopReporter{}
+	}
 	rbf := ringBufForwarder{
-		cfg: cfg, logger: logger, ringbuffer: ringbuffer,
+		tracer: tracer, cfg: cfg, logger: logger, ringbuffer: ringbuffer,
 		closers: closers, reader: reader,
 		filter: filter.Filter, metrics: metrics,
 	}
@@ -154,6 +173,7 @@ func (rbf *ringBufForwarder) readAndForwardInner(eventsReader ringBufReader, spa
 				return
 			}
 			rbf.logger.Error("error reading from perf reader", err)
+			rbf.metrics.TracerDroppedEvent(rbf.tracer, "read_error")
 			continue
 		}
 		rbf.processAndForward(record, spansChan)
@@ -170,9 +190,13 @@ func (rbf *ringBufForwarder) alreadyForwarded(ctx context.Context, _ []io.Closer
 func (rbf *ringBufForwarder) processAndForward(record ringbuf.Record, spansChan chan<- []request.Span) {
 	rbf.access.Lock()
 	defer rbf.access.Unlock()
+	rbf.metrics.TracerEvents(rbf.tracer, 1)
+	start := time.Now()
 	s, ignore, err := rbf.reader(&record)
+	rbf.assembly += time.Since(start)
 	if err != nil {
 		rbf.logger.Error("error parsing perf event", err)
+		rbf.metrics.TracerDroppedEvent(rbf.tracer, "parse_error")
 		return
 	}
 	if ignore {
@@ -180,6 +204,7 @@ func (rbf *ringBufForwarder) processAndForward(record ringbuf.Record, spansChan
 	}
 	if !s.IsValid() {
 		rbf.logger.Debug("invalid span", "span", s)
+		rbf.metrics.TracerDroppedEvent(rbf.tracer, "invalid_span")
 		return
 	}
 	rbf.spans[rbf.spansLen] = s
@@ -197,11 +222,48 @@ func (rbf *ringBufForwarder) processAndForward(record ringbuf.Record, spansChan
 
 func (rbf *ringBufForwarder) flushEvents(spansChan chan<- []request.Span) {
 	rbf.metrics.TracerFlush(rbf.spansLen)
-	spansChan <- rbf.filter(rbf.spans[:rbf.spansLen])
+	rbf.metrics.PipelineStageThroughput(assemblyStage, rbf.spansLen)
+	rbf.metrics.PipelineStageLatency(assemblyStage, rbf.assembly)
+	rbf.assembly = 0
+	spans := rbf.filter(rbf.spans[:rbf.spansLen])
+	rbf.countEvents(spans)
+	spansChan <- spans
 	rbf.spans = make([]request.Span, rbf.cfg.BatchLength)
 	rbf.spansLen = 0
 }
 
+// capturedEvents groups the forwarded events for the internal metrics
+type capturedEvents struct {
+	protocol string
+	service  string
+}
+
+func (rbf *ringBufForwarder) countEvents(spans []request.Span) {
+	if _, ok := rbf.metrics.(imetrics.NoopReporter); ok {
+		return
+	}
+	// the events are aggregated by batch to minimize the overhead of the internal metrics
+	counts := map[capturedEvents]int{}
+	for i := range spans {
+		counts[capturedEvents{protocol: eventProtocol(spans[i].Type), service: spans[i].ServiceID.Name}]++
+	}
+	for ce, events := range counts {
+		rbf.metrics.CapturedEvents(ce.protocol, ce.service, events)
+	}
+}
+
+func eventProtocol(t request.EventType) string {
+	switch t {
+	case request.EventTypeHTTP, request.EventTypeHTTPClient:
+		return "http"
+	case request.EventTypeGRPC, request.EventTypeGRPCClient:
+		return "grpc"
+	case request.EventTypeSQLClient:
+		return "sql"
+	}
+	return "unknown"
+}
+
 func (rbf *ringBufForwarder) bgFlushOnTimeout(spansChan chan<- []request.Span) {
 	for {
 		<-rbf.ticker.C
@@ -33,6 +33,7 @@ func TestForwardRingbuf_CapacityFull(t *testing.T) {
 	fltr := TestPidsFilter{services: map[uint32]svc.ID{}}
 	fltr.AllowPID(1, svc.ID{Name: "myService"}, PIDTypeGo)
 	go ForwardRingbuf(
+		"test",
 		&TracerConfig{BatchLength: 10},
 		nil, // the source ring buffer can be null
 		&fltr,
@@ -65,6 +66,8 @@ func TestForwardRingbuf_CapacityFull(t *testing.T) {
 	// AND metrics are properly updated
 	assert.Equal(t, 2, metrics.flushes)
 	assert.Equal(t, 20, metrics.flushedLen)
+	assert.Equal(t, map[string]int{"test": 20}, metrics.events)
+	assert.Equal(t, map[string]int{"http/myService": 20}, metrics.captured)
 
 	// AND does not forward any extra message if no more elements are in the ring buffer
 	select {
@@ -85,6 +88,7 @@ func TestForwardRingbuf_Deadline(t *testing.T) {
 	fltr := TestPidsFilter{services: map[uint32]svc.ID{}}
 	fltr.AllowPID(1, svc.ID{Name: "myService"}, PIDTypeGo)
 	go ForwardRingbuf(
+		"test",
 		&TracerConfig{BatchLength: 10, BatchTimeout: 20 * time.Millisecond},
 		nil,   // the source ring buffer can be null
 		&fltr, // change fltr to a pointer
@@ -125,6 +129,7 @@ func TestForwardRingbuf_Close(t *testing.T) {
 	metrics := &metricsReporter{}
 	closable := closableObject{}
 	go ForwardRingbuf(
+		"test",
 		&TracerConfig{BatchLength: 10},
 		nil, // the source ring buffer can be null
 		(&IdentityPidsFilter{}),
@@ -208,6 +213,23 @@ type metricsReporter struct {
 	imetrics.NoopReporter
 	flushes    int
 	flushedLen int
+	events     map[string]int
+	// key: protocol/service
+	captured map[string]int
+}
+
+func (m *metricsReporter) CapturedEvents(protocol, service string, events int) {
+	if m.captured == nil {
+		m.captured = map[string]int{}
+	}
+	m.captured[protocol+"/"+service] += events
+}
+
+func (m *metricsReporter) TracerEvents(tracer string, len int) {
+	if m.events == nil {
+		m.events = map[string]int{}
+	}
+	m.events[tracer] += len
 }
 
 func (m *metricsReporter) TracerFlush(len int) {
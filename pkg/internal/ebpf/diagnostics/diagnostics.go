@@ -0,0 +1,174 @@
+// Package diagnostics classifies the most common failures when loading or attaching eBPF programs
+// (e.g. missing BTF, locked memory limit, programs too large for the verifier...), so Beyla can
+// report a human-readable cause with a suggested remediation instead of a raw verifier log.
+package diagnostics
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cilium/ebpf"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+)
+
+// CauseUnknown is reported for the failures that don't match any classification rule
+const CauseUnknown = "unknown"
+
+// Cause of a failure to load or attach an eBPF program
+type Cause struct {
+	// Name of the cause, as reported in the internal metrics
+	Name string
+	// Description of the cause, in human-readable form
+	Description string
+	// Remediation that is suggested to the user
+	Remediation string
+}
+
+type rule struct {
+	cause Cause
+	// pattern that is matched against the error message and the verifier log
+	pattern *regexp.Regexp
+}
+
+// rules to classify the failures, in order of evaluation: the first matching rule wins
+var rules = []rule{{
+	cause: Cause{
+		Name:        "missing_btf",
+		Description: "the kernel does not expose its BTF type information",
+		Remediation: "use a kernel built with CONFIG_DEBUG_INFO_BTF=y, and make sure that /sys/kernel/btf/vmlinux is readable",
+	},
+	pattern: regexp.MustCompile(`(?i)no BTF found|load(ing)? kernel (BTF )?spec|/sys/kernel/btf/vmlinux|kernel BTF is not supported`),
+}, {
+	cause: Cause{
+		Name:        "fentry_unsupported",
+		Description: "the kernel is too old for fentry/fexit programs",
+		Remediation: "fentry/fexit programs require Linux 5.5 or newer with BTF support. Upgrade the kernel",
+	},
+	pattern: regexp.MustCompile(`(?i)fentry|fexit|tracing prog(ram)?s? must provide btf_id|attach_btf_id`),
+}, {
+	cause: Cause{
+		Name:        "memlock_limit",
+		Description: "the locked memory limit is too low to load the eBPF programs and maps",
+		Remediation: "in kernels older than 5.11, grant the CAP_SYS_RESOURCE capability to Beyla, or raise the locked memory limit (ulimit -l unlimited)",
+	},
+	pattern: regexp.MustCompile(`(?i)MEMLOCK may be too low|RLIMIT_MEMLOCK`),
+}, {
+	cause: Cause{
+		Name:        "program_too_large",
+		Description: "the eBPF program is too large or too complex for the kernel verifier",
+		Remediation: "kernels older than 5.2 limit the programs to 4096 instructions. Upgrade the kernel, or disable optional instrumentation such as ebpf.track_request_headers",
+	},
+	pattern: regexp.MustCompile(`(?i)program is too large|too many instructions|sequence of \d+ jumps is too complex|argument list too long`),
+}, {
+	cause: Cause{
+		Name:        "missing_kernel_symbol",
+		Description: "the kernel function to instrument does not exist in the running kernel",
+		Remediation: "check whether the function is listed in /proc/kallsyms. Some kernel versions rename or inline it, so please report the kernel version to the Beyla maintainers",
+	},
+	pattern: regexp.MustCompile(`(?i)(perf_kprobe PMU|tracefs event)[^\n]*no such file or directory|symbol '?\S+'? not found`),
+}, {
+	cause: Cause{
+		Name:        "kallsyms_access",
+		Description: "Beyla can't access the kernel symbols or the tracing file system to attach the probes",
+		Remediation: "mount tracefs in /sys/kernel/tracing (or debugfs in /sys/kernel/debug), and make sure that the kernel.kptr_restrict sysctl allows reading /proc/kallsyms",
+	},
+	pattern: regexp.MustCompile(`(?i)kallsyms|kptr_restrict|neither debugfs nor tracefs are mounted|(tracefs|debugfs)[^\n]*(permission denied|operation not permitted)`),
+}, {
+	cause: Cause{
+		Name:        "unsupported_helper",
+		Description: "the eBPF program uses a helper function that the kernel does not support or does not allow",
+		Remediation: "upgrade the kernel. If the helper is bpf_probe_write_user, the kernel lockdown mode or the missing CAP_SYS_ADMIN capability prevent the trace context propagation",
+	},
+	pattern: regexp.MustCompile(`(?i)unknown func \w+|helper call is not allowed`),
+}, {
+	cause: Cause{
+		Name:        "missing_capabilities",
+		Description: "Beyla lacks the privileges to load or attach eBPF programs",
+		Remediation: "run Beyla as a privileged container, or grant it the CAP_BPF, CAP_PERFMON, CAP_SYS_PTRACE and CAP_DAC_READ_SEARCH capabilities",
+	},
+	pattern: regexp.MustCompile(`(?i)operation not permitted|permission denied`),
+}}
+
+// Classify returns the most likely cause of the provided failure to load or attach an eBPF program.
+// If no classification rule matches, the returned cause is named CauseUnknown.
+func Classify(err error) Cause {
+	text := err.Error()
+	if log := verifierLog(err); len(log) > 0 {
+		text += "\n" + strings.Join(log, "\n")
+	}
+	for _, r := range rules {
+		if r.pattern.MatchString(text) {
+			return r.cause
+		}
+	}
+	return Cause{Name: CauseUnknown}
+}
+
+func verifierLog(err error) []string {
+	var ve *ebpf.VerifierError
+	if errors.As(err, &ve) {
+		return ve.Log
+	}
+	return nil
+}
+
+// Reporter reports the causes of the eBPF failures.
+// A nil Reporter is valid: it logs the causes, but does not report them as metrics nor
+// stores the verifier logs.
+type Reporter struct {
+	// debug enables storing the full verifier logs in files
+	debug   bool
+	dir     string
+	metrics imetrics.Reporter
+}
+
+// NewReporter returns a Reporter that, if debug is true, stores the full verifier logs in
+// the temporary directory
+func NewReporter(debug bool, metrics imetrics.Reporter) *Reporter {
+	return &Reporter{debug: debug, dir: os.TempDir(), metrics: metrics}
+}
+
+// Report logs the cause of the provided failure to load or attach an eBPF program, along with
+// the suggested remediation.
+func (r *Reporter) Report(log *slog.Logger, err error) {
+	if err == nil {
+		return
+	}
+	cause := Classify(err)
+	attrs := []any{"cause", cause.Name}
+	if cause.Name != CauseUnknown {
+		attrs = append(attrs, "remediation", cause.Remediation)
+	}
+	if r != nil {
+		r.metrics.EBPFFailure(cause.Name)
+		if vlog := verifierLog(err); len(vlog) > 0 {
+			if !r.debug {
+				attrs = append(attrs, "verifierLog", "set BEYLA_BPF_DEBUG=true to store the full verifier log")
+			} else if file, ferr := r.storeLog(vlog); ferr != nil {
+				log.Debug("can't store the verifier log", "error", ferr)
+			} else {
+				attrs = append(attrs, "verifierLog", file)
+			}
+		}
+	}
+	if cause.Name == CauseUnknown {
+		log.Warn("eBPF failure of unknown cause", attrs...)
+	} else {
+		log.Warn("eBPF failure: "+cause.Description, attrs...)
+	}
+}
+
+func (r *Reporter) storeLog(vlog []string) (string, error) {
+	file := filepath.Join(r.dir, fmt.Sprintf("beyla-verifier-%d.log", time.Now().UnixNano()))
+	if err := os.WriteFile(file, []byte(strings.Join(vlog, "\n")+"\n"), 0o600); err != nil {
+		return "", err
+	}
+	return file, nil
+}
@@ -0,0 +1,108 @@
+package diagnostics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+)
+
+// readFailure reads a failure from the testdata folder. The first line of the file is the error
+// message. The rest of lines, if any, are the verifier log, as captured from real kernels.
+func readFailure(t *testing.T, file string) error {
+	content, err := os.ReadFile(filepath.Join("testdata", file))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	if len(lines) == 1 {
+		return errors.New(lines[0])
+	}
+	return fmt.Errorf("loading and assigning BPF objects: %w",
+		&ebpf.VerifierError{Cause: errors.New(lines[0]), Log: lines[1:]})
+}
+
+func TestClassify(t *testing.T) {
+	for _, tc := range []struct {
+		file  string
+		cause string
+	}{
+		{file: "missing_btf.log", cause: "missing_btf"},
+		{file: "fentry_unsupported.log", cause: "fentry_unsupported"},
+		{file: "memlock_limit.log", cause: "memlock_limit"},
+		{file: "program_too_large.log", cause: "program_too_large"},
+		{file: "program_too_complex.log", cause: "program_too_large"},
+		{file: "missing_kernel_symbol.log", cause: "missing_kernel_symbol"},
+		{file: "kallsyms_access.log", cause: "kallsyms_access"},
+		{file: "unsupported_helper.log", cause: "unsupported_helper"},
+		{file: "missing_capabilities.log", cause: "missing_capabilities"},
+		{file: "unknown.log", cause: CauseUnknown},
+	} {
+		t.Run(tc.file, func(t *testing.T) {
+			cause := Classify(readFailure(t, tc.file))
+			assert.Equal(t, tc.cause, cause.Name)
+			if tc.cause != CauseUnknown {
+				assert.NotEmpty(t, cause.Description)
+				assert.NotEmpty(t, cause.Remediation)
+			}
+		})
+	}
+}
+
+type failuresMetrics struct {
+	imetrics.NoopReporter
+	causes []string
+}
+
+func (f *failuresMetrics) EBPFFailure(cause string) {
+	f.causes = append(f.causes, cause)
+}
+
+func TestReporter(t *testing.T) {
+	metrics := &failuresMetrics{}
+	reporter := NewReporter(false, metrics)
+	reporter.dir = t.TempDir()
+	out := &bytes.Buffer{}
+	log := slog.New(slog.NewTextHandler(out, nil))
+
+	// WHEN a failure is reported without the debug flag
+	reporter.Report(log, readFailure(t, "program_too_large.log"))
+
+	// THEN the cause is logged in a single line with its remediation
+	assert.Equal(t, 1, strings.Count(out.String(), "\n"))
+	assert.Contains(t, out.String(), "cause=program_too_large")
+	assert.Contains(t, out.String(), "remediation=")
+	// AND it is counted in the metrics
+	assert.Equal(t, []string{"program_too_large"}, metrics.causes)
+	// AND the verifier log is not stored
+	files, err := os.ReadDir(reporter.dir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestReporter_Debug(t *testing.T) {
+	reporter := NewReporter(true, imetrics.NoopReporter{})
+	reporter.dir = t.TempDir()
+	out := &bytes.Buffer{}
+
+	// WHEN a verifier failure is reported with the debug flag
+	reporter.Report(slog.New(slog.NewTextHandler(out, nil)), readFailure(t, "unsupported_helper.log"))
+
+	// THEN the full verifier log is stored in a file
+	files, err := os.ReadDir(reporter.dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	content, err := os.ReadFile(filepath.Join(reporter.dir, files[0].Name()))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "205: (85) call bpf_probe_write_user#36")
+	// AND its path is logged
+	assert.Contains(t, out.String(), files[0].Name())
+}
@@ -17,15 +17,22 @@ import (
 	"github.com/prometheus/procfs"
 	"golang.org/x/sys/unix"
 
+	"github.com/grafana/beyla/pkg/internal/ebpf/attachment"
 	ebpfcommon "github.com/grafana/beyla/pkg/internal/ebpf/common"
 	"github.com/grafana/beyla/pkg/internal/exec"
 	"github.com/grafana/beyla/pkg/internal/goexec"
+	"github.com/grafana/beyla/pkg/internal/report"
 )
 
 type instrumenter struct {
 	offsets   *goexec.Offsets
 	exe       *link.Executable
 	closables []io.Closer
+	// target executable path, for the registry of attached probes
+	target string
+	probes *report.Probes
+	// attachments re-attaches the probes that are found detached
+	attachments *attachment.Watchdog
 }
 
 func ilog() *slog.Logger {
@@ -43,7 +50,7 @@ func (i *instrumenter) goprobes(p Tracer) error {
 			continue
 		}
 		log.Debug("going to instrument function", "function", funcName, "offsets", offs, "programs", funcPrograms)
-		if err := i.goprobe(ebpfcommon.Probe{
+		if err := i.goprobe(funcName, ebpfcommon.Probe{
 			Offsets:  offs,
 			Programs: funcPrograms,
 		}); err != nil {
@@ -55,29 +62,29 @@ func (i *instrumenter) goprobes(p Tracer) error {
 	return nil
 }
 
-func (i *instrumenter) goprobe(probe ebpfcommon.Probe) error {
+func (i *instrumenter) goprobe(funcName string, probe ebpfcommon.Probe) error {
 	// Attach BPF programs as start and return probes
 	if probe.Programs.Start != nil {
-		up, err := i.exe.Uprobe("", probe.Programs.Start, &link.UprobeOptions{
-			Address: probe.Offsets.Start,
-		})
-		if err != nil {
+		if err := i.attach(report.ProbeGoUprobe, funcName, i.target, func() (link.Link, error) {
+			return i.exe.Uprobe("", probe.Programs.Start, &link.UprobeOptions{
+				Address: probe.Offsets.Start,
+			})
+		}); err != nil {
 			return fmt.Errorf("setting uprobe: %w", err)
 		}
-		i.closables = append(i.closables, up)
 	}
 
 	if probe.Programs.End != nil {
 		// Go won't work with Uretprobes because of the way Go manages the stack. We need to set uprobes just before the return
 		// values: https://github.com/iovisor/bcc/issues/1320
 		for _, ret := range probe.Offsets.Returns {
-			urp, err := i.exe.Uprobe("", probe.Programs.End, &link.UprobeOptions{
-				Address: ret,
-			})
-			if err != nil {
+			if err := i.attach(report.ProbeGoReturn, funcName, i.target, func() (link.Link, error) {
+				return i.exe.Uprobe("", probe.Programs.End, &link.UprobeOptions{
+					Address: ret,
+				})
+			}); err != nil {
 				return fmt.Errorf("setting uretprobe: %w", err)
 			}
-			i.closables = append(i.closables, urp)
 		}
 	}
 
@@ -100,21 +107,21 @@ func (i *instrumenter) kprobes(p KprobesTracer) error {
 
 func (i *instrumenter) kprobe(funcName string, programs ebpfcommon.FunctionPrograms) error {
 	if programs.Start != nil {
-		kp, err := link.Kprobe(funcName, programs.Start, nil)
-		if err != nil {
+		if err := i.attach(report.ProbeKprobe, funcName, "", func() (link.Link, error) {
+			return link.Kprobe(funcName, programs.Start, nil)
+		}); err != nil {
 			return fmt.Errorf("setting kprobe: %w", err)
 		}
-		i.closables = append(i.closables, kp)
 	}
 
 	if programs.End != nil {
 		// The commented code doesn't work on certain kernels. We need to invesigate more to see if it's possible
 		// to productize it. Failure says: "neither debugfs nor tracefs are mounted".
-		kp, err := link.Kretprobe(funcName, programs.End, nil /*&link.KprobeOptions{RetprobeMaxActive: 1024}*/)
-		if err != nil {
+		if err := i.attach(report.ProbeKretprobe, funcName, "", func() (link.Link, error) {
+			return link.Kretprobe(funcName, programs.End, nil /*&link.KprobeOptions{RetprobeMaxActive: 1024}*/)
+		}); err != nil {
 			return fmt.Errorf("setting kretprobe: %w", err)
 		}
-		i.closables = append(i.closables, kp)
 	}
 
 	return nil
@@ -138,11 +145,18 @@ func (i *instrumenter) uprobes(pid int32, p Tracer) error {
 		instrPath := fmt.Sprintf("/proc/%d/exe", pid)
 
 		ino := uint64(0)
+		target := i.target
+
+		if libMap != nil && ebpfcommon.SharedLibrariesDisabled {
+			log.Debug("not instrumenting library because of missing capabilities", "lib", lib, "path", libMap.Pathname)
+			continue
+		}
 
 		if libMap != nil {
 			log.Debug("instrumenting library", "lib", lib, "path", libMap.Pathname)
 			// we do this to make sure instrumenting something like libssl.so works with Docker
 			instrPath = fmt.Sprintf("/proc/%d/map_files/%x-%x", pid, libMap.StartAddr, libMap.EndAddr)
+			target = libMap.Pathname
 
 			info, err := os.Stat(instrPath)
 			if err == nil {
@@ -169,7 +183,7 @@ func (i *instrumenter) uprobes(pid int32, p Tracer) error {
 
 		for funcName, funcPrograms := range pMap {
 			log.Debug("going to instrument function", "function", funcName, "programs", funcPrograms)
-			if err := i.uprobe(funcName, libExe, funcPrograms); err != nil {
+			if err := i.uprobe(funcName, libExe, target, funcPrograms); err != nil {
 				if funcPrograms.Required {
 					return fmt.Errorf("instrumenting function %q: %w", funcName, err)
 				}
@@ -188,34 +202,37 @@ func (i *instrumenter) uprobes(pid int32, p Tracer) error {
 	return nil
 }
 
-func (i *instrumenter) uprobe(funcName string, exe *link.Executable, probe ebpfcommon.FunctionPrograms) error {
+func (i *instrumenter) uprobe(funcName string, exe *link.Executable, target string, probe ebpfcommon.FunctionPrograms) error {
 	if probe.Start != nil {
-		up, err := exe.Uprobe(funcName, probe.Start, nil)
-		if err != nil {
+		if err := i.attach(report.ProbeUprobe, funcName, target, func() (link.Link, error) {
+			return exe.Uprobe(funcName, probe.Start, nil)
+		}); err != nil {
 			return fmt.Errorf("setting uprobe: %w", err)
 		}
-		i.closables = append(i.closables, up)
 	}
 
 	if probe.End != nil {
-		up, err := exe.Uretprobe(funcName, probe.End, nil)
-		if err != nil {
+		if err := i.attach(report.ProbeUretprobe, funcName, target, func() (link.Link, error) {
+			return exe.Uretprobe(funcName, probe.End, nil)
+		}); err != nil {
 			return fmt.Errorf("setting uretprobe: %w", err)
 		}
-		i.closables = append(i.closables, up)
 	}
 
 	return nil
 }
 
 func (i *instrumenter) sockfilters(p Tracer) error {
+	if ebpfcommon.SocketFiltersDisabled {
+		return nil
+	}
 	for _, filter := range p.SocketFilters() {
 		fd, err := attachSocketFilter(filter)
 		if err != nil {
 			return fmt.Errorf("attaching socket filter: %w", err)
 		}
 
-		p.AddCloser(&ebpfcommon.Filter{Fd: fd})
+		p.AddCloser(i.probes.Attached(report.Probe{Type: report.ProbeSocketFilter}, &ebpfcommon.Filter{Fd: fd}))
 	}
 
 	return nil
@@ -253,16 +270,36 @@ func (i *instrumenter) tracepoint(funcName string, programs ebpfcommon.FunctionP
 			return fmt.Errorf("invalid tracepoint type, must contain / in the name to separate the type and function name")
 		}
 		parts := strings.Split(funcName, "/")
-		kp, err := link.Tracepoint(parts[0], parts[1], programs.Start, nil)
-		if err != nil {
+		if err := i.attach(report.ProbeTracepoint, funcName, "", func() (link.Link, error) {
+			return link.Tracepoint(parts[0], parts[1], programs.Start, nil)
+		}); err != nil {
 			return fmt.Errorf("setting syscall: %w", err)
 		}
-		i.closables = append(i.closables, kp)
 	}
 
 	return nil
 }
 
+// attach the probe with the provided function, which is invoked again if the probe needs to be
+// re-attached. It keeps the link to the probe, to be closed with the tracer, and records it in the
+// registry of attached probes
+func (i *instrumenter) attach(probeType, funcName, target string, attach func() (link.Link, error)) error {
+	name := funcName
+	if target != "" {
+		name = target + ":" + funcName
+	}
+	lnk, err := i.attachments.AttachLink(probeType, name, attach)
+	if err != nil {
+		return err
+	}
+	i.closables = append(i.closables, i.probes.Attached(report.Probe{
+		Type:     probeType,
+		Function: funcName,
+		Target:   target,
+	}, lnk))
+	return nil
+}
+
 func isLittleEndian() bool {
 	var a uint16 = 1
 
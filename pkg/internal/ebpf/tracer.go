@@ -8,9 +8,12 @@ import (
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/link"
 
+	"github.com/grafana/beyla/pkg/internal/ebpf/attachment"
 	ebpfcommon "github.com/grafana/beyla/pkg/internal/ebpf/common"
+	"github.com/grafana/beyla/pkg/internal/ebpf/diagnostics"
 	"github.com/grafana/beyla/pkg/internal/exec"
 	"github.com/grafana/beyla/pkg/internal/goexec"
+	"github.com/grafana/beyla/pkg/internal/report"
 	"github.com/grafana/beyla/pkg/internal/request"
 	"github.com/grafana/beyla/pkg/internal/svc"
 )
@@ -94,6 +97,12 @@ type ProcessTracer struct {
 	Goffsets *goexec.Offsets
 	Exe      *link.Executable
 	PinPath  string
+	// Probes registers the eBPF probes that are attached. It can be nil.
+	Probes *report.Probes
+	// Attachments re-attaches the probes that are found detached. It can be nil.
+	Attachments *attachment.Watchdog
+	// Diagnostics reports the causes of the failures to load or attach the probes. It can be nil.
+	Diagnostics *diagnostics.Reporter
 
 	SystemWide bool
 	Type       ProcessTracerType
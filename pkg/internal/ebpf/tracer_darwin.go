@@ -8,7 +8,7 @@ import (
 
 // dummy implementations to avoid compilation errors in Darwin.
 // The tracer component is only usable in Linux.
-func (pt *ProcessTracer) Run(_ context.Context, _ chan<- []request.Span) {}
+func (pt *ProcessTracer) Run(_ context.Context, _ chan<- []request.Span) error { return nil }
 
 func RunUtilityTracer(_ UtilityTracer, _ string) error {
 	return nil
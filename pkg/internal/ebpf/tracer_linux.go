@@ -2,10 +2,8 @@ package ebpf
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"log/slog"
-	"os"
 	"reflect"
 	"strings"
 	"sync"
@@ -20,7 +18,9 @@ var loadMux sync.Mutex
 
 func ptlog() *slog.Logger { return slog.With("component", "ebpf.ProcessTracer") }
 
-func (pt *ProcessTracer) Run(ctx context.Context, out chan<- []request.Span) {
+// Run loads and attaches the eBPF programs of the process tracer, and starts forwarding
+// their traces in background. It returns an error if the programs couldn't be attached.
+func (pt *ProcessTracer) Run(ctx context.Context, out chan<- []request.Span) error {
 	pt.log = ptlog().With("path", pt.ELFInfo.CmdExePath, "pid", pt.ELFInfo.Pid)
 
 	pt.log.Debug("starting process tracer")
@@ -28,15 +28,13 @@ func (pt *ProcessTracer) Run(ctx context.Context, out chan<- []request.Span) {
 	trcrs, err := pt.tracers()
 	if err != nil {
 		pt.log.Error("couldn't trace process. Stopping process tracer", "error", err)
-		return
+		return err
 	}
 
 	for _, t := range trcrs {
 		go t.Run(ctx, out)
 	}
-	go func() {
-		<-ctx.Done()
-	}()
+	return nil
 }
 
 func (pt *ProcessTracer) loadSpec(p Tracer) (*ebpf.CollectionSpec, error) {
@@ -89,42 +87,45 @@ func (pt *ProcessTracer) tracers() ([]Tracer, error) {
 				}
 			}
 			if err != nil {
-				printVerifierErrorInfo(err)
+				pt.Diagnostics.Report(plog, err)
 				return nil, fmt.Errorf("loading and assigning BPF objects: %w", err)
 			}
 		}
 		i := instrumenter{
-			exe:     pt.Exe,
-			offsets: pt.Goffsets,
+			exe:         pt.Exe,
+			offsets:     pt.Goffsets,
+			target:      pt.ELFInfo.CmdExePath,
+			probes:      pt.Probes,
+			attachments: pt.Attachments,
 		}
 
 		// Go style Uprobes
 		if err := i.goprobes(p); err != nil {
-			printVerifierErrorInfo(err)
+			pt.Diagnostics.Report(plog, err)
 			return nil, err
 		}
 
 		// Kprobes to be used for native instrumentation points
 		if err := i.kprobes(p); err != nil {
-			printVerifierErrorInfo(err)
+			pt.Diagnostics.Report(plog, err)
 			return nil, err
 		}
 
 		// Uprobes to be used for native module instrumentation points
 		if err := i.uprobes(pt.ELFInfo.Pid, p); err != nil {
-			printVerifierErrorInfo(err)
+			pt.Diagnostics.Report(plog, err)
 			return nil, err
 		}
 
 		// Tracepoints support
 		if err := i.tracepoints(p); err != nil {
-			printVerifierErrorInfo(err)
+			pt.Diagnostics.Report(plog, err)
 			return nil, err
 		}
 
 		// Sock filters support
 		if err := i.sockfilters(p); err != nil {
-			printVerifierErrorInfo(err)
+			pt.Diagnostics.Report(plog, err)
 			return nil, err
 		}
 
@@ -134,13 +135,6 @@ func (pt *ProcessTracer) tracers() ([]Tracer, error) {
 	return tracers, nil
 }
 
-func printVerifierErrorInfo(err error) {
-	var ve *ebpf.VerifierError
-	if errors.As(err, &ve) {
-		_, _ = fmt.Fprintf(os.Stderr, "Error Log:\n %v\n", strings.Join(ve.Log, "\n"))
-	}
-}
-
 func RunUtilityTracer(p UtilityTracer, pinPath string) error {
 	i := instrumenter{}
 	plog := ptlog()
@@ -154,17 +148,14 @@ func RunUtilityTracer(p UtilityTracer, pinPath string) error {
 		Maps: ebpf.MapOptions{
 			PinPath: pinPath,
 		}}); err != nil {
-		printVerifierErrorInfo(err)
 		return fmt.Errorf("loading and assigning BPF objects: %w", err)
 	}
 
 	if err := i.kprobes(p); err != nil {
-		printVerifierErrorInfo(err)
 		return err
 	}
 
 	if err := i.tracepoints(p); err != nil {
-		printVerifierErrorInfo(err)
 		return err
 	}
 
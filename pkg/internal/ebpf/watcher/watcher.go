@@ -84,6 +84,7 @@ func (p *Watcher) Tracepoints() map[string]ebpfcommon.FunctionPrograms {
 func (p *Watcher) Run(ctx context.Context) {
 	p.events <- Event{Type: Ready}
 	ebpfcommon.ForwardRingbuf(
+		"watcher",
 		&p.cfg.EBPF,
 		p.bpfObjects.WatchEvents,
 		&ebpfcommon.IdentityPidsFilter{},
@@ -0,0 +1,133 @@
+// Package alias keeps reporting the former names of the Beyla-specific metrics and attributes that
+// have been renamed, so the users have a transition period to migrate their queries and dashboards.
+package alias
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"github.com/grafana/beyla/pkg/internal/export/metric"
+	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
+)
+
+func log() *slog.Logger {
+	return slog.With("component", "alias.Aliaser")
+}
+
+// Mode selects whether the deprecated names of the renamed metrics and attributes are reported
+type Mode string
+
+const (
+	// None reports only the current names. This is the default.
+	None = Mode("none")
+	// Both reports the metrics and attributes with both their current and deprecated names
+	Both = Mode("both")
+	// Only reports the renamed metrics and attributes with their deprecated names only
+	Only = Mode("only")
+)
+
+func (m Mode) Validate() error {
+	switch m {
+	case "", None, Both, Only:
+		return nil
+	}
+	return fmt.Errorf("unknown deprecated names mode %q, choices are [%s, %s, %s]", m, None, Both, Only)
+}
+
+func (m Mode) enabled() bool {
+	return m == Both || m == Only
+}
+
+// metricAlias is a metric that was renamed
+type metricAlias struct {
+	current    metric.Name
+	deprecated metric.Name
+}
+
+// table of the renamed metrics and attributes
+type table struct {
+	metrics []metricAlias
+	// key: current name. Value: deprecated name
+	attributes map[attr.Name]attr.Name
+}
+
+// builtin contains the Beyla-specific metrics and attributes that have been renamed, with the name
+// they had before. Any rename must add an entry here, or TestPublishedNames will fail.
+// An entry can be removed once its deprecated name is not supported anymore, at the same time
+// that it is removed from the testdata/published_names.txt file.
+var builtin = table{
+	metrics:    []metricAlias{},
+	attributes: map[attr.Name]attr.Name{},
+}
+
+// Aliaser reports the deprecated names of the renamed metrics and attributes, transforming the data at the
+// boundary of the exporters. A nil Aliaser leaves the data untouched, so it can be safely invoked when the
+// deprecated names are not reported.
+type Aliaser struct {
+	mode Mode
+	// key: current name. Value: deprecated name
+	promMetrics map[string]string
+	otelMetrics map[string]string
+	promAttrs   map[string]string
+	otelAttrs   map[string]string
+}
+
+// New returns an Aliaser for the builtin table of renamed metrics and attributes, or nil if the
+// deprecated names are not reported, either because they are disabled or because there aren't renamed names.
+func New(mode Mode) *Aliaser {
+	return newAliaser(mode, &builtin)
+}
+
+func newAliaser(mode Mode, t *table) *Aliaser {
+	if !mode.enabled() {
+		return nil
+	}
+	if len(t.metrics) == 0 && len(t.attributes) == 0 {
+		log().Info("there aren't deprecated metric or attribute names to report", "mode", mode)
+		return nil
+	}
+	a := &Aliaser{
+		mode:        mode,
+		promMetrics: map[string]string{},
+		otelMetrics: map[string]string{},
+		promAttrs:   map[string]string{},
+		otelAttrs:   map[string]string{},
+	}
+	var deprecatedMetrics, deprecatedAttrs []string
+	for _, m := range t.metrics {
+		a.promMetrics[m.current.Prom] = m.deprecated.Prom
+		a.otelMetrics[m.current.OTEL] = m.deprecated.OTEL
+		deprecatedMetrics = append(deprecatedMetrics,
+			m.deprecated.Prom+" (now "+m.current.Prom+")",
+			m.deprecated.OTEL+" (now "+m.current.OTEL+")")
+	}
+	for current, deprecated := range t.attributes {
+		a.promAttrs[current.Prom()] = deprecated.Prom()
+		a.otelAttrs[string(current.OTEL())] = string(deprecated.OTEL())
+		deprecatedAttrs = append(deprecatedAttrs, string(deprecated)+" (now "+string(current)+")")
+	}
+	sort.Strings(deprecatedAttrs)
+	log().Warn("reporting deprecated metric and attribute names. Please migrate your queries and dashboards"+
+		" to the current names, as the deprecated names will stop being reported in future versions",
+		"mode", mode, "metrics", deprecatedMetrics, "attributes", deprecatedAttrs)
+	return a
+}
+
+// reportCurrent returns true if the current names of the renamed metrics and attributes are reported
+func (a *Aliaser) reportCurrent() bool {
+	return a.mode == Both
+}
+
+// names returns the names that are reported for a given metric or attribute, according to the
+// passed map of deprecated names
+func (a *Aliaser) names(aliases map[string]string, name string) []string {
+	deprecated, ok := aliases[name]
+	if !ok {
+		return []string{name}
+	}
+	if a.reportCurrent() {
+		return []string{name, deprecated}
+	}
+	return []string{deprecated}
+}
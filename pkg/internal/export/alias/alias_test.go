@@ -0,0 +1,107 @@
+package alias
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/beyla/pkg/internal/export/metric"
+	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
+)
+
+const publishedNamesFile = "testdata/published_names.txt"
+
+// publishedMetrics are the metrics whose names are checked against the published names
+var publishedMetrics = []metric.Name{
+	metric.BeylaNetworkFlow,
+	metric.BeylaNetworkICMPRTT,
+	metric.BeylaNetworkFlowSize,
+	metric.BeylaNetworkFlowDuration,
+	metric.HTTPServerRequestSize,
+	metric.HTTPClientRequestSize,
+	metric.HTTPServerDuration,
+	metric.HTTPClientDuration,
+	metric.RPCServerDuration,
+	metric.RPCClientDuration,
+	metric.SQLClientDuration,
+}
+
+// currentNames returns the metric and attribute names that Beyla currently reports,
+// in the same format as the published names file
+func currentNames() map[string]struct{} {
+	names := map[string]struct{}{}
+	for _, m := range publishedMetrics {
+		names["metric "+m.Prom] = struct{}{}
+		names["metric "+m.OTEL] = struct{}{}
+	}
+	for name := range metric.AllAttributeNames() {
+		names["attribute "+string(name)] = struct{}{}
+	}
+	return names
+}
+
+func publishedNames(t *testing.T) map[string]struct{} {
+	file, err := os.Open(publishedNamesFile)
+	require.NoError(t, err)
+	defer file.Close()
+	names := map[string]struct{}{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			names[line] = struct{}{}
+		}
+	}
+	require.NoError(t, scanner.Err())
+	return names
+}
+
+// TestPublishedNames verifies that any metric or attribute that has been published by Beyla
+// is still reported, either with its current name or as a deprecated name of the builtin table.
+func TestPublishedNames(t *testing.T) {
+	published := publishedNames(t)
+	current := currentNames()
+	deprecated := map[string]struct{}{}
+	for _, m := range builtin.metrics {
+		deprecated["metric "+m.deprecated.Prom] = struct{}{}
+		deprecated["metric "+m.deprecated.OTEL] = struct{}{}
+		assert.Contains(t, current, "metric "+m.current.Prom, "the renamed metric must exist")
+		assert.Contains(t, current, "metric "+m.current.OTEL, "the renamed metric must exist")
+	}
+	for renamed, name := range builtin.attributes {
+		deprecated["attribute "+string(name)] = struct{}{}
+		assert.Contains(t, current, "attribute "+string(renamed), "the renamed attribute must exist")
+	}
+
+	for name := range published {
+		_, isCurrent := current[name]
+		_, isDeprecated := deprecated[name]
+		assert.Truef(t, isCurrent || isDeprecated,
+			"%q is not reported anymore. If it was renamed, add an entry to the builtin table in alias.go", name)
+	}
+	for name := range current {
+		assert.Containsf(t, published, name,
+			"%q is missing. If it is a new metric or attribute, add it to %s", name, publishedNamesFile)
+	}
+	for name := range deprecated {
+		assert.Containsf(t, published, name, "deprecated name %q was never published", name)
+	}
+}
+
+func TestMode_Validate(t *testing.T) {
+	for _, m := range []Mode{"", None, Both, Only} {
+		assert.NoError(t, m.Validate())
+	}
+	assert.Error(t, Mode("all").Validate())
+}
+
+func TestNew_Disabled(t *testing.T) {
+	renamed := &table{attributes: map[attr.Name]attr.Name{attr.HTTPRoute: "http.path"}}
+	assert.Nil(t, newAliaser("", renamed))
+	assert.Nil(t, newAliaser(None, renamed))
+	assert.Nil(t, newAliaser(Both, &table{}))
+	assert.NotNil(t, newAliaser(Only, renamed))
+}
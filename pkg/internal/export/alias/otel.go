@@ -0,0 +1,137 @@
+package alias
+
+import (
+	"context"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// aliasedMetricsExporter wraps an otel metrics exporter to report the deprecated names
+type aliasedMetricsExporter struct {
+	metric.Exporter
+	aliases *Aliaser
+}
+
+// MetricsExporter wraps an OTEL metrics exporter to report the deprecated names of the renamed metrics
+// and attributes
+func (a *Aliaser) MetricsExporter(in metric.Exporter) metric.Exporter {
+	if a == nil {
+		return in
+	}
+	return &aliasedMetricsExporter{Exporter: in, aliases: a}
+}
+
+func (ae *aliasedMetricsExporter) Export(ctx context.Context, md *metricdata.ResourceMetrics) error {
+	return ae.Exporter.Export(ctx, ae.aliases.resourceMetrics(md))
+}
+
+// resourceMetrics returns a copy of the provided metrics with the deprecated names. The slices of
+// metrics aren't modified in place because they are reused by the OTEL SDK between collections.
+func (a *Aliaser) resourceMetrics(md *metricdata.ResourceMetrics) *metricdata.ResourceMetrics {
+	reported := &metricdata.ResourceMetrics{
+		Resource:     md.Resource,
+		ScopeMetrics: make([]metricdata.ScopeMetrics, 0, len(md.ScopeMetrics)),
+	}
+	for _, scope := range md.ScopeMetrics {
+		metrics := make([]metricdata.Metrics, 0, len(scope.Metrics))
+		for _, m := range scope.Metrics {
+			a.renameDataPoints(m.Data)
+			for _, name := range a.names(a.otelMetrics, m.Name) {
+				m.Name = name
+				metrics = append(metrics, m)
+			}
+		}
+		reported.ScopeMetrics = append(reported.ScopeMetrics,
+			metricdata.ScopeMetrics{Scope: scope.Scope, Metrics: metrics})
+	}
+	return reported
+}
+
+// renameDataPoints replaces the attributes of the data points. They are replaced in place,
+// as the OTEL SDK overrides all the data points' attributes on each collection.
+func (a *Aliaser) renameDataPoints(data metricdata.Aggregation) {
+	switch d := data.(type) {
+	case metricdata.Sum[int64]:
+		renameDataPoints(a, d.DataPoints, func(dp *metricdata.DataPoint[int64]) *attribute.Set { return &dp.Attributes })
+	case metricdata.Sum[float64]:
+		renameDataPoints(a, d.DataPoints, func(dp *metricdata.DataPoint[float64]) *attribute.Set { return &dp.Attributes })
+	case metricdata.Gauge[int64]:
+		renameDataPoints(a, d.DataPoints, func(dp *metricdata.DataPoint[int64]) *attribute.Set { return &dp.Attributes })
+	case metricdata.Gauge[float64]:
+		renameDataPoints(a, d.DataPoints, func(dp *metricdata.DataPoint[float64]) *attribute.Set { return &dp.Attributes })
+	case metricdata.Histogram[int64]:
+		renameDataPoints(a, d.DataPoints, func(dp *metricdata.HistogramDataPoint[int64]) *attribute.Set { return &dp.Attributes })
+	case metricdata.Histogram[float64]:
+		renameDataPoints(a, d.DataPoints, func(dp *metricdata.HistogramDataPoint[float64]) *attribute.Set { return &dp.Attributes })
+	case metricdata.ExponentialHistogram[int64]:
+		renameDataPoints(a, d.DataPoints, func(dp *metricdata.ExponentialHistogramDataPoint[int64]) *attribute.Set { return &dp.Attributes })
+	case metricdata.ExponentialHistogram[float64]:
+		renameDataPoints(a, d.DataPoints, func(dp *metricdata.ExponentialHistogramDataPoint[float64]) *attribute.Set { return &dp.Attributes })
+	}
+}
+
+func renameDataPoints[DP any](a *Aliaser, dataPoints []DP, attributes func(*DP) *attribute.Set) {
+	for i := range dataPoints {
+		attrs := attributes(&dataPoints[i])
+		*attrs = a.attributeSet(attrs)
+	}
+}
+
+func (a *Aliaser) attributeSet(set *attribute.Set) attribute.Set {
+	renamed := false
+	for it := set.Iter(); it.Next(); {
+		if _, ok := a.otelAttrs[string(it.Attribute().Key)]; ok {
+			renamed = true
+			break
+		}
+	}
+	if !renamed {
+		return *set
+	}
+	kvs := make([]attribute.KeyValue, 0, set.Len()+1)
+	for it := set.Iter(); it.Next(); {
+		kv := it.Attribute()
+		for _, name := range a.names(a.otelAttrs, string(kv.Key)) {
+			kvs = append(kvs, attribute.KeyValue{Key: attribute.Key(name), Value: kv.Value})
+		}
+	}
+	return attribute.NewSet(kvs...)
+}
+
+// Traces replaces, in place, the attributes of the spans with their deprecated names
+func (a *Aliaser) Traces(traces ptrace.Traces) ptrace.Traces {
+	if a == nil {
+		return traces
+	}
+	rss := traces.ResourceSpans()
+	for i := 0; i < rss.Len(); i++ {
+		sss := rss.At(i).ScopeSpans()
+		for j := 0; j < sss.Len(); j++ {
+			spans := sss.At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				a.renameMap(spans.At(k).Attributes())
+			}
+		}
+	}
+	return traces
+}
+
+func (a *Aliaser) renameMap(attrs pcommon.Map) {
+	for current, deprecated := range a.otelAttrs {
+		if _, ok := attrs.Get(current); !ok {
+			continue
+		}
+		// the deprecated entry is added before getting the current value, as adding entries
+		// might reallocate the values of the map
+		dst := attrs.PutEmpty(deprecated)
+		value, _ := attrs.Get(current)
+		value.CopyTo(dst)
+		if !a.reportCurrent() {
+			attrs.Remove(current)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package alias
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// capturingExporter stores the last exported metrics
+type capturingExporter struct {
+	metric.Exporter
+	exported *metricdata.ResourceMetrics
+}
+
+func (ce *capturingExporter) Export(_ context.Context, md *metricdata.ResourceMetrics) error {
+	ce.exported = md
+	return nil
+}
+
+func testResourceMetrics() *metricdata.ResourceMetrics {
+	return &metricdata.ResourceMetrics{ScopeMetrics: []metricdata.ScopeMetrics{{
+		Metrics: []metricdata.Metrics{{
+			Name: "beyla.network.flow.bytes",
+			Data: metricdata.Sum[int64]{DataPoints: []metricdata.DataPoint[int64]{{
+				Attributes: attribute.NewSet(attribute.String("src.name", "foo"), attribute.String("dst.name", "bar")),
+				Value:      3,
+			}}},
+		}, {
+			Name: "other.metric",
+			Data: metricdata.Histogram[float64]{DataPoints: []metricdata.HistogramDataPoint[float64]{{
+				Attributes: attribute.NewSet(attribute.String("dst.name", "baz")),
+			}}},
+		}},
+	}}}
+}
+
+func exportedAttributes(md *metricdata.ResourceMetrics) map[string][]attribute.KeyValue {
+	attrs := map[string][]attribute.KeyValue{}
+	for _, m := range md.ScopeMetrics[0].Metrics {
+		switch d := m.Data.(type) {
+		case metricdata.Sum[int64]:
+			attrs[m.Name] = d.DataPoints[0].Attributes.ToSlice()
+		case metricdata.Histogram[float64]:
+			attrs[m.Name] = d.DataPoints[0].Attributes.ToSlice()
+		}
+	}
+	return attrs
+}
+
+func TestMetricsExporter_Both(t *testing.T) {
+	exporter := &capturingExporter{}
+	aliased := newAliaser(Both, &testTable).MetricsExporter(exporter)
+	original := testResourceMetrics()
+
+	require.NoError(t, aliased.Export(context.Background(), original))
+
+	flowAttrs := []attribute.KeyValue{
+		attribute.String("dst.name", "bar"), attribute.String("source.name", "foo"), attribute.String("src.name", "foo"),
+	}
+	assert.Equal(t, map[string][]attribute.KeyValue{
+		"beyla.network.flow.bytes": flowAttrs,
+		"beyla.network.bytes":      flowAttrs,
+		"other.metric":             {attribute.String("dst.name", "baz")},
+	}, exportedAttributes(exporter.exported))
+	// the metrics slices of the SDK are not modified
+	assert.Len(t, original.ScopeMetrics[0].Metrics, 2)
+}
+
+func TestMetricsExporter_Only(t *testing.T) {
+	exporter := &capturingExporter{}
+	aliased := newAliaser(Only, &testTable).MetricsExporter(exporter)
+
+	require.NoError(t, aliased.Export(context.Background(), testResourceMetrics()))
+
+	assert.Equal(t, map[string][]attribute.KeyValue{
+		"beyla.network.bytes": {attribute.String("dst.name", "bar"), attribute.String("source.name", "foo")},
+		"other.metric":        {attribute.String("dst.name", "baz")},
+	}, exportedAttributes(exporter.exported))
+}
+
+func testTraces() ptrace.Traces {
+	traces := ptrace.NewTraces()
+	span := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.Attributes().PutStr("src.name", "foo")
+	span.Attributes().PutStr("dst.name", "bar")
+	return traces
+}
+
+func spanAttributes(traces ptrace.Traces) map[string]any {
+	return traces.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0).Attributes().AsRaw()
+}
+
+func TestTraces(t *testing.T) {
+	assert.Equal(t,
+		map[string]any{"src.name": "foo", "source.name": "foo", "dst.name": "bar"},
+		spanAttributes(newAliaser(Both, &testTable).Traces(testTraces())))
+	assert.Equal(t,
+		map[string]any{"source.name": "foo", "dst.name": "bar"},
+		spanAttributes(newAliaser(Only, &testTable).Traces(testTraces())))
+	var disabled *Aliaser
+	assert.Equal(t,
+		map[string]any{"src.name": "foo", "dst.name": "bar"},
+		spanAttributes(disabled.Traces(testTraces())))
+}
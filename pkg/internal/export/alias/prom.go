@@ -0,0 +1,68 @@
+package alias
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// Gatherer wraps a Prometheus gatherer to report the deprecated names of the renamed metrics and labels
+func (a *Aliaser) Gatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	if a == nil {
+		return g
+	}
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+		return a.families(families), err
+	})
+}
+
+func (a *Aliaser) families(families []*dto.MetricFamily) []*dto.MetricFamily {
+	reported := make([]*dto.MetricFamily, 0, len(families))
+	for _, family := range families {
+		for _, m := range family.Metric {
+			m.Label = a.labels(m.Label)
+		}
+		deprecated, ok := a.promMetrics[family.GetName()]
+		if !ok {
+			reported = append(reported, family)
+			continue
+		}
+		if a.reportCurrent() {
+			reported = append(reported, family)
+			family = proto.Clone(family).(*dto.MetricFamily)
+		}
+		family.Name = proto.String(deprecated)
+		reported = append(reported, family)
+	}
+	// the gathered families must be sorted by name
+	sort.Slice(reported, func(i, j int) bool {
+		return reported[i].GetName() < reported[j].GetName()
+	})
+	return reported
+}
+
+func (a *Aliaser) labels(labels []*dto.LabelPair) []*dto.LabelPair {
+	renamed := false
+	for _, label := range labels {
+		if _, ok := a.promAttrs[label.GetName()]; ok {
+			renamed = true
+			break
+		}
+	}
+	if !renamed {
+		return labels
+	}
+	reported := make([]*dto.LabelPair, 0, len(labels)+1)
+	for _, label := range labels {
+		for _, name := range a.names(a.promAttrs, label.GetName()) {
+			reported = append(reported, &dto.LabelPair{Name: proto.String(name), Value: label.Value})
+		}
+	}
+	sort.Slice(reported, func(i, j int) bool {
+		return reported[i].GetName() < reported[j].GetName()
+	})
+	return reported
+}
@@ -0,0 +1,77 @@
+package alias
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/beyla/pkg/internal/export/metric"
+	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
+)
+
+var testTable = table{
+	metrics: []metricAlias{{
+		current:    metric.BeylaNetworkFlow,
+		deprecated: metric.Name{Prom: "beyla_network_bytes_total", OTEL: "beyla.network.bytes"},
+	}},
+	attributes: map[attr.Name]attr.Name{"src.name": "source.name"},
+}
+
+func gatheredLabels(t *testing.T, families []*dto.MetricFamily) map[string]map[string]string {
+	t.Helper()
+	labels := map[string]map[string]string{}
+	for _, family := range families {
+		require.Len(t, family.Metric, 1)
+		lbls := map[string]string{}
+		for _, l := range family.Metric[0].Label {
+			lbls[l.GetName()] = l.GetValue()
+		}
+		labels[family.GetName()] = lbls
+	}
+	return labels
+}
+
+func testRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	flows := prometheus.NewCounterVec(prometheus.CounterOpts{Name: metric.BeylaNetworkFlow.Prom}, []string{"src_name", "dst_name"})
+	flows.WithLabelValues("foo", "bar").Add(3)
+	other := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "other_metric"}, []string{"src_name"})
+	other.WithLabelValues("baz").Set(1)
+	reg.MustRegister(flows, other)
+	return reg
+}
+
+func TestGatherer_Both(t *testing.T) {
+	aliases := newAliaser(Both, &testTable)
+	families, err := aliases.Gatherer(testRegistry()).Gather()
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]map[string]string{
+		"beyla_network_bytes_total":      {"src_name": "foo", "source_name": "foo", "dst_name": "bar"},
+		"beyla_network_flow_bytes_total": {"src_name": "foo", "source_name": "foo", "dst_name": "bar"},
+		"other_metric":                   {"src_name": "baz", "source_name": "baz"},
+	}, gatheredLabels(t, families))
+	// families are sorted by name
+	assert.Equal(t, "beyla_network_bytes_total", families[0].GetName())
+	assert.Equal(t, 3.0, families[1].Metric[0].GetCounter().GetValue())
+}
+
+func TestGatherer_Only(t *testing.T) {
+	aliases := newAliaser(Only, &testTable)
+	families, err := aliases.Gatherer(testRegistry()).Gather()
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]map[string]string{
+		"beyla_network_bytes_total": {"source_name": "foo", "dst_name": "bar"},
+		"other_metric":              {"source_name": "baz"},
+	}, gatheredLabels(t, families))
+}
+
+func TestGatherer_Nil(t *testing.T) {
+	reg := testRegistry()
+	var aliases *Aliaser
+	assert.Same(t, reg, aliases.Gatherer(reg))
+}
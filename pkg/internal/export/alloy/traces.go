@@ -8,17 +8,21 @@ import (
 
 	"github.com/grafana/beyla/pkg/beyla"
 	"github.com/grafana/beyla/pkg/internal/export/otel"
+	"github.com/grafana/beyla/pkg/internal/pipe/global"
 	"github.com/grafana/beyla/pkg/internal/request"
 )
 
 // TracesReceiver creates a terminal node that consumes request.Spans and sends OpenTelemetry traces to the configured consumers.
-func TracesReceiver(ctx context.Context, cfg *beyla.TracesReceiverConfig) pipe.FinalProvider[[]request.Span] {
-	return (&tracesReceiver{ctx: ctx, cfg: cfg}).provideLoop
+func TracesReceiver(
+	ctx context.Context, cfg *beyla.TracesReceiverConfig, ctxInfo *global.ContextInfo,
+) pipe.FinalProvider[[]request.Span] {
+	return (&tracesReceiver{ctx: ctx, cfg: cfg, ctxInfo: ctxInfo}).provideLoop
 }
 
 type tracesReceiver struct {
-	ctx context.Context
-	cfg *beyla.TracesReceiverConfig
+	ctx     context.Context
+	cfg     *beyla.TracesReceiverConfig
+	ctxInfo *global.ContextInfo
 }
 
 func (tr *tracesReceiver) provideLoop() (pipe.FinalFunc[[]request.Span], error) {
@@ -34,8 +38,8 @@ func (tr *tracesReceiver) provideLoop() (pipe.FinalFunc[[]request.Span], error)
 				}
 
 				for _, tc := range tr.cfg.Traces {
-					traces := otel.GenerateTraces(span)
-					err := tc.ConsumeTraces(tr.ctx, traces)
+					traces := otel.GenerateTraces(span, &tr.ctxInfo.Build, tr.ctxInfo.SemConv)
+					err := tc.ConsumeTraces(tr.ctx, tr.ctxInfo.Aliases.Traces(traces))
 					if err != nil {
 						slog.Error("error sending trace to consumer", "error", err)
 					}
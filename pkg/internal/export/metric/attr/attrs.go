@@ -18,7 +18,14 @@ func (an Name) OTEL() attribute.Key {
 }
 
 func (an Name) Prom() string {
-	return strings.ReplaceAll(string(an), ".", "_")
+	// besides the dots, the names that embed user-provided keys (e.g. namespace labels) might
+	// contain other characters that are not allowed in the Prometheus label names
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == ':' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, string(an))
 }
 
 // OpenTelemetry 1.23 semantic convention
@@ -53,11 +60,46 @@ const (
 	K8sReplicaSetName  = Name("k8s.replicaset.name")
 	K8sDaemonSetName   = Name("k8s.daemonset.name")
 	K8sStatefulSetName = Name("k8s.statefulset.name")
+	K8sJobName         = Name("k8s.job.name")
+	K8sCronJobName     = Name("k8s.cronjob.name")
 	K8sNodeName        = Name("k8s.node.name")
 	K8sPodUID          = Name("k8s.pod.uid")
 	K8sPodStartTime    = Name("k8s.pod.start_time")
+
+	K8sPodServiceAccount = Name("k8s.pod.service_account")
+	// K8sPeerServiceAccount is the service account of the pod at the other side of the request
+	K8sPeerServiceAccount = Name("k8s.peer.service_account")
+
+	CloudAvailabilityZone = Name(semconv.CloudAvailabilityZoneKey)
+	CloudRegion           = Name(semconv.CloudRegionKey)
+
+	K8sContainerName         = Name("k8s.container.name")
+	K8sContainerRestartCount = Name("k8s.container.restart_count")
+
+	ContainerID        = Name(semconv.ContainerIDKey)
+	ContainerImageName = Name(semconv.ContainerImageNameKey)
+	ContainerImageTag  = Name(semconv.ContainerImageTagKey)
 )
 
+// K8sNamespaceLabel returns the name of the attribute that reports the value of the namespace label
+// with the provided key
+func K8sNamespaceLabel(key string) Name {
+	return Name("k8s.namespace.label." + key)
+}
+
+const k8sPeerNamespaceLabelPrefix = "k8s.peer.namespace.label."
+
+// K8sPeerNamespaceLabel returns the name of the attribute that reports the value of the label with
+// the provided key, for the namespace of the pod at the other side of the request
+func K8sPeerNamespaceLabel(key string) Name {
+	return Name(k8sPeerNamespaceLabelPrefix + key)
+}
+
+// IsK8sPeerNamespaceLabel returns whether the attribute reports a label of the peer namespace
+func IsK8sPeerNamespaceLabel(name Name) bool {
+	return strings.HasPrefix(string(name), k8sPeerNamespaceLabelPrefix)
+}
+
 // Beyla-specific network attributes
 var (
 	BeylaIP    = Name("beyla.ip")
@@ -72,7 +114,14 @@ var (
 	Iface      = Name("iface")
 	SrcCIDR    = Name("src.cidr")
 	DstCIDR    = Name("dst.cidr")
+	ICMPType   = Name("icmp.type")
+	ICMPCode   = Name("icmp.code")
 
+	SrcProcessName = Name("src.process.name")
+	DstProcessName = Name("dst.process.name")
+
+	K8sSrcZone      = Name("k8s.src.zone")
+	K8sDstZone      = Name("k8s.dst.zone")
 	K8sSrcOwnerName = Name("k8s.src.owner.name")
 	K8sSrcNamespace = Name("k8s.src.namespace")
 	K8sDstOwnerName = Name("k8s.dst.owner.name")
@@ -88,6 +137,14 @@ var (
 	K8sDstOwnerType = Name("k8s.dst.owner.type")
 	K8sDstNodeIP    = Name("k8s.dst.node.ip")
 	K8sDstNodeName  = Name("k8s.dst.node.name")
+
+	// SrcScope and DstScope tell whether the endpoints of a flow are a pod, service or node of the
+	// cluster, or are external to it
+	SrcScope = Name("src.scope")
+	DstScope = Name("dst.scope")
+
+	// K8sCrossZone tells whether the source and destination of a flow are in different topology zones
+	K8sCrossZone = Name("k8s.cross_zone")
 )
 
 // other beyla-specific attributes
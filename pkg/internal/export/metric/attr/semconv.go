@@ -0,0 +1,141 @@
+package attr
+
+import (
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// SemConvStability selects the version of the HTTP and RPC semantic conventions of the reported
+// attributes, similarly to the OTEL_SEMCONV_STABILITY_OPT_IN standard environment variable.
+type SemConvStability string
+
+const (
+	// SemConvStable reports the attributes from the stable HTTP semantic conventions (1.23 and later)
+	SemConvStable = SemConvStability("stable")
+	// SemConvOld reports the attributes from the experimental HTTP semantic conventions (1.20 and earlier)
+	SemConvOld = SemConvStability("old")
+	// SemConvBoth reports the attributes from both the stable and the old semantic conventions,
+	// to help migrating the queries and dashboards from the old to the stable conventions.
+	SemConvBoth = SemConvStability("both")
+)
+
+// Attribute names from the HTTP semantic conventions 1.20 and earlier
+const (
+	OldHTTPMethod               = Name("http.method")
+	OldHTTPStatusCode           = Name("http.status_code")
+	OldHTTPTarget               = Name("http.target")
+	OldHTTPURL                  = Name("http.url")
+	OldHTTPRequestContentLength = Name("http.request_content_length")
+	OldNetSockPeerAddr          = Name("net.sock.peer.addr")
+	OldNetHostName              = Name("net.host.name")
+	OldNetHostPort              = Name("net.host.port")
+	OldNetPeerName              = Name("net.peer.name")
+	OldNetPeerPort              = Name("net.peer.port")
+)
+
+// oldServerNames and oldClientNames map the stable attributes to their old name, for the telemetry
+// reported from the server and the client side, respectively. The attributes that didn't change between
+// both conventions (e.g. http.route or rpc.method) aren't here, so they are never duplicated.
+var (
+	oldServerNames = map[Name]Name{
+		HTTPRequestMethod:      OldHTTPMethod,
+		HTTPResponseStatusCode: OldHTTPStatusCode,
+		HTTPUrlPath:            OldHTTPTarget,
+		HTTPRequestBodySize:    OldHTTPRequestContentLength,
+		ClientAddr:             OldNetSockPeerAddr,
+		ServerAddr:             OldNetHostName,
+		ServerPort:             OldNetHostPort,
+	}
+	oldClientNames = map[Name]Name{
+		HTTPRequestMethod:      OldHTTPMethod,
+		HTTPResponseStatusCode: OldHTTPStatusCode,
+		HTTPUrlFull:            OldHTTPURL,
+		HTTPRequestBodySize:    OldHTTPRequestContentLength,
+		ServerAddr:             OldNetPeerName,
+		ServerPort:             OldNetPeerPort,
+	}
+	stableNames = map[Name]Name{}
+)
+
+func init() {
+	for _, names := range []map[Name]Name{oldServerNames, oldClientNames} {
+		for stable, old := range names {
+			stableNames[old] = stable
+		}
+	}
+}
+
+func (s SemConvStability) Validate() error {
+	switch s {
+	case "", SemConvStable, SemConvOld, SemConvBoth:
+		return nil
+	}
+	return fmt.Errorf("unknown semantic conventions %q, choices are [%s, %s, %s]",
+		s, SemConvStable, SemConvOld, SemConvBoth)
+}
+
+// Stable returns true if the stable attributes have to be reported. This is the default.
+func (s SemConvStability) Stable() bool {
+	return s != SemConvOld
+}
+
+// Old returns true if the old attributes have to be reported
+func (s SemConvStability) Old() bool {
+	return s == SemConvOld || s == SemConvBoth
+}
+
+// StableName returns the stable name of an attribute from the old semantic conventions,
+// and false if the provided name is not an old attribute.
+func StableName(old Name) (Name, bool) {
+	stable, ok := stableNames[old]
+	return stable, ok
+}
+
+func oldNames(client bool) map[Name]Name {
+	if client {
+		return oldClientNames
+	}
+	return oldServerNames
+}
+
+// Names returns the names of the passed stable attributes, as they must be reported according to
+// the semantic conventions. The client argument specifies whether the attributes are reported from
+// the client side, as some attribute names differ between the client and the server side.
+func (s SemConvStability) Names(names []Name, client bool) []Name {
+	if !s.Old() {
+		return names
+	}
+	old := oldNames(client)
+	reported := make([]Name, 0, len(names))
+	for _, name := range names {
+		oldName, renamed := old[name]
+		if !renamed || s.Stable() {
+			reported = append(reported, name)
+		}
+		if renamed {
+			reported = append(reported, oldName)
+		}
+	}
+	return reported
+}
+
+// KeyValues converts the passed stable attributes, as they must be reported according to the semantic
+// conventions. The client argument has the same meaning as in the Names method.
+func (s SemConvStability) KeyValues(kvs []attribute.KeyValue, client bool) []attribute.KeyValue {
+	if !s.Old() {
+		return kvs
+	}
+	old := oldNames(client)
+	reported := make([]attribute.KeyValue, 0, len(kvs))
+	for _, kv := range kvs {
+		oldName, renamed := old[Name(kv.Key)]
+		if !renamed || s.Stable() {
+			reported = append(reported, kv)
+		}
+		if renamed {
+			reported = append(reported, attribute.KeyValue{Key: oldName.OTEL(), Value: kv.Value})
+		}
+	}
+	return reported
+}
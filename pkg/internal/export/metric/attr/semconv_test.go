@@ -0,0 +1,49 @@
+package attr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSemConvStability_Names(t *testing.T) {
+	names := []Name{HTTPRequestMethod, HTTPRoute, ServerAddr, ServerPort, ClientAddr}
+
+	assert.Equal(t, names, SemConvStability("").Names(names, false))
+	assert.Equal(t, names, SemConvStable.Names(names, true))
+
+	// unchanged attributes, as http.route, are never duplicated
+	assert.Equal(t,
+		[]Name{OldHTTPMethod, HTTPRoute, OldNetHostName, OldNetHostPort, OldNetSockPeerAddr},
+		SemConvOld.Names(names, false))
+	assert.Equal(t,
+		[]Name{OldHTTPMethod, HTTPRoute, OldNetPeerName, OldNetPeerPort, ClientAddr},
+		SemConvOld.Names(names, true))
+	assert.Equal(t,
+		[]Name{HTTPRequestMethod, OldHTTPMethod, HTTPRoute, ServerAddr, OldNetHostName,
+			ServerPort, OldNetHostPort, ClientAddr, OldNetSockPeerAddr},
+		SemConvBoth.Names(names, false))
+}
+
+func TestStableName(t *testing.T) {
+	for old, stable := range map[Name]Name{
+		OldHTTPMethod:  HTTPRequestMethod,
+		OldHTTPTarget:  HTTPUrlPath,
+		OldNetHostName: ServerAddr,
+		OldNetPeerName: ServerAddr,
+		OldNetPeerPort: ServerPort,
+	} {
+		name, ok := StableName(old)
+		assert.True(t, ok, old)
+		assert.Equal(t, stable, name)
+	}
+	_, ok := StableName(HTTPRequestMethod)
+	assert.False(t, ok)
+}
+
+func TestSemConvStability_Validate(t *testing.T) {
+	for _, s := range []SemConvStability{"", SemConvStable, SemConvOld, SemConvBoth} {
+		assert.NoError(t, s.Validate())
+	}
+	assert.Error(t, SemConvStability("http/dup").Validate())
+}
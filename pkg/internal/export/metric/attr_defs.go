@@ -17,6 +17,7 @@ const (
 	GroupHTTPRoutes
 	GroupNetIfaceDirection
 	GroupNetCIDR
+	GroupNetProcess
 	GroupPeerInfo // TODO Beyla 2.0: remove when we remove ReportPeerInfo configuration option
 	GroupTarget   // TODO Beyla 2.0: remove when we remove ReportTarget configuration option
 )
@@ -30,13 +31,15 @@ func (e *AttrGroups) Add(groups AttrGroups) {
 }
 
 // Any new metric and attribute must be added here to be matched from the user-provided wildcard
-// selectors of the attributes.select section
-func getDefinitions(groups AttrGroups) map[Section]AttrReportGroup {
+// selectors of the attributes.select section. The namespace labels are the attributes that report
+// the labels of the Kubernetes namespaces, whose names depend on the user configuration.
+func getDefinitions(groups AttrGroups, namespaceLabels ...attr.Name) map[Section]AttrReportGroup {
 	kubeEnabled := groups.Has(GroupKubernetes)
 	promEnabled := groups.Has(GroupPrometheus)
 	ifaceDirEnabled := groups.Has(GroupNetIfaceDirection)
 	peerInfoEnabled := groups.Has(GroupPeerInfo)
 	cidrEnabled := groups.Has(GroupNetCIDR)
+	netProcessEnabled := groups.Has(GroupNetProcess)
 
 	// attributes to be reported exclusively for prometheus exporters
 	var prometheusAttributes = AttrReportGroup{
@@ -68,6 +71,11 @@ func getDefinitions(groups AttrGroups) map[Section]AttrReportGroup {
 			attr.K8sDstOwnerType: false,
 			attr.K8sDstNodeIP:    false,
 			attr.K8sDstNodeName:  false,
+			attr.K8sSrcZone:      true,
+			attr.K8sDstZone:      true,
+			attr.SrcScope:        false,
+			attr.DstScope:        false,
+			attr.K8sCrossZone:    false,
 		},
 	}
 
@@ -81,6 +89,16 @@ func getDefinitions(groups AttrGroups) map[Section]AttrReportGroup {
 		},
 	}
 
+	// network process attributes are only enabled if the process
+	// attribution of the flows is enabled
+	var networkProcess = AttrReportGroup{
+		Disabled: !netProcessEnabled,
+		Attributes: map[attr.Name]Default{
+			attr.SrcProcessName: true,
+			attr.DstProcessName: true,
+		},
+	}
+
 	// attributes to be reported exclusively for application metrics when
 	// kubernetes metadata is enabled
 	var appKubeAttributes = AttrReportGroup{
@@ -92,11 +110,31 @@ func getDefinitions(groups AttrGroups) map[Section]AttrReportGroup {
 			attr.K8sReplicaSetName:  true,
 			attr.K8sDaemonSetName:   true,
 			attr.K8sStatefulSetName: true,
+			attr.K8sJobName:         true,
+			attr.K8sCronJobName:     true,
 			attr.K8sNodeName:        true,
-			attr.K8sPodUID:          true,
 			attr.K8sPodStartTime:    true,
+			attr.K8sClusterName:     true,
+			// the topology is only reported if the node topology is enabled in the Kubernetes decorator
+			attr.CloudAvailabilityZone: true,
+			attr.CloudRegion:           true,
+			// the pod UID changes each time a pod is recreated, so it is disabled by default
+			// in the metrics to avoid increasing their cardinality. It is always reported in the traces.
+			attr.K8sPodUID:        false,
+			attr.K8sContainerName: true,
+			// the service accounts are only relevant for the users that audit the workload identities
+			attr.K8sPodServiceAccount:  false,
+			attr.K8sPeerServiceAccount: false,
+			// the container ID changes each time a container is restarted
+			attr.ContainerID:        false,
+			attr.ContainerImageName: false,
+			attr.ContainerImageTag:  false,
 		},
 	}
+	for _, label := range namespaceLabels {
+		// like their service accounts, the labels of the namespaces of the peers are disabled by default
+		appKubeAttributes.Attributes[label] = Default(!attr.IsK8sPeerNamespaceLabel(label))
+	}
 
 	var httpRoutes = AttrReportGroup{
 		Disabled: !groups.Has(GroupHTTPRoutes),
@@ -141,22 +179,29 @@ func getDefinitions(groups AttrGroups) map[Section]AttrReportGroup {
 		},
 	}
 
-	return map[Section]AttrReportGroup{
-		BeylaNetworkFlow.Section: {
-			SubGroups: []*AttrReportGroup{&networkCIDR, &networkKubeAttributes},
-			Attributes: map[attr.Name]Default{
-				attr.BeylaIP:    false,
-				attr.Transport:  false,
-				attr.SrcAddress: false,
-				attr.DstAddres:  false,
-				attr.SrcPort:    false,
-				attr.DstPort:    false,
-				attr.SrcName:    false,
-				attr.DstName:    false,
-				attr.Direction:  Default(ifaceDirEnabled),
-				attr.Iface:      Default(ifaceDirEnabled),
-			},
+	var networkAttributes = AttrReportGroup{
+		SubGroups: []*AttrReportGroup{&networkCIDR, &networkKubeAttributes, &networkProcess},
+		Attributes: map[attr.Name]Default{
+			attr.BeylaIP:    false,
+			attr.Transport:  false,
+			attr.SrcAddress: false,
+			attr.DstAddres:  false,
+			attr.SrcPort:    false,
+			attr.DstPort:    false,
+			attr.SrcName:    false,
+			attr.DstName:    false,
+			attr.Direction:  Default(ifaceDirEnabled),
+			attr.Iface:      Default(ifaceDirEnabled),
+			attr.ICMPType:   false,
+			attr.ICMPCode:   false,
 		},
+	}
+
+	return map[Section]AttrReportGroup{
+		BeylaNetworkFlow.Section:         networkAttributes,
+		BeylaNetworkICMPRTT.Section:      networkAttributes,
+		BeylaNetworkFlowSize.Section:     networkAttributes,
+		BeylaNetworkFlowDuration.Section: networkAttributes,
 		HTTPServerDuration.Section: {
 			SubGroups: []*AttrReportGroup{&prometheusAttributes, &appKubeAttributes, &httpCommon, &serverInfo},
 		},
@@ -1,11 +1,13 @@
 package metric
 
 import (
+	"fmt"
 	"maps"
 	"path"
 	"strings"
 
 	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
+	"github.com/grafana/beyla/pkg/internal/helpers"
 )
 
 // Selection specifies which attributes are allowed for each metric.
@@ -56,7 +58,6 @@ func (i *InclusionLists) excludes(name attr.Name) bool {
 // - Remove unit suffixes such as .seconds or .bytes
 // Only normalize the metric names, as the attribute names are already normalized in the
 // PrometheusGetters and OpenTelemetryGetters function
-// TODO: validate too
 func (incl Selection) Normalize() {
 	if incl == nil {
 		return
@@ -69,3 +70,43 @@ func (incl Selection) Normalize() {
 	maps.DeleteFunc(incl, func(_ Section, _ InclusionLists) bool { return true })
 	maps.Copy(incl, normalized)
 }
+
+// Validate returns the problems of the user-provided selection: unknown metrics, and inclusion
+// or exclusion patterns that are malformed or do not match any attribute of their metric.
+// The namespace labels are the attributes that are reported for the configured namespace labels.
+func (incl Selection) Validate(namespaceLabels ...attr.Name) []error {
+	definitions := getDefinitions(-1, namespaceLabels...)
+	var problems []error
+	for _, metricName := range helpers.SortedKeys(incl) {
+		definition, ok := definitions[normalizeMetric(metricName)]
+		if !ok {
+			problems = append(problems, fmt.Errorf("unknown metric %q", metricName))
+			continue
+		}
+		attrs := definition.All()
+		lists := incl[metricName]
+		for _, list := range []struct {
+			name     string
+			patterns []string
+		}{{name: "include", patterns: lists.Include}, {name: "exclude", patterns: lists.Exclude}} {
+			for _, pattern := range list.patterns {
+				if err := validatePattern(pattern, attrs); err != nil {
+					problems = append(problems, fmt.Errorf("%s.%s: %w", metricName, list.name, err))
+				}
+			}
+		}
+	}
+	return problems
+}
+
+func validatePattern(pattern string, attrs map[attr.Name]struct{}) error {
+	if _, err := path.Match(asProm(pattern), ""); err != nil {
+		return fmt.Errorf("malformed attribute pattern %q: %w", pattern, err)
+	}
+	for name := range attrs {
+		if ok, _ := path.Match(asProm(pattern), name.Prom()); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("attribute pattern %q does not match any attribute of the metric", pattern)
+}
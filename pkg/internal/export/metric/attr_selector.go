@@ -33,13 +33,14 @@ type AttrSelector struct {
 }
 
 // NewAttrSelector returns an AttrSelector instance based on the user-provided attributes Selection
-// and the auto-detected attribute AttrGroups
-func NewAttrSelector(groups AttrGroups, selectorCfg Selection) (*AttrSelector, error) {
+// and the auto-detected attribute AttrGroups. The namespace labels are added to the Kubernetes
+// attributes of the application metrics.
+func NewAttrSelector(groups AttrGroups, selectorCfg Selection, namespaceLabels ...attr.Name) (*AttrSelector, error) {
 	selectorCfg.Normalize()
 	// TODO: validate
 	return &AttrSelector{
 		selector:   selectorCfg,
-		definition: getDefinitions(groups),
+		definition: getDefinitions(groups, namespaceLabels...),
 	}, nil
 }
 
@@ -33,13 +33,17 @@ func TestFor(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, []attr.Name{
 		"beyla.ip",
+		"k8s.cross_zone",
 		"k8s.dst.namespace",
 		"k8s.dst.node.ip",
+		"k8s.dst.zone",
 		"k8s.src.namespace",
 		"k8s.src.node.ip",
+		"k8s.src.zone",
 		"src.address",
 		"src.name",
 		"src.port",
+		"src.scope",
 	}, p.For(BeylaNetworkFlow))
 }
 
@@ -73,7 +77,92 @@ func TestDefault(t *testing.T) {
 		"k8s.cluster.name",
 		"k8s.dst.namespace",
 		"k8s.dst.owner.name",
+		"k8s.dst.zone",
 		"k8s.src.namespace",
 		"k8s.src.owner.name",
+		"k8s.src.zone",
 	}, p.For(BeylaNetworkFlow))
 }
+
+func TestSelection_Validate(t *testing.T) {
+	assert.Empty(t, Selection{
+		"beyla_network_flow_bytes_total": InclusionLists{
+			Include: []string{"beyla_ip", "src.*", "k8s.*"},
+			Exclude: []string{"k8s_*_name"},
+		},
+		"http.server.request.duration": InclusionLists{Include: []string{"url.path"}},
+	}.Validate())
+
+	problems := Selection{
+		"beyla_network_flow_bytes_total": InclusionLists{
+			Include: []string{"beyla_ip", "src.addr", "k8s.[*"},
+			Exclude: []string{"foo.*"},
+		},
+		"http.server.duration.total": InclusionLists{Include: []string{"*"}},
+	}.Validate()
+	require.Len(t, problems, 4)
+	assert.Contains(t, problems[0].Error(), `beyla_network_flow_bytes_total.include: attribute pattern "src.addr" does not match`)
+	assert.Contains(t, problems[1].Error(), `beyla_network_flow_bytes_total.include: malformed attribute pattern "k8s.[*"`)
+	assert.Contains(t, problems[2].Error(), `beyla_network_flow_bytes_total.exclude: attribute pattern "foo.*" does not match`)
+	assert.Contains(t, problems[3].Error(), `unknown metric "http.server.duration.total"`)
+}
+
+func TestDefault_PodUID(t *testing.T) {
+	// the pod UID and the container ID are not reported by default in the application metrics
+	p, err := NewAttrSelector(GroupKubernetes, nil)
+	require.NoError(t, err)
+	assert.Contains(t, p.For(HTTPServerDuration), attr.K8sPodName)
+	assert.NotContains(t, p.For(HTTPServerDuration), attr.K8sPodUID)
+	assert.NotContains(t, p.For(HTTPServerDuration), attr.ContainerID)
+	assert.NotContains(t, p.For(HTTPServerDuration), attr.K8sPodServiceAccount)
+	assert.NotContains(t, p.For(HTTPClientDuration), attr.K8sPeerServiceAccount)
+
+	// unless it is explicitly selected
+	p, err = NewAttrSelector(GroupKubernetes, Selection{
+		"http_server_request_duration_seconds": InclusionLists{Include: []string{"*"}},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, p.For(HTTPServerDuration), attr.K8sPodUID)
+	assert.Contains(t, p.For(HTTPServerDuration), attr.ContainerID)
+	assert.Contains(t, p.For(HTTPServerDuration), attr.K8sPodServiceAccount)
+	assert.Contains(t, p.For(HTTPServerDuration), attr.K8sPeerServiceAccount)
+}
+
+func TestDefault_NamespaceLabels(t *testing.T) {
+	// the configured namespace labels are reported by default in the application metrics
+	team := attr.K8sNamespaceLabel("team")
+	partOf := attr.K8sNamespaceLabel("app.kubernetes.io/part-of")
+	p, err := NewAttrSelector(GroupKubernetes, nil, team, partOf)
+	require.NoError(t, err)
+	assert.Contains(t, p.For(HTTPServerDuration), team)
+	assert.Contains(t, p.For(HTTPServerDuration), partOf)
+	assert.NotContains(t, p.For(BeylaNetworkFlow), team)
+	assert.Equal(t, "k8s_namespace_label_app_kubernetes_io_part_of", partOf.Prom())
+
+	// while the labels of the namespaces of the peers must be explicitly selected
+	peerTeam := attr.K8sPeerNamespaceLabel("team")
+	p, err = NewAttrSelector(GroupKubernetes, nil, team, peerTeam)
+	require.NoError(t, err)
+	assert.Contains(t, p.For(HTTPServerDuration), team)
+	assert.NotContains(t, p.For(HTTPServerDuration), peerTeam)
+	p, err = NewAttrSelector(GroupKubernetes, Selection{
+		"http_server_request_duration_seconds": InclusionLists{Include: []string{"k8s.peer.namespace.label.*"}},
+	}, team, peerTeam)
+	require.NoError(t, err)
+	assert.Equal(t, []attr.Name{peerTeam}, p.For(HTTPServerDuration))
+
+	// but not if Kubernetes is disabled
+	p, err = NewAttrSelector(0, nil, team)
+	require.NoError(t, err)
+	assert.NotContains(t, p.For(HTTPServerDuration), team)
+
+	// and they can be selected as any other attribute
+	selection := Selection{
+		"http_server_request_duration_seconds": InclusionLists{Include: []string{"k8s.namespace.label.*"}},
+	}
+	assert.Empty(t, selection.Validate(team, partOf))
+	assert.Len(t, selection.Validate(), 1)
+	p, err = NewAttrSelector(GroupKubernetes, selection, team, partOf)
+	require.NoError(t, err)
+	assert.Equal(t, []attr.Name{partOf, team}, p.For(HTTPServerDuration))
+}
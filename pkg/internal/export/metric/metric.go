@@ -1,6 +1,10 @@
 package metric
 
-import "strings"
+import (
+	"strings"
+
+	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
+)
 
 // Section of the attributes.select configuration. They are metric names
 // using the dot.notation and suppressing any .total .sum or .count suffix.
@@ -26,6 +30,21 @@ var (
 		Prom:    "beyla_network_flow_bytes_total",
 		OTEL:    "beyla.network.flow.bytes",
 	}
+	BeylaNetworkICMPRTT = Name{
+		Section: "beyla.network.icmp.rtt",
+		Prom:    "beyla_network_icmp_rtt_seconds",
+		OTEL:    "beyla.network.icmp.rtt",
+	}
+	BeylaNetworkFlowSize = Name{
+		Section: "beyla.network.flow.size",
+		Prom:    "beyla_network_flow_size_bytes",
+		OTEL:    "beyla.network.flow.size",
+	}
+	BeylaNetworkFlowDuration = Name{
+		Section: "beyla.network.flow.duration",
+		Prom:    "beyla_network_flow_duration_seconds",
+		OTEL:    "beyla.network.flow.duration",
+	}
 	HTTPServerRequestSize = Name{
 		Section: "http.server.request.body.size",
 		Prom:    "http_server_request_body_size_bytes",
@@ -63,6 +82,59 @@ var (
 	}
 )
 
+// oldMetrics are the names of the HTTP metrics in the semantic conventions 1.20 and earlier.
+// The Section is kept, so the attributes.select entries don't depend on the semantic conventions.
+var oldMetrics = map[Section]Name{
+	HTTPServerRequestSize.Section: {
+		Section: HTTPServerRequestSize.Section,
+		Prom:    "http_server_request_size_bytes",
+		OTEL:    "http.server.request.size",
+	},
+	HTTPClientRequestSize.Section: {
+		Section: HTTPClientRequestSize.Section,
+		Prom:    "http_client_request_size_bytes",
+		OTEL:    "http.client.request.size",
+	},
+	HTTPServerDuration.Section: {
+		Section: HTTPServerDuration.Section,
+		Prom:    "http_server_duration_seconds",
+		OTEL:    "http.server.duration",
+	},
+	HTTPClientDuration.Section: {
+		Section: HTTPClientDuration.Section,
+		Prom:    "http_client_duration_seconds",
+		OTEL:    "http.client.duration",
+	},
+}
+
+// clientMetrics are reported from the client side of the requests
+var clientMetrics = map[Section]struct{}{
+	HTTPClientRequestSize.Section: {},
+	HTTPClientDuration.Section:    {},
+	RPCClientDuration.Section:     {},
+	SQLClientDuration.Section:     {},
+}
+
+// SemConv returns the name of the metric according to the semantic conventions. When both the
+// stable and old conventions are selected, the stable metric name is returned, as the metrics
+// would be otherwise duplicated.
+func (n Name) SemConv(s attr.SemConvStability) Name {
+	if s.Stable() {
+		return n
+	}
+	if old, ok := oldMetrics[n.Section]; ok {
+		return old
+	}
+	return n
+}
+
+// SemConvAttrs returns the names of the selected attributes of the metric, as they must be
+// reported according to the semantic conventions.
+func (n Name) SemConvAttrs(s attr.SemConvStability, names []attr.Name) []attr.Name {
+	_, client := clientMetrics[n.Section]
+	return s.Names(names, client)
+}
+
 // normalizeMetric will facilitate the user-input in the attributes.enable section.
 // The user can specify the Prometheus or OTEL notation, and can include or not
 // the units and aggregations for the metrics. Beyla will accept all the inputs
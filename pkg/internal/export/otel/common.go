@@ -5,7 +5,11 @@ import (
 	"crypto/tls"
 	"fmt"
 	"log/slog"
+	"net"
+	"net/url"
 	"os"
+	"runtime"
+	"strings"
 
 	"github.com/go-logr/logr"
 	"github.com/hashicorp/golang-lru/v2/simplelru"
@@ -19,6 +23,8 @@ import (
 	semconv "go.opentelemetry.io/otel/semconv/v1.19.0"
 	"google.golang.org/grpc/credentials"
 
+	"github.com/grafana/beyla/pkg/buildinfo"
+	"github.com/grafana/beyla/pkg/internal/pipe/global"
 	"github.com/grafana/beyla/pkg/internal/svc"
 )
 
@@ -55,7 +61,33 @@ var DefaultBuckets = Buckets{
 	RequestSizeHistogram: []float64{0, 32, 64, 128, 256, 512, 1024, 2048, 4096, 8192},
 }
 
-func getResourceAttrs(service svc.ID) *resource.Resource {
+// resource attributes that describe the Beyla instance that generated the telemetry
+const (
+	beylaRevisionKey      = attribute.Key("beyla.revision")
+	beylaGoVersionKey     = attribute.Key("beyla.go.version")
+	beylaFeaturesKey      = attribute.Key("beyla.features")
+	beylaKernelReleaseKey = attribute.Key("beyla.kernel.release")
+)
+
+// BuildAttributes returns the resource attributes that describe the build of Beyla, its
+// enabled features and the kernel release of the host. They are the equivalent to the labels
+// of the beyla_build_info Prometheus metric. As in Prometheus, empty values are omitted.
+func BuildAttributes(build *global.BuildInfo) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		semconv.TelemetrySDKVersion(buildinfo.Version),
+		beylaRevisionKey.String(buildinfo.Revision),
+		beylaGoVersionKey.String(runtime.Version()),
+	}
+	if len(build.Features) > 0 {
+		attrs = append(attrs, beylaFeaturesKey.String(strings.Join(build.Features, ",")))
+	}
+	if build.KernelRelease != "" {
+		attrs = append(attrs, beylaKernelReleaseKey.String(build.KernelRelease))
+	}
+	return attrs
+}
+
+func getResourceAttrs(service svc.ID, build *global.BuildInfo) *resource.Resource {
 	attrs := []attribute.KeyValue{
 		semconv.ServiceName(service.Name),
 		semconv.ServiceInstanceID(service.Instance),
@@ -67,6 +99,7 @@ func getResourceAttrs(service svc.ID) *resource.Resource {
 		// We set the SDK name as Beyla, so we can distinguish beyla generated metrics from other SDKs
 		semconv.TelemetrySDKNameKey.String("beyla"),
 	}
+	attrs = append(attrs, BuildAttributes(build)...)
 
 	if service.Namespace != "" {
 		attrs = append(attrs, semconv.ServiceNamespace(service.Namespace))
@@ -115,6 +148,19 @@ func (rp *ReporterPool[T]) For(service svc.ID) (T, error) {
 	return m, nil
 }
 
+// Items returns the currently cached items, from the oldest to the newest
+func (rp *ReporterPool[T]) Items() []T {
+	return rp.pool.Values()
+}
+
+// RemoveHalf removes the least recently used half of the cached items, invoking the
+// eviction callback for each of them
+func (rp *ReporterPool[T]) RemoveHalf() {
+	for n := rp.pool.Len() / 2; n > 0; n-- {
+		rp.pool.RemoveOldest()
+	}
+}
+
 // Intermediate representation of option functions suitable for testing
 type otlpOptions struct {
 	Endpoint      string
@@ -193,6 +239,18 @@ type LogrAdaptor struct {
 	inner *slog.Logger
 }
 
+// hostPort returns the host:port address of an endpoint URL, using the default port of the
+// URL scheme if the port is not explicitly set
+func hostPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
 func SetupInternalOTELSDKLogger(levelStr string) {
 	log := slog.With("component", "otel.BatchSpanProcessor")
 	if levelStr != "" {
@@ -17,14 +17,16 @@ type instrumentedMetricsExporter struct {
 }
 
 func (ie *instrumentedMetricsExporter) Export(ctx context.Context, md *metricdata.ResourceMetrics) error {
-	if err := ie.Exporter.Export(ctx, md); err != nil {
-		ie.internal.OTELMetricExportError(err)
-		return err
-	}
 	totalMetrics := 0
 	for _, scope := range md.ScopeMetrics {
 		totalMetrics += len(scope.Metrics)
 	}
+	if err := ie.Exporter.Export(ctx, md); err != nil {
+		ie.internal.OTELMetricExportError(err)
+		// the OTEL metrics exporter retries the export internally before returning an error
+		ie.internal.OTELExportDropped(signalMetrics, DropRetryExhausted, totalMetrics)
+		return err
+	}
 	ie.internal.OTELMetricExport(totalMetrics)
 	return nil
 }
@@ -8,6 +8,7 @@ import (
 	"os"
 	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/mariomac/pipes/pipe"
@@ -20,8 +21,11 @@ import (
 	"go.opentelemetry.io/otel/sdk/metric"
 	semconv "go.opentelemetry.io/otel/semconv/v1.19.0"
 
+	"github.com/grafana/beyla/pkg/buildinfo"
 	metric2 "github.com/grafana/beyla/pkg/internal/export/metric"
+	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
 	"github.com/grafana/beyla/pkg/internal/imetrics"
+	"github.com/grafana/beyla/pkg/internal/loadshed"
 	"github.com/grafana/beyla/pkg/internal/pipe/global"
 	"github.com/grafana/beyla/pkg/internal/request"
 	"github.com/grafana/beyla/pkg/internal/svc"
@@ -155,9 +159,16 @@ func (m MetricsConfig) Enabled() bool {
 type MetricsReporter struct {
 	ctx        context.Context
 	cfg        *MetricsConfig
+	build      *global.BuildInfo
 	attributes *metric2.AttrSelector
+	semconv    attr.SemConvStability
 	exporter   metric.Exporter
 	reporters  ReporterPool[*Metrics]
+	// shrinkReporters is set under high memory pressure. The pool is not safe for concurrent
+	// access, so it is shrunk from the reporting loop
+	shrinkReporters atomic.Bool
+	// loadShedding stops recording the request body sizes when Beyla can't keep the pace of the spans
+	loadShedding *loadshed.Shedder
 
 	// user-selected fields for each of the reported metrics
 	attrHTTPDuration          []metric2.Field[*request.Span, attribute.KeyValue]
@@ -222,30 +233,35 @@ func newMetricsReporter(
 ) (*MetricsReporter, error) {
 	log := mlog()
 
-	attribProvider, err := metric2.NewAttrSelector(ctxInfo.MetricAttributeGroups, userAttribSelection)
+	attribProvider, err := metric2.NewAttrSelector(ctxInfo.MetricAttributeGroups, userAttribSelection,
+		ctxInfo.MetricNamespaceLabels...)
 	if err != nil {
 		return nil, fmt.Errorf("attributes select: %w", err)
 	}
 	mr := MetricsReporter{
 		ctx:        ctx,
 		cfg:        cfg,
+		build:      &ctxInfo.Build,
 		attributes: attribProvider,
+		semconv:    ctxInfo.SemConv,
+
+		loadShedding: ctxInfo.AppO11y.LoadShedding,
 	}
 	// initialize attribute getters
 	mr.attrHTTPDuration = metric2.OpenTelemetryGetters(
-		request.SpanOTELGetters, mr.attributes.For(metric2.HTTPServerDuration))
+		request.SpanOTELGetters, mr.attributesFor(metric2.HTTPServerDuration))
 	mr.attrHTTPClientDuration = metric2.OpenTelemetryGetters(
-		request.SpanOTELGetters, mr.attributes.For(metric2.HTTPClientDuration))
+		request.SpanOTELGetters, mr.attributesFor(metric2.HTTPClientDuration))
 	mr.attrHTTPRequestSize = metric2.OpenTelemetryGetters(
-		request.SpanOTELGetters, mr.attributes.For(metric2.HTTPServerRequestSize))
+		request.SpanOTELGetters, mr.attributesFor(metric2.HTTPServerRequestSize))
 	mr.attrHTTPClientRequestSize = metric2.OpenTelemetryGetters(
-		request.SpanOTELGetters, mr.attributes.For(metric2.HTTPClientRequestSize))
+		request.SpanOTELGetters, mr.attributesFor(metric2.HTTPClientRequestSize))
 	mr.attrGRPCServer = metric2.OpenTelemetryGetters(
-		request.SpanOTELGetters, mr.attributes.For(metric2.RPCServerDuration))
+		request.SpanOTELGetters, mr.attributesFor(metric2.RPCServerDuration))
 	mr.attrGRPCClient = metric2.OpenTelemetryGetters(
-		request.SpanOTELGetters, mr.attributes.For(metric2.RPCClientDuration))
+		request.SpanOTELGetters, mr.attributesFor(metric2.RPCClientDuration))
 	mr.attrSQLClient = metric2.OpenTelemetryGetters(
-		request.SpanOTELGetters, mr.attributes.For(metric2.SQLClientDuration))
+		request.SpanOTELGetters, mr.attributesFor(metric2.SQLClientDuration))
 
 	mr.reporters = NewReporterPool[*Metrics](cfg.ReportersCacheLen,
 		func(id svc.UID, v *Metrics) {
@@ -267,11 +283,17 @@ func newMetricsReporter(
 	if err != nil {
 		return nil, err
 	}
-	mr.exporter = instrumentMetricsExporter(ctxInfo.Metrics, exporter)
+	mr.exporter = instrumentMetricsExporter(ctxInfo.Metrics, ctxInfo.Aliases.MetricsExporter(exporter))
+	ctxInfo.MemoryPressure.OnHigh("otel_metrics_reporters_shrink", func() { mr.shrinkReporters.Store(true) })
 
 	return &mr, nil
 }
 
+// attributesFor returns the selected attributes of a metric, named according to the semantic conventions
+func (mr *MetricsReporter) attributesFor(name metric2.Name) []attr.Name {
+	return name.SemConvAttrs(mr.semconv, mr.attributes.For(name))
+}
+
 func (mr *MetricsReporter) otelMetricOptions(mlog *slog.Logger) []metric.Option {
 	if !mr.cfg.OTelMetricsEnabled() {
 		return []metric.Option{}
@@ -280,13 +302,13 @@ func (mr *MetricsReporter) otelMetricOptions(mlog *slog.Logger) []metric.Option
 	useExponentialHistograms := isExponentialAggregation(mr.cfg, mlog)
 
 	return []metric.Option{
-		metric.WithView(otelHistogramConfig(metric2.HTTPServerDuration.OTEL, mr.cfg.Buckets.DurationHistogram, useExponentialHistograms)),
-		metric.WithView(otelHistogramConfig(metric2.HTTPClientDuration.OTEL, mr.cfg.Buckets.DurationHistogram, useExponentialHistograms)),
+		metric.WithView(otelHistogramConfig(metric2.HTTPServerDuration.SemConv(mr.semconv).OTEL, mr.cfg.Buckets.DurationHistogram, useExponentialHistograms)),
+		metric.WithView(otelHistogramConfig(metric2.HTTPClientDuration.SemConv(mr.semconv).OTEL, mr.cfg.Buckets.DurationHistogram, useExponentialHistograms)),
 		metric.WithView(otelHistogramConfig(metric2.RPCServerDuration.OTEL, mr.cfg.Buckets.DurationHistogram, useExponentialHistograms)),
 		metric.WithView(otelHistogramConfig(metric2.RPCClientDuration.OTEL, mr.cfg.Buckets.DurationHistogram, useExponentialHistograms)),
 		metric.WithView(otelHistogramConfig(metric2.SQLClientDuration.OTEL, mr.cfg.Buckets.DurationHistogram, useExponentialHistograms)),
-		metric.WithView(otelHistogramConfig(metric2.HTTPServerRequestSize.OTEL, mr.cfg.Buckets.RequestSizeHistogram, useExponentialHistograms)),
-		metric.WithView(otelHistogramConfig(metric2.HTTPClientRequestSize.OTEL, mr.cfg.Buckets.RequestSizeHistogram, useExponentialHistograms)),
+		metric.WithView(otelHistogramConfig(metric2.HTTPServerRequestSize.SemConv(mr.semconv).OTEL, mr.cfg.Buckets.RequestSizeHistogram, useExponentialHistograms)),
+		metric.WithView(otelHistogramConfig(metric2.HTTPClientRequestSize.SemConv(mr.semconv).OTEL, mr.cfg.Buckets.RequestSizeHistogram, useExponentialHistograms)),
 	}
 }
 
@@ -321,11 +343,11 @@ func (mr *MetricsReporter) setupOtelMeters(m *Metrics, meter instrument.Meter) e
 	}
 
 	var err error
-	m.httpDuration, err = meter.Float64Histogram(metric2.HTTPServerDuration.OTEL, instrument.WithUnit("s"))
+	m.httpDuration, err = meter.Float64Histogram(metric2.HTTPServerDuration.SemConv(mr.semconv).OTEL, instrument.WithUnit("s"))
 	if err != nil {
 		return fmt.Errorf("creating http duration histogram metric: %w", err)
 	}
-	m.httpClientDuration, err = meter.Float64Histogram(metric2.HTTPClientDuration.OTEL, instrument.WithUnit("s"))
+	m.httpClientDuration, err = meter.Float64Histogram(metric2.HTTPClientDuration.SemConv(mr.semconv).OTEL, instrument.WithUnit("s"))
 	if err != nil {
 		return fmt.Errorf("creating http duration histogram metric: %w", err)
 	}
@@ -341,11 +363,11 @@ func (mr *MetricsReporter) setupOtelMeters(m *Metrics, meter instrument.Meter) e
 	if err != nil {
 		return fmt.Errorf("creating sql client duration histogram metric: %w", err)
 	}
-	m.httpRequestSize, err = meter.Float64Histogram(metric2.HTTPServerRequestSize.OTEL, instrument.WithUnit("By"))
+	m.httpRequestSize, err = meter.Float64Histogram(metric2.HTTPServerRequestSize.SemConv(mr.semconv).OTEL, instrument.WithUnit("By"))
 	if err != nil {
 		return fmt.Errorf("creating http size histogram metric: %w", err)
 	}
-	m.httpClientRequestSize, err = meter.Float64Histogram(metric2.HTTPClientRequestSize.OTEL, instrument.WithUnit("By"))
+	m.httpClientRequestSize, err = meter.Float64Histogram(metric2.HTTPClientRequestSize.SemConv(mr.semconv).OTEL, instrument.WithUnit("By"))
 	if err != nil {
 		return fmt.Errorf("creating http size histogram metric: %w", err)
 	}
@@ -423,7 +445,7 @@ func (mr *MetricsReporter) setupGraphMeters(m *Metrics, meter instrument.Meter)
 func (mr *MetricsReporter) newMetricSet(service svc.ID) (*Metrics, error) {
 	mlog := mlog().With("service", service)
 	mlog.Debug("creating new Metrics reporter")
-	resources := getResourceAttrs(service)
+	resources := getResourceAttrs(service, mr.build)
 
 	opts := []metric.Option{
 		metric.WithResource(resources),
@@ -445,7 +467,7 @@ func (mr *MetricsReporter) newMetricSet(service svc.ID) (*Metrics, error) {
 	// time units for HTTP and GRPC durations are in seconds, according to the OTEL specification:
 	// https://github.com/open-telemetry/opentelemetry-specification/tree/main/specification/metrics/semantic_conventions
 	// TODO: set ExplicitBucketBoundaries here and in prometheus from the previous specification
-	meter := m.provider.Meter(reporterName)
+	meter := m.provider.Meter(reporterName, instrument.WithInstrumentationVersion(buildinfo.Version))
 	var err error
 	if mr.cfg.OTelMetricsEnabled() {
 		err = mr.setupOtelMeters(&m, meter)
@@ -535,9 +557,16 @@ func grpcMetricsExporter(ctx context.Context, cfg *MetricsConfig) (metric.Export
 	return mexp, nil
 }
 
+// close flushes the metrics that have been recorded since the last export, and shuts down the exporter
 func (mr *MetricsReporter) close() {
+	log := slog.With("component", "MetricsReporter")
+	for _, m := range mr.reporters.Items() {
+		if err := m.provider.ForceFlush(mr.ctx); err != nil {
+			log.Warn("error flushing metrics provider", "service", m.service.UID, "error", err)
+		}
+	}
 	if err := mr.exporter.Shutdown(mr.ctx); err != nil {
-		slog.With("component", "MetricsReporter").Error("closing metrics provider", "error", err)
+		log.Error("closing metrics provider", "error", err)
 	}
 }
 
@@ -649,6 +678,7 @@ func withAttributes(span *request.Span, getters []metric2.Field[*request.Span, a
 func (r *Metrics) record(span *request.Span, mr *MetricsReporter) {
 	t := span.Timings()
 	duration := t.End.Sub(t.RequestStart).Seconds()
+	recordSize := !mr.loadShedding.Shedding(loadshed.BodySize)
 
 	if mr.cfg.OTelMetricsEnabled() {
 		switch span.Type {
@@ -656,8 +686,10 @@ func (r *Metrics) record(span *request.Span, mr *MetricsReporter) {
 			// TODO: for more accuracy, there must be a way to set the metric time from the actual span end time
 			r.httpDuration.Record(r.ctx, duration,
 				withAttributes(span, mr.attrHTTPDuration))
-			r.httpRequestSize.Record(r.ctx, float64(span.ContentLength),
-				withAttributes(span, mr.attrHTTPRequestSize))
+			if recordSize {
+				r.httpRequestSize.Record(r.ctx, float64(span.ContentLength),
+					withAttributes(span, mr.attrHTTPRequestSize))
+			}
 		case request.EventTypeGRPC:
 			r.grpcDuration.Record(r.ctx, duration,
 				withAttributes(span, mr.attrGRPCServer))
@@ -667,8 +699,10 @@ func (r *Metrics) record(span *request.Span, mr *MetricsReporter) {
 		case request.EventTypeHTTPClient:
 			r.httpClientDuration.Record(r.ctx, duration,
 				withAttributes(span, mr.attrHTTPClientDuration))
-			r.httpClientRequestSize.Record(r.ctx, float64(span.ContentLength),
-				withAttributes(span, mr.attrHTTPClientRequestSize))
+			if recordSize {
+				r.httpClientRequestSize.Record(r.ctx, float64(span.ContentLength),
+					withAttributes(span, mr.attrHTTPClientRequestSize))
+			}
 		case request.EventTypeSQLClient:
 			r.sqlClientDuration.Record(r.ctx, duration,
 				withAttributes(span, mr.attrSQLClient))
@@ -679,7 +713,9 @@ func (r *Metrics) record(span *request.Span, mr *MetricsReporter) {
 		attrOpt := instrument.WithAttributeSet(mr.spanMetricAttributes(span))
 		r.spanMetricsLatency.Record(r.ctx, duration, attrOpt)
 		r.spanMetricsCallsTotal.Add(r.ctx, 1, attrOpt)
-		r.spanMetricsSizeTotal.Add(r.ctx, float64(span.ContentLength), attrOpt)
+		if recordSize {
+			r.spanMetricsSizeTotal.Add(r.ctx, float64(span.ContentLength), attrOpt)
+		}
 	}
 
 	if mr.cfg.ServiceGraphMetricsEnabled() {
@@ -700,6 +736,10 @@ func (mr *MetricsReporter) reportMetrics(input <-chan []request.Span) {
 	var lastSvcUID svc.UID
 	var reporter *Metrics
 	for spans := range input {
+		if mr.shrinkReporters.Swap(false) {
+			mr.reporters.RemoveHalf()
+			reporter = nil
+		}
 		for i := range spans {
 			s := &spans[i]
 
@@ -819,6 +859,24 @@ func parseMetricsEndpoint(cfg *MetricsConfig) (*url.URL, bool, error) {
 	return murl, isCommon, nil
 }
 
+// EndpointAddress returns the host:port address of the OTLP metrics endpoint
+func (m *MetricsConfig) EndpointAddress() (string, error) {
+	murl, _, err := parseMetricsEndpoint(m)
+	if err != nil {
+		return "", err
+	}
+	return hostPort(murl), nil
+}
+
+// RedactedEndpoint returns the URL of the OTLP metrics endpoint, hiding its password, if any
+func (m *MetricsConfig) RedactedEndpoint() (string, error) {
+	murl, _, err := parseMetricsEndpoint(m)
+	if err != nil {
+		return "", err
+	}
+	return murl.Redacted(), nil
+}
+
 // HACK: at the time of writing this, the otelpmetrichttp API does not support explicitly
 // setting the protocol. They should be properly set via environment variables, but
 // if the user supplied the value via configuration file (and not via env vars), we override the environment.
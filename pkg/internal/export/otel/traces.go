@@ -14,6 +14,7 @@ import (
 	"go.opentelemetry.io/collector/config/configgrpc"
 	"go.opentelemetry.io/collector/config/confighttp"
 	"go.opentelemetry.io/collector/config/configopaque"
+	"go.opentelemetry.io/collector/config/configretry"
 	"go.opentelemetry.io/collector/config/configtelemetry"
 	"go.opentelemetry.io/collector/config/configtls"
 	"go.opentelemetry.io/collector/exporter"
@@ -32,6 +33,8 @@ import (
 	trace2 "go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
+	"github.com/grafana/beyla/pkg/buildinfo"
+	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
 	"github.com/grafana/beyla/pkg/internal/imetrics"
 	"github.com/grafana/beyla/pkg/internal/pipe/global"
 	"github.com/grafana/beyla/pkg/internal/request"
@@ -55,12 +58,26 @@ type TracesConfig struct {
 
 	Sampler Sampler `yaml:"sampler"`
 
+	// MaxExportBatchSize is the maximum number of spans that are sent in a single export request
+	MaxExportBatchSize int `yaml:"max_export_batch_size" env:"BEYLA_OTLP_TRACES_MAX_EXPORT_BATCH_SIZE"`
+	// MaxExportBatchBytes is the maximum size of the encoded spans that are sent in a single export request.
+	// Bigger batches are split into multiple requests.
+	MaxExportBatchBytes int `yaml:"max_export_batch_bytes" env:"BEYLA_OTLP_TRACES_MAX_EXPORT_BATCH_BYTES"`
+	// BatchTimeout is the maximum time that a span waits in a batch before being exported.
+	BatchTimeout time.Duration `yaml:"batch_timeout" env:"BEYLA_OTLP_TRACES_BATCH_TIMEOUT"`
+	// MaxQueueSize is the maximum number of spans waiting to be exported. When the queue is full,
+	// the oldest spans are dropped.
+	MaxQueueSize int `yaml:"max_queue_size" env:"BEYLA_OTLP_TRACES_MAX_QUEUE_SIZE"`
+	// QueueErrorSpansFraction is the maximum fraction of the queue that can be used to retain
+	// spans with error status when the queue is full.
+	QueueErrorSpansFraction float64 `yaml:"queue_error_spans_fraction" env:"BEYLA_OTLP_TRACES_QUEUE_ERROR_SPANS_FRACTION"`
+	// RetryMaxElapsedTime is the maximum time that the export of a batch of spans is retried before
+	// dropping it. Zero disables the retries.
+	RetryMaxElapsedTime time.Duration `yaml:"retry_max_elapsed_time" env:"BEYLA_OTLP_TRACES_RETRY_MAX_ELAPSED_TIME"`
+
 	// Configuration options below this line will remain undocumented at the moment,
 	// but can be useful for performance-tuning of some customers.
-	MaxExportBatchSize int           `yaml:"max_export_batch_size" env:"BEYLA_OTLP_TRACES_MAX_EXPORT_BATCH_SIZE"`
-	MaxQueueSize       int           `yaml:"max_queue_size" env:"BEYLA_OTLP_TRACES_MAX_QUEUE_SIZE"`
-	BatchTimeout       time.Duration `yaml:"batch_timeout" env:"BEYLA_OTLP_TRACES_BATCH_TIMEOUT"`
-	ExportTimeout      time.Duration `yaml:"export_timeout" env:"BEYLA_OTLP_TRACES_EXPORT_TIMEOUT"`
+	ExportTimeout time.Duration `yaml:"export_timeout" env:"BEYLA_OTLP_TRACES_EXPORT_TIMEOUT"`
 
 	ReportersCacheLen int `yaml:"reporters_cache_len" env:"BEYLA_TRACES_REPORT_CACHE_LEN"`
 
@@ -70,6 +87,10 @@ type TracesConfig struct {
 
 	// Grafana configuration needs to be explicitly set up before building the graph
 	Grafana *GrafanaOTLP `yaml:"-"`
+
+	// Shards of the pipeline, which need to be explicitly set up before building the graph. Each
+	// shard batches its spans separately, with its share of the batch limits.
+	Shards int `yaml:"-"`
 }
 
 // Enabled specifies that the OTEL traces node is enabled if and only if
@@ -79,7 +100,7 @@ func (m TracesConfig) Enabled() bool { //nolint:gocritic
 	return m.CommonEndpoint != "" || m.TracesEndpoint != "" || m.Grafana.TracesEnabled()
 }
 
-func (m *TracesConfig) getProtocol() Protocol {
+func (m *TracesConfig) GetProtocol() Protocol {
 	if m.TracesProtocol != "" {
 		return m.TracesProtocol
 	}
@@ -136,24 +157,69 @@ func (tr *tracesOTELReceiver) provideLoop() (pipe.FinalFunc[[]request.Span], err
 		if err != nil {
 			slog.Error("error starting traces exporter", "error", err)
 		}
-		for spans := range in {
+		// the export queue decouples the pipeline from the collector, which might be slow or unavailable
+		queue := newTracesQueue(&tr.cfg, tr.ctxInfo.Metrics)
+		sent := make(chan struct{})
+		go func() {
+			queue.sendLoop(func(traces ptrace.Traces) error {
+				err := exp.ConsumeTraces(tr.ctx, tr.ctxInfo.Aliases.Traces(traces))
+				if err != nil {
+					slog.Error("error sending traces to consumer", "error", err)
+				}
+				return err
+			})
+			close(sent)
+		}()
+		tr.batchLoop(in, newShardedBatcher(&tr.cfg, tr.ctxInfo.Metrics, queue.push))
+		queue.close()
+		<-sent
+	}, nil
+}
+
+// batchLoop forwards the received spans to the batcher, and flushes the batch when it is older than
+// the configured batch timeout. A zero timeout flushes the pending spans after each input slice.
+func (tr *tracesOTELReceiver) batchLoop(in <-chan []request.Span, batcher *shardedBatcher) {
+	var timer *time.Timer
+	var timeout <-chan time.Time
+	stopTimer := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, timeout = nil, nil
+		}
+	}
+	defer stopTimer()
+	for {
+		select {
+		case spans, ok := <-in:
+			if !ok {
+				batcher.flush(flushShutdown)
+				return
+			}
 			for i := range spans {
 				span := &spans[i]
 				if span.IgnoreSpan == request.IgnoreTraces {
 					continue
 				}
-				traces := GenerateTraces(span)
-				err := exp.ConsumeTraces(tr.ctx, traces)
-				if err != nil {
-					slog.Error("error sending trace to consumer", "error", err)
-				}
+				batcher.add(span, GenerateTraces(span, &tr.ctxInfo.Build, tr.ctxInfo.SemConv))
+			}
+			switch {
+			case !batcher.pending():
+				stopTimer()
+			case tr.cfg.BatchTimeout <= 0:
+				batcher.flush(flushTimeout)
+			case timer == nil:
+				timer = time.NewTimer(tr.cfg.BatchTimeout)
+				timeout = timer.C
 			}
+		case <-timeout:
+			timer, timeout = nil, nil
+			batcher.flush(flushTimeout)
 		}
-	}, nil
+	}
 }
 
 func getTracesExporter(ctx context.Context, cfg TracesConfig, ctxInfo *global.ContextInfo) (exporter.Traces, error) {
-	switch proto := cfg.getProtocol(); proto {
+	switch proto := cfg.GetProtocol(); proto {
 	case ProtocolHTTPJSON, ProtocolHTTPProtobuf, "": // zero value defaults to HTTP for backwards-compatibility
 		slog.Debug("instantiating HTTP TracesReporter", "protocol", proto)
 		var t trace.SpanExporter
@@ -176,6 +242,7 @@ func getTracesExporter(ctx context.Context, cfg TracesConfig, ctxInfo *global.Co
 		factory := otlphttpexporter.NewFactory()
 		config := factory.CreateDefaultConfig().(*otlphttpexporter.Config)
 		config.QueueConfig.Enabled = false
+		config.RetryConfig = retryConfig(&cfg)
 		config.ClientConfig = confighttp.ClientConfig{
 			Endpoint: endpoint.String(),
 			TLSSetting: configtls.ClientConfig{
@@ -207,6 +274,7 @@ func getTracesExporter(ctx context.Context, cfg TracesConfig, ctxInfo *global.Co
 		factory := otlpexporter.NewFactory()
 		config := factory.CreateDefaultConfig().(*otlpexporter.Config)
 		config.QueueConfig.Enabled = false
+		config.RetryConfig = retryConfig(&cfg)
 		config.ClientConfig = configgrpc.ClientConfig{
 			Endpoint: endpoint.String(),
 			TLSSetting: configtls.ClientConfig{
@@ -224,6 +292,22 @@ func getTracesExporter(ctx context.Context, cfg TracesConfig, ctxInfo *global.Co
 
 }
 
+// retryConfig returns the retry settings of the collector exporter, whose retries
+// can't take longer than the configured RetryMaxElapsedTime
+func retryConfig(cfg *TracesConfig) configretry.BackOffConfig {
+	retry := configretry.NewDefaultBackOffConfig()
+	if cfg.RetryMaxElapsedTime <= 0 {
+		retry.Enabled = false
+		return retry
+	}
+	retry.MaxElapsedTime = cfg.RetryMaxElapsedTime
+	// for short elapsed times, make sure that the export is retried at least a few times
+	if maxInterval := cfg.RetryMaxElapsedTime / 4; retry.InitialInterval > maxInterval {
+		retry.InitialInterval = maxInterval
+	}
+	return retry
+}
+
 func getTraceSettings(ctxInfo *global.ContextInfo, cfg TracesConfig, in trace.SpanExporter) exporter.CreateSettings {
 	var opts []trace.BatchSpanProcessorOption
 	if cfg.MaxExportBatchSize > 0 {
@@ -262,14 +346,16 @@ func getTraceSettings(ctxInfo *global.ContextInfo, cfg TracesConfig, in trace.Sp
 }
 
 // GenerateTraces creates a ptrace.Traces from a request.Span
-func GenerateTraces(span *request.Span) ptrace.Traces {
+func GenerateTraces(span *request.Span, build *global.BuildInfo, conventions attr.SemConvStability) ptrace.Traces {
 	t := span.Timings()
 	start := spanStartTime(t)
 	hasSubSpans := t.Start.After(start)
 	traces := ptrace.NewTraces()
 	rs := traces.ResourceSpans().AppendEmpty()
 	ss := rs.ScopeSpans().AppendEmpty()
-	resourceAttrs := attrsToMap(getResourceAttrs(span.ServiceID).Attributes())
+	ss.Scope().SetName(reporterName)
+	ss.Scope().SetVersion(buildinfo.Version)
+	resourceAttrs := attrsToMap(getResourceAttrs(span.ServiceID, build).Attributes())
 	resourceAttrs.PutStr(string(semconv.OTelLibraryNameKey), reporterName)
 	resourceAttrs.CopyTo(rs.Resource().Attributes())
 
@@ -299,7 +385,7 @@ func GenerateTraces(span *request.Span) ptrace.Traces {
 	}
 
 	// Set span attributes
-	attrs := traceAttributes(span)
+	attrs := traceAttributes(span, conventions)
 	m := attrsToMap(attrs)
 	m.CopyTo(s.Attributes())
 
@@ -469,7 +555,7 @@ func SpanKindString(span *request.Span) string {
 	return "SPAN_KIND_INTERNAL"
 }
 
-func traceAttributes(span *request.Span) []attribute.KeyValue {
+func traceAttributes(span *request.Span, conventions attr.SemConvStability) []attribute.KeyValue {
 	var attrs []attribute.KeyValue
 
 	switch span.Type {
@@ -524,8 +610,14 @@ func traceAttributes(span *request.Span) []attribute.KeyValue {
 			}
 		}
 	}
+	if span.OtherServiceAccount != "" {
+		attrs = append(attrs, attr.K8sPeerServiceAccount.OTEL().String(span.OtherServiceAccount))
+	}
+	for name, value := range span.OtherNamespaceLabels {
+		attrs = append(attrs, name.OTEL().String(value))
+	}
 
-	return attrs
+	return conventions.KeyValues(attrs, spanKind(span) == trace2.SpanKindClient)
 }
 
 func TraceName(span *request.Span) string {
@@ -601,6 +693,24 @@ func parseTracesEndpoint(cfg *TracesConfig) (*url.URL, bool, error) {
 	return murl, isCommon, nil
 }
 
+// EndpointAddress returns the host:port address of the OTLP traces endpoint
+func (m *TracesConfig) EndpointAddress() (string, error) {
+	murl, _, err := parseTracesEndpoint(m)
+	if err != nil {
+		return "", err
+	}
+	return hostPort(murl), nil
+}
+
+// RedactedEndpoint returns the URL of the OTLP traces endpoint, hiding its password, if any
+func (m *TracesConfig) RedactedEndpoint() (string, error) {
+	murl, _, err := parseTracesEndpoint(m)
+	if err != nil {
+		return "", err
+	}
+	return murl.Redacted(), nil
+}
+
 func getHTTPTracesEndpointOptions(cfg *TracesConfig) (otlpOptions, error) {
 	opts := otlpOptions{}
 	log := tlog().With("transport", "http")
@@ -0,0 +1,133 @@
+package otel
+
+import (
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+	"github.com/grafana/beyla/pkg/internal/pipe/shard"
+	"github.com/grafana/beyla/pkg/internal/request"
+)
+
+// reasons for flushing a batch of traces, as reported by the internal metrics
+const (
+	flushMaxSize  = "max_size"
+	flushMaxBytes = "max_bytes"
+	flushTimeout  = "timeout"
+	flushShutdown = "shutdown"
+)
+
+// tracesBatcher accumulates the traces generated from the spans and forwards them in batches that
+// never exceed the configured number of spans nor encoded bytes. If adding some traces to the
+// current batch would exceed any of the limits, the current batch is flushed first, so the traces
+// are split into multiple batches instead of being dropped.
+type tracesBatcher struct {
+	maxSpans int
+	maxBytes int
+	send     func(ptrace.Traces)
+	metrics  imetrics.Reporter
+	sizer    ptrace.ProtoMarshaler
+
+	batch ptrace.Traces
+	spans int
+	bytes int
+}
+
+func newTracesBatcher(cfg *TracesConfig, metrics imetrics.Reporter, send func(ptrace.Traces)) *tracesBatcher {
+	if metrics == nil {
+		metrics = imetrics.NoopReporter{}
+	}
+	return &tracesBatcher{
+		maxSpans: cfg.MaxExportBatchSize,
+		maxBytes: cfg.MaxExportBatchBytes,
+		send:     send,
+		metrics:  metrics,
+		batch:    ptrace.NewTraces(),
+	}
+}
+
+// add moves the contents of the passed traces into the current batch, flushing the batch
+// before and/or after if any of the limits is reached
+func (b *tracesBatcher) add(traces ptrace.Traces) {
+	spans := traces.SpanCount()
+	bytes := b.sizer.TracesSize(traces)
+	if b.spans > 0 {
+		if b.maxSpans > 0 && b.spans+spans > b.maxSpans {
+			b.flush(flushMaxSize)
+		} else if b.maxBytes > 0 && b.bytes+bytes > b.maxBytes {
+			b.flush(flushMaxBytes)
+		}
+	}
+	traces.ResourceSpans().MoveAndAppendTo(b.batch.ResourceSpans())
+	b.spans += spans
+	b.bytes += bytes
+	if b.maxSpans > 0 && b.spans >= b.maxSpans {
+		b.flush(flushMaxSize)
+	} else if b.maxBytes > 0 && b.bytes >= b.maxBytes {
+		b.flush(flushMaxBytes)
+	}
+}
+
+// pending returns whether the current batch contains traces that haven't been flushed yet
+func (b *tracesBatcher) pending() bool {
+	return b.spans > 0
+}
+
+// flush forwards the current batch, if not empty, and starts a new one
+func (b *tracesBatcher) flush(reason string) {
+	if b.spans == 0 {
+		return
+	}
+	b.metrics.OTELTraceBatch(b.spans, b.bytes, reason)
+	b.send(b.batch)
+	b.batch = ptrace.NewTraces()
+	b.spans, b.bytes = 0, 0
+}
+
+// shardedBatcher keeps a separate batch for each shard of the pipeline, so the spans of a service with a
+// huge volume do not fill, nor trigger the flush of, the batches of the services in other shards.
+// Each shard batcher gets an equal share of the configured batch limits.
+type shardedBatcher struct {
+	shards []*tracesBatcher
+}
+
+func newShardedBatcher(cfg *TracesConfig, metrics imetrics.Reporter, send func(ptrace.Traces)) *shardedBatcher {
+	if cfg.Shards <= 1 {
+		return &shardedBatcher{shards: []*tracesBatcher{newTracesBatcher(cfg, metrics, send)}}
+	}
+	shardCfg := *cfg
+	shardCfg.MaxExportBatchSize = shareOf(cfg.MaxExportBatchSize, cfg.Shards)
+	shardCfg.MaxExportBatchBytes = shareOf(cfg.MaxExportBatchBytes, cfg.Shards)
+	sb := &shardedBatcher{shards: make([]*tracesBatcher, cfg.Shards)}
+	for i := range sb.shards {
+		sb.shards[i] = newTracesBatcher(&shardCfg, metrics, send)
+	}
+	return sb
+}
+
+// shareOf divides a limit among the shards. A zero limit means no limit, and a share is never zero.
+func shareOf(limit, shards int) int {
+	if limit <= 0 {
+		return limit
+	}
+	return max(1, limit/shards)
+}
+
+// add the traces generated from the passed span to the batch of the span shard
+func (sb *shardedBatcher) add(span *request.Span, traces ptrace.Traces) {
+	sb.shards[shard.Of(&span.ServiceID, len(sb.shards))].add(traces)
+}
+
+func (sb *shardedBatcher) pending() bool {
+	for _, b := range sb.shards {
+		if b.pending() {
+			return true
+		}
+	}
+	return false
+}
+
+func (sb *shardedBatcher) flush(reason string) {
+	for _, b := range sb.shards {
+		b.flush(reason)
+	}
+}
@@ -0,0 +1,250 @@
+package otel
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.19.0"
+
+	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+	"github.com/grafana/beyla/pkg/internal/pipe/global"
+	"github.com/grafana/beyla/pkg/internal/pipe/shard"
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+const testTimeout = 5 * time.Second
+
+type batchRecorder struct {
+	imetrics.NoopReporter
+	batches chan ptrace.Traces
+	reasons chan string
+}
+
+func newBatchRecorder() *batchRecorder {
+	return &batchRecorder{
+		batches: make(chan ptrace.Traces, 100),
+		reasons: make(chan string, 100),
+	}
+}
+
+func (r *batchRecorder) send(traces ptrace.Traces) {
+	r.batches <- traces
+}
+
+func (r *batchRecorder) OTELTraceBatch(_, _ int, reason string) {
+	r.reasons <- reason
+}
+
+func (r *batchRecorder) next(t *testing.T) (ptrace.Traces, string) {
+	t.Helper()
+	select {
+	case b := <-r.batches:
+		return b, <-r.reasons
+	case <-time.After(testTimeout):
+		require.Fail(t, "timeout while waiting for a batch of traces")
+	}
+	return ptrace.Traces{}, ""
+}
+
+func (r *batchRecorder) assertEmpty(t *testing.T) {
+	t.Helper()
+	select {
+	case b := <-r.batches:
+		assert.Failf(t, "unexpected batch", "got %d spans", b.SpanCount())
+	default:
+	}
+}
+
+func clientTraces() ptrace.Traces {
+	return GenerateTraces(&request.Span{
+		Type: request.EventTypeHTTPClient, Method: "GET", Path: "/test", Status: 200,
+	}, &global.BuildInfo{}, attr.SemConvStable)
+}
+
+func TestTracesBatcher_MaxSize(t *testing.T) {
+	// GIVEN a batcher limited to 3 spans
+	rec := newBatchRecorder()
+	b := newTracesBatcher(&TracesConfig{MaxExportBatchSize: 3}, rec, rec.send)
+
+	// WHEN adding 7 spans
+	for i := 0; i < 7; i++ {
+		b.add(clientTraces())
+	}
+	// THEN the spans are flushed in batches of 3 as soon as the limit is reached
+	for i := 0; i < 2; i++ {
+		batch, reason := rec.next(t)
+		assert.Equal(t, 3, batch.SpanCount())
+		assert.Equal(t, flushMaxSize, reason)
+	}
+	rec.assertEmpty(t)
+
+	// AND the remaining span is kept until the batcher is explicitly flushed
+	assert.True(t, b.pending())
+	b.flush(flushShutdown)
+	batch, reason := rec.next(t)
+	assert.Equal(t, 1, batch.SpanCount())
+	assert.Equal(t, flushShutdown, reason)
+	assert.False(t, b.pending())
+
+	// AND flushing an empty batch does nothing
+	b.flush(flushTimeout)
+	rec.assertEmpty(t)
+}
+
+func TestTracesBatcher_MaxBytes(t *testing.T) {
+	spanSize := (&ptrace.ProtoMarshaler{}).TracesSize(clientTraces())
+
+	// GIVEN a batcher whose byte limit fits two and a half spans
+	rec := newBatchRecorder()
+	b := newTracesBatcher(&TracesConfig{MaxExportBatchSize: 100, MaxExportBatchBytes: spanSize * 5 / 2}, rec, rec.send)
+
+	// WHEN adding 5 spans
+	for i := 0; i < 5; i++ {
+		b.add(clientTraces())
+	}
+	b.flush(flushShutdown)
+
+	// THEN the spans are split in batches whose encoded size does not exceed the limit
+	expected := []struct {
+		spans  int
+		reason string
+	}{{2, flushMaxBytes}, {2, flushMaxBytes}, {1, flushShutdown}}
+	for _, exp := range expected {
+		batch, reason := rec.next(t)
+		assert.Equal(t, exp.spans, batch.SpanCount())
+		assert.Equal(t, exp.reason, reason)
+		// the size of the merged batch is the sum of the sizes of its traces
+		assert.Equal(t, exp.spans*spanSize, (&ptrace.ProtoMarshaler{}).TracesSize(batch))
+	}
+	rec.assertEmpty(t)
+}
+
+func TestTracesBatcher_SpanBiggerThanMaxBytes(t *testing.T) {
+	// GIVEN a batcher whose byte limit is smaller than a single span
+	rec := newBatchRecorder()
+	b := newTracesBatcher(&TracesConfig{MaxExportBatchBytes: 10}, rec, rec.send)
+
+	// WHEN adding 2 spans
+	b.add(clientTraces())
+	b.add(clientTraces())
+
+	// THEN the spans are not dropped but sent in their own batch
+	for i := 0; i < 2; i++ {
+		batch, reason := rec.next(t)
+		assert.Equal(t, 1, batch.SpanCount())
+		assert.Equal(t, flushMaxBytes, reason)
+	}
+	rec.assertEmpty(t)
+}
+
+func TestTracesBatchLoop_Timeout(t *testing.T) {
+	// GIVEN a traces receiver with a batch timeout
+	rec := newBatchRecorder()
+	tr := &tracesOTELReceiver{
+		cfg:     TracesConfig{MaxExportBatchSize: 100, BatchTimeout: 50 * time.Millisecond},
+		ctxInfo: &global.ContextInfo{},
+	}
+	in := make(chan []request.Span, 10)
+	done := make(chan struct{})
+	go func() {
+		tr.batchLoop(in, newShardedBatcher(&tr.cfg, rec, rec.send))
+		close(done)
+	}()
+
+	// WHEN it receives some spans that do not fill the batch
+	clientSpan := request.Span{Type: request.EventTypeHTTPClient, Method: "GET", Path: "/test", Status: 200}
+	in <- []request.Span{clientSpan, clientSpan}
+	in <- []request.Span{clientSpan, {IgnoreSpan: request.IgnoreTraces}}
+
+	// THEN the spans are flushed after the batch timeout
+	batch, reason := rec.next(t)
+	assert.Equal(t, 3, batch.SpanCount())
+	assert.Equal(t, flushTimeout, reason)
+
+	// AND the pending spans are flushed when the input channel is closed
+	in <- []request.Span{clientSpan}
+	close(in)
+	batch, reason = rec.next(t)
+	assert.Equal(t, 1, batch.SpanCount())
+	assert.Contains(t, []string{flushTimeout, flushShutdown}, reason)
+	select {
+	case <-done:
+	case <-time.After(testTimeout):
+		require.Fail(t, "batch loop did not end")
+	}
+	rec.assertEmpty(t)
+}
+
+func TestTracesBatchLoop_ZeroTimeout(t *testing.T) {
+	// GIVEN a traces receiver without batch timeout
+	rec := newBatchRecorder()
+	tr := &tracesOTELReceiver{
+		cfg:     TracesConfig{MaxExportBatchSize: 100},
+		ctxInfo: &global.ContextInfo{},
+	}
+	in := make(chan []request.Span, 10)
+	go tr.batchLoop(in, newShardedBatcher(&tr.cfg, rec, rec.send))
+	defer close(in)
+
+	// WHEN it receives a slice of spans
+	clientSpan := request.Span{Type: request.EventTypeHTTPClient, Method: "GET", Path: "/test", Status: 200}
+	in <- []request.Span{clientSpan, clientSpan}
+
+	// THEN all the spans in the slice are sent together without waiting
+	batch, reason := rec.next(t)
+	assert.Equal(t, 2, batch.SpanCount())
+	assert.Equal(t, flushTimeout, reason)
+}
+
+func TestShardedBatcher(t *testing.T) {
+	// GIVEN a batcher for a pipeline with 2 shards, limited to 4 spans
+	rec := newBatchRecorder()
+	b := newShardedBatcher(&TracesConfig{MaxExportBatchSize: 4, Shards: 2}, rec, rec.send)
+
+	// AND two services whose spans are processed by different shards
+	var services []request.Span
+	for i := 0; len(services) < 2; i++ {
+		span := request.Span{
+			Type: request.EventTypeHTTPClient, Method: "GET", Path: "/test", Status: 200,
+			ServiceID: svc.ID{Name: fmt.Sprintf("svc-%d", i), UID: svc.UID(fmt.Sprintf("host-%d", i))},
+		}
+		if len(services) == 0 || shard.Of(&span.ServiceID, 2) != shard.Of(&services[0].ServiceID, 2) {
+			services = append(services, span)
+		}
+	}
+	noisy, quiet := &services[0], &services[1]
+
+	// WHEN the first service generates more spans than the second
+	b.add(quiet, GenerateTraces(quiet, &global.BuildInfo{}, attr.SemConvStable))
+	for i := 0; i < 5; i++ {
+		b.add(noisy, GenerateTraces(noisy, &global.BuildInfo{}, attr.SemConvStable))
+	}
+
+	// THEN each shard gets its share of the batch size, and the noisy service only
+	// flushes the batches of its own shard
+	for i := 0; i < 2; i++ {
+		batch, reason := rec.next(t)
+		assert.Equal(t, 2, batch.SpanCount())
+		assert.Equal(t, flushMaxSize, reason)
+		svcName, _ := batch.ResourceSpans().At(0).Resource().Attributes().Get(string(semconv.ServiceNameKey))
+		assert.Equal(t, noisy.ServiceID.Name, svcName.Str())
+	}
+	rec.assertEmpty(t)
+
+	// AND the pending spans of all the shards are flushed together
+	assert.True(t, b.pending())
+	b.flush(flushTimeout)
+	spans := 0
+	for i := 0; i < 2; i++ {
+		batch, _ := rec.next(t)
+		spans += batch.SpanCount()
+	}
+	assert.Equal(t, 2, spans)
+	assert.False(t, b.pending())
+}
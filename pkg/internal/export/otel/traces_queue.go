@@ -0,0 +1,207 @@
+package otel
+
+import (
+	"sync"
+
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+)
+
+// reasons for dropping telemetry, as reported by the internal metrics
+const (
+	// DropQueueFull is reported when the spans are discarded from a full export queue
+	DropQueueFull = "queue_full"
+	// DropRetryExhausted is reported when the export fails after retrying it
+	DropRetryExhausted = "retry_exhausted"
+	// DropEncodeError is reported when the export fails with a permanent error, because the data can't be
+	// encoded or the collector rejects it, so it isn't retried
+	DropEncodeError = "encode_error"
+)
+
+// signals, as reported by the internal metrics
+const (
+	signalTraces  = "traces"
+	signalMetrics = "metrics"
+)
+
+// queuedBatch is a batch of traces waiting to be exported
+type queuedBatch struct {
+	traces     ptrace.Traces
+	spans      int
+	errorSpans int
+}
+
+// errorsOnly returns whether all the spans in the batch have error status
+func (qb *queuedBatch) errorsOnly() bool {
+	return qb.spans == qb.errorSpans
+}
+
+// tracesQueue decouples the generation of the span batches from their export, so a slow or
+// unavailable collector does not block the previous stages of the pipeline. When the number of
+// queued spans exceeds the queue capacity, it drops spans according to the following policy:
+//   - oldest batches are dropped first.
+//   - spans with error status are retained, as long as they don't exceed the configured fraction
+//     of the queue capacity. Beyond that fraction, they are dropped as any other span.
+//
+// Every dropped span is accounted in the internal metrics, labeled by the reason of the drop.
+type tracesQueue struct {
+	capacity        int
+	errorSpansLimit int
+	metrics         imetrics.Reporter
+
+	mt         sync.Mutex
+	batches    []*queuedBatch
+	spans      int
+	errorSpans int
+	closed     bool
+	// notify wakes up the sendLoop when there are new batches or the queue is closed
+	notify chan struct{}
+}
+
+func newTracesQueue(cfg *TracesConfig, metrics imetrics.Reporter) *tracesQueue {
+	if metrics == nil {
+		metrics = imetrics.NoopReporter{}
+	}
+	return &tracesQueue{
+		capacity:        cfg.MaxQueueSize,
+		errorSpansLimit: int(float64(cfg.MaxQueueSize) * cfg.QueueErrorSpansFraction),
+		metrics:         metrics,
+		notify:          make(chan struct{}, 1),
+	}
+}
+
+// push adds a batch of traces to the queue, dropping older spans if the queue is full
+func (q *tracesQueue) push(traces ptrace.Traces) {
+	batch := &queuedBatch{traces: traces, spans: traces.SpanCount(), errorSpans: errorSpanCount(traces)}
+	q.mt.Lock()
+	if q.capacity > 0 {
+		for len(q.batches) > 0 && q.spans+batch.spans > q.capacity {
+			q.evict()
+		}
+	}
+	q.batches = append(q.batches, batch)
+	q.spans += batch.spans
+	q.errorSpans += batch.errorSpans
+	q.mt.Unlock()
+	q.wakeUp()
+}
+
+// evict releases space in the queue, following the drop policy. It must be invoked with the lock held.
+func (q *tracesQueue) evict() {
+	victim := 0
+	if q.errorSpans <= q.errorSpansLimit {
+		// error spans are retained, so we look for the oldest batch with non-error spans
+		for victim < len(q.batches) && q.batches[victim].errorsOnly() {
+			victim++
+		}
+		if victim == len(q.batches) {
+			// only error spans in the queue. We drop the oldest
+			victim = 0
+		}
+	}
+	batch := q.batches[victim]
+	if batch.errorsOnly() || q.errorSpans > q.errorSpansLimit {
+		q.batches = append(q.batches[:victim], q.batches[victim+1:]...)
+		q.spans -= batch.spans
+		q.errorSpans -= batch.errorSpans
+		q.metrics.OTELExportDropped(signalTraces, DropQueueFull, batch.spans)
+		return
+	}
+	// keep only the error spans of the victim batch
+	removeNonErrorSpans(batch.traces)
+	dropped := batch.spans - batch.errorSpans
+	batch.spans = batch.errorSpans
+	q.spans -= dropped
+	q.metrics.OTELExportDropped(signalTraces, DropQueueFull, dropped)
+	if batch.spans == 0 {
+		q.batches = append(q.batches[:victim], q.batches[victim+1:]...)
+	}
+}
+
+// close stops accepting new batches. The sendLoop will return after exporting the queued batches.
+func (q *tracesQueue) close() {
+	q.mt.Lock()
+	q.closed = true
+	q.mt.Unlock()
+	q.wakeUp()
+}
+
+func (q *tracesQueue) wakeUp() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// pop returns the oldest batch in the queue, waiting for it if the queue is empty.
+// It returns false if the queue is empty and closed.
+func (q *tracesQueue) pop() (*queuedBatch, bool) {
+	for {
+		q.mt.Lock()
+		if len(q.batches) > 0 {
+			batch := q.batches[0]
+			q.batches[0] = nil
+			q.batches = q.batches[1:]
+			q.spans -= batch.spans
+			q.errorSpans -= batch.errorSpans
+			q.mt.Unlock()
+			return batch, true
+		}
+		closed := q.closed
+		q.mt.Unlock()
+		if closed {
+			return nil, false
+		}
+		<-q.notify
+	}
+}
+
+// sendLoop exports the queued batches in order until the queue is closed and empty.
+// The send function is expected to retry the export of each batch before returning an error.
+func (q *tracesQueue) sendLoop(send func(ptrace.Traces) error) {
+	for {
+		batch, ok := q.pop()
+		if !ok {
+			return
+		}
+		if err := send(batch.traces); err != nil {
+			reason := DropRetryExhausted
+			if consumererror.IsPermanent(err) {
+				reason = DropEncodeError
+			}
+			q.metrics.OTELExportDropped(signalTraces, reason, batch.spans)
+			tlog().Debug("dropped traces batch", "reason", reason, "spans", batch.spans, "error", err)
+		}
+	}
+}
+
+func errorSpanCount(traces ptrace.Traces) int {
+	count := 0
+	rss := traces.ResourceSpans()
+	for i := 0; i < rss.Len(); i++ {
+		sss := rss.At(i).ScopeSpans()
+		for j := 0; j < sss.Len(); j++ {
+			spans := sss.At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				if spans.At(k).Status().Code() == ptrace.StatusCodeError {
+					count++
+				}
+			}
+		}
+	}
+	return count
+}
+
+func removeNonErrorSpans(traces ptrace.Traces) {
+	traces.ResourceSpans().RemoveIf(func(rs ptrace.ResourceSpans) bool {
+		rs.ScopeSpans().RemoveIf(func(ss ptrace.ScopeSpans) bool {
+			ss.Spans().RemoveIf(func(span ptrace.Span) bool {
+				return span.Status().Code() != ptrace.StatusCodeError
+			})
+			return ss.Spans().Len() == 0
+		})
+		return rs.ScopeSpans().Len() == 0
+	})
+}
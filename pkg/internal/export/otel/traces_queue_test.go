@@ -0,0 +1,295 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+	"github.com/grafana/beyla/pkg/internal/pipe/global"
+	"github.com/grafana/beyla/pkg/internal/request"
+)
+
+type dropsRecorder struct {
+	imetrics.NoopReporter
+	mt    sync.Mutex
+	drops map[string]int
+}
+
+func newDropsRecorder() *dropsRecorder {
+	return &dropsRecorder{drops: map[string]int{}}
+}
+
+func (d *dropsRecorder) OTELExportDropped(signal, reason string, items int) {
+	d.mt.Lock()
+	defer d.mt.Unlock()
+	d.drops[signal+"/"+reason] += items
+}
+
+func (d *dropsRecorder) dropped(signal, reason string) int {
+	d.mt.Lock()
+	defer d.mt.Unlock()
+	return d.drops[signal+"/"+reason]
+}
+
+// batchOf generates a batch of client spans whose route identifies the batch, and where
+// the given number of spans have error status
+func batchOf(id, spans, errors int) ptrace.Traces {
+	traces := ptrace.NewTraces()
+	for i := 0; i < spans; i++ {
+		status := 200
+		if i < errors {
+			status = 500
+		}
+		GenerateTraces(&request.Span{
+			Type: request.EventTypeHTTPClient, Method: "GET", Path: fmt.Sprintf("/batch/%d", id), Status: status,
+		}, &global.BuildInfo{}, attr.SemConvStable).ResourceSpans().MoveAndAppendTo(traces.ResourceSpans())
+	}
+	return traces
+}
+
+// batchSummary contains the identifier of an exported batch, and its number of error and non-error spans
+type batchSummary struct {
+	path   string
+	ok     int
+	errors int
+}
+
+func summarize(traces ptrace.Traces) batchSummary {
+	sum := batchSummary{}
+	rss := traces.ResourceSpans()
+	for i := 0; i < rss.Len(); i++ {
+		spans := rss.At(i).ScopeSpans().At(0).Spans()
+		for k := 0; k < spans.Len(); k++ {
+			span := spans.At(k)
+			path, _ := span.Attributes().Get("url.full")
+			sum.path = path.Str()
+			if span.Status().Code() == ptrace.StatusCodeError {
+				sum.errors++
+			} else {
+				sum.ok++
+			}
+		}
+	}
+	return sum
+}
+
+func TestTracesQueue_DropOldestFirst(t *testing.T) {
+	// GIVEN a queue with capacity for 10 spans
+	drops := newDropsRecorder()
+	q := newTracesQueue(&TracesConfig{MaxQueueSize: 10}, drops)
+
+	// WHEN it receives more spans than its capacity, without errors
+	for i := 0; i < 5; i++ {
+		q.push(batchOf(i, 3, 0))
+	}
+	q.close()
+
+	// THEN the oldest batches are dropped
+	assert.Equal(t, 6, drops.dropped(signalTraces, DropQueueFull))
+	var paths []string
+	q.sendLoop(func(traces ptrace.Traces) error {
+		paths = append(paths, summarize(traces).path)
+		return nil
+	})
+	assert.Equal(t, []string{"/batch/2", "/batch/3", "/batch/4"}, paths)
+}
+
+func TestTracesQueue_RetainErrorSpans(t *testing.T) {
+	// GIVEN a queue with capacity for 10 spans, which retains error spans up to the 40% of its capacity
+	drops := newDropsRecorder()
+	q := newTracesQueue(&TracesConfig{MaxQueueSize: 10, QueueErrorSpansFraction: 0.4}, drops)
+
+	// WHEN it receives more spans than its capacity
+	q.push(batchOf(0, 4, 1)) // 1 error span
+	q.push(batchOf(1, 4, 2)) // 2 error spans
+	q.push(batchOf(2, 4, 0))
+	q.push(batchOf(3, 4, 0))
+	q.close()
+
+	// THEN the non-error spans of the oldest batches are dropped first, and the
+	// error spans are retained up to the configured fraction of the queue
+	assert.Equal(t, 9, drops.dropped(signalTraces, DropQueueFull))
+	var batches []batchSummary
+	q.sendLoop(func(traces ptrace.Traces) error {
+		batches = append(batches, summarize(traces))
+		return nil
+	})
+	assert.Equal(t, []batchSummary{
+		{path: "/batch/0", errors: 1},
+		{path: "/batch/1", errors: 2},
+		{path: "/batch/3", ok: 4},
+	}, batches)
+}
+
+func TestTracesQueue_ErrorSpansBeyondFraction(t *testing.T) {
+	// GIVEN a queue with capacity for 10 spans, which retains error spans up to the 20% of its capacity
+	drops := newDropsRecorder()
+	q := newTracesQueue(&TracesConfig{MaxQueueSize: 10, QueueErrorSpansFraction: 0.2}, drops)
+
+	// WHEN it receives more error spans than the retained fraction
+	q.push(batchOf(0, 3, 3))
+	q.push(batchOf(1, 3, 3))
+	q.push(batchOf(2, 3, 0))
+	q.push(batchOf(3, 3, 0))
+	q.close()
+
+	// THEN the error spans beyond the fraction are dropped, oldest first
+	var batches []batchSummary
+	q.sendLoop(func(traces ptrace.Traces) error {
+		batches = append(batches, summarize(traces))
+		return nil
+	})
+	assert.Equal(t, []batchSummary{
+		{path: "/batch/1", errors: 3},
+		{path: "/batch/2", ok: 3},
+		{path: "/batch/3", ok: 3},
+	}, batches)
+	assert.Equal(t, 3, drops.dropped(signalTraces, DropQueueFull))
+}
+
+func TestTracesQueue_ExportErrors(t *testing.T) {
+	drops := newDropsRecorder()
+	q := newTracesQueue(&TracesConfig{MaxQueueSize: 100}, drops)
+	q.push(batchOf(0, 3, 0))
+	q.push(batchOf(1, 5, 0))
+	q.push(batchOf(2, 7, 0))
+	q.close()
+
+	errs := []error{
+		errors.New("collector unavailable"),
+		consumererror.NewPermanent(errors.New("can't marshal")),
+		nil,
+	}
+	q.sendLoop(func(_ ptrace.Traces) error {
+		err := errs[0]
+		errs = errs[1:]
+		return err
+	})
+	assert.Equal(t, 3, drops.dropped(signalTraces, DropRetryExhausted))
+	assert.Equal(t, 5, drops.dropped(signalTraces, DropEncodeError))
+	assert.Zero(t, drops.dropped(signalTraces, DropQueueFull))
+}
+
+// simulates a collector outage of 5 minutes, where 1 batch of spans is generated each second
+// and each export is retried for 1 minute before failing
+func TestTracesQueue_Outage(t *testing.T) {
+	const (
+		queueSize    = 100
+		batchSpans   = 10
+		outageSecs   = 300
+		retrySecs    = 60
+		errorEachNth = 10 // one batch each 10 seconds has an error span
+	)
+	drops := newDropsRecorder()
+	q := newTracesQueue(&TracesConfig{MaxQueueSize: queueSize, QueueErrorSpansFraction: 0.5}, drops)
+
+	// the simulated clock is advanced by the test, and the collector export blocks
+	// until the clock reaches the end of the retry period or the end of the outage
+	var clockMt sync.Mutex
+	clock := sync.NewCond(&clockMt)
+	now := 0
+	var delivered []batchSummary
+	sent := make(chan struct{})
+	go func() {
+		q.sendLoop(func(traces ptrace.Traces) error {
+			clockMt.Lock()
+			defer clockMt.Unlock()
+			if now < outageSecs {
+				deadline := now + retrySecs
+				for now < deadline && now < outageSecs {
+					clock.Wait()
+				}
+				if now < outageSecs {
+					return errors.New("collector unavailable")
+				}
+			}
+			delivered = append(delivered, summarize(traces))
+			return nil
+		})
+		close(sent)
+	}()
+
+	generated := 0
+	for sec := 0; sec < outageSecs; sec++ {
+		errSpans := 0
+		if sec%errorEachNth == 0 {
+			errSpans = 1
+		}
+		q.push(batchOf(sec, batchSpans, errSpans))
+		generated += batchSpans
+		clockMt.Lock()
+		now++
+		clock.Broadcast()
+		clockMt.Unlock()
+		// give the sender the chance to process the clock update
+		time.Sleep(time.Millisecond)
+	}
+	q.close()
+	select {
+	case <-sent:
+	case <-time.After(10 * time.Second):
+		require.Fail(t, "the queue was not drained")
+	}
+
+	// all the spans are either delivered or accounted as dropped
+	deliveredSpans := 0
+	errorSpans := 0
+	for _, b := range delivered {
+		deliveredSpans += b.ok + b.errors
+		errorSpans += b.errors
+	}
+	assert.Equal(t, generated,
+		deliveredSpans+drops.dropped(signalTraces, DropQueueFull)+drops.dropped(signalTraces, DropRetryExhausted))
+	// the failed exports dropped their batches after retrying them
+	assert.Positive(t, drops.dropped(signalTraces, DropRetryExhausted))
+	assert.LessOrEqual(t, deliveredSpans, queueSize+batchSpans)
+
+	// the most recent batches are delivered, in order
+	require.NotEmpty(t, delivered)
+	assert.Equal(t, fmt.Sprintf("/batch/%d", outageSecs-1), delivered[len(delivered)-1].path)
+	// AND the error spans from the older batches have been retained
+	assert.Greater(t, errorSpans, 1)
+	assert.LessOrEqual(t, errorSpans, queueSize/2+1)
+}
+
+type failingMetricsExporter struct {
+	metric.Exporter
+}
+
+func (f failingMetricsExporter) Export(_ context.Context, _ *metricdata.ResourceMetrics) error {
+	return errors.New("collector unavailable")
+}
+
+func TestMetricsExporter_Drops(t *testing.T) {
+	drops := newDropsRecorder()
+	exp := instrumentMetricsExporter(drops, failingMetricsExporter{})
+	require.Error(t, exp.Export(context.Background(), &metricdata.ResourceMetrics{
+		ScopeMetrics: []metricdata.ScopeMetrics{{Metrics: make([]metricdata.Metrics, 3)}},
+	}))
+	assert.Equal(t, 3, drops.dropped(signalMetrics, DropRetryExhausted))
+}
+
+func TestRetryConfig(t *testing.T) {
+	assert.False(t, retryConfig(&TracesConfig{}).Enabled)
+
+	retry := retryConfig(&TracesConfig{RetryMaxElapsedTime: time.Minute})
+	assert.True(t, retry.Enabled)
+	assert.Equal(t, time.Minute, retry.MaxElapsedTime)
+	assert.Equal(t, 5*time.Second, retry.InitialInterval)
+
+	retry = retryConfig(&TracesConfig{RetryMaxElapsedTime: 2 * time.Second})
+	assert.Equal(t, 2*time.Second, retry.MaxElapsedTime)
+	assert.Equal(t, 500*time.Millisecond, retry.InitialInterval)
+}
@@ -21,6 +21,8 @@ import (
 	semconv "go.opentelemetry.io/otel/semconv/v1.19.0"
 	"go.opentelemetry.io/otel/trace"
 
+	"github.com/grafana/beyla/pkg/buildinfo"
+	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
 	"github.com/grafana/beyla/pkg/internal/imetrics"
 	"github.com/grafana/beyla/pkg/internal/pipe/global"
 	"github.com/grafana/beyla/pkg/internal/request"
@@ -253,7 +255,7 @@ func TestGenerateTraces(t *testing.T) {
 			TraceID:      traceID,
 			SpanID:       spanID,
 		}
-		traces := GenerateTraces(span)
+		traces := GenerateTraces(span, &global.BuildInfo{}, attr.SemConvStable)
 
 		assert.Equal(t, 1, traces.ResourceSpans().Len())
 		assert.Equal(t, 1, traces.ResourceSpans().At(0).ScopeSpans().Len())
@@ -298,7 +300,7 @@ func TestGenerateTraces(t *testing.T) {
 			SpanID:       spanID,
 			TraceID:      traceID,
 		}
-		traces := GenerateTraces(span)
+		traces := GenerateTraces(span, &global.BuildInfo{}, attr.SemConvStable)
 
 		assert.Equal(t, 1, traces.ResourceSpans().Len())
 		assert.Equal(t, 1, traces.ResourceSpans().At(0).ScopeSpans().Len())
@@ -334,7 +336,7 @@ func TestGenerateTraces(t *testing.T) {
 			Route:        "/test",
 			Status:       200,
 		}
-		traces := GenerateTraces(span)
+		traces := GenerateTraces(span, &global.BuildInfo{}, attr.SemConvStable)
 
 		assert.Equal(t, 1, traces.ResourceSpans().Len())
 		assert.Equal(t, 1, traces.ResourceSpans().At(0).ScopeSpans().Len())
@@ -371,7 +373,7 @@ func TestGenerateTraces(t *testing.T) {
 			SpanID:       spanID,
 			TraceID:      traceID,
 		}
-		traces := GenerateTraces(span)
+		traces := GenerateTraces(span, &global.BuildInfo{}, attr.SemConvStable)
 
 		assert.Equal(t, 1, traces.ResourceSpans().Len())
 		assert.Equal(t, 1, traces.ResourceSpans().At(0).ScopeSpans().Len())
@@ -396,7 +398,7 @@ func TestGenerateTraces(t *testing.T) {
 			ParentSpanID: parentSpanID,
 			TraceID:      traceID,
 		}
-		traces := GenerateTraces(span)
+		traces := GenerateTraces(span, &global.BuildInfo{}, attr.SemConvStable)
 
 		assert.Equal(t, 1, traces.ResourceSpans().Len())
 		assert.Equal(t, 1, traces.ResourceSpans().At(0).ScopeSpans().Len())
@@ -416,7 +418,7 @@ func TestGenerateTraces(t *testing.T) {
 			Method:       "GET",
 			Route:        "/test",
 		}
-		traces := GenerateTraces(span)
+		traces := GenerateTraces(span, &global.BuildInfo{}, attr.SemConvStable)
 
 		assert.Equal(t, 1, traces.ResourceSpans().Len())
 		assert.Equal(t, 1, traces.ResourceSpans().At(0).ScopeSpans().Len())
@@ -428,6 +430,69 @@ func TestGenerateTraces(t *testing.T) {
 	})
 }
 
+func TestGenerateTraces_BuildInfo(t *testing.T) {
+	span := &request.Span{Type: request.EventTypeHTTP, Method: "GET", Route: "/test", Status: 200}
+	traces := GenerateTraces(span, &global.BuildInfo{
+		Features:      []string{"application", "network"},
+		KernelRelease: "6.1.0-18-amd64",
+	}, attr.SemConvStable)
+
+	rs := traces.ResourceSpans().At(0)
+	attrs := rs.Resource().Attributes()
+	for key, expected := range map[string]string{
+		"telemetry.sdk.version": buildinfo.Version,
+		"beyla.revision":        buildinfo.Revision,
+		"beyla.features":        "application,network",
+		"beyla.kernel.release":  "6.1.0-18-amd64",
+	} {
+		val, ok := attrs.Get(key)
+		require.Truef(t, ok, "missing attribute %s", key)
+		assert.Equal(t, expected, val.Str())
+	}
+	_, ok := attrs.Get("beyla.go.version")
+	assert.True(t, ok)
+
+	scope := rs.ScopeSpans().At(0).Scope()
+	assert.Equal(t, reporterName, scope.Name())
+	assert.Equal(t, buildinfo.Version, scope.Version())
+}
+
+func TestGenerateTraces_SemConv(t *testing.T) {
+	span := &request.Span{Type: request.EventTypeHTTPClient, Method: "GET", Path: "http://foo/bar",
+		Status: 200, Host: "foo", HostPort: 8080, ContentLength: 123}
+	spanAttrs := func(conventions attr.SemConvStability) map[string]any {
+		traces := GenerateTraces(span, &global.BuildInfo{}, conventions)
+		return traces.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0).Attributes().AsRaw()
+	}
+	stable := map[string]any{
+		"http.request.method":       "GET",
+		"http.response.status_code": int64(200),
+		"url.full":                  "http://foo/bar",
+		"server.address":            "foo",
+		"server.port":               int64(8080),
+		"http.request.body.size":    int64(123),
+	}
+	old := map[string]any{
+		"http.method":                 "GET",
+		"http.status_code":            int64(200),
+		"http.url":                    "http://foo/bar",
+		"net.peer.name":               "foo",
+		"net.peer.port":               int64(8080),
+		"http.request_content_length": int64(123),
+	}
+	assert.Equal(t, stable, spanAttrs(""))
+	assert.Equal(t, stable, spanAttrs(attr.SemConvStable))
+	assert.Equal(t, old, spanAttrs(attr.SemConvOld))
+	both := spanAttrs(attr.SemConvBoth)
+	assert.Len(t, both, len(stable)+len(old))
+	for k, v := range stable {
+		assert.Equal(t, v, both[k], k)
+	}
+	for k, v := range old {
+		assert.Equal(t, v, both[k], k)
+	}
+}
+
 func TestAttrsToMap(t *testing.T) {
 	t.Run("test with string attribute", func(t *testing.T) {
 		attrs := []attribute.KeyValue{
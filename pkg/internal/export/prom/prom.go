@@ -6,6 +6,7 @@ import (
 	"runtime"
 	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/golang-lru/v2/expirable"
@@ -18,6 +19,7 @@ import (
 	"github.com/grafana/beyla/pkg/internal/export/metric"
 	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
 	"github.com/grafana/beyla/pkg/internal/export/otel"
+	"github.com/grafana/beyla/pkg/internal/loadshed"
 	"github.com/grafana/beyla/pkg/internal/pipe/global"
 	"github.com/grafana/beyla/pkg/internal/request"
 	"github.com/grafana/beyla/pkg/internal/svc"
@@ -45,6 +47,8 @@ const (
 	k8sStatefulSetName = "k8s_statefulset_name"
 	k8sReplicaSetName  = "k8s_replicaset_name"
 	k8sDaemonSetName   = "k8s_daemonset_name"
+	k8sJobName         = "k8s_job_name"
+	k8sCronJobName     = "k8s_cronjob_name"
 	k8sNodeName        = "k8s_node_name"
 	k8sPodUID          = "k8s_pod_uid"
 	k8sPodStartTime    = "k8s_pod_start_time"
@@ -85,6 +89,11 @@ var beylaInfoLabelNames = []string{LanguageLabel}
 type PrometheusConfig struct {
 	Port int    `yaml:"port" env:"BEYLA_PROMETHEUS_PORT"`
 	Path string `yaml:"path" env:"BEYLA_PROMETHEUS_PATH"`
+	// UnixSocket is the path of a Unix domain socket that serves the metrics, in addition to the port.
+	// If the port is 0, the metrics are only served from the socket.
+	UnixSocket string `yaml:"unix_socket" env:"BEYLA_PROMETHEUS_UNIX_SOCKET"`
+	// UnixSocketMode is the permissions of the Unix socket file
+	UnixSocketMode connector.FileMode `yaml:"unix_socket_mode" env:"BEYLA_PROMETHEUS_UNIX_SOCKET_MODE"`
 
 	// Deprecated. Going to be removed in Beyla 2.0. Use attributes.select instead
 	ReportTarget bool `yaml:"report_target" env:"BEYLA_METRICS_REPORT_TARGET"`
@@ -120,9 +129,15 @@ func (p PrometheusConfig) ServiceGraphMetricsEnabled() bool {
 	return slices.Contains(p.Features, otel.FeatureGraph)
 }
 
+// EndpointEnabled returns whether the metrics are served from a port or a Unix socket
+// nolint:gocritic
+func (p PrometheusConfig) EndpointEnabled() bool {
+	return p.Port != 0 || p.UnixSocket != ""
+}
+
 // nolint:gocritic
 func (p PrometheusConfig) Enabled() bool {
-	return (p.Port != 0 || p.Registry != nil) && (p.OTelMetricsEnabled() || p.SpanMetricsEnabled() || p.ServiceGraphMetricsEnabled())
+	return (p.EndpointEnabled() || p.Registry != nil) && (p.OTelMetricsEnabled() || p.SpanMetricsEnabled() || p.ServiceGraphMetricsEnabled())
 }
 
 type metricsReporter struct {
@@ -196,25 +211,30 @@ func newReporter(
 	groups := ctxInfo.MetricAttributeGroups
 	groups.Add(metric.GroupPrometheus)
 
-	attrsProvider, err := metric.NewAttrSelector(groups, selector)
+	attrsProvider, err := metric.NewAttrSelector(groups, selector, ctxInfo.MetricNamespaceLabels...)
 	if err != nil {
 		return nil, fmt.Errorf("selecting metrics attributes: %w", err)
 	}
 
+	semconv := ctxInfo.SemConv
+	// the attributes of each metric, named according to the semantic conventions
+	attrsFor := func(name metric.Name) []attr.Name {
+		return name.SemConvAttrs(semconv, attrsProvider.For(name))
+	}
 	attrHTTPDuration := metric.PrometheusGetters(request.SpanPromGetters,
-		attrsProvider.For(metric.HTTPServerDuration))
+		attrsFor(metric.HTTPServerDuration))
 	attrHTTPClientDuration := metric.PrometheusGetters(request.SpanPromGetters,
-		attrsProvider.For(metric.HTTPClientDuration))
+		attrsFor(metric.HTTPClientDuration))
 	attrHTTPRequestSize := metric.PrometheusGetters(request.SpanPromGetters,
-		attrsProvider.For(metric.HTTPServerRequestSize))
+		attrsFor(metric.HTTPServerRequestSize))
 	attrHTTPClientRequestSize := metric.PrometheusGetters(request.SpanPromGetters,
-		attrsProvider.For(metric.HTTPClientRequestSize))
+		attrsFor(metric.HTTPClientRequestSize))
 	attrGRPCDuration := metric.PrometheusGetters(request.SpanPromGetters,
-		attrsProvider.For(metric.RPCServerDuration))
+		attrsFor(metric.RPCServerDuration))
 	attrGRPCClientDuration := metric.PrometheusGetters(request.SpanPromGetters,
-		attrsProvider.For(metric.RPCClientDuration))
+		attrsFor(metric.RPCClientDuration))
 	attrSQLClientDuration := metric.PrometheusGetters(request.SpanPromGetters,
-		attrsProvider.For(metric.HTTPServerDuration))
+		attrsFor(metric.HTTPServerDuration))
 
 	// If service name is not explicitly set, we take the service name as set by the
 	// executable inspector
@@ -233,18 +253,20 @@ func newReporter(
 		beylaInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Name: BeylaBuildInfo,
 			Help: "A metric with a constant '1' value labeled by version, revision, branch, " +
-				"goversion from which Beyla was built, the goos and goarch for the build, and the" +
-				"language of the reported services",
+				"goversion from which Beyla was built, the goos and goarch for the build, the " +
+				"enabled features, the kernel release of the host, and the language of the reported services",
 			ConstLabels: map[string]string{
-				"goarch":    runtime.GOARCH,
-				"goos":      runtime.GOOS,
-				"goversion": runtime.Version(),
-				"version":   buildinfo.Version,
-				"revision":  buildinfo.Revision,
+				"goarch":         runtime.GOARCH,
+				"goos":           runtime.GOOS,
+				"goversion":      runtime.Version(),
+				"version":        buildinfo.Version,
+				"revision":       buildinfo.Revision,
+				"features":       strings.Join(ctxInfo.Build.Features, ","),
+				"kernel_release": ctxInfo.Build.KernelRelease,
 			},
 		}, beylaInfoLabelNames),
 		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
-			Name:                            metric.HTTPServerDuration.Prom,
+			Name:                            metric.HTTPServerDuration.SemConv(semconv).Prom,
 			Help:                            "duration of HTTP service calls from the server side, in seconds",
 			Buckets:                         cfg.Buckets.DurationHistogram,
 			NativeHistogramBucketFactor:     defaultHistogramBucketFactor,
@@ -252,7 +274,7 @@ func newReporter(
 			NativeHistogramMinResetDuration: defaultHistogramMinResetDuration,
 		}, labelNames(attrHTTPDuration)),
 		httpClientDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
-			Name:                            metric.HTTPClientDuration.Prom,
+			Name:                            metric.HTTPClientDuration.SemConv(semconv).Prom,
 			Help:                            "duration of HTTP service calls from the client side, in seconds",
 			Buckets:                         cfg.Buckets.DurationHistogram,
 			NativeHistogramBucketFactor:     defaultHistogramBucketFactor,
@@ -284,7 +306,7 @@ func newReporter(
 			NativeHistogramMinResetDuration: defaultHistogramMinResetDuration,
 		}, labelNames(attrSQLClientDuration)),
 		httpRequestSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
-			Name:                            metric.HTTPServerRequestSize.Prom,
+			Name:                            metric.HTTPServerRequestSize.SemConv(semconv).Prom,
 			Help:                            "size, in bytes, of the HTTP request body as received at the server side",
 			Buckets:                         cfg.Buckets.RequestSizeHistogram,
 			NativeHistogramBucketFactor:     defaultHistogramBucketFactor,
@@ -292,7 +314,7 @@ func newReporter(
 			NativeHistogramMinResetDuration: defaultHistogramMinResetDuration,
 		}, labelNames(attrHTTPRequestSize)),
 		httpClientRequestSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
-			Name:                            metric.HTTPClientRequestSize.Prom,
+			Name:                            metric.HTTPClientRequestSize.SemConv(semconv).Prom,
 			Help:                            "size, in bytes, of the HTTP request body as sent from the client side",
 			Buckets:                         cfg.Buckets.RequestSizeHistogram,
 			NativeHistogramBucketFactor:     defaultHistogramBucketFactor,
@@ -390,6 +412,9 @@ func newReporter(
 		mr.cfg.Registry.MustRegister(registeredMetrics...)
 	} else {
 		mr.promConnect.Register(cfg.Port, cfg.Path, registeredMetrics...)
+		if cfg.UnixSocket != "" {
+			mr.promConnect.UnixSocket(cfg.Port, cfg.UnixSocket, cfg.UnixSocketMode)
+		}
 	}
 
 	return mr, nil
@@ -412,22 +437,28 @@ func (r *metricsReporter) observe(span *request.Span) {
 	t := span.Timings()
 	r.beylaInfo.WithLabelValues(span.ServiceID.SDKLanguage.String()).Set(1.0)
 	duration := t.End.Sub(t.RequestStart).Seconds()
+	// the request body sizes are not recorded while Beyla sheds load
+	recordSize := !r.ctxInfo.AppO11y.LoadShedding.Shedding(loadshed.BodySize)
 	if r.cfg.OTelMetricsEnabled() {
 		switch span.Type {
 		case request.EventTypeHTTP:
 			r.httpDuration.WithLabelValues(
 				labelValues(span, r.attrHTTPDuration)...,
 			).Observe(duration)
-			r.httpRequestSize.WithLabelValues(
-				labelValues(span, r.attrHTTPRequestSize)...,
-			).Observe(float64(span.ContentLength))
+			if recordSize {
+				r.httpRequestSize.WithLabelValues(
+					labelValues(span, r.attrHTTPRequestSize)...,
+				).Observe(float64(span.ContentLength))
+			}
 		case request.EventTypeHTTPClient:
 			r.httpClientDuration.WithLabelValues(
 				labelValues(span, r.attrHTTPClientDuration)...,
 			).Observe(duration)
-			r.httpClientRequestSize.WithLabelValues(
-				labelValues(span, r.attrHTTPClientRequestSize)...,
-			).Observe(float64(span.ContentLength))
+			if recordSize {
+				r.httpClientRequestSize.WithLabelValues(
+					labelValues(span, r.attrHTTPClientRequestSize)...,
+				).Observe(float64(span.ContentLength))
+			}
 		case request.EventTypeGRPC:
 			r.grpcDuration.WithLabelValues(
 				labelValues(span, r.attrGRPCDuration)...,
@@ -446,7 +477,9 @@ func (r *metricsReporter) observe(span *request.Span) {
 		lv := r.labelValuesSpans(span)
 		r.spanMetricsLatency.WithLabelValues(lv...).Observe(duration)
 		r.spanMetricsCallsTotal.WithLabelValues(lv...).Add(1)
-		r.spanMetricsSizeTotal.WithLabelValues(lv...).Add(float64(span.ContentLength))
+		if recordSize {
+			r.spanMetricsSizeTotal.WithLabelValues(lv...).Add(float64(span.ContentLength))
+		}
 
 		_, ok := r.serviceCache.Get(span.ServiceID.UID)
 		if !ok {
@@ -472,7 +505,7 @@ func (r *metricsReporter) observe(span *request.Span) {
 
 func appendK8sLabelNames(names []string) []string {
 	names = append(names, k8sNamespaceName, k8sPodName, k8sNodeName, k8sPodUID, k8sPodStartTime,
-		k8sDeploymentName, k8sReplicaSetName, k8sStatefulSetName, k8sDaemonSetName)
+		k8sDeploymentName, k8sReplicaSetName, k8sStatefulSetName, k8sDaemonSetName, k8sJobName, k8sCronJobName)
 	return names
 }
 
@@ -488,6 +521,8 @@ func appendK8sLabelValuesService(values []string, service svc.ID) []string {
 		service.Metadata[(attr.K8sReplicaSetName)],
 		service.Metadata[(attr.K8sStatefulSetName)],
 		service.Metadata[(attr.K8sDaemonSetName)],
+		service.Metadata[(attr.K8sJobName)],
+		service.Metadata[(attr.K8sCronJobName)],
 	)
 	return values
 }
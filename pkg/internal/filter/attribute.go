@@ -1,7 +1,9 @@
 package filter
 
 import (
+	"errors"
 	"fmt"
+	"sync/atomic"
 
 	"github.com/gobwas/glob"
 	"github.com/mariomac/pipes/pipe"
@@ -23,18 +25,53 @@ type AttributeFamilyConfig map[string]MatchDefinition
 // ByAttribute provides a pipeline node that drops all the records of type T (*ebpf.Record, or *request.Span)
 // that do not match the provided AttributeFamilyConfig.
 func ByAttribute[T any](config AttributeFamilyConfig, getters metric.NamedGetters[T, string]) pipe.MiddleProvider[[]T, []T] {
-	return func() (pipe.MiddleFunc[[]T, []T], error) {
-		if len(config) == 0 {
-			// No filter configuration provided. The node will be ignored
-			// and bypassed by the Pipes library
-			return pipe.Bypass[[]T](), nil
-		}
-		f, err := newFilter(config, getters)
-		if err != nil {
-			return nil, err
+	return NewByAttribute(config, getters).Provide
+}
+
+// Attribute is a filter by attribute whose configuration can be updated at runtime.
+type Attribute[T any] struct {
+	config  AttributeFamilyConfig
+	getters metric.NamedGetters[T, string]
+	active  atomic.Pointer[filter[T]]
+}
+
+func NewByAttribute[T any](config AttributeFamilyConfig, getters metric.NamedGetters[T, string]) *Attribute[T] {
+	return &Attribute[T]{config: config, getters: getters}
+}
+
+// Provide the pipeline node of the filter
+func (a *Attribute[T]) Provide() (pipe.MiddleFunc[[]T, []T], error) {
+	if len(a.config) == 0 {
+		// No filter configuration provided. The node will be ignored
+		// and bypassed by the Pipes library
+		return pipe.Bypass[[]T](), nil
+	}
+	f, err := newFilter(a.config, a.getters)
+	if err != nil {
+		return nil, err
+	}
+	a.active.Store(f)
+	return func(in <-chan []T, out chan<- []T) {
+		for i := range in {
+			if i = a.active.Load().filterBatch(i); len(i) > 0 {
+				out <- i
+			}
 		}
-		return f.doFilter, nil
+	}, nil
+}
+
+// Update the configuration of a running filter. The filter must have been provided
+// with a non-empty configuration.
+func (a *Attribute[T]) Update(config AttributeFamilyConfig) error {
+	if a.active.Load() == nil {
+		return errors.New("attribute filter was not enabled at startup")
+	}
+	f, err := newFilter(config, a.getters)
+	if err != nil {
+		return err
 	}
+	a.active.Store(f)
+	return nil
 }
 
 type filter[T any] struct {
@@ -96,15 +133,6 @@ func buildMatcher[T any](getters metric.NamedGetters[T, string], attribute attr.
 	return m, nil
 }
 
-// main pipeline node loop
-func (f *filter[T]) doFilter(in <-chan []T, out chan<- []T) {
-	for i := range in {
-		if i = f.filterBatch(i); len(i) > 0 {
-			out <- i
-		}
-	}
-}
-
 // filterBatch removes from the input slice the records that do not match
 // the user-provided attribute matchers
 func (f *filter[T]) filterBatch(batch []T) []T {
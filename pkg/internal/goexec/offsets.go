@@ -11,6 +11,9 @@ type Offsets struct {
 	// Funcs key: function name
 	Funcs map[string]FuncOffsets
 	Field FieldOffsets
+	// FieldSources lists the sources that provided the field offsets (SourceDWARF, SourceExternal
+	// or SourceEmbedded). It is empty if no field offset could be resolved.
+	FieldSources []string
 }
 
 type FuncOffsets struct {
@@ -37,13 +40,14 @@ func InspectOffsets(execElf *exec.FileInfo, funcs []string) (*Offsets, error) {
 	}
 
 	// check the offsets of the required fields from the method arguments
-	structFieldOffsets, err := structMemberOffsets(execElf.ELF)
+	structFieldOffsets, sources, err := structMemberOffsets(execElf.ELF)
 	if err != nil {
 		return nil, fmt.Errorf("checking struct members in file %s: %w", execElf.ProExeLinkPath, err)
 	}
 
 	return &Offsets{
-		Funcs: found,
-		Field: structFieldOffsets,
+		Funcs:        found,
+		Field:        structFieldOffsets,
+		FieldSources: sources,
 	}, nil
 }
@@ -0,0 +1,136 @@
+package goexec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/grafana/go-offsets-tracker/pkg/offsets"
+)
+
+// Sources of the struct field offsets
+const (
+	SourceDWARF    = "dwarf"
+	SourceExternal = "external"
+	SourceEmbedded = "embedded"
+)
+
+const externalOffsetsTimeout = 30 * time.Second
+
+// externalOffsets augments or overrides the embedded offsets database. Nil if no external
+// offsets file has been loaded.
+var externalOffsets atomic.Pointer[offsets.Track]
+
+// WatchExternalOffsets loads the offsets database from the provided file path or HTTP(S) URL, and
+// reloads it each time Beyla receives the SIGHUP signal, until the context is canceled.
+// The external offsets take precedence over the offsets that are embedded in Beyla.
+// If the external offsets can't be loaded, the previously loaded offsets are kept.
+func WatchExternalOffsets(ctx context.Context, location string) {
+	llog := log().With("location", location)
+	if err := LoadExternalOffsets(ctx, location); err != nil {
+		llog.Error("can't load external Go offsets. Using the embedded offsets", "error", err)
+	} else {
+		llog.Info("external Go offsets loaded")
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				if err := LoadExternalOffsets(ctx, location); err != nil {
+					llog.Error("can't reload external Go offsets. Keeping the previous offsets", "error", err)
+				} else {
+					llog.Info("external Go offsets reloaded")
+				}
+			}
+		}
+	}()
+}
+
+// LoadExternalOffsets loads the offsets database from the provided file path or HTTP(S) URL.
+// It must follow the format of the github.com/grafana/go-offsets-tracker files. If the database
+// is malformed, it is rejected and the previously loaded offsets are kept.
+func LoadExternalOffsets(ctx context.Context, location string) error {
+	content, err := readLocation(ctx, location)
+	if err != nil {
+		return err
+	}
+	track, err := parseOffsets(content)
+	if err != nil {
+		return err
+	}
+	externalOffsets.Store(track)
+	return nil
+}
+
+func readLocation(ctx context.Context, location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		content, err := os.ReadFile(location)
+		if err != nil {
+			return nil, fmt.Errorf("reading offsets file: %w", err)
+		}
+		return content, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, externalOffsetsTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating offsets request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("downloading offsets: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading offsets: unexpected HTTP status %s", resp.Status)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("downloading offsets: %w", err)
+	}
+	return content, nil
+}
+
+// parseOffsets returns an error if the offsets database is malformed
+func parseOffsets(content []byte) (track *offsets.Track, err error) {
+	// the offsets library panics on wrongly formatted versions, as it expects
+	// the versions that are generated by itself
+	defer func() {
+		if r := recover(); r != nil {
+			track, err = nil, fmt.Errorf("invalid offsets file: %v", r)
+		}
+	}()
+	track, err = offsets.Read(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("invalid offsets file: %w", err)
+	}
+	if len(track.Data) == 0 {
+		return nil, errors.New("invalid offsets file: no offsets data")
+	}
+	for strName, str := range track.Data {
+		for fieldName, field := range str {
+			for _, offset := range field.Offsets {
+				// forces validating the versions of the offsets
+				field.GetOffset(offset.Since)
+			}
+			if len(field.Offsets) == 0 {
+				return nil, fmt.Errorf("invalid offsets file: no offsets for %s.%s", strName, fieldName)
+			}
+		}
+	}
+	return track, nil
+}
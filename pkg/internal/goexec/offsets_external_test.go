@@ -0,0 +1,83 @@
+package goexec
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const externalOffsetsJSON = `{
+  "data": {
+    "net/http.Request": {
+      "URL": {
+        "versions": {"oldest": "1.17.0", "newest": "1.99.0"},
+        "offsets": [{"offset": 999, "since": "1.17.0"}]
+      }
+    }
+  }
+}`
+
+func TestExternalOffsets(t *testing.T) {
+	t.Cleanup(func() { externalOffsets.Store(nil) })
+	file := path.Join(t.TempDir(), "offsets.json")
+	require.NoError(t, os.WriteFile(file, []byte(externalOffsetsJSON), 0o644))
+
+	// WHEN an external offsets file is loaded
+	require.NoError(t, LoadExternalOffsets(context.Background(), file))
+
+	// THEN its offsets override the embedded offsets
+	offsets, sources, err := structMemberOffsets(smallELF)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(999), offsets["url_ptr_pos"])
+	// AND the embedded offsets are used for the rest of fields
+	assert.Equal(t, uint64(56), offsets["path_ptr_pos"])
+	assert.Equal(t, []string{SourceExternal, SourceEmbedded}, sources)
+
+	// WHEN a malformed offsets file is loaded
+	for _, malformed := range []string{
+		`{"data": {`,
+		`{"data": {}}`,
+		`{"data": {"net/http.Request": {"URL": {"offsets": [{"offset": 1, "since": "latest"}]}}}}`,
+		`{"data": {"net/http.Request": {"URL": {"offsets": []}}}}`,
+	} {
+		require.NoError(t, os.WriteFile(file, []byte(malformed), 0o644))
+		// THEN it is rejected
+		require.Error(t, LoadExternalOffsets(context.Background(), file), malformed)
+	}
+	// AND the previous offsets are kept
+	offsets, _, err = structMemberOffsets(smallELF)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(999), offsets["url_ptr_pos"])
+}
+
+func TestExternalOffsets_URL(t *testing.T) {
+	t.Cleanup(func() { externalOffsets.Store(nil) })
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/offsets.json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(externalOffsetsJSON))
+	}))
+	defer server.Close()
+
+	require.Error(t, LoadExternalOffsets(context.Background(), server.URL+"/missing.json"))
+	assert.Nil(t, externalOffsets.Load())
+
+	require.NoError(t, LoadExternalOffsets(context.Background(), server.URL+"/offsets.json"))
+	offset, ok := externalOffsets.Load().Find("net/http.Request", "URL", "1.22.0")
+	require.True(t, ok)
+	assert.Equal(t, uint64(999), offset)
+}
+
+func TestEmbeddedOffsets(t *testing.T) {
+	_, sources, err := structMemberOffsets(smallELF)
+	require.NoError(t, err)
+	assert.Equal(t, []string{SourceEmbedded}, sources)
+}
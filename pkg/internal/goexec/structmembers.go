@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"log/slog"
 	"strings"
+	"sync"
 
 	"github.com/grafana/go-offsets-tracker/pkg/offsets"
 )
@@ -177,19 +178,26 @@ var structMembers = map[string]structInfo{
 	},
 }
 
-func structMemberOffsets(elfFile *elf.File) (FieldOffsets, error) {
+// structMemberOffsets returns the offsets of the struct fields, as well as the sources that provided
+// them: the DWARF info of the executable, the external offsets database or the embedded database.
+func structMemberOffsets(elfFile *elf.File) (FieldOffsets, []string, error) {
 	// first, try to read offsets from DWARF debug info
 	var offs FieldOffsets
 	var expected map[string]struct{}
+	var sources []string
 	dwarfData, err := elfFile.DWARF()
 	if err == nil {
 		offs, expected = structMemberOffsetsFromDwarf(dwarfData)
+		if len(offs) > 0 {
+			sources = append(sources, SourceDWARF)
+		}
 		if len(expected) > 0 {
 			log().Debug("Fields not found in the DWARF file", "fields", expected)
 		} else {
-			return offs, nil
+			return offs, sources, nil
 		}
-	} else {
+	}
+	if offs == nil {
 		// initialize empty offsets
 		offs = FieldOffsets{}
 	}
@@ -197,19 +205,32 @@ func structMemberOffsets(elfFile *elf.File) (FieldOffsets, error) {
 	log().Debug("Can't read all offsets from DWARF info. Checking in prefetched database")
 
 	// if it is not possible, query from prefetched offsets
-	return structMemberPreFetchedOffsets(elfFile, offs)
+	dbSources, err := structMemberPreFetchedOffsets(elfFile, offs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return offs, append(sources, dbSources...), nil
 }
 
-func structMemberPreFetchedOffsets(elfFile *elf.File, fieldOffsets FieldOffsets) (FieldOffsets, error) {
+var embeddedOffsets = sync.OnceValues(func() (*offsets.Track, error) {
+	return offsets.Read(bytes.NewBufferString(prefetchedOffsets))
+})
+
+// structMemberPreFetchedOffsets looks for the offsets of the fields that haven't been found in
+// the DWARF info, first in the external offsets database, if any, and then in the embedded database.
+// It returns the databases that provided any offset.
+func structMemberPreFetchedOffsets(elfFile *elf.File, fieldOffsets FieldOffsets) ([]string, error) {
 	log := log().With("function", "structMemberPreFetchedOffsets")
-	offs, err := offsets.Read(bytes.NewBufferString(prefetchedOffsets))
+	embedded, err := embeddedOffsets()
 	if err != nil {
 		return nil, fmt.Errorf("reading offsets file contents: %w", err)
 	}
+	external := externalOffsets.Load()
 	libVersions, err := findLibraryVersions(elfFile)
 	if err != nil {
 		return nil, fmt.Errorf("searching for library versions: %w", err)
 	}
+	usedSources := map[string]struct{}{}
 	// after putting the offsets.json in a Go structure, we search all the
 	// structMembers elements on it, to get the annotated offsets
 	for strName, strInfo := range structMembers {
@@ -227,18 +248,38 @@ func structMemberPreFetchedOffsets(elfFile *elf.File, fieldOffsets FieldOffsets)
 		}
 
 		for fieldName, constantName := range strInfo.fields {
-			// look the version of the required field in the offsets.json memory copy
-			offset, ok := offs.Find(strName, fieldName, version)
+			if _, ok := fieldOffsets[constantName]; ok {
+				// already found in the DWARF info
+				continue
+			}
+			// look the version of the required field in the external offsets and then in
+			// the offsets.json memory copy
+			source := SourceExternal
+			offset, ok := uint64(0), false
+			if external != nil {
+				offset, ok = external.Find(strName, fieldName, version)
+			}
+			if !ok {
+				source = SourceEmbedded
+				offset, ok = embedded.Find(strName, fieldName, version)
+			}
 			if !ok {
 				log.Debug("can't find offsets for field",
 					"lib", strInfo.lib, "name", strName, "field", fieldName, "version", version)
 				continue
 			}
-			log.Debug("found offset", "constantName", constantName, "offset", offset)
+			log.Debug("found offset", "constantName", constantName, "offset", offset, "source", source)
 			fieldOffsets[constantName] = offset
+			usedSources[source] = struct{}{}
+		}
+	}
+	var sources []string
+	for _, source := range []string{SourceExternal, SourceEmbedded} {
+		if _, ok := usedSources[source]; ok {
+			sources = append(sources, source)
 		}
 	}
-	return fieldOffsets, nil
+	return sources, nil
 }
 
 // structMemberOffsetsFromDwarf reads the executable dwarf information to get
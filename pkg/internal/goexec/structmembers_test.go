@@ -94,7 +94,7 @@ func TestGrpcOffsetsFromDwarf(t *testing.T) {
 }
 
 func TestGoOffsetsWithoutDwarf(t *testing.T) {
-	offsets, err := structMemberOffsets(smallELF)
+	offsets, _, err := structMemberOffsets(smallELF)
 	require.NoError(t, err)
 	// this test might fail if a future Go version updates the internal structure of the used structs.
 	mustMatch(t, FieldOffsets{
@@ -108,7 +108,7 @@ func TestGoOffsetsWithoutDwarf(t *testing.T) {
 }
 
 func TestGrpcOffsetsWithoutDwarf(t *testing.T) {
-	offsets, _ := structMemberOffsets(smallGRPCElf)
+	offsets, _, _ := structMemberOffsets(smallGRPCElf)
 	// this test might fail if a future Go gRPC version updates the internal structure of the used structs.
 	mustMatch(t, FieldOffsets{
 		"grpc_stream_st_ptr_pos":     uint64(8),
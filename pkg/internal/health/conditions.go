@@ -0,0 +1,134 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var timeNow = time.Now
+
+// Note is returned by the checks whose condition is met, to report a detail about it
+// in the response body. For example, that no process has been instrumented yet.
+type Note string
+
+func (n Note) Error() string {
+	return string(n)
+}
+
+// Status is a condition whose state is explicitly set by the component that owns it
+type Status struct {
+	mt  sync.Mutex
+	err error
+}
+
+// NewStatus returns a Status with the provided initial error. A nil error means
+// that the condition is met.
+func NewStatus(initial error) *Status {
+	return &Status{err: initial}
+}
+
+func (s *Status) Set(err error) {
+	s.mt.Lock()
+	defer s.mt.Unlock()
+	s.err = err
+}
+
+func (s *Status) Check(_ context.Context) error {
+	s.mt.Lock()
+	defer s.mt.Unlock()
+	return s.err
+}
+
+// Counter is a condition that is met as long as there is at least one
+// active instance of the counted resources (e.g. attached eBPF tracers)
+type Counter struct {
+	count atomic.Int64
+	// error reported when there are no active instances
+	zeroErr error
+}
+
+func NewCounter(zeroErr error) *Counter {
+	return &Counter{zeroErr: zeroErr}
+}
+
+func (c *Counter) Inc() {
+	c.count.Add(1)
+}
+
+func (c *Counter) Dec() {
+	c.count.Add(-1)
+}
+
+func (c *Counter) Check(_ context.Context) error {
+	if c.count.Load() <= 0 {
+		return c.zeroErr
+	}
+	return nil
+}
+
+// Watchdog detects deadlocks in the forwarding of data between pipeline stages: the
+// forwarding stage invokes Enter before sending data to the next stage and Exit after it.
+// The check fails if the data has not been accepted after the configured timeout.
+// A nil Watchdog is valid and does nothing.
+type Watchdog struct {
+	timeout time.Duration
+	// unix nanoseconds since the forwarding stage is blocked. Zero if it is not blocked.
+	blockedSince atomic.Int64
+}
+
+func (w *Watchdog) Enter() {
+	if w != nil {
+		w.blockedSince.Store(timeNow().UnixNano())
+	}
+}
+
+func (w *Watchdog) Exit() {
+	if w != nil {
+		w.blockedSince.Store(0)
+	}
+}
+
+func (w *Watchdog) Check(_ context.Context) error {
+	since := w.blockedSince.Load()
+	if since == 0 {
+		return nil
+	}
+	if blocked := timeNow().Sub(time.Unix(0, since)); blocked > w.timeout {
+		return fmt.Errorf("pipeline blocked for %s", blocked.Round(time.Second))
+	}
+	return nil
+}
+
+// UnixPrefix marks the addresses that are passed to Dial as Unix domain socket paths
+const UnixPrefix = "unix:"
+
+// Dial returns a check that succeeds if any of the provided TCP addresses accepts connections.
+// The addresses prefixed by UnixPrefix are dialed as Unix domain sockets.
+func Dial(addrs ...string) Check {
+	return func(ctx context.Context) error {
+		var errs []error
+		dialer := net.Dialer{}
+		for _, addr := range addrs {
+			network := "tcp"
+			if socket, ok := strings.CutPrefix(addr, UnixPrefix); ok {
+				network, addr = "unix", socket
+			}
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err == nil {
+				_ = conn.Close()
+				return nil
+			}
+			errs = append(errs, err)
+		}
+		if len(errs) == 0 {
+			return errors.New("no exporters configured")
+		}
+		return errors.Join(errs...)
+	}
+}
@@ -0,0 +1,183 @@
+// Package health provides the liveness and readiness reports of Beyla, which are
+// served through the /healthz and /readyz HTTP endpoints.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+)
+
+var errNotChecked = errors.New("not checked yet")
+
+func hlog() *slog.Logger {
+	return slog.With("component", "health.Reporter")
+}
+
+// Config for the liveness and readiness HTTP endpoints
+type Config struct {
+	// Port where the /healthz and /readyz endpoints are served. If unset, the endpoints
+	// are served from the internal metrics Prometheus port, if defined.
+	Port int `yaml:"port" env:"BEYLA_HEALTH_PORT"`
+	// CheckPeriod is the time between two consecutive evaluations of the liveness and readiness
+	// conditions. It also bounds the time that each condition can take to be evaluated.
+	CheckPeriod time.Duration `yaml:"check_period" env:"BEYLA_HEALTH_CHECK_PERIOD"`
+	// DeadlockTimeout is the maximum time that the processing pipeline can be blocked
+	// while forwarding data, before Beyla is reported as not alive.
+	DeadlockTimeout time.Duration `yaml:"deadlock_timeout" env:"BEYLA_HEALTH_DEADLOCK_TIMEOUT"`
+}
+
+// Check returns an error if the checked condition is failing
+type Check func(ctx context.Context) error
+
+type condition struct {
+	name  string
+	check Check
+	err   error
+}
+
+// Reporter periodically evaluates the liveness and readiness conditions that have been
+// registered by the diverse Beyla components, and reports them through HTTP.
+// A nil Reporter is valid and ignores any registered condition.
+type Reporter struct {
+	cfg *Config
+
+	mt        sync.RWMutex
+	liveness  []*condition
+	readiness []*condition
+}
+
+func NewReporter(cfg *Config) *Reporter {
+	return &Reporter{cfg: cfg}
+}
+
+// Liveness registers a condition that Beyla needs to meet to be considered alive.
+func (r *Reporter) Liveness(name string, check Check) {
+	if r == nil {
+		return
+	}
+	r.mt.Lock()
+	defer r.mt.Unlock()
+	r.liveness = append(r.liveness, &condition{name: name, check: check, err: errNotChecked})
+}
+
+// Readiness registers a condition that Beyla needs to meet to be considered ready.
+func (r *Reporter) Readiness(name string, check Check) {
+	if r == nil {
+		return
+	}
+	r.mt.Lock()
+	defer r.mt.Unlock()
+	r.readiness = append(r.readiness, &condition{name: name, check: check, err: errNotChecked})
+}
+
+// Watchdog returns a Watchdog that is registered as a liveness condition with the given name
+func (r *Reporter) Watchdog(name string) *Watchdog {
+	if r == nil {
+		return nil
+	}
+	w := &Watchdog{timeout: r.cfg.DeadlockTimeout}
+	r.Liveness(name, w.Check)
+	return w
+}
+
+// Start evaluating periodically the registered conditions, until the context is canceled.
+func (r *Reporter) Start(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.CheckPeriod)
+	defer ticker.Stop()
+	for {
+		r.evaluate(ctx)
+		select {
+		case <-ctx.Done():
+			hlog().Debug("context canceled. Stopping health checks")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// evaluate all the conditions concurrently, bounding their duration to the check period
+func (r *Reporter) evaluate(ctx context.Context) {
+	r.mt.RLock()
+	conditions := make([]*condition, 0, len(r.liveness)+len(r.readiness))
+	conditions = append(conditions, r.liveness...)
+	conditions = append(conditions, r.readiness...)
+	r.mt.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.CheckPeriod)
+	defer cancel()
+	results := make([]error, len(conditions))
+	wg := sync.WaitGroup{}
+	wg.Add(len(conditions))
+	for i, c := range conditions {
+		go func() {
+			defer wg.Done()
+			results[i] = c.check(ctx)
+		}()
+	}
+	wg.Wait()
+
+	r.mt.Lock()
+	defer r.mt.Unlock()
+	for i, c := range conditions {
+		if failing(results[i]) && !failing(c.err) {
+			hlog().Warn("health condition is failing", "condition", c.name, "error", results[i])
+		}
+		c.err = results[i]
+	}
+}
+
+// LivenessHandler reports the liveness conditions. It returns 503 if any of them is failing.
+func (r *Reporter) LivenessHandler() http.Handler {
+	return r.handler("healthz", func() []*condition { return r.liveness })
+}
+
+// ReadinessHandler reports the readiness conditions. It returns 503 if any of them is failing.
+func (r *Reporter) ReadinessHandler() http.Handler {
+	return r.handler("readyz", func() []*condition { return r.readiness })
+}
+
+func (r *Reporter) handler(name string, conditions func() []*condition) http.HandlerFunc {
+	return func(rw http.ResponseWriter, _ *http.Request) {
+		sb := strings.Builder{}
+		failed := false
+		r.mt.RLock()
+		for _, c := range conditions() {
+			var note Note
+			switch {
+			case failing(c.err):
+				failed = true
+				fmt.Fprintf(&sb, "[-]%s failed: %s\n", c.name, c.err)
+			case errors.As(c.err, &note):
+				fmt.Fprintf(&sb, "[+]%s ok: %s\n", c.name, note)
+			default:
+				fmt.Fprintf(&sb, "[+]%s ok\n", c.name)
+			}
+		}
+		r.mt.RUnlock()
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if failed {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(&sb, "%s check failed\n", name)
+		} else {
+			fmt.Fprintf(&sb, "%s check passed\n", name)
+		}
+		_, _ = rw.Write([]byte(sb.String()))
+	}
+}
+
+// failing returns true if the error of a check is not a Note
+func failing(err error) bool {
+	var note Note
+	return err != nil && !errors.As(err, &note)
+}
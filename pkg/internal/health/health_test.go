@@ -0,0 +1,149 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, handler http.Handler) (int, string) {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	return rec.Code, string(body)
+}
+
+func TestReporter(t *testing.T) {
+	r := NewReporter(&Config{CheckPeriod: 10 * time.Millisecond, DeadlockTimeout: time.Minute})
+	ebpf := NewCounter(errors.New("no eBPF programs attached"))
+	informers := NewStatus(nil)
+	r.Readiness("ebpf", ebpf.Check)
+	r.Readiness("kubernetes", informers.Check)
+	r.Watchdog("pipeline")
+
+	// conditions are failing until they are checked for the first time
+	code, body := get(t, r.ReadinessHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, "[-]ebpf failed: not checked yet\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Start(ctx)
+
+	// Liveness is reported independently of readiness
+	assert.Eventually(t, func() bool {
+		code, _ := get(t, r.LivenessHandler())
+		return code == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+	code, body = get(t, r.LivenessHandler())
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "[+]pipeline ok\nhealthz check passed\n", body)
+
+	// each readiness condition is individually reported
+	code, body = get(t, r.ReadinessHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "[-]ebpf failed: no eBPF programs attached\n[+]kubernetes ok\nreadyz check failed\n", body)
+
+	ebpf.Inc()
+	assert.Eventually(t, func() bool {
+		code, _ := get(t, r.ReadinessHandler())
+		return code == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+	_, body = get(t, r.ReadinessHandler())
+	assert.Equal(t, "[+]ebpf ok\n[+]kubernetes ok\nreadyz check passed\n", body)
+
+	// conditions failing after startup eventually flip the readiness
+	informers.Set(errors.New("kubernetes informer stopped"))
+	assert.Eventually(t, func() bool {
+		code, _ := get(t, r.ReadinessHandler())
+		return code == http.StatusServiceUnavailable
+	}, 5*time.Second, 10*time.Millisecond)
+	_, body = get(t, r.ReadinessHandler())
+	assert.Contains(t, body, "[-]kubernetes failed: kubernetes informer stopped\n")
+}
+
+func TestReporter_Notes(t *testing.T) {
+	r := NewReporter(&Config{CheckPeriod: 10 * time.Millisecond, DeadlockTimeout: time.Minute})
+	tracers := NewCounter(Note("no matching process yet"))
+	r.Readiness("ebpf", tracers.Check)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Start(ctx)
+
+	// conditions reporting a note are not failing, and the note is reported in the body
+	assert.Eventually(t, func() bool {
+		code, _ := get(t, r.ReadinessHandler())
+		return code == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+	_, body := get(t, r.ReadinessHandler())
+	assert.Equal(t, "[+]ebpf ok: no matching process yet\nreadyz check passed\n", body)
+
+	tracers.Inc()
+	assert.Eventually(t, func() bool {
+		_, body := get(t, r.ReadinessHandler())
+		return body == "[+]ebpf ok\nreadyz check passed\n"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestWatchdog(t *testing.T) {
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	w := &Watchdog{timeout: time.Minute}
+	require.NoError(t, w.Check(context.Background()))
+
+	w.Enter()
+	now = now.Add(30 * time.Second)
+	require.NoError(t, w.Check(context.Background()))
+
+	// blocked for longer than the timeout
+	now = now.Add(time.Minute)
+	require.Error(t, w.Check(context.Background()))
+
+	w.Exit()
+	require.NoError(t, w.Check(context.Background()))
+
+	// a nil watchdog can be safely invoked
+	var nilWatchdog *Watchdog
+	nilWatchdog.Enter()
+	nilWatchdog.Exit()
+}
+
+func TestDial(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := closed.Addr().String()
+	require.NoError(t, closed.Close())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, Dial(closedAddr, listener.Addr().String())(ctx))
+	assert.Error(t, Dial(closedAddr)(ctx))
+	assert.Error(t, Dial()(ctx))
+}
+
+func TestDial_UnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "metrics.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, Dial(UnixPrefix+socket)(ctx))
+	assert.Error(t, Dial(UnixPrefix+filepath.Join(t.TempDir(), "missing.sock"))(ctx))
+}
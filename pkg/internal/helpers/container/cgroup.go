@@ -0,0 +1,88 @@
+package container
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// recognizers of the container ID in the segments of the cgroup paths. When a cgroup path contains
+// multiple container IDs, because of nested container environments (for example, Kubernetes in Docker
+// or Docker in Docker), the innermost container ID is taken, as it belongs to the container that
+// is actually running the process.
+// Examples of cgroup entries for each recognizer:
+//
+//	systemd driver, cgroup v1 and v2:
+//	  docker:     0::/system.slice/docker-<id>.scope
+//	  containerd: 0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod<uid>.slice/cri-containerd-<id>.scope
+//	  cri-o:      0::/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod<uid>.slice/crio-<id>.scope/container
+//	  podman:     0::/user.slice/user-1000.slice/user@1000.service/user.slice/libpod-<id>.scope/container
+//	  kind:       0::/kubelet.slice/kubelet-kubepods.slice/kubelet-kubepods-besteffort.slice/kubelet-kubepods-besteffort-pod<uid>.slice/cri-containerd-<id>.scope
+//	cgroupfs driver with runtime prefix, cgroup v1 and v2:
+//	  cri-o:      9:memory:/kubepods/besteffort/pod<uid>/crio-<id>
+//	  podman:     0::/machine.slice/libpod-<id>
+//	cgroupfs driver, cgroup v1 and v2:
+//	  docker:     4:pids:/docker/<id>
+//	  containerd: 0::/kubepods/burstable/pod<uid>/<id>
+//	  kata:       0::/kubepods/besteffort/pod<uid>/kata_<sandbox>/<id>
+//	nested:
+//	  kind:       0::/docker/<node id>/kubepods/besteffort/pod<uid>/<id>
+//	  dind:       0::/system.slice/docker-<runner id>.scope/docker/<id>
+var recognizers = []*regexp.Regexp{
+	regexp.MustCompile(`^(?:docker|cri-containerd|cri-dockerd|crio|libpod)-([0-9a-f]{64})\.scope$`),
+	regexp.MustCompile(`^(?:docker|cri-containerd|crio|libpod)-([0-9a-f]{64})$`),
+	regexp.MustCompile(`^([0-9a-f]{64})$`),
+}
+
+// cgroupEntry is a line from the /proc/<pid>/cgroup file, with the format
+// hierarchy-ID:controller-list:cgroup-path
+type cgroupEntry struct {
+	unified bool
+	path    string
+	raw     string
+}
+
+// parseCgroups returns the entries of a /proc/<pid>/cgroup file whose path can contain the
+// container ID. In hybrid hierarchies, if the process belongs to a cgroup in the unified (v2)
+// hierarchy, only the unified entries are returned, as the v1 hierarchies might refer to an
+// outer container (for example, the Docker container of a Kubernetes in Docker node).
+func parseCgroups(content []byte) []cgroupEntry {
+	var entries []cgroupEntry
+	inUnified := false
+	for _, line := range bytes.Split(content, []byte{'\n'}) {
+		fields := strings.SplitN(string(line), ":", 3)
+		if len(fields) < 3 {
+			continue
+		}
+		entry := cgroupEntry{unified: fields[0] == "0" && fields[1] == "", path: fields[2], raw: string(line)}
+		if entry.unified && entry.path != "/" {
+			inUnified = true
+		}
+		entries = append(entries, entry)
+	}
+	if !inUnified {
+		return entries
+	}
+	unified := entries[:0]
+	for _, entry := range entries {
+		if entry.unified {
+			unified = append(unified, entry)
+		}
+	}
+	return unified
+}
+
+// containerIDFrom returns the innermost container ID from the first cgroup entry that contains any.
+func containerIDFrom(entries []cgroupEntry) (string, bool) {
+	for _, entry := range entries {
+		segments := strings.Split(entry.path, "/")
+		for i := len(segments) - 1; i >= 0; i-- {
+			for _, r := range recognizers {
+				if sm := r.FindStringSubmatch(segments[i]); len(sm) > 1 {
+					return sm[1], true
+				}
+			}
+		}
+	}
+	return "", false
+}
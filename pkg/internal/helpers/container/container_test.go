@@ -30,7 +30,6 @@ var fixturesWithContainer = map[uint32]string{
 1:name=systemd:/docker/a2ffe0e97ac22657a2a023ad628e9df837c38a03b1ebc904d3f6d644eb1a1a81
 0::/system.slice/containerd.service`,
 	789: `0::/../cri-containerd-40c03570b6f4c30bc8d69923d37ee698f5cfcced92c7b7df1c47f6f7887378a9.scope`,
-	999: `0::/system.slice/docker-40c03570b6f4c30bc8d69923d37ee698f5cfcced92c7b7df1c47f6f7887378a9.scope/kubepods/burstable/podc55ba69a-e39f-44af-925d-c4794fd57878/264c1e319d1f6080a48a9fabcf9ac8fd9afd9a5930cf35e8d0eeb03b258c3152`,
 	// GKE cgroup entry
 	589: `0::/kubepods/burstable/pod4a163a05-439d-484b-8e53-2968bc15824f/40c03570b6f4c30bc8d69923d37ee698f5cfcced92c7b7df1c47f6f7887378a9`,
 	// GKE-containerd cgroup entry
@@ -93,3 +92,256 @@ func TestContainerID(t *testing.T) {
 	require.Error(t, err)
 
 }
+
+// corpus of /proc/<pid>/cgroup contents from different container runtimes, cgroup drivers and
+// cgroup versions
+var cgroupFormats = []struct {
+	name     string
+	cgroup   string
+	expectID string
+}{{
+	name: "docker, cgroupfs driver, cgroup v1",
+	cgroup: `12:hugetlb:/docker/3ad1b1d1e4d7a7f1a57c5de82a6f0e1c2f5b5e9b4c2d7a3e8f6b1c0d9e8f7a6b
+11:memory:/docker/3ad1b1d1e4d7a7f1a57c5de82a6f0e1c2f5b5e9b4c2d7a3e8f6b1c0d9e8f7a6b
+10:cpu,cpuacct:/docker/3ad1b1d1e4d7a7f1a57c5de82a6f0e1c2f5b5e9b4c2d7a3e8f6b1c0d9e8f7a6b
+9:pids:/docker/3ad1b1d1e4d7a7f1a57c5de82a6f0e1c2f5b5e9b4c2d7a3e8f6b1c0d9e8f7a6b
+1:name=systemd:/docker/3ad1b1d1e4d7a7f1a57c5de82a6f0e1c2f5b5e9b4c2d7a3e8f6b1c0d9e8f7a6b`,
+	expectID: "3ad1b1d1e4d7a7f1a57c5de82a6f0e1c2f5b5e9b4c2d7a3e8f6b1c0d9e8f7a6b",
+}, {
+	name: "docker, systemd driver, cgroup v1",
+	cgroup: `11:memory:/system.slice/docker-9c5b8f2fd1d64ee0b3a4c0b6c8c7de1f9e2a8a1b0c5d4e3f2a1b0c9d8e7f6a5b.scope
+10:cpu,cpuacct:/system.slice/docker-9c5b8f2fd1d64ee0b3a4c0b6c8c7de1f9e2a8a1b0c5d4e3f2a1b0c9d8e7f6a5b.scope
+1:name=systemd:/system.slice/docker-9c5b8f2fd1d64ee0b3a4c0b6c8c7de1f9e2a8a1b0c5d4e3f2a1b0c9d8e7f6a5b.scope
+0::/`,
+	expectID: "9c5b8f2fd1d64ee0b3a4c0b6c8c7de1f9e2a8a1b0c5d4e3f2a1b0c9d8e7f6a5b",
+}, {
+	name:     "docker, systemd driver, cgroup v2",
+	cgroup:   `0::/system.slice/docker-9c5b8f2fd1d64ee0b3a4c0b6c8c7de1f9e2a8a1b0c5d4e3f2a1b0c9d8e7f6a5b.scope`,
+	expectID: "9c5b8f2fd1d64ee0b3a4c0b6c8c7de1f9e2a8a1b0c5d4e3f2a1b0c9d8e7f6a5b",
+}, {
+	name:     "docker, cgroupfs driver, cgroup v2",
+	cgroup:   `0::/docker/3ad1b1d1e4d7a7f1a57c5de82a6f0e1c2f5b5e9b4c2d7a3e8f6b1c0d9e8f7a6b`,
+	expectID: "3ad1b1d1e4d7a7f1a57c5de82a6f0e1c2f5b5e9b4c2d7a3e8f6b1c0d9e8f7a6b",
+}, {
+	name: "containerd, cgroupfs driver, cgroup v1",
+	cgroup: `12:memory:/kubepods/besteffort/pod0d3ae6a1-4c52-4b8f-9d55-6f1e2c3b4a59/5f8e3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f
+11:pids:/kubepods/besteffort/pod0d3ae6a1-4c52-4b8f-9d55-6f1e2c3b4a59/5f8e3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f
+1:name=systemd:/kubepods/besteffort/pod0d3ae6a1-4c52-4b8f-9d55-6f1e2c3b4a59/5f8e3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f`,
+	expectID: "5f8e3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f",
+}, {
+	name: "containerd, systemd driver, cgroup v1",
+	cgroup: `11:memory:/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0d3ae6a1_4c52_4b8f_9d55_6f1e2c3b4a59.slice/cri-containerd-5f8e3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f.scope
+1:name=systemd:/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0d3ae6a1_4c52_4b8f_9d55_6f1e2c3b4a59.slice/cri-containerd-5f8e3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f.scope
+0::/`,
+	expectID: "5f8e3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f",
+}, {
+	name:     "containerd, cgroupfs driver, cgroup v2",
+	cgroup:   `0::/kubepods/burstable/pod0d3ae6a1-4c52-4b8f-9d55-6f1e2c3b4a59/5f8e3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f`,
+	expectID: "5f8e3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f",
+}, {
+	name: "cri-o, systemd driver, cgroup v1",
+	cgroup: `11:memory:/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod7e1b5c3a_2d4f_4a6b_8c9d_0e1f2a3b4c5d.slice/crio-b8f2c6e4a1d3579bdf13579bdf2468ace02468ace13579bdf02468ace13579bd.scope
+1:name=systemd:/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod7e1b5c3a_2d4f_4a6b_8c9d_0e1f2a3b4c5d.slice/crio-b8f2c6e4a1d3579bdf13579bdf2468ace02468ace13579bdf02468ace13579bd.scope`,
+	expectID: "b8f2c6e4a1d3579bdf13579bdf2468ace02468ace13579bdf02468ace13579bd",
+}, {
+	name:     "cri-o, systemd driver, cgroup v2 with conmon",
+	cgroup:   `0::/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod7e1b5c3a_2d4f_4a6b_8c9d_0e1f2a3b4c5d.slice/crio-b8f2c6e4a1d3579bdf13579bdf2468ace02468ace13579bdf02468ace13579bd.scope/container`,
+	expectID: "b8f2c6e4a1d3579bdf13579bdf2468ace02468ace13579bdf02468ace13579bd",
+}, {
+	name:   "cri-o, conmon process is not a container",
+	cgroup: `0::/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod7e1b5c3a_2d4f_4a6b_8c9d_0e1f2a3b4c5d.slice/crio-conmon-b8f2c6e4a1d3579bdf13579bdf2468ace02468ace13579bdf02468ace13579bd.scope`,
+}, {
+	name:     "cri-o, cgroupfs driver, cgroup v1",
+	cgroup:   `9:memory:/kubepods/besteffort/pod7e1b5c3a-2d4f-4a6b-8c9d-0e1f2a3b4c5d/crio-b8f2c6e4a1d3579bdf13579bdf2468ace02468ace13579bdf02468ace13579bd`,
+	expectID: "b8f2c6e4a1d3579bdf13579bdf2468ace02468ace13579bdf02468ace13579bd",
+}, {
+	name:     "podman, systemd driver, rootless cgroup v2",
+	cgroup:   `0::/user.slice/user-1000.slice/user@1000.service/user.slice/libpod-e4a7d2c9b1f3058a6c2e4b8d0f1a3c5e7092b4d6f8a1c3e5072b4d6f8a0c2e4b.scope/container`,
+	expectID: "e4a7d2c9b1f3058a6c2e4b8d0f1a3c5e7092b4d6f8a1c3e5072b4d6f8a0c2e4b",
+}, {
+	name:     "podman, cgroupfs driver, cgroup v2",
+	cgroup:   `0::/machine.slice/libpod-e4a7d2c9b1f3058a6c2e4b8d0f1a3c5e7092b4d6f8a1c3e5072b4d6f8a0c2e4b`,
+	expectID: "e4a7d2c9b1f3058a6c2e4b8d0f1a3c5e7092b4d6f8a1c3e5072b4d6f8a0c2e4b",
+}, {
+	name:     "podman, cgroupfs driver, cgroup v1",
+	cgroup:   `4:pids:/libpod_parent/libpod-e4a7d2c9b1f3058a6c2e4b8d0f1a3c5e7092b4d6f8a1c3e5072b4d6f8a0c2e4b`,
+	expectID: "e4a7d2c9b1f3058a6c2e4b8d0f1a3c5e7092b4d6f8a1c3e5072b4d6f8a0c2e4b",
+}, {
+	name:     "kind, nested systemd hierarchy",
+	cgroup:   `0::/kubelet.slice/kubelet-kubepods.slice/kubelet-kubepods-besteffort.slice/kubelet-kubepods-besteffort-pod2f6b1e3c_9a4d_4c7e_8b5f_1d2e3f4a5b6c.slice/cri-containerd-c1d2e3f4a5b6c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2.scope`,
+	expectID: "c1d2e3f4a5b6c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2",
+}, {
+	name: "kind, hybrid hierarchy where v1 refers to the node container",
+	cgroup: `11:memory:/docker/3ad1b1d1e4d7a7f1a57c5de82a6f0e1c2f5b5e9b4c2d7a3e8f6b1c0d9e8f7a6b
+1:name=systemd:/docker/3ad1b1d1e4d7a7f1a57c5de82a6f0e1c2f5b5e9b4c2d7a3e8f6b1c0d9e8f7a6b
+0::/kubelet.slice/kubelet-kubepods.slice/kubelet-kubepods-burstable.slice/kubelet-kubepods-burstable-pod2f6b1e3c_9a4d_4c7e_8b5f_1d2e3f4a5b6c.slice/cri-containerd-c1d2e3f4a5b6c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2.scope`,
+	expectID: "c1d2e3f4a5b6c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2",
+}, {
+	name:     "kata, nested sandbox hierarchy",
+	cgroup:   `0::/kubepods/besteffort/pod4b3c2d1e-0f9a-4b8c-7d6e-5f4a3b2c1d0e/kata_8a7b6c5d4e3f2a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a3b2c1d0e9f8a7b/0a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f0a1b`,
+	expectID: "0a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f0a1b",
+}, {
+	name: "systemd service on the host",
+	cgroup: `1:name=systemd:/system.slice/sshd.service
+0::/system.slice/sshd.service`,
+}, {
+	name:   "root cgroup",
+	cgroup: `0::/`,
+}}
+
+// cgroup entries captured from nested container environments, where the cgroup path contains the IDs
+// of both the outer and the inner containers
+var nestedCgroups = []struct {
+	name     string
+	cgroup   string
+	expectID string
+}{{
+	name: "kind node on a cgroup v1 host, systemd driver",
+	cgroup: `12:pids:/docker/8afe480d66074930353da456a1344caca810fe31c1e31f6e08c95a66887235d6/kubelet.slice/kubelet-kubepods.slice/kubelet-kubepods-besteffort.slice/kubelet-kubepods-besteffort-pod44c76ce5_f953_4bd3_bc89_12621681af49.slice/cri-containerd-40c03570b6f4c30bc8d69923d37ee698f5cfcced92c7b7df1c47f6f7887378a9.scope
+11:memory:/docker/8afe480d66074930353da456a1344caca810fe31c1e31f6e08c95a66887235d6/kubelet.slice/kubelet-kubepods.slice/kubelet-kubepods-besteffort.slice/kubelet-kubepods-besteffort-pod44c76ce5_f953_4bd3_bc89_12621681af49.slice/cri-containerd-40c03570b6f4c30bc8d69923d37ee698f5cfcced92c7b7df1c47f6f7887378a9.scope
+1:name=systemd:/docker/8afe480d66074930353da456a1344caca810fe31c1e31f6e08c95a66887235d6/kubelet.slice/kubelet-kubepods.slice/kubelet-kubepods-besteffort.slice/kubelet-kubepods-besteffort-pod44c76ce5_f953_4bd3_bc89_12621681af49.slice/cri-containerd-40c03570b6f4c30bc8d69923d37ee698f5cfcced92c7b7df1c47f6f7887378a9.scope
+0::/docker/8afe480d66074930353da456a1344caca810fe31c1e31f6e08c95a66887235d6/kubelet.slice/kubelet-kubepods.slice/kubelet-kubepods-besteffort.slice/kubelet-kubepods-besteffort-pod44c76ce5_f953_4bd3_bc89_12621681af49.slice/cri-containerd-40c03570b6f4c30bc8d69923d37ee698f5cfcced92c7b7df1c47f6f7887378a9.scope`,
+	expectID: "40c03570b6f4c30bc8d69923d37ee698f5cfcced92c7b7df1c47f6f7887378a9",
+}, {
+	name:     "kind node without cgroup namespace, cgroupfs driver",
+	cgroup:   `0::/docker/8afe480d66074930353da456a1344caca810fe31c1e31f6e08c95a66887235d6/kubepods/besteffort/pod44c76ce5-f953-4bd3-bc89-12621681af49/40c03570b6f4c30bc8d69923d37ee698f5cfcced92c7b7df1c47f6f7887378a9`,
+	expectID: "40c03570b6f4c30bc8d69923d37ee698f5cfcced92c7b7df1c47f6f7887378a9",
+}, {
+	name:     "Kubernetes in a Docker container with systemd driver",
+	cgroup:   `0::/system.slice/docker-40c03570b6f4c30bc8d69923d37ee698f5cfcced92c7b7df1c47f6f7887378a9.scope/kubepods/burstable/podc55ba69a-e39f-44af-925d-c4794fd57878/264c1e319d1f6080a48a9fabcf9ac8fd9afd9a5930cf35e8d0eeb03b258c3152`,
+	expectID: "264c1e319d1f6080a48a9fabcf9ac8fd9afd9a5930cf35e8d0eeb03b258c3152",
+}, {
+	name:     "Docker in Docker runner",
+	cgroup:   `0::/system.slice/docker-3ad1b1d1e4d7a7f1a57c5de82a6f0e1c2f5b5e9b4c2d7a3e8f6b1c0d9e8f7a6b.scope/docker/264c1e319d1f6080a48a9fabcf9ac8fd9afd9a5930cf35e8d0eeb03b258c3152`,
+	expectID: "264c1e319d1f6080a48a9fabcf9ac8fd9afd9a5930cf35e8d0eeb03b258c3152",
+}, {
+	name:     "Docker in Docker runner pod",
+	cgroup:   `0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-podc55ba69a_e39f_44af_925d_c4794fd57878.slice/cri-containerd-3ad1b1d1e4d7a7f1a57c5de82a6f0e1c2f5b5e9b4c2d7a3e8f6b1c0d9e8f7a6b.scope/docker/264c1e319d1f6080a48a9fabcf9ac8fd9afd9a5930cf35e8d0eeb03b258c3152`,
+	expectID: "264c1e319d1f6080a48a9fabcf9ac8fd9afd9a5930cf35e8d0eeb03b258c3152",
+}}
+
+func TestContainerID_Nested(t *testing.T) {
+	for _, tc := range nestedCgroups {
+		t.Run(tc.name, func(t *testing.T) {
+			id, ok := IDFromCgroup([]byte(tc.cgroup))
+			assert.True(t, ok)
+			assert.Equal(t, tc.expectID, id)
+		})
+	}
+}
+
+func TestContainerID_Formats(t *testing.T) {
+	for _, tc := range cgroupFormats {
+		t.Run(tc.name, func(t *testing.T) {
+			id, ok := containerIDFrom(parseCgroups([]byte(tc.cgroup)))
+			assert.Equal(t, tc.expectID != "", ok)
+			assert.Equal(t, tc.expectID, id)
+		})
+	}
+}
+
+func TestStartTime(t *testing.T) {
+	dir := t.TempDir()
+	origProcRoot := procRoot
+	procRoot = dir + "/"
+	defer func() { procRoot = origProcRoot }()
+	require.NoError(t, os.Mkdir(dir+"/33", 0777))
+	// the command name can contain spaces and parentheses
+	require.NoError(t, os.WriteFile(dir+"/33/stat", []byte(
+		"33 (my (weird) cmd) S 1 33 33 0 -1 4194560 1120 0 0 0 3 1 0 0 20 0 1 0 123456 12345678 1234 "+
+			"18446744073709551615 1 1 0 0 0 0 0 0 0 0 0 0 17 2 0 0 0 0 0\n"), 0666))
+
+	start, err := StartTime(33)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(123456), start)
+
+	_, err = StartTime(34)
+	require.Error(t, err)
+}
+
+// corpus of /proc/<pid>/mountinfo contents, whose container ID is looked up when the cgroup is not informative
+var mountinfoFormats = []struct {
+	name      string
+	mountinfo string
+	expectID  string
+}{{
+	name: "docker",
+	mountinfo: `1187 1025 0:139 / / rw,relatime master:394 - overlay overlay rw,lowerdir=/var/lib/docker/overlay2/l/TRDWKUCQNU6ZF4XJ3YZC4DVQ7N,upperdir=/var/lib/docker/overlay2/9f6f5cc1f6d0e5d3c1b5a4e7b7d9b0a1c2e3f4a5b6c7d8e9f0a1b2c3d4e5f6a7/diff
+1188 1187 0:142 / /proc rw,nosuid,nodev,noexec,relatime - proc proc rw
+1210 1187 259:2 /var/lib/docker/containers/3ad1b1d1e4d7a7f1a57c5de82a6f0e1c2f5b5e9b4c2d7a3e8f6b1c0d9e8f7a6b/resolv.conf /etc/resolv.conf rw,relatime - ext4 /dev/nvme0n1p2 rw
+1211 1187 259:2 /var/lib/docker/containers/3ad1b1d1e4d7a7f1a57c5de82a6f0e1c2f5b5e9b4c2d7a3e8f6b1c0d9e8f7a6b/hostname /etc/hostname rw,relatime - ext4 /dev/nvme0n1p2 rw
+1212 1187 259:2 /var/lib/docker/containers/3ad1b1d1e4d7a7f1a57c5de82a6f0e1c2f5b5e9b4c2d7a3e8f6b1c0d9e8f7a6b/hosts /etc/hosts rw,relatime - ext4 /dev/nvme0n1p2 rw`,
+	expectID: "3ad1b1d1e4d7a7f1a57c5de82a6f0e1c2f5b5e9b4c2d7a3e8f6b1c0d9e8f7a6b",
+}, {
+	name: "docker, with /var in its own partition",
+	mountinfo: `1187 1025 0:139 / / rw,relatime master:394 - overlay overlay rw
+1211 1187 253:1 /lib/docker/containers/3ad1b1d1e4d7a7f1a57c5de82a6f0e1c2f5b5e9b4c2d7a3e8f6b1c0d9e8f7a6b/hostname /etc/hostname rw,relatime - xfs /dev/mapper/vg-var rw`,
+	expectID: "3ad1b1d1e4d7a7f1a57c5de82a6f0e1c2f5b5e9b4c2d7a3e8f6b1c0d9e8f7a6b",
+}, {
+	name: "podman",
+	mountinfo: `611 540 0:55 / / rw,relatime - overlay overlay rw
+632 611 0:26 /containers/storage/overlay-containers/e4a7d2c9b1f3058a6c2e4b8d0f1a3c5e7092b4d6f8a1c3e5072b4d6f8a0c2e4b/userdata/hostname /etc/hostname rw,nosuid,nodev - tmpfs tmpfs rw,mode=755
+633 611 0:26 /containers/storage/overlay-containers/e4a7d2c9b1f3058a6c2e4b8d0f1a3c5e7092b4d6f8a1c3e5072b4d6f8a0c2e4b/userdata/hosts /etc/hosts rw,nosuid,nodev - tmpfs tmpfs rw,mode=755`,
+	expectID: "e4a7d2c9b1f3058a6c2e4b8d0f1a3c5e7092b4d6f8a1c3e5072b4d6f8a0c2e4b",
+}, {
+	name: "containerd, whose mounts refer to the pod and its sandbox",
+	mountinfo: `2303 2211 0:361 / / rw,relatime master:712 - overlay overlay rw
+2312 2303 259:1 /var/lib/kubelet/pods/0d3ae6a1-4c52-4b8f-9d55-6f1e2c3b4a59/etc-hosts /etc/hosts rw,relatime - ext4 /dev/root rw
+2314 2303 259:1 /var/lib/containerd/io.containerd.grpc.v1.cri/sandboxes/8a7b6c5d4e3f2a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a3b2c1d0e9f8a7b/hostname /etc/hostname rw,relatime - ext4 /dev/root rw
+2315 2303 259:1 /var/lib/containerd/io.containerd.grpc.v1.cri/sandboxes/8a7b6c5d4e3f2a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a3b2c1d0e9f8a7b/resolv.conf /etc/resolv.conf rw,relatime - ext4 /dev/root rw`,
+}, {
+	name: "mounts of different containers",
+	mountinfo: `1211 1187 259:2 /var/lib/docker/containers/3ad1b1d1e4d7a7f1a57c5de82a6f0e1c2f5b5e9b4c2d7a3e8f6b1c0d9e8f7a6b/hostname /etc/hostname rw,relatime - ext4 /dev/nvme0n1p2 rw
+1212 1187 259:2 /var/lib/docker/containers/264c1e319d1f6080a48a9fabcf9ac8fd9afd9a5930cf35e8d0eeb03b258c3152/hosts /etc/hosts rw,relatime - ext4 /dev/nvme0n1p2 rw`,
+}, {
+	name:      "container file mounted elsewhere",
+	mountinfo: `1211 1187 259:2 /var/lib/docker/containers/3ad1b1d1e4d7a7f1a57c5de82a6f0e1c2f5b5e9b4c2d7a3e8f6b1c0d9e8f7a6b/hostname /mnt/hostname rw,relatime - ext4 /dev/nvme0n1p2 rw`,
+}, {
+	name: "host process",
+	mountinfo: `22 1 259:2 / / rw,relatime shared:1 - ext4 /dev/nvme0n1p2 rw
+23 22 0:21 / /proc rw,nosuid,nodev,noexec,relatime shared:12 - proc proc rw`,
+}, {
+	name:      "truncated lines",
+	mountinfo: "1211 1187 259:2\n\n",
+}}
+
+func TestContainerIDFromMounts(t *testing.T) {
+	for _, tc := range mountinfoFormats {
+		t.Run(tc.name, func(t *testing.T) {
+			id, ok := containerIDFromMounts([]byte(tc.mountinfo))
+			assert.Equal(t, tc.expectID != "", ok)
+			assert.Equal(t, tc.expectID, id)
+		})
+	}
+}
+
+func TestContainerID_MountsFallback(t *testing.T) {
+	dir := t.TempDir()
+	origProcRoot, origNamespaceFinder := procRoot, namespaceFinder
+	t.Cleanup(func() { procRoot, namespaceFinder = origProcRoot, origNamespaceFinder })
+	procRoot = dir + "/"
+	namespaceFinder = func(_ int32) (uint32, error) { return 7, nil }
+
+	// GIVEN a process in a private cgroup namespace, whose cgroup path does not contain the container ID
+	require.NoError(t, os.Mkdir(dir+"/33", 0777))
+	require.NoError(t, os.WriteFile(dir+"/33/cgroup", []byte("0::/\n"), 0666))
+	// WHEN its mounts don't reveal the container ID either
+	require.NoError(t, os.WriteFile(dir+"/33/mountinfo", []byte(mountinfoFormats[len(mountinfoFormats)-2].mountinfo), 0666))
+	// THEN no container is found
+	_, err := InfoForPID(33)
+	require.ErrorIs(t, err, ErrNoContainer)
+
+	// AND WHEN its mounts come from the storage of its container
+	require.NoError(t, os.WriteFile(dir+"/33/mountinfo", []byte(mountinfoFormats[0].mountinfo), 0666))
+	// THEN the container is found from the mounts
+	info, err := InfoForPID(33)
+	require.NoError(t, err)
+	assert.Equal(t, Info{ContainerID: mountinfoFormats[0].expectID, PIDNamespace: 7}, info)
+
+	// AND the cgroup takes precedence over the mounts
+	require.NoError(t, os.WriteFile(dir+"/33/cgroup", []byte(cgroupFormats[0].cgroup), 0666))
+	require.NoError(t, os.WriteFile(dir+"/33/mountinfo", []byte(mountinfoFormats[2].mountinfo), 0666))
+	info, err = InfoForPID(33)
+	require.NoError(t, err)
+	assert.Equal(t, cgroupFormats[0].expectID, info.ContainerID)
+}
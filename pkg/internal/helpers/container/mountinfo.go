@@ -0,0 +1,59 @@
+package container
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// the container runtimes bind-mount some per-container files from their own storage directories. When the
+// cgroup of a process does not contain the container ID (for example, in private cgroup namespaces, where
+// the cgroup path is just "/"), the source path of these mounts can still reveal it.
+var containerMountPoints = map[string]struct{}{
+	"/etc/hostname":    {},
+	"/etc/hosts":       {},
+	"/etc/resolv.conf": {},
+}
+
+// recognizers of the container ID in the root of the bind mounts of the files from containerMountPoints:
+//
+//	docker:        /var/lib/docker/containers/<id>/hostname
+//	podman, cri-o: /var/lib/containers/storage/overlay-containers/<id>/userdata/hostname
+//
+// The root of a mount is relative to the root of its filesystem, so the beginning of the path depends
+// on the partitions of the host.
+var mountRecognizers = []*regexp.Regexp{
+	regexp.MustCompile(`/containers/([0-9a-f]{64})/(?:hostname|hosts|resolv\.conf)$`),
+	regexp.MustCompile(`/overlay-containers/([0-9a-f]{64})/userdata/(?:hostname|hosts|resolv\.conf)$`),
+}
+
+// containerIDFromMounts returns the container ID from the contents of a /proc/<pid>/mountinfo file,
+// whose lines have the format:
+//
+//	mount-ID parent-ID major:minor root mount-point options [optional-fields...] - fstype source super-options
+//
+// It returns false if no mount contains a recognizable container ID, or if the mounts refer to different
+// container IDs, as it can't tell which of them runs the process.
+func containerIDFromMounts(mountinfo []byte) (string, bool) {
+	containerID := ""
+	for _, line := range bytes.Split(mountinfo, []byte{'\n'}) {
+		fields := strings.Fields(string(line))
+		if len(fields) < 5 {
+			continue
+		}
+		if _, ok := containerMountPoints[fields[4]]; !ok {
+			continue
+		}
+		for _, r := range mountRecognizers {
+			sm := r.FindStringSubmatch(fields[3])
+			if len(sm) < 2 {
+				continue
+			}
+			if containerID != "" && containerID != sm[1] {
+				return "", false
+			}
+			containerID = sm[1]
+		}
+	}
+	return containerID, containerID != ""
+}
@@ -0,0 +1,35 @@
+package container
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// StartTime returns the time when the process with the given PID started, in clock ticks since
+// the system boot. Together with the PID, it identifies a process unequivocally, as the PID of a
+// dead process can be reused by a new process.
+func StartTime(pid uint32) (uint64, error) {
+	statFile := procRoot + strconv.Itoa(int(pid)) + "/stat"
+	stat, err := os.ReadFile(statFile)
+	if err != nil {
+		return 0, fmt.Errorf("reading %s: %w", statFile, err)
+	}
+	// the command name is enclosed in parentheses and might contain spaces, so we
+	// parse the fields after it. The start time is the 22nd field of the file.
+	end := bytes.LastIndexByte(stat, ')')
+	if end < 0 {
+		return 0, fmt.Errorf("%s: unexpected format: %q", statFile, stat)
+	}
+	fields := bytes.Fields(stat[end+1:])
+	const startTimeField = 22 - 3 // the fields after the command name start in the 3rd field
+	if len(fields) <= startTimeField {
+		return 0, fmt.Errorf("%s: unexpected number of fields: %d", statFile, len(fields))
+	}
+	start, err := strconv.ParseUint(string(fields[startTimeField]), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: parsing start time: %w", statFile, err)
+	}
+	return start, nil
+}
@@ -1,5 +1,10 @@
 package helpers
 
+import (
+	"cmp"
+	"slices"
+)
+
 // MultiCounter maps a counter to a given key
 type MultiCounter[K comparable] map[K]*int
 
@@ -85,3 +90,13 @@ func SliceToSet[V comparable](s []V) map[V]struct{} {
 	}
 	return out
 }
+
+// SortedKeys returns the keys of the provided map, in ascending order
+func SortedKeys[K cmp.Ordered, V any](m map[K]V) []K {
+	out := make([]K, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	slices.Sort(out)
+	return out
+}
@@ -105,3 +105,8 @@ func TestSetToSlice(t *testing.T) {
 	slices.Sort(slice)
 	assert.Equal(t, []int{1, 2, 3}, slice)
 }
+
+func TestSortedKeys(t *testing.T) {
+	assert.Equal(t, []string{"a", "b", "c"}, SortedKeys(map[string]int{"c": 3, "a": 1, "b": 2}))
+	assert.Empty(t, SortedKeys(map[string]int(nil)))
+}
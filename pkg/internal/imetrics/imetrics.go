@@ -3,6 +3,7 @@ package imetrics
 
 import (
 	"context"
+	"time"
 )
 
 // Config options for the different metrics exporters
@@ -28,15 +29,155 @@ type Reporter interface {
 	OTELTraceExportError(err error)
 	// PrometheusRequest is invoked every time the Prometheus exporter is invoked, for a given port and path
 	PrometheusRequest(port, path string)
+	// TracerEvents is invoked every time an eBPF tracer reads a group of len events from the kernel space
+	TracerEvents(tracer string, len int)
+	// TracerDroppedEvent is invoked every time an event read from the kernel space is discarded because
+	// it can't be read or parsed
+	TracerDroppedEvent(tracer, reason string)
+	// InstrumentProcess is invoked every time a new process is instrumented, reporting its service name
+	// and the type of instrumentation (go-uprobes, kprobes or tls)
+	InstrumentProcess(service, instrumentation string)
+	// UninstrumentProcess is invoked every time an instrumented process ends, with the same arguments
+	// that were passed to InstrumentProcess
+	UninstrumentProcess(service, instrumentation string)
+	// CapturedEvents is invoked every time the eBPF tracers forward a group of events of a given
+	// protocol (http, grpc, sql...) and service to the pipeline
+	CapturedEvents(protocol, service string, events int)
+	// KubeDatabaseIndexSize is invoked every time the Kubernetes Database updates one of its indexes
+	KubeDatabaseIndexSize(index string, size int)
+	// KubeDatabaseLookup is invoked every time the Kubernetes Database looks up an entry in one of its indexes
+	KubeDatabaseLookup(index string, hit bool)
+	// KubeDatabaseEvictions is invoked every time the Kubernetes Database evicts expired entries from one of its indexes
+	KubeDatabaseEvictions(index string, entries int)
+	// KubeDatabaseInspectionFailure is invoked every time the Kubernetes Database gives up inspecting the
+	// container information of a process, after retrying it
+	KubeDatabaseInspectionFailure()
+	// KubeDatabaseReconciliations is invoked every time the Kubernetes Database fixes the entries of one of its
+	// indexes that diverged from the informers, for example because some events were missed during a disconnection
+	KubeDatabaseReconciliations(index string, corrections int)
+	// KubeInformerEvents is invoked once for each resource (pod, service...) and event type (add, update
+	// or delete) whose informer events are handled by the Kubernetes Database. The returned recorder is
+	// invoked for each handled event, so it must not allocate.
+	KubeInformerEvents(resource, event string) EventRecorder
+	// ReverseDNSLookup is invoked every time the name resolver looks up the name of an IP in the DNS,
+	// reporting the result (success or failure), or when an asynchronous lookup is dropped
+	ReverseDNSLookup(result string)
+	// PipelineQueueDepth is invoked every time a pipeline stage receives data, reporting the length of its
+	// input queue
+	PipelineQueueDepth(stage string, depth int)
+	// PipelineStageLatency is invoked every time a pipeline stage forwards data to the next stage, reporting
+	// the time since the input data was received
+	PipelineStageLatency(stage string, latency time.Duration)
+	// PipelineQueueDrop is invoked every time the input queue of a pipeline stage discards data
+	// because it is full
+	PipelineQueueDrop(stage string)
+	// PipelineStageThroughput is invoked every time a pipeline stage receives, or generates, a batch
+	// of data, reporting the number of items in the batch
+	PipelineStageThroughput(stage string, items int)
+	// ConfigReload is invoked every time the configuration is reloaded. A failed reload keeps the
+	// active configuration.
+	ConfigReload(success bool)
+	// ConfigHash is invoked every time the active configuration changes, reporting its hash
+	ConfigHash(hash string)
+	// LogSuppressed is invoked every time a repeated log message is suppressed, for the component
+	// that submitted it
+	LogSuppressed(component string)
+	// MemoryPressureAction is invoked every time a component performs an action to reduce its memory
+	// usage when the memory usage approaches the limit
+	MemoryPressureAction(action string)
+	// GoOffsetsUnresolved is invoked every time the offsets of the Go structs can't be resolved for
+	// an instrumented Go executable
+	GoOffsetsUnresolved()
+	// LeaderElection is invoked every time this Beyla instance acquires or loses the leadership of
+	// the cluster-scoped responsibilities
+	LeaderElection(leading bool)
+	// EBPFReattach is invoked every time an eBPF program of the given type is found detached from its
+	// hook, reporting whether it could be re-attached
+	EBPFReattach(probeType string, success bool)
+	// EBPFDetached is invoked after each verification of the eBPF attachments, reporting the number
+	// of programs that are detached and could not be re-attached
+	EBPFDetached(programs int)
+	// EBPFFailure is invoked every time an eBPF program fails to load or attach, reporting the
+	// classified cause of the failure
+	EBPFFailure(cause string)
+	// OTELTraceBatch is invoked every time the OpenTelemetry Traces exporter flushes a batch of spans,
+	// reporting its length in spans and encoded bytes, as well as the reason of the flush
+	OTELTraceBatch(spans, bytes int, reason string)
+	// OTELExportDropped is invoked every time that the OpenTelemetry exporters drop some items (spans or
+	// metrics) of the given signal, reporting the reason of the drop
+	OTELExportDropped(signal, reason string, items int)
+	// PipelineShardQueueDepth is invoked every time a pipeline shard takes a batch of spans from its
+	// input queue, reporting the length of the queue
+	PipelineShardQueueDepth(shard string, depth int)
+	// PipelineShardThroughput is invoked every time a pipeline shard receives a batch of spans
+	PipelineShardThroughput(shard string, spans int)
+	// PipelineShardDrop is invoked every time the input queue of a pipeline shard discards a batch
+	// of spans because it is full
+	PipelineShardDrop(shard string, spans int)
+	// PipelineShardLatency is invoked every time a pipeline shard forwards a batch of spans, reporting
+	// the time since the shard took it from its input queue
+	PipelineShardLatency(shard string, latency time.Duration)
+	// KubeDelayedDecoration is invoked every time the Kubernetes decorator stops waiting for the
+	// metadata of a PID namespace whose spans have been delayed, reporting whether it was found
+	KubeDelayedDecoration(resolved bool)
+	// LoadSheddingTransition is invoked every time the load shedding level changes, reporting the new
+	// level by number and by name
+	LoadSheddingTransition(level int, name string)
+	// LoadSheddingSpans is invoked every time the load shedding degrades a batch of spans, reporting the
+	// shed work (span_export, body_size or request_attributes) and the number of affected spans
+	LoadSheddingSpans(work string, spans int)
+}
+
+// EventRecorder accounts the events of a given type, as well as the time that their handling takes
+type EventRecorder interface {
+	Record(handling time.Duration)
 }
 
 // NoopReporter is a metrics Reporter that just does nothing
 type NoopReporter struct{}
 
-func (n NoopReporter) Start(_ context.Context)       {}
-func (n NoopReporter) TracerFlush(_ int)             {}
-func (n NoopReporter) OTELMetricExport(_ int)        {}
-func (n NoopReporter) OTELMetricExportError(_ error) {}
-func (n NoopReporter) OTELTraceExport(_ int)         {}
-func (n NoopReporter) OTELTraceExportError(_ error)  {}
-func (n NoopReporter) PrometheusRequest(_, _ string) {}
+func (n NoopReporter) Start(_ context.Context)                        {}
+func (n NoopReporter) TracerFlush(_ int)                              {}
+func (n NoopReporter) OTELMetricExport(_ int)                         {}
+func (n NoopReporter) OTELMetricExportError(_ error)                  {}
+func (n NoopReporter) OTELTraceExport(_ int)                          {}
+func (n NoopReporter) OTELTraceExportError(_ error)                   {}
+func (n NoopReporter) PrometheusRequest(_, _ string)                  {}
+func (n NoopReporter) TracerEvents(_ string, _ int)                   {}
+func (n NoopReporter) TracerDroppedEvent(_, _ string)                 {}
+func (n NoopReporter) InstrumentProcess(_, _ string)                  {}
+func (n NoopReporter) UninstrumentProcess(_, _ string)                {}
+func (n NoopReporter) CapturedEvents(_, _ string, _ int)              {}
+func (n NoopReporter) KubeDatabaseIndexSize(_ string, _ int)          {}
+func (n NoopReporter) KubeDatabaseLookup(_ string, _ bool)            {}
+func (n NoopReporter) KubeDatabaseEvictions(_ string, _ int)          {}
+func (n NoopReporter) KubeDatabaseInspectionFailure()                 {}
+func (n NoopReporter) KubeDatabaseReconciliations(_ string, _ int)    {}
+func (n NoopReporter) KubeInformerEvents(_, _ string) EventRecorder   { return noopRecorder{} }
+func (n NoopReporter) ReverseDNSLookup(_ string)                      {}
+func (n NoopReporter) PipelineQueueDepth(_ string, _ int)             {}
+func (n NoopReporter) PipelineStageLatency(_ string, _ time.Duration) {}
+func (n NoopReporter) PipelineQueueDrop(_ string)                     {}
+func (n NoopReporter) PipelineStageThroughput(_ string, _ int)        {}
+func (n NoopReporter) ConfigReload(_ bool)                            {}
+func (n NoopReporter) ConfigHash(_ string)                            {}
+func (n NoopReporter) LogSuppressed(_ string)                         {}
+func (n NoopReporter) MemoryPressureAction(_ string)                  {}
+func (n NoopReporter) GoOffsetsUnresolved()                           {}
+func (n NoopReporter) LeaderElection(_ bool)                          {}
+func (n NoopReporter) EBPFReattach(_ string, _ bool)                  {}
+func (n NoopReporter) EBPFDetached(_ int)                             {}
+func (n NoopReporter) EBPFFailure(_ string)                           {}
+func (n NoopReporter) OTELTraceBatch(_, _ int, _ string)              {}
+func (n NoopReporter) OTELExportDropped(_, _ string, _ int)           {}
+func (n NoopReporter) PipelineShardQueueDepth(_ string, _ int)        {}
+func (n NoopReporter) PipelineShardThroughput(_ string, _ int)        {}
+func (n NoopReporter) PipelineShardDrop(_ string, _ int)              {}
+func (n NoopReporter) PipelineShardLatency(_ string, _ time.Duration) {}
+func (n NoopReporter) KubeDelayedDecoration(_ bool)                   {}
+func (n NoopReporter) LoadSheddingTransition(_ int, _ string)         {}
+func (n NoopReporter) LoadSheddingSpans(_ string, _ int)              {}
+
+type noopRecorder struct{}
+
+func (n noopRecorder) Record(_ time.Duration) {}
@@ -14,27 +14,83 @@ import (
 // TODO: let users override it or create it from the batch_length value
 var pipelineBufferLengths = []float64{0, 10, 20, 40, 80, 160, 320}
 
+// stageLatencies buckets, in seconds, for the processing latency of each pipeline stage
+var stageLatencies = []float64{0.00001, 0.0001, 0.001, 0.01, 0.1, 1, 10}
+
+// traceBatchSpans and traceBatchBytes buckets for the size of the span batches submitted by the OTEL traces exporter
+var traceBatchSpans = []float64{1, 10, 100, 500, 1000, 2000, 4096}
+var traceBatchBytes = prometheus.ExponentialBuckets(1024, 4, 8)
+
 type PrometheusConfig struct {
 	Port int    `yaml:"port,omitempty" env:"BEYLA_INTERNAL_METRICS_PROMETHEUS_PORT"`
 	Path string `yaml:"path,omitempty" env:"BEYLA_INTERNAL_METRICS_PROMETHEUS_PATH"`
+	// UnixSocket is the path of a Unix domain socket that serves the same endpoints as the port.
+	// If the port is 0, the endpoints are only served from the socket.
+	UnixSocket string `yaml:"unix_socket,omitempty" env:"BEYLA_INTERNAL_METRICS_PROMETHEUS_UNIX_SOCKET"`
+	// UnixSocketMode is the permissions of the Unix socket file
+	UnixSocketMode connector.FileMode `yaml:"unix_socket_mode,omitempty" env:"BEYLA_INTERNAL_METRICS_PROMETHEUS_UNIX_SOCKET_MODE"`
+}
+
+// Enabled returns whether the internal endpoints are served from a port or a Unix socket
+func (p *PrometheusConfig) Enabled() bool {
+	return p.Port != 0 || p.UnixSocket != ""
 }
 
 // PrometheusReporter is an internal metrics Reporter that exports to Prometheus
 type PrometheusReporter struct {
-	connector            *connector.PrometheusManager
-	tracerFlushes        prometheus.Histogram
-	otelMetricExports    prometheus.Counter
-	otelMetricExportErrs *prometheus.CounterVec
-	otelTraceExports     prometheus.Counter
-	otelTraceExportErrs  *prometheus.CounterVec
-	prometheusRequests   *prometheus.CounterVec
+	connector             *connector.PrometheusManager
+	tracerFlushes         prometheus.Histogram
+	otelMetricExports     prometheus.Counter
+	otelMetricExportErrs  *prometheus.CounterVec
+	otelTraceExports      prometheus.Counter
+	otelTraceExportErrs   *prometheus.CounterVec
+	prometheusRequests    *prometheus.CounterVec
+	tracerEvents          *prometheus.CounterVec
+	tracerDroppedEvents   *prometheus.CounterVec
+	instrumentedProcs     *prometheus.GaugeVec
+	capturedEvents        *prometheus.CounterVec
+	kubeDBIndexSizes      *prometheus.GaugeVec
+	kubeDBLookups         *prometheus.CounterVec
+	kubeDBEvictions       *prometheus.CounterVec
+	kubeDBInspectFails    prometheus.Counter
+	kubeDBReconciliations *prometheus.CounterVec
+	kubeInformerEvents    *prometheus.CounterVec
+	kubeInformerHandling  *prometheus.HistogramVec
+	reverseDNSLookups     *prometheus.CounterVec
+	pipelineQueueDepths   *prometheus.GaugeVec
+	pipelineLatencies     *prometheus.HistogramVec
+	pipelineQueueDrops    *prometheus.CounterVec
+	pipelineBatches       *prometheus.CounterVec
+	pipelineItems         *prometheus.CounterVec
+	configReloads         *prometheus.CounterVec
+	configInfo            *prometheus.GaugeVec
+	logsSuppressed        *prometheus.CounterVec
+	memPressureActions    *prometheus.CounterVec
+	goOffsetsUnresolved   prometheus.Counter
+	leader                prometheus.Gauge
+	leaderTransitions     *prometheus.CounterVec
+	ebpfReattachments     *prometheus.CounterVec
+	ebpfDetached          prometheus.Gauge
+	ebpfFailures          *prometheus.CounterVec
+	traceBatchSpans       *prometheus.HistogramVec
+	traceBatchBytes       prometheus.Histogram
+	otelExportDrops       *prometheus.CounterVec
+	shardQueueDepths      *prometheus.GaugeVec
+	shardBatches          *prometheus.CounterVec
+	shardSpans            *prometheus.CounterVec
+	shardDrops            *prometheus.CounterVec
+	shardLatencies        *prometheus.HistogramVec
+	kubeDelayed           *prometheus.CounterVec
+	loadSheddingLevel     prometheus.Gauge
+	loadSheddingChanges   *prometheus.CounterVec
+	loadSheddingSpans     *prometheus.CounterVec
 }
 
 func NewPrometheusReporter(cfg *PrometheusConfig, manager *connector.PrometheusManager) *PrometheusReporter {
 	pr := &PrometheusReporter{
 		connector: manager,
 		tracerFlushes: prometheus.NewHistogram(prometheus.HistogramOpts{
-			Name:                            "ebpf_tracer_flushes",
+			Name:                            "beyla_ebpf_tracer_flushes",
 			Help:                            "length of the groups of traces flushed from the eBPF tracer to the next pipeline stage",
 			Buckets:                         pipelineBufferLengths,
 			NativeHistogramBucketFactor:     1.1,
@@ -42,25 +98,186 @@ func NewPrometheusReporter(cfg *PrometheusConfig, manager *connector.PrometheusM
 			NativeHistogramMinResetDuration: 1 * time.Hour,
 		}),
 		otelMetricExports: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: "otel_metric_exports",
+			Name: "beyla_otel_metric_exports_total",
 			Help: "length of the metric batches submitted to the remote OTEL collector",
 		}),
 		otelMetricExportErrs: prometheus.NewCounterVec(prometheus.CounterOpts{
-			Name: "otel_metric_export_errors",
+			Name: "beyla_otel_metric_export_errors_total",
 			Help: "error count on each failed OTEL metric export",
 		}, []string{"error"}),
 		otelTraceExports: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: "otel_trace_exports",
+			Name: "beyla_otel_trace_exports_total",
 			Help: "length of the trace batches submitted to the remote OTEL collector",
 		}),
 		otelTraceExportErrs: prometheus.NewCounterVec(prometheus.CounterOpts{
-			Name: "otel_trace_export_errors",
+			Name: "beyla_otel_trace_export_errors_total",
 			Help: "error count on each failed OTEL trace export",
 		}, []string{"error"}),
 		prometheusRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
-			Name: "prometheus_http_requests",
+			Name: "beyla_prometheus_http_requests_total",
 			Help: "requests towards the Prometheus Scrape endpoint",
 		}, []string{"port", "path"}),
+		tracerEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_ebpf_tracer_events_total",
+			Help: "events read by each eBPF tracer from the kernel space",
+		}, []string{"tracer"}),
+		tracerDroppedEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_ebpf_tracer_dropped_events_total",
+			Help: "events from the eBPF tracers that are discarded because they can't be read, parsed or are invalid",
+		}, []string{"tracer", "reason"}),
+		instrumentedProcs: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "beyla_instrumented_processes",
+			Help: "number of processes that are currently instrumented, by service name and instrumentation type",
+		}, []string{"service_name", "instrumentation"}),
+		capturedEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_captured_events_total",
+			Help: "events captured by the eBPF tracers and forwarded to the pipeline, by protocol and service name",
+		}, []string{"protocol", "service_name"}),
+		kubeDBIndexSizes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "beyla_kube_database_index_size",
+			Help: "number of entries in each index of the Kubernetes metadata database",
+		}, []string{"index"}),
+		kubeDBLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_kube_database_lookups_total",
+			Help: "lookups in each index of the Kubernetes metadata database, by result (hit or miss)",
+		}, []string{"index", "result"}),
+		kubeDBEvictions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_kube_database_evictions_total",
+			Help: "expired entries that have been evicted from each index of the Kubernetes metadata database",
+		}, []string{"index"}),
+		kubeDBInspectFails: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "beyla_kube_database_inspection_failures_total",
+			Help: "processes whose container information could not be inspected by the Kubernetes metadata database after retrying",
+		}),
+		kubeDBReconciliations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_kube_database_reconciliation_corrections_total",
+			Help: "entries of each index of the Kubernetes metadata database that were fixed because they diverged from the informers",
+		}, []string{"index"}),
+		kubeInformerEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_kube_informer_events_total",
+			Help: "informer events handled by the Kubernetes metadata database, by resource and event type",
+		}, []string{"resource", "event"}),
+		kubeInformerHandling: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "beyla_kube_informer_event_handler_seconds",
+			Help:    "time that the Kubernetes metadata database takes to handle each informer event, by resource and event type",
+			Buckets: stageLatencies,
+		}, []string{"resource", "event"}),
+		reverseDNSLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_reverse_dns_lookups_total",
+			Help: "reverse DNS lookups of the peers that are not found in the cluster, by result",
+		}, []string{"result"}),
+		pipelineQueueDepths: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "beyla_pipeline_queue_depth",
+			Help: "length of the input queue of each pipeline stage",
+		}, []string{"stage"}),
+		pipelineLatencies: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "beyla_pipeline_stage_latency_seconds",
+			Help:    "time that each pipeline stage takes to process and forward its input data",
+			Buckets: stageLatencies,
+		}, []string{"stage"}),
+		pipelineQueueDrops: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_pipeline_queue_dropped_total",
+			Help: "batches of data discarded by the input queue of each pipeline stage because it is full",
+		}, []string{"stage"}),
+		pipelineBatches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_pipeline_stage_batches_total",
+			Help: "batches of data received, or generated, by each pipeline stage",
+		}, []string{"stage"}),
+		pipelineItems: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_pipeline_stage_items_total",
+			Help: "items (for example, spans or flows) received, or generated, by each pipeline stage",
+		}, []string{"stage"}),
+		configReloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_config_reloads_total",
+			Help: "configuration reloads, by result (success or failure)",
+		}, []string{"result"}),
+		configInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "beyla_config_info",
+			Help: "constant 1 value labeled by the hash of the active configuration",
+		}, []string{"hash"}),
+		logsSuppressed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_log_messages_suppressed_total",
+			Help: "repeated log messages that have been suppressed, by component",
+		}, []string{"component"}),
+		memPressureActions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_memory_pressure_actions_total",
+			Help: "actions performed to reduce the memory usage when it approaches the memory limit, by action",
+		}, []string{"action"}),
+		goOffsetsUnresolved: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "beyla_go_offsets_unresolved_total",
+			Help: "instrumented Go executables whose struct field offsets could not be resolved",
+		}),
+		leader: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "beyla_leader",
+			Help: "1 if this instance is the leader that runs the cluster-scoped responsibilities, 0 otherwise",
+		}),
+		leaderTransitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_leader_transitions_total",
+			Help: "times that this instance acquired or lost the leadership, by transition",
+		}, []string{"transition"}),
+		ebpfReattachments: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_ebpf_reattachments_total",
+			Help: "attempts to re-attach the eBPF programs that were found detached, by type and result (success or failure)",
+		}, []string{"type", "result"}),
+		ebpfDetached: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "beyla_ebpf_detached_programs",
+			Help: "eBPF programs that are detached from their hooks and could not be re-attached",
+		}),
+		ebpfFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_ebpf_failures_total",
+			Help: "failures to load or attach eBPF programs, by classified cause",
+		}, []string{"cause"}),
+		traceBatchSpans: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "beyla_otel_trace_batch_spans",
+			Help:    "number of spans in each batch submitted by the OTEL traces exporter, by flush reason",
+			Buckets: traceBatchSpans,
+		}, []string{"reason"}),
+		traceBatchBytes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "beyla_otel_trace_batch_bytes",
+			Help:    "encoded size of each batch submitted by the OTEL traces exporter",
+			Buckets: traceBatchBytes,
+		}),
+		otelExportDrops: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_otel_export_dropped_total",
+			Help: "spans or metrics dropped by the OTEL exporters, by signal and reason",
+		}, []string{"signal", "reason"}),
+		shardQueueDepths: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "beyla_pipeline_shard_queue_depth",
+			Help: "length of the input queue of each pipeline shard",
+		}, []string{"shard"}),
+		shardBatches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_pipeline_shard_batches_total",
+			Help: "batches of spans received by each pipeline shard",
+		}, []string{"shard"}),
+		shardSpans: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_pipeline_shard_spans_total",
+			Help: "spans received by each pipeline shard",
+		}, []string{"shard"}),
+		shardDrops: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_pipeline_shard_dropped_spans_total",
+			Help: "spans discarded by the input queue of each pipeline shard because it is full",
+		}, []string{"shard"}),
+		shardLatencies: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "beyla_pipeline_shard_latency_seconds",
+			Help:    "time that each pipeline shard takes to process and forward a batch of spans",
+			Buckets: stageLatencies,
+		}, []string{"shard"}),
+		kubeDelayed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_kube_delayed_decorations_total",
+			Help: "PID namespaces whose spans were delayed waiting for their Kubernetes metadata, by result (resolved or unresolved)",
+		}, []string{"result"}),
+		loadSheddingLevel: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "beyla_load_shedding_level",
+			Help: "current load shedding level: 0 (none), 1 (span_export), 2 (body_size) or 3 (request_attributes)",
+		}),
+		loadSheddingChanges: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_load_shedding_transitions_total",
+			Help: "times that the load shedding level changed, by the new level",
+		}, []string{"level"}),
+		loadSheddingSpans: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_load_shedding_spans_total",
+			Help: "spans whose processing was degraded by the load shedding, by shed work",
+		}, []string{"work"}),
 	}
 	manager.Register(cfg.Port, cfg.Path,
 		pr.tracerFlushes,
@@ -68,7 +285,49 @@ func NewPrometheusReporter(cfg *PrometheusConfig, manager *connector.PrometheusM
 		pr.otelMetricExportErrs,
 		pr.otelTraceExports,
 		pr.otelTraceExportErrs,
-		pr.prometheusRequests)
+		pr.prometheusRequests,
+		pr.tracerEvents,
+		pr.tracerDroppedEvents,
+		pr.instrumentedProcs,
+		pr.capturedEvents,
+		pr.kubeDBIndexSizes,
+		pr.kubeDBLookups,
+		pr.kubeDBEvictions,
+		pr.kubeDBInspectFails,
+		pr.kubeDBReconciliations,
+		pr.kubeInformerEvents,
+		pr.kubeInformerHandling,
+		pr.reverseDNSLookups,
+		pr.pipelineQueueDepths,
+		pr.pipelineLatencies,
+		pr.pipelineQueueDrops,
+		pr.pipelineBatches,
+		pr.pipelineItems,
+		pr.configReloads,
+		pr.configInfo,
+		pr.logsSuppressed,
+		pr.memPressureActions,
+		pr.goOffsetsUnresolved,
+		pr.leader,
+		pr.leaderTransitions,
+		pr.ebpfReattachments,
+		pr.ebpfDetached,
+		pr.ebpfFailures,
+		pr.traceBatchSpans,
+		pr.traceBatchBytes,
+		pr.otelExportDrops,
+		pr.shardQueueDepths,
+		pr.shardBatches,
+		pr.shardSpans,
+		pr.shardDrops,
+		pr.shardLatencies,
+		pr.kubeDelayed,
+		pr.loadSheddingLevel,
+		pr.loadSheddingChanges,
+		pr.loadSheddingSpans)
+	if cfg.UnixSocket != "" {
+		manager.UnixSocket(cfg.Port, cfg.UnixSocket, cfg.UnixSocketMode)
+	}
 
 	return pr
 }
@@ -100,3 +359,181 @@ func (p *PrometheusReporter) OTELTraceExportError(err error) {
 func (p *PrometheusReporter) PrometheusRequest(port, path string) {
 	p.prometheusRequests.WithLabelValues(port, path).Inc()
 }
+
+func (p *PrometheusReporter) TracerEvents(tracer string, len int) {
+	p.tracerEvents.WithLabelValues(tracer).Add(float64(len))
+}
+
+func (p *PrometheusReporter) TracerDroppedEvent(tracer, reason string) {
+	p.tracerDroppedEvents.WithLabelValues(tracer, reason).Inc()
+}
+
+func (p *PrometheusReporter) InstrumentProcess(service, instrumentation string) {
+	p.instrumentedProcs.WithLabelValues(service, instrumentation).Inc()
+}
+
+func (p *PrometheusReporter) UninstrumentProcess(service, instrumentation string) {
+	p.instrumentedProcs.WithLabelValues(service, instrumentation).Dec()
+}
+
+func (p *PrometheusReporter) CapturedEvents(protocol, service string, events int) {
+	p.capturedEvents.WithLabelValues(protocol, service).Add(float64(events))
+}
+
+func (p *PrometheusReporter) KubeDatabaseIndexSize(index string, size int) {
+	p.kubeDBIndexSizes.WithLabelValues(index).Set(float64(size))
+}
+
+func (p *PrometheusReporter) KubeDatabaseLookup(index string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	p.kubeDBLookups.WithLabelValues(index, result).Inc()
+}
+
+func (p *PrometheusReporter) KubeDatabaseEvictions(index string, entries int) {
+	p.kubeDBEvictions.WithLabelValues(index).Add(float64(entries))
+}
+
+func (p *PrometheusReporter) KubeDatabaseInspectionFailure() {
+	p.kubeDBInspectFails.Inc()
+}
+
+func (p *PrometheusReporter) KubeDatabaseReconciliations(index string, corrections int) {
+	p.kubeDBReconciliations.WithLabelValues(index).Add(float64(corrections))
+}
+
+// KubeInformerEvents binds the labels of the returned recorder in advance, as they would allocate
+// if they were looked up for each event
+func (p *PrometheusReporter) KubeInformerEvents(resource, event string) EventRecorder {
+	return promEventRecorder{
+		events:   p.kubeInformerEvents.WithLabelValues(resource, event),
+		handling: p.kubeInformerHandling.WithLabelValues(resource, event),
+	}
+}
+
+type promEventRecorder struct {
+	events   prometheus.Counter
+	handling prometheus.Observer
+}
+
+func (r promEventRecorder) Record(handling time.Duration) {
+	r.events.Inc()
+	r.handling.Observe(handling.Seconds())
+}
+
+func (p *PrometheusReporter) ReverseDNSLookup(result string) {
+	p.reverseDNSLookups.WithLabelValues(result).Inc()
+}
+
+func (p *PrometheusReporter) PipelineQueueDepth(stage string, depth int) {
+	p.pipelineQueueDepths.WithLabelValues(stage).Set(float64(depth))
+}
+
+func (p *PrometheusReporter) PipelineStageLatency(stage string, latency time.Duration) {
+	p.pipelineLatencies.WithLabelValues(stage).Observe(latency.Seconds())
+}
+
+func (p *PrometheusReporter) PipelineQueueDrop(stage string) {
+	p.pipelineQueueDrops.WithLabelValues(stage).Inc()
+}
+
+func (p *PrometheusReporter) PipelineStageThroughput(stage string, items int) {
+	p.pipelineBatches.WithLabelValues(stage).Inc()
+	p.pipelineItems.WithLabelValues(stage).Add(float64(items))
+}
+
+func (p *PrometheusReporter) ConfigReload(success bool) {
+	result := "failure"
+	if success {
+		result = "success"
+	}
+	p.configReloads.WithLabelValues(result).Inc()
+}
+
+func (p *PrometheusReporter) ConfigHash(hash string) {
+	p.configInfo.Reset()
+	p.configInfo.WithLabelValues(hash).Set(1)
+}
+
+func (p *PrometheusReporter) LogSuppressed(component string) {
+	p.logsSuppressed.WithLabelValues(component).Inc()
+}
+
+func (p *PrometheusReporter) MemoryPressureAction(action string) {
+	p.memPressureActions.WithLabelValues(action).Inc()
+}
+
+func (p *PrometheusReporter) GoOffsetsUnresolved() {
+	p.goOffsetsUnresolved.Inc()
+}
+
+func (p *PrometheusReporter) LeaderElection(leading bool) {
+	if leading {
+		p.leader.Set(1)
+		p.leaderTransitions.WithLabelValues("acquired").Inc()
+	} else {
+		p.leader.Set(0)
+		p.leaderTransitions.WithLabelValues("lost").Inc()
+	}
+}
+
+func (p *PrometheusReporter) EBPFReattach(probeType string, success bool) {
+	result := "failure"
+	if success {
+		result = "success"
+	}
+	p.ebpfReattachments.WithLabelValues(probeType, result).Inc()
+}
+
+func (p *PrometheusReporter) EBPFDetached(programs int) {
+	p.ebpfDetached.Set(float64(programs))
+}
+
+func (p *PrometheusReporter) EBPFFailure(cause string) {
+	p.ebpfFailures.WithLabelValues(cause).Inc()
+}
+
+func (p *PrometheusReporter) OTELTraceBatch(spans, bytes int, reason string) {
+	p.traceBatchSpans.WithLabelValues(reason).Observe(float64(spans))
+	p.traceBatchBytes.Observe(float64(bytes))
+}
+
+func (p *PrometheusReporter) OTELExportDropped(signal, reason string, items int) {
+	p.otelExportDrops.WithLabelValues(signal, reason).Add(float64(items))
+}
+
+func (p *PrometheusReporter) PipelineShardQueueDepth(shard string, depth int) {
+	p.shardQueueDepths.WithLabelValues(shard).Set(float64(depth))
+}
+
+func (p *PrometheusReporter) PipelineShardThroughput(shard string, spans int) {
+	p.shardBatches.WithLabelValues(shard).Inc()
+	p.shardSpans.WithLabelValues(shard).Add(float64(spans))
+}
+
+func (p *PrometheusReporter) PipelineShardDrop(shard string, spans int) {
+	p.shardDrops.WithLabelValues(shard).Add(float64(spans))
+}
+
+func (p *PrometheusReporter) PipelineShardLatency(shard string, latency time.Duration) {
+	p.shardLatencies.WithLabelValues(shard).Observe(latency.Seconds())
+}
+
+func (p *PrometheusReporter) KubeDelayedDecoration(resolved bool) {
+	result := "unresolved"
+	if resolved {
+		result = "resolved"
+	}
+	p.kubeDelayed.WithLabelValues(result).Inc()
+}
+
+func (p *PrometheusReporter) LoadSheddingTransition(level int, name string) {
+	p.loadSheddingLevel.Set(float64(level))
+	p.loadSheddingChanges.WithLabelValues(name).Inc()
+}
+
+func (p *PrometheusReporter) LoadSheddingSpans(work string, spans int) {
+	p.loadSheddingSpans.WithLabelValues(work).Add(float64(spans))
+}
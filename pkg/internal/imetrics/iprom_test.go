@@ -0,0 +1,23 @@
+package imetrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/grafana/beyla/pkg/internal/connector"
+)
+
+func TestKubeInformerEvents(t *testing.T) {
+	reporter := NewPrometheusReporter(&PrometheusConfig{Port: 9090, Path: "/metrics"}, &connector.PrometheusManager{})
+	adds := reporter.KubeInformerEvents("pod", "add")
+
+	// the bound recorder must not allocate, as it is invoked for each informer event
+	assert.Zero(t, testing.AllocsPerRun(100, func() {
+		adds.Record(time.Millisecond)
+	}))
+	assert.Equal(t, 101.0, testutil.ToFloat64(reporter.kubeInformerEvents.WithLabelValues("pod", "add")))
+	assert.Zero(t, testutil.ToFloat64(reporter.kubeInformerEvents.WithLabelValues("pod", "delete")))
+}
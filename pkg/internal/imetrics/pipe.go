@@ -0,0 +1,126 @@
+package imetrics
+
+import (
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"github.com/mariomac/pipes/pipe"
+)
+
+var timeNow = time.Now
+
+// InstrumentStart wraps a start pipeline stage to report the throughput of the data that it generates.
+// If the reporter is a NoopReporter, the stage is not instrumented.
+func InstrumentStart[OUT any](r Reporter, stage string, start pipe.StartFunc[OUT]) pipe.StartFunc[OUT] {
+	if _, ok := r.(NoopReporter); ok || r == nil {
+		return start
+	}
+	return func(out chan<- OUT) {
+		nodeOut := make(chan OUT)
+		forwarded := make(chan struct{})
+		go func() {
+			defer close(forwarded)
+			for o := range nodeOut {
+				r.PipelineStageThroughput(stage, itemsOf(o))
+				out <- o
+			}
+		}()
+		start(nodeOut)
+		close(nodeOut)
+		<-forwarded
+	}
+}
+
+// InstrumentMiddle wraps the provider of a middle pipeline stage to report the depth of its input
+// queue and the throughput of its inputs, as well as the time it takes to process and forward each input.
+// The stage is expected to process its inputs sequentially, forwarding at most one output for
+// each input. If the stage is bypassed or the reporter is a NoopReporter, the stage is not instrumented.
+func InstrumentMiddle[IN, OUT any](r Reporter, stage string, provider pipe.MiddleProvider[IN, OUT]) pipe.MiddleProvider[IN, OUT] {
+	if _, ok := r.(NoopReporter); ok || r == nil {
+		return provider
+	}
+	return func() (pipe.MiddleFunc[IN, OUT], error) {
+		node, err := provider()
+		if err != nil || node == nil {
+			return node, err
+		}
+		return func(in <-chan IN, out chan<- OUT) {
+			// time when the stage took the input that is being processed
+			var taken atomic.Int64
+			nodeIn := make(chan IN)
+			go func() {
+				defer close(nodeIn)
+				for i := range in {
+					r.PipelineQueueDepth(stage, len(in))
+					r.PipelineStageThroughput(stage, itemsOf(i))
+					nodeIn <- i
+					taken.Store(timeNow().UnixNano())
+				}
+			}()
+			nodeOut := make(chan OUT)
+			forwarded := make(chan struct{})
+			go func() {
+				defer close(forwarded)
+				for o := range nodeOut {
+					r.PipelineStageLatency(stage, timeNow().Sub(time.Unix(0, taken.Load())))
+					out <- o
+				}
+			}()
+			node(nodeIn, nodeOut)
+			close(nodeOut)
+			<-forwarded
+		}, nil
+	}
+}
+
+// InstrumentFinal wraps the provider of a final pipeline stage to report the depth of its input queue
+// and the throughput of its inputs, as well as the time it takes to process each input.
+// As a final stage does not report when it finishes processing an input, the processing time is only
+// measured when the stage is still busy with the previous input when a new input arrives: then the
+// processing time is the time until the stage takes the new input. This way, the latency is reported
+// when it matters (when the stage can't keep the pace of its inputs) without adding any overhead to
+// the stage.
+// If the stage is ignored or the reporter is a NoopReporter, the stage is not instrumented.
+func InstrumentFinal[IN any](r Reporter, stage string, provider pipe.FinalProvider[IN]) pipe.FinalProvider[IN] {
+	if _, ok := r.(NoopReporter); ok || r == nil {
+		return provider
+	}
+	return func() (pipe.FinalFunc[IN], error) {
+		node, err := provider()
+		if err != nil || node == nil {
+			return node, err
+		}
+		return func(in <-chan IN) {
+			nodeIn := make(chan IN)
+			go func() {
+				defer close(nodeIn)
+				// time when the stage took the previous input
+				var taken time.Time
+				for i := range in {
+					r.PipelineQueueDepth(stage, len(in))
+					r.PipelineStageThroughput(stage, itemsOf(i))
+					select {
+					case nodeIn <- i:
+						// the stage was idle, waiting for inputs
+					default:
+						nodeIn <- i
+						if !taken.IsZero() {
+							r.PipelineStageLatency(stage, timeNow().Sub(taken))
+						}
+					}
+					taken = timeNow()
+				}
+			}()
+			node(nodeIn)
+		}, nil
+	}
+}
+
+// itemsOf returns the number of items in a batch of data, or 1 if the data is not a slice
+func itemsOf[T any](batch T) int {
+	if v := reflect.ValueOf(batch); v.Kind() == reflect.Slice {
+		return v.Len()
+	}
+	return 1
+}
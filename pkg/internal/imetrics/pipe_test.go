@@ -0,0 +1,146 @@
+package imetrics
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mariomac/pipes/pipe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stageMetrics struct {
+	NoopReporter
+	mt        sync.Mutex
+	depths    []int
+	latencies []time.Duration
+	items     []int
+}
+
+func (s *stageMetrics) PipelineQueueDepth(stage string, depth int) {
+	s.mt.Lock()
+	defer s.mt.Unlock()
+	if stage == "stage" {
+		s.depths = append(s.depths, depth)
+	}
+}
+
+func (s *stageMetrics) PipelineStageLatency(stage string, latency time.Duration) {
+	s.mt.Lock()
+	defer s.mt.Unlock()
+	if stage == "stage" {
+		s.latencies = append(s.latencies, latency)
+	}
+}
+
+func (s *stageMetrics) PipelineStageThroughput(stage string, items int) {
+	s.mt.Lock()
+	defer s.mt.Unlock()
+	if stage == "stage" {
+		s.items = append(s.items, items)
+	}
+}
+
+func TestInstrumentStart(t *testing.T) {
+	metrics := &stageMetrics{}
+	node := InstrumentStart[[]int](metrics, "stage", func(out chan<- []int) {
+		out <- []int{1, 2, 3}
+		out <- nil
+		out <- []int{4}
+	})
+	out := make(chan []int, 10)
+	node(out)
+
+	require.Len(t, out, 3)
+	assert.Equal(t, []int{1, 2, 3}, <-out)
+	assert.Empty(t, <-out)
+	assert.Equal(t, []int{4}, <-out)
+
+	metrics.mt.Lock()
+	defer metrics.mt.Unlock()
+	assert.Equal(t, []int{3, 0, 1}, metrics.items)
+}
+
+func TestInstrumentMiddle(t *testing.T) {
+	metrics := &stageMetrics{}
+	node, err := InstrumentMiddle[int, int](metrics, "stage", func() (pipe.MiddleFunc[int, int], error) {
+		return func(in <-chan int, out chan<- int) {
+			for i := range in {
+				out <- i * 2
+			}
+		}, nil
+	})()
+	require.NoError(t, err)
+
+	in := make(chan int, 10)
+	for i := 0; i < 3; i++ {
+		in <- i
+	}
+	close(in)
+	out := make(chan int, 10)
+	node(in, out)
+
+	// the output channel is not closed by the wrapper, as the pipes library does it
+	require.Len(t, out, 3)
+	assert.Equal(t, 0, <-out)
+	assert.Equal(t, 2, <-out)
+	assert.Equal(t, 4, <-out)
+
+	metrics.mt.Lock()
+	defer metrics.mt.Unlock()
+	assert.Equal(t, []int{2, 1, 0}, metrics.depths)
+	// a latency is reported for each forwarded output
+	assert.Len(t, metrics.latencies, 3)
+	// the inputs that are not slices are accounted as a single item
+	assert.Equal(t, []int{1, 1, 1}, metrics.items)
+}
+
+func TestInstrumentFinal(t *testing.T) {
+	metrics := &stageMetrics{}
+	var received []int
+	// the stage takes some time to process each input
+	const processTime = 20 * time.Millisecond
+	node, err := InstrumentFinal[int](metrics, "stage", func() (pipe.FinalFunc[int], error) {
+		return func(in <-chan int) {
+			for i := range in {
+				time.Sleep(processTime)
+				received = append(received, i)
+			}
+		}, nil
+	})()
+	require.NoError(t, err)
+
+	in := make(chan int, 10)
+	for i := 0; i < 3; i++ {
+		in <- i
+	}
+	close(in)
+	node(in)
+
+	assert.Equal(t, []int{0, 1, 2}, received)
+	metrics.mt.Lock()
+	defer metrics.mt.Unlock()
+	assert.Equal(t, []int{2, 1, 0}, metrics.depths)
+	assert.Equal(t, []int{1, 1, 1}, metrics.items)
+	// the latency is reported when the stage is busy with the previous input as a new input arrives
+	require.Len(t, metrics.latencies, 2)
+	for _, latency := range metrics.latencies {
+		assert.GreaterOrEqual(t, latency, processTime)
+	}
+}
+
+func TestInstrument_Bypass(t *testing.T) {
+	metrics := &stageMetrics{}
+	middle, err := InstrumentMiddle[int, int](metrics, "stage", func() (pipe.MiddleFunc[int, int], error) {
+		return pipe.Bypass[int](), nil
+	})()
+	require.NoError(t, err)
+	assert.Nil(t, middle)
+
+	final, err := InstrumentFinal[int](metrics, "stage", func() (pipe.FinalFunc[int], error) {
+		return pipe.IgnoreFinal[int](), nil
+	})()
+	require.NoError(t, err)
+	assert.Nil(t, final)
+}
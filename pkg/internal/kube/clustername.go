@@ -2,7 +2,7 @@
 // https://github.com/DataDog/datadog-agent,
 // published under Apache License 2.0
 
-package k8s
+package kube
 
 import (
 	"bytes"
@@ -13,12 +13,15 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 )
 
 const (
@@ -28,6 +31,10 @@ const (
 	ec2MetadataURL         = "http://169.254.169.254/latest/meta-data"
 	ec2SecurityCredsURL    = ec2MetadataURL + "/iam/security-credentials/"
 	ec2InstanceIdentityURL = "http://169.254.169.254/latest/dynamic/instance-identity/document/"
+
+	clusterNameRetries       = 5
+	clusterNameFailRetryTime = 500 * time.Millisecond
+	clusterNameMaxRetryTime  = 5 * time.Minute
 )
 
 var (
@@ -39,11 +46,130 @@ var metadataClient = http.Client{Timeout: time.Second}
 
 type clusterNameFetcher func(context.Context) (string, error)
 
+// injectable functions for testing
+var (
+	cloudClusterName = fetchClusterName
+	retryTime        = clusterNameFailRetryTime
+)
+
+// ClusterName provides the name of the Kubernetes cluster, which is resolved in background
+// and cached after the first successful resolution.
+type ClusterName struct {
+	name atomic.Pointer[string]
+	// resolved is closed when the name is stored
+	resolved chan struct{}
+}
+
+// ResolveClusterName returns the configured cluster name, if not empty. Otherwise, it starts
+// resolving it in background from the Cloud Provider Metadata (EC2, GCP and Azure). If it
+// fails to, the UID of the kube-system namespace is used as a stable identifier of the cluster,
+// unless the client is nil.
+// The returned instance provides an empty name until the resolution succeeds, so the callers
+// don't need to wait for it.
+func ResolveClusterName(ctx context.Context, client kubernetes.Interface, configured string) *ClusterName {
+	cn := &ClusterName{resolved: make(chan struct{})}
+	if configured != "" {
+		cn.set(configured)
+		return cn
+	}
+	go cn.resolve(ctx, client)
+	return cn
+}
+
+func (cn *ClusterName) set(name string) {
+	cn.name.Store(&name)
+	close(cn.resolved)
+}
+
+// Wait blocks until the name of the cluster is resolved, the timeout expires or the context is done,
+// and returns the name, or an empty string if it has not been resolved yet. The decorators wait for
+// it before decorating the first spans and flows. It can be invoked on a nil instance.
+func (cn *ClusterName) Wait(ctx context.Context, timeout time.Duration) string {
+	if cn == nil {
+		return ""
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-cn.resolved:
+	case <-timer.C:
+		klog().Warn("the cluster name is not resolved yet. The first spans and network flows won't report"+
+			" the k8s.cluster.name attribute", "timeout", timeout)
+	case <-ctx.Done():
+	}
+	return cn.Get()
+}
+
+// Get returns the name of the cluster, or an empty string if it has not been resolved yet.
+// It can be invoked on a nil instance.
+func (cn *ClusterName) Get() string {
+	if cn == nil {
+		return ""
+	}
+	if name := cn.name.Load(); name != nil {
+		return *name
+	}
+	return ""
+}
+
+func (cn *ClusterName) resolve(ctx context.Context, client kubernetes.Interface) {
+	log := klog().With("func", "ClusterName.resolve")
+	for retries := 0; retries < clusterNameRetries; retries++ {
+		if name := cloudClusterName(ctx); name != "" {
+			cn.set(name)
+			return
+		}
+		log.Debug("retrying cluster name fetching", "wait", retryTime)
+		if !sleep(ctx, retryTime) {
+			return
+		}
+	}
+	// without access to the API server (e.g. when the Pods are fetched from the kubelet),
+	// the cloud provider metadata is the only source of the cluster name
+	if client == nil {
+		log.Warn("can't fetch the cluster name from the Cloud Provider Metadata. The k8s.cluster.name" +
+			" attribute won't be reported, unless you explicitly set the BEYLA_KUBE_CLUSTER_NAME environment variable")
+		return
+	}
+	// the kube-system namespace can't be removed, so its UID identifies the cluster
+	// during its whole lifetime
+	wait := retryTime
+	for warned := false; ; warned = true {
+		ns, err := client.CoreV1().Namespaces().Get(ctx, metav1.NamespaceSystem, metav1.GetOptions{})
+		if err == nil {
+			uid := string(ns.UID)
+			log.Info("can't fetch the cluster name from the Cloud Provider Metadata. Using the UID"+
+				" of the kube-system namespace as cluster name", "uid", uid)
+			cn.set(uid)
+			return
+		}
+		if !warned {
+			log.Warn("can't fetch Kubernetes Cluster Name. The k8s.cluster.name attribute won't be"+
+				" reported until Beyla can read the kube-system namespace, unless you explicitly set"+
+				" the BEYLA_KUBE_CLUSTER_NAME environment variable", "error", err)
+		}
+		wait = min(2*wait, clusterNameMaxRetryTime)
+		if !sleep(ctx, wait) {
+			return
+		}
+	}
+}
+
+// sleep returns false if the context is canceled before the provided time
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
 // fetchClusterName tries to automatically guess the cluster name from three major
 // cloud providers: EC2, GCP, Azure.
 // TODO: consider other providers (Alibaba, Oracle, etc...)
 func fetchClusterName(ctx context.Context) string {
-	log := log().With("func", "fetchClusterName")
+	log := klog().With("func", "fetchClusterName")
 	var clusterNameFetchers = map[string]clusterNameFetcher{
 		"EC2":   ec2ClusterNameFetcher,
 		"GCP":   gcpClusterNameFetcher,
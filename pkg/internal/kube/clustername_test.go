@@ -0,0 +1,93 @@
+package kube
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakek8sclientset "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestResolveClusterName(t *testing.T) {
+	fetched := ""
+	cloudClusterName = func(context.Context) string { return fetched }
+	retryTime = time.Millisecond
+	t.Cleanup(func() {
+		cloudClusterName = fetchClusterName
+		retryTime = clusterNameFailRetryTime
+	})
+	kubeSystem := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "the-uid"}}
+
+	t.Run("configured", func(t *testing.T) {
+		fetched = "from-cloud"
+		cn := ResolveClusterName(context.Background(), fakek8sclientset.NewSimpleClientset(kubeSystem), "the-cluster")
+		assert.Equal(t, "the-cluster", cn.Get())
+	})
+	t.Run("from cloud provider", func(t *testing.T) {
+		fetched = "from-cloud"
+		cn := ResolveClusterName(context.Background(), fakek8sclientset.NewSimpleClientset(kubeSystem), "")
+		require.Eventually(t, func() bool { return cn.Get() == "from-cloud" }, 5*time.Second, 10*time.Millisecond)
+	})
+	t.Run("from kube-system namespace", func(t *testing.T) {
+		fetched = ""
+		cn := ResolveClusterName(context.Background(), fakek8sclientset.NewSimpleClientset(kubeSystem), "")
+		require.Eventually(t, func() bool { return cn.Get() == "the-uid" }, 5*time.Second, 10*time.Millisecond)
+	})
+	t.Run("retries until resolved", func(t *testing.T) {
+		fetched = ""
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		client := fakek8sclientset.NewSimpleClientset()
+		cn := ResolveClusterName(ctx, client, "")
+		// GIVEN that the cluster name can't be resolved yet
+		time.Sleep(20 * time.Millisecond)
+		assert.Empty(t, cn.Get())
+		// WHEN the kube-system namespace becomes readable
+		_, err := client.CoreV1().Namespaces().Create(ctx, kubeSystem, metav1.CreateOptions{})
+		require.NoError(t, err)
+		// THEN the cluster name is eventually resolved
+		require.Eventually(t, func() bool { return cn.Get() == "the-uid" }, 5*time.Second, 10*time.Millisecond)
+	})
+	t.Run("nil instance", func(t *testing.T) {
+		var cn *ClusterName
+		assert.Empty(t, cn.Get())
+		assert.Empty(t, cn.Wait(context.Background(), time.Millisecond))
+	})
+}
+
+func TestClusterName_Wait(t *testing.T) {
+	fetched := make(chan string)
+	cloudClusterName = func(ctx context.Context) string {
+		select {
+		case name := <-fetched:
+			return name
+		case <-ctx.Done():
+			return ""
+		}
+	}
+	t.Cleanup(func() { cloudClusterName = fetchClusterName })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// GIVEN a cluster name that is being resolved
+	cn := ResolveClusterName(ctx, nil, "")
+	// THEN the wait times out while it is not resolved
+	assert.Empty(t, cn.Wait(ctx, 10*time.Millisecond))
+
+	// AND the wait returns as soon as it is resolved
+	waited := make(chan string)
+	go func() { waited <- cn.Wait(ctx, time.Minute) }()
+	fetched <- "from-cloud"
+	select {
+	case name := <-waited:
+		assert.Equal(t, "from-cloud", name)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "timeout waiting for the cluster name")
+	}
+	// AND the configured names don't need to be waited for
+	assert.Equal(t, "the-cluster", ResolveClusterName(ctx, nil, "the-cluster").Wait(ctx, time.Nanosecond))
+}
@@ -0,0 +1,112 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// EndpointSliceInfo contains the metadata of an EndpointSlice that is required to attribute
+// the IPs of its endpoints to the Service that they serve
+type EndpointSliceInfo struct {
+	// Informers need that internal object is an ObjectMeta instance
+	metav1.ObjectMeta
+	// ServiceName is the name of the Service that owns the EndpointSlice. The Service is
+	// in the same namespace as the EndpointSlice.
+	ServiceName string
+	// IPs of all the endpoints, including the not ready and terminating ones, so the traffic
+	// is still attributed to the Service during rollouts
+	IPs []string
+	// Ports of the endpoints. If empty, the Service does not restrict its ports.
+	Ports []uint16
+	// Headless is true if the Service has no cluster IP, so its clients connect directly to the
+	// endpoints (e.g. the pods of a StatefulSet)
+	Headless bool
+
+	// Excluded is true if the namespace of the Service is excluded from the decoration by the namespace filter
+	Excluded      bool
+	namespaceOnly *EndpointSliceInfo
+}
+
+func (k *Metadata) initEndpointSliceInformer(informerFactory informers.SharedInformerFactory) error {
+	log := klog().With("informer", "EndpointSlice")
+	slices := informerFactory.Discovery().V1().EndpointSlices().Informer()
+	// Transform any *discoveryv1.EndpointSlice instance into a *EndpointSliceInfo instance to save space
+	// in the informer's cache
+	if err := slices.SetTransform(func(i interface{}) (interface{}, error) {
+		es, ok := i.(*discoveryv1.EndpointSlice)
+		if !ok {
+			// it's Ok. The K8s library just informed from an entity
+			// that has been previously transformed/stored
+			if esi, ok := i.(*EndpointSliceInfo); ok {
+				return esi, nil
+			}
+			return nil, fmt.Errorf("was expecting an EndpointSlice. Got: %T", i)
+		}
+		info := &EndpointSliceInfo{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      es.Name,
+				Namespace: es.Namespace,
+				UID:       es.UID,
+			},
+			ServiceName: es.Labels[discoveryv1.LabelServiceName],
+		}
+		// the EndpointSlice controller labels the slices of the headless Services
+		_, info.Headless = es.Labels[v1.IsHeadlessService]
+		for i := range es.Endpoints {
+			for _, addr := range es.Endpoints[i].Addresses {
+				info.IPs = append(info.IPs, NormalizeIP(addr))
+			}
+		}
+		for i := range es.Ports {
+			if es.Ports[i].Port != nil {
+				info.Ports = append(info.Ports, uint16(*es.Ports[i].Port))
+			}
+		}
+		if !k.DecoratedNamespaces.Decorated(info.Namespace) {
+			info.Exclude()
+		}
+		if log.Enabled(context.TODO(), slog.LevelDebug) {
+			log.Debug("inserting EndpointSlice", "name", es.Name, "namespace", es.Namespace,
+				"service", info.ServiceName, "headless", info.Headless, "ips", info.IPs, "ports", info.Ports)
+		}
+		return info, nil
+	}); err != nil {
+		return fmt.Errorf("can't set EndpointSlices transform: %w", err)
+	}
+	if err := k.trackWatchFailures(log, slices); err != nil {
+		return fmt.Errorf("can't set EndpointSlices watch error handler: %w", err)
+	}
+
+	k.endpointSlices = append(k.endpointSlices, slices)
+	return nil
+}
+
+// ListEndpointSlices returns the metadata of all the EndpointSlices in the informers' stores
+func (k *Metadata) ListEndpointSlices() []*EndpointSliceInfo {
+	var infos []*EndpointSliceInfo
+	for _, slices := range k.endpointSlices {
+		for _, obj := range slices.GetStore().List() {
+			infos = append(infos, obj.(*EndpointSliceInfo))
+		}
+	}
+	return infos
+}
+
+// EndpointSlicesWatched returns whether the EndpointSlices informers are enabled, so the
+// EndpointSlices are kept up to date
+func (k *Metadata) EndpointSlicesWatched() bool {
+	return k.WatchEndpointSlices
+}
+
+// AddEndpointSliceEventHandler listens for the EndpointSlice events. It does nothing if the
+// EndpointSlices informers are not enabled.
+func (k *Metadata) AddEndpointSliceEventHandler(h cache.ResourceEventHandler) (*EventHandlerRegistration, error) {
+	return addEventHandler(k.endpointSlices, h)
+}
@@ -0,0 +1,364 @@
+package kube
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// FakeMetadata is an in-memory replacement of Metadata for testing its consumers, such as the Kubernetes
+// Database, without connecting to a cluster. The tests add, update and delete the objects, and the events are
+// delivered synchronously to the registered handlers, so they have been handled when the invoked method returns.
+// The objects are stored as they are provided, except that the namespace filter is applied to them.
+type FakeMetadata struct {
+	// DecoratedNamespaces marks the Pods and Services of the namespaces that are not decorated as Excluded,
+	// as Metadata does. It must be set before adding any object.
+	DecoratedNamespaces *NamespaceFilter
+	// ClusterName is returned by GetClusterName
+	ClusterName string
+
+	// eventsMut serializes the changes, so each handler receives the events in the same order as they happen
+	eventsMut sync.Mutex
+	// mt protects the stored objects and the handlers. It is not held while the handlers are invoked, so
+	// they can read the objects.
+	mt                sync.RWMutex
+	pods              fakeResource[*PodInfo]
+	endpointSlices    fakeResource[*EndpointSliceInfo]
+	services          fakeResource[*ServiceInfo]
+	replicaSets       map[string]*ReplicaSetInfo
+	jobCronJobs       map[string]string
+	nodes             map[string]*NodeInfo
+	namespaceLabels   map[string]map[string]string
+	containerHandlers []ContainerEventHandler
+	relisted          bool
+}
+
+// fakeResource stores the objects of a kind by namespace and name, and the handlers of their events
+type fakeResource[T any] struct {
+	objects  map[string]T
+	handlers []fakeHandler
+}
+
+type fakeHandler struct {
+	reg     *EventHandlerRegistration
+	handler cache.ResourceEventHandler
+}
+
+func NewFakeMetadata() *FakeMetadata {
+	return &FakeMetadata{
+		pods:            fakeResource[*PodInfo]{objects: map[string]*PodInfo{}},
+		endpointSlices:  fakeResource[*EndpointSliceInfo]{objects: map[string]*EndpointSliceInfo{}},
+		services:        fakeResource[*ServiceInfo]{objects: map[string]*ServiceInfo{}},
+		replicaSets:     map[string]*ReplicaSetInfo{},
+		jobCronJobs:     map[string]string{},
+		nodes:           map[string]*NodeInfo{},
+		namespaceLabels: map[string]map[string]string{},
+	}
+}
+
+// AddPod stores the Pod, which is delivered to the handlers as an Add event or, if a Pod with the same
+// namespace and name was stored, as an Update event
+func (f *FakeMetadata) AddPod(pod *PodInfo) {
+	if !f.DecoratedNamespaces.Decorated(pod.Namespace) {
+		pod.Exclude()
+	}
+	upsertFake(f, &f.pods, qName(pod.Namespace, pod.Name), pod)
+}
+
+// DeletePod removes the Pod, and notifies the deletion of its containers to the container event handlers
+func (f *FakeMetadata) DeletePod(namespace, name string) {
+	f.eventsMut.Lock()
+	defer f.eventsMut.Unlock()
+	f.mt.RLock()
+	pod, ok := f.pods.objects[qName(namespace, name)]
+	containerHandlers := slices.Clone(f.containerHandlers)
+	f.mt.RUnlock()
+	if !ok {
+		return
+	}
+	for _, h := range containerHandlers {
+		h.OnDeletion(pod.ContainerIDs)
+	}
+	deleteFake(f, &f.pods, qName(namespace, name))
+}
+
+// AddEndpointSlice stores the EndpointSlice, which is delivered to the handlers as an Add or Update event
+func (f *FakeMetadata) AddEndpointSlice(es *EndpointSliceInfo) {
+	if !f.DecoratedNamespaces.Decorated(es.Namespace) {
+		es.Exclude()
+	}
+	upsertFake(f, &f.endpointSlices, qName(es.Namespace, es.Name), es)
+}
+
+func (f *FakeMetadata) DeleteEndpointSlice(namespace, name string) {
+	f.eventsMut.Lock()
+	defer f.eventsMut.Unlock()
+	deleteFake(f, &f.endpointSlices, qName(namespace, name))
+}
+
+// AddService stores the Service, which is delivered to the handlers as an Add or Update event
+func (f *FakeMetadata) AddService(svc *ServiceInfo) {
+	svc.Excluded = !f.DecoratedNamespaces.Decorated(svc.Namespace)
+	upsertFake(f, &f.services, qName(svc.Namespace, svc.Name), svc)
+}
+
+func (f *FakeMetadata) DeleteService(namespace, name string) {
+	f.eventsMut.Lock()
+	defer f.eventsMut.Unlock()
+	deleteFake(f, &f.services, qName(namespace, name))
+}
+
+// AddReplicaSet stores the ReplicaSet, whose Deployment is returned by PodWithOwnerInfo for its Pods
+func (f *FakeMetadata) AddReplicaSet(rs *ReplicaSetInfo) {
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	f.replicaSets[qName(rs.Namespace, rs.Name)] = rs
+}
+
+func (f *FakeMetadata) DeleteReplicaSet(namespace, name string) {
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	delete(f.replicaSets, qName(namespace, name))
+}
+
+// SetJobCronJob stores the CronJob that owns the Job, which is returned by PodWithOwnerInfo for its Pods
+func (f *FakeMetadata) SetJobCronJob(namespace, job, cronJob string) {
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	f.jobCronJobs[qName(namespace, job)] = cronJob
+}
+
+func (f *FakeMetadata) AddNode(node *NodeInfo) {
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	f.nodes[node.Name] = node
+}
+
+func (f *FakeMetadata) SetNamespaceLabels(name string, labels map[string]string) {
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	f.namespaceLabels[name] = labels
+}
+
+// Relist simulates that the informers listed their objects again after a watch failure, so the next
+// invocation of Relisted returns true
+func (f *FakeMetadata) Relist() {
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	f.relisted = true
+}
+
+func (f *FakeMetadata) Relisted() bool {
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	relisted := f.relisted
+	f.relisted = false
+	return relisted
+}
+
+// upsertFake stores the object and delivers it to the handlers of its resource
+func upsertFake[T any](f *FakeMetadata, r *fakeResource[T], key string, obj T) {
+	f.eventsMut.Lock()
+	defer f.eventsMut.Unlock()
+	f.mt.Lock()
+	old, ok := r.objects[key]
+	r.objects[key] = obj
+	handlers := slices.Clone(r.handlers)
+	f.mt.Unlock()
+	for _, h := range handlers {
+		if ok {
+			h.handler.OnUpdate(old, obj)
+		} else {
+			h.handler.OnAdd(obj, false)
+		}
+	}
+}
+
+// deleteFake removes the object and notifies its handlers. The eventsMut must be held by the caller.
+func deleteFake[T any](f *FakeMetadata, r *fakeResource[T], key string) {
+	f.mt.Lock()
+	old, ok := r.objects[key]
+	delete(r.objects, key)
+	handlers := slices.Clone(r.handlers)
+	f.mt.Unlock()
+	if !ok {
+		return
+	}
+	for _, h := range handlers {
+		h.handler.OnDelete(old)
+	}
+}
+
+// addFakeHandler registers the handler, and delivers the currently stored objects to it before returning
+func addFakeHandler[T any](f *FakeMetadata, r *fakeResource[T], h cache.ResourceEventHandler) *EventHandlerRegistration {
+	f.eventsMut.Lock()
+	defer f.eventsMut.Unlock()
+	reg := &EventHandlerRegistration{}
+	reg.onRemove = func() {
+		f.mt.Lock()
+		defer f.mt.Unlock()
+		r.handlers = slices.DeleteFunc(r.handlers, func(fh fakeHandler) bool {
+			return fh.reg == reg
+		})
+	}
+	f.mt.Lock()
+	r.handlers = append(r.handlers, fakeHandler{reg: reg, handler: h})
+	stored := listFake(r)
+	f.mt.Unlock()
+	for _, obj := range stored {
+		h.OnAdd(obj, true)
+	}
+	return reg
+}
+
+// listFake returns the objects of the resource, sorted by namespace and name
+func listFake[T any](r *fakeResource[T]) []T {
+	keys := make([]string, 0, len(r.objects))
+	for key := range r.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	objs := make([]T, 0, len(keys))
+	for _, key := range keys {
+		objs = append(objs, r.objects[key])
+	}
+	return objs
+}
+
+func (f *FakeMetadata) AddPodEventHandler(h cache.ResourceEventHandler) (*EventHandlerRegistration, error) {
+	return addFakeHandler(f, &f.pods, h), nil
+}
+
+func (f *FakeMetadata) AddEndpointSliceEventHandler(h cache.ResourceEventHandler) (*EventHandlerRegistration, error) {
+	return addFakeHandler(f, &f.endpointSlices, h), nil
+}
+
+func (f *FakeMetadata) AddServiceEventHandler(h cache.ResourceEventHandler) (*EventHandlerRegistration, error) {
+	return addFakeHandler(f, &f.services, h), nil
+}
+
+func (f *FakeMetadata) AddContainerEventHandler(eh ContainerEventHandler) {
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	f.containerHandlers = append(f.containerHandlers, eh)
+}
+
+func (f *FakeMetadata) RemoveContainerEventHandler(eh ContainerEventHandler) {
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	f.containerHandlers = slices.DeleteFunc(f.containerHandlers, func(h ContainerEventHandler) bool {
+		return h == eh
+	})
+}
+
+// GetContainerPod returns the Pod of the container, whose ID can be provided in any of the forms that
+// Metadata.GetContainerPod accepts
+func (f *FakeMetadata) GetContainerPod(containerID string) (*PodInfo, bool) {
+	containerID = NormalizeContainerID(containerID)
+	if containerID == "" {
+		return nil, false
+	}
+	f.mt.RLock()
+	defer f.mt.RUnlock()
+	for _, pod := range listFake(&f.pods) {
+		for _, cid := range pod.ContainerIDs {
+			if cid == containerID ||
+				(len(containerID) == ShortContainerIDLen && strings.HasPrefix(cid, containerID)) {
+				return pod, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func (f *FakeMetadata) GetPod(namespace, name string) (*PodInfo, bool) {
+	f.mt.RLock()
+	defer f.mt.RUnlock()
+	pod, ok := f.pods.objects[qName(namespace, name)]
+	return pod, ok
+}
+
+func (f *FakeMetadata) ListPods() []*PodInfo {
+	f.mt.RLock()
+	defer f.mt.RUnlock()
+	return listFake(&f.pods)
+}
+
+func (f *FakeMetadata) ListEndpointSlices() []*EndpointSliceInfo {
+	f.mt.RLock()
+	defer f.mt.RUnlock()
+	return listFake(&f.endpointSlices)
+}
+
+func (f *FakeMetadata) ListServices() []*ServiceInfo {
+	f.mt.RLock()
+	defer f.mt.RUnlock()
+	return listFake(&f.services)
+}
+
+func (f *FakeMetadata) FetchPodOwnerInfo(pod *PodInfo) {
+	fetchPodOwnerInfo(pod, f.replicaSetDeployment, f.jobCronJob)
+}
+
+func (f *FakeMetadata) PodWithOwnerInfo(pod *PodInfo) *PodInfo {
+	return podWithOwnerInfo(pod, f.replicaSetDeployment, f.jobCronJob)
+}
+
+func (f *FakeMetadata) replicaSetDeployment(pod *PodInfo) (string, bool) {
+	f.mt.RLock()
+	defer f.mt.RUnlock()
+	rs, ok := f.replicaSets[qName(pod.Namespace, pod.Owner.Name)]
+	if !ok {
+		return "", false
+	}
+	return rs.DeploymentName, true
+}
+
+func (f *FakeMetadata) jobCronJob(pod *PodInfo) (string, bool) {
+	f.mt.RLock()
+	defer f.mt.RUnlock()
+	cronJob, ok := f.jobCronJobs[qName(pod.Namespace, pod.Owner.Name)]
+	return cronJob, ok
+}
+
+func (f *FakeMetadata) GetNamespaceLabels(name string) (map[string]string, bool) {
+	f.mt.RLock()
+	defer f.mt.RUnlock()
+	labels, ok := f.namespaceLabels[name]
+	return labels, ok
+}
+
+func (f *FakeMetadata) GetNodeInfo(name string) (*NodeInfo, bool) {
+	f.mt.RLock()
+	defer f.mt.RUnlock()
+	node, ok := f.nodes[name]
+	return node, ok
+}
+
+func (f *FakeMetadata) GetClusterName() string {
+	return f.ClusterName
+}
+
+func (f *FakeMetadata) NamespaceFilter() *NamespaceFilter {
+	return f.DecoratedNamespaces
+}
+
+// EndpointSlicesWatched returns true, as the EndpointSlices are always delivered to their handlers
+func (f *FakeMetadata) EndpointSlicesWatched() bool {
+	return true
+}
+
+// WaitForCacheSync returns immediately, as the objects are stored synchronously
+func (f *FakeMetadata) WaitForCacheSync(_ context.Context) error {
+	return nil
+}
+
+// ResyncPeriod returns 0, as the objects are never delivered again to the handlers
+func (f *FakeMetadata) ResyncPeriod() time.Duration {
+	return 0
+}
@@ -0,0 +1,82 @@
+package kube
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestFakeMetadata_PodEvents(t *testing.T) {
+	fake := NewFakeMetadata()
+	fake.AddPod(&PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "ns"}})
+
+	// GIVEN a handler that is registered after a pod was stored
+	var events []string
+	reg, err := fake.AddPodEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) { events = append(events, "add "+obj.(*PodInfo).Name) },
+		UpdateFunc: func(_, newObj interface{}) {
+			events = append(events, "update "+newObj.(*PodInfo).Name)
+		},
+		DeleteFunc: func(obj interface{}) { events = append(events, "delete "+obj.(*PodInfo).Name) },
+	})
+	require.NoError(t, err)
+	var containers deletedContainers
+	fake.AddContainerEventHandler(&containers)
+
+	// WHEN pods are added, updated and deleted
+	fake.AddPod(&PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "ns"}, ContainerIDs: []string{"c1"}})
+	fake.AddPod(&PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "ns"}})
+	fake.DeletePod("ns", "b")
+	fake.DeletePod("ns", "unknown")
+
+	// THEN the stored pod and the changes have been delivered before returning
+	assert.Equal(t, []string{"add a", "add b", "update a", "delete b"}, events)
+	assert.Equal(t, []string{"c1"}, containers.get())
+	assert.Len(t, fake.ListPods(), 1)
+
+	// AND WHEN the handler is removed
+	require.NoError(t, reg.Remove())
+	fake.AddPod(&PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "ns"}})
+	// THEN it doesn't receive the events anymore
+	assert.Len(t, events, 4)
+}
+
+func TestFakeMetadata_Lookups(t *testing.T) {
+	filter, err := NewNamespaceFilter(nil, []string{"kube-*"})
+	require.NoError(t, err)
+	fake := NewFakeMetadata()
+	fake.DecoratedNamespaces = filter
+	fake.AddPod(&PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"},
+		Owner: &Owner{Type: OwnerReplicaSet, Name: "web-7d4b9"}, ContainerIDs: []string{"40c03570b6f4c30bc8d6"}})
+	fake.AddPod(&PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "dns", Namespace: "kube-system"}})
+
+	// the containers are found by any form of their ID
+	for _, cid := range []string{"40c03570b6f4c30bc8d6", "containerd://40c03570b6f4c30bc8d6", "40c03570b6f4"} {
+		pod, ok := fake.GetContainerPod(cid)
+		require.True(t, ok, cid)
+		assert.Equal(t, "web", pod.Name)
+	}
+	// the namespace filter is applied to the stored objects
+	pod, ok := fake.GetPod("kube-system", "dns")
+	require.True(t, ok)
+	assert.True(t, pod.Excluded)
+
+	// the Deployment is only known after the ReplicaSet is stored
+	pod, _ = fake.GetPod("shop", "web")
+	assert.Same(t, pod, fake.PodWithOwnerInfo(pod))
+	fake.AddReplicaSet(&ReplicaSetInfo{ObjectMeta: metav1.ObjectMeta{Name: "web-7d4b9", Namespace: "shop"},
+		DeploymentName: "web"})
+	withOwner := fake.PodWithOwnerInfo(pod)
+	require.NotNil(t, withOwner.Owner.Owner)
+	assert.Equal(t, "web", withOwner.Owner.Owner.Name)
+	assert.Nil(t, pod.Owner.Owner)
+
+	// each relist is reported once
+	assert.False(t, fake.Relisted())
+	fake.Relist()
+	assert.True(t, fake.Relisted())
+	assert.False(t, fake.Relisted())
+}
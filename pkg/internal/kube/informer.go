@@ -2,11 +2,15 @@ package kube
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
@@ -20,10 +24,21 @@ import (
 )
 
 const (
-	kubeConfigEnvVariable  = "KUBECONFIG"
-	syncTime               = 10 * time.Minute
+	kubeConfigEnvVariable = "KUBECONFIG"
+	syncTime              = 10 * time.Minute
+	// DefaultSyncTimeout is the maximum time that the Kubernetes decoration waits for the informers
+	// to sync, if no other timeout is provided
+	DefaultSyncTimeout     = 30 * time.Second
 	IndexPodByContainerIDs = "idx_pod_by_container"
-	IndexReplicaSetNames   = "idx_rs"
+	// IndexPodByShortContainerIDs indexes the pods by the truncated form of their container IDs, as
+	// shown by the container runtimes' CLIs
+	IndexPodByShortContainerIDs = "idx_pod_by_short_container"
+	IndexReplicaSetNames        = "idx_rs"
+
+	// ServiceNameAnnotation explicitly overrides the service name of the applications running in a Pod
+	ServiceNameAnnotation = "resource.opentelemetry.io/service.name"
+	// ServiceNamespaceAnnotation explicitly overrides the service namespace of the applications running in a Pod
+	ServiceNamespaceAnnotation = "resource.opentelemetry.io/service.namespace"
 )
 
 func klog() *slog.Logger {
@@ -38,11 +53,98 @@ type ContainerEventHandler interface {
 
 // Metadata stores an in-memory copy of the different Kubernetes objects whose metadata is relevant to us.
 type Metadata struct {
-	// pods and replicaSets cache the different K8s types to custom, smaller object types
-	pods        cache.SharedIndexInformer
-	replicaSets cache.SharedIndexInformer
-
+	// pods and replicaSets cache the different K8s types to custom, smaller object types.
+	// There is an informer of each type for each watched namespace, or a single one for the
+	// whole cluster. The replicaSets are not created if DeploymentsFromReplicaSetNames is set.
+	pods        []cache.SharedIndexInformer
+	replicaSets []cache.SharedIndexInformer
+	// endpointSlices are only created if WatchEndpointSlices is set
+	endpointSlices []cache.SharedIndexInformer
+	// services are only created if WatchServices is set
+	services []cache.SharedIndexInformer
+	// namespaces are only created if WatchNamespaceLabels is set
+	namespaces []cache.SharedIndexInformer
+	// nodes are only created if WatchNodes is set
+	nodes []cache.SharedIndexInformer
+
+	// WatchEndpointSlices enables the EndpointSlices informers. It must be set before
+	// the informers are initialized.
+	WatchEndpointSlices bool
+	// WatchServices enables the Services informers, which provide the hostnames of the ExternalName
+	// Services and the selectors of the other Services. It must be set before the informers are initialized.
+	WatchServices bool
+	// WatchNamespaceLabels enables the Namespaces informers, which provide the labels of the
+	// watched namespaces. It must be set before the informers are initialized.
+	WatchNamespaceLabels bool
+	// WatchNodes enables the Nodes informer, which provides the topology of the Nodes where
+	// the Pods are scheduled. It must be set before the informers are initialized.
+	WatchNodes bool
+	// DeploymentsFromReplicaSetNames disables the ReplicaSets informers, which are among the biggest memory
+	// consumers, and derives the Deployment of the Pods that are owned by a ReplicaSet from the ReplicaSet name.
+	// It must be set before the informers are initialized.
+	DeploymentsFromReplicaSetNames bool
+	// ReplicaSetLookupCacheLen enables, if DeploymentsFromReplicaSetNames is set, fetching from the API the
+	// ReplicaSets whose Deployment can't be derived from their name. The fetched ReplicaSets are kept in a
+	// cache of the provided length. If 0, the Deployment of these ReplicaSets is not reported.
+	ReplicaSetLookupCacheLen int
+	// JobLookupCacheLen enables fetching from the API the Jobs of the Pods, to know the CronJob that owns
+	// them. The fetched Jobs are kept in a cache of the provided length. If 0, the CronJobs are not reported.
+	JobLookupCacheLen int
+	// Kubelet, if set, makes InitFromKubelet fetch the Pods of the local node from the kubelet, instead of
+	// watching them from the API server. The rest of the informers are not started, so the Watch* fields
+	// are ignored, and the Deployments are derived from the ReplicaSet names.
+	Kubelet *KubeletConfig
+	// Namespaces restricts the informers to the objects of the provided namespaces. If empty,
+	// the objects of the whole cluster are watched. It must be set before the informers are initialized.
+	Namespaces []string
+	// DecoratedNamespaces marks the Pods and Services of the namespaces that are not decorated as Excluded,
+	// so the filter is only evaluated when they are stored. It must be set before the informers are initialized.
+	DecoratedNamespaces *NamespaceFilter
+	// ClusterName provides the name of the cluster. It is resolved by the caller, so the same name is
+	// shared with the network flows decoration. If nil, the name of the cluster is not reported.
+	ClusterName *ClusterName
+
+	// replicaSetLookups is only created if DeploymentsFromReplicaSetNames and ReplicaSetLookupCacheLen are set
+	replicaSetLookups *replicaSetLookups
+	// jobLookups is only created if JobLookupCacheLen is set
+	jobLookups *jobLookups
+
+	// synced is closed when the caches of all the informers are synced
+	synced <-chan struct{}
+
+	containerHandlersMut   sync.RWMutex
 	containerEventHandlers []ContainerEventHandler
+
+	// resource version of the informers whose watch failed, until they list their objects again
+	watchFailuresMut sync.Mutex
+	watchFailures    map[cache.SharedIndexInformer]string
+}
+
+// EventHandlerRegistration of an event handler in the informers of all the watched namespaces.
+// It allows removing the handler.
+type EventHandlerRegistration struct {
+	informers []cache.SharedIndexInformer
+	handles   []cache.ResourceEventHandlerRegistration
+	// removed interrupts the replay of the stored objects, if it is still ongoing
+	removed atomic.Bool
+	// onRemove unregisters the handlers that are not registered in any informer, as in FakeMetadata
+	onRemove func()
+}
+
+// Remove the event handler from the informers. The handler might still receive the events that
+// were being dispatched when it was removed.
+func (r *EventHandlerRegistration) Remove() error {
+	r.removed.Store(true)
+	if r.onRemove != nil {
+		r.onRemove()
+	}
+	var errs []error
+	for i, handle := range r.handles {
+		if err := r.informers[i].RemoveEventHandler(handle); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // PodInfo contains precollected metadata for Pods, Nodes and Services.
@@ -54,13 +156,59 @@ type PodInfo struct {
 	// Informers need that internal object is an ObjectMeta instance
 	metav1.ObjectMeta
 	NodeName string
+	// ServiceAccount is the name of the service account that provides the identity of the Pod
+	ServiceAccount string
 
 	Owner *Owner
 
-	// StartTimeStr caches value of ObjectMeta.StartTimestamp.String()
+	// StartTimeStr is the time when the Pod was started by the kubelet, in RFC3339 format.
+	// If the Pod has not been started yet, it is the creation time of the Pod.
 	StartTimeStr string
 	ContainerIDs []string
-	IPs          []string
+	// ContainerRestarts is the restart count of each container, by container ID. It is
+	// updated each time the Pod status is updated.
+	ContainerRestarts map[string]int32
+	// Containers contains the name and image of each container, by container ID
+	Containers map[string]ContainerInfo
+	IPs        []string
+	// HostIPs and HostPorts are only set for the Pods that receive traffic addressed to their node:
+	// the Pods in the host network, identified by their container ports, and the Pods that declare
+	// hostPort mappings, identified by their host ports.
+	HostIPs   []string
+	HostPorts []uint16
+
+	// Excluded is true if the namespace of the Pod is excluded from the decoration by the namespace filter
+	Excluded      bool
+	namespaceOnly *PodInfo
+}
+
+// ContainerInfo contains the metadata of a container that is used to name the service that runs inside it
+type ContainerInfo struct {
+	Name  string
+	Image string
+}
+
+// Container returns the name and image of the container with the provided ID, which can be provided
+// either in the raw form or in the runtime-prefixed form. It returns false if the container status
+// has not been reported yet.
+func (pi *PodInfo) Container(containerID string) (ContainerInfo, bool) {
+	ci, ok := pi.Containers[NormalizeContainerID(containerID)]
+	return ci, ok
+}
+
+// FullContainerID returns the full ID of the container of the pod whose ID starts with the provided,
+// possibly truncated, ID. It returns false if the pod doesn't have such container.
+func (pi *PodInfo) FullContainerID(containerID string) (string, bool) {
+	containerID = NormalizeContainerID(containerID)
+	if containerID == "" {
+		return "", false
+	}
+	for _, cid := range pi.ContainerIDs {
+		if strings.HasPrefix(cid, containerID) {
+			return cid, true
+		}
+	}
+	return "", false
 }
 
 type ReplicaSetInfo struct {
@@ -72,11 +220,24 @@ func qName(namespace, name string) string {
 	return namespace + "/" + name
 }
 
+// ShortContainerIDLen is the length of the truncated container IDs
+const ShortContainerIDLen = 12
+
 var podIndexer = cache.Indexers{
 	IndexPodByContainerIDs: func(obj interface{}) ([]string, error) {
 		pi := obj.(*PodInfo)
 		return pi.ContainerIDs, nil
 	},
+	IndexPodByShortContainerIDs: func(obj interface{}) ([]string, error) {
+		pi := obj.(*PodInfo)
+		short := make([]string, 0, len(pi.ContainerIDs))
+		for _, cid := range pi.ContainerIDs {
+			if len(cid) > ShortContainerIDLen {
+				short = append(short, cid[:ShortContainerIDLen])
+			}
+		}
+		return short, nil
+	},
 }
 
 // usually all the data required by the discovery and enrichement is inside
@@ -91,22 +252,57 @@ var replicaSetIndexer = cache.Indexers{
 	},
 }
 
-// GetContainerPod fetches metadata from a Pod given the name of one of its containers
+// GetContainerPod fetches metadata from a Pod given the ID of one of its containers. The ID can be
+// provided either as a raw hex ID, as found in the cgroup entries, or in the runtime-prefixed form
+// that the container runtime reports in the Pod status (e.g. containerd://<id>). The ID can also be
+// truncated to ShortContainerIDLen characters.
 func (k *Metadata) GetContainerPod(containerID string) (*PodInfo, bool) {
-	objs, err := k.pods.GetIndexer().ByIndex(IndexPodByContainerIDs, containerID)
-	if err != nil {
-		klog().Debug("error accessing index by container ID. Ignoring", "error", err, "containerID", containerID)
-		return nil, false
+	containerID = NormalizeContainerID(containerID)
+	index := IndexPodByContainerIDs
+	if len(containerID) == ShortContainerIDLen {
+		index = IndexPodByShortContainerIDs
 	}
-	if len(objs) == 0 {
-		return nil, false
+	for _, pods := range k.pods {
+		objs, err := pods.GetIndexer().ByIndex(index, containerID)
+		if err != nil {
+			klog().Debug("error accessing index by container ID. Ignoring", "error", err, "containerID", containerID)
+			return nil, false
+		}
+		if len(objs) > 0 {
+			return objs[0].(*PodInfo), true
+		}
+	}
+	return nil, false
+}
+
+// ListPods returns the metadata of all the Pods in the informers' stores
+func (k *Metadata) ListPods() []*PodInfo {
+	var infos []*PodInfo
+	for _, pods := range k.pods {
+		for _, obj := range pods.GetStore().List() {
+			infos = append(infos, obj.(*PodInfo))
+		}
+	}
+	return infos
+}
+
+// GetPod fetches the metadata of the Pod with the provided namespace and name
+func (k *Metadata) GetPod(namespace, name string) (*PodInfo, bool) {
+	for _, pods := range k.pods {
+		obj, ok, err := pods.GetStore().GetByKey(qName(namespace, name))
+		if err != nil {
+			klog().Debug("error accessing the Pods store. Ignoring", "error", err, "namespace", namespace, "name", name)
+			return nil, false
+		}
+		if ok {
+			return obj.(*PodInfo), true
+		}
 	}
-	return objs[0].(*PodInfo), true
+	return nil, false
 }
 
-func (k *Metadata) initPodInformer(informerFactory informers.SharedInformerFactory) error {
+func (k *Metadata) initPodInformer(pods cache.SharedIndexInformer) error {
 	log := klog().With("informer", "Pod")
-	pods := informerFactory.Core().V1().Pods().Informer()
 
 	k.initContainerListeners(log, pods)
 
@@ -122,69 +318,163 @@ func (k *Metadata) initPodInformer(informerFactory informers.SharedInformerFacto
 			}
 			return nil, fmt.Errorf("was expecting a Pod. Got: %T", i)
 		}
-		containerIDs := make([]string, 0,
-			len(pod.Status.ContainerStatuses)+
-				len(pod.Status.InitContainerStatuses)+
-				len(pod.Status.EphemeralContainerStatuses))
-		for i := range pod.Status.ContainerStatuses {
-			containerIDs = append(containerIDs,
-				rmContainerIDSchema(pod.Status.ContainerStatuses[i].ContainerID))
+		info := podInfo(pod)
+		if !k.DecoratedNamespaces.Decorated(info.Namespace) {
+			info.Exclude()
 		}
-		for i := range pod.Status.InitContainerStatuses {
-			containerIDs = append(containerIDs,
-				rmContainerIDSchema(pod.Status.InitContainerStatuses[i].ContainerID))
-		}
-		for i := range pod.Status.EphemeralContainerStatuses {
-			containerIDs = append(containerIDs,
-				rmContainerIDSchema(pod.Status.EphemeralContainerStatuses[i].ContainerID))
-		}
-
-		ips := make([]string, 0, len(pod.Status.PodIPs))
-		for _, ip := range pod.Status.PodIPs {
-			// ignoring host-networked Pod IPs
-			if ip.IP != pod.Status.HostIP {
-				ips = append(ips, ip.IP)
-			}
-		}
-
-		owner := OwnerFromPodInfo(pod)
-		startTime := pod.GetCreationTimestamp().String()
 		if log.Enabled(context.TODO(), slog.LevelDebug) {
-			log.Debug("inserting pod", "name", pod.Name, "namespace", pod.Namespace,
-				"uid", pod.UID, "owner", owner,
-				"node", pod.Spec.NodeName, "startTime", startTime,
-				"containerIDs", containerIDs)
-		}
-		return &PodInfo{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      pod.Name,
-				Namespace: pod.Namespace,
-				UID:       pod.UID,
-				Labels:    pod.Labels,
-			},
-			Owner:        owner,
-			NodeName:     pod.Spec.NodeName,
-			StartTimeStr: startTime,
-			ContainerIDs: containerIDs,
-			IPs:          ips,
-		}, nil
+			log.Debug("inserting pod", "name", info.Name, "namespace", info.Namespace,
+				"uid", info.UID, "owner", info.Owner,
+				"node", info.NodeName, "startTime", info.StartTimeStr,
+				"containerIDs", info.ContainerIDs)
+		}
+		return info, nil
 	}); err != nil {
 		return fmt.Errorf("can't set pods transform: %w", err)
 	}
 	if err := pods.AddIndexers(podIndexer); err != nil {
 		return fmt.Errorf("can't add indexers to Pods informer: %w", err)
 	}
+	if err := k.trackWatchFailures(log, pods); err != nil {
+		return fmt.Errorf("can't set Pods watch error handler: %w", err)
+	}
 
-	k.pods = pods
+	k.pods = append(k.pods, pods)
 	return nil
 }
 
+// podInfo copies the fields of the Pod that are consumed by Beyla, so the informer's cache stores the
+// PodInfo instead of the whole Pod, with its spec, managed fields and the rest of its status
+func podInfo(pod *v1.Pod) *PodInfo {
+	containers := len(pod.Status.ContainerStatuses) +
+		len(pod.Status.InitContainerStatuses) +
+		len(pod.Status.EphemeralContainerStatuses)
+	containerIDs := make([]string, 0, containers)
+	restarts := make(map[string]int32, containers)
+	containerInfos := make(map[string]ContainerInfo, containers)
+	// the init and ephemeral containers are indexed too, as they can run instrumented processes. The
+	// ephemeral containers are added to the status of the existing Pod, so they are indexed on its updates.
+	for _, statuses := range [][]v1.ContainerStatus{
+		pod.Status.ContainerStatuses,
+		pod.Status.InitContainerStatuses,
+		pod.Status.EphemeralContainerStatuses,
+	} {
+		for i := range statuses {
+			cid := NormalizeContainerID(statuses[i].ContainerID)
+			// the containers that are waiting to be created don't have an ID yet
+			if cid == "" {
+				continue
+			}
+			containerIDs = append(containerIDs, cid)
+			restarts[cid] = statuses[i].RestartCount
+			containerInfos[cid] = ContainerInfo{Name: statuses[i].Name, Image: statuses[i].Image}
+		}
+	}
+
+	ips := make([]string, 0, len(pod.Status.PodIPs))
+	hostIP := NormalizeIP(pod.Status.HostIP)
+	for _, ip := range pod.Status.PodIPs {
+		// ignoring host-networked Pod IPs
+		if podIP := NormalizeIP(ip.IP); podIP != hostIP {
+			ips = append(ips, podIP)
+		}
+	}
+
+	var hostIPs []string
+	var hostPorts []uint16
+	if pod.Spec.HostNetwork {
+		hostIPs, hostPorts = hostNetworkAddresses(pod)
+	} else {
+		hostIPs, hostPorts = hostPortAddresses(pod)
+	}
+
+	owner := OwnerFromPodInfo(pod)
+	startTime := pod.GetCreationTimestamp().UTC().Format(time.RFC3339)
+	if pod.Status.StartTime != nil {
+		startTime = pod.Status.StartTime.UTC().Format(time.RFC3339)
+	}
+	return &PodInfo{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              pod.Name,
+			Namespace:         pod.Namespace,
+			UID:               pod.UID,
+			CreationTimestamp: pod.CreationTimestamp,
+			Labels:            pod.Labels,
+			Annotations:       serviceAnnotations(pod.Annotations),
+		},
+		Owner:             owner,
+		NodeName:          pod.Spec.NodeName,
+		ServiceAccount:    pod.Spec.ServiceAccountName,
+		StartTimeStr:      startTime,
+		ContainerIDs:      containerIDs,
+		ContainerRestarts: restarts,
+		Containers:        containerInfos,
+		IPs:               ips,
+		HostIPs:           hostIPs,
+		HostPorts:         hostPorts,
+	}
+}
+
+// hostNetworkAddresses returns the node IPs and the container ports of a Pod in the host network
+func hostNetworkAddresses(pod *v1.Pod) ([]string, []uint16) {
+	ips := make([]string, 0, len(pod.Status.PodIPs))
+	for _, ip := range pod.Status.PodIPs {
+		ips = append(ips, NormalizeIP(ip.IP))
+	}
+	if len(ips) == 0 && pod.Status.HostIP != "" {
+		ips = append(ips, NormalizeIP(pod.Status.HostIP))
+	}
+	var ports []uint16
+	seen := map[int32]struct{}{}
+	for _, containers := range [][]v1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for i := range containers {
+			for _, port := range containers[i].Ports {
+				if _, ok := seen[port.ContainerPort]; ok || port.ContainerPort <= 0 {
+					continue
+				}
+				seen[port.ContainerPort] = struct{}{}
+				ports = append(ports, uint16(port.ContainerPort))
+			}
+		}
+	}
+	return ips, ports
+}
+
+// hostPortAddresses returns the node IPs and the declared host ports of a Pod that is not in the host
+// network, or nil if it does not map any host port
+func hostPortAddresses(pod *v1.Pod) ([]string, []uint16) {
+	var ports []uint16
+	for i := range pod.Spec.Containers {
+		for _, port := range pod.Spec.Containers[i].Ports {
+			if port.HostPort > 0 && !slices.Contains(ports, uint16(port.HostPort)) {
+				ports = append(ports, uint16(port.HostPort))
+			}
+		}
+	}
+	if len(ports) == 0 {
+		return nil, nil
+	}
+	ips := make([]string, 0, len(pod.Status.HostIPs))
+	for _, ip := range pod.Status.HostIPs {
+		ips = append(ips, NormalizeIP(ip.IP))
+	}
+	if len(ips) == 0 && pod.Status.HostIP != "" {
+		ips = append(ips, NormalizeIP(pod.Status.HostIP))
+	}
+	return ips, ports
+}
+
 // initContainerListeners listens for deletions of pods, to forward them to the ContainerEventHandler subscribers.
 func (k *Metadata) initContainerListeners(log *slog.Logger, pods cache.SharedIndexInformer) {
 	if _, err := pods.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		DeleteFunc: func(obj interface{}) {
-			pod := obj.(*PodInfo)
+			pod, ok := DeletedObject[*PodInfo](obj)
+			if !ok {
+				return
+			}
 			log.Debug("deleting containers for pod", "pod", pod.Name, "containers", pod.ContainerIDs)
+			k.containerHandlersMut.RLock()
+			defer k.containerHandlersMut.RUnlock()
 			for _, listener := range k.containerEventHandlers {
 				listener.OnDeletion(pod.ContainerIDs)
 			}
@@ -195,27 +485,32 @@ func (k *Metadata) initContainerListeners(log *slog.Logger, pods cache.SharedInd
 	}
 }
 
-// rmContainerIDSchema extracts the hex ID of a container ID that is provided in the form:
+// NormalizeContainerID extracts the lowercase hex ID of a container ID that can be provided in the
+// form reported by any container runtime, such as:
 // containerd://40c03570b6f4c30bc8d69923d37ee698f5cfcced92c7b7df1c47f6f7887378a9
-func rmContainerIDSchema(containerID string) string {
+// docker://40c03570b6f4c30bc8d69923d37ee698f5cfcced92c7b7df1c47f6f7887378a9
+// cri-o://40c03570b6f4c30bc8d69923d37ee698f5cfcced92c7b7df1c47f6f7887378a9
+func NormalizeContainerID(containerID string) string {
 	if parts := strings.Split(containerID, "://"); len(parts) > 1 {
-		return parts[1]
+		containerID = parts[1]
 	}
-	return containerID
+	return strings.ToLower(strings.TrimSpace(containerID))
 }
 
 // GetReplicaSetInfo fetches metadata from a ReplicaSet given its name
 func (k *Metadata) GetReplicaSetInfo(namespace, name string) (*ReplicaSetInfo, bool) {
-	objs, err := k.replicaSets.GetIndexer().ByIndex(IndexReplicaSetNames, qName(namespace, name))
-	if err != nil {
-		klog().Debug("error accessing ReplicaSet index by name. Ignoring",
-			"error", err, "name", name)
-		return nil, false
-	}
-	if len(objs) == 0 {
-		return nil, false
+	for _, rss := range k.replicaSets {
+		objs, err := rss.GetIndexer().ByIndex(IndexReplicaSetNames, qName(namespace, name))
+		if err != nil {
+			klog().Debug("error accessing ReplicaSet index by name. Ignoring",
+				"error", err, "name", name)
+			return nil, false
+		}
+		if len(objs) > 0 {
+			return objs[0].(*ReplicaSetInfo), true
+		}
 	}
-	return objs[0].(*ReplicaSetInfo), true
+	return nil, false
 }
 
 func (k *Metadata) initReplicaSetInformer(informerFactory informers.SharedInformerFactory) error {
@@ -233,25 +528,12 @@ func (k *Metadata) initReplicaSetInformer(informerFactory informers.SharedInform
 			}
 			return nil, fmt.Errorf("was expecting a ReplicaSet. Got: %T", i)
 		}
-		var deployment string
-		for i := range rs.OwnerReferences {
-			or := &rs.OwnerReferences[i]
-			if or.APIVersion == "apps/v1" && or.Kind == "Deployment" {
-				deployment = or.Name
-				break
-			}
-		}
+		rsi := replicaSetInfo(rs)
 		if log.Enabled(context.TODO(), slog.LevelDebug) {
 			log.Debug("inserting ReplicaSet", "name", rs.Name, "namespace", rs.Namespace,
-				"deployment", deployment)
-		}
-		return &ReplicaSetInfo{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      rs.Name,
-				Namespace: rs.Namespace,
-			},
-			DeploymentName: deployment,
-		}, nil
+				"deployment", rsi.DeploymentName)
+		}
+		return rsi, nil
 	}); err != nil {
 		return fmt.Errorf("can't set pods transform: %w", err)
 	}
@@ -259,16 +541,111 @@ func (k *Metadata) initReplicaSetInformer(informerFactory informers.SharedInform
 		return fmt.Errorf("can't add %s indexer to ReplicaSets informer: %w", IndexReplicaSetNames, err)
 	}
 
-	k.replicaSets = rss
+	k.replicaSets = append(k.replicaSets, rss)
 	return nil
 }
 
+// replicaSetInfo copies the name of the ReplicaSet and of the Deployment that owns it, if any
+func replicaSetInfo(rs *appsv1.ReplicaSet) *ReplicaSetInfo {
+	var deployment string
+	for i := range rs.OwnerReferences {
+		or := &rs.OwnerReferences[i]
+		if or.APIVersion == "apps/v1" && or.Kind == "Deployment" {
+			deployment = or.Name
+			break
+		}
+	}
+	return &ReplicaSetInfo{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      rs.Name,
+			Namespace: rs.Namespace,
+		},
+		DeploymentName: deployment,
+	}
+}
+
 func (k *Metadata) InitFromClient(ctx context.Context, client kubernetes.Interface, timeout time.Duration) error {
-	// Initialization variables
+	if k.DeploymentsFromReplicaSetNames && k.ReplicaSetLookupCacheLen > 0 {
+		k.replicaSetLookups = newReplicaSetLookups(client, k.ReplicaSetLookupCacheLen)
+	}
+	if k.JobLookupCacheLen > 0 {
+		k.jobLookups = newJobLookups(client, k.JobLookupCacheLen)
+	}
 	return k.initInformers(ctx, client, timeout)
 }
 
+// InitFromKubelet starts a Pods informer that is fed from the kubelet, as configured in the Kubelet field,
+// so Beyla doesn't need permissions to list and watch the objects of the cluster. Only the Pods of the local
+// node are known, so the traffic to the Pods of other nodes is not decorated.
+func (k *Metadata) InitFromKubelet(ctx context.Context, timeout time.Duration) error {
+	if k.Kubelet == nil {
+		return errors.New("kubelet configuration is missing")
+	}
+	kubelet, err := newKubeletPods(*k.Kubelet, k.Namespaces)
+	if err != nil {
+		return err
+	}
+	pods := cache.NewSharedIndexInformer(kubelet.listWatch(), &v1.Pod{}, syncTime, cache.Indexers{})
+	if err := k.initPodInformer(pods); err != nil {
+		return err
+	}
+	log := klog().With("endpoint", k.Kubelet.Endpoint)
+	log.Debug("starting kubelet Pods informer, waiting for syncronization")
+	go pods.Run(ctx.Done())
+	synced := make(chan struct{})
+	go func() {
+		if cache.WaitForCacheSync(ctx.Done(), pods.HasSynced) {
+			close(synced)
+		}
+	}()
+	k.synced = synced
+	AwaitCacheSync(ctx, log, k.WaitForCacheSync, timeout)
+	return nil
+}
+
+// GetClusterName returns the name of the cluster, or an empty string if it is not resolved yet
+func (k *Metadata) GetClusterName() string {
+	return k.ClusterName.Get()
+}
+
+// NamespaceFilter returns the filter of the namespaces whose Pods and Services are decorated
+func (k *Metadata) NamespaceFilter() *NamespaceFilter {
+	return k.DecoratedNamespaces
+}
+
+// ClientConfig selects the API server that the Kubernetes clients connect to, which can be the API
+// server of a remote cluster
+type ClientConfig struct {
+	// KubeconfigPath is the kubeconfig file. If empty, the file in the KUBECONFIG environment variable or,
+	// if not set, in $HOME/.kube/config is used. If it does not exist, the in-cluster configuration is used.
+	KubeconfigPath string
+	// Context selects a context of the kubeconfig file instead of its current context. The in-cluster
+	// configuration is not used as fallback if the context is set.
+	Context string
+	// APIServerURL, if set, connects to the provided API server instead of loading a kubeconfig file
+	APIServerURL string
+	// TokenPath is the file with the bearer token that authenticates to the APIServerURL. It is read
+	// again periodically, so the token can be rotated.
+	TokenPath string
+	// CAPath is the file with the CA certificates that verify the serving certificate of the APIServerURL.
+	// If empty, the system CA certificates are used.
+	CAPath string
+}
+
 func LoadConfig(kubeConfigPath string) (*rest.Config, error) {
+	return ClientConfig{KubeconfigPath: kubeConfigPath}.Load()
+}
+
+// Load returns the configuration of the clients that connect to the selected API server
+func (c ClientConfig) Load() (*rest.Config, error) {
+	if c.APIServerURL != "" {
+		return &rest.Config{
+			Host:            c.APIServerURL,
+			BearerTokenFile: c.TokenPath,
+			TLSClientConfig: rest.TLSClientConfig{CAFile: c.CAPath},
+		}, nil
+	}
+	kubeConfigPath := c.KubeconfigPath
 	// if no config path is provided, load it from the env variable
 	if kubeConfigPath == "" {
 		kubeConfigPath = os.Getenv(kubeConfigEnvVariable)
@@ -281,6 +658,16 @@ func LoadConfig(kubeConfigPath string) (*rest.Config, error) {
 		}
 		kubeConfigPath = path.Join(homeDir, ".kube", "config")
 	}
+	if c.Context != "" {
+		config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeConfigPath},
+			&clientcmd.ConfigOverrides{CurrentContext: c.Context},
+		).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("can't load context %q from %s: %w", c.Context, kubeConfigPath, err)
+		}
+		return config, nil
+	}
 	config, err := clientcmd.BuildConfigFromFlags("", kubeConfigPath)
 	if err == nil {
 		return config, nil
@@ -296,80 +683,298 @@ func LoadConfig(kubeConfigPath string) (*rest.Config, error) {
 }
 
 func (k *Metadata) initInformers(ctx context.Context, client kubernetes.Interface, timeout time.Duration) error {
-	informerFactory := informers.NewSharedInformerFactory(client, syncTime)
-	err := k.initPodInformer(informerFactory)
-	if err != nil {
-		return err
+	log := klog()
+	var factories []informers.SharedInformerFactory
+	for _, namespace := range k.watchedNamespaces() {
+		informerFactory := informers.NewSharedInformerFactoryWithOptions(client, syncTime,
+			informers.WithNamespace(namespace))
+		err := k.initPodInformer(informerFactory.Core().V1().Pods().Informer())
+		if err != nil {
+			return err
+		}
+		if !k.DeploymentsFromReplicaSetNames {
+			if err := k.initReplicaSetInformer(informerFactory); err != nil {
+				return err
+			}
+		}
+		if k.WatchEndpointSlices {
+			if err := k.initEndpointSliceInformer(informerFactory); err != nil {
+				return err
+			}
+		}
+		if k.WatchServices {
+			if err := k.initServiceInformer(informerFactory); err != nil {
+				return err
+			}
+		}
+		factories = append(factories, informerFactory)
+		if k.WatchNamespaceLabels {
+			nsFactory, err := k.initNamespaceInformer(client, namespace)
+			if err != nil {
+				return err
+			}
+			factories = append(factories, nsFactory)
+		}
 	}
-	err = k.initReplicaSetInformer(informerFactory)
-	if err != nil {
-		return err
+	if k.WatchNodes {
+		nodesFactory, err := k.initNodeInformer(client)
+		if err != nil {
+			return err
+		}
+		factories = append(factories, nodesFactory)
 	}
 
-	log := klog()
-	log.Debug("starting kubernetes informers, waiting for syncronization")
-	informerFactory.Start(ctx.Done())
-	finishedCacheSync := make(chan struct{})
+	log.Debug("starting kubernetes informers, waiting for syncronization", "namespaces", k.Namespaces)
+	k.synced = StartFactories(ctx, factories...)
+	AwaitCacheSync(ctx, log, k.WaitForCacheSync, timeout)
+	return nil
+}
+
+// WaitForCacheSync blocks until the caches of all the informers are synced, or returns an
+// error if the context is done before
+func (k *Metadata) WaitForCacheSync(ctx context.Context) error {
+	return WaitForSync(ctx, k.synced)
+}
+
+// Synced returns an error if the informers are not synchronized with the Kubernetes API.
+// It can be used as a readiness health check.
+func (k *Metadata) Synced(_ context.Context) error {
+	return InformersSynced(slices.Concat(k.pods, k.replicaSets, k.endpointSlices, k.services, k.namespaces, k.nodes)...)
+}
+
+// watchedNamespaces returns the distinct namespaces to watch, or the namespace that represents
+// the whole cluster
+func (k *Metadata) watchedNamespaces() []string {
+	var namespaces []string
+	for _, ns := range k.Namespaces {
+		if ns = strings.TrimSpace(ns); ns != "" && !slices.Contains(namespaces, ns) {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	if len(namespaces) == 0 {
+		return []string{metav1.NamespaceAll}
+	}
+	return namespaces
+}
+
+// StartFactories starts the informers of the provided factories, and returns a channel that is
+// closed when all their caches are synced. The channel is never closed if the context is done before.
+func StartFactories(ctx context.Context, factories ...informers.SharedInformerFactory) <-chan struct{} {
+	for _, informerFactory := range factories {
+		informerFactory.Start(ctx.Done())
+	}
+	synced := make(chan struct{})
 	go func() {
-		informerFactory.WaitForCacheSync(ctx.Done())
-		close(finishedCacheSync)
+		for _, informerFactory := range factories {
+			for _, ok := range informerFactory.WaitForCacheSync(ctx.Done()) {
+				if !ok {
+					return
+				}
+			}
+		}
+		close(synced)
 	}()
+	return synced
+}
+
+// AwaitCacheSync blocks the caller until the provided wait function returns, for a maximum of the
+// provided timeout (or DefaultSyncTimeout, if zero). If the timeout expires, it logs a warning and
+// returns false, so the caller proceeds without the Kubernetes metadata until the caches are synced.
+func AwaitCacheSync(ctx context.Context, log *slog.Logger, wait func(context.Context) error, timeout time.Duration) bool {
+	if timeout <= 0 {
+		timeout = DefaultSyncTimeout
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := wait(waitCtx); err != nil {
+		log.Warn("kubernetes informers have not synced. Proceeding without waiting, so the first"+
+			" traces and metrics might not contain Kubernetes metadata", "timeout", timeout, "error", err)
+		return false
+	}
+	log.Debug("kubernetes informers synced")
+	return true
+}
+
+// WaitForSync blocks until the channel that is returned by StartFactories is closed, or returns
+// an error if the context is done before
+func WaitForSync(ctx context.Context, synced <-chan struct{}) error {
+	if synced == nil {
+		return errors.New("kubernetes informers not started")
+	}
 	select {
-	case <-finishedCacheSync:
-		log.Debug("kubernetes informers started")
+	case <-synced:
 		return nil
-	case <-time.After(timeout):
-		return fmt.Errorf("kubernetes cache has not been synced after %s timeout", timeout)
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for kubernetes informers to sync: %w", ctx.Err())
+	}
+}
+
+// InformersSynced returns an error if any of the provided informers has been stopped
+// or is not synchronized yet.
+func InformersSynced(informers ...cache.SharedIndexInformer) error {
+	for _, inf := range informers {
+		if inf.IsStopped() {
+			return errors.New("kubernetes informer stopped")
+		}
+		if !inf.HasSynced() {
+			return errors.New("kubernetes informer not synchronized")
+		}
 	}
+	return nil
 }
 
-// FetchPodOwnerInfo updates the pod owner with the Deployment information, if it exists.
+// FetchPodOwnerInfo updates the pod owner with the Deployment or CronJob information, if it exists.
 // Pod Info might include a ReplicaSet as owner, and ReplicaSet info
 // usually has a Deployment as owner reference, which is the one that we'd really like
-// to report as owner.
+// to report as owner. Likewise, the Jobs might be owned by a CronJob.
 func (k *Metadata) FetchPodOwnerInfo(pod *PodInfo) {
-	if pod.Owner != nil && pod.Owner.Type == OwnerReplicaSet {
-		if rsi, ok := k.GetReplicaSetInfo(pod.Namespace, pod.Owner.Name); ok {
-			pod.Owner.Owner = &Owner{Type: OwnerDeployment, Name: rsi.DeploymentName}
+	fetchPodOwnerInfo(pod, k.replicaSetDeployment, k.jobCronJob)
+}
+
+func fetchPodOwnerInfo(pod *PodInfo, replicaSetDeployment, jobCronJob func(*PodInfo) (string, bool)) {
+	if parent, ok := ownerOwner(pod, replicaSetDeployment, jobCronJob); ok {
+		pod.Owner.Owner = parent
+	}
+}
+
+// PodWithOwnerInfo works as FetchPodOwnerInfo but, instead of updating the passed pod, it returns
+// an updated copy of it. If the pod does not have any ReplicaSet or Job as owner, or their owner
+// is not found, the same pod is returned. This allows sharing the returned PodInfo between goroutines.
+func (k *Metadata) PodWithOwnerInfo(pod *PodInfo) *PodInfo {
+	return podWithOwnerInfo(pod, k.replicaSetDeployment, k.jobCronJob)
+}
+
+func podWithOwnerInfo(pod *PodInfo, replicaSetDeployment, jobCronJob func(*PodInfo) (string, bool)) *PodInfo {
+	parent, ok := ownerOwner(pod, replicaSetDeployment, jobCronJob)
+	if !ok {
+		return pod
+	}
+	if pod.Owner.Owner != nil && pod.Owner.Owner.Type == parent.Type &&
+		pod.Owner.Owner.Name == parent.Name {
+		return pod
+	}
+	owner := *pod.Owner
+	owner.Owner = parent
+	podCopy := *pod
+	podCopy.Owner = &owner
+	return &podCopy
+}
+
+// ownerOwner returns the Deployment that owns the ReplicaSet of the pod, or the CronJob that owns its Job
+func ownerOwner(pod *PodInfo, replicaSetDeployment, jobCronJob func(*PodInfo) (string, bool)) (*Owner, bool) {
+	if pod.Owner == nil {
+		return nil, false
+	}
+	switch pod.Owner.Type {
+	case OwnerReplicaSet:
+		if deployment, ok := replicaSetDeployment(pod); ok {
+			return &Owner{Type: OwnerDeployment, Name: deployment}, true
+		}
+	case OwnerJob:
+		if cronJob, ok := jobCronJob(pod); ok {
+			return &Owner{Type: OwnerCronJob, Name: cronJob}, true
 		}
 	}
+	return nil, false
 }
 
 func (k *Metadata) AddContainerEventHandler(eh ContainerEventHandler) {
+	k.containerHandlersMut.Lock()
+	defer k.containerHandlersMut.Unlock()
 	k.containerEventHandlers = append(k.containerEventHandlers, eh)
 }
 
-func (k *Metadata) AddPodEventHandler(h cache.ResourceEventHandler) error {
-	_, err := k.pods.AddEventHandler(h)
+// RemoveContainerEventHandler stops forwarding the container deletions to the provided handler
+func (k *Metadata) RemoveContainerEventHandler(eh ContainerEventHandler) {
+	k.containerHandlersMut.Lock()
+	defer k.containerHandlersMut.Unlock()
+	k.containerEventHandlers = slices.DeleteFunc(k.containerEventHandlers, func(h ContainerEventHandler) bool {
+		return h == eh
+	})
+}
+
+func (k *Metadata) AddPodEventHandler(h cache.ResourceEventHandler) (*EventHandlerRegistration, error) {
+	return addEventHandler(k.pods, h)
+}
+
+func (k *Metadata) AddReplicaSetEventHandler(h cache.ResourceEventHandler) (*EventHandlerRegistration, error) {
+	return addEventHandler(k.replicaSets, h)
+}
+
+// addEventHandler adds the handler to the informers of all the watched namespaces,
+// so it receives the events of all of them
+func addEventHandler(infs []cache.SharedIndexInformer, h cache.ResourceEventHandler) (*EventHandlerRegistration, error) {
+	reg := &EventHandlerRegistration{}
+	for _, inf := range infs {
+		handle, err := inf.AddEventHandler(h)
+		if err != nil {
+			// the handler is not left registered in the other informers
+			_ = reg.Remove()
+			return nil, err
+		}
+		reg.informers = append(reg.informers, inf)
+		reg.handles = append(reg.handles, handle)
+	}
 	// passing a snapshot of the currently stored entities
 	go func() {
-		for _, pod := range k.pods.GetStore().List() {
-			h.OnAdd(pod, true)
+		for _, inf := range infs {
+			for _, obj := range inf.GetStore().List() {
+				if reg.removed.Load() {
+					return
+				}
+				h.OnAdd(obj, true)
+			}
 		}
 	}()
-	return err
+	return reg, nil
 }
 
-func (k *Metadata) AddReplicaSetEventHandler(h cache.ResourceEventHandler) error {
-	_, err := k.replicaSets.AddEventHandler(h)
-	// passing a snapshot of the currently stored entities
-	go func() {
-		for _, pod := range k.replicaSets.GetStore().List() {
-			h.OnAdd(pod, true)
+// serviceAnnotations only keeps the annotations that are used by Beyla, to save memory
+func serviceAnnotations(annotations map[string]string) map[string]string {
+	var kept map[string]string
+	for _, key := range []string{ServiceNameAnnotation, ServiceNamespaceAnnotation} {
+		if value, ok := annotations[key]; ok {
+			if kept == nil {
+				kept = map[string]string{}
+			}
+			kept[key] = value
 		}
-	}()
-	return err
+	}
+	return kept
 }
 
+// ServiceName of the applications running in the Pod, as set by the service name annotation.
+// Otherwise, it is the name of the Pod owner.
 func (i *PodInfo) ServiceName() string {
-	if i.Owner != nil {
-		// we have two levels of ownership at most
-		if i.Owner.Owner != nil {
-			return i.Owner.Owner.Name
-		}
+	if name := i.Annotations[ServiceNameAnnotation]; name != "" {
+		return name
+	}
+	return i.OwnerName()
+}
 
-		return i.Owner.Name
+// ServiceNamespace of the applications running in the Pod, as set by the service namespace annotation.
+// Otherwise, it is the namespace of the Pod.
+func (i *PodInfo) ServiceNamespace() string {
+	if ns := i.Annotations[ServiceNamespaceAnnotation]; ns != "" {
+		return ns
 	}
+	return i.Namespace
+}
 
+// OwnerName returns the name of the topmost owner of the Pod, or the name of the Pod
+// if it doesn't have any owner
+func (i *PodInfo) OwnerName() string {
+	if owner := i.TopOwner(); owner != nil {
+		return owner.Name
+	}
 	return i.Name
 }
+
+// TopOwner returns the topmost owner of the Pod, or nil if it doesn't have any owner
+func (i *PodInfo) TopOwner() *Owner {
+	// we have two levels of ownership at most
+	if i.Owner != nil && i.Owner.Owner != nil {
+		return i.Owner.Owner
+	}
+	return i.Owner
+}
@@ -1,10 +1,20 @@
 package kube
 
 import (
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
 )
 
 func TestServiceName(t *testing.T) {
@@ -49,3 +59,359 @@ func TestServiceName(t *testing.T) {
 	assert.Equal(t, "not_nested", pod4.ServiceName())
 	assert.Equal(t, "", pod5.ServiceName())
 }
+
+func TestServiceName_Annotations(t *testing.T) {
+	owned := PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "the-pod", Namespace: "the-ns"},
+		Owner:      &Owner{Type: OwnerDeployment, Name: "the-deployment"},
+	}
+	bare := PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "the-pod", Namespace: "the-ns"}}
+	annotated := owned
+	annotated.Annotations = serviceAnnotations(map[string]string{
+		ServiceNameAnnotation:      "the-service",
+		ServiceNamespaceAnnotation: "the-service-ns",
+		"unused":                   "annotation",
+	})
+
+	// the annotation takes precedence over the owner name, which takes precedence over the pod name
+	assert.Equal(t, "the-service", annotated.ServiceName())
+	assert.Equal(t, "the-deployment", owned.ServiceName())
+	assert.Equal(t, "the-pod", bare.ServiceName())
+	assert.Equal(t, "the-deployment", annotated.OwnerName())
+	// the same applies to the namespace
+	assert.Equal(t, "the-service-ns", annotated.ServiceNamespace())
+	assert.Equal(t, "the-ns", owned.ServiceNamespace())
+	// only the annotations used by Beyla are kept
+	assert.Len(t, annotated.Annotations, 2)
+	assert.Nil(t, serviceAnnotations(map[string]string{"unused": "annotation"}))
+}
+
+func TestNormalizeContainerID(t *testing.T) {
+	const id = "40c03570b6f4c30bc8d69923d37ee698f5cfcced92c7b7df1c47f6f7887378a9"
+	for _, reported := range []string{
+		id,
+		"containerd://" + id,
+		"docker://" + id,
+		"cri-o://" + id,
+		"containerd://40C03570B6F4C30BC8D69923D37EE698F5CFCCED92C7B7DF1C47F6F7887378A9",
+	} {
+		assert.Equal(t, id, NormalizeContainerID(reported))
+	}
+}
+
+func TestPodInfo_Container(t *testing.T) {
+	const id = "40c03570b6f4c30bc8d69923d37ee698f5cfcced92c7b7df1c47f6f7887378a9"
+	info := podInfo(&v1.Pod{Status: v1.PodStatus{
+		ContainerStatuses: []v1.ContainerStatus{
+			{Name: "app", Image: "shop/app:1.0", ContainerID: "containerd://" + id},
+			{Name: "sidecar", Image: "envoy:1.29", ContainerID: "cri-o://0123456789abcdef"},
+		},
+	}})
+	// the containers are found by their ID, in both the raw and the runtime-prefixed forms
+	ci, ok := info.Container(id)
+	require.True(t, ok)
+	assert.Equal(t, ContainerInfo{Name: "app", Image: "shop/app:1.0"}, ci)
+	ci, ok = info.Container("cri-o://0123456789ABCDEF")
+	require.True(t, ok)
+	assert.Equal(t, ContainerInfo{Name: "sidecar", Image: "envoy:1.29"}, ci)
+	_, ok = info.Container("fedcba9876543210")
+	assert.False(t, ok)
+
+	// the pods whose container statuses haven't been reported yet don't have container information
+	_, ok = podInfo(&v1.Pod{}).Container(id)
+	assert.False(t, ok)
+
+	// the full container IDs are found from their truncated form
+	full, ok := info.FullContainerID("containerd://40C03570B6F4")
+	require.True(t, ok)
+	assert.Equal(t, id, full)
+	_, ok = info.FullContainerID("fedcba987654")
+	assert.False(t, ok)
+	_, ok = info.FullContainerID("")
+	assert.False(t, ok)
+}
+
+func TestPodInfo_InitAndEphemeralContainers(t *testing.T) {
+	info := podInfo(&v1.Pod{Status: v1.PodStatus{
+		InitContainerStatuses: []v1.ContainerStatus{
+			{Name: "migrations", Image: "shop/migrations:1.0", ContainerID: "containerd://0123456789abcdef"},
+		},
+		// the main container waits until the init container exits
+		ContainerStatuses: []v1.ContainerStatus{{Name: "app", Image: "shop/app:1.0"}},
+		EphemeralContainerStatuses: []v1.ContainerStatus{
+			{Name: "debugger", Image: "busybox", ContainerID: "containerd://fedcba9876543210"},
+		},
+	}})
+	assert.Equal(t, []string{"0123456789abcdef", "fedcba9876543210"}, info.ContainerIDs)
+	ci, ok := info.Container("0123456789abcdef")
+	require.True(t, ok)
+	assert.Equal(t, ContainerInfo{Name: "migrations", Image: "shop/migrations:1.0"}, ci)
+	ci, ok = info.Container("fedcba9876543210")
+	require.True(t, ok)
+	assert.Equal(t, ContainerInfo{Name: "debugger", Image: "busybox"}, ci)
+	_, ok = info.Container("")
+	assert.False(t, ok)
+}
+
+func TestNodeTopology(t *testing.T) {
+	zone, region := NodeTopology(map[string]string{
+		v1.LabelTopologyZone: "eu-west-1a", v1.LabelTopologyRegion: "eu-west-1",
+		v1.LabelFailureDomainBetaZone: "old-zone", v1.LabelFailureDomainBetaRegion: "old-region",
+	})
+	assert.Equal(t, "eu-west-1a", zone)
+	assert.Equal(t, "eu-west-1", region)
+
+	// the deprecated labels are used if the well-known labels are not set
+	zone, region = NodeTopology(map[string]string{
+		v1.LabelFailureDomainBetaZone: "old-zone", v1.LabelFailureDomainBetaRegion: "old-region",
+	})
+	assert.Equal(t, "old-zone", zone)
+	assert.Equal(t, "old-region", region)
+
+	zone, region = NodeTopology(nil)
+	assert.Empty(t, zone)
+	assert.Empty(t, region)
+}
+
+func TestHostNetworkAddresses(t *testing.T) {
+	pod := &v1.Pod{
+		Spec: v1.PodSpec{
+			HostNetwork:    true,
+			InitContainers: []v1.Container{{Ports: []v1.ContainerPort{{ContainerPort: 9090}}}},
+			Containers: []v1.Container{
+				{Ports: []v1.ContainerPort{{ContainerPort: 9100}, {ContainerPort: 9090, Protocol: v1.ProtocolUDP}}},
+				{},
+			},
+		},
+		Status: v1.PodStatus{
+			HostIP: "192.168.1.10",
+			PodIPs: []v1.PodIP{{IP: "192.168.1.10"}, {IP: "fd00::0:10"}},
+		},
+	}
+	ips, ports := hostNetworkAddresses(pod)
+	assert.Equal(t, []string{"192.168.1.10", "fd00::10"}, ips)
+	assert.Equal(t, []uint16{9090, 9100}, ports)
+
+	// the host IP is used if the pod IPs are not reported
+	pod.Status.PodIPs = nil
+	ips, _ = hostNetworkAddresses(pod)
+	assert.Equal(t, []string{"192.168.1.10"}, ips)
+}
+
+func TestHostPortAddresses(t *testing.T) {
+	pod := &v1.Pod{
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{
+				{Ports: []v1.ContainerPort{{ContainerPort: 80, HostPort: 8080}, {ContainerPort: 9090}}},
+				{Ports: []v1.ContainerPort{{ContainerPort: 443, HostPort: 8443}, {ContainerPort: 81, HostPort: 8080}}},
+			},
+		},
+		Status: v1.PodStatus{
+			HostIP:  "192.168.1.10",
+			HostIPs: []v1.HostIP{{IP: "192.168.1.10"}, {IP: "fd00::0:10"}},
+			PodIPs:  []v1.PodIP{{IP: "10.244.0.5"}},
+		},
+	}
+	// only the declared host ports are taken, with the node IPs
+	ips, ports := hostPortAddresses(pod)
+	assert.Equal(t, []string{"192.168.1.10", "fd00::10"}, ips)
+	assert.Equal(t, []uint16{8080, 8443}, ports)
+
+	// the host IP is used if the host IPs are not reported
+	pod.Status.HostIPs = nil
+	ips, _ = hostPortAddresses(pod)
+	assert.Equal(t, []string{"192.168.1.10"}, ips)
+
+	// the pods without host ports are not addressed through their node
+	ips, ports = hostPortAddresses(&v1.Pod{
+		Spec:   v1.PodSpec{Containers: []v1.Container{{Ports: []v1.ContainerPort{{ContainerPort: 80}}}}},
+		Status: v1.PodStatus{HostIP: "192.168.1.10"},
+	})
+	assert.Nil(t, ips)
+	assert.Nil(t, ports)
+}
+
+// BenchmarkPodsStoreMemory compares the heap taken by the informer's cache for 10k synthetic Pods
+// when it stores the whole Pods, and when it stores the PodInfo returned by the transform
+func BenchmarkPodsStoreMemory(b *testing.B) {
+	const pods = 10000
+	for _, tc := range []struct {
+		name      string
+		transform func(*v1.Pod) interface{}
+	}{
+		{name: "Pod", transform: func(pod *v1.Pod) interface{} { return pod }},
+		{name: "PodInfo", transform: func(pod *v1.Pod) interface{} { return podInfo(pod) }},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			var heap int64
+			for i := 0; i < b.N; i++ {
+				before := heapAlloc()
+				store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+				for p := 0; p < pods; p++ {
+					require.NoError(b, store.Add(tc.transform(syntheticPod(p))))
+				}
+				heap = heapAlloc() - before
+				runtime.KeepAlive(store)
+			}
+			b.ReportMetric(float64(heap)/pods, "heap-B/pod")
+		})
+	}
+}
+
+func heapAlloc() int64 {
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return int64(ms.HeapAlloc)
+}
+
+// syntheticPod returns a Pod of a Deployment with the usual fields of the Pods that are returned
+// by the Kubernetes API
+func syntheticPod(n int) *v1.Pod {
+	name := fmt.Sprintf("web-7d9f8b6c5d-%05d", n)
+	ip := fmt.Sprintf("10.%d.%d.%d", n>>16&0xff, n>>8&0xff, n&0xff)
+	started := metav1.Now()
+	env := make([]v1.EnvVar, 0, 10)
+	for i := 0; i < 10; i++ {
+		env = append(env, v1.EnvVar{Name: fmt.Sprintf("SETTING_%d", i), Value: fmt.Sprintf("value-%d-%d", n, i)})
+	}
+	container := func(cname string, port int32) v1.Container {
+		return v1.Container{
+			Name:  cname,
+			Image: "registry.example.com/shop/" + cname + ":1.4.2",
+			Env:   env,
+			Ports: []v1.ContainerPort{{Name: "http", ContainerPort: port, Protocol: v1.ProtocolTCP}},
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m"), v1.ResourceMemory: resource.MustParse("128Mi")},
+				Limits:   v1.ResourceList{v1.ResourceMemory: resource.MustParse("256Mi")},
+			},
+			VolumeMounts: []v1.VolumeMount{
+				{Name: "config", MountPath: "/etc/" + cname},
+				{Name: "kube-api-access", MountPath: "/var/run/secrets/kubernetes.io/serviceaccount", ReadOnly: true},
+			},
+		}
+	}
+	status := func(cname string) v1.ContainerStatus {
+		return v1.ContainerStatus{
+			Name:         cname,
+			Image:        "registry.example.com/shop/" + cname + ":1.4.2",
+			ImageID:      "registry.example.com/shop/" + cname + "@sha256:" + strings.Repeat("ab", 32),
+			ContainerID:  fmt.Sprintf("containerd://%064x", n*2+len(cname)),
+			Ready:        true,
+			State:        v1.ContainerState{Running: &v1.ContainerStateRunning{StartedAt: started}},
+			RestartCount: 1,
+		}
+	}
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "shop",
+			UID:               types.UID(fmt.Sprintf("6f1c2a4e-0000-4000-8000-%012d", n)),
+			ResourceVersion:   fmt.Sprint(1000000 + n),
+			CreationTimestamp: started,
+			Labels: map[string]string{
+				"app.kubernetes.io/name": "web", "app.kubernetes.io/part-of": "shop",
+				"pod-template-hash": "7d9f8b6c5d", "version": "1.4.2",
+			},
+			Annotations: map[string]string{
+				"kubectl.kubernetes.io/restartedAt": "2024-05-06T07:00:00Z",
+				"prometheus.io/scrape":              "true",
+				"prometheus.io/port":                "8080",
+			},
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet",
+				Name: "web-7d9f8b6c5d", UID: "0b5a6c2e-0000-4000-8000-000000000000"}},
+			ManagedFields: []metav1.ManagedFieldsEntry{
+				{Manager: "kube-controller-manager", Operation: metav1.ManagedFieldsOperationUpdate, APIVersion: "v1",
+					FieldsType: "FieldsV1", FieldsV1: &metav1.FieldsV1{Raw: []byte(strings.Repeat(`{"f:spec":{}}`, 150))}},
+				{Manager: "kubelet", Operation: metav1.ManagedFieldsOperationUpdate, APIVersion: "v1",
+					FieldsType: "FieldsV1", FieldsV1: &metav1.FieldsV1{Raw: []byte(strings.Repeat(`{"f:status":{}}`, 100))},
+					Subresource: "status"},
+			},
+		},
+		Spec: v1.PodSpec{
+			NodeName:       fmt.Sprintf("node-%04d", n%5000),
+			Containers:     []v1.Container{container("web", 8080), container("sidecar", 9090)},
+			InitContainers: []v1.Container{container("migrations", 0)},
+			Volumes: []v1.Volume{
+				{Name: "config", VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{
+					LocalObjectReference: v1.LocalObjectReference{Name: "web-config"}}}},
+				{Name: "kube-api-access", VolumeSource: v1.VolumeSource{Projected: &v1.ProjectedVolumeSource{
+					Sources: []v1.VolumeProjection{{ServiceAccountToken: &v1.ServiceAccountTokenProjection{Path: "token"}}}}}},
+			},
+			Tolerations: []v1.Toleration{
+				{Key: "node.kubernetes.io/not-ready", Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoExecute},
+				{Key: "node.kubernetes.io/unreachable", Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoExecute},
+			},
+		},
+		Status: v1.PodStatus{
+			Phase:  v1.PodRunning,
+			HostIP: "192.168.0.1",
+			PodIP:  ip,
+			PodIPs: []v1.PodIP{{IP: ip}},
+			Conditions: []v1.PodCondition{
+				{Type: v1.PodInitialized, Status: v1.ConditionTrue, LastTransitionTime: started},
+				{Type: v1.PodReady, Status: v1.ConditionTrue, LastTransitionTime: started},
+				{Type: v1.ContainersReady, Status: v1.ConditionTrue, LastTransitionTime: started},
+				{Type: v1.PodScheduled, Status: v1.ConditionTrue, LastTransitionTime: started},
+			},
+			StartTime:             &started,
+			ContainerStatuses:     []v1.ContainerStatus{status("web"), status("sidecar")},
+			InitContainerStatuses: []v1.ContainerStatus{status("migrations")},
+		},
+	}
+}
+
+const twoClustersKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: local
+  cluster:
+    server: https://127.0.0.1:6443
+- name: remote
+  cluster:
+    server: https://k8s.example.com:6443
+users:
+- name: beyla
+  user:
+    token: the-token
+contexts:
+- name: local
+  context: {cluster: local, user: beyla}
+- name: remote
+  context: {cluster: remote, user: beyla}
+current-context: local
+`
+
+func TestClientConfig_Context(t *testing.T) {
+	kubeconfig := path.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(kubeconfig, []byte(twoClustersKubeconfig), 0o600))
+
+	// the current context is used by default
+	config, err := ClientConfig{KubeconfigPath: kubeconfig}.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "https://127.0.0.1:6443", config.Host)
+
+	// AND another context can be selected
+	config, err = ClientConfig{KubeconfigPath: kubeconfig, Context: "remote"}.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "https://k8s.example.com:6443", config.Host)
+	assert.Equal(t, "the-token", config.BearerToken)
+
+	// AND a missing context is not replaced by the in-cluster configuration
+	_, err = ClientConfig{KubeconfigPath: kubeconfig, Context: "staging"}.Load()
+	assert.ErrorContains(t, err, "staging")
+}
+
+func TestClientConfig_APIServerURL(t *testing.T) {
+	// the kubeconfig is ignored when the API server is explicitly provided
+	config, err := ClientConfig{
+		KubeconfigPath: "/does/not/exist",
+		APIServerURL:   "https://10.0.0.1:6443",
+		TokenPath:      "/etc/beyla/token",
+		CAPath:         "/etc/beyla/ca.crt",
+	}.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "https://10.0.0.1:6443", config.Host)
+	assert.Equal(t, "/etc/beyla/token", config.BearerTokenFile)
+	assert.Equal(t, "/etc/beyla/ca.crt", config.TLSClientConfig.CAFile)
+}
@@ -0,0 +1,17 @@
+package kube
+
+import "net/netip"
+
+// NormalizeIP returns the canonical text representation of an IP address, so the same
+// address is always indexed and looked up with the same key: IPv4-mapped IPv6 addresses
+// (e.g. ::ffff:10.0.0.1) are returned in their IPv4 form, and IPv6 addresses are returned in
+// their shortest, lowercase form (e.g. FD00:0:0::1 is returned as fd00::1). The zone of the
+// IPv6 addresses (e.g. fe80::1%eth0) is removed, as the Kubernetes objects don't report it.
+// If the argument is not a valid IP address, it is returned unmodified.
+func NormalizeIP(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	return addr.Unmap().WithZone("").String()
+}
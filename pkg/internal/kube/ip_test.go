@@ -0,0 +1,26 @@
+package kube
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeIP(t *testing.T) {
+	for in, expected := range map[string]string{
+		"10.0.0.1":             "10.0.0.1",
+		"::ffff:10.0.0.1":      "10.0.0.1",
+		"::ffff:a00:1":         "10.0.0.1",
+		"fd00:0:0:0::1":        "fd00::1",
+		"FD00:0000::00AB":      "fd00::ab",
+		"2001:db8::1":          "2001:db8::1",
+		"fe80::1%eth0":         "fe80::1",
+		"FE80::A%2":            "fe80::a",
+		"::ffff:10.0.0.1%eth0": "10.0.0.1",
+		"::1":                  "::1",
+		"not-an-ip":            "not-an-ip",
+		"":                     "",
+	} {
+		assert.Equal(t, expected, NormalizeIP(in), "input: %q", in)
+	}
+}
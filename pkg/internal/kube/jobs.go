@@ -0,0 +1,78 @@
+package kube
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// jobLookupTTL is the time after which a fetched Job is fetched again, so the Jobs that were
+	// not found (e.g. because they were being created) are eventually retried
+	jobLookupTTL = 10 * time.Minute
+	// jobLookupTimeout limits the time that the decoration is blocked by a Job lookup
+	jobLookupTimeout = 5 * time.Second
+)
+
+// jobCronJob returns the name of the CronJob that owns the Job of the pod. It returns false if the Job
+// is not known, or it is not owned by a CronJob, such as the Jobs that are created manually.
+func (k *Metadata) jobCronJob(pod *PodInfo) (string, bool) {
+	return k.jobLookups.cronJob(pod.Namespace, pod.Owner.Name)
+}
+
+// jobLookups fetches the Jobs from the API, as Beyla doesn't watch them, and keeps the name of their
+// CronJob in a LRU cache. The Jobs without CronJob, or that don't exist, are cached too, with an empty name.
+type jobLookups struct {
+	client kubernetes.Interface
+	cache  *expirable.LRU[string, string]
+}
+
+func newJobLookups(client kubernetes.Interface, size int) *jobLookups {
+	return &jobLookups{
+		client: client,
+		cache:  expirable.NewLRU[string, string](size, nil, jobLookupTTL),
+	}
+}
+
+// cronJob returns the name of the CronJob that owns the Job, as in Metadata.jobCronJob.
+// A nil jobLookups never finds the CronJobs.
+func (jl *jobLookups) cronJob(namespace, name string) (string, bool) {
+	if jl == nil {
+		return "", false
+	}
+	key := qName(namespace, name)
+	cronJob, ok := jl.cache.Get(key)
+	if !ok {
+		ctx, cancel := context.WithTimeout(context.Background(), jobLookupTimeout)
+		defer cancel()
+		job, err := jl.client.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		switch {
+		case err == nil:
+			cronJob = jobCronJobName(job)
+		case apierrors.IsNotFound(err):
+			cronJob = ""
+		default:
+			// the transient errors are not cached, so the Job is fetched again in the next lookup
+			klog().Debug("can't fetch Job. Ignoring", "namespace", namespace, "name", name, "error", err)
+			return "", false
+		}
+		jl.cache.Add(key, cronJob)
+	}
+	return cronJob, cronJob != ""
+}
+
+// jobCronJobName returns the name of the CronJob in the owner references of the Job, if any
+func jobCronJobName(job *batchv1.Job) string {
+	for i := range job.OwnerReferences {
+		or := &job.OwnerReferences[i]
+		if or.APIVersion == "batch/v1" && or.Kind == "CronJob" {
+			return or.Name
+		}
+	}
+	return ""
+}
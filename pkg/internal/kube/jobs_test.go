@@ -0,0 +1,74 @@
+package kube
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakek8sclientset "k8s.io/client-go/kubernetes/fake"
+)
+
+func jobPod(job string) *PodInfo {
+	return &PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: job + "-x7k2p", Namespace: "batch"},
+		Owner:      &Owner{Type: OwnerJob, Name: job},
+	}
+}
+
+func TestPodWithOwnerInfo_JobLookups(t *testing.T) {
+	// GIVEN a cluster with a Job that was created by a CronJob, and a Job that was created manually
+	// with a name that looks like the ones created by a CronJob
+	client := fakek8sclientset.NewSimpleClientset(
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "backup-28475040", Namespace: "batch",
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "batch/v1", Kind: "CronJob", Name: "backup"}}}},
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "migrate-28475040", Namespace: "batch"}},
+	)
+	jobGets := func() int {
+		gets := 0
+		for _, action := range client.Actions() {
+			if action.GetVerb() == "get" && action.GetResource().Resource == "jobs" {
+				gets++
+			}
+		}
+		return gets
+	}
+	informer := Metadata{JobLookupCacheLen: 10}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+
+	// WHEN the Pod is owned by the Job of a CronJob
+	for i := 0; i < 3; i++ {
+		pod := informer.PodWithOwnerInfo(jobPod("backup-28475040"))
+		// THEN the Job is fetched once, and its CronJob is cached
+		assert.Equal(t, "Job:backup-28475040->CronJob:backup", ownerString(pod.Owner))
+		assert.Equal(t, 1, jobGets())
+	}
+
+	// AND the Jobs without CronJob, or that don't exist, are reported without CronJob, and cached too
+	for i := 0; i < 3; i++ {
+		pod := jobPod("migrate-28475040")
+		informer.FetchPodOwnerInfo(pod)
+		assert.Equal(t, "Job:migrate-28475040", ownerString(pod.Owner))
+		pod = informer.PodWithOwnerInfo(jobPod("missing"))
+		assert.Equal(t, "Job:missing", ownerString(pod.Owner))
+		assert.Equal(t, 3, jobGets())
+	}
+}
+
+func TestPodWithOwnerInfo_NoJobLookups(t *testing.T) {
+	client := fakek8sclientset.NewSimpleClientset(
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "backup-28475040", Namespace: "batch",
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "batch/v1", Kind: "CronJob", Name: "backup"}}}},
+	)
+	// GIVEN informers that don't fetch the Jobs
+	informer := Metadata{}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+
+	// THEN the CronJobs are not reported
+	pod := jobPod("backup-28475040")
+	informer.FetchPodOwnerInfo(pod)
+	assert.Equal(t, "Job:backup-28475040", ownerString(pod.Owner))
+}
@@ -0,0 +1,211 @@
+package kube
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// InClusterTokenPath is the bearer token of the service account of the Beyla Pod
+	InClusterTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	// InClusterCAPath is the CA certificate of the cluster, as mounted in the Beyla Pod
+	InClusterCAPath = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+
+	kubeletRequestTimeout = 10 * time.Second
+)
+
+// KubeletConfig enables fetching the Pods of the local node from the kubelet API, instead of watching the
+// Pods of the cluster from the API server
+type KubeletConfig struct {
+	// Endpoint of the kubelet API, e.g. https://localhost:10250
+	Endpoint string
+	// TokenPath is the file of the bearer token that authenticates Beyla in the kubelet. It is read
+	// again on each request, as the service account tokens are rotated. If empty, no token is sent.
+	TokenPath string
+	// CAPath is the file of the CA certificate that verifies the kubelet serving certificate. If empty
+	// or if the file doesn't exist, the system CAs are used.
+	CAPath string
+	// InsecureSkipVerify doesn't verify the kubelet serving certificate, which is self-signed in many clusters
+	InsecureSkipVerify bool
+	// Refresh is the period between two fetches of the Pods
+	Refresh time.Duration
+}
+
+// kubeletPods lists the Pods of the local node from the kubelet, and "watches" them by fetching them
+// periodically and notifying the differences, so they can feed a regular Pods informer
+type kubeletPods struct {
+	cfg        KubeletConfig
+	client     *http.Client
+	namespaces []string
+
+	mut sync.Mutex
+	// known Pods, by UID, since the last list or fetch
+	known map[types.UID]*v1.Pod
+}
+
+func newKubeletPods(cfg KubeletConfig, namespaces []string) (*kubeletPods, error) {
+	if cfg.Refresh <= 0 {
+		return nil, fmt.Errorf("kubelet refresh period must be positive. Got: %v", cfg.Refresh)
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify} //nolint:gosec
+	if cfg.CAPath != "" && !cfg.InsecureSkipVerify {
+		pem, err := os.ReadFile(cfg.CAPath)
+		switch {
+		case err == nil:
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no valid certificates in %s", cfg.CAPath)
+			}
+		case !errors.Is(err, os.ErrNotExist):
+			return nil, fmt.Errorf("reading kubelet CA: %w", err)
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &kubeletPods{
+		cfg:        cfg,
+		client:     &http.Client{Transport: transport, Timeout: kubeletRequestTimeout},
+		namespaces: namespaces,
+		known:      map[types.UID]*v1.Pod{},
+	}, nil
+}
+
+// fetch returns the Pods of the local node, from the namespaces that are watched
+func (kp *kubeletPods) fetch(ctx context.Context) (*v1.PodList, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(kp.cfg.Endpoint, "/")+"/pods", nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating kubelet request: %w", err)
+	}
+	if kp.cfg.TokenPath != "" {
+		token, err := os.ReadFile(kp.cfg.TokenPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading kubelet token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := kp.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching kubelet pods: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching kubelet pods: unexpected status %s", resp.Status)
+	}
+	var list v1.PodList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("decoding kubelet pods: %w", err)
+	}
+	if len(kp.namespaces) > 0 {
+		list.Items = slices.DeleteFunc(list.Items, func(pod v1.Pod) bool {
+			return !slices.Contains(kp.namespaces, pod.Namespace)
+		})
+	}
+	return &list, nil
+}
+
+// listWatch returns the ListerWatcher of the Pods informer. The watch never fails: if a fetch fails,
+// the differences are notified after the next successful fetch.
+func (kp *kubeletPods) listWatch() cache.ListerWatcher {
+	return &cache.ListWatch{
+		ListFunc: func(_ metav1.ListOptions) (runtime.Object, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), kubeletRequestTimeout)
+			defer cancel()
+			list, err := kp.fetch(ctx)
+			if err != nil {
+				return nil, err
+			}
+			known := make(map[types.UID]*v1.Pod, len(list.Items))
+			for i := range list.Items {
+				known[list.Items[i].UID] = &list.Items[i]
+			}
+			kp.mut.Lock()
+			kp.known = known
+			kp.mut.Unlock()
+			return list, nil
+		},
+		WatchFunc: func(_ metav1.ListOptions) (watch.Interface, error) {
+			events := make(chan watch.Event)
+			watcher := watch.NewProxyWatcher(events)
+			go kp.poll(watcher.StopChan(), events)
+			return watcher, nil
+		},
+	}
+}
+
+// poll fetches the Pods periodically and sends their differences with the previously known Pods,
+// until the watcher is stopped
+func (kp *kubeletPods) poll(stop <-chan struct{}, events chan<- watch.Event) {
+	defer close(events)
+	log := klog().With("component", "kube.kubeletPods")
+	ticker := time.NewTicker(kp.cfg.Refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), kubeletRequestTimeout)
+		list, err := kp.fetch(ctx)
+		cancel()
+		if err != nil {
+			log.Warn("can't fetch the Pods from the kubelet. Retrying later", "error", err)
+			continue
+		}
+		for _, ev := range kp.diff(list) {
+			select {
+			case events <- ev:
+			case <-stop:
+				return
+			}
+		}
+	}
+}
+
+// diff replaces the known Pods by the fetched ones, and returns the events that describe the changes.
+// The deletions are returned first, so a Pod that is recreated with the same name replaces the old one.
+func (kp *kubeletPods) diff(list *v1.PodList) []watch.Event {
+	kp.mut.Lock()
+	defer kp.mut.Unlock()
+	fetched := make(map[types.UID]*v1.Pod, len(list.Items))
+	var events []watch.Event
+	for i := range list.Items {
+		fetched[list.Items[i].UID] = &list.Items[i]
+	}
+	for uid, pod := range kp.known {
+		if _, ok := fetched[uid]; !ok {
+			events = append(events, watch.Event{Type: watch.Deleted, Object: pod})
+		}
+	}
+	for uid, pod := range fetched {
+		old, ok := kp.known[uid]
+		switch {
+		case !ok:
+			events = append(events, watch.Event{Type: watch.Added, Object: pod})
+		// the kubelet reports its own status of the Pods, which can be newer than the status in the
+		// API server, so the status changes are notified even if the resource version is the same
+		case old.ResourceVersion != pod.ResourceVersion || !equality.Semantic.DeepEqual(old.Status, pod.Status):
+			events = append(events, watch.Event{Type: watch.Modified, Object: pod})
+		}
+	}
+	kp.known = fetched
+	return events
+}
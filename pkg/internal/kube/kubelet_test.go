@@ -0,0 +1,149 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// fakeKubelet serves the /pods endpoint of the kubelet
+type fakeKubelet struct {
+	mut    sync.Mutex
+	pods   []v1.Pod
+	fail   bool
+	tokens []string
+}
+
+func (fk *fakeKubelet) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	fk.mut.Lock()
+	defer fk.mut.Unlock()
+	fk.tokens = append(fk.tokens, req.Header.Get("Authorization"))
+	if req.URL.Path != "/pods" || fk.fail {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	_ = json.NewEncoder(rw).Encode(v1.PodList{Items: fk.pods})
+}
+
+func (fk *fakeKubelet) set(fail bool, pods ...v1.Pod) {
+	fk.mut.Lock()
+	defer fk.mut.Unlock()
+	fk.fail = fail
+	fk.pods = pods
+}
+
+func kubeletPod(namespace, name, uid, containerID string) v1.Pod {
+	return v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, UID: types.UID(uid), ResourceVersion: "1",
+			Labels: map[string]string{podTemplateHashLabel: "5d4f7b9c8"},
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "frontend-5d4f7b9c8"},
+			}},
+		Status: v1.PodStatus{
+			PodIPs:            []v1.PodIP{{IP: "10.244.0.5"}},
+			ContainerStatuses: []v1.ContainerStatus{{Name: "app", ContainerID: "containerd://" + containerID}},
+		},
+	}
+}
+
+type deletedContainers struct {
+	mut sync.Mutex
+	ids []string
+}
+
+func (dc *deletedContainers) OnDeletion(containerIDs []string) {
+	dc.mut.Lock()
+	defer dc.mut.Unlock()
+	dc.ids = append(dc.ids, containerIDs...)
+}
+
+func (dc *deletedContainers) get() []string {
+	dc.mut.Lock()
+	defer dc.mut.Unlock()
+	return dc.ids
+}
+
+func TestInitFromKubelet(t *testing.T) {
+	// GIVEN a kubelet that runs a Pod in a watched namespace, and another in a namespace that is not watched
+	kubelet := &fakeKubelet{}
+	kubelet.set(false,
+		kubeletPod("shop", "frontend-5d4f7b9c8-x7k2p", "uid-1", "container-a"),
+		kubeletPod("kube-system", "coredns", "uid-dns", "container-dns"))
+	server := httptest.NewServer(kubelet)
+	defer server.Close()
+	token := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(token, []byte("the-token\n"), 0o600))
+
+	// WHEN the metadata is fetched from the kubelet
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	informer := Metadata{Namespaces: []string{"shop"}, Kubelet: &KubeletConfig{
+		Endpoint: server.URL, TokenPath: token, Refresh: 10 * time.Millisecond,
+	}}
+	require.NoError(t, informer.InitFromKubelet(ctx, 5*time.Second))
+	require.NoError(t, informer.Synced(ctx))
+	deleted := &deletedContainers{}
+	informer.AddContainerEventHandler(deleted)
+
+	// THEN the Pods of the watched namespaces are found, without watching the API server
+	pod, ok := informer.GetContainerPod("container-a")
+	require.True(t, ok)
+	assert.Equal(t, "frontend-5d4f7b9c8-x7k2p", pod.Name)
+	_, ok = informer.GetContainerPod("container-dns")
+	assert.False(t, ok)
+	// AND the Deployment is derived from the ReplicaSet name
+	assert.Equal(t, "ReplicaSet:frontend-5d4f7b9c8->Deployment:frontend", ownerString(informer.PodWithOwnerInfo(pod).Owner))
+	// AND the kubelet requests are authenticated with the token
+	kubelet.mut.Lock()
+	assert.Equal(t, "Bearer the-token", kubelet.tokens[0])
+	kubelet.mut.Unlock()
+
+	// AND WHEN the kubelet reports a new container, before the status is updated in the API server
+	restarted := kubeletPod("shop", "frontend-5d4f7b9c8-x7k2p", "uid-1", "container-b")
+	kubelet.set(false, restarted)
+	// THEN the update is received, even if the resource version is the same
+	require.Eventually(t, func() bool {
+		_, ok := informer.GetContainerPod("container-b")
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// AND WHEN the kubelet can't be reached
+	kubelet.set(true)
+	time.Sleep(50 * time.Millisecond)
+	// THEN the known Pods are kept
+	_, ok = informer.GetContainerPod("container-b")
+	assert.True(t, ok)
+
+	// AND WHEN the Pod is recreated with the same name
+	kubelet.set(false, kubeletPod("shop", "frontend-5d4f7b9c8-x7k2p", "uid-2", "container-c"))
+	// THEN the containers of the previous Pod are deleted, and the new Pod is found
+	require.Eventually(t, func() bool {
+		pod, ok := informer.GetPod("shop", "frontend-5d4f7b9c8-x7k2p")
+		return ok && pod.UID == "uid-2"
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"container-b"}, deleted.get())
+	_, ok = informer.GetContainerPod("container-c")
+	assert.True(t, ok)
+}
+
+func TestInitFromKubelet_Errors(t *testing.T) {
+	assert.Error(t, (&Metadata{}).InitFromKubelet(context.Background(), time.Second))
+	assert.Error(t, (&Metadata{Kubelet: &KubeletConfig{Endpoint: "https://localhost:10250"}}).
+		InitFromKubelet(context.Background(), time.Second))
+	ca := filepath.Join(t.TempDir(), "ca.crt")
+	require.NoError(t, os.WriteFile(ca, []byte("not a certificate"), 0o600))
+	assert.Error(t, (&Metadata{Kubelet: &KubeletConfig{Endpoint: "https://localhost:10250", CAPath: ca, Refresh: time.Second}}).
+		InitFromKubelet(context.Background(), time.Second))
+}
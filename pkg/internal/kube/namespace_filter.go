@@ -0,0 +1,96 @@
+package kube
+
+import (
+	"fmt"
+
+	"github.com/gobwas/glob"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NamespaceFilter selects, by exact names or glob patterns, the namespaces whose Pods and Services are
+// decorated with their Kubernetes metadata
+type NamespaceFilter struct {
+	include []glob.Glob
+	exclude []glob.Glob
+}
+
+// NewNamespaceFilter returns a filter that decorates the namespaces matching any of the include patterns,
+// or all of them if no include pattern is provided, except the ones matching any of the exclude patterns.
+// It returns nil if no pattern is provided, as all the namespaces are decorated.
+func NewNamespaceFilter(include, exclude []string) (*NamespaceFilter, error) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+	f := &NamespaceFilter{}
+	var err error
+	if f.include, err = compileGlobs(include); err != nil {
+		return nil, fmt.Errorf("invalid included namespace: %w", err)
+	}
+	if f.exclude, err = compileGlobs(exclude); err != nil {
+		return nil, fmt.Errorf("invalid excluded namespace: %w", err)
+	}
+	return f, nil
+}
+
+func compileGlobs(patterns []string) ([]glob.Glob, error) {
+	globs := make([]glob.Glob, 0, len(patterns))
+	for _, pattern := range patterns {
+		g, err := glob.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", pattern, err)
+		}
+		globs = append(globs, g)
+	}
+	return globs, nil
+}
+
+// Decorated returns whether the objects of the namespace are decorated. A nil filter decorates all the namespaces.
+func (f *NamespaceFilter) Decorated(namespace string) bool {
+	if f == nil {
+		return true
+	}
+	for _, g := range f.exclude {
+		if g.Match(namespace) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, g := range f.include {
+		if g.Match(namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// Exclude marks the Pod as belonging to a namespace that is excluded from the decoration, and prepares
+// the copy that is returned when the excluded Pods are decorated only with their namespace
+func (pi *PodInfo) Exclude() {
+	pi.Excluded = true
+	pi.namespaceOnly = &PodInfo{ObjectMeta: metav1.ObjectMeta{Namespace: pi.Namespace}, Excluded: true}
+}
+
+// NamespaceOnly returns a copy of the Pod that only contains its namespace
+func (pi *PodInfo) NamespaceOnly() *PodInfo {
+	if pi.namespaceOnly != nil {
+		return pi.namespaceOnly
+	}
+	return &PodInfo{ObjectMeta: metav1.ObjectMeta{Namespace: pi.Namespace}, Excluded: true}
+}
+
+// Exclude marks the EndpointSlice as belonging to a namespace that is excluded from the decoration, and
+// prepares the copy that is returned when the excluded Services are decorated only with their namespace
+func (es *EndpointSliceInfo) Exclude() {
+	es.Excluded = true
+	es.namespaceOnly = &EndpointSliceInfo{ObjectMeta: metav1.ObjectMeta{Namespace: es.Namespace}, Excluded: true}
+}
+
+// NamespaceOnly returns a copy of the EndpointSlice that only contains its namespace
+func (es *EndpointSliceInfo) NamespaceOnly() *EndpointSliceInfo {
+	if es.namespaceOnly != nil {
+		return es.namespaceOnly
+	}
+	return &EndpointSliceInfo{ObjectMeta: metav1.ObjectMeta{Namespace: es.Namespace}, Excluded: true}
+}
@@ -0,0 +1,38 @@
+package kube
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespaceFilter(t *testing.T) {
+	// no patterns decorate everything
+	f, err := NewNamespaceFilter(nil, nil)
+	require.NoError(t, err)
+	assert.Nil(t, f)
+	assert.True(t, f.Decorated("kube-system"))
+
+	// exclusions only
+	f, err = NewNamespaceFilter(nil, []string{"kube-system", "operator-*"})
+	require.NoError(t, err)
+	assert.True(t, f.Decorated("shop"))
+	assert.False(t, f.Decorated("kube-system"))
+	assert.False(t, f.Decorated("operator-certs"))
+	assert.True(t, f.Decorated("kube-public"))
+
+	// inclusions restrict the decorated namespaces, and the exclusions take precedence over them
+	f, err = NewNamespaceFilter([]string{"shop", "team-*"}, []string{"team-sandbox"})
+	require.NoError(t, err)
+	assert.True(t, f.Decorated("shop"))
+	assert.True(t, f.Decorated("team-payments"))
+	assert.False(t, f.Decorated("team-sandbox"))
+	assert.False(t, f.Decorated("shop-staging"))
+	assert.False(t, f.Decorated("kube-system"))
+
+	_, err = NewNamespaceFilter([]string{"team-["}, nil)
+	assert.Error(t, err)
+	_, err = NewNamespaceFilter(nil, []string{"kube-["})
+	assert.Error(t, err)
+}
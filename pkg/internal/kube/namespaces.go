@@ -0,0 +1,77 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NamespaceInfo contains the metadata of a Namespace whose labels can be attached to the
+// metadata of the applications that run in it
+type NamespaceInfo struct {
+	// Informers need that internal object is an ObjectMeta instance
+	metav1.ObjectMeta
+}
+
+// initNamespaceInformer watches the provided Namespace, or all of them if the name is empty.
+// Namespaces are cluster-scoped, so the informer has its own factory, which selects the
+// Namespace by name instead of watching the objects inside it.
+func (k *Metadata) initNamespaceInformer(client kubernetes.Interface, name string) (informers.SharedInformerFactory, error) {
+	log := klog().With("informer", "Namespace")
+	informerFactory := informers.NewSharedInformerFactoryWithOptions(client, syncTime,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			if name != metav1.NamespaceAll {
+				options.FieldSelector = "metadata.name=" + name
+			}
+		}))
+	namespaces := informerFactory.Core().V1().Namespaces().Informer()
+	// Transform any *v1.Namespace instance into a *NamespaceInfo instance to save space
+	// in the informer's cache
+	if err := namespaces.SetTransform(func(i interface{}) (interface{}, error) {
+		ns, ok := i.(*v1.Namespace)
+		if !ok {
+			// it's Ok. The K8s library just informed from an entity
+			// that has been previously transformed/stored
+			if nsi, ok := i.(*NamespaceInfo); ok {
+				return nsi, nil
+			}
+			return nil, fmt.Errorf("was expecting a Namespace. Got: %T", i)
+		}
+		if log.Enabled(context.TODO(), slog.LevelDebug) {
+			log.Debug("inserting Namespace", "name", ns.Name, "labels", ns.Labels)
+		}
+		return &NamespaceInfo{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   ns.Name,
+				UID:    ns.UID,
+				Labels: ns.Labels,
+			},
+		}, nil
+	}); err != nil {
+		return nil, fmt.Errorf("can't set Namespaces transform: %w", err)
+	}
+
+	k.namespaces = append(k.namespaces, namespaces)
+	return informerFactory, nil
+}
+
+// GetNamespaceLabels returns the labels of the Namespace with the provided name. It returns false
+// if the Namespace is not known yet, or the Namespaces informers are not enabled.
+func (k *Metadata) GetNamespaceLabels(name string) (map[string]string, bool) {
+	for _, namespaces := range k.namespaces {
+		obj, ok, err := namespaces.GetStore().GetByKey(name)
+		if err != nil {
+			klog().Debug("error accessing Namespaces store. Ignoring", "error", err, "name", name)
+			return nil, false
+		}
+		if ok {
+			return obj.(*NamespaceInfo).Labels, true
+		}
+	}
+	return nil, false
+}
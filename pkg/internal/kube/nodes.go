@@ -0,0 +1,83 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NodeInfo contains the topology of a Node, which is attached to the metadata of the Pods
+// that are scheduled on it
+type NodeInfo struct {
+	// Informers need that internal object is an ObjectMeta instance
+	metav1.ObjectMeta
+	Zone   string
+	Region string
+}
+
+// NodeTopology returns the zone and region of a Node from its well-known labels, falling back
+// to the deprecated failure-domain labels that are still set by some providers
+func NodeTopology(labels map[string]string) (zone, region string) {
+	zone = labels[v1.LabelTopologyZone]
+	if zone == "" {
+		zone = labels[v1.LabelFailureDomainBetaZone]
+	}
+	region = labels[v1.LabelTopologyRegion]
+	if region == "" {
+		region = labels[v1.LabelFailureDomainBetaRegion]
+	}
+	return zone, region
+}
+
+// initNodeInformer watches all the Nodes of the cluster, as they are cluster-scoped and
+// the Pods of the watched namespaces can be scheduled in any of them
+func (k *Metadata) initNodeInformer(client kubernetes.Interface) (informers.SharedInformerFactory, error) {
+	log := klog().With("informer", "Node")
+	informerFactory := informers.NewSharedInformerFactory(client, syncTime)
+	nodes := informerFactory.Core().V1().Nodes().Informer()
+	// Transform any *v1.Node instance into a *NodeInfo instance to save space
+	// in the informer's cache
+	if err := nodes.SetTransform(func(i interface{}) (interface{}, error) {
+		node, ok := i.(*v1.Node)
+		if !ok {
+			// it's Ok. The K8s library just informed from an entity
+			// that has been previously transformed/stored
+			if ni, ok := i.(*NodeInfo); ok {
+				return ni, nil
+			}
+			return nil, fmt.Errorf("was expecting a Node. Got: %T", i)
+		}
+		info := &NodeInfo{ObjectMeta: metav1.ObjectMeta{Name: node.Name, UID: node.UID}}
+		info.Zone, info.Region = NodeTopology(node.Labels)
+		if log.Enabled(context.TODO(), slog.LevelDebug) {
+			log.Debug("inserting Node", "name", node.Name, "zone", info.Zone, "region", info.Region)
+		}
+		return info, nil
+	}); err != nil {
+		return nil, fmt.Errorf("can't set Nodes transform: %w", err)
+	}
+
+	k.nodes = append(k.nodes, nodes)
+	return informerFactory, nil
+}
+
+// GetNodeInfo returns the topology of the Node with the provided name. It returns false
+// if the Node is not known yet, or the Nodes informer is not enabled.
+func (k *Metadata) GetNodeInfo(name string) (*NodeInfo, bool) {
+	for _, nodes := range k.nodes {
+		obj, ok, err := nodes.GetStore().GetByKey(name)
+		if err != nil {
+			klog().Debug("error accessing Nodes store. Ignoring", "error", err, "name", name)
+			return nil, false
+		}
+		if ok {
+			return obj.(*NodeInfo), true
+		}
+	}
+	return nil, false
+}
@@ -16,8 +16,30 @@ const (
 	OwnerDeployment
 	OwnerStatefulSet
 	OwnerDaemonSet
+	OwnerJob
+	OwnerCronJob
 )
 
+// Kind returns the Kubernetes kind of the owner
+func (o OwnerType) Kind() string {
+	switch o {
+	case OwnerReplicaSet:
+		return "ReplicaSet"
+	case OwnerDeployment:
+		return "Deployment"
+	case OwnerStatefulSet:
+		return "StatefulSet"
+	case OwnerDaemonSet:
+		return "DaemonSet"
+	case OwnerJob:
+		return "Job"
+	case OwnerCronJob:
+		return "CronJob"
+	default:
+		return "Unknown"
+	}
+}
+
 func (o OwnerType) LabelName() attr.Name {
 	switch o {
 	case OwnerReplicaSet:
@@ -28,6 +50,10 @@ func (o OwnerType) LabelName() attr.Name {
 		return attr.K8sStatefulSetName
 	case OwnerDaemonSet:
 		return attr.K8sDaemonSetName
+	case OwnerJob:
+		return attr.K8sJobName
+	case OwnerCronJob:
+		return attr.K8sCronJobName
 	default:
 		return "k8s.unknown.owner"
 	}
@@ -41,10 +67,14 @@ type Owner struct {
 }
 
 // OwnerFromPodInfo returns the pod Owner reference. It might be
-// null if the Pod does not have any owner
+// null if the Pod does not have any owner.
+// The Deployment that owns a ReplicaSet is resolved later from the ReplicaSets informer.
 func OwnerFromPodInfo(pod *v1.Pod) *Owner {
 	for i := range pod.OwnerReferences {
 		or := &pod.OwnerReferences[i]
+		if or.APIVersion == "batch/v1" && or.Kind == "Job" {
+			return &Owner{Type: OwnerJob, Name: or.Name}
+		}
 		if or.APIVersion != "apps/v1" {
 			continue
 		}
@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestOwnerString(t *testing.T) {
@@ -12,3 +14,19 @@ func TestOwnerString(t *testing.T) {
 	owner.Owner = &Owner{Type: OwnerDeployment, Name: "dep"}
 	assert.Equal(t, "k8s.deployment.name:dep->k8s.replicaset.name:rs", owner.String())
 }
+
+func TestOwnerFromPodInfo(t *testing.T) {
+	ownedBy := func(apiVersion, kind, name string) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: apiVersion, Kind: kind, Name: name},
+		}}}
+	}
+	assert.Nil(t, OwnerFromPodInfo(&v1.Pod{}))
+	assert.Nil(t, OwnerFromPodInfo(ownedBy("v1", "Node", "the-node")))
+	assert.Equal(t, &Owner{Type: OwnerReplicaSet, Name: "rs"}, OwnerFromPodInfo(ownedBy("apps/v1", "ReplicaSet", "rs")))
+	assert.Equal(t, &Owner{Type: OwnerStatefulSet, Name: "ss"}, OwnerFromPodInfo(ownedBy("apps/v1", "StatefulSet", "ss")))
+	assert.Equal(t, &Owner{Type: OwnerDaemonSet, Name: "ds"}, OwnerFromPodInfo(ownedBy("apps/v1", "DaemonSet", "ds")))
+	assert.Equal(t, &Owner{Type: OwnerJob, Name: "migrate-2"}, OwnerFromPodInfo(ownedBy("batch/v1", "Job", "migrate-2")))
+	// the CronJob is not guessed from the name of the Job
+	assert.Equal(t, &Owner{Type: OwnerJob, Name: "backup-28475040"}, OwnerFromPodInfo(ownedBy("batch/v1", "Job", "backup-28475040")))
+}
@@ -0,0 +1,101 @@
+package kube
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// podTemplateHashLabel is added by the Deployment controller to its ReplicaSets and their Pods. The
+	// name of the ReplicaSet is the name of the Deployment followed by the hash.
+	podTemplateHashLabel = "pod-template-hash"
+	// replicaSetLookupTTL is the time after which a fetched ReplicaSet is fetched again, so the ReplicaSets
+	// that were not found (e.g. because they were being created) are eventually retried
+	replicaSetLookupTTL = 10 * time.Minute
+	// replicaSetLookupTimeout limits the time that the decoration is blocked by a ReplicaSet lookup
+	replicaSetLookupTimeout = 5 * time.Second
+)
+
+// replicaSetDeployment returns the name of the Deployment that owns the ReplicaSet of the pod, which can
+// be empty if the ReplicaSet is not owned by a Deployment. It returns false if the ReplicaSet is not known.
+func (k *Metadata) replicaSetDeployment(pod *PodInfo) (string, bool) {
+	if !k.DeploymentsFromReplicaSetNames && k.Kubelet == nil {
+		rsi, ok := k.GetReplicaSetInfo(pod.Namespace, pod.Owner.Name)
+		if !ok {
+			return "", false
+		}
+		return rsi.DeploymentName, true
+	}
+	if deployment, ok := deploymentFromReplicaSetName(pod); ok {
+		return deployment, true
+	}
+	return k.replicaSetLookups.deployment(pod.Namespace, pod.Owner.Name)
+}
+
+// deploymentFromReplicaSetName derives the name of the Deployment that owns the ReplicaSet of the pod by
+// removing the pod-template-hash suffix from the ReplicaSet name. The suffix must match the pod-template-hash
+// label of the pod, so the ReplicaSets that are created directly by the users aren't taken as Deployments.
+func deploymentFromReplicaSetName(pod *PodInfo) (string, bool) {
+	if pod.Owner == nil || pod.Owner.Type != OwnerReplicaSet {
+		return "", false
+	}
+	hash := pod.Labels[podTemplateHashLabel]
+	if hash == "" {
+		return "", false
+	}
+	deployment, ok := strings.CutSuffix(pod.Owner.Name, "-"+hash)
+	if !ok || deployment == "" {
+		return "", false
+	}
+	return deployment, true
+}
+
+// replicaSetLookups fetches the ReplicaSets from the API when the informers don't watch them, and keeps
+// them in a LRU cache. The ReplicaSets that don't exist are cached too, as nil.
+type replicaSetLookups struct {
+	client kubernetes.Interface
+	cache  *expirable.LRU[string, *ReplicaSetInfo]
+}
+
+func newReplicaSetLookups(client kubernetes.Interface, size int) *replicaSetLookups {
+	return &replicaSetLookups{
+		client: client,
+		cache:  expirable.NewLRU[string, *ReplicaSetInfo](size, nil, replicaSetLookupTTL),
+	}
+}
+
+// deployment returns the name of the Deployment that owns the ReplicaSet, as in Metadata.replicaSetDeployment.
+// A nil replicaSetLookups never finds the ReplicaSets.
+func (rl *replicaSetLookups) deployment(namespace, name string) (string, bool) {
+	if rl == nil {
+		return "", false
+	}
+	key := qName(namespace, name)
+	rsi, ok := rl.cache.Get(key)
+	if !ok {
+		ctx, cancel := context.WithTimeout(context.Background(), replicaSetLookupTimeout)
+		defer cancel()
+		rs, err := rl.client.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		switch {
+		case err == nil:
+			rsi = replicaSetInfo(rs)
+		case apierrors.IsNotFound(err):
+			rsi = nil
+		default:
+			// the transient errors are not cached, so the ReplicaSet is fetched again in the next lookup
+			klog().Debug("can't fetch ReplicaSet. Ignoring", "namespace", namespace, "name", name, "error", err)
+			return "", false
+		}
+		rl.cache.Add(key, rsi)
+	}
+	if rsi == nil {
+		return "", false
+	}
+	return rsi.DeploymentName, true
+}
@@ -0,0 +1,124 @@
+package kube
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakek8sclientset "k8s.io/client-go/kubernetes/fake"
+)
+
+func replicaSetPod(replicaSet, hash string) *PodInfo {
+	pod := &PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: replicaSet + "-x7k2p", Namespace: "shop"},
+		Owner:      &Owner{Type: OwnerReplicaSet, Name: replicaSet},
+	}
+	if hash != "" {
+		pod.Labels = map[string]string{podTemplateHashLabel: hash}
+	}
+	return pod
+}
+
+func TestDeploymentFromReplicaSetName(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		pod        *PodInfo
+		deployment string
+	}{
+		{name: "deployment", pod: replicaSetPod("frontend-5d4f7b9c8", "5d4f7b9c8"), deployment: "frontend"},
+		{name: "dashed deployment", pod: replicaSetPod("shop-api-v2-7c6b5d", "7c6b5d"), deployment: "shop-api-v2"},
+		{name: "no hash label", pod: replicaSetPod("frontend-5d4f7b9c8", "")},
+		{name: "hash of another ReplicaSet", pod: replicaSetPod("frontend-5d4f7b9c8", "6e5a8c")},
+		{name: "hash without dash", pod: replicaSetPod("frontend5d4f7b9c8", "5d4f7b9c8")},
+		{name: "only the hash", pod: replicaSetPod("-5d4f7b9c8", "5d4f7b9c8")},
+		{name: "not a ReplicaSet", pod: &PodInfo{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{podTemplateHashLabel: "5d4f7b9c8"}},
+			Owner:      &Owner{Type: OwnerStatefulSet, Name: "db-5d4f7b9c8"}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			deployment, ok := deploymentFromReplicaSetName(tc.pod)
+			assert.Equal(t, tc.deployment != "", ok)
+			assert.Equal(t, tc.deployment, deployment)
+		})
+	}
+}
+
+func TestPodWithOwnerInfo_DeploymentsFromReplicaSetNames(t *testing.T) {
+	// GIVEN a cluster with a ReplicaSet of a Deployment, whose Pods don't have the pod-template-hash label,
+	// and a ReplicaSet that was created without Deployment
+	client := fakek8sclientset.NewSimpleClientset(
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "legacy-rs", Namespace: "shop",
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "legacy"}}}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "manual", Namespace: "shop"}},
+	)
+	replicaSetGets := func() int {
+		gets := 0
+		for _, action := range client.Actions() {
+			if action.GetVerb() == "get" && action.GetResource().Resource == "replicasets" {
+				gets++
+			}
+		}
+		return gets
+	}
+	// AND informers that don't watch the ReplicaSets
+	informer := Metadata{DeploymentsFromReplicaSetNames: true, ReplicaSetLookupCacheLen: 10}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	assert.Empty(t, informer.replicaSets)
+
+	// WHEN the Pod has the pod-template-hash label of its ReplicaSet
+	pod := informer.PodWithOwnerInfo(replicaSetPod("frontend-5d4f7b9c8", "5d4f7b9c8"))
+	// THEN the Deployment is derived from the ReplicaSet name, without fetching the ReplicaSet
+	assert.Equal(t, "ReplicaSet:frontend-5d4f7b9c8->Deployment:frontend", ownerString(pod.Owner))
+	assert.Zero(t, replicaSetGets())
+
+	// WHEN the Deployment can't be derived
+	for i := 0; i < 3; i++ {
+		pod = informer.PodWithOwnerInfo(replicaSetPod("legacy-rs", ""))
+		// THEN the ReplicaSet is fetched once, and its Deployment is cached
+		assert.Equal(t, "ReplicaSet:legacy-rs->Deployment:legacy", ownerString(pod.Owner))
+		assert.Equal(t, 1, replicaSetGets())
+	}
+
+	// AND the ReplicaSets without Deployment, or that don't exist, are cached too
+	for i := 0; i < 3; i++ {
+		pod = informer.PodWithOwnerInfo(replicaSetPod("manual", ""))
+		assert.Equal(t, "ReplicaSet:manual->Deployment:", ownerString(pod.Owner))
+		pod = informer.PodWithOwnerInfo(replicaSetPod("missing", ""))
+		assert.Equal(t, "ReplicaSet:missing", ownerString(pod.Owner))
+		assert.Equal(t, 3, replicaSetGets())
+	}
+}
+
+func TestPodWithOwnerInfo_NoReplicaSetLookups(t *testing.T) {
+	client := fakek8sclientset.NewSimpleClientset(
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "legacy-rs", Namespace: "shop",
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "legacy"}}}},
+	)
+	// GIVEN informers that don't watch the ReplicaSets, nor fetch them
+	informer := Metadata{DeploymentsFromReplicaSetNames: true}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+
+	// THEN only the Deployments that can be derived from the ReplicaSet names are reported
+	pod := replicaSetPod("frontend-5d4f7b9c8", "5d4f7b9c8")
+	informer.FetchPodOwnerInfo(pod)
+	assert.Equal(t, "ReplicaSet:frontend-5d4f7b9c8->Deployment:frontend", ownerString(pod.Owner))
+	pod = replicaSetPod("legacy-rs", "")
+	informer.FetchPodOwnerInfo(pod)
+	assert.Equal(t, "ReplicaSet:legacy-rs", ownerString(pod.Owner))
+}
+
+// ownerString returns the owners chain from the direct owner of the pod, which is the reverse of Owner.String
+func ownerString(owner *Owner) string {
+	str := ""
+	for ; owner != nil; owner = owner.Owner {
+		if str != "" {
+			str += "->"
+		}
+		str += owner.Type.Kind() + ":" + owner.Name
+	}
+	return str
+}
@@ -0,0 +1,93 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ServiceInfo contains the metadata of a Service that is required to attribute the traffic to
+// the external hostname of the ExternalName Services, and to find the Services that select a Pod
+type ServiceInfo struct {
+	// Informers need that internal object is an ObjectMeta instance
+	metav1.ObjectMeta
+	// ExternalName is the hostname that the Service aliases. It is empty if the Service is not
+	// of ExternalName type.
+	ExternalName string
+	// Selector of the Pods that back the Service. It is empty for the Services whose endpoints
+	// are managed manually, and for the ExternalName Services.
+	Selector map[string]string
+	// Excluded is true if the namespace of the Service is excluded from the decoration by the namespace filter
+	Excluded bool
+}
+
+func (k *Metadata) initServiceInformer(informerFactory informers.SharedInformerFactory) error {
+	log := klog().With("informer", "Service")
+	services := informerFactory.Core().V1().Services().Informer()
+	// Transform any *v1.Service instance into a *ServiceInfo instance to save space
+	// in the informer's cache
+	if err := services.SetTransform(func(i interface{}) (interface{}, error) {
+		svc, ok := i.(*v1.Service)
+		if !ok {
+			// it's Ok. The K8s library just informed from an entity
+			// that has been previously transformed/stored
+			if si, ok := i.(*ServiceInfo); ok {
+				return si, nil
+			}
+			return nil, fmt.Errorf("was expecting a Service. Got: %T", i)
+		}
+		info := &ServiceInfo{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      svc.Name,
+				Namespace: svc.Namespace,
+				UID:       svc.UID,
+			},
+		}
+		info.Excluded = !k.DecoratedNamespaces.Decorated(svc.Namespace)
+		// the traffic to the other Service types is attributed from their EndpointSlices
+		if svc.Spec.Type == v1.ServiceTypeExternalName {
+			info.ExternalName = svc.Spec.ExternalName
+			if log.Enabled(context.TODO(), slog.LevelDebug) {
+				log.Debug("inserting ExternalName Service", "name", svc.Name, "namespace", svc.Namespace,
+					"externalName", info.ExternalName)
+			}
+		} else if len(svc.Spec.Selector) > 0 {
+			info.Selector = svc.Spec.Selector
+			if log.Enabled(context.TODO(), slog.LevelDebug) {
+				log.Debug("inserting Service", "name", svc.Name, "namespace", svc.Namespace,
+					"selector", info.Selector)
+			}
+		}
+		return info, nil
+	}); err != nil {
+		return fmt.Errorf("can't set Services transform: %w", err)
+	}
+	if err := k.trackWatchFailures(log, services); err != nil {
+		return fmt.Errorf("can't set Services watch error handler: %w", err)
+	}
+
+	k.services = append(k.services, services)
+	return nil
+}
+
+// ListServices returns the metadata of all the Services in the informers' stores
+func (k *Metadata) ListServices() []*ServiceInfo {
+	var infos []*ServiceInfo
+	for _, services := range k.services {
+		for _, obj := range services.GetStore().List() {
+			infos = append(infos, obj.(*ServiceInfo))
+		}
+	}
+	return infos
+}
+
+// AddServiceEventHandler listens for the Service events. It does nothing if the
+// Services informers are not enabled.
+func (k *Metadata) AddServiceEventHandler(h cache.ResourceEventHandler) (*EventHandlerRegistration, error) {
+	return addEventHandler(k.services, h)
+}
@@ -0,0 +1,61 @@
+package kube
+
+import (
+	"log/slog"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// DeletedObject returns the object of a Delete event. If the informer missed the deletion, for example
+// because its watch failed while the object was deleted, the object is wrapped into a tombstone when
+// the informer lists the objects again.
+func DeletedObject[T any](obj interface{}) (T, bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	t, ok := obj.(T)
+	return t, ok
+}
+
+// ResyncPeriod returns the period after which the informers deliver again all their objects to the
+// event handlers, as Update events
+func (k *Metadata) ResyncPeriod() time.Duration {
+	return syncTime
+}
+
+// trackWatchFailures records the resource version of the informer when its watch fails. Until the informer
+// lists the objects again, it does not deliver the events that happen in the cluster.
+func (k *Metadata) trackWatchFailures(log *slog.Logger, informer cache.SharedIndexInformer) error {
+	return informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		cache.DefaultWatchErrorHandler(r, err)
+		log.Debug("watch failed. Waiting for the informer to list the objects again", "error", err)
+		k.watchFailuresMut.Lock()
+		defer k.watchFailuresMut.Unlock()
+		if k.watchFailures == nil {
+			k.watchFailures = map[cache.SharedIndexInformer]string{}
+		}
+		// consecutive failures keep the version from before the first of them
+		if _, ok := k.watchFailures[informer]; !ok {
+			k.watchFailures[informer] = informer.LastSyncResourceVersion()
+		}
+	})
+}
+
+// Relisted returns true if any informer whose watch failed has listed the objects again since then, so
+// its event handlers might have missed the objects that were created, updated or deleted in the meantime.
+// Each relist is reported once.
+func (k *Metadata) Relisted() bool {
+	k.watchFailuresMut.Lock()
+	defer k.watchFailuresMut.Unlock()
+	relisted := false
+	for informer, version := range k.watchFailures {
+		// if nothing changed in the cluster during the disconnection, the version is the same and
+		// there is nothing to reconcile
+		if informer.LastSyncResourceVersion() != version {
+			delete(k.watchFailures, informer)
+			relisted = true
+		}
+	}
+	return relisted
+}
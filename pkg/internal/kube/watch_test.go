@@ -0,0 +1,75 @@
+package kube
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// fakeInformer only implements the methods of the informer that are used to track the watch failures
+type fakeInformer struct {
+	cache.SharedIndexInformer
+	mut          sync.Mutex
+	version      string
+	errorHandler cache.WatchErrorHandler
+}
+
+func (f *fakeInformer) SetWatchErrorHandler(handler cache.WatchErrorHandler) error {
+	f.errorHandler = handler
+	return nil
+}
+
+func (f *fakeInformer) LastSyncResourceVersion() string {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	return f.version
+}
+
+func (f *fakeInformer) sync(version string) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.version = version
+}
+
+func TestRelisted(t *testing.T) {
+	// GIVEN an informer whose watch failures are tracked
+	k := Metadata{}
+	informer := &fakeInformer{version: "100"}
+	require.NoError(t, k.trackWatchFailures(klog(), informer))
+	assert.False(t, k.Relisted())
+
+	// WHEN its watch fails repeatedly
+	informer.errorHandler(&cache.Reflector{}, errors.New("connection refused"))
+	informer.errorHandler(&cache.Reflector{}, errors.New("connection refused"))
+	// THEN it is not reported as relisted until its resource version changes
+	assert.False(t, k.Relisted())
+	informer.sync("120")
+	assert.True(t, k.Relisted())
+	// AND each relist is reported once
+	assert.False(t, k.Relisted())
+
+	// AND the versions that change without a watch failure are not reported
+	informer.sync("130")
+	assert.False(t, k.Relisted())
+}
+
+func TestDeletedObject(t *testing.T) {
+	pod := &PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "the-pod", Namespace: "the-ns"}}
+
+	deleted, ok := DeletedObject[*PodInfo](pod)
+	require.True(t, ok)
+	assert.Same(t, pod, deleted)
+
+	// the deletions that were missed by the informer are wrapped in tombstones
+	deleted, ok = DeletedObject[*PodInfo](cache.DeletedFinalStateUnknown{Key: "the-ns/the-pod", Obj: pod})
+	require.True(t, ok)
+	assert.Same(t, pod, deleted)
+
+	_, ok = DeletedObject[*ReplicaSetInfo](pod)
+	assert.False(t, ok)
+}
@@ -0,0 +1,198 @@
+// Package leader elects, among the Beyla instances of a cluster, a leader instance that runs the
+// responsibilities that only need to happen once per cluster. The election is coordinated through
+// a Kubernetes Lease.
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+)
+
+// namespaceFile contains the namespace of the pod, as mounted by Kubernetes
+const namespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+func llog() *slog.Logger {
+	return slog.With("component", "leader.Elector")
+}
+
+type Config struct {
+	// Enable the leader election. If disabled, every Beyla instance runs the cluster-scoped
+	// responsibilities.
+	Enable bool `yaml:"enable" env:"BEYLA_LEADER_ELECTION_ENABLE"`
+	// LeaseName is the name of the Kubernetes Lease that coordinates the election. All the Beyla
+	// instances that compete for the leadership must use the same name.
+	LeaseName string `yaml:"lease_name" env:"BEYLA_LEADER_ELECTION_LEASE_NAME"`
+	// LeaseNamespace is the namespace of the Kubernetes Lease. If empty, it defaults to the
+	// namespace of the Beyla pod.
+	LeaseNamespace string `yaml:"lease_namespace" env:"BEYLA_LEADER_ELECTION_LEASE_NAMESPACE"`
+	// LeaseDuration is the time that the other instances wait, since the last renewal of the
+	// Lease, before taking over the leadership.
+	LeaseDuration time.Duration `yaml:"lease_duration" env:"BEYLA_LEADER_ELECTION_LEASE_DURATION"`
+	// RenewDeadline is the time that the leader retries renewing the Lease before giving up the
+	// leadership.
+	RenewDeadline time.Duration `yaml:"renew_deadline" env:"BEYLA_LEADER_ELECTION_RENEW_DEADLINE"`
+	// RetryPeriod is the time between the attempts to acquire or renew the Lease.
+	RetryPeriod time.Duration `yaml:"retry_period" env:"BEYLA_LEADER_ELECTION_RETRY_PERIOD"`
+}
+
+func (c *Config) Validate() error {
+	if !c.Enable {
+		return nil
+	}
+	if c.LeaseName == "" {
+		return errors.New("lease_name can't be empty")
+	}
+	if c.RetryPeriod <= 0 {
+		return fmt.Errorf("retry_period must be greater than 0. Got: %v", c.RetryPeriod)
+	}
+	if c.RenewDeadline <= time.Duration(leaderelection.JitterFactor*float64(c.RetryPeriod)) {
+		return fmt.Errorf("renew_deadline (%v) must be greater than %v times the retry_period (%v)",
+			c.RenewDeadline, leaderelection.JitterFactor, c.RetryPeriod)
+	}
+	if c.LeaseDuration <= c.RenewDeadline {
+		return fmt.Errorf("lease_duration (%v) must be greater than renew_deadline (%v)",
+			c.LeaseDuration, c.RenewDeadline)
+	}
+	return nil
+}
+
+// Elector is a registry of the cluster-scoped responsibilities, which are run only while this
+// Beyla instance is the leader.
+// A nil Elector is valid: it considers that this instance is always the leader, so it runs
+// the registered responsibilities immediately.
+type Elector struct {
+	cfg      *Config
+	identity string
+	metrics  imetrics.Reporter
+
+	mt               sync.Mutex
+	responsibilities []responsibility
+	// leaderCtx is canceled when this instance loses the leadership. Nil if it is not the leader.
+	leaderCtx context.Context
+}
+
+type responsibility struct {
+	name string
+	run  func(ctx context.Context)
+}
+
+// NewElector returns an Elector that competes for the leadership with the provided identity,
+// which must be unique among the Beyla instances (e.g. the pod name).
+func NewElector(cfg *Config, identity string, metrics imetrics.Reporter) *Elector {
+	return &Elector{cfg: cfg, identity: identity, metrics: metrics}
+}
+
+// Run registers a cluster-scoped responsibility. The provided function is invoked, from another
+// goroutine, each time this instance acquires the leadership, with a context that is canceled
+// when it loses the leadership or the provided context is canceled.
+func (e *Elector) Run(ctx context.Context, name string, run func(ctx context.Context)) {
+	if e == nil {
+		go run(ctx)
+		return
+	}
+	e.mt.Lock()
+	defer e.mt.Unlock()
+	e.responsibilities = append(e.responsibilities, responsibility{name: name, run: run})
+	if e.leaderCtx != nil {
+		e.start(e.leaderCtx, responsibility{name: name, run: run})
+	}
+}
+
+// IsLeader returns whether this instance is currently the leader
+func (e *Elector) IsLeader() bool {
+	if e == nil {
+		return true
+	}
+	e.mt.Lock()
+	defer e.mt.Unlock()
+	return e.leaderCtx != nil
+}
+
+// Start competing for the leadership in background, until the context is canceled. Then, if this
+// instance is the leader, it releases the Lease so another instance can take over immediately.
+func (e *Elector) Start(ctx context.Context, client kubernetes.Interface) error {
+	namespace := e.cfg.LeaseNamespace
+	if namespace == "" {
+		namespace = podNamespace()
+	}
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Namespace: namespace, Name: e.cfg.LeaseName},
+			Client:     client.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: e.identity},
+		},
+		Name:            e.cfg.LeaseName,
+		LeaseDuration:   e.cfg.LeaseDuration,
+		RenewDeadline:   e.cfg.RenewDeadline,
+		RetryPeriod:     e.cfg.RetryPeriod,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: e.startLeading,
+			OnStoppedLeading: e.stopLeading,
+			OnNewLeader: func(identity string) {
+				llog().Debug("new leader elected", "leader", identity)
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("creating leader elector: %w", err)
+	}
+	llog().Info("starting leader election", "lease", namespace+"/"+e.cfg.LeaseName, "identity", e.identity)
+	go func() {
+		// after losing the leadership, this instance competes again for it
+		for ctx.Err() == nil {
+			elector.Run(ctx)
+		}
+	}()
+	return nil
+}
+
+func (e *Elector) startLeading(ctx context.Context) {
+	llog().Info("acquired the leadership. Running the cluster-scoped responsibilities")
+	e.metrics.LeaderElection(true)
+	e.mt.Lock()
+	defer e.mt.Unlock()
+	e.leaderCtx = ctx
+	for _, r := range e.responsibilities {
+		e.start(ctx, r)
+	}
+}
+
+// stopLeading is also invoked when the election ends without having acquired the leadership
+func (e *Elector) stopLeading() {
+	e.mt.Lock()
+	defer e.mt.Unlock()
+	if e.leaderCtx == nil {
+		return
+	}
+	e.leaderCtx = nil
+	llog().Info("lost the leadership. Stopping the cluster-scoped responsibilities")
+	e.metrics.LeaderElection(false)
+}
+
+func (e *Elector) start(ctx context.Context, r responsibility) {
+	llog().Debug("running cluster-scoped responsibility", "name", r.name)
+	go r.run(ctx)
+}
+
+func podNamespace() string {
+	if ns, err := os.ReadFile(namespaceFile); err == nil {
+		if ns := strings.TrimSpace(string(ns)); ns != "" {
+			return ns
+		}
+	}
+	return metav1.NamespaceDefault
+}
@@ -0,0 +1,124 @@
+package leader
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mariomac/guara/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+	"github.com/grafana/beyla/pkg/internal/testutil"
+)
+
+const timeout = 10 * time.Second
+
+var testConfig = Config{
+	Enable:         true,
+	LeaseName:      "beyla-leader",
+	LeaseNamespace: "beyla",
+	LeaseDuration:  2 * time.Second,
+	RenewDeadline:  time.Second,
+	RetryPeriod:    200 * time.Millisecond,
+}
+
+type leaderMetrics struct {
+	imetrics.NoopReporter
+	mt          sync.Mutex
+	transitions []bool
+}
+
+func (m *leaderMetrics) LeaderElection(leading bool) {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	m.transitions = append(m.transitions, leading)
+}
+
+func (m *leaderMetrics) get() []bool {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	return append([]bool{}, m.transitions...)
+}
+
+// responsibilityState returns a responsibility that reports to the returned channel
+// whether it is running or has stopped
+func responsibilityState() (func(ctx context.Context), chan bool) {
+	running := make(chan bool, 10)
+	return func(ctx context.Context) {
+		running <- true
+		<-ctx.Done()
+		running <- false
+	}, running
+}
+
+func TestElector_Handover(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// GIVEN a Beyla instance that is the leader
+	firstMetrics := &leaderMetrics{}
+	firstCtx, stopFirst := context.WithCancel(ctx)
+	first := NewElector(&testConfig, "first", firstMetrics)
+	firstRun, firstRunning := responsibilityState()
+	first.Run(ctx, "test", firstRun)
+	require.NoError(t, first.Start(firstCtx, client))
+	assert.True(t, testutil.ReadChannel(t, firstRunning, timeout))
+	assert.True(t, first.IsLeader())
+
+	// AND another instance that competes for the leadership
+	secondMetrics := &leaderMetrics{}
+	second := NewElector(&testConfig, "second", secondMetrics)
+	require.NoError(t, second.Start(ctx, client))
+	secondRun, secondRunning := responsibilityState()
+	second.Run(ctx, "test", secondRun)
+
+	// THEN the responsibilities only run in the leader
+	time.Sleep(testConfig.LeaseDuration)
+	assert.False(t, second.IsLeader())
+	assert.Empty(t, secondRunning)
+
+	// WHEN the leader stops
+	stopFirst()
+
+	// THEN its responsibilities are stopped
+	assert.False(t, testutil.ReadChannel(t, firstRunning, timeout))
+	// AND the other instance takes over the leadership
+	assert.True(t, testutil.ReadChannel(t, secondRunning, timeout))
+	test.Eventually(t, timeout, func(t require.TestingT) {
+		assert.False(t, first.IsLeader())
+		assert.True(t, second.IsLeader())
+	})
+	// AND the leadership transitions are reported
+	assert.Equal(t, []bool{true, false}, firstMetrics.get())
+	assert.Equal(t, []bool{true}, secondMetrics.get())
+}
+
+func TestElector_Nil(t *testing.T) {
+	var elector *Elector
+	run, running := responsibilityState()
+	elector.Run(context.Background(), "test", run)
+	assert.True(t, testutil.ReadChannel(t, running, timeout))
+	assert.True(t, elector.IsLeader())
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.NoError(t, (&Config{}).Validate())
+	assert.NoError(t, testConfig.Validate())
+
+	cfg := testConfig
+	cfg.LeaseName = ""
+	assert.Error(t, cfg.Validate())
+
+	cfg = testConfig
+	cfg.LeaseDuration = cfg.RenewDeadline
+	assert.Error(t, cfg.Validate())
+
+	cfg = testConfig
+	cfg.RenewDeadline = cfg.RetryPeriod
+	assert.Error(t, cfg.Validate())
+}
@@ -0,0 +1,101 @@
+package loadshed
+
+import (
+	"context"
+	"syscall"
+	"time"
+)
+
+// controller periodically checks the backlog of captured events and the CPU usage of Beyla, and
+// increases or decreases the shedding level accordingly.
+type controller struct {
+	shedder *Shedder
+	// backlog returns the fraction of the captured events queue that is filled
+	backlog func() float64
+	// cpuTime and now can be overridden for testing
+	cpuTime func() time.Duration
+	now     func() time.Time
+
+	lastCheck time.Time
+	lastCPU   time.Duration
+	// lowSince is the time since the load stays below the low thresholds. It is zero if the
+	// load is above them.
+	lowSince time.Time
+}
+
+// Start checking the load in background, until the context is canceled. The backlog function
+// returns the fraction of the captured events queue that is filled.
+func (s *Shedder) Start(ctx context.Context, backlog func() float64) {
+	if s == nil {
+		return
+	}
+	c := s.controller(backlog)
+	llog().Info("load shedding enabled", "backlogHigh", s.cfg.BacklogHigh, "cpuHigh", s.cfg.CPUHigh)
+	go func() {
+		ticker := time.NewTicker(s.cfg.CheckPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.check()
+			}
+		}
+	}()
+}
+
+func (s *Shedder) controller(backlog func() float64) *controller {
+	c := &controller{shedder: s, backlog: backlog, cpuTime: processCPUTime, now: time.Now}
+	c.lastCheck, c.lastCPU = c.now(), c.cpuTime()
+	return c
+}
+
+func (c *controller) check() {
+	cfg := c.shedder.cfg
+	now, cpuTime := c.now(), c.cpuTime()
+	var cpu float64
+	if elapsed := now.Sub(c.lastCheck); elapsed > 0 {
+		cpu = (cpuTime - c.lastCPU).Seconds() / elapsed.Seconds()
+	}
+	c.lastCheck, c.lastCPU = now, cpuTime
+	backlog := c.backlog()
+
+	level := c.shedder.Level()
+	switch {
+	case backlog >= cfg.BacklogHigh || (cfg.CPUHigh > 0 && cpu >= cfg.CPUHigh):
+		c.lowSince = time.Time{}
+		if level < RequestAttributes {
+			llog().Warn("Beyla can't keep the pace of the captured events. Shedding load",
+				"level", level+1, "backlog", backlog, "cpu", cpu)
+			c.shedder.setLevel(level + 1)
+		}
+	case backlog <= cfg.BacklogLow && (cfg.CPUHigh == 0 || cpu <= cfg.CPULow):
+		if level == None {
+			return
+		}
+		if c.lowSince.IsZero() {
+			c.lowSince = now
+		}
+		if now.Sub(c.lowSince) >= cfg.RecoveryDelay {
+			llog().Info("load decreased. Recovering the shed work",
+				"level", level-1, "backlog", backlog, "cpu", cpu)
+			c.shedder.setLevel(level - 1)
+			// the next level is recovered after another delay
+			c.lowSince = now
+		}
+	default:
+		// between the low and high thresholds, the current level is kept
+		c.lowSince = time.Time{}
+	}
+}
+
+// processCPUTime returns the user and system CPU time that has been consumed by the Beyla process
+func processCPUTime() time.Duration {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		llog().Debug("can't read the CPU usage", "error", err)
+		return 0
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
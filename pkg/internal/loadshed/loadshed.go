@@ -0,0 +1,119 @@
+// Package loadshed progressively disables the most expensive processing of the application spans
+// when Beyla can't keep the pace of the captured events, or when its own CPU usage is too high,
+// so the RED metrics can be preserved during the traffic spikes. The processing is restored
+// automatically when the load decreases.
+package loadshed
+
+import (
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+)
+
+func llog() *slog.Logger {
+	return slog.With("component", "loadshed.Shedder")
+}
+
+// Level of load shedding. Each level also sheds the work of the previous levels.
+type Level int32
+
+const (
+	// None of the processing is shed
+	None Level = iota
+	// SpanExport stops exporting the traces of the services with the highest span rates
+	SpanExport
+	// BodySize stops recording the size of the HTTP request bodies
+	BodySize
+	// RequestAttributes removes the attributes whose value changes on each request: the URL path,
+	// and the client address of the server spans
+	RequestAttributes
+)
+
+var levelNames = [...]string{"none", "span_export", "body_size", "request_attributes"}
+
+func (l Level) String() string {
+	if l < None || l > RequestAttributes {
+		return fmt.Sprintf("unknown(%d)", int32(l))
+	}
+	return levelNames[l]
+}
+
+// Config of the load shedding
+type Config struct {
+	Enable bool `yaml:"enable" env:"BEYLA_LOAD_SHEDDING_ENABLE"`
+	// CheckPeriod between the checks of the load. The shedding level changes at most once per check.
+	CheckPeriod time.Duration `yaml:"check_period" env:"BEYLA_LOAD_SHEDDING_CHECK_PERIOD"`
+	// BacklogHigh is the fraction of the captured events queue above which the shedding level is increased
+	BacklogHigh float64 `yaml:"backlog_high" env:"BEYLA_LOAD_SHEDDING_BACKLOG_HIGH"`
+	// BacklogLow is the fraction of the captured events queue below which the shedding level can be decreased
+	BacklogLow float64 `yaml:"backlog_low" env:"BEYLA_LOAD_SHEDDING_BACKLOG_LOW"`
+	// CPUHigh is the CPU usage of Beyla, in cores, above which the shedding level is increased.
+	// 0 ignores the CPU usage.
+	CPUHigh float64 `yaml:"cpu_high" env:"BEYLA_LOAD_SHEDDING_CPU_HIGH"`
+	// CPULow is the CPU usage of Beyla, in cores, below which the shedding level can be decreased
+	CPULow float64 `yaml:"cpu_low" env:"BEYLA_LOAD_SHEDDING_CPU_LOW"`
+	// RecoveryDelay is the time that the load must stay below the low thresholds before the
+	// shedding level is decreased by one
+	RecoveryDelay time.Duration `yaml:"recovery_delay" env:"BEYLA_LOAD_SHEDDING_RECOVERY_DELAY"`
+}
+
+func (c *Config) Validate() error {
+	if !c.Enable {
+		return nil
+	}
+	if c.CheckPeriod <= 0 {
+		return fmt.Errorf("check_period must be greater than 0. Got: %v", c.CheckPeriod)
+	}
+	if c.BacklogLow < 0 || c.BacklogLow >= c.BacklogHigh || c.BacklogHigh > 1 {
+		return fmt.Errorf("backlog_low and backlog_high must verify 0 <= backlog_low < backlog_high <= 1. Got: %v and %v",
+			c.BacklogLow, c.BacklogHigh)
+	}
+	if c.CPUHigh < 0 || (c.CPUHigh > 0 && (c.CPULow < 0 || c.CPULow >= c.CPUHigh)) {
+		return fmt.Errorf("cpu_low and cpu_high must verify 0 <= cpu_low < cpu_high, or cpu_high = 0. Got: %v and %v",
+			c.CPULow, c.CPUHigh)
+	}
+	if c.RecoveryDelay < 0 {
+		return fmt.Errorf("recovery_delay can't be negative. Got: %v", c.RecoveryDelay)
+	}
+	return nil
+}
+
+// Shedder keeps the current shedding level, which is checked by the components that perform
+// the shed work. A nil Shedder is valid: it never sheds any work.
+type Shedder struct {
+	cfg     *Config
+	metrics imetrics.Reporter
+	level   atomic.Int32
+}
+
+// New returns a Shedder for the provided configuration, or nil if the load shedding is disabled.
+func New(cfg *Config, metrics imetrics.Reporter) *Shedder {
+	if !cfg.Enable {
+		return nil
+	}
+	if metrics == nil {
+		metrics = imetrics.NoopReporter{}
+	}
+	return &Shedder{cfg: cfg, metrics: metrics}
+}
+
+// Level of load shedding
+func (s *Shedder) Level() Level {
+	if s == nil {
+		return None
+	}
+	return Level(s.level.Load())
+}
+
+// Shedding returns whether the work of the provided level is being shed
+func (s *Shedder) Shedding(l Level) bool {
+	return s.Level() >= l
+}
+
+func (s *Shedder) setLevel(l Level) {
+	s.level.Store(int32(l))
+	s.metrics.LoadSheddingTransition(int(l), l.String())
+}
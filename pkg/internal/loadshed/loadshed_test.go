@@ -0,0 +1,244 @@
+package loadshed
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+type shedMetrics struct {
+	imetrics.NoopReporter
+	mt          sync.Mutex
+	transitions []string
+	spans       map[string]int
+}
+
+func (m *shedMetrics) LoadSheddingTransition(_ int, name string) {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	m.transitions = append(m.transitions, name)
+}
+
+func (m *shedMetrics) LoadSheddingSpans(work string, spans int) {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	m.spans[work] += spans
+}
+
+func testConfig() *Config {
+	return &Config{
+		Enable:        true,
+		CheckPeriod:   time.Second,
+		BacklogHigh:   0.8,
+		BacklogLow:    0.2,
+		CPUHigh:       2,
+		CPULow:        1,
+		RecoveryDelay: 10 * time.Second,
+	}
+}
+
+// fakeLoad replaces the clock, the CPU time and the backlog of a controller
+type fakeLoad struct {
+	now     time.Time
+	cpuTime time.Duration
+	backlog float64
+}
+
+// tick advances the clock by a second, with the provided CPU usage in cores
+func (f *fakeLoad) tick(c *controller, cpu float64, backlog float64) {
+	f.now = f.now.Add(time.Second)
+	f.cpuTime += time.Duration(cpu * float64(time.Second))
+	f.backlog = backlog
+	c.check()
+}
+
+func testController(shedder *Shedder) (*controller, *fakeLoad) {
+	load := &fakeLoad{now: time.Unix(0, 0)}
+	c := shedder.controller(func() float64 { return load.backlog })
+	c.now = func() time.Time { return load.now }
+	c.cpuTime = func() time.Duration { return load.cpuTime }
+	c.lastCheck, c.lastCPU = load.now, load.cpuTime
+	return c, load
+}
+
+func TestController(t *testing.T) {
+	metrics := &shedMetrics{spans: map[string]int{}}
+	shedder := New(testConfig(), metrics)
+	c, load := testController(shedder)
+
+	// WHEN the load is below the high thresholds
+	load.tick(c, 0.5, 0.5)
+	// THEN nothing is shed
+	assert.Equal(t, None, shedder.Level())
+	assert.False(t, shedder.Shedding(SpanExport))
+
+	// WHEN the backlog exceeds the high threshold
+	load.tick(c, 0.5, 0.9)
+	// THEN the level is increased, one level per check
+	assert.Equal(t, SpanExport, shedder.Level())
+	assert.False(t, shedder.Shedding(BodySize))
+	// AND WHEN the CPU usage also exceeds the high threshold
+	load.tick(c, 2.5, 0.5)
+	load.tick(c, 2.5, 0.5)
+	load.tick(c, 2.5, 0.9)
+	// THEN the level is increased up to the maximum level
+	assert.Equal(t, RequestAttributes, shedder.Level())
+	assert.True(t, shedder.Shedding(SpanExport))
+	assert.True(t, shedder.Shedding(BodySize))
+
+	// WHEN the load is between the low and high thresholds
+	for i := 0; i < 20; i++ {
+		load.tick(c, 1.5, 0.1)
+	}
+	// THEN the level is kept
+	assert.Equal(t, RequestAttributes, shedder.Level())
+
+	// WHEN the load goes below the low thresholds
+	for i := 0; i < 10; i++ {
+		load.tick(c, 0.5, 0.1)
+	}
+	// THEN the level is not decreased until the recovery delay has passed
+	assert.Equal(t, RequestAttributes, shedder.Level())
+	load.tick(c, 0.5, 0.1)
+	assert.Equal(t, BodySize, shedder.Level())
+	// AND each other level is recovered after another delay
+	for i := 0; i < 10; i++ {
+		load.tick(c, 0.5, 0.1)
+	}
+	assert.Equal(t, SpanExport, shedder.Level())
+	// AND a spike during the recovery restarts the delay
+	load.tick(c, 1.5, 0.1)
+	for i := 0; i < 10; i++ {
+		load.tick(c, 0.5, 0.1)
+	}
+	assert.Equal(t, SpanExport, shedder.Level())
+	load.tick(c, 0.5, 0.1)
+	assert.Equal(t, None, shedder.Level())
+
+	// AND every transition is counted
+	assert.Equal(t, []string{
+		"span_export", "body_size", "request_attributes",
+		"body_size", "span_export", "none",
+	}, metrics.transitions)
+}
+
+func TestController_IgnoreCPU(t *testing.T) {
+	cfg := testConfig()
+	cfg.CPUHigh, cfg.CPULow = 0, 0
+	shedder := New(cfg, nil)
+	c, load := testController(shedder)
+
+	// a high CPU usage is ignored if the CPU threshold is 0
+	load.tick(c, 10, 0.5)
+	assert.Equal(t, None, shedder.Level())
+	load.tick(c, 10, 0.8)
+	assert.Equal(t, SpanExport, shedder.Level())
+}
+
+func span(uid svc.UID, typ request.EventType) request.Span {
+	return request.Span{
+		Type:      typ,
+		Path:      "/users/1234",
+		Route:     "/users/{id}",
+		Peer:      "1.2.3.4",
+		PeerName:  "client",
+		Host:      "5.6.7.8",
+		ServiceID: svc.ID{UID: uid},
+	}
+}
+
+func TestSpansStage(t *testing.T) {
+	metrics := &shedMetrics{spans: map[string]int{}}
+	shedder := New(testConfig(), metrics)
+	st := shedder.spansStage()
+	now := st.windowStart
+	st.now = func() time.Time { return now }
+
+	// GIVEN a window where the "busy" service has a span rate above the average
+	batch := func() []request.Span {
+		return []request.Span{
+			span("busy", request.EventTypeHTTP),
+			span("busy", request.EventTypeHTTPClient),
+			span("busy", request.EventTypeGRPC),
+			span("quiet", request.EventTypeHTTP),
+		}
+	}
+	// WHEN nothing is shed
+	spans := st.shed(batch())
+	// THEN the spans are forwarded unmodified
+	assert.Equal(t, batch(), spans)
+
+	// WHEN the traces export is shed after the first window
+	now = now.Add(time.Second)
+	shedder.setLevel(SpanExport)
+	spans = st.shed(batch())
+	// THEN the traces of the high-volume services are not exported
+	require.Len(t, spans, 4)
+	for _, s := range spans[:3] {
+		assert.Equal(t, request.IgnoreTraces, s.IgnoreSpan)
+	}
+	assert.Zero(t, spans[3].IgnoreSpan)
+	// AND the spans that are ignored also for metrics are removed
+	ignored := span("busy", request.EventTypeHTTP)
+	ignored.IgnoreSpan = request.IgnoreMetrics
+	spans = st.shed([]request.Span{ignored, span("quiet", request.EventTypeHTTP)})
+	require.Len(t, spans, 1)
+	assert.Equal(t, svc.UID("quiet"), spans[0].ServiceID.UID)
+
+	// WHEN the per-request attributes are shed
+	shedder.setLevel(RequestAttributes)
+	spans = st.shed(batch())
+	// THEN the URL path and the client address of the server spans are removed
+	require.Len(t, spans, 4)
+	assert.Empty(t, spans[0].Path)
+	assert.Empty(t, spans[0].Peer)
+	assert.Empty(t, spans[0].PeerName)
+	assert.Empty(t, spans[1].Path)
+	assert.Equal(t, "1.2.3.4", spans[1].Peer)
+	assert.Empty(t, spans[2].Peer)
+	// AND the attributes of the RED metrics are kept
+	for _, s := range spans {
+		assert.Equal(t, "/users/{id}", s.Route)
+		assert.Equal(t, "5.6.7.8", s.Host)
+	}
+
+	// AND the affected spans are counted by shed work
+	assert.Equal(t, map[string]int{
+		"span_export":        4 + 3,
+		"body_size":          3,
+		"request_attributes": 4,
+	}, metrics.spans)
+}
+
+func TestShedder_Nil(t *testing.T) {
+	shedder := New(&Config{}, nil)
+	require.Nil(t, shedder)
+	assert.Equal(t, None, shedder.Level())
+	assert.False(t, shedder.Shedding(SpanExport))
+	node, err := shedder.Provide()
+	require.NoError(t, err)
+	assert.Nil(t, node)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.NoError(t, (&Config{}).Validate())
+	assert.NoError(t, testConfig().Validate())
+	cfg := testConfig()
+	cfg.CPUHigh, cfg.CPULow = 0, 0
+	assert.NoError(t, cfg.Validate())
+	cfg.BacklogHigh = 1.5
+	assert.Error(t, cfg.Validate())
+	cfg = testConfig()
+	cfg.CPULow = 3
+	assert.Error(t, cfg.Validate())
+	cfg = testConfig()
+	cfg.CheckPeriod = 0
+	assert.Error(t, cfg.Validate())
+}
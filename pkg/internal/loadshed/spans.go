@@ -0,0 +1,148 @@
+package loadshed
+
+import (
+	"time"
+
+	"github.com/mariomac/pipes/pipe"
+
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+// Provide the pipeline stage that sheds the work of the spans, according to the current level.
+// The body size is not recorded by the metrics exporters, which check the level by themselves.
+// The stage is bypassed if the load shedding is disabled.
+func (s *Shedder) Provide() (pipe.MiddleFunc[[]request.Span, []request.Span], error) {
+	if s == nil {
+		return pipe.Bypass[[]request.Span](), nil
+	}
+	st := s.spansStage()
+	return func(in <-chan []request.Span, out chan<- []request.Span) {
+		for spans := range in {
+			if spans = st.shed(spans); len(spans) > 0 {
+				out <- spans
+			}
+		}
+	}, nil
+}
+
+// spansStage accounts the span rate of each service, to find the high-volume services whose
+// traces are not exported while the SpanExport level is shed.
+type spansStage struct {
+	shedder *Shedder
+	// now can be overridden for testing
+	now func() time.Time
+
+	windowStart time.Time
+	// spans of each service since the start of the current window
+	counts map[svc.UID]int
+	// highVolume services in the previous window
+	highVolume map[svc.UID]struct{}
+}
+
+func (s *Shedder) spansStage() *spansStage {
+	st := &spansStage{shedder: s, now: time.Now, counts: map[svc.UID]int{}}
+	st.windowStart = st.now()
+	return st
+}
+
+func (st *spansStage) shed(spans []request.Span) []request.Span {
+	for i := range spans {
+		st.counts[spans[i].ServiceID.UID]++
+	}
+	if now := st.now(); now.Sub(st.windowStart) >= st.shedder.cfg.CheckPeriod {
+		st.rotateWindow(now)
+	}
+
+	level := st.shedder.Level()
+	if level == None {
+		return spans
+	}
+	metrics := st.shedder.metrics
+	if level >= SpanExport {
+		var shed int
+		spans, shed = st.shedTraces(spans)
+		if shed > 0 {
+			metrics.LoadSheddingSpans(SpanExport.String(), shed)
+		}
+	}
+	if level >= BodySize {
+		if n := countHTTP(spans); n > 0 {
+			metrics.LoadSheddingSpans(BodySize.String(), n)
+		}
+	}
+	if level >= RequestAttributes {
+		if n := removeRequestAttributes(spans); n > 0 {
+			metrics.LoadSheddingSpans(RequestAttributes.String(), n)
+		}
+	}
+	return spans
+}
+
+// rotateWindow selects as high-volume services the services whose span count in the finished window
+// is equal or above the average of all the services, and starts a new window
+func (st *spansStage) rotateWindow(now time.Time) {
+	total := 0
+	for _, n := range st.counts {
+		total += n
+	}
+	st.highVolume = make(map[svc.UID]struct{}, len(st.counts))
+	for uid, n := range st.counts {
+		if n*len(st.counts) >= total {
+			st.highVolume[uid] = struct{}{}
+		}
+	}
+	st.counts = make(map[svc.UID]int, len(st.counts))
+	st.windowStart = now
+}
+
+// shedTraces stops exporting the traces of the high-volume services. The spans that are also ignored for
+// metrics are removed from the batch. It returns the number of shed spans.
+func (st *spansStage) shedTraces(spans []request.Span) ([]request.Span, int) {
+	shed := 0
+	kept := spans[:0]
+	for i := range spans {
+		span := &spans[i]
+		if _, ok := st.highVolume[span.ServiceID.UID]; ok && span.IgnoreSpan != request.IgnoreTraces {
+			shed++
+			if span.IgnoreSpan == request.IgnoreMetrics {
+				continue
+			}
+			span.IgnoreSpan = request.IgnoreTraces
+		}
+		kept = append(kept, *span)
+	}
+	return kept, shed
+}
+
+func countHTTP(spans []request.Span) int {
+	n := 0
+	for i := range spans {
+		if spans[i].Type == request.EventTypeHTTP || spans[i].Type == request.EventTypeHTTPClient {
+			n++
+		}
+	}
+	return n
+}
+
+// removeRequestAttributes removes the URL path, as the route is kept, and the client address of
+// the server spans. It returns the number of modified spans.
+func removeRequestAttributes(spans []request.Span) int {
+	n := 0
+	for i := range spans {
+		span := &spans[i]
+		modified := false
+		if span.Type == request.EventTypeHTTP || span.Type == request.EventTypeHTTPClient {
+			modified = span.Path != ""
+			span.Path = ""
+		}
+		if !span.IsClientSpan() && (span.Peer != "" || span.PeerName != "") {
+			modified = true
+			span.Peer, span.PeerName = "", ""
+		}
+		if modified {
+			n++
+		}
+	}
+	return n
+}
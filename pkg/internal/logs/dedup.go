@@ -0,0 +1,180 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxDedupEntries limits the number of distinct messages that are tracked. When it is reached,
+// the messages that haven't been repeated during the last period are forgotten.
+const maxDedupEntries = 1000
+
+// DedupConfig limits the repeated warning and error messages
+type DedupConfig struct {
+	// Burst is the number of identical messages (same component and message) that are logged
+	// before being summarized. 0 disables the deduplication.
+	Burst int `yaml:"burst" env:"BEYLA_LOG_DEDUP_BURST"`
+	// Period between the summaries of the suppressed messages. The messages are logged again at full
+	// rate if they are not repeated during a whole period.
+	Period time.Duration `yaml:"period" env:"BEYLA_LOG_DEDUP_PERIOD"`
+}
+
+// Dedup suppresses the repetitions of identical warning and error messages, and periodically
+// logs how many times they have been repeated. The summaries of the messages that stop being
+// repeated are flushed in background after Start is invoked.
+type Dedup struct {
+	cfg DedupConfig
+	// clock can be overridden for testing
+	clock        func() time.Time
+	onSuppressed atomic.Pointer[func(component string)]
+
+	mt      sync.Mutex
+	entries map[dedupKey]*dedupEntry
+}
+
+type dedupKey struct {
+	component string
+	message   string
+}
+
+type dedupEntry struct {
+	occurrences int
+	suppressed  int
+	lastSeen    time.Time
+	lastSummary time.Time
+	// last suppressed record, and the handler that would have written it
+	last    slog.Record
+	handler slog.Handler
+}
+
+// summary is a record that reports how many times a message has been suppressed
+type summary struct {
+	handler slog.Handler
+	record  slog.Record
+}
+
+// summarize returns the summary of the suppressed messages of the entry, and resets its count
+func (e *dedupEntry) summarize(now time.Time) summary {
+	s := summary{handler: e.handler, record: e.last}
+	s.record.Message = fmt.Sprintf("%s (repeated %d times)", e.last.Message, e.suppressed)
+	e.suppressed = 0
+	e.lastSummary = now
+	e.last, e.handler = slog.Record{}, nil
+	return s
+}
+
+func (s *summary) write(ctx context.Context) {
+	if s.handler != nil {
+		_ = s.handler.Handle(ctx, s.record)
+	}
+}
+
+func NewDedup(cfg *DedupConfig) *Dedup {
+	return &Dedup{cfg: *cfg, clock: time.Now, entries: map[dedupKey]*dedupEntry{}}
+}
+
+// ReportTo sets a function that is invoked each time a message is suppressed
+func (d *Dedup) ReportTo(onSuppressed func(component string)) {
+	d.onSuppressed.Store(&onSuppressed)
+}
+
+// Start flushing periodically the summaries of the suppressed messages, until the context is canceled.
+// Otherwise, the summaries of the messages that stop being repeated are never logged.
+func (d *Dedup) Start(ctx context.Context) {
+	if d == nil || d.cfg.Burst <= 0 || d.cfg.Period <= 0 {
+		return
+	}
+	ticker := time.NewTicker(d.cfg.Period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, s := range d.flush(d.clock()) {
+				s.write(ctx)
+			}
+		}
+	}
+}
+
+// flush returns the summaries of the messages that have been suppressed since, at least, a period ago
+func (d *Dedup) flush(now time.Time) []summary {
+	d.mt.Lock()
+	defer d.mt.Unlock()
+	var summaries []summary
+	for _, e := range d.entries {
+		if e.suppressed > 0 && now.Sub(e.lastSummary) >= d.cfg.Period {
+			summaries = append(summaries, e.summarize(now))
+		}
+	}
+	return summaries
+}
+
+// filter returns whether the record must be logged by the provided handler. If the record summarizes
+// previously suppressed messages, its message is suffixed with the number of repetitions.
+// If the record restarts the logging of a message that was not repeated during a whole period, it
+// also returns the pending summary of the message, which must be logged before the record.
+func (d *Dedup) filter(component string, handler slog.Handler, record *slog.Record) (bool, *summary) {
+	if d == nil || d.cfg.Burst <= 0 || record.Level < slog.LevelWarn {
+		return true, nil
+	}
+	now := d.clock()
+	d.mt.Lock()
+	defer d.mt.Unlock()
+	key := dedupKey{component: component, message: record.Message}
+	e, ok := d.entries[key]
+	if !ok && len(d.entries) >= maxDedupEntries {
+		d.forget(now)
+		if len(d.entries) >= maxDedupEntries {
+			// too many distinct messages to track
+			return true, nil
+		}
+	}
+	var pending *summary
+	if !ok || now.Sub(e.lastSeen) > d.cfg.Period {
+		if ok && e.suppressed > 0 {
+			s := e.summarize(now)
+			pending = &s
+		}
+		e = &dedupEntry{}
+		d.entries[key] = e
+	}
+	e.lastSeen = now
+	e.occurrences++
+	if e.occurrences <= d.cfg.Burst {
+		if e.occurrences == d.cfg.Burst {
+			e.lastSummary = now
+		}
+		return true, pending
+	}
+	if now.Sub(e.lastSummary) < d.cfg.Period {
+		e.suppressed++
+		// the record is retained after the handler returns, so it must be cloned
+		e.last, e.handler = record.Clone(), handler
+		if report := d.onSuppressed.Load(); report != nil {
+			(*report)(component)
+		}
+		return false, pending
+	}
+	// this message summarizes the previously suppressed messages
+	record.Message = fmt.Sprintf("%s (repeated %d times)", record.Message, e.suppressed+1)
+	e.suppressed = 0
+	e.lastSummary = now
+	e.last, e.handler = slog.Record{}, nil
+	return true, pending
+}
+
+// forget the messages that haven't been repeated during the last period, and whose
+// summary has been already flushed
+func (d *Dedup) forget(now time.Time) {
+	for k, e := range d.entries {
+		if now.Sub(e.lastSeen) > d.cfg.Period && e.suppressed == 0 {
+			delete(d.entries, k)
+		}
+	}
+}
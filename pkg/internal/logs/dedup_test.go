@@ -0,0 +1,138 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedup(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	dedup := NewDedup(&DedupConfig{Burst: 3, Period: time.Minute})
+	dedup.clock = func() time.Time { return now }
+	suppressed := map[string]int{}
+	dedup.ReportTo(func(component string) { suppressed[component]++ })
+
+	levels, err := NewLevels("INFO", nil)
+	require.NoError(t, err)
+	out := &bytes.Buffer{}
+	h, err := NewHandler(out, FormatText, levels, dedup)
+	require.NoError(t, err)
+	log := slog.New(h).With(ComponentKey, "otel.MetricsReporter")
+
+	lines := func() []string {
+		defer out.Reset()
+		return strings.Split(strings.TrimSpace(out.String()), "\n")
+	}
+
+	// identical errors are logged at full rate for the first occurrences
+	for i := 0; i < 10; i++ {
+		log.Error("can't export metrics", "attempt", i)
+		now = now.Add(time.Second)
+	}
+	// other messages and info messages are not affected
+	log.Error("another error")
+	for i := 0; i < 5; i++ {
+		log.Info("some info")
+	}
+	logged := lines()
+	assert.Len(t, logged, 3+1+5)
+	assert.Equal(t, map[string]int{"otel.MetricsReporter": 7}, suppressed)
+
+	// after a period since the last logged message, the suppressed messages are summarized
+	now = now.Add(55 * time.Second)
+	log.Error("can't export metrics", "attempt", 10)
+	logged = lines()
+	require.Len(t, logged, 1)
+	assert.Contains(t, logged[0], "can't export metrics (repeated 8 times)")
+	assert.Contains(t, logged[0], "attempt=10")
+
+	// the summaries keep being periodic while the messages are repeated
+	log.Error("can't export metrics")
+	assert.Empty(t, strings.TrimSpace(out.String()))
+
+	// the messages are logged again at full rate if they are not repeated during a whole period,
+	// after the summary of the last suppressed message
+	now = now.Add(2 * time.Minute)
+	log.Error("can't export metrics")
+	log.Error("can't export metrics")
+	logged = lines()
+	require.Len(t, logged, 3)
+	assert.Contains(t, logged[0], "can't export metrics (repeated 1 times)")
+	assert.NotContains(t, logged[1], "repeated")
+	assert.NotContains(t, logged[2], "repeated")
+}
+
+func TestDedup_PendingSummaries(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	dedup := NewDedup(&DedupConfig{Burst: 1, Period: time.Minute})
+	dedup.clock = func() time.Time { return now }
+
+	levels, err := NewLevels("INFO", nil)
+	require.NoError(t, err)
+	out := &bytes.Buffer{}
+	h, err := NewHandler(out, FormatText, levels, dedup)
+	require.NoError(t, err)
+	log := slog.New(h).With(ComponentKey, "otel.TracesReporter")
+
+	lines := func() []string {
+		defer out.Reset()
+		return strings.Split(strings.TrimSpace(out.String()), "\n")
+	}
+
+	// GIVEN a message that is suppressed and then stops being repeated
+	for i := 0; i < 4; i++ {
+		log.Error("can't export traces", "attempt", i)
+		now = now.Add(time.Second)
+	}
+	require.Len(t, lines(), 1)
+
+	// WHEN the summaries are flushed before a whole period passes
+	assert.Empty(t, dedup.flush(now))
+
+	// THEN they are flushed after a period since the last summary
+	now = now.Add(time.Minute)
+	for _, s := range dedup.flush(now) {
+		s.write(context.Background())
+	}
+	logged := lines()
+	require.Len(t, logged, 1)
+	assert.Contains(t, logged[0], "can't export traces (repeated 3 times)")
+	assert.Contains(t, logged[0], "component=otel.TracesReporter")
+	assert.Contains(t, logged[0], "attempt=3")
+	// AND they are not flushed again
+	assert.Empty(t, dedup.flush(now.Add(time.Hour)))
+
+	// GIVEN a message that is suppressed and then stops being repeated
+	for i := 0; i < 3; i++ {
+		log.Warn("can't resolve host", "attempt", i)
+		now = now.Add(time.Second)
+	}
+	require.Len(t, lines(), 1)
+	// WHEN it is repeated again after a whole period, before the summary is flushed
+	now = now.Add(2 * time.Minute)
+	log.Warn("can't resolve host", "attempt", 3)
+	// THEN the summary of the suppressed messages is logged before the message
+	logged = lines()
+	require.Len(t, logged, 2)
+	assert.Contains(t, logged[0], "can't resolve host (repeated 2 times)")
+	assert.Contains(t, logged[0], "attempt=2")
+	assert.NotContains(t, logged[1], "repeated")
+	assert.Contains(t, logged[1], "attempt=3")
+}
+
+func TestDedup_Disabled(t *testing.T) {
+	dedup := NewDedup(&DedupConfig{Burst: 0, Period: time.Minute})
+	for i := 0; i < 10; i++ {
+		record := slog.NewRecord(time.Now(), slog.LevelError, "error", 0)
+		log, pending := dedup.filter("component", nil, &record)
+		assert.True(t, log)
+		assert.Nil(t, pending)
+	}
+}
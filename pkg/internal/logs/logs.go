@@ -0,0 +1,154 @@
+// Package logs provides a slog handler that filters the log messages according to
+// the level of the component that submits them. The component of a logger is
+// defined by the "component" attribute (e.g. slog.With("component", "kube.Database")).
+package logs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+)
+
+// ComponentKey is the attribute that identifies the component of a logger
+const ComponentKey = "component"
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Controls allow modifying the behavior of the logger at runtime
+type Controls struct {
+	Levels *Levels
+	// Dedup is nil if the deduplication of messages is disabled
+	Dedup *Dedup
+}
+
+// Levels stores the minimum level of the log messages, globally and by component.
+// It can be updated at runtime.
+type Levels struct {
+	global      slog.LevelVar
+	byComponent atomic.Pointer[map[string]slog.Level]
+}
+
+// NewLevels parses the global level and the level of each component. See SetComponents
+// for the syntax of the component names.
+func NewLevels(global string, byComponent map[string]string) (*Levels, error) {
+	l := &Levels{}
+	if err := l.SetGlobal(global); err != nil {
+		return nil, err
+	}
+	if err := l.SetComponents(byComponent); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// SetGlobal sets the level of the components that don't have a specific level
+func (l *Levels) SetGlobal(level string) error {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	l.global.Set(lvl)
+	return nil
+}
+
+// SetComponents replaces the levels by component. The level of a component also applies to
+// its subcomponents, unless they have their own level. For example, the "kube" level also
+// applies to the "kube.Database" component.
+func (l *Levels) SetComponents(byComponent map[string]string) error {
+	levels := make(map[string]slog.Level, len(byComponent))
+	for component, level := range byComponent {
+		lvl, err := ParseLevel(level)
+		if err != nil {
+			return fmt.Errorf("component %q: %w", component, err)
+		}
+		levels[component] = lvl
+	}
+	l.byComponent.Store(&levels)
+	return nil
+}
+
+// Level returns the minimum level of the messages of the provided component
+func (l *Levels) Level(component string) slog.Level {
+	if levels := l.byComponent.Load(); levels != nil && len(*levels) > 0 {
+		for c := component; c != ""; {
+			if lvl, ok := (*levels)[c]; ok {
+				return lvl
+			}
+			dot := strings.LastIndexByte(c, '.')
+			if dot < 0 {
+				break
+			}
+			c = c[:dot]
+		}
+	}
+	return l.global.Level()
+}
+
+// ParseLevel accepts the DEBUG, INFO, WARN and ERROR levels, case-insensitively
+func ParseLevel(level string) (slog.Level, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return lvl, fmt.Errorf("unknown log level %q, choices are [DEBUG, INFO, WARN, ERROR]", level)
+	}
+	return lvl, nil
+}
+
+// NewHandler returns a slog handler that writes in the provided text or JSON format, and
+// discards the messages below the level of their component. The discarded messages are
+// not formatted. If not nil, the provided Dedup suppresses the repeated messages.
+func NewHandler(out io.Writer, format string, levels *Levels, dedup *Dedup) (slog.Handler, error) {
+	// the output handler accepts any level, as the messages are already filtered
+	opts := &slog.HandlerOptions{Level: slog.Level(-1 << 20)}
+	var inner slog.Handler
+	switch strings.ToLower(format) {
+	case FormatText, "":
+		inner = slog.NewTextHandler(out, opts)
+	case FormatJSON:
+		inner = slog.NewJSONHandler(out, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q, choices are [%s, %s]", format, FormatText, FormatJSON)
+	}
+	return &handler{inner: inner, levels: levels, dedup: dedup}, nil
+}
+
+type handler struct {
+	inner     slog.Handler
+	levels    *Levels
+	dedup     *Dedup
+	component string
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.levels.Level(h.component)
+}
+
+func (h *handler) Handle(ctx context.Context, record slog.Record) error {
+	log, pending := h.dedup.filter(h.component, h.inner, &record)
+	if pending != nil {
+		pending.write(ctx)
+	}
+	if !log {
+		return nil
+	}
+	return h.inner.Handle(ctx, record)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	component := h.component
+	for _, attr := range attrs {
+		if attr.Key == ComponentKey {
+			component = attr.Value.String()
+		}
+	}
+	return &handler{inner: h.inner.WithAttrs(attrs), levels: h.levels, dedup: h.dedup, component: component}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{inner: h.inner.WithGroup(name), levels: h.levels, dedup: h.dedup, component: h.component}
+}
@@ -0,0 +1,108 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingValue counts how many times it is formatted
+type countingValue struct {
+	formatted *int
+}
+
+func (c countingValue) LogValue() slog.Value {
+	*c.formatted++
+	return slog.StringValue("expensive")
+}
+
+func testLogger(t *testing.T, format string, levels *Levels) (*slog.Logger, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	h, err := NewHandler(out, format, levels, nil)
+	require.NoError(t, err)
+	return slog.New(h), out
+}
+
+func TestComponentLevels(t *testing.T) {
+	levels, err := NewLevels("info", map[string]string{
+		"kube":       "debug",
+		"ebpf.Flows": "error",
+	})
+	require.NoError(t, err)
+	log, out := testLogger(t, FormatText, levels)
+
+	formatted := 0
+	value := countingValue{formatted: &formatted}
+
+	// the level of a component applies to its subcomponents
+	log.With(ComponentKey, "kube.Database").Debug("kube debug", "value", value)
+	// the global level applies to the components without a specific level
+	log.With(ComponentKey, "discover.ProcessWatcher").Debug("discover debug", "value", value)
+	log.With(ComponentKey, "discover.ProcessWatcher").Info("discover info")
+	log.Debug("no component debug", "value", value)
+	// a component can restrict its level over the global level
+	log.With(ComponentKey, "ebpf.Flows").Warn("ebpf warn", "value", value)
+	log.With(ComponentKey, "ebpf.Flows.Ringbuf").Error("ebpf error")
+
+	logged := out.String()
+	assert.Contains(t, logged, "kube debug")
+	assert.Contains(t, logged, "discover info")
+	assert.Contains(t, logged, "ebpf error")
+	assert.NotContains(t, logged, "discover debug")
+	assert.NotContains(t, logged, "no component debug")
+	assert.NotContains(t, logged, "ebpf warn")
+	// the suppressed messages are not formatted
+	assert.Equal(t, 1, formatted)
+
+	// WHEN the levels are updated at runtime
+	require.NoError(t, levels.SetGlobal("warn"))
+	require.NoError(t, levels.SetComponents(map[string]string{"discover": "debug"}))
+	out.Reset()
+	log.With(ComponentKey, "kube.Database").Info("kube info")
+	log.With(ComponentKey, "discover.ProcessWatcher").Debug("discover debug")
+
+	// THEN the existing loggers apply the new levels
+	logged = out.String()
+	assert.NotContains(t, logged, "kube info")
+	assert.Contains(t, logged, "discover debug")
+}
+
+func TestJSONFormat(t *testing.T) {
+	levels, err := NewLevels("INFO", nil)
+	require.NoError(t, err)
+	log, out := testLogger(t, FormatJSON, levels)
+
+	log.With(ComponentKey, "kube.Database").Info("hello", "pods", 3)
+
+	entry := map[string]any{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, "INFO", entry["level"])
+	assert.Equal(t, "hello", entry["msg"])
+	assert.Equal(t, "kube.Database", entry["component"])
+	assert.EqualValues(t, 3, entry["pods"])
+	assert.Contains(t, entry, "time")
+}
+
+func TestInvalidOptions(t *testing.T) {
+	_, err := NewLevels("verbose", nil)
+	require.Error(t, err)
+	_, err = NewLevels("INFO", map[string]string{"kube": "verbose"})
+	require.Error(t, err)
+	_, err = NewHandler(&bytes.Buffer{}, "xml", &Levels{}, nil)
+	require.Error(t, err)
+}
+
+func BenchmarkSuppressedComponent(b *testing.B) {
+	levels, _ := NewLevels("INFO", map[string]string{"kube": "DEBUG"})
+	h, _ := NewHandler(&strings.Builder{}, FormatJSON, levels, nil)
+	log := slog.New(h).With(ComponentKey, "ebpf.ProcessTracer")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		log.Debug("suppressed", "iteration", i)
+	}
+}
@@ -0,0 +1,158 @@
+// Package memlimit sets the memory limit of the Go runtime according to the memory limit of the
+// container, and notifies the components when the memory usage approaches the limit, so they can
+// reduce their memory usage.
+package memlimit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func mlog() *slog.Logger {
+	return slog.With("component", "memlimit")
+}
+
+// cgroupV1Unlimited is the minimum value of memory.limit_in_bytes that cgroups v1 reports when
+// the memory is not limited (the maximum int64 value, rounded down to the page size)
+const cgroupV1Unlimited = int64(1) << 62
+
+// in cgroups v2, the "max" value means no limit
+const cgroupV2Unlimited = math.MaxInt64
+
+type Config struct {
+	// LimitRatio is the fraction of the container memory limit that is set as the memory limit
+	// of the Go runtime (GOMEMLIMIT). 0 disables it. It is ignored if the GOMEMLIMIT environment
+	// variable is set.
+	LimitRatio float64 `yaml:"limit_ratio" env:"BEYLA_MEMORY_LIMIT_RATIO"`
+	// PressureRatio is the fraction of the Go runtime memory limit above which the components
+	// are requested to reduce their memory usage.
+	PressureRatio float64 `yaml:"pressure_ratio" env:"BEYLA_MEMORY_PRESSURE_RATIO"`
+	// CheckPeriod is the period between the checks of the memory usage.
+	CheckPeriod time.Duration `yaml:"check_period" env:"BEYLA_MEMORY_CHECK_PERIOD"`
+}
+
+func (c *Config) Validate() error {
+	if c.LimitRatio < 0 || c.LimitRatio > 1 {
+		return fmt.Errorf("limit_ratio must be between 0 and 1. Got: %v", c.LimitRatio)
+	}
+	if c.PressureRatio <= 0 || c.PressureRatio > 1 {
+		return fmt.Errorf("pressure_ratio must be greater than 0 and lower or equal to 1. Got: %v", c.PressureRatio)
+	}
+	if c.CheckPeriod <= 0 {
+		return fmt.Errorf("check_period must be greater than 0. Got: %v", c.CheckPeriod)
+	}
+	return nil
+}
+
+// SetLimit sets the memory limit of the Go runtime to the configured fraction of the container
+// memory limit, unless it is manually set by the GOMEMLIMIT environment variable. It returns the
+// resulting memory limit of the Go runtime, or 0 if the memory is not limited.
+func SetLimit(cfg *Config) int64 {
+	log := mlog()
+	if manual := os.Getenv("GOMEMLIMIT"); manual != "" {
+		log.Info("memory limit manually set by the GOMEMLIMIT environment variable", "GOMEMLIMIT", manual)
+		return currentLimit()
+	}
+	if cfg.LimitRatio <= 0 {
+		return currentLimit()
+	}
+	limit, ok, err := containerLimit("/proc/self/cgroup", "/sys/fs/cgroup")
+	if err != nil {
+		log.Warn("can't read the container memory limit. Not setting the Go memory limit", "error", err)
+		return currentLimit()
+	}
+	if !ok {
+		log.Debug("the container memory is not limited. Not setting the Go memory limit")
+		return currentLimit()
+	}
+	goLimit := int64(float64(limit) * cfg.LimitRatio)
+	debug.SetMemoryLimit(goLimit)
+	log.Info("setting the Go memory limit", "containerLimit", limit, "ratio", cfg.LimitRatio, "goLimit", goLimit)
+	return goLimit
+}
+
+// currentLimit returns the memory limit of the Go runtime, or 0 if it is not limited
+func currentLimit() int64 {
+	// a negative value just returns the current limit
+	limit := debug.SetMemoryLimit(-1)
+	if limit == math.MaxInt64 {
+		return 0
+	}
+	return limit
+}
+
+// containerLimit returns the memory limit of the cgroup of the current process, given the path of
+// the /proc/self/cgroup file and the mount point of the cgroups filesystem. The returned boolean
+// is false if the memory is not limited.
+func containerLimit(procCgroup, cgroupRoot string) (int64, bool, error) {
+	content, err := os.ReadFile(procCgroup)
+	if err != nil {
+		return 0, false, fmt.Errorf("reading process cgroup: %w", err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		// format: hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		switch {
+		case parts[0] == "0" && parts[1] == "":
+			// cgroups v2 unified hierarchy. Inside a container with its own cgroup namespace,
+			// the path is usually "/", so we also check the root of the hierarchy
+			return readLimit(cgroupV2Unlimited,
+				filepath.Join(cgroupRoot, parts[2], "memory.max"),
+				filepath.Join(cgroupRoot, "memory.max"))
+		case hasController(parts[1], "memory"):
+			// cgroups v1
+			return readLimit(cgroupV1Unlimited,
+				filepath.Join(cgroupRoot, "memory", parts[2], "memory.limit_in_bytes"),
+				filepath.Join(cgroupRoot, "memory", "memory.limit_in_bytes"))
+		}
+	}
+	return 0, false, nil
+}
+
+func hasController(controllers, name string) bool {
+	for _, c := range strings.Split(controllers, ",") {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// readLimit reads the limit from the first existing file
+func readLimit(unlimited int64, files ...string) (int64, bool, error) {
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return 0, false, fmt.Errorf("reading memory limit: %w", err)
+		}
+		value := strings.TrimSpace(string(content))
+		if value == "max" {
+			return 0, false, nil
+		}
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("parsing memory limit from %s: %w", file, err)
+		}
+		if limit >= unlimited {
+			return 0, false, nil
+		}
+		return limit, true, nil
+	}
+	return 0, false, nil
+}
@@ -0,0 +1,136 @@
+package memlimit
+
+import (
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func TestContainerLimit(t *testing.T) {
+	type testCase struct {
+		name       string
+		procCgroup string
+		files      map[string]string
+		limit      int64
+		limited    bool
+	}
+	for _, tc := range []testCase{{
+		name:       "cgroups v2 with namespace",
+		procCgroup: "0::/\n",
+		files:      map[string]string{"memory.max": "1073741824\n"},
+		limit:      1073741824, limited: true,
+	}, {
+		name:       "cgroups v2 nested path",
+		procCgroup: "0::/kubepods/pod1/container\n",
+		files:      map[string]string{"kubepods/pod1/container/memory.max": "536870912\n"},
+		limit:      536870912, limited: true,
+	}, {
+		name:       "cgroups v2 unlimited",
+		procCgroup: "0::/\n",
+		files:      map[string]string{"memory.max": "max\n"},
+	}, {
+		name:       "cgroups v1",
+		procCgroup: "12:cpu,cpuacct:/docker/abc\n4:memory:/docker/abc\n",
+		files:      map[string]string{"memory/docker/abc/memory.limit_in_bytes": "268435456\n"},
+		limit:      268435456, limited: true,
+	}, {
+		name:       "cgroups v1 with namespace",
+		procCgroup: "4:memory:/docker/abc\n",
+		files:      map[string]string{"memory/memory.limit_in_bytes": "268435456\n"},
+		limit:      268435456, limited: true,
+	}, {
+		name:       "cgroups v1 unlimited",
+		procCgroup: "4:memory:/\n",
+		files:      map[string]string{"memory/memory.limit_in_bytes": "9223372036854771712\n"},
+	}, {
+		name:       "no memory controller",
+		procCgroup: "12:cpu,cpuacct:/\n",
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, filepath.Join(dir, "proc_cgroup"), tc.procCgroup)
+			for path, content := range tc.files {
+				writeFile(t, filepath.Join(dir, "cgroup", path), content)
+			}
+			limit, limited, err := containerLimit(filepath.Join(dir, "proc_cgroup"), filepath.Join(dir, "cgroup"))
+			require.NoError(t, err)
+			assert.Equal(t, tc.limited, limited)
+			assert.Equal(t, tc.limit, limit)
+		})
+	}
+}
+
+func TestSetLimit_ManualOverride(t *testing.T) {
+	previous := debug.SetMemoryLimit(512 << 20)
+	defer debug.SetMemoryLimit(previous)
+	t.Setenv("GOMEMLIMIT", "512MiB")
+
+	// the manual limit is kept
+	assert.EqualValues(t, 512<<20, SetLimit(&Config{LimitRatio: 0.5}))
+	assert.EqualValues(t, 512<<20, debug.SetMemoryLimit(-1))
+}
+
+type pressureMetrics struct {
+	imetrics.NoopReporter
+	mt      sync.Mutex
+	actions map[string]int
+}
+
+func (m *pressureMetrics) MemoryPressureAction(action string) {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	m.actions[action]++
+}
+
+func TestMonitor(t *testing.T) {
+	pressure := NewPressure()
+	metrics := &pressureMetrics{actions: map[string]int{}}
+	monitor := NewMonitor(&Config{PressureRatio: 0.8, CheckPeriod: time.Second}, 1000, pressure, metrics)
+	usage := uint64(500)
+	monitor.usage = func() uint64 { return usage }
+
+	cleared := 0
+	pressure.OnHigh("cache_clear", func() { cleared++ })
+
+	// WHEN the memory usage is below the pressure threshold
+	monitor.check()
+	// THEN no action is performed
+	assert.False(t, pressure.High())
+	assert.Zero(t, cleared)
+
+	// WHEN the memory usage exceeds the pressure threshold
+	usage = 850
+	monitor.check()
+	monitor.check()
+	// THEN the actions are performed on each check, and counted
+	assert.True(t, pressure.High())
+	assert.Equal(t, 2, cleared)
+	assert.Equal(t, map[string]int{"cache_clear": 2}, metrics.actions)
+
+	// WHEN the memory usage goes below the threshold again
+	usage = 700
+	monitor.check()
+	// THEN the pressure is relieved
+	assert.False(t, pressure.High())
+	assert.Equal(t, 2, cleared)
+}
+
+func TestPressure_Nil(t *testing.T) {
+	var pressure *Pressure
+	pressure.OnHigh("cache_clear", func() {})
+	assert.False(t, pressure.High())
+}
@@ -0,0 +1,125 @@
+package memlimit
+
+import (
+	"context"
+	rtmetrics "runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+)
+
+// Pressure is a registry of the actions that the components perform to reduce their memory usage
+// when it approaches the memory limit. The components can also check whether the memory
+// pressure is high, e.g. to drop data more aggressively.
+// A nil Pressure is valid: it ignores any registered action and never reports high pressure.
+type Pressure struct {
+	mt      sync.Mutex
+	actions []action
+	high    atomic.Bool
+}
+
+type action struct {
+	name     string
+	mitigate func()
+}
+
+func NewPressure() *Pressure {
+	return &Pressure{}
+}
+
+// OnHigh registers a function that is invoked, from another goroutine, on each check of the memory
+// usage while the memory pressure is high. The invocations are counted by the provided action name
+// in the beyla_memory_pressure_actions_total internal metric.
+func (p *Pressure) OnHigh(name string, mitigate func()) {
+	if p == nil {
+		return
+	}
+	p.mt.Lock()
+	defer p.mt.Unlock()
+	p.actions = append(p.actions, action{name: name, mitigate: mitigate})
+}
+
+// High returns whether the memory usage is approaching the memory limit
+func (p *Pressure) High() bool {
+	return p != nil && p.high.Load()
+}
+
+func (p *Pressure) mitigate(metrics imetrics.Reporter) {
+	p.mt.Lock()
+	actions := p.actions
+	p.mt.Unlock()
+	for _, a := range actions {
+		a.mitigate()
+		metrics.MemoryPressureAction(a.name)
+	}
+}
+
+// Monitor periodically checks the memory usage of the Go runtime against its memory limit, and
+// updates the provided Pressure accordingly.
+type Monitor struct {
+	cfg       *Config
+	threshold uint64
+	pressure  *Pressure
+	metrics   imetrics.Reporter
+	// usage can be overridden for testing
+	usage func() uint64
+}
+
+// NewMonitor returns a Monitor that reports high pressure when the memory usage exceeds the
+// configured fraction of the provided memory limit.
+func NewMonitor(cfg *Config, limit int64, pressure *Pressure, metrics imetrics.Reporter) *Monitor {
+	return &Monitor{
+		cfg:       cfg,
+		threshold: uint64(float64(limit) * cfg.PressureRatio),
+		pressure:  pressure,
+		metrics:   metrics,
+		usage:     goMemoryUsage,
+	}
+}
+
+// Start checking the memory usage in background, until the context is canceled
+func (m *Monitor) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(m.cfg.CheckPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.check()
+			}
+		}
+	}()
+}
+
+func (m *Monitor) check() {
+	usage := m.usage()
+	if usage < m.threshold {
+		if m.pressure.high.Swap(false) {
+			mlog().Info("memory pressure relieved", "usage", usage, "threshold", m.threshold)
+		}
+		return
+	}
+	if !m.pressure.high.Swap(true) {
+		mlog().Warn("high memory pressure. Reducing the memory usage",
+			"usage", usage, "threshold", m.threshold)
+	}
+	m.pressure.mitigate(m.metrics)
+}
+
+var usageMetrics = []rtmetrics.Sample{
+	{Name: "/memory/classes/total:bytes"},
+	{Name: "/memory/classes/heap/released:bytes"},
+}
+
+// goMemoryUsage returns the memory that the Go runtime accounts against its memory limit: the
+// mapped memory minus the heap memory that has been returned to the OS
+func goMemoryUsage() uint64 {
+	samples := make([]rtmetrics.Sample, len(usageMetrics))
+	copy(samples, usageMetrics)
+	rtmetrics.Read(samples)
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64()
+}
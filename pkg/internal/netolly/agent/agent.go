@@ -20,6 +20,7 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -28,10 +29,13 @@ import (
 	"github.com/cilium/ebpf/ringbuf"
 
 	"github.com/grafana/beyla/pkg/beyla"
+	"github.com/grafana/beyla/pkg/internal/ebpf/attachment"
+	"github.com/grafana/beyla/pkg/internal/health"
 	"github.com/grafana/beyla/pkg/internal/netolly/ebpf"
 	"github.com/grafana/beyla/pkg/internal/netolly/flow"
 	"github.com/grafana/beyla/pkg/internal/netolly/ifaces"
 	"github.com/grafana/beyla/pkg/internal/pipe/global"
+	"github.com/grafana/beyla/pkg/internal/report"
 )
 
 const (
@@ -101,6 +105,13 @@ type Flows struct {
 	interfaceNamer flow.InterfaceNamer
 	agentIP        net.IP
 
+	// attachedIfaces reports readiness as long as the eBPF programs are attached to any interface
+	attachedIfaces *health.Counter
+	// names of the interfaces with attached eBPF programs
+	attached map[string]struct{}
+	// functions that stop watching the attachment of the eBPF programs to each interface
+	unwatch map[string]func()
+
 	status Status
 }
 
@@ -108,6 +119,9 @@ type Flows struct {
 type ebpfFlowFetcher interface {
 	io.Closer
 	Register(iface ifaces.Interface) error
+	// Attachment of the eBPF programs to the provided interface, or nil if they can't be detached
+	// by external tools
+	Attachment(iface ifaces.Interface) attachment.Attachment
 
 	LookupAndDeleteMap() map[ebpf.NetFlowId][]ebpf.NetFlowMetrics
 	ReadRingBuf() (ringbuf.Record, error)
@@ -148,13 +162,16 @@ func FlowsAgent(ctxInfo *global.ContextInfo, cfg *beyla.Config) (*Flows, error)
 		alog.Info("using socket filter for collecting network events")
 		fetcher, err = ebpf.NewSockFlowFetcher(cfg.NetworkFlows.Sampling, cfg.NetworkFlows.CacheMaxFlows)
 		if err != nil {
+			ctxInfo.Diagnostics.Report(alog, err)
 			return nil, err
 		}
 	case beyla.EbpfSourceTC:
 		alog.Info("using kernel Traffic Control for collecting network events")
 		ingress, egress := flowDirections(&cfg.NetworkFlows)
-		fetcher, err = ebpf.NewFlowFetcher(cfg.NetworkFlows.Sampling, cfg.NetworkFlows.CacheMaxFlows, ingress, egress)
+		fetcher, err = ebpf.NewFlowFetcher(cfg.NetworkFlows.Sampling, cfg.NetworkFlows.CacheMaxFlows,
+			ingress, egress, cfg.NetworkFlows.ReportTunnelOuterFlows)
 		if err != nil {
+			ctxInfo.Diagnostics.Report(alog, err)
 			return nil, err
 		}
 	default:
@@ -188,8 +205,12 @@ func flowsAgent(
 		return iface
 	}
 
-	mapTracer := flow.NewMapTracer(fetcher, cfg.NetworkFlows.CacheActiveTimeout)
-	rbTracer := flow.NewRingBufTracer(fetcher, mapTracer, cfg.NetworkFlows.CacheActiveTimeout)
+	mapTracer := flow.NewMapTracer(fetcher, cfg.NetworkFlows.CacheActiveTimeout,
+		ctxInfo.Health.Watchdog("neto11y.pipeline"), ctxInfo.Metrics)
+	attachedIfaces := health.NewCounter(errors.New("no network interfaces attached"))
+	ctxInfo.Health.Readiness("neto11y.ebpf", attachedIfaces.Check)
+	rbTracer := flow.NewRingBufTracer(fetcher, mapTracer, cfg.NetworkFlows.CacheActiveTimeout,
+		ctxInfo.Metrics, ctxInfo.MemoryPressure)
 	return &Flows{
 		ctxInfo:        ctxInfo,
 		ebpf:           fetcher,
@@ -200,6 +221,9 @@ func flowsAgent(
 		rbTracer:       rbTracer,
 		agentIP:        agentIP,
 		interfaceNamer: interfaceNamer,
+		attachedIfaces: attachedIfaces,
+		attached:       map[string]struct{}{},
+		unwatch:        map[string]func(){},
 	}, nil
 }
 
@@ -237,6 +261,8 @@ func (f *Flows) Run(ctx context.Context) error {
 
 	f.status = StatusStopping
 	alog.Info("stopping Flows agent")
+	// the eBPF map must be accessible until the map tracer evicts its last flows
+	<-f.mapTracer.Stopped()
 	if err := f.ebpf.Close(); err != nil {
 		alog.Warn("eBPF resources not correctly closed", "error", err)
 	}
@@ -279,6 +305,7 @@ func (f *Flows) interfacesManager(ctx context.Context) error {
 				case ifaces.EventDeleted:
 					// qdiscs, ingress and egress filters are automatically deleted so we don't need to
 					// specifically detach them from the ebpfFetcher
+					f.onInterfaceDeleted(event.Interface)
 				default:
 					slog.Warn("unknown event type", "event", event)
 				}
@@ -299,6 +326,28 @@ func (f *Flows) onInterfaceAdded(iface ifaces.Interface) {
 	alog.Info("interface detected. Registering flow ebpfFetcher")
 	if err := f.ebpf.Register(iface); err != nil {
 		alog.Warn("can't register flow ebpfFetcher. Ignoring", "error", err)
+		f.ctxInfo.Diagnostics.Report(alog, err)
 		return
 	}
+	if _, ok := f.attached[iface.Name]; !ok {
+		f.attached[iface.Name] = struct{}{}
+		f.attachedIfaces.Inc()
+	}
+	if att := f.ebpf.Attachment(iface); att != nil {
+		if unwatch, ok := f.unwatch[iface.Name]; ok {
+			unwatch()
+		}
+		f.unwatch[iface.Name] = f.ctxInfo.Attachments.Watch(report.ProbeTC, iface.Name, att)
+	}
+}
+
+func (f *Flows) onInterfaceDeleted(iface ifaces.Interface) {
+	if unwatch, ok := f.unwatch[iface.Name]; ok {
+		unwatch()
+		delete(f.unwatch, iface.Name)
+	}
+	if _, ok := f.attached[iface.Name]; ok {
+		delete(f.attached, iface.Name)
+		f.attachedIfaces.Dec()
+	}
 }
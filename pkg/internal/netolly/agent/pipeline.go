@@ -5,7 +5,9 @@ import (
 
 	"github.com/mariomac/pipes/pipe"
 
+	"github.com/grafana/beyla/pkg/beyla"
 	"github.com/grafana/beyla/pkg/internal/filter"
+	"github.com/grafana/beyla/pkg/internal/imetrics"
 	"github.com/grafana/beyla/pkg/internal/netolly/ebpf"
 	"github.com/grafana/beyla/pkg/internal/netolly/export"
 	"github.com/grafana/beyla/pkg/internal/netolly/export/otel"
@@ -13,6 +15,9 @@ import (
 	"github.com/grafana/beyla/pkg/internal/netolly/flow"
 	"github.com/grafana/beyla/pkg/internal/netolly/transform/cidr"
 	"github.com/grafana/beyla/pkg/internal/netolly/transform/k8s"
+	"github.com/grafana/beyla/pkg/internal/netolly/transform/process"
+	"github.com/grafana/beyla/pkg/internal/pipe/queue"
+	"github.com/grafana/beyla/pkg/internal/reload"
 )
 
 // FlowsPipeline defines the different nodes in the Beyla's NetO11y module,
@@ -23,6 +28,8 @@ type FlowsPipeline struct {
 
 	ProtoFilter     pipe.Middle[[]*ebpf.Record, []*ebpf.Record]
 	Deduper         pipe.Middle[[]*ebpf.Record, []*ebpf.Record]
+	ICMPEchoRTT     pipe.Middle[[]*ebpf.Record, []*ebpf.Record]
+	Process         pipe.Middle[[]*ebpf.Record, []*ebpf.Record]
 	Kubernetes      pipe.Middle[[]*ebpf.Record, []*ebpf.Record]
 	ReverseDNS      pipe.Middle[[]*ebpf.Record, []*ebpf.Record]
 	CIDRs           pipe.Middle[[]*ebpf.Record, []*ebpf.Record]
@@ -40,7 +47,11 @@ func (fp *FlowsPipeline) Connect() {
 	fp.RingBufTracer.SendTo(fp.ProtoFilter)
 
 	fp.ProtoFilter.SendTo(fp.Deduper)
-	fp.Deduper.SendTo(fp.Kubernetes)
+	fp.Deduper.SendTo(fp.ICMPEchoRTT)
+	// process decoration goes before Kubernetes, as the latter uses the PIDs of the
+	// local sockets to attribute the flows from Pods in the host network
+	fp.ICMPEchoRTT.SendTo(fp.Process)
+	fp.Process.SendTo(fp.Kubernetes)
 	fp.Kubernetes.SendTo(fp.ReverseDNS)
 	fp.ReverseDNS.SendTo(fp.CIDRs)
 	fp.CIDRs.SendTo(fp.Decorator)
@@ -55,8 +66,10 @@ func ringBufTracer(fp *FlowsPipeline) *pipe.Start[[]*ebpf.Record] { return &fp.R
 
 func prtFltr(fp *FlowsPipeline) *pipe.Middle[[]*ebpf.Record, []*ebpf.Record]   { return &fp.ProtoFilter }
 func deduper(fp *FlowsPipeline) *pipe.Middle[[]*ebpf.Record, []*ebpf.Record]   { return &fp.Deduper }
+func icmpRTT(fp *FlowsPipeline) *pipe.Middle[[]*ebpf.Record, []*ebpf.Record]   { return &fp.ICMPEchoRTT }
 func kube(fp *FlowsPipeline) *pipe.Middle[[]*ebpf.Record, []*ebpf.Record]      { return &fp.Kubernetes }
 func rdns(fp *FlowsPipeline) *pipe.Middle[[]*ebpf.Record, []*ebpf.Record]      { return &fp.ReverseDNS }
+func procs(fp *FlowsPipeline) *pipe.Middle[[]*ebpf.Record, []*ebpf.Record]     { return &fp.Process }
 func cidrs(fp *FlowsPipeline) *pipe.Middle[[]*ebpf.Record, []*ebpf.Record]     { return &fp.CIDRs }
 func decorator(fp *FlowsPipeline) *pipe.Middle[[]*ebpf.Record, []*ebpf.Record] { return &fp.Decorator }
 func fltr(fp *FlowsPipeline) *pipe.Middle[[]*ebpf.Record, []*ebpf.Record]      { return &fp.AttributeFilter }
@@ -87,16 +100,20 @@ func (f *Flows) pipelineBuilder(ctx context.Context) (*pipe.Builder[*FlowsPipeli
 	pb := pipe.NewBuilder(&FlowsPipeline{}, pipe.ChannelBufferLen(f.cfg.ChannelBufferLen))
 
 	// Start nodes: those generating flow records (reading them from eBPF)
-	pipe.AddStart(pb, mapTracer, f.mapTracer.TraceLoop(ctx))
-	pipe.AddStart(pb, ringBufTracer, f.rbTracer.TraceLoop(ctx))
+	pipe.AddStart(pb, mapTracer, imetrics.InstrumentStart(f.ctxInfo.Metrics, "neto11y.map_tracer",
+		f.mapTracer.TraceLoop(ctx)))
+	pipe.AddStart(pb, ringBufTracer, imetrics.InstrumentStart(f.ctxInfo.Metrics, "neto11y.ringbuf_tracer",
+		f.rbTracer.TraceLoop(ctx)))
 
 	// Middle nodes: transforming flow records and passing them to the next stage in the pipeline.
 	// Many of the nodes here are not mandatory. It's decision of each Provider function to decide
 	// whether the node needs to be instantiated or just bypassed.
-	pipe.AddMiddleProvider(pb, prtFltr,
-		flow.ProtocolFilterProvider(f.cfg.NetworkFlows.Protocols, f.cfg.NetworkFlows.ExcludeProtocols))
+	// The internal metrics report the queue depth, throughput and processing latency of each instantiated node.
+	stages := queue.NewStages(f.cfg.PipelineQueues, f.cfg.ChannelBufferLen, f.ctxInfo.Metrics)
+	pipe.AddMiddleProvider(pb, prtFltr, queue.Middle(stages, "neto11y.protocol_filter",
+		flow.ProtocolFilterProvider(f.cfg.NetworkFlows.Protocols, f.cfg.NetworkFlows.ExcludeProtocols)))
 
-	pipe.AddMiddleProvider(pb, deduper, func() (pipe.MiddleFunc[[]*ebpf.Record, []*ebpf.Record], error) {
+	pipe.AddMiddleProvider(pb, deduper, queue.Middle(stages, "neto11y.deduper", func() (pipe.MiddleFunc[[]*ebpf.Record, []*ebpf.Record], error) {
 		var deduperExpireTime = f.cfg.NetworkFlows.DeduperFCTTL
 		if deduperExpireTime <= 0 {
 			deduperExpireTime = 2 * f.cfg.NetworkFlows.CacheActiveTimeout
@@ -104,9 +121,13 @@ func (f *Flows) pipelineBuilder(ctx context.Context) (*pipe.Builder[*FlowsPipeli
 		return flow.DeduperProvider(&flow.Deduper{
 			Type:       f.cfg.NetworkFlows.Deduper,
 			ExpireTime: deduperExpireTime,
+			Pressure:   f.ctxInfo.MemoryPressure,
 		})
-	})
-	pipe.AddMiddleProvider(pb, decorator, func() (pipe.MiddleFunc[[]*ebpf.Record, []*ebpf.Record], error) {
+	}))
+	pipe.AddMiddleProvider(pb, icmpRTT, queue.Middle(stages, "neto11y.icmp_echo_rtt", func() (pipe.MiddleFunc[[]*ebpf.Record, []*ebpf.Record], error) {
+		return flow.ICMPEchoRTTProvider(&f.cfg.NetworkFlows.ICMPEchoRTT)
+	}))
+	pipe.AddMiddleProvider(pb, decorator, queue.Middle(stages, "neto11y.decorator", func() (pipe.MiddleFunc[[]*ebpf.Record, []*ebpf.Record], error) {
 		// If deduper is enabled, we know that interfaces are unset.
 		// As an optimization, we just pass here an empty-string interface namer
 		ifaceNamer := f.interfaceNamer
@@ -116,37 +137,48 @@ func (f *Flows) pipelineBuilder(ctx context.Context) (*pipe.Builder[*FlowsPipeli
 			}
 		}
 		return flow.Decorate(f.agentIP, ifaceNamer), nil
-	})
-	pipe.AddMiddleProvider(pb, cidrs, func() (pipe.MiddleFunc[[]*ebpf.Record, []*ebpf.Record], error) {
+	}))
+	pipe.AddMiddleProvider(pb, cidrs, queue.Middle(stages, "neto11y.cidrs", func() (pipe.MiddleFunc[[]*ebpf.Record, []*ebpf.Record], error) {
 		return cidr.DecoratorProvider(f.cfg.NetworkFlows.CIDRs)
-	})
-	pipe.AddMiddleProvider(pb, kube, func() (pipe.MiddleFunc[[]*ebpf.Record, []*ebpf.Record], error) {
-		return k8s.MetadataDecoratorProvider(ctx, &f.cfg.Attributes.Kubernetes)
-	})
-	pipe.AddMiddleProvider(pb, rdns, func() (pipe.MiddleFunc[[]*ebpf.Record, []*ebpf.Record], error) {
+	}))
+	pipe.AddMiddleProvider(pb, kube, queue.Middle(stages, "neto11y.kubernetes", func() (pipe.MiddleFunc[[]*ebpf.Record, []*ebpf.Record], error) {
+		return k8s.MetadataDecoratorProvider(ctx, f.ctxInfo, &f.cfg.Attributes.Kubernetes)
+	}))
+	pipe.AddMiddleProvider(pb, rdns, queue.Middle(stages, "neto11y.reverse_dns", func() (pipe.MiddleFunc[[]*ebpf.Record, []*ebpf.Record], error) {
 		return flow.ReverseDNSProvider(&f.cfg.NetworkFlows.ReverseDNS)
-	})
-	pipe.AddMiddleProvider(pb, fltr, filter.ByAttribute(f.cfg.Filters.Network, ebpf.RecordGetters))
+	}))
+	pipe.AddMiddleProvider(pb, procs, queue.Middle(stages, "neto11y.process", func() (pipe.MiddleFunc[[]*ebpf.Record, []*ebpf.Record], error) {
+		return process.DecoratorProvider(ctx, &process.Decorator{
+			Attribution:     &f.cfg.NetworkFlows.ProcessAttribution,
+			HostNetworkPods: f.cfg.Attributes.Kubernetes.Enabled(),
+			SocketDirection: f.cfg.NetworkFlows.Source == beyla.EbpfSourceSock,
+		})
+	}))
+	attrs := filter.NewByAttribute(f.cfg.Filters.Network, ebpf.RecordGetters)
+	reload.OnChange(f.ctxInfo.Reload, "filter.network", attrs.Update)
+	pipe.AddMiddleProvider(pb, fltr, queue.Middle(stages, "neto11y.attribute_filter", attrs.Provide))
 
 	// Terminal nodes export the flow record information out of the pipeline: OTEL, Prom and printer.
 	// Not all the nodes are mandatory here. Is the responsibility of each Provider function to decide
 	// whether each node is going to be instantiated or just ignored.
 	f.cfg.Attributes.Select.Normalize()
-	pipe.AddFinalProvider(pb, otelExport, func() (pipe.FinalFunc[[]*ebpf.Record], error) {
+	pipe.AddFinalProvider(pb, otelExport, queue.Final(stages, "neto11y.otel_metrics", func() (pipe.FinalFunc[[]*ebpf.Record], error) {
 		return otel.MetricsExporterProvider(f.ctxInfo, &otel.MetricsConfig{
 			Metrics:            &f.cfg.Metrics,
 			AttributeSelectors: f.cfg.Attributes.Select,
+			FlowHistograms:     f.cfg.NetworkFlows.FlowHistograms,
 		})
-	})
-	pipe.AddFinalProvider(pb, promExport, func() (pipe.FinalFunc[[]*ebpf.Record], error) {
+	}))
+	pipe.AddFinalProvider(pb, promExport, queue.Final(stages, "neto11y.prometheus", func() (pipe.FinalFunc[[]*ebpf.Record], error) {
 		return prom.PrometheusEndpoint(ctx, f.ctxInfo, &prom.PrometheusConfig{
 			Config:             &f.cfg.Prometheus,
 			AttributeSelectors: f.cfg.Attributes.Select,
+			FlowHistograms:     f.cfg.NetworkFlows.FlowHistograms,
 		})
-	})
-	pipe.AddFinalProvider(pb, printer, func() (pipe.FinalFunc[[]*ebpf.Record], error) {
+	}))
+	pipe.AddFinalProvider(pb, printer, queue.Final(stages, "neto11y.printer", func() (pipe.FinalFunc[[]*ebpf.Record], error) {
 		return export.FlowPrinterProvider(f.cfg.NetworkFlows.Print)
-	})
+	}))
 
 	return pb, nil
 }
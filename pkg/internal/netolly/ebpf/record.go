@@ -22,8 +22,10 @@ import (
 	"encoding/binary"
 	"io"
 	"net"
+	"time"
 
 	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
+	"github.com/grafana/beyla/pkg/internal/netolly/flow/transport"
 )
 
 // IPAddr encodes v4 and v6 IPs with a fixed length.
@@ -55,6 +57,15 @@ type RecordAttrs struct {
 	// BeylaIP provides information about the source of the flow (the Agent that traced it)
 	BeylaIP  string
 	Metadata map[attr.Name]string
+
+	// SrcPID and DstPID are the local processes owning the source and destination
+	// sockets of the flow, if they are known
+	SrcPID uint32
+	DstPID uint32
+
+	// ICMPEchoRTT is only set for ICMP Echo Reply flows whose Echo Request flow
+	// has been previously seen in the opposite direction.
+	ICMPEchoRTT time.Duration
 }
 
 func NewRecord(
@@ -82,6 +93,14 @@ func (fm *NetFlowMetrics) Accumulate(src *NetFlowMetrics) {
 	fm.Flags |= src.Flags
 }
 
+// Duration of the flow, from its first to its last observed packet
+func (fm *NetFlowMetrics) Duration() time.Duration {
+	if fm.EndMonoTimeNs < fm.StartMonoTimeNs {
+		return 0
+	}
+	return time.Duration(fm.EndMonoTimeNs - fm.StartMonoTimeNs)
+}
+
 // SrcIP is never null. Returned as pointer for efficiency.
 func (fi *NetFlowId) SrcIP() *IPAddr {
 	return (*IPAddr)(&fi.SrcIp.In6U.U6Addr8)
@@ -92,6 +111,13 @@ func (fi *NetFlowId) DstIP() *IPAddr {
 	return (*IPAddr)(&fi.DstIp.In6U.U6Addr8)
 }
 
+// IsICMP returns whether the flow transports ICMP or ICMPv6 messages. For such flows,
+// the SrcPort and DstPort fields respectively store the ICMP type and code.
+func (fi *NetFlowId) IsICMP() bool {
+	return fi.TransportProtocol == uint8(transport.ICMP) ||
+		fi.TransportProtocol == uint8(transport.ICMPV6)
+}
+
 // IP returns the net.IP equivalent object
 func (ia *IPAddr) IP() net.IP {
 	return ia[:]
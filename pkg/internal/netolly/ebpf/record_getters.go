@@ -22,9 +22,13 @@ func RecordGetters(name attr.Name) (metric.Getter[*Record, string], bool) {
 	case attr.DstAddres:
 		getter = func(r *Record) string { return r.Id.DstIP().IP().String() }
 	case attr.SrcPort:
-		getter = func(r *Record) string { return strconv.FormatUint(uint64(r.Id.SrcPort), 10) }
+		getter = func(r *Record) string { return portStr(&r.Id, r.Id.SrcPort) }
 	case attr.DstPort:
-		getter = func(r *Record) string { return strconv.FormatUint(uint64(r.Id.DstPort), 10) }
+		getter = func(r *Record) string { return portStr(&r.Id, r.Id.DstPort) }
+	case attr.ICMPType:
+		getter = func(r *Record) string { return icmpStr(&r.Id, r.Id.SrcPort) }
+	case attr.ICMPCode:
+		getter = func(r *Record) string { return icmpStr(&r.Id, r.Id.DstPort) }
 	case attr.SrcName:
 		getter = func(r *Record) string { return r.Attrs.SrcName }
 	case attr.DstName:
@@ -39,6 +43,22 @@ func RecordGetters(name attr.Name) (metric.Getter[*Record, string], bool) {
 	return getter, getter != nil
 }
 
+// ICMP flows use the port fields to store the ICMP type and code,
+// so they aren't reported as ports
+func portStr(id *NetFlowId, port uint16) string {
+	if id.IsICMP() {
+		return ""
+	}
+	return strconv.FormatUint(uint64(port), 10)
+}
+
+func icmpStr(id *NetFlowId, typeOrCode uint16) string {
+	if !id.IsICMP() {
+		return ""
+	}
+	return strconv.FormatUint(uint64(typeOrCode), 10)
+}
+
 func directionStr(direction uint8) string {
 	switch direction {
 	case DirectionIngress:
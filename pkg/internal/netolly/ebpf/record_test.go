@@ -0,0 +1,34 @@
+package ebpf
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The records are read byte by byte from the eBPF maps and ring buffers, so the
+// Go structs must match the size of the C structs that are compiled into the objects
+func TestRecordLayout(t *testing.T) {
+	for name, load := range map[string]func() (*ebpf.CollectionSpec, error){
+		"Net":   LoadNet,
+		"NetSk": LoadNetSk,
+	} {
+		t.Run(name, func(t *testing.T) {
+			spec, err := load()
+			require.NoError(t, err)
+			for cType, goType := range map[string]any{
+				"flow_id_t":      NetFlowId{},
+				"flow_metrics_t": NetFlowMetrics{},
+				"flow_record_t":  NetFlowRecordT{},
+			} {
+				var st *btf.Struct
+				require.NoError(t, spec.Types.TypeByName(cType, &st))
+				assert.EqualValuesf(t, st.Size, binary.Size(goType), "size of %s", cType)
+			}
+		})
+	}
+}
@@ -22,7 +22,6 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
-	"os"
 	"strings"
 	"syscall"
 	"unsafe"
@@ -32,6 +31,7 @@ import (
 	"github.com/cilium/ebpf/rlimit"
 	"golang.org/x/sys/unix"
 
+	"github.com/grafana/beyla/pkg/internal/ebpf/attachment"
 	"github.com/grafana/beyla/pkg/internal/netolly/ifaces"
 )
 
@@ -79,7 +79,6 @@ func NewSockFlowFetcher(
 	if err := spec.LoadAndAssign(&objects, &ebpf.CollectionOptions{
 		Programs: ebpf.ProgramOptions{LogSize: 640 * 1024},
 	}); err != nil {
-		printVerifierErrorInfo(err)
 		return nil, fmt.Errorf("loading and assigning BPF objects: %w", err)
 	}
 
@@ -105,18 +104,17 @@ func NewSockFlowFetcher(
 	}, nil
 }
 
-func printVerifierErrorInfo(err error) {
-	var ve *ebpf.VerifierError
-	if errors.As(err, &ve) {
-		_, _ = fmt.Fprintf(os.Stderr, "Error Log:\n %v\n", strings.Join(ve.Log, "\n"))
-	}
-}
-
 // Noop because socket filters don't require special registration for different network interfaces
 func (m *SockFlowFetcher) Register(_ ifaces.Interface) error {
 	return nil
 }
 
+// Attachment returns nil because the socket filter is attached to a socket that is owned by Beyla,
+// so it can't be detached by other tools
+func (m *SockFlowFetcher) Attachment(_ ifaces.Interface) attachment.Attachment {
+	return nil
+}
+
 // Close any resources that are taken up by the socket filter, the filter itself and some maps.
 func (m *SockFlowFetcher) Close() error {
 	log := tlog()
@@ -5,6 +5,7 @@ package ebpf
 import (
 	"github.com/cilium/ebpf/ringbuf"
 
+	"github.com/grafana/beyla/pkg/internal/ebpf/attachment"
 	"github.com/grafana/beyla/pkg/internal/netolly/ifaces"
 )
 
@@ -18,6 +19,10 @@ func (s *SockFlowFetcher) Register(_ ifaces.Interface) error {
 	panic("this is never going to be executed")
 }
 
+func (s *SockFlowFetcher) Attachment(_ ifaces.Interface) attachment.Attachment {
+	panic("this is never going to be executed")
+}
+
 func (s *SockFlowFetcher) LookupAndDeleteMap() map[NetFlowId][]NetFlowMetrics {
 	panic("this is never going to be executed")
 }
@@ -27,12 +27,14 @@ import (
 	"io/fs"
 	"log/slog"
 	"strings"
+	"sync"
 
 	"github.com/cilium/ebpf/ringbuf"
 	"github.com/cilium/ebpf/rlimit"
 	"github.com/vishvananda/netlink"
 	"golang.org/x/sys/unix"
 
+	"github.com/grafana/beyla/pkg/internal/ebpf/attachment"
 	"github.com/grafana/beyla/pkg/internal/netolly/ifaces"
 )
 
@@ -44,7 +46,10 @@ const (
 	// constants defined in flows.c as "volatile const"
 	constSampling      = "sampling"
 	constTraceMessages = "trace_messages"
+	constTunnelOuter   = "report_tunnel_outer"
 	aggregatedFlowsMap = "aggregated_flows"
+	egressFilterName   = "tc/egress_flow_parse"
+	ingressFilterName  = "tc/ingress_flow_parse"
 )
 
 func tlog() *slog.Logger {
@@ -56,6 +61,9 @@ func tlog() *slog.Logger {
 // and to flows that are forwarded by the kernel via ringbuffer because could not be aggregated
 // in the map
 type FlowFetcher struct {
+	// mt guards the registration of the interfaces, which can be invoked from the interfaces
+	// informer and from the attachments watchdog
+	mt             sync.Mutex
 	objects        *NetObjects
 	qdiscs         map[ifaces.Interface]*netlink.GenericQdisc
 	egressFilters  map[ifaces.Interface]*netlink.BpfFilter
@@ -68,7 +76,7 @@ type FlowFetcher struct {
 
 func NewFlowFetcher(
 	sampling, cacheMaxSize int,
-	ingress, egress bool,
+	ingress, egress, tunnelOuter bool,
 ) (*FlowFetcher, error) {
 	tlog := tlog()
 	if err := rlimit.RemoveMemlock(); err != nil {
@@ -89,9 +97,14 @@ func NewFlowFetcher(
 	if tlog.Enabled(context.TODO(), slog.LevelDebug) {
 		traceMsgs = 1
 	}
+	reportTunnelOuter := 0
+	if tunnelOuter {
+		reportTunnelOuter = 1
+	}
 	if err := spec.RewriteConstants(map[string]interface{}{
 		constSampling:      uint32(sampling),
 		constTraceMessages: uint8(traceMsgs),
+		constTunnelOuter:   uint8(reportTunnelOuter),
 	}); err != nil {
 		return nil, fmt.Errorf("rewriting BPF constants definition: %w", err)
 	}
@@ -119,6 +132,11 @@ func NewFlowFetcher(
 // Register and links the eBPF fetcher into the system. The program should invoke Unregister
 // before exiting.
 func (m *FlowFetcher) Register(iface ifaces.Interface) error {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	if m.objects == nil {
+		return errors.New("flow fetcher is closed")
+	}
 	ilog := tlog().With("interface", iface)
 	// Load pre-compiled programs and maps into the kernel, and rewrites the configuration
 	ipvlan, err := netlink.LinkByIndex(iface.Index)
@@ -171,7 +189,7 @@ func (m *FlowFetcher) registerEgress(iface ifaces.Interface, ipvlan netlink.Link
 	egressFilter := &netlink.BpfFilter{
 		FilterAttrs:  egressAttrs,
 		Fd:           m.objects.EgressFlowParse.FD(),
-		Name:         "tc/egress_flow_parse",
+		Name:         egressFilterName,
 		DirectAction: true,
 	}
 	if err := netlink.FilterDel(egressFilter); err == nil {
@@ -205,7 +223,7 @@ func (m *FlowFetcher) registerIngress(iface ifaces.Interface, ipvlan netlink.Lin
 	ingressFilter := &netlink.BpfFilter{
 		FilterAttrs:  ingressAttrs,
 		Fd:           m.objects.IngressFlowParse.FD(),
-		Name:         "tc/ingress_flow_parse",
+		Name:         ingressFilterName,
 		DirectAction: true,
 	}
 	if err := netlink.FilterDel(ingressFilter); err == nil {
@@ -222,10 +240,65 @@ func (m *FlowFetcher) registerIngress(iface ifaces.Interface, ipvlan netlink.Lin
 	return nil
 }
 
+// Attachment returns the attachment of the Traffic Control programs to the provided interface,
+// so it can be verified periodically
+func (m *FlowFetcher) Attachment(iface ifaces.Interface) attachment.Attachment {
+	return &tcAttachment{fetcher: m, iface: iface}
+}
+
+type tcAttachment struct {
+	fetcher *FlowFetcher
+	iface   ifaces.Interface
+}
+
+// Check that the egress and ingress filters are still in the interface
+func (tc *tcAttachment) Check() error {
+	ipvlan, err := netlink.LinkByIndex(tc.iface.Index)
+	if err != nil {
+		var notFound netlink.LinkNotFoundError
+		if errors.As(err, &notFound) {
+			// the interface has been removed, and the informer will stop watching it
+			return nil
+		}
+		return fmt.Errorf("looking up interface %d (%s): %w", tc.iface.Index, tc.iface.Name, err)
+	}
+	if tc.fetcher.enableEgress {
+		if err := hasFilter(ipvlan, netlink.HANDLE_MIN_EGRESS, egressFilterName); err != nil {
+			return err
+		}
+	}
+	if tc.fetcher.enableIngress {
+		if err := hasFilter(ipvlan, netlink.HANDLE_MIN_INGRESS, ingressFilterName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reattach registers again the qdisc and the filters in the interface
+func (tc *tcAttachment) Reattach() error {
+	return tc.fetcher.Register(tc.iface)
+}
+
+func hasFilter(ipvlan netlink.Link, parent uint32, name string) error {
+	filters, err := netlink.FilterList(ipvlan, parent)
+	if err != nil {
+		return fmt.Errorf("listing filters: %w", err)
+	}
+	for _, filter := range filters {
+		if bpf, ok := filter.(*netlink.BpfFilter); ok && bpf.Name == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("filter %s not found", name)
+}
+
 // Close the eBPF fetcher from the system.
 // We don't need an "Close(iface)" method because the filters and qdiscs
 // are automatically removed when the interface is down
 func (m *FlowFetcher) Close() error {
+	m.mt.Lock()
+	defer m.mt.Unlock()
 	log := tlog()
 	log.Debug("unregistering eBPF objects")
 
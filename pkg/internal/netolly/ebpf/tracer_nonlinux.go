@@ -5,13 +5,14 @@ package ebpf
 import (
 	"github.com/cilium/ebpf/ringbuf"
 
+	"github.com/grafana/beyla/pkg/internal/ebpf/attachment"
 	"github.com/grafana/beyla/pkg/internal/netolly/ifaces"
 )
 
 type FlowFetcher struct {
 }
 
-func NewFlowFetcher(_, _ int, _, _ bool) (*FlowFetcher, error) {
+func NewFlowFetcher(_, _ int, _, _, _ bool) (*FlowFetcher, error) {
 	return nil, nil
 }
 
@@ -19,6 +20,10 @@ func (m *FlowFetcher) Register(_ ifaces.Interface) error {
 	return nil
 }
 
+func (m *FlowFetcher) Attachment(_ ifaces.Interface) attachment.Attachment {
+	return nil
+}
+
 func (m *FlowFetcher) Close() error {
 	return nil
 }
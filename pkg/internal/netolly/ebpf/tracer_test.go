@@ -0,0 +1,28 @@
+//go:build linux
+
+package ebpf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// The constants that are rewritten before loading the programs must be
+// declared in the compiled objects, or the tracers would fail to load
+func TestRewriteConstants(t *testing.T) {
+	spec, err := LoadNet()
+	require.NoError(t, err)
+	require.NoError(t, spec.RewriteConstants(map[string]interface{}{
+		constSampling:      uint32(0),
+		constTraceMessages: uint8(0),
+		constTunnelOuter:   uint8(1),
+	}))
+
+	spec, err = LoadNetSk()
+	require.NoError(t, err)
+	require.NoError(t, spec.RewriteConstants(map[string]interface{}{
+		constSampling:      uint32(0),
+		constTraceMessages: uint8(0),
+	}))
+}
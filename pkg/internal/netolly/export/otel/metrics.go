@@ -24,6 +24,8 @@ import (
 type MetricsConfig struct {
 	Metrics            *otel.MetricsConfig
 	AttributeSelectors bmetric.Selection
+	// FlowHistograms enables the flow size and duration histograms
+	FlowHistograms bool
 }
 
 func (mc MetricsConfig) Enabled() bool {
@@ -34,7 +36,7 @@ func mlog() *slog.Logger {
 	return slog.With("component", "flows.MetricsReporter")
 }
 
-func newResource() *resource.Resource {
+func newResource(build *global.BuildInfo) *resource.Resource {
 	attrs := []attribute.KeyValue{
 		semconv.ServiceName("beyla-network-flows"),
 		semconv.ServiceInstanceID(uuid.New().String()),
@@ -46,20 +48,45 @@ func newResource() *resource.Resource {
 		// We set the SDK name as Beyla, so we can distinguish beyla generated metrics from other SDKs
 		semconv.TelemetrySDKNameKey.String("beyla"),
 	}
+	attrs = append(attrs, otel.BuildAttributes(build)...)
 
 	return resource.NewWithAttributes(semconv.SchemaURL, attrs...)
 }
 
-func newMeterProvider(res *resource.Resource, exporter *metric.Exporter, interval time.Duration) (*metric.MeterProvider, error) {
+func histogramView(name string, buckets []float64) metric.Option {
+	return metric.WithView(metric.NewView(
+		metric.Instrument{Name: name},
+		metric.Stream{
+			Name:        name,
+			Aggregation: metric.AggregationExplicitBucketHistogram{Boundaries: buckets},
+		},
+	))
+}
+
+func newMeterProvider(res *resource.Resource, exporter *metric.Exporter, interval time.Duration, buckets otel.Buckets) (*metric.MeterProvider, error) {
 	meterProvider := metric.NewMeterProvider(
 		metric.WithResource(res),
 		metric.WithReader(metric.NewPeriodicReader(*exporter, metric.WithInterval(interval))),
+		histogramView(bmetric.BeylaNetworkICMPRTT.OTEL, buckets.DurationHistogram),
+		histogramView(bmetric.BeylaNetworkFlowSize.OTEL, buckets.RequestSizeHistogram),
+		histogramView(bmetric.BeylaNetworkFlowDuration.OTEL, buckets.DurationHistogram),
 	)
 	return meterProvider, nil
 }
 
 type metricsExporter struct {
-	metrics *Expirer
+	// ctx is used to flush the pending metrics when the exporter stops
+	ctx      context.Context
+	provider *metric.MeterProvider
+	metrics  *Expirer
+	icmpRTT  metric2.Float64Histogram
+	rttAttrs []bmetric.Field[*ebpf.Record, string]
+
+	// flowSize and flowDuration are nil if the flow histograms are disabled
+	flowSize      metric2.Int64Histogram
+	flowDuration  metric2.Float64Histogram
+	sizeAttrs     []bmetric.Field[*ebpf.Record, string]
+	durationAttrs []bmetric.Field[*ebpf.Record, string]
 }
 
 func MetricsExporterProvider(ctxInfo *global.ContextInfo, cfg *MetricsConfig) (pipe.FinalFunc[[]*ebpf.Record], error) {
@@ -75,7 +102,8 @@ func MetricsExporterProvider(ctxInfo *global.ContextInfo, cfg *MetricsConfig) (p
 		return nil, err
 	}
 
-	provider, err := newMeterProvider(newResource(), &exporter, cfg.Metrics.Interval)
+	exporter = ctxInfo.Aliases.MetricsExporter(exporter)
+	provider, err := newMeterProvider(newResource(&ctxInfo.Build), &exporter, cfg.Metrics.Interval, cfg.Metrics.Buckets)
 
 	if err != nil {
 		log.Error("", "error", err)
@@ -103,10 +131,50 @@ func MetricsExporterProvider(ctxInfo *global.ContextInfo, cfg *MetricsConfig) (p
 		log.Error("creating observable counter", "error", err)
 		return nil, err
 	}
+	icmpRTT, err := ebpfEvents.Float64Histogram(
+		bmetric.BeylaNetworkICMPRTT.OTEL,
+		metric2.WithDescription("estimated round-trip time between ICMP Echo Request and Echo Reply flows"),
+		metric2.WithUnit("s"),
+	)
+	if err != nil {
+		log.Error("creating ICMP RTT histogram", "error", err)
+		return nil, err
+	}
+	me := &metricsExporter{
+		ctx:      ctxInfo.ExportContext(context.Background()),
+		provider: provider,
+		metrics:  expirer,
+		icmpRTT:  icmpRTT,
+		rttAttrs: bmetric.OpenTelemetryGetters(
+			ebpf.RecordGetters,
+			attrProv.For(bmetric.BeylaNetworkICMPRTT)),
+	}
+	if cfg.FlowHistograms {
+		if me.flowSize, err = ebpfEvents.Int64Histogram(
+			bmetric.BeylaNetworkFlowSize.OTEL,
+			metric2.WithDescription("bytes of each flow, as observed when it is evicted from the accounting cache"),
+			metric2.WithUnit("By"),
+		); err != nil {
+			log.Error("creating flow size histogram", "error", err)
+			return nil, err
+		}
+		if me.flowDuration, err = ebpfEvents.Float64Histogram(
+			bmetric.BeylaNetworkFlowDuration.OTEL,
+			metric2.WithDescription("duration of each flow, as observed when it is evicted from the accounting cache"),
+			metric2.WithUnit("s"),
+		); err != nil {
+			log.Error("creating flow duration histogram", "error", err)
+			return nil, err
+		}
+		me.sizeAttrs = bmetric.OpenTelemetryGetters(
+			ebpf.RecordGetters,
+			attrProv.For(bmetric.BeylaNetworkFlowSize))
+		me.durationAttrs = bmetric.OpenTelemetryGetters(
+			ebpf.RecordGetters,
+			attrProv.For(bmetric.BeylaNetworkFlowDuration))
+	}
 	log.Debug("restricting attributes not in this list", "attributes", cfg.AttributeSelectors)
-	return (&metricsExporter{
-		metrics: expirer,
-	}).Do, nil
+	return me.Do, nil
 }
 
 func (me *metricsExporter) Do(in <-chan []*ebpf.Record) {
@@ -114,6 +182,28 @@ func (me *metricsExporter) Do(in <-chan []*ebpf.Record) {
 		me.metrics.UpdateTime()
 		for _, v := range i {
 			me.metrics.ForRecord(v).val.Add(int64(v.Metrics.Bytes))
+			if v.Attrs.ICMPEchoRTT > 0 {
+				me.icmpRTT.Record(context.Background(), v.Attrs.ICMPEchoRTT.Seconds(),
+					metric2.WithAttributeSet(attributeSet(v, me.rttAttrs)))
+			}
+			if me.flowSize != nil {
+				me.flowSize.Record(context.Background(), int64(v.Metrics.Bytes),
+					metric2.WithAttributeSet(attributeSet(v, me.sizeAttrs)))
+				me.flowDuration.Record(context.Background(), v.Metrics.Duration().Seconds(),
+					metric2.WithAttributeSet(attributeSet(v, me.durationAttrs)))
+			}
 		}
 	}
+	// flush the metrics that have been recorded since the last export
+	if err := me.provider.Shutdown(me.ctx); err != nil {
+		mlog().Warn("can't flush network metrics", "error", err)
+	}
+}
+
+func attributeSet(m *ebpf.Record, attrs []bmetric.Field[*ebpf.Record, string]) attribute.Set {
+	keyVals := make([]attribute.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		keyVals = append(keyVals, attribute.String(attr.ExposedName, attr.Get(m)))
+	}
+	return attribute.NewSet(keyVals...)
 }
@@ -16,45 +16,51 @@ func plog() *slog.Logger {
 }
 
 // Expirer drops metrics from labels that haven't been updated during a given timeout
-type Expirer struct {
-	entries *export.ExpiryMap[prometheus.Counter]
-	wrapped *prometheus.CounterVec
+type Expirer[T prometheus.Metric] struct {
+	entries *export.ExpiryMap[T]
+	wrapped *prometheus.MetricVec
 }
 
-// NewExpirer creates a metric that wraps a given CounterVec. Its labeled instances are dropped
-// if they haven't been updated during the last timeout period
-func NewExpirer(wrapped *prometheus.CounterVec, expireTime time.Duration) *Expirer {
-	return &Expirer{
+// NewExpirer creates a metric that wraps a given MetricVec (e.g. the MetricVec of a CounterVec or
+// a HistogramVec). Its labeled instances are dropped if they haven't been updated during the
+// last timeout period
+func NewExpirer[T prometheus.Metric](wrapped *prometheus.MetricVec, expireTime time.Duration) *Expirer[T] {
+	return &Expirer[T]{
 		wrapped: wrapped,
-		entries: export.NewExpiryMap[prometheus.Counter](expireTime, export.WithClock[prometheus.Counter](timeNow)),
+		entries: export.NewExpiryMap[T](expireTime, export.WithClock[T](timeNow)),
 	}
 }
 
 // UpdateTime updates the last access time to be annotated to any new or existing metric.
 // It is a required operation before processing a given
 // batch of metrics (invoking the WithLabelValues).
-func (ex *Expirer) UpdateTime() {
+func (ex *Expirer[T]) UpdateTime() {
 	ex.entries.UpdateTime()
 }
 
-// WithLabelValues returns the Counter for the given slice of label
+// WithLabelValues returns the metric for the given slice of label
 // values (same order as the variable labels in Desc). If that combination of
-// label values is accessed for the first time, a new Counter is created.
+// label values is accessed for the first time, a new metric is created.
 // If not, a cached copy is returned and the "last access" cache time is updated.
-func (ex *Expirer) WithLabelValues(lbls ...string) prometheus.Counter {
-	return ex.entries.GetOrCreate(lbls, func() prometheus.Counter {
+func (ex *Expirer[T]) WithLabelValues(lbls ...string) T {
+	return ex.entries.GetOrCreate(lbls, func() T {
 		plog().With("labelValues", lbls).Debug("storing new metric label set")
-		return ex.wrapped.WithLabelValues(lbls...)
+		m, err := ex.wrapped.GetMetricWithLabelValues(lbls...)
+		if err != nil {
+			// same behavior as the WithLabelValues method of the wrapped vectors
+			panic(err)
+		}
+		return m.(T)
 	})
 }
 
 // Describe wraps prometheus.Collector Describe method
-func (ex *Expirer) Describe(descs chan<- *prometheus.Desc) {
+func (ex *Expirer[T]) Describe(descs chan<- *prometheus.Desc) {
 	ex.wrapped.Describe(descs)
 }
 
 // Collect wraps prometheus.Collector Wrap method
-func (ex *Expirer) Collect(metrics chan<- prometheus.Metric) {
+func (ex *Expirer[T]) Collect(metrics chan<- prometheus.Metric) {
 	log := plog()
 	log.Debug("invoking metrics collection")
 	for _, old := range ex.entries.DeleteExpired() {
@@ -131,3 +131,91 @@ func (c *syncedClock) Advance(t time.Duration) {
 	defer c.mt.Unlock()
 	c.now = c.now.Add(t)
 }
+
+func TestFlowHistograms(t *testing.T) {
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	defer cancelCtx()
+	openPort, err := test.FreeTCPPort()
+	require.NoError(t, err)
+	promURL := fmt.Sprintf("http://127.0.0.1:%d/metrics", openPort)
+
+	// GIVEN a Prometheus Metrics Exporter with the flow histograms enabled
+	exporter, err := PrometheusEndpoint(
+		ctx, &global.ContextInfo{Prometheus: &connector.PrometheusManager{}},
+		&PrometheusConfig{Config: &prom.PrometheusConfig{
+			Port:     openPort,
+			Path:     "/metrics",
+			TTL:      3 * time.Minute,
+			Features: []string{otel.FeatureNetwork},
+			Buckets: otel.Buckets{
+				DurationHistogram:    []float64{1, 10},
+				RequestSizeHistogram: []float64{100, 1000},
+			},
+		}, AttributeSelectors: metric.Selection{
+			metric.BeylaNetworkFlowSize.Section: metric.InclusionLists{
+				Include: []string{"src_name"},
+			},
+			metric.BeylaNetworkFlowDuration.Section: metric.InclusionLists{
+				Include: []string{"src_name"},
+			},
+		}, FlowHistograms: true},
+	)
+	require.NoError(t, err)
+
+	metrics := make(chan []*ebpf.Record, 20)
+	go exporter(metrics)
+
+	// WHEN it receives flows
+	metrics <- []*ebpf.Record{
+		{Attrs: ebpf.RecordAttrs{SrcName: "foo"},
+			NetFlowRecordT: ebpf.NetFlowRecordT{Metrics: ebpf.NetFlowMetrics{
+				Bytes: 50, StartMonoTimeNs: 1_000_000_000, EndMonoTimeNs: 6_000_000_000}}},
+		{Attrs: ebpf.RecordAttrs{SrcName: "foo"},
+			NetFlowRecordT: ebpf.NetFlowRecordT{Metrics: ebpf.NetFlowMetrics{
+				Bytes: 500, StartMonoTimeNs: 1_000_000_000, EndMonoTimeNs: 1_500_000_000}}},
+	}
+
+	// THEN the size and duration of each flow are observed in the histograms
+	test.Eventually(t, timeout, func(t require.TestingT) {
+		exported := getMetrics(t, promURL)
+		assert.Contains(t, exported, `beyla_network_flow_size_bytes_bucket{src_name="foo",le="100"} 1`)
+		assert.Contains(t, exported, `beyla_network_flow_size_bytes_bucket{src_name="foo",le="1000"} 2`)
+		assert.Contains(t, exported, `beyla_network_flow_size_bytes_sum{src_name="foo"} 550`)
+		assert.Contains(t, exported, `beyla_network_flow_duration_seconds_bucket{src_name="foo",le="1"} 1`)
+		assert.Contains(t, exported, `beyla_network_flow_duration_seconds_bucket{src_name="foo",le="10"} 2`)
+		assert.Contains(t, exported, `beyla_network_flow_duration_seconds_count{src_name="foo"} 2`)
+	})
+}
+
+func TestFlowHistograms_DisabledByDefault(t *testing.T) {
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	defer cancelCtx()
+	openPort, err := test.FreeTCPPort()
+	require.NoError(t, err)
+	promURL := fmt.Sprintf("http://127.0.0.1:%d/metrics", openPort)
+
+	exporter, err := PrometheusEndpoint(
+		ctx, &global.ContextInfo{Prometheus: &connector.PrometheusManager{}},
+		&PrometheusConfig{Config: &prom.PrometheusConfig{
+			Port:     openPort,
+			Path:     "/metrics",
+			TTL:      3 * time.Minute,
+			Features: []string{otel.FeatureNetwork},
+		}},
+	)
+	require.NoError(t, err)
+
+	metrics := make(chan []*ebpf.Record, 20)
+	go exporter(metrics)
+	metrics <- []*ebpf.Record{
+		{NetFlowRecordT: ebpf.NetFlowRecordT{Metrics: ebpf.NetFlowMetrics{Bytes: 50}}},
+	}
+
+	var exported string
+	test.Eventually(t, timeout, func(t require.TestingT) {
+		exported = getMetrics(t, promURL)
+		assert.Contains(t, exported, `beyla_network_flow_bytes_total`)
+	})
+	assert.NotContains(t, exported, `beyla_network_flow_size_bytes`)
+	assert.NotContains(t, exported, `beyla_network_flow_duration_seconds`)
+}
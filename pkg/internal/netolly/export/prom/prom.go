@@ -20,27 +20,30 @@ import (
 type PrometheusConfig struct {
 	Config             *prom.PrometheusConfig
 	AttributeSelectors metric.Selection
+	// FlowHistograms enables the flow size and duration histograms
+	FlowHistograms bool
 }
 
 // nolint:gocritic
 func (p PrometheusConfig) Enabled() bool {
-	return p.Config != nil && p.Config.Port != 0 && slices.Contains(p.Config.Features, otel.FeatureNetwork)
-}
-
-type counterCollector interface {
-	prometheus.Collector
-	UpdateTime()
-	WithLabelValues(...string) prometheus.Counter
+	return p.Config != nil && p.Config.EndpointEnabled() && slices.Contains(p.Config.Features, otel.FeatureNetwork)
 }
 
 type metricsReporter struct {
 	cfg *prom.PrometheusConfig
 
-	flowBytes counterCollector
+	flowBytes *Expirer[prometheus.Counter]
+	icmpRTT   *Expirer[prometheus.Histogram]
+	// flowSize and flowDuration are nil if the flow histograms are disabled
+	flowSize     *Expirer[prometheus.Histogram]
+	flowDuration *Expirer[prometheus.Histogram]
 
 	promConnect *connector.PrometheusManager
 
-	attrs []metric.Field[*ebpf.Record, string]
+	attrs         []metric.Field[*ebpf.Record, string]
+	rttAttrs      []metric.Field[*ebpf.Record, string]
+	sizeAttrs     []metric.Field[*ebpf.Record, string]
+	durationAttrs []metric.Field[*ebpf.Record, string]
 
 	bgCtx context.Context
 }
@@ -80,10 +83,9 @@ func newReporter(
 		ebpf.RecordGetters,
 		provider.For(metric.BeylaNetworkFlow))
 
-	labelNames := make([]string, 0, len(attrs))
-	for _, label := range attrs {
-		labelNames = append(labelNames, label.ExposedName)
-	}
+	rttAttrs := metric.PrometheusGetters(
+		ebpf.RecordGetters,
+		provider.For(metric.BeylaNetworkICMPRTT))
 
 	// If service name is not explicitly set, we take the service name as set by the
 	// executable inspector
@@ -92,13 +94,43 @@ func newReporter(
 		cfg:         cfg.Config,
 		promConnect: ctxInfo.Prometheus,
 		attrs:       attrs,
-		flowBytes: NewExpirer(prometheus.NewCounterVec(prometheus.CounterOpts{
+		rttAttrs:    rttAttrs,
+		flowBytes: NewExpirer[prometheus.Counter](prometheus.NewCounterVec(prometheus.CounterOpts{
 			Name: metric.BeylaNetworkFlow.Prom,
 			Help: "bytes submitted from a source network endpoint to a destination network endpoint",
-		}, labelNames), cfg.Config.TTL),
+		}, labelNames(attrs)).MetricVec, cfg.Config.TTL),
+		icmpRTT: NewExpirer[prometheus.Histogram](prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    metric.BeylaNetworkICMPRTT.Prom,
+			Help:    "estimated round-trip time between ICMP Echo Request and Echo Reply flows",
+			Buckets: cfg.Config.Buckets.DurationHistogram,
+		}, labelNames(rttAttrs)).MetricVec, cfg.Config.TTL),
 	}
 
-	mr.promConnect.Register(cfg.Config.Port, cfg.Config.Path, mr.flowBytes)
+	collectors := []prometheus.Collector{mr.flowBytes, mr.icmpRTT}
+	if cfg.FlowHistograms {
+		mr.sizeAttrs = metric.PrometheusGetters(
+			ebpf.RecordGetters,
+			provider.For(metric.BeylaNetworkFlowSize))
+		mr.durationAttrs = metric.PrometheusGetters(
+			ebpf.RecordGetters,
+			provider.For(metric.BeylaNetworkFlowDuration))
+		mr.flowSize = NewExpirer[prometheus.Histogram](prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    metric.BeylaNetworkFlowSize.Prom,
+			Help:    "bytes of each flow, as observed when it is evicted from the accounting cache",
+			Buckets: cfg.Config.Buckets.RequestSizeHistogram,
+		}, labelNames(mr.sizeAttrs)).MetricVec, cfg.Config.TTL)
+		mr.flowDuration = NewExpirer[prometheus.Histogram](prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    metric.BeylaNetworkFlowDuration.Prom,
+			Help:    "duration of each flow, as observed when it is evicted from the accounting cache",
+			Buckets: cfg.Config.Buckets.DurationHistogram,
+		}, labelNames(mr.durationAttrs)).MetricVec, cfg.Config.TTL)
+		collectors = append(collectors, mr.flowSize, mr.flowDuration)
+	}
+
+	mr.promConnect.Register(cfg.Config.Port, cfg.Config.Path, collectors...)
+	if cfg.Config.UnixSocket != "" {
+		mr.promConnect.UnixSocket(cfg.Config.Port, cfg.Config.UnixSocket, cfg.Config.UnixSocketMode)
+	}
 
 	return mr, nil
 }
@@ -107,6 +139,11 @@ func (r *metricsReporter) reportMetrics(input <-chan []*ebpf.Record) {
 	go r.promConnect.StartHTTP(r.bgCtx)
 	for flows := range input {
 		r.flowBytes.UpdateTime()
+		r.icmpRTT.UpdateTime()
+		if r.flowSize != nil {
+			r.flowSize.UpdateTime()
+			r.flowDuration.UpdateTime()
+		}
 		for _, flow := range flows {
 			r.observe(flow)
 		}
@@ -114,9 +151,28 @@ func (r *metricsReporter) reportMetrics(input <-chan []*ebpf.Record) {
 }
 
 func (r *metricsReporter) observe(flow *ebpf.Record) {
-	labelValues := make([]string, 0, len(r.attrs))
-	for _, attr := range r.attrs {
-		labelValues = append(labelValues, attr.Get(flow))
+	r.flowBytes.WithLabelValues(labelValues(flow, r.attrs)...).Add(float64(flow.Metrics.Bytes))
+	if flow.Attrs.ICMPEchoRTT > 0 {
+		r.icmpRTT.WithLabelValues(labelValues(flow, r.rttAttrs)...).Observe(flow.Attrs.ICMPEchoRTT.Seconds())
+	}
+	if r.flowSize != nil {
+		r.flowSize.WithLabelValues(labelValues(flow, r.sizeAttrs)...).Observe(float64(flow.Metrics.Bytes))
+		r.flowDuration.WithLabelValues(labelValues(flow, r.durationAttrs)...).Observe(flow.Metrics.Duration().Seconds())
+	}
+}
+
+func labelNames(attrs []metric.Field[*ebpf.Record, string]) []string {
+	names := make([]string, 0, len(attrs))
+	for _, label := range attrs {
+		names = append(names, label.ExposedName)
+	}
+	return names
+}
+
+func labelValues(flow *ebpf.Record, attrs []metric.Field[*ebpf.Record, string]) []string {
+	values := make([]string, 0, len(attrs))
+	for _, attr := range attrs {
+		values = append(values, attr.Get(flow))
 	}
-	r.flowBytes.WithLabelValues(labelValues...).Add(float64(flow.Metrics.Bytes))
+	return values
 }
@@ -21,10 +21,12 @@ package flow
 import (
 	"container/list"
 	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"github.com/mariomac/pipes/pipe"
 
+	"github.com/grafana/beyla/pkg/internal/memlimit"
 	"github.com/grafana/beyla/pkg/internal/netolly/ebpf"
 )
 
@@ -40,6 +42,8 @@ const (
 type Deduper struct {
 	Type       string
 	ExpireTime time.Duration
+	// Pressure, if not nil, requests shrinking the cache when the memory usage approaches the limit
+	Pressure *memlimit.Pressure
 }
 
 func (d Deduper) Enabled() bool {
@@ -80,9 +84,15 @@ func DeduperProvider(dd *Deduper) (pipe.MiddleFunc[[]*ebpf.Record, []*ebpf.Recor
 		entries: list.New(),
 		ifaces:  map[ebpf.NetFlowId]*list.Element{},
 	}
+	// the cache is not safe for concurrent access, so it is shrunk from the deduper loop
+	shrink := atomic.Bool{}
+	dd.Pressure.OnHigh("network_deduper_cache_shrink", func() { shrink.Store(true) })
 	return func(in <-chan []*ebpf.Record, out chan<- []*ebpf.Record) {
 		for records := range in {
 			cache.removeExpired()
+			if shrink.Swap(false) {
+				cache.removeOldest(cache.entries.Len() / 2)
+			}
 			fwd := make([]*ebpf.Record, 0, len(records))
 			for _, record := range records {
 				if cache.isDupe(&record.Id) {
@@ -132,6 +142,16 @@ func (c *deduperCache) isDupe(key *ebpf.NetFlowId) bool {
 	return false
 }
 
+// removeOldest removes the n least recently accessed entries. Their flows might be forwarded
+// again as non-duplicate flows from a different interface.
+func (c *deduperCache) removeOldest(n int) {
+	for ele := c.entries.Back(); ele != nil && n > 0; ele = c.entries.Back() {
+		c.entries.Remove(ele)
+		delete(c.ifaces, *ele.Value.(*entry).key)
+		n--
+	}
+}
+
 func (c *deduperCache) removeExpired() {
 	now := timeNow()
 	ele := c.entries.Back()
@@ -19,6 +19,7 @@
 package flow
 
 import (
+	"container/list"
 	"sync"
 	"testing"
 	"time"
@@ -26,7 +27,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
 	"github.com/grafana/beyla/pkg/internal/netolly/ebpf"
+	"github.com/grafana/beyla/pkg/internal/netolly/flow/transport"
 	"github.com/grafana/beyla/pkg/internal/testutil"
 )
 
@@ -125,6 +128,70 @@ func TestDedupe_EvictFlows(t *testing.T) {
 		testutil.ReadChannel(t, output, timeout))
 }
 
+func TestDedupe_RemoveOldest(t *testing.T) {
+	cache := &deduperCache{
+		expire:  time.Minute,
+		entries: list.New(),
+		ifaces:  map[ebpf.NetFlowId]*list.Element{},
+	}
+	one := ebpf.NetFlowId{EthProtocol: 1, SrcPort: 123, DstPort: 456, IfIndex: 1}
+	two := ebpf.NetFlowId{EthProtocol: 1, SrcPort: 333, DstPort: 456, IfIndex: 1}
+	assert.False(t, cache.isDupe(&one))
+	assert.False(t, cache.isDupe(&two))
+
+	// WHEN the cache is shrunk
+	cache.removeOldest(1)
+
+	// THEN the least recently accessed flow is forgotten, and accepted from any interface
+	assert.Equal(t, 1, cache.entries.Len())
+	one.IfIndex = 2
+	assert.False(t, cache.isDupe(&one))
+	// AND the rest of the flows are still deduplicated
+	two.IfIndex = 2
+	assert.True(t, cache.isDupe(&two))
+}
+
+// SCTP associations can be multi-homed: a single association (same ports and
+// verification tag) can send packets through multiple source/destination IP pairs.
+// Since flows are identified by IPs and ports, each path of the association is
+// currently reported as a separate flow.
+func TestDedupe_SCTPMultiHomingAsSeparateFlows(t *testing.T) {
+	input := make(chan []*ebpf.Record, 100)
+	output := make(chan []*ebpf.Record, 100)
+
+	dedupe, err := DeduperProvider(&Deduper{Type: DeduperFirstCome, ExpireTime: time.Minute})
+	require.NoError(t, err)
+	go dedupe(input, output)
+
+	primary := &ebpf.Record{NetFlowRecordT: ebpf.NetFlowRecordT{Id: ebpf.NetFlowId{
+		EthProtocol: 1, TransportProtocol: uint8(transport.SCTP), SrcPort: 38412, DstPort: 38412, IfIndex: 1,
+	}, Metrics: ebpf.NetFlowMetrics{
+		Packets: 3, Bytes: 300,
+	}}}
+	primary.Id.SrcIp.In6U.U6Addr8[15] = 1
+	primary.Id.DstIp.In6U.U6Addr8[15] = 2
+	// same association, alternate path
+	secondary := clone(primary)
+	secondary.Id.SrcIp.In6U.U6Addr8[15] = 3
+	secondary.Id.DstIp.In6U.U6Addr8[15] = 4
+	secondary.Metrics = ebpf.NetFlowMetrics{Packets: 1, Bytes: 100}
+
+	input <- []*ebpf.Record{clone(primary), clone(secondary)}
+	deduped := testutil.ReadChannel(t, output, timeout)
+	assert.Equal(t, []*ebpf.Record{unset(primary), unset(secondary)}, deduped)
+
+	get := func(name attr.Name, r *ebpf.Record) string {
+		getter, ok := ebpf.RecordGetters(name)
+		require.True(t, ok)
+		return getter(r)
+	}
+	for _, r := range deduped {
+		assert.Equal(t, "SCTP", get(attr.Transport, r))
+		assert.Equal(t, "38412", get(attr.SrcPort, r))
+		assert.Equal(t, "38412", get(attr.DstPort, r))
+	}
+}
+
 type timerMock struct {
 	// avoids data races in tests
 	sync.RWMutex
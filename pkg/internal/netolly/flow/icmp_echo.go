@@ -0,0 +1,141 @@
+package flow
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/mariomac/pipes/pipe"
+
+	"github.com/grafana/beyla/pkg/internal/netolly/ebpf"
+	"github.com/grafana/beyla/pkg/internal/netolly/flow/transport"
+)
+
+// ICMP types for Echo Request and Echo Reply messages
+// https://www.iana.org/assignments/icmp-parameters/icmp-parameters.xhtml
+// https://www.iana.org/assignments/icmpv6-parameters/icmpv6-parameters.xhtml
+const (
+	icmpEchoReply     = 0
+	icmpEchoRequest   = 8
+	icmpV6EchoRequest = 128
+	icmpV6EchoReply   = 129
+)
+
+func ielog() *slog.Logger {
+	return slog.With("component", "flow.ICMPEchoRTT")
+}
+
+// ICMPEchoRTT configures the matching of ICMP Echo Request flows with their corresponding
+// Echo Reply flows, in order to estimate the round-trip time between two endpoints.
+type ICMPEchoRTT struct {
+	// Enable the estimation of the ICMP Echo round-trip time. Default: false
+	Enable bool `yaml:"enable" env:"BEYLA_NETWORK_ICMP_ECHO_RTT"`
+	// MaxWait is the maximum time that an Echo Request flow is waiting for its
+	// Echo Reply flow, before being forgotten.
+	MaxWait time.Duration `yaml:"max_wait" env:"BEYLA_NETWORK_ICMP_ECHO_RTT_MAX_WAIT"`
+}
+
+type echoKey struct {
+	transport uint8
+	src       ebpf.IPAddr
+	dst       ebpf.IPAddr
+}
+
+type echoRequest struct {
+	startNs uint64
+	endNs   uint64
+	expiry  time.Time
+}
+
+type echoMatcher struct {
+	maxWait time.Duration
+	// key: endpoints of the Echo Request. Value: times of the request flow
+	pending map[echoKey]echoRequest
+}
+
+// ICMPEchoRTTProvider matches the flows of ICMP Echo Request messages with the flows of the Echo Reply
+// messages coming in the opposite direction. When they match, the estimated round-trip time is stored
+// in the Echo Reply record.
+// Since flows are aggregated in the kernel, the RTT is estimated from the difference between the
+// start and end times of both flows, so it is an approximation averaging all the echo messages that
+// have been aggregated into the same flow.
+func ICMPEchoRTTProvider(cfg *ICMPEchoRTT) (pipe.MiddleFunc[[]*ebpf.Record, []*ebpf.Record], error) {
+	if !cfg.Enable {
+		// This node is not going to be instantiated. Let the pipes library just bypassing it.
+		return pipe.Bypass[[]*ebpf.Record](), nil
+	}
+	em := &echoMatcher{
+		maxWait: cfg.MaxWait,
+		pending: map[echoKey]echoRequest{},
+	}
+	return func(in <-chan []*ebpf.Record, out chan<- []*ebpf.Record) {
+		ielog().Debug("starting ICMP Echo RTT node")
+		for flows := range in {
+			em.removeExpired()
+			for _, flow := range flows {
+				em.match(flow)
+			}
+			out <- flows
+		}
+	}, nil
+}
+
+func (em *echoMatcher) match(flow *ebpf.Record) {
+	if !flow.Id.IsICMP() || flow.Id.DstPort != 0 {
+		// not an ICMP message, or its ICMP code is not 0 (as required by Echo messages)
+		return
+	}
+	switch echoType(&flow.Id) {
+	case icmpEchoRequest:
+		em.pending[echoKey{
+			transport: flow.Id.TransportProtocol,
+			src:       *flow.Id.SrcIP(),
+			dst:       *flow.Id.DstIP(),
+		}] = echoRequest{
+			startNs: flow.Metrics.StartMonoTimeNs,
+			endNs:   flow.Metrics.EndMonoTimeNs,
+			expiry:  timeNow().Add(em.maxWait),
+		}
+	case icmpEchoReply:
+		// the reply goes in the opposite direction of the request
+		key := echoKey{
+			transport: flow.Id.TransportProtocol,
+			src:       *flow.Id.DstIP(),
+			dst:       *flow.Id.SrcIP(),
+		}
+		req, ok := em.pending[key]
+		if !ok {
+			return
+		}
+		delete(em.pending, key)
+		if flow.Metrics.StartMonoTimeNs < req.startNs || flow.Metrics.EndMonoTimeNs < req.endNs {
+			// the reply flow can't happen before the request flow. Probably they
+			// belong to different flow aggregation periods
+			return
+		}
+		flow.Attrs.ICMPEchoRTT = time.Duration(
+			(flow.Metrics.StartMonoTimeNs - req.startNs + flow.Metrics.EndMonoTimeNs - req.endNs) / 2)
+	}
+}
+
+// echoType normalizes the ICMP and ICMPv6 Echo types to the ICMP echo types.
+// Any other type is returned as -1
+func echoType(id *ebpf.NetFlowId) int {
+	switch {
+	case id.TransportProtocol == uint8(transport.ICMP) && id.SrcPort == icmpEchoRequest,
+		id.TransportProtocol == uint8(transport.ICMPV6) && id.SrcPort == icmpV6EchoRequest:
+		return icmpEchoRequest
+	case id.TransportProtocol == uint8(transport.ICMP) && id.SrcPort == icmpEchoReply,
+		id.TransportProtocol == uint8(transport.ICMPV6) && id.SrcPort == icmpV6EchoReply:
+		return icmpEchoReply
+	}
+	return -1
+}
+
+func (em *echoMatcher) removeExpired() {
+	now := timeNow()
+	for k, req := range em.pending {
+		if now.After(req.expiry) {
+			delete(em.pending, k)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package flow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/beyla/pkg/internal/netolly/ebpf"
+	"github.com/grafana/beyla/pkg/internal/netolly/flow/transport"
+	"github.com/grafana/beyla/pkg/internal/testutil"
+)
+
+func icmpFlow(proto transport.Protocol, icmpType uint16, src, dst byte, start, end uint64) *ebpf.Record {
+	r := &ebpf.Record{NetFlowRecordT: ebpf.NetFlowRecordT{
+		Id: ebpf.NetFlowId{
+			TransportProtocol: uint8(proto),
+			SrcPort:           icmpType,
+		},
+		Metrics: ebpf.NetFlowMetrics{StartMonoTimeNs: start, EndMonoTimeNs: end},
+	}}
+	r.Id.SrcIp.In6U.U6Addr8[15] = src
+	r.Id.DstIp.In6U.U6Addr8[15] = dst
+	return r
+}
+
+func TestICMPEchoRTT(t *testing.T) {
+	input := make(chan []*ebpf.Record, 10)
+	output := make(chan []*ebpf.Record, 10)
+	rtt, err := ICMPEchoRTTProvider(&ICMPEchoRTT{Enable: true, MaxWait: time.Minute})
+	require.NoError(t, err)
+	go rtt(input, output)
+
+	// GIVEN ICMP and ICMPv6 Echo Requests from 1 to 2
+	input <- []*ebpf.Record{
+		icmpFlow(transport.ICMP, icmpEchoRequest, 1, 2, 1000, 5000),
+		icmpFlow(transport.ICMPV6, icmpV6EchoRequest, 1, 2, 2000, 6000),
+	}
+	for _, r := range testutil.ReadChannel(t, output, timeout) {
+		assert.Zero(t, r.Attrs.ICMPEchoRTT)
+	}
+
+	// WHEN the Echo Replies are received from 2 to 1
+	input <- []*ebpf.Record{
+		icmpFlow(transport.ICMP, icmpEchoReply, 2, 1, 1300, 5100),
+		icmpFlow(transport.ICMPV6, icmpV6EchoReply, 2, 1, 2500, 6500),
+		// replies that do not match any request must be ignored
+		icmpFlow(transport.ICMP, icmpEchoReply, 1, 2, 1300, 5100),
+		icmpFlow(transport.ICMP, icmpEchoReply, 3, 1, 1300, 5100),
+	}
+	// THEN the estimated RTT is set in the matching reply flows
+	out := testutil.ReadChannel(t, output, timeout)
+	require.Len(t, out, 4)
+	assert.Equal(t, 200*time.Nanosecond, out[0].Attrs.ICMPEchoRTT)
+	assert.Equal(t, 500*time.Nanosecond, out[1].Attrs.ICMPEchoRTT)
+	assert.Zero(t, out[2].Attrs.ICMPEchoRTT)
+	assert.Zero(t, out[3].Attrs.ICMPEchoRTT)
+
+	// AND the matched requests are forgotten
+	input <- []*ebpf.Record{icmpFlow(transport.ICMP, icmpEchoReply, 2, 1, 1300, 5100)}
+	out = testutil.ReadChannel(t, output, timeout)
+	assert.Zero(t, out[0].Attrs.ICMPEchoRTT)
+}
+
+func TestICMPEchoRTT_Expiry(t *testing.T) {
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	input := make(chan []*ebpf.Record, 10)
+	output := make(chan []*ebpf.Record, 10)
+	rtt, err := ICMPEchoRTTProvider(&ICMPEchoRTT{Enable: true, MaxWait: time.Minute})
+	require.NoError(t, err)
+	go rtt(input, output)
+
+	input <- []*ebpf.Record{icmpFlow(transport.ICMP, icmpEchoRequest, 1, 2, 1000, 5000)}
+	testutil.ReadChannel(t, output, timeout)
+
+	// WHEN the reply comes after the max wait time
+	now = now.Add(2 * time.Minute)
+	input <- []*ebpf.Record{icmpFlow(transport.ICMP, icmpEchoReply, 2, 1, 1300, 5100)}
+
+	// THEN the request has been forgotten and the RTT is not calculated
+	out := testutil.ReadChannel(t, output, timeout)
+	assert.Zero(t, out[0].Attrs.ICMPEchoRTT)
+}
@@ -27,9 +27,14 @@ import (
 	"github.com/gavv/monotime"
 	"github.com/mariomac/pipes/pipe"
 
+	"github.com/grafana/beyla/pkg/internal/health"
+	"github.com/grafana/beyla/pkg/internal/imetrics"
 	"github.com/grafana/beyla/pkg/internal/netolly/ebpf"
 )
 
+// mapTracerName labels the internal metrics of the MapTracer
+const mapTracerName = "network_flows_map"
+
 func mtlog() *slog.Logger {
 	return slog.With("component", "flow.MapTracer")
 }
@@ -42,18 +47,28 @@ type MapTracer struct {
 	// manages the access to the eviction routines, avoiding two evictions happening at the same time
 	evictionCond   *sync.Cond
 	lastEvictionNs uint64
+	// watchdog detects whether the pipeline is blocked while forwarding the evicted flows
+	watchdog *health.Watchdog
+	metrics  imetrics.Reporter
+	// stopped is closed after the last eviction, when the trace loop ends
+	stopped chan struct{}
 }
 
 type mapFetcher interface {
 	LookupAndDeleteMap() map[ebpf.NetFlowId][]ebpf.NetFlowMetrics
 }
 
-func NewMapTracer(fetcher mapFetcher, evictionTimeout time.Duration) *MapTracer {
+func NewMapTracer(
+	fetcher mapFetcher, evictionTimeout time.Duration, watchdog *health.Watchdog, metrics imetrics.Reporter,
+) *MapTracer {
 	return &MapTracer{
 		mapFetcher:      fetcher,
 		evictionTimeout: evictionTimeout,
 		lastEvictionNs:  uint64(monotime.Now()),
 		evictionCond:    sync.NewCond(&sync.Mutex{}),
+		watchdog:        watchdog,
+		metrics:         metrics,
+		stopped:         make(chan struct{}),
 	}
 }
 
@@ -63,8 +78,15 @@ func (m *MapTracer) Flush() {
 	m.evictionCond.Broadcast()
 }
 
+// Stopped is closed when the trace loop ends, after evicting the flows that were accumulated
+// in the eBPF map since the last eviction. The eBPF map must not be closed before.
+func (m *MapTracer) Stopped() <-chan struct{} {
+	return m.stopped
+}
+
 func (m *MapTracer) TraceLoop(ctx context.Context) pipe.StartFunc[[]*ebpf.Record] {
 	return func(out chan<- []*ebpf.Record) {
+		defer close(m.stopped)
 		evictionTicker := time.NewTicker(m.evictionTimeout)
 		go m.evictionSynchronization(ctx, out)
 		mtlog := mtlog()
@@ -72,7 +94,12 @@ func (m *MapTracer) TraceLoop(ctx context.Context) pipe.StartFunc[[]*ebpf.Record
 			select {
 			case <-ctx.Done():
 				evictionTicker.Stop()
-				mtlog.Debug("exiting trace loop due to context cancellation")
+				mtlog.Debug("exiting trace loop due to context cancellation. Evicting pending flows")
+				// forward the flows accumulated since the last eviction, so they are exported
+				// before Beyla stops
+				m.evictionCond.L.Lock()
+				m.evictFlows(out)
+				m.evictionCond.L.Unlock()
 				return
 			case <-evictionTicker.C:
 				mtlog.Debug("triggering flow eviction on timer")
@@ -95,18 +122,20 @@ func (m *MapTracer) evictionSynchronization(ctx context.Context, out chan<- []*e
 		m.evictionCond.Wait()
 		select {
 		case <-ctx.Done():
+			// the trace loop performs the last eviction
+			m.evictionCond.L.Unlock()
 			mtlog.Debug("context canceled. Stopping goroutine before evicting flows")
 			return
 		default:
 			mtlog.Debug("evictionSynchronization signal received")
-			m.evictFlows(ctx, out)
+			m.evictFlows(out)
 		}
 		m.evictionCond.L.Unlock()
 
 	}
 }
 
-func (m *MapTracer) evictFlows(ctx context.Context, forwardFlows chan<- []*ebpf.Record) {
+func (m *MapTracer) evictFlows(forwardFlows chan<- []*ebpf.Record) {
 	var forwardingFlows []*ebpf.Record
 	laterFlowNs := uint64(0)
 	for flowKey, flowMetrics := range m.mapFetcher.LookupAndDeleteMap() {
@@ -122,14 +151,11 @@ func (m *MapTracer) evictFlows(ctx context.Context, forwardFlows chan<- []*ebpf.
 		forwardingFlows = append(forwardingFlows, ebpf.NewRecord(flowKey, aggregatedMetrics))
 	}
 	m.lastEvictionNs = laterFlowNs
-	mtlog := mtlog()
-	select {
-	case <-ctx.Done():
-		mtlog.Debug("skipping flow eviction as agent is being stopped")
-	default:
-		forwardFlows <- forwardingFlows
-	}
-	mtlog.Debug("flows evicted", "len", len(forwardingFlows))
+	m.metrics.TracerEvents(mapTracerName, len(forwardingFlows))
+	m.watchdog.Enter()
+	forwardFlows <- forwardingFlows
+	m.watchdog.Exit()
+	mtlog().Debug("flows evicted", "len", len(forwardingFlows))
 }
 
 func (m *MapTracer) aggregate(metrics []ebpf.NetFlowMetrics) ebpf.NetFlowMetrics {
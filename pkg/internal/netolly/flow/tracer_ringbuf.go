@@ -31,9 +31,14 @@ import (
 	"github.com/cilium/ebpf/ringbuf"
 	"github.com/mariomac/pipes/pipe"
 
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+	"github.com/grafana/beyla/pkg/internal/memlimit"
 	"github.com/grafana/beyla/pkg/internal/netolly/ebpf"
 )
 
+// ringBufTracerName labels the internal metrics of the RingBufTracer
+const ringBufTracerName = "network_flows_ringbuf"
+
 func rtlog() *slog.Logger {
 	return slog.With("component", "flow.RingBufTracer")
 }
@@ -45,6 +50,9 @@ type RingBufTracer struct {
 	mapFlusher mapFlusher
 	ringBuffer ringBufReader
 	stats      stats
+	metrics    imetrics.Reporter
+	// under high memory pressure, the flows from the ring buffer are dropped
+	pressure *memlimit.Pressure
 }
 
 type ringBufReader interface {
@@ -65,11 +73,14 @@ type mapFlusher interface {
 
 func NewRingBufTracer(
 	reader ringBufReader, flusher mapFlusher, logTimeout time.Duration,
+	metrics imetrics.Reporter, pressure *memlimit.Pressure,
 ) *RingBufTracer {
 	return &RingBufTracer{
 		mapFlusher: flusher,
 		ringBuffer: reader,
 		stats:      stats{loggingTimeout: logTimeout},
+		metrics:    metrics,
+		pressure:   pressure,
 	}
 }
 
@@ -99,11 +110,16 @@ func (m *RingBufTracer) TraceLoop(ctx context.Context) pipe.StartFunc[[]*ebpf.Re
 func (m *RingBufTracer) listenAndForwardRingBuffer(debugging bool, forwardCh chan<- []*ebpf.Record) error {
 	event, err := m.ringBuffer.ReadRingBuf()
 	if err != nil {
+		if !errors.Is(err, ringbuf.ErrClosed) {
+			m.metrics.TracerDroppedEvent(ringBufTracerName, "read_error")
+		}
 		return fmt.Errorf("reading from ring buffer: %w", err)
 	}
+	m.metrics.TracerEvents(ringBufTracerName, 1)
 	// Parses the ringbuf event entry into an Event structure.
 	readFlow, err := ebpf.ReadFrom(bytes.NewBuffer(event.RawSample))
 	if err != nil {
+		m.metrics.TracerDroppedEvent(ringBufTracerName, "parse_error")
 		return fmt.Errorf("parsing data received from the ring buffer: %w", err)
 	}
 	mapFullError := readFlow.Metrics.Errno == uint8(syscall.E2BIG)
@@ -115,6 +131,11 @@ func (m *RingBufTracer) listenAndForwardRingBuffer(debugging bool, forwardCh cha
 	if mapFullError {
 		m.mapFlusher.Flush()
 	}
+	if m.pressure.High() {
+		m.metrics.TracerDroppedEvent(ringBufTracerName, "memory_pressure")
+		m.metrics.MemoryPressureAction("network_flows_ringbuf_drop")
+		return nil
+	}
 
 	forwardCh <- []*ebpf.Record{{
 		NetFlowRecordT: readFlow,
@@ -27,6 +27,7 @@ const (
 	GRE      = Protocol(47)
 	ESP      = Protocol(50)
 	AH       = Protocol(51)
+	ICMPV6   = Protocol(58)
 	MTP      = Protocol(92)
 	BEETPH   = Protocol(94)
 	ENCAP    = Protocol(98)
@@ -79,6 +80,8 @@ func (p Protocol) String() string {
 		return "ESP"
 	case AH:
 		return "AH"
+	case ICMPV6:
+		return "ICMPV6"
 	case MTP:
 		return "MTP"
 	case BEETPH:
@@ -140,6 +143,8 @@ func ParseProtocol(str string) (Protocol, error) {
 		return ESP, nil
 	case "AH":
 		return AH, nil
+	case "ICMPV6":
+		return ICMPV6, nil
 	case "MTP":
 		return MTP, nil
 	case "BEETPH":
@@ -23,8 +23,8 @@ import (
 	"fmt"
 	"log/slog"
 	"net"
-	"os"
-	"path"
+	"slices"
+	"strings"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
@@ -32,20 +32,19 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/tools/clientcmd"
 
+	"github.com/grafana/beyla/pkg/internal/kube"
 	"github.com/grafana/beyla/pkg/internal/netolly/transform/k8s/cni"
 )
 
 const (
-	kubeConfigEnvVariable = "KUBECONFIG"
-	defaultSyncTimeout    = 10 * time.Minute
-	IndexIP               = "byIP"
-	typeNode              = "Node"
-	typePod               = "Pod"
-	typeService           = "Service"
+	defaultResyncTime = 10 * time.Minute
+	IndexIP           = "byIP"
+	IndexContainerID  = "byContainerID"
+	typeNode          = "Node"
+	typePod           = "Pod"
+	typeService       = "Service"
 )
 
 // TODO: merge this data structure with the appo11y kubernetes informers
@@ -57,6 +56,16 @@ type NetworkInformers struct {
 	services cache.SharedIndexInformer
 	// replicaSets caches the ReplicaSets as partially-filled *ObjectMeta pointers
 	replicaSets cache.SharedIndexInformer
+	// ClusterName provides the name of the cluster, which is shared with the spans decoration.
+	// If nil, the name of the cluster is not reported.
+	ClusterName *kube.ClusterName
+	// ServiceCIDRs are the ranges of the Service cluster IPs, so the IPs of the Services that are not
+	// known are still classified as internal to the cluster. It must be set before the informers are initialized.
+	ServiceCIDRs []string
+	// cidrs classifies the IPs that are not known by the informers
+	cidrs *clusterCIDRs
+	// synced is closed when the caches of all the informers are synced
+	synced <-chan struct{}
 }
 
 type Owner struct {
@@ -76,7 +85,14 @@ type Info struct {
 	Owner    Owner
 	HostName string
 	HostIP   string
-	ips      []string
+	// Zone is the topology zone of the Node, or of the Node where the Pod is scheduled
+	Zone string
+	ips  []string
+	// podCIDRs are only stored for Nodes
+	podCIDRs []string
+	// containerIDs are only stored for Pods in the host network, as they
+	// can't be identified by their IP
+	containerIDs []string
 }
 
 var commonIndexers = map[string]cache.IndexFunc{
@@ -85,25 +101,71 @@ var commonIndexers = map[string]cache.IndexFunc{
 	},
 }
 
+var podIndexers = map[string]cache.IndexFunc{
+	IndexIP: commonIndexers[IndexIP],
+	IndexContainerID: func(obj interface{}) ([]string, error) {
+		return obj.(*Info).containerIDs, nil
+	},
+}
+
+// GetInfo returns the metadata of the Pod, Node or Service with the provided IP address.
+// IPv4, IPv6 and IPv4-mapped IPv6 addresses are accepted in any of their text representations.
 func (k *NetworkInformers) GetInfo(ip string) (*Info, bool) {
-	if info, ok := k.fetchInformers(ip); ok {
-		// Owner data might be discovered after the owned, so we fetch it
-		// at the last moment
-		if info.Owner.Name == "" {
-			info.Owner = k.getOwner(info)
-		}
-		return info, true
+	if info, ok := k.fetchInformers(kube.NormalizeIP(ip)); ok {
+		return k.withOwner(info), true
 	}
 
 	return nil, false
 }
 
+// GetInfoForContainer returns the metadata of the host-networked Pod that runs the
+// provided container.
+func (k *NetworkInformers) GetInfoForContainer(containerID string) (*Info, bool) {
+	objs, err := k.pods.GetIndexer().ByIndex(IndexContainerID, containerID)
+	if err != nil {
+		slog.Debug("error accessing index. Ignoring", "containerID", containerID, "error", err)
+		return nil, false
+	}
+	if len(objs) == 0 {
+		return nil, false
+	}
+	info := objs[0].(*Info)
+	if info.HostName == "" {
+		info.HostName = k.getHostName(info.HostIP)
+	}
+	if info.Zone == "" {
+		info.Zone = k.getZone(info.HostName)
+	}
+	return k.withOwner(info), true
+}
+
+// withOwner returns the info with its owner. Owner data might be discovered after the owned, so
+// it is fetched at the last moment, and stored in the info once it is resolved, so the following
+// flows don't look it up again. Until then, a copy of the info with the Pod as owner is returned.
+func (k *NetworkInformers) withOwner(info *Info) *Info {
+	if info.Owner.Name != "" {
+		return info
+	}
+	owner, resolved := k.getOwner(info)
+	if !resolved {
+		unresolved := *info
+		unresolved.Owner = owner
+		return &unresolved
+	}
+	info.Owner = owner
+	return info
+}
+
 func (k *NetworkInformers) fetchInformers(ip string) (*Info, bool) {
 	if info, ok := infoForIP(k.pods.GetIndexer(), ip); ok {
 		// it might happen that the Host is discovered after the Pod
 		if info.HostName == "" {
 			info.HostName = k.getHostName(info.HostIP)
 		}
+		// the Node might be observed after the Pod is scheduled on it
+		if info.Zone == "" {
+			info.Zone = k.getZone(info.HostName)
+		}
 		return info, true
 	}
 	if info, ok := infoForIP(k.nodes.GetIndexer(), ip); ok {
@@ -127,27 +189,31 @@ func infoForIP(idx cache.Indexer, ip string) (*Info, bool) {
 	return objs[0].(*Info), true
 }
 
-func (k *NetworkInformers) getOwner(info *Info) Owner {
+// getOwner returns the owner of the info, and false if it is owned by a ReplicaSet that the informer
+// has not received yet
+func (k *NetworkInformers) getOwner(info *Info) (Owner, bool) {
 	if len(info.OwnerReferences) != 0 {
 		ownerReference := info.OwnerReferences[0]
 		if ownerReference.Kind != "ReplicaSet" {
 			return Owner{
 				Name: ownerReference.Name,
 				Type: ownerReference.Kind,
-			}
+			}, true
 		}
 
 		item, ok, err := k.replicaSets.GetIndexer().GetByKey(info.Namespace + "/" + ownerReference.Name)
 		if err != nil {
 			slog.Debug("can't get ReplicaSet info from informer. Ignoring",
 				"key", info.Namespace+"/"+ownerReference.Name, "error", err)
-		} else if ok {
+		} else if !ok {
+			return Owner{Name: info.Name, Type: info.Type}, false
+		} else {
 			rsInfo := item.(*metav1.ObjectMeta)
 			if len(rsInfo.OwnerReferences) > 0 {
 				return Owner{
 					Name: rsInfo.OwnerReferences[0].Name,
 					Type: rsInfo.OwnerReferences[0].Kind,
-				}
+				}, true
 			}
 		}
 	}
@@ -155,7 +221,7 @@ func (k *NetworkInformers) getOwner(info *Info) Owner {
 	return Owner{
 		Name: info.Name,
 		Type: info.Type,
-	}
+	}, true
 }
 
 func (k *NetworkInformers) getHostName(hostIP string) string {
@@ -167,6 +233,23 @@ func (k *NetworkInformers) getHostName(hostIP string) string {
 	return ""
 }
 
+// getZone returns the topology zone of the Node with the provided name. The Nodes are
+// cluster-scoped, so their key in the informer's store is their name.
+func (k *NetworkInformers) getZone(nodeName string) string {
+	if nodeName == "" {
+		return ""
+	}
+	obj, ok, err := k.nodes.GetStore().GetByKey(nodeName)
+	if err != nil {
+		slog.Debug("can't get Node info from informer. Ignoring", "name", nodeName, "error", err)
+		return ""
+	}
+	if !ok {
+		return ""
+	}
+	return obj.(*Info).Zone
+}
+
 func (k *NetworkInformers) initNodeInformer(informerFactory informers.SharedInformerFactory) error {
 	nodes := informerFactory.Core().V1().Nodes().Informer()
 	// Transform any *v1.Node instance into a *Info instance to save space
@@ -183,22 +266,24 @@ func (k *NetworkInformers) initNodeInformer(informerFactory informers.SharedInfo
 		}
 		ips := make([]string, 0, len(node.Status.Addresses))
 		for _, address := range node.Status.Addresses {
-			ip := net.ParseIP(address.Address)
-			if ip != nil {
-				ips = append(ips, ip.String())
+			// the addresses can also be host names
+			if ip := kube.NormalizeIP(address.Address); net.ParseIP(ip) != nil {
+				ips = append(ips, ip)
 			}
 		}
 		// CNI-dependent logic (must work regardless of whether the CNI is installed)
 		ips = cni.AddOvnIPs(ips, node)
+		zone, _ := kube.NodeTopology(node.Labels)
 
 		return &Info{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      node.Name,
 				Namespace: node.Namespace,
-				Labels:    node.Labels,
 			},
-			ips:  ips,
-			Type: typeNode,
+			ips:      ips,
+			Type:     typeNode,
+			Zone:     zone,
+			podCIDRs: nodePodCIDRs(node),
 		}, nil
 	}); err != nil {
 		return fmt.Errorf("can't set nodes transform: %w", err)
@@ -206,10 +291,28 @@ func (k *NetworkInformers) initNodeInformer(informerFactory informers.SharedInfo
 	if err := nodes.AddIndexers(commonIndexers); err != nil {
 		return fmt.Errorf("can't add %s indexer to Nodes informer: %w", IndexIP, err)
 	}
+	if _, err := nodes.AddEventHandler(k.cidrs.nodeCIDRsHandler()); err != nil {
+		return fmt.Errorf("can't add Pod CIDRs handler to Nodes informer: %w", err)
+	}
 	k.nodes = nodes
 	return nil
 }
 
+// nodePodCIDRs returns the valid Pod CIDRs of the Node. Older clusters only set the PodCIDR field.
+func nodePodCIDRs(node *v1.Node) []string {
+	cidrs := node.Spec.PodCIDRs
+	if len(cidrs) == 0 && node.Spec.PodCIDR != "" {
+		cidrs = []string{node.Spec.PodCIDR}
+	}
+	valid := make([]string, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if _, _, err := net.ParseCIDR(cidr); err == nil {
+			valid = append(valid, cidr)
+		}
+	}
+	return valid
+}
+
 func (k *NetworkInformers) initPodInformer(informerFactory informers.SharedInformerFactory) error {
 	pods := informerFactory.Core().V1().Pods().Informer()
 	// Transform any *v1.Pod instance into a *Info instance to save space
@@ -225,34 +328,78 @@ func (k *NetworkInformers) initPodInformer(informerFactory informers.SharedInfor
 			return nil, fmt.Errorf("was expecting a Pod. Got: %T", i)
 		}
 		ips := make([]string, 0, len(pod.Status.PodIPs))
+		hostIP := kube.NormalizeIP(pod.Status.HostIP)
 		for _, ip := range pod.Status.PodIPs {
 			// ignoring host-networked Pod IPs
-			if ip.IP != pod.Status.HostIP {
-				ips = append(ips, ip.IP)
+			if podIP := kube.NormalizeIP(ip.IP); podIP != hostIP {
+				ips = append(ips, podIP)
 			}
 		}
+		var containerIDs []string
+		if pod.Spec.HostNetwork {
+			containerIDs = podContainerIDs(pod)
+		}
 		return &Info{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:            pod.Name,
 				Namespace:       pod.Namespace,
-				Labels:          pod.Labels,
-				OwnerReferences: pod.OwnerReferences,
+				OwnerReferences: firstOwner(pod.OwnerReferences),
 			},
-			Type:   typePod,
-			HostIP: pod.Status.HostIP,
-			ips:    ips,
+			Type:         typePod,
+			HostName:     pod.Spec.NodeName,
+			HostIP:       hostIP,
+			ips:          ips,
+			containerIDs: containerIDs,
 		}, nil
 	}); err != nil {
 		return fmt.Errorf("can't set pods transform: %w", err)
 	}
-	if err := pods.AddIndexers(commonIndexers); err != nil {
-		return fmt.Errorf("can't add %s indexer to Pods informer: %w", IndexIP, err)
+	if err := pods.AddIndexers(podIndexers); err != nil {
+		return fmt.Errorf("can't add indexers to Pods informer: %w", err)
 	}
 
 	k.pods = pods
 	return nil
 }
 
+// firstOwner returns the kind and name of the first owner, which are the only owner fields
+// that are used to decorate the flows
+func firstOwner(refs []metav1.OwnerReference) []metav1.OwnerReference {
+	if len(refs) == 0 {
+		return nil
+	}
+	return []metav1.OwnerReference{{Kind: refs[0].Kind, Name: refs[0].Name}}
+}
+
+func podContainerIDs(pod *v1.Pod) []string {
+	containerIDs := make([]string, 0,
+		len(pod.Status.ContainerStatuses)+
+			len(pod.Status.InitContainerStatuses)+
+			len(pod.Status.EphemeralContainerStatuses))
+	for i := range pod.Status.ContainerStatuses {
+		containerIDs = append(containerIDs,
+			rmContainerIDSchema(pod.Status.ContainerStatuses[i].ContainerID))
+	}
+	for i := range pod.Status.InitContainerStatuses {
+		containerIDs = append(containerIDs,
+			rmContainerIDSchema(pod.Status.InitContainerStatuses[i].ContainerID))
+	}
+	for i := range pod.Status.EphemeralContainerStatuses {
+		containerIDs = append(containerIDs,
+			rmContainerIDSchema(pod.Status.EphemeralContainerStatuses[i].ContainerID))
+	}
+	return containerIDs
+}
+
+// rmContainerIDSchema extracts the hex ID of a container ID that is provided in the form:
+// containerd://40c03570b6f4c30bc8d69923d37ee698f5cfcced92c7b7df1c47f6f7887378a9
+func rmContainerIDSchema(containerID string) string {
+	if parts := strings.Split(containerID, "://"); len(parts) > 1 {
+		return parts[1]
+	}
+	return containerID
+}
+
 func (k *NetworkInformers) initServiceInformer(informerFactory informers.SharedInformerFactory) error {
 	services := informerFactory.Core().V1().Services().Informer()
 	// Transform any *v1.Service instance into a *Info instance to save space
@@ -267,7 +414,8 @@ func (k *NetworkInformers) initServiceInformer(informerFactory informers.SharedI
 			}
 			return nil, fmt.Errorf("was expecting a Service. Got: %T", i)
 		}
-		if svc.Spec.ClusterIP == v1.ClusterIPNone {
+		ips := serviceIPs(svc)
+		if svc.Spec.ClusterIP == v1.ClusterIPNone && len(ips) == 0 {
 			k.log.Warn("Service doesn't have any ClusterIP. Beyla won't decorate their flows",
 				"namespace", svc.Namespace, "name", svc.Name)
 		}
@@ -275,10 +423,9 @@ func (k *NetworkInformers) initServiceInformer(informerFactory informers.SharedI
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      svc.Name,
 				Namespace: svc.Namespace,
-				Labels:    svc.Labels,
 			},
 			Type: typeService,
-			ips:  svc.Spec.ClusterIPs,
+			ips:  ips,
 		}, nil
 	}); err != nil {
 		return fmt.Errorf("can't set services transform: %w", err)
@@ -291,6 +438,29 @@ func (k *NetworkInformers) initServiceInformer(informerFactory informers.SharedI
 	return nil
 }
 
+// serviceIPs returns the cluster IPs, the external IPs and the load balancer ingress IPs of a Service.
+// The ingress IPs are only known after the cloud provider provisions the load balancer, but the informer
+// reindexes the Service on each update. The ingress entries that only have a host name are ignored.
+func serviceIPs(svc *v1.Service) []string {
+	ips := make([]string, 0, len(svc.Spec.ClusterIPs)+len(svc.Spec.ExternalIPs)+len(svc.Status.LoadBalancer.Ingress))
+	add := func(ip string) {
+		// headless Services have a "None" cluster IP
+		if ip = kube.NormalizeIP(ip); net.ParseIP(ip) != nil && !slices.Contains(ips, ip) {
+			ips = append(ips, ip)
+		}
+	}
+	for _, ip := range svc.Spec.ClusterIPs {
+		add(ip)
+	}
+	for _, ip := range svc.Spec.ExternalIPs {
+		add(ip)
+	}
+	for i := range svc.Status.LoadBalancer.Ingress {
+		add(svc.Status.LoadBalancer.Ingress[i].IP)
+	}
+	return ips
+}
+
 func (k *NetworkInformers) initReplicaSetInformer(informerFactory informers.SharedInformerFactory) error {
 	k.replicaSets = informerFactory.Apps().V1().ReplicaSets().Informer()
 	// To save space, instead of storing a complete *appvs1.Replicaset instance, the
@@ -308,7 +478,7 @@ func (k *NetworkInformers) initReplicaSetInformer(informerFactory informers.Shar
 		return &metav1.ObjectMeta{
 			Name:            rs.Name,
 			Namespace:       rs.Namespace,
-			OwnerReferences: rs.OwnerReferences,
+			OwnerReferences: firstOwner(rs.OwnerReferences),
 		}, nil
 	}); err != nil {
 		return fmt.Errorf("can't set ReplicaSets transform: %w", err)
@@ -316,10 +486,16 @@ func (k *NetworkInformers) initReplicaSetInformer(informerFactory informers.Shar
 	return nil
 }
 
-func (k *NetworkInformers) InitFromConfig(ctx context.Context, kubeConfigPath string, syncTimeout time.Duration) error {
+// Synced returns an error if the informers are not synchronized with the Kubernetes API.
+// It can be used as a readiness health check.
+func (k *NetworkInformers) Synced(_ context.Context) error {
+	return kube.InformersSynced(k.nodes, k.pods, k.services, k.replicaSets)
+}
+
+func (k *NetworkInformers) InitFromConfig(ctx context.Context, clientCfg kube.ClientConfig, syncTimeout time.Duration) error {
 	k.log = slog.With("component", "kubernetes.NetworkInformers")
 	// Initialization variables
-	config, err := LoadConfig(kubeConfigPath)
+	config, err := clientCfg.Load()
 	if err != nil {
 		return err
 	}
@@ -337,39 +513,18 @@ func (k *NetworkInformers) InitFromConfig(ctx context.Context, kubeConfigPath st
 	return nil
 }
 
-func LoadConfig(kubeConfigPath string) (*rest.Config, error) {
-	// if no config path is provided, load it from the env variable
-	if kubeConfigPath == "" {
-		kubeConfigPath = os.Getenv(kubeConfigEnvVariable)
-	}
-	// otherwise, load it from the $HOME/.kube/config file
-	if kubeConfigPath == "" {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return nil, fmt.Errorf("can't get user home dir: %w", err)
-		}
-		kubeConfigPath = path.Join(homeDir, ".kube", "config")
-	}
-	config, err := clientcmd.BuildConfigFromFlags("", kubeConfigPath)
-	if err == nil {
-		return config, nil
-	}
-	// fallback: use in-cluster config
-	config, err = rest.InClusterConfig()
-	if err != nil {
-		return nil, fmt.Errorf("can't access kubenetes. Tried using config from: "+
-			"config parameter, %s env, homedir and InClusterConfig. Got: %w",
-			kubeConfigEnvVariable, err)
-	}
-	return config, nil
+// GetClusterName returns the name of the cluster, or an empty string if it is not resolved yet
+func (k *NetworkInformers) GetClusterName() string {
+	return k.ClusterName.Get()
 }
 
 func (k *NetworkInformers) initInformers(ctx context.Context, client kubernetes.Interface, syncTimeout time.Duration) error {
-	if syncTimeout <= 0 {
-		syncTimeout = defaultSyncTimeout
+	var err error
+	if k.cidrs, err = newClusterCIDRs(k.ServiceCIDRs); err != nil {
+		return err
 	}
-	informerFactory := informers.NewSharedInformerFactory(client, syncTimeout)
-	err := k.initNodeInformer(informerFactory)
+	informerFactory := informers.NewSharedInformerFactory(client, defaultResyncTime)
+	err = k.initNodeInformer(informerFactory)
 	if err != nil {
 		return err
 	}
@@ -386,10 +541,15 @@ func (k *NetworkInformers) initInformers(ctx context.Context, client kubernetes.
 		return err
 	}
 
-	slog.Debug("starting kubernetes informers, waiting for syncronization")
-	informerFactory.Start(ctx.Done())
-	informerFactory.WaitForCacheSync(ctx.Done())
-	slog.Debug("kubernetes informers started")
-
+	log := slog.With("component", "kubernetes.NetworkInformers")
+	log.Debug("starting kubernetes informers, waiting for syncronization")
+	k.synced = kube.StartFactories(ctx, informerFactory)
+	kube.AwaitCacheSync(ctx, log, k.WaitForCacheSync, syncTimeout)
 	return nil
 }
+
+// WaitForCacheSync blocks until the caches of all the informers are synced, or returns an
+// error if the context is done before
+func (k *NetworkInformers) WaitForCacheSync(ctx context.Context) error {
+	return kube.WaitForSync(ctx, k.synced)
+}
@@ -22,13 +22,17 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"strconv"
 	"time"
 
 	"github.com/hashicorp/golang-lru/v2/simplelru"
 	"github.com/mariomac/pipes/pipe"
 
 	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
+	"github.com/grafana/beyla/pkg/internal/helpers/container"
+	"github.com/grafana/beyla/pkg/internal/kube"
 	"github.com/grafana/beyla/pkg/internal/netolly/ebpf"
+	"github.com/grafana/beyla/pkg/internal/pipe/global"
 	"github.com/grafana/beyla/pkg/transform"
 )
 
@@ -42,25 +46,39 @@ const (
 	attrSuffixOwnerType = ".owner.type"
 	attrSuffixHostIP    = ".node.ip"
 	attrSuffixHostName  = ".node.name"
+	attrSuffixZone      = ".zone"
 )
 
 const alreadyLoggedIPsCacheLen = 256
-const (
-	clusterMetadataRetries       = 5
-	clusterMetadataFailRetryTime = 500 * time.Millisecond
+const containerIDsCacheLen = 1024
+
+// containerIDsCheckPeriod is the time after which the start time of a cached process is checked
+// again, to detect whether its PID has been reused by another process
+const containerIDsCheckPeriod = 30 * time.Second
+
+// injectable functions for testing
+var (
+	containerInfoForPID = container.InfoForPID
+	processStartTime    = container.StartTime
+	timeNow             = time.Now
 )
 
 func log() *slog.Logger { return slog.With("component", "k8s.MetadataDecorator") }
 
-func MetadataDecoratorProvider(ctx context.Context, cfg *transform.KubernetesDecorator) (pipe.MiddleFunc[[]*ebpf.Record, []*ebpf.Record], error) {
+func MetadataDecoratorProvider(
+	ctx context.Context,
+	ctxInfo *global.ContextInfo,
+	cfg *transform.KubernetesDecorator,
+) (pipe.MiddleFunc[[]*ebpf.Record, []*ebpf.Record], error) {
 	if !cfg.Enabled() {
 		// This node is not going to be instantiated. Let the pipes library just bypassing it.
 		return pipe.Bypass[[]*ebpf.Record](), nil
 	}
-	nt, err := newDecorator(ctx, cfg)
+	nt, err := newDecorator(ctx, cfg, ctxInfo.K8sClusterName)
 	if err != nil {
 		return nil, fmt.Errorf("instantiating network transformer: %w", err)
 	}
+	ctxInfo.Health.Readiness("neto11y.kubernetes", nt.kube.Synced)
 	var decorate func([]*ebpf.Record) []*ebpf.Record
 	if cfg.DropExternal {
 		log().Debug("will drop external flows")
@@ -81,7 +99,11 @@ type decorator struct {
 	log              *slog.Logger
 	alreadyLoggedIPs *simplelru.LRU[string, struct{}]
 	kube             NetworkInformers
-	clusterName      string
+	// caches the container ID of each local process, by PID
+	containerIDs *simplelru.LRU[uint32, processContainer]
+	// ownerNames replaces the names of the Pods by the names of their owners, so the flows of all the
+	// Pods of a workload are aggregated
+	ownerNames bool
 }
 
 func (n *decorator) decorateNoDrop(flows []*ebpf.Record) []*ebpf.Record {
@@ -105,17 +127,36 @@ func (n *decorator) transform(flow *ebpf.Record) bool {
 	if flow.Attrs.Metadata == nil {
 		flow.Attrs.Metadata = map[attr.Name]string{}
 	}
-	if n.clusterName != "" {
-		flow.Attrs.Metadata[(attr.K8sClusterName)] = n.clusterName
+	// the cluster name might not be resolved yet if it took longer than the informers sync timeout
+	if clusterName := n.kube.GetClusterName(); clusterName != "" {
+		flow.Attrs.Metadata[attr.K8sClusterName] = clusterName
+	}
+	srcIP, dstIP := flow.Id.SrcIP().IP().String(), flow.Id.DstIP().IP().String()
+	srcOk := n.decorate(flow, attrPrefixSrc, srcIP, flow.Attrs.SrcPID)
+	dstOk := n.decorate(flow, attrPrefixDst, dstIP, flow.Attrs.DstPID)
+	// the endpoints that are not known by the informers might still be in the ranges of the cluster
+	if !srcOk {
+		flow.Attrs.Metadata[attr.SrcScope] = n.kube.cidrScope(srcIP)
+	}
+	if !dstOk {
+		flow.Attrs.Metadata[attr.DstScope] = n.kube.cidrScope(dstIP)
+	}
+	// the traffic across zones is only known if both zones are known
+	srcZone, dstZone := flow.Attrs.Metadata[attr.K8sSrcZone], flow.Attrs.Metadata[attr.K8sDstZone]
+	if srcZone != "" && dstZone != "" {
+		flow.Attrs.Metadata[attr.K8sCrossZone] = strconv.FormatBool(srcZone != dstZone)
 	}
-	srcOk := n.decorate(flow, attrPrefixSrc, flow.Id.SrcIP().IP().String())
-	dstOk := n.decorate(flow, attrPrefixDst, flow.Id.DstIP().IP().String())
 	return srcOk && dstOk
 }
 
-// decorate the flow with Kube metadata. Returns false if there is no metadata found for such IP
-func (n *decorator) decorate(flow *ebpf.Record, prefix, ip string) bool {
-	kubeInfo, ok := n.kube.GetInfo(ip)
+// decorate the flow with Kube metadata. Returns false if there is no metadata found for such IP.
+// If the endpoint belongs to a local process, the PID is used to look for a host-networked Pod,
+// as they share the IP with the Node and other host-networked Pods.
+func (n *decorator) decorate(flow *ebpf.Record, prefix, ip string, pid uint32) bool {
+	kubeInfo, ok := n.hostNetworkPod(pid)
+	if !ok {
+		kubeInfo, ok = n.kube.GetInfo(ip)
+	}
 	if !ok {
 		if n.log.Enabled(context.TODO(), slog.LevelDebug) {
 			// avoid spoofing the debug logs with the same message for each flow whose IP can't be decorated
@@ -126,8 +167,18 @@ func (n *decorator) decorate(flow *ebpf.Record, prefix, ip string) bool {
 		}
 		return false
 	}
+	name := kubeInfo.Name
+	if n.ownerNames && kubeInfo.Type == typePod {
+		name = kubeInfo.Owner.Name
+	} else {
+		flow.Attrs.Metadata[attr.Name(prefix+attrSuffixName)] = kubeInfo.Name
+	}
 	flow.Attrs.Metadata[attr.Name(prefix+attrSuffixNs)] = kubeInfo.Namespace
-	flow.Attrs.Metadata[attr.Name(prefix+attrSuffixName)] = kubeInfo.Name
+	if prefix == attrPrefixDst {
+		flow.Attrs.Metadata[attr.DstScope] = infoScope(kubeInfo)
+	} else {
+		flow.Attrs.Metadata[attr.SrcScope] = infoScope(kubeInfo)
+	}
 	flow.Attrs.Metadata[attr.Name(prefix+attrSuffixType)] = kubeInfo.Type
 	flow.Attrs.Metadata[attr.Name(prefix+attrSuffixOwnerName)] = kubeInfo.Owner.Name
 	flow.Attrs.Metadata[attr.Name(prefix+attrSuffixOwnerType)] = kubeInfo.Owner.Type
@@ -137,61 +188,84 @@ func (n *decorator) decorate(flow *ebpf.Record, prefix, ip string) bool {
 			flow.Attrs.Metadata[attr.Name(prefix+attrSuffixHostName)] = kubeInfo.HostName
 		}
 	}
+	if kubeInfo.Zone != "" {
+		flow.Attrs.Metadata[attr.Name(prefix+attrSuffixZone)] = kubeInfo.Zone
+	}
 	// decorate other names from metadata, if required
 	if prefix == attrPrefixDst {
 		if flow.Attrs.DstName == "" {
-			flow.Attrs.DstName = kubeInfo.Name
+			flow.Attrs.DstName = name
 		}
 	} else {
 		if flow.Attrs.SrcName == "" {
-			flow.Attrs.SrcName = kubeInfo.Name
+			flow.Attrs.SrcName = name
 		}
 	}
 	return true
 }
 
+// processContainer is the cached container of a process. As the PID of a dead process
+// can be reused by a new process, the start time identifies the process that owned the PID.
+type processContainer struct {
+	start uint64
+	// containerID is empty if the process is not in a container
+	containerID string
+	checked     time.Time
+}
+
+func (n *decorator) hostNetworkPod(pid uint32) (*Info, bool) {
+	if pid == 0 {
+		return nil, false
+	}
+	pc, ok := n.containerIDs.Get(pid)
+	// the /proc filesystem is only read for unknown processes, or periodically
+	// to check that the PID still belongs to the cached process
+	if now := timeNow(); !ok || now.Sub(pc.checked) > containerIDsCheckPeriod {
+		start, err := processStartTime(pid)
+		if err != nil {
+			// the process has finished
+			n.containerIDs.Remove(pid)
+			return nil, false
+		}
+		if !ok || start != pc.start {
+			pc = processContainer{start: start}
+			if info, err := containerInfoForPID(pid); err == nil {
+				pc.containerID = info.ContainerID
+			}
+		}
+		pc.checked = now
+		n.containerIDs.Add(pid, pc)
+	}
+	if pc.containerID == "" {
+		return nil, false
+	}
+	return n.kube.GetInfoForContainer(pc.containerID)
+}
+
 // newDecorator create a new transform
-func newDecorator(ctx context.Context, cfg *transform.KubernetesDecorator) (*decorator, error) {
+func newDecorator(
+	ctx context.Context, cfg *transform.KubernetesDecorator, clusterName *kube.ClusterName,
+) (*decorator, error) {
 	nt := decorator{
-		log:         log(),
-		clusterName: kubeClusterName(ctx, cfg),
+		log:        log(),
+		kube:       NetworkInformers{ClusterName: clusterName, ServiceCIDRs: cfg.ServiceCIDRs},
+		ownerNames: cfg.NetworkOwnerNames,
+	}
+	var err error
+	if nt.containerIDs, err = simplelru.NewLRU[uint32, processContainer](containerIDsCacheLen, nil); err != nil {
+		return nil, fmt.Errorf("instantiating container IDs cache: %w", err)
 	}
 	if nt.log.Enabled(ctx, slog.LevelDebug) {
-		var err error
 		nt.alreadyLoggedIPs, err = simplelru.NewLRU[string, struct{}](alreadyLoggedIPsCacheLen, nil)
 		if err != nil {
 			return nil, fmt.Errorf("instantiating debug notified error cache: %w", err)
 		}
 	}
 
-	if err := nt.kube.InitFromConfig(ctx, cfg.KubeconfigPath, cfg.InformersSyncTimeout); err != nil {
+	if err := nt.kube.InitFromConfig(ctx, cfg.ClientConfig(), cfg.InformersSyncTimeout); err != nil {
 		return nil, err
 	}
+	// the cluster name is awaited, so the first flows already report it
+	clusterName.Wait(ctx, cfg.InformersSyncTimeout)
 	return &nt, nil
 }
-
-func kubeClusterName(ctx context.Context, cfg *transform.KubernetesDecorator) string {
-	log := log().With("func", "kubeClusterName")
-	if cfg.ClusterName != "" {
-		return cfg.ClusterName
-	}
-	retries := 0
-	for retries < clusterMetadataRetries {
-		if clusterName := fetchClusterName(ctx); clusterName != "" {
-			return clusterName
-		}
-		retries++
-		log.Debug("retrying cluster name fetching in 500 ms...")
-		select {
-		case <-ctx.Done():
-			log.Debug("context canceled before starting the kubernetes decorator node")
-			return ""
-		case <-time.After(clusterMetadataFailRetryTime):
-			// retry or end!
-		}
-	}
-	log.Warn("can't fetch Kubernetes Cluster Name." +
-		" Network metrics won't contain k8s.cluster.name attribute unless you explicitly set " +
-		" the BEYLA_KUBE_CLUSTER_NAME environment variable")
-	return ""
-}
@@ -0,0 +1,530 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
+	"github.com/grafana/beyla/pkg/internal/helpers/container"
+	"github.com/grafana/beyla/pkg/internal/kube"
+	"github.com/grafana/beyla/pkg/internal/netolly/ebpf"
+	appkube "github.com/grafana/beyla/pkg/internal/transform/kube"
+)
+
+const nodeIP = "10.0.0.1"
+
+func hostNetworkPod(name, owner, containerID string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name, Namespace: "kube-system",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "DaemonSet", Name: owner}},
+		},
+		Spec: v1.PodSpec{HostNetwork: true, NodeName: "node-1"},
+		Status: v1.PodStatus{
+			HostIP:            nodeIP,
+			PodIPs:            []v1.PodIP{{IP: nodeIP}},
+			ContainerStatuses: []v1.ContainerStatus{{ContainerID: "containerd://" + containerID}},
+		},
+	}
+}
+
+func TestDecorate_HostNetworkPods(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Address: nodeIP}}},
+		},
+		hostNetworkPod("node-exporter-abcde", "node-exporter", "aaaa"),
+		hostNetworkPod("kube-proxy-fghij", "kube-proxy", "bbbb"),
+	)
+	containerInfoForPID = func(pid uint32) (container.Info, error) {
+		switch pid {
+		case 100:
+			return container.Info{ContainerID: "aaaa"}, nil
+		case 200:
+			return container.Info{ContainerID: "bbbb"}, nil
+		}
+		return container.Info{}, errors.New("not in a container")
+	}
+	processStartTime = func(pid uint32) (uint64, error) {
+		return 1, nil
+	}
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() {
+		containerInfoForPID, processStartTime, timeNow = container.InfoForPID, container.StartTime, time.Now
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dec := decorator{log: slog.With("test", t.Name())}
+	var err error
+	dec.containerIDs, err = simplelru.NewLRU[uint32, processContainer](containerIDsCacheLen, nil)
+	require.NoError(t, err)
+	require.NoError(t, dec.kube.initInformers(ctx, client, 0))
+
+	// GIVEN a flow between two host-networked Pods in the same Node
+	flow := &ebpf.Record{}
+	flow.Id.SrcIp.In6U.U6Addr8 = ebpf.IPAddr{10: 0xff, 11: 0xff, 12: 10, 15: 1}
+	flow.Id.DstIp.In6U.U6Addr8 = ebpf.IPAddr{10: 0xff, 11: 0xff, 12: 10, 15: 1}
+	flow.Attrs.SrcPID = 200
+	flow.Attrs.DstPID = 100
+
+	// WHEN it is decorated
+	require.True(t, dec.transform(flow))
+
+	// THEN each endpoint is attributed to the Pod owning its socket
+	md := flow.Attrs.Metadata
+	assert.Equal(t, "kube-proxy-fghij", md[attr.Name(attrPrefixSrc+attrSuffixName)])
+	assert.Equal(t, "Pod", md[attr.Name(attrPrefixSrc+attrSuffixType)])
+	assert.Equal(t, "kube-proxy", md[attr.Name(attrPrefixSrc+attrSuffixOwnerName)])
+	assert.Equal(t, "DaemonSet", md[attr.Name(attrPrefixSrc+attrSuffixOwnerType)])
+	assert.Equal(t, "node-1", md[attr.Name(attrPrefixSrc+attrSuffixHostName)])
+	assert.Equal(t, "node-exporter-abcde", md[attr.Name(attrPrefixDst+attrSuffixName)])
+	assert.Equal(t, "node-exporter", md[attr.Name(attrPrefixDst+attrSuffixOwnerName)])
+
+	// AND processes that don't belong to any Pod are attributed to the Node
+	flow = &ebpf.Record{}
+	flow.Id.SrcIp.In6U.U6Addr8 = ebpf.IPAddr{10: 0xff, 11: 0xff, 12: 10, 15: 1}
+	flow.Id.DstIp.In6U.U6Addr8 = ebpf.IPAddr{10: 0xff, 11: 0xff, 12: 10, 15: 1}
+	flow.Attrs.SrcPID = 300
+	require.True(t, dec.transform(flow))
+	assert.Equal(t, "node-1", flow.Attrs.Metadata[attr.Name(attrPrefixSrc+attrSuffixName)])
+	assert.Equal(t, "Node", flow.Attrs.Metadata[attr.Name(attrPrefixSrc+attrSuffixType)])
+	assert.Equal(t, "node-1", flow.Attrs.Metadata[attr.Name(attrPrefixDst+attrSuffixName)])
+
+	// AND when the PID of a finished process is reused by another process
+	containerInfoForPID = func(pid uint32) (container.Info, error) {
+		if pid == 100 {
+			return container.Info{ContainerID: "bbbb"}, nil
+		}
+		return container.Info{}, errors.New("not in a container")
+	}
+	processStartTime = func(pid uint32) (uint64, error) {
+		return 2, nil
+	}
+	flow = &ebpf.Record{}
+	flow.Id.SrcIp.In6U.U6Addr8 = ebpf.IPAddr{10: 0xff, 11: 0xff, 12: 10, 15: 1}
+	flow.Id.DstIp.In6U.U6Addr8 = ebpf.IPAddr{10: 0xff, 11: 0xff, 12: 10, 15: 1}
+	flow.Attrs.SrcPID = 100
+	require.True(t, dec.transform(flow))
+	// THEN the cached container is used until the process is checked again
+	assert.Equal(t, "node-exporter-abcde", flow.Attrs.Metadata[attr.Name(attrPrefixSrc+attrSuffixName)])
+
+	now = now.Add(2 * containerIDsCheckPeriod)
+	flow = &ebpf.Record{}
+	flow.Id.SrcIp.In6U.U6Addr8 = ebpf.IPAddr{10: 0xff, 11: 0xff, 12: 10, 15: 1}
+	flow.Id.DstIp.In6U.U6Addr8 = ebpf.IPAddr{10: 0xff, 11: 0xff, 12: 10, 15: 1}
+	flow.Attrs.SrcPID = 100
+	require.True(t, dec.transform(flow))
+	// AND then the flow is attributed to the Pod of the new process
+	assert.Equal(t, "kube-proxy-fghij", flow.Attrs.Metadata[attr.Name(attrPrefixSrc+attrSuffixName)])
+
+	// AND the flows of processes that have finished are attributed to the Node
+	processStartTime = func(pid uint32) (uint64, error) {
+		return 0, errors.New("no such process")
+	}
+	now = now.Add(2 * containerIDsCheckPeriod)
+	flow = &ebpf.Record{}
+	flow.Id.SrcIp.In6U.U6Addr8 = ebpf.IPAddr{10: 0xff, 11: 0xff, 12: 10, 15: 1}
+	flow.Id.DstIp.In6U.U6Addr8 = ebpf.IPAddr{10: 0xff, 11: 0xff, 12: 10, 15: 1}
+	flow.Attrs.SrcPID = 100
+	require.True(t, dec.transform(flow))
+	assert.Equal(t, "Node", flow.Attrs.Metadata[attr.Name(attrPrefixSrc+attrSuffixType)])
+}
+
+func TestDecorate_DualStack(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "client", Namespace: "default"},
+			Status: v1.PodStatus{
+				HostIP: nodeIP,
+				// IPv6 addresses are not always reported in their canonical form
+				PodIPs: []v1.PodIP{{IP: "10.244.0.5"}, {IP: "fd00:10:244:0:0:0:0:5"}},
+			},
+		},
+		&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "server", Namespace: "default"},
+			Spec:       v1.ServiceSpec{ClusterIPs: []string{"10.96.0.10", "FD00:10:96::A"}},
+		},
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dec := decorator{log: slog.With("test", t.Name())}
+	var err error
+	dec.containerIDs, err = simplelru.NewLRU[uint32, processContainer](containerIDsCacheLen, nil)
+	require.NoError(t, err)
+	require.NoError(t, dec.kube.initInformers(ctx, client, 0))
+
+	for _, tc := range []struct{ name, src, dst string }{
+		{name: "IPv4", src: "10.244.0.5", dst: "10.96.0.10"},
+		{name: "IPv6", src: "fd00:10:244::5", dst: "fd00:10:96::a"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			flow := &ebpf.Record{}
+			flow.Id.SrcIp.In6U.U6Addr8 = ebpf.IPAddr(net.ParseIP(tc.src).To16())
+			flow.Id.DstIp.In6U.U6Addr8 = ebpf.IPAddr(net.ParseIP(tc.dst).To16())
+
+			require.True(t, dec.transform(flow))
+			assert.Equal(t, "client", flow.Attrs.Metadata[attr.Name(attrPrefixSrc+attrSuffixName)])
+			assert.Equal(t, "Pod", flow.Attrs.Metadata[attr.Name(attrPrefixSrc+attrSuffixType)])
+			assert.Equal(t, "server", flow.Attrs.Metadata[attr.Name(attrPrefixDst+attrSuffixName)])
+			assert.Equal(t, "Service", flow.Attrs.Metadata[attr.Name(attrPrefixDst+attrSuffixType)])
+		})
+	}
+}
+
+func TestGetInfo_NonCanonicalIPs(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status: v1.NodeStatus{Addresses: []v1.NodeAddress{
+				{Type: v1.NodeInternalIP, Address: "::ffff:10.0.0.1"},
+				{Type: v1.NodeInternalIP, Address: "FD00:0:0::1"},
+				{Type: v1.NodeHostName, Address: "node-1"},
+			}},
+		},
+		&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "client", Namespace: "default"},
+			Spec:       v1.PodSpec{NodeName: "node-1"},
+			Status: v1.PodStatus{
+				HostIP: "10.0.0.1",
+				PodIPs: []v1.PodIP{{IP: "10.244.0.5"}, {IP: "FD00:10:244:0:0:0:0:5"}},
+			},
+		},
+		&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "server", Namespace: "default"},
+			Spec:       v1.ServiceSpec{ClusterIPs: []string{"10.96.0.10", "fd00:10:96::a"}},
+		},
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	informers := NetworkInformers{log: slog.With("test", t.Name())}
+	require.NoError(t, informers.initInformers(ctx, client, 0))
+
+	// both address families, in any text representation, resolve to the same object
+	for name, ips := range map[string][]string{
+		"node-1": {"10.0.0.1", "::ffff:10.0.0.1", "fd00::1", "FD00::1%eth0"},
+		"client": {"10.244.0.5", "::FFFF:10.244.0.5", "fd00:10:244::5", "Fd00:10:244:0::5%2"},
+		"server": {"10.96.0.10", "::ffff:a60:a", "FD00:10:96::A", "fd00:10:96:0:0:0:0:a%eth0"},
+	} {
+		for _, ip := range ips {
+			info, ok := informers.GetInfo(ip)
+			require.Truef(t, ok, "ip: %s", ip)
+			assert.Equalf(t, name, info.Name, "ip: %s", ip)
+		}
+	}
+	// the Pod is decorated with the name of its Node, found by its normalized host IP
+	info, ok := informers.GetInfo("fd00:10:244::5")
+	require.True(t, ok)
+	assert.Equal(t, "node-1", info.HostName)
+}
+
+func TestGetInfo_NodeAddresses(t *testing.T) {
+	// GIVEN a cloud Node with internal and external addresses
+	client := fake.NewSimpleClientset(&v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status: v1.NodeStatus{Addresses: []v1.NodeAddress{
+			{Type: v1.NodeInternalIP, Address: "10.0.0.1"},
+			{Type: v1.NodeExternalIP, Address: "203.0.113.7"},
+			{Type: v1.NodeInternalDNS, Address: "ip-10-0-0-1.ec2.internal"},
+			{Type: v1.NodeHostName, Address: "ip-10-0-0-1"},
+		}},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	informers := NetworkInformers{log: slog.With("test", t.Name())}
+	require.NoError(t, informers.initInformers(ctx, client, 0))
+
+	// THEN the traffic to any of its IP addresses is attributed to the Node
+	for _, ip := range []string{"10.0.0.1", "203.0.113.7"} {
+		info, ok := informers.GetInfo(ip)
+		require.Truef(t, ok, "ip: %s", ip)
+		assert.Equal(t, "node-1", info.Name)
+		assert.Equal(t, typeNode, info.Type)
+	}
+	// AND the host names are not indexed as IPs
+	_, ok := informers.GetInfo("ip-10-0-0-1.ec2.internal")
+	assert.False(t, ok)
+
+	// AND WHEN the Node is deleted
+	require.NoError(t, client.CoreV1().Nodes().Delete(ctx, "node-1", metav1.DeleteOptions{}))
+	// THEN none of its addresses is attributed to it anymore
+	require.Eventually(t, func() bool {
+		_, internalOK := informers.GetInfo("10.0.0.1")
+		_, externalOK := informers.GetInfo("203.0.113.7")
+		return !internalOK && !externalOK
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestGetInfo_ServiceLoadBalancer(t *testing.T) {
+	// GIVEN a LoadBalancer Service with external IPs, whose load balancer is not yet provisioned
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "gateway", Namespace: "shop"},
+		Spec: v1.ServiceSpec{
+			Type:        v1.ServiceTypeLoadBalancer,
+			ClusterIPs:  []string{"10.96.0.10"},
+			ExternalIPs: []string{"192.0.2.10"},
+		},
+	}
+	client := fake.NewSimpleClientset(svc)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	informers := NetworkInformers{log: slog.With("test", t.Name())}
+	require.NoError(t, informers.initInformers(ctx, client, 0))
+
+	// THEN its cluster and external IPs are attributed to it
+	for _, ip := range []string{"10.96.0.10", "192.0.2.10"} {
+		info, ok := informers.GetInfo(ip)
+		require.Truef(t, ok, "ip: %s", ip)
+		assert.Equal(t, "gateway", info.Name)
+		assert.Equal(t, typeService, info.Type)
+	}
+
+	// AND WHEN the cloud provider provisions the load balancer
+	withIngress := func(ingress ...v1.LoadBalancerIngress) *v1.Service {
+		updated := svc.DeepCopy()
+		updated.Status.LoadBalancer.Ingress = ingress
+		return updated
+	}
+	_, err := client.CoreV1().Services("shop").UpdateStatus(ctx, withIngress(
+		v1.LoadBalancerIngress{IP: "203.0.113.10"},
+		v1.LoadBalancerIngress{Hostname: "gateway.elb.example.com"},
+	), metav1.UpdateOptions{})
+	require.NoError(t, err)
+	// THEN its ingress IP is attributed to the Service
+	require.Eventually(t, func() bool {
+		info, ok := informers.GetInfo("203.0.113.10")
+		return ok && info.Name == "gateway"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// AND WHEN the ingress IP changes
+	_, err = client.CoreV1().Services("shop").UpdateStatus(ctx,
+		withIngress(v1.LoadBalancerIngress{IP: "203.0.113.20"}), metav1.UpdateOptions{})
+	require.NoError(t, err)
+	// THEN the new IP is attributed to the Service, and the previous IP is not
+	require.Eventually(t, func() bool {
+		_, oldOK := informers.GetInfo("203.0.113.10")
+		info, newOK := informers.GetInfo("203.0.113.20")
+		return !oldOK && newOK && info.Name == "gateway"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// AND WHEN the Service is deleted
+	require.NoError(t, client.CoreV1().Services("shop").Delete(ctx, "gateway", metav1.DeleteOptions{}))
+	// THEN none of its IPs is attributed to it anymore
+	require.Eventually(t, func() bool {
+		for _, ip := range []string{"10.96.0.10", "192.0.2.10", "203.0.113.20"} {
+			if _, ok := informers.GetInfo(ip); ok {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDecorate_NodeZone(t *testing.T) {
+	// GIVEN a Node in a topology zone
+	client := fake.NewSimpleClientset(
+		&v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{v1.LabelTopologyZone: "eu-west-1a"}},
+			Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Address: "10.0.0.1"}}},
+		},
+		// AND a Pod that is scheduled on a Node that has not been observed yet
+		&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"},
+			Spec:       v1.PodSpec{NodeName: "node-2"},
+			Status:     v1.PodStatus{HostIP: "10.0.0.2", PodIPs: []v1.PodIP{{IP: "10.1.0.5"}}},
+		},
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dec := decorator{log: slog.With("test", t.Name())}
+	var err error
+	dec.alreadyLoggedIPs, err = simplelru.NewLRU[string, struct{}](alreadyLoggedIPsCacheLen, nil)
+	require.NoError(t, err)
+	require.NoError(t, dec.kube.initInformers(ctx, client, 0))
+
+	flow := func() *ebpf.Record {
+		flow := &ebpf.Record{}
+		flow.Id.SrcIp.In6U.U6Addr8 = ebpf.IPAddr{10: 0xff, 11: 0xff, 12: 10, 13: 1, 15: 5}
+		flow.Id.DstIp.In6U.U6Addr8 = ebpf.IPAddr{10: 0xff, 11: 0xff, 12: 10, 15: 1}
+		return flow
+	}
+	// WHEN a flow from the Pod to the Node is decorated
+	f := flow()
+	require.True(t, dec.transform(f))
+	// THEN the zone of the Node is reported
+	assert.Equal(t, "eu-west-1a", f.Attrs.Metadata[attr.K8sDstZone])
+	// AND the zone of the Pod is unknown until its Node is observed
+	assert.Equal(t, "node-2", f.Attrs.Metadata[attr.Name(attrPrefixSrc+attrSuffixHostName)])
+	assert.NotContains(t, f.Attrs.Metadata, attr.K8sSrcZone)
+	assert.NotContains(t, f.Attrs.Metadata, attr.K8sCrossZone)
+
+	// AND WHEN the Node of the Pod is observed
+	_, err = client.CoreV1().Nodes().Create(ctx, &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-2", Labels: map[string]string{v1.LabelTopologyZone: "eu-west-1b"}},
+		Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Address: "10.0.0.2"}}},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	// THEN the next flows of the Pod report its zone
+	require.Eventually(t, func() bool {
+		f := flow()
+		return dec.transform(f) && f.Attrs.Metadata[attr.K8sSrcZone] == "eu-west-1b"
+	}, 5*time.Second, 10*time.Millisecond)
+	// AND the flows between both zones are reported as cross-zone
+	f = flow()
+	require.True(t, dec.transform(f))
+	assert.Equal(t, "true", f.Attrs.Metadata[attr.K8sCrossZone])
+
+	// AND the flows within the same zone are not
+	f = flow()
+	f.Id.SrcIp.In6U.U6Addr8 = ebpf.IPAddr{10: 0xff, 11: 0xff, 12: 10, 15: 2}
+	f.Id.DstIp.In6U.U6Addr8 = ebpf.IPAddr{10: 0xff, 11: 0xff, 12: 10, 13: 1, 15: 5}
+	require.True(t, dec.transform(f))
+	assert.Equal(t, "false", f.Attrs.Metadata[attr.K8sCrossZone])
+}
+
+func TestDecorate_OwnerNames(t *testing.T) {
+	// GIVEN a Pod whose ReplicaSet has not been observed yet
+	client := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-5d8f-abcde", Namespace: "shop",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-5d8f"}}},
+		Status: v1.PodStatus{HostIP: nodeIP, PodIPs: []v1.PodIP{{IP: "10.1.0.5"}}},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dec := decorator{log: slog.With("test", t.Name()), ownerNames: true}
+	require.NoError(t, dec.kube.initInformers(ctx, client, 0))
+	dec.alreadyLoggedIPs, _ = simplelru.NewLRU[string, struct{}](alreadyLoggedIPsCacheLen, nil)
+
+	flow := func() *ebpf.Record {
+		flow := &ebpf.Record{}
+		flow.Id.SrcIp.In6U.U6Addr8 = ebpf.IPAddr{10: 0xff, 11: 0xff, 12: 10, 13: 1, 15: 5}
+		flow.Id.DstIp.In6U.U6Addr8 = ebpf.IPAddr{10: 0xff, 11: 0xff, 12: 8, 13: 8, 14: 8, 15: 8}
+		return flow
+	}
+	// WHEN its flows are decorated
+	f := flow()
+	dec.transform(f)
+	// THEN the Pod is its own owner, and the Pod name is not reported
+	assert.Equal(t, "web-5d8f-abcde", f.Attrs.SrcName)
+	assert.Equal(t, "web-5d8f-abcde", f.Attrs.Metadata[attr.K8sSrcOwnerName])
+	assert.Equal(t, "Pod", f.Attrs.Metadata[attr.K8sSrcOwnerType])
+	assert.NotContains(t, f.Attrs.Metadata, attr.K8sSrcName)
+
+	// AND WHEN the ReplicaSet is observed
+	_, err := client.AppsV1().ReplicaSets("shop").Create(ctx, &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-5d8f", Namespace: "shop",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "web"}}},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	// THEN the next flows are named after the Deployment
+	require.Eventually(t, func() bool {
+		f := flow()
+		dec.transform(f)
+		return f.Attrs.SrcName == "web" && f.Attrs.Metadata[attr.K8sSrcOwnerType] == "Deployment"
+	}, 5*time.Second, 10*time.Millisecond)
+	// AND the resolved owner is stored with the Pod, so it is not looked up again
+	first, ok := dec.kube.GetInfo("10.1.0.5")
+	require.True(t, ok)
+	second, _ := dec.kube.GetInfo("10.1.0.5")
+	assert.Same(t, first, second)
+}
+
+func TestDecorate_Scope(t *testing.T) {
+	// GIVEN a Node with a Pod CIDR, a known Pod and a known Service
+	client := fake.NewSimpleClientset(
+		&v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Spec:       v1.NodeSpec{PodCIDRs: []string{"10.1.0.0/24"}},
+			Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Address: nodeIP}}},
+		},
+		&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"},
+			Status:     v1.PodStatus{HostIP: nodeIP, PodIPs: []v1.PodIP{{IP: "10.1.0.5"}}},
+		},
+		&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "shop"},
+			Spec:       v1.ServiceSpec{ClusterIPs: []string{"10.96.0.10"}},
+		},
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dec := decorator{log: slog.With("test", t.Name())}
+	dec.kube.ServiceCIDRs = []string{"10.96.0.0/12"}
+	require.NoError(t, dec.kube.initInformers(ctx, client, 0))
+	dec.alreadyLoggedIPs, _ = simplelru.NewLRU[string, struct{}](alreadyLoggedIPsCacheLen, nil)
+
+	scopes := func(src, dst string) (string, string) {
+		flow := &ebpf.Record{}
+		flow.Id.SrcIp.In6U.U6Addr8 = ebpf.IPAddr(net.ParseIP(src).To16())
+		flow.Id.DstIp.In6U.U6Addr8 = ebpf.IPAddr(net.ParseIP(dst).To16())
+		dec.transform(flow)
+		return flow.Attrs.Metadata[attr.SrcScope], flow.Attrs.Metadata[attr.DstScope]
+	}
+	// THEN the known objects are classified by their type
+	src, dst := scopes("10.1.0.5", "10.96.0.10")
+	assert.Equal(t, scopePod, src)
+	assert.Equal(t, scopeService, dst)
+	src, dst = scopes(nodeIP, "8.8.8.8")
+	assert.Equal(t, scopeNode, src)
+	assert.Equal(t, scopeExternal, dst)
+	// AND the unknown IPs by the Pod and Service CIDRs
+	src, dst = scopes("10.1.0.77", "10.100.3.4")
+	assert.Equal(t, scopePod, src)
+	assert.Equal(t, scopeService, dst)
+	assert.True(t, dec.kube.IsClusterInternal("10.1.0.77"))
+	assert.False(t, dec.kube.IsClusterInternal("10.2.0.7"))
+
+	// AND WHEN a Node joins the cluster
+	_, err := client.CoreV1().Nodes().Create(ctx, &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-2"},
+		Spec:       v1.NodeSpec{PodCIDRs: []string{"10.2.0.0/24"}},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	// THEN the IPs in its Pod CIDR are internal
+	require.Eventually(t, func() bool {
+		return dec.kube.IsClusterInternal("10.2.0.7")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// AND WHEN a Node leaves the cluster
+	require.NoError(t, client.CoreV1().Nodes().Delete(ctx, "node-1", metav1.DeleteOptions{}))
+	// THEN the unknown IPs in its Pod CIDR are external
+	require.Eventually(t, func() bool {
+		return !dec.kube.IsClusterInternal("10.1.0.77")
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.True(t, dec.kube.IsClusterInternal("10.1.0.5"))
+}
+
+func TestDecorate_SharedClusterName(t *testing.T) {
+	// GIVEN a cluster name that is shared by the spans and the flows decoration
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clusterName := kube.ResolveClusterName(ctx, nil, "the-cluster")
+	spans := appkube.CreateDatabase(&kube.Metadata{ClusterName: clusterName})
+	dec := decorator{log: slog.With("test", t.Name()), kube: NetworkInformers{ClusterName: clusterName}}
+	require.NoError(t, dec.kube.initInformers(ctx, fake.NewSimpleClientset(), 0))
+	dec.alreadyLoggedIPs, _ = simplelru.NewLRU[string, struct{}](alreadyLoggedIPsCacheLen, nil)
+
+	// WHEN a flow is decorated
+	flow := &ebpf.Record{}
+	flow.Id.SrcIp.In6U.U6Addr8 = ebpf.IPAddr{10: 0xff, 11: 0xff, 12: 10, 15: 1}
+	flow.Id.DstIp.In6U.U6Addr8 = ebpf.IPAddr{10: 0xff, 11: 0xff, 12: 10, 15: 2}
+	dec.transform(flow)
+
+	// THEN it reports the same cluster name as the spans
+	assert.Equal(t, "the-cluster", spans.ClusterName())
+	assert.Equal(t, spans.ClusterName(), flow.Attrs.Metadata[attr.K8sClusterName])
+}
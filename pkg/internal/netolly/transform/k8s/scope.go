@@ -0,0 +1,151 @@
+package k8s
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/yl2chen/cidranger"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/grafana/beyla/pkg/internal/kube"
+)
+
+// scopes of the flow endpoints, as reported by the src.scope and dst.scope attributes
+const (
+	scopePod      = "pod"
+	scopeService  = "service"
+	scopeNode     = "node"
+	scopeExternal = "external"
+)
+
+// clusterCIDRs classifies the IPs that are not known by the informers, such as the IPs of the Pods that
+// have not been observed yet, by the Pod CIDRs of the observed Nodes and the configured Service CIDRs.
+// The CIDRs are stored in a trie, so the lookups don't depend on the number of Nodes.
+type clusterCIDRs struct {
+	mut    sync.RWMutex
+	ranger cidranger.Ranger
+	// number of Nodes that declare each Pod CIDR, as the CIDR is removed when no Node declares it
+	podCIDRs map[string]int
+}
+
+type scopeRangerEntry struct {
+	ipNet net.IPNet
+	scope string
+}
+
+func (e *scopeRangerEntry) Network() net.IPNet {
+	return e.ipNet
+}
+
+func newClusterCIDRs(serviceCIDRs []string) (*clusterCIDRs, error) {
+	c := &clusterCIDRs{ranger: cidranger.NewPCTrieRanger(), podCIDRs: map[string]int{}}
+	for _, cidr := range serviceCIDRs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("parsing Service CIDR %s: %w", cidr, err)
+		}
+		if err := c.ranger.Insert(&scopeRangerEntry{ipNet: *ipNet, scope: scopeService}); err != nil {
+			return nil, fmt.Errorf("inserting Service CIDR %s: %w", cidr, err)
+		}
+	}
+	return c, nil
+}
+
+// scope returns the scope of the narrowest CIDR that contains the IP, or external if none does
+func (c *clusterCIDRs) scope(ip net.IP) string {
+	c.mut.RLock()
+	entries, err := c.ranger.ContainingNetworks(ip)
+	c.mut.RUnlock()
+	if err != nil || len(entries) == 0 {
+		return scopeExternal
+	}
+	return entries[len(entries)-1].(*scopeRangerEntry).scope
+}
+
+func (c *clusterCIDRs) addPodCIDRs(cidrs []string) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	for _, cidr := range cidrs {
+		c.podCIDRs[cidr]++
+		if c.podCIDRs[cidr] > 1 {
+			continue
+		}
+		// the CIDRs were validated by the Node informer transform
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		if err := c.ranger.Insert(&scopeRangerEntry{ipNet: *ipNet, scope: scopePod}); err != nil {
+			log().Debug("can't insert Pod CIDR. Ignoring", "cidr", cidr, "error", err)
+		}
+	}
+}
+
+func (c *clusterCIDRs) removePodCIDRs(cidrs []string) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	for _, cidr := range cidrs {
+		if c.podCIDRs[cidr] > 1 {
+			c.podCIDRs[cidr]--
+			continue
+		}
+		delete(c.podCIDRs, cidr)
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		if _, err := c.ranger.Remove(*ipNet); err != nil {
+			log().Debug("can't remove Pod CIDR. Ignoring", "cidr", cidr, "error", err)
+		}
+	}
+}
+
+// nodeCIDRsHandler keeps the Pod CIDRs updated with the Nodes that come and go
+func (c *clusterCIDRs) nodeCIDRsHandler() cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			c.addPodCIDRs(obj.(*Info).podCIDRs)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			// the Pod CIDRs of a Node are immutable once set, but they might be unset at creation
+			c.addPodCIDRs(newObj.(*Info).podCIDRs)
+			c.removePodCIDRs(oldObj.(*Info).podCIDRs)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if node, ok := kube.DeletedObject[*Info](obj); ok {
+				c.removePodCIDRs(node.podCIDRs)
+			}
+		},
+	}
+}
+
+// infoScope returns the scope of an object from the informers
+func infoScope(info *Info) string {
+	switch info.Type {
+	case typePod:
+		return scopePod
+	case typeService:
+		return scopeService
+	case typeNode:
+		return scopeNode
+	}
+	return scopeExternal
+}
+
+// IsClusterInternal returns whether the IP belongs to a Pod, Service or Node of the cluster, either
+// because it is known by the informers, or because it is in the Pod CIDR of a Node or in a Service CIDR
+func (k *NetworkInformers) IsClusterInternal(ip string) bool {
+	return k.Scope(ip) != scopeExternal
+}
+
+// Scope returns whether the IP belongs to a pod, service or node of the cluster, or is external to it
+func (k *NetworkInformers) Scope(ip string) string {
+	if info, ok := k.fetchInformers(kube.NormalizeIP(ip)); ok {
+		return infoScope(info)
+	}
+	return k.cidrScope(ip)
+}
+
+// cidrScope returns the scope of an IP that is not known by the informers
+func (k *NetworkInformers) cidrScope(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || k.cidrs == nil {
+		return scopeExternal
+	}
+	return k.cidrs.scope(parsed)
+}
@@ -0,0 +1,135 @@
+// Package process decorates the network flows with the name of the local processes
+// that own the sockets of each flow endpoint.
+package process
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/mariomac/pipes/pipe"
+
+	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
+	"github.com/grafana/beyla/pkg/internal/netolly/ebpf"
+)
+
+func plog() *slog.Logger {
+	return slog.With("component", "process.Decorator")
+}
+
+// Attribution configures the decoration of the network flows with the name of
+// the local processes owning the source and destination sockets.
+type Attribution struct {
+	// Enable the process attribution of the network flows. Default: false
+	Enable bool `yaml:"enable" env:"BEYLA_NETWORK_PROCESS_ATTRIBUTION"`
+	// RefreshPeriod is the minimum time between two consecutive scans of the sockets
+	// and processes in the /proc filesystem. The scans run in background when a socket
+	// is not found, so the flows are not attributed until the next scan finds it.
+	RefreshPeriod time.Duration `yaml:"refresh_period" env:"BEYLA_NETWORK_PROCESS_ATTRIBUTION_REFRESH_PERIOD"`
+}
+
+// Decorator configures the process decoration node of the network flows pipeline
+type Decorator struct {
+	Attribution *Attribution
+	// HostNetworkPods enables the lookup of the local socket processes, even if the
+	// process attribution is disabled, to let the Kubernetes decorator attribute the flows
+	// of the Pods running in the host network to their actual owners
+	HostNetworkPods bool
+	// SocketDirection overrides the direction of the flows according to the state of
+	// their local sockets, instead of relying on the ports heuristic of the
+	// socket filter eBPF tracer
+	SocketDirection bool
+}
+
+func (d *Decorator) Enabled() bool {
+	return d.Attribution.Enable || d.HostNetworkPods
+}
+
+func DecoratorProvider(ctx context.Context, cfg *Decorator) (pipe.MiddleFunc[[]*ebpf.Record, []*ebpf.Record], error) {
+	if !cfg.Enabled() {
+		// This node is not going to be instantiated. Let the pipes library just bypassing it.
+		return pipe.Bypass[[]*ebpf.Record](), nil
+	}
+	dec := decorator{
+		sockets:         newSocketIndex("/proc", cfg.Attribution.RefreshPeriod),
+		socketDirection: cfg.SocketDirection,
+	}
+	dec.sockets.refresh()
+	return func(in <-chan []*ebpf.Record, out chan<- []*ebpf.Record) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go dec.sockets.refreshLoop(ctx)
+		plog().Debug("starting node")
+		for flows := range in {
+			for _, flow := range flows {
+				dec.decorate(flow)
+			}
+			out <- flows
+		}
+		plog().Debug("stopping node")
+	}, nil
+}
+
+type decorator struct {
+	sockets         *socketIndex
+	socketDirection bool
+}
+
+func (d *decorator) decorate(flow *ebpf.Record) {
+	if flow.Attrs.Metadata == nil {
+		flow.Attrs.Metadata = map[attr.Name]string{}
+	}
+	src, srcLocal := d.sockets.socket(flow.Id.TransportProtocol, flow.Id.SrcIP(), flow.Id.SrcPort)
+	if srcLocal {
+		flow.Attrs.Metadata[attr.SrcProcessName] = src.name
+		flow.Attrs.SrcPID = src.pid
+	}
+	dst, dstLocal := d.sockets.socket(flow.Id.TransportProtocol, flow.Id.DstIP(), flow.Id.DstPort)
+	if dstLocal {
+		flow.Attrs.Metadata[attr.DstProcessName] = dst.name
+		flow.Attrs.DstPID = dst.pid
+	}
+	if d.socketDirection && flow.Id.Direction != ebpf.DirectionUnset {
+		if dir, ok := d.direction(flow, srcLocal, dstLocal); ok {
+			flow.Id.Direction = dir
+		}
+	}
+}
+
+// direction of the flow, according to its local sockets: flows coming from a local socket
+// are egress and flows going to a local socket are ingress. If both sockets are local (e.g.
+// two Pods in the host network), the flow is egress when it goes from the client to the server.
+func (d *decorator) direction(flow *ebpf.Record, srcLocal, dstLocal bool) (uint8, bool) {
+	switch {
+	case srcLocal && dstLocal:
+		if d.sockets.isServer(flow.Id.TransportProtocol, flow.Id.DstIP(), flow.Id.DstPort) {
+			return ebpf.DirectionEgress, true
+		}
+		if d.sockets.isServer(flow.Id.TransportProtocol, flow.Id.SrcIP(), flow.Id.SrcPort) {
+			return ebpf.DirectionIngress, true
+		}
+		return 0, false
+	case srcLocal:
+		return ebpf.DirectionEgress, true
+	case dstLocal:
+		return ebpf.DirectionIngress, true
+	}
+	return 0, false
+}
+
+// localAddrs returns the IP addresses of the local network interfaces
+func localAddrs() []net.IP {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		plog().Debug("can't get local interface addresses", "error", err)
+		return nil
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			ips = append(ips, ipNet.IP)
+		}
+	}
+	return ips
+}
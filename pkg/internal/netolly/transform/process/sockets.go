@@ -0,0 +1,290 @@
+package process
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/beyla/pkg/internal/netolly/ebpf"
+	"github.com/grafana/beyla/pkg/internal/netolly/flow/transport"
+)
+
+// TCP_LISTEN state, as reported in the /proc/net/tcp files
+const tcpListen = "0A"
+
+// files from the /proc/net folder, listing the sockets of each transport protocol
+var procNetFiles = []struct {
+	file      string
+	transport transport.Protocol
+}{
+	{file: "tcp", transport: transport.TCP},
+	{file: "tcp6", transport: transport.TCP},
+	{file: "udp", transport: transport.UDP},
+	{file: "udp6", transport: transport.UDP},
+}
+
+type sockKey struct {
+	transport uint8
+	ip        ebpf.IPAddr
+	port      uint16
+}
+
+type sockInfo struct {
+	pid  uint32
+	name string
+}
+
+type procNetEntry struct {
+	key sockKey
+	// listening is true for TCP listening sockets and for unconnected UDP sockets
+	listening bool
+}
+
+// socketIndex maps local socket addresses to the process that owns them.
+// The index is rebuilt in background, so the lookups never wait for the scans
+// of the /proc filesystem.
+type socketIndex struct {
+	procRoot      string
+	refreshPeriod time.Duration
+	localAddrs    func() []net.IP
+
+	// missed requests a background refresh of the index, when a lookup
+	// doesn't find a socket
+	missed chan struct{}
+
+	mt      sync.RWMutex
+	sockets map[sockKey]sockInfo
+	// addresses of the listening sockets
+	listens map[sockKey]struct{}
+	// local IP addresses of the host, to match sockets bound to any address
+	locals map[ebpf.IPAddr]struct{}
+}
+
+func newSocketIndex(procRoot string, refreshPeriod time.Duration) *socketIndex {
+	return &socketIndex{
+		procRoot:      procRoot,
+		refreshPeriod: refreshPeriod,
+		localAddrs:    localAddrs,
+		missed:        make(chan struct{}, 1),
+		sockets:       map[sockKey]sockInfo{},
+		listens:       map[sockKey]struct{}{},
+		locals:        map[ebpf.IPAddr]struct{}{},
+	}
+}
+
+// socket returns the process owning the local socket with the provided address.
+// If the socket is not found, a background refresh of the index is requested, so
+// the socket can be found by the next lookups.
+func (si *socketIndex) socket(proto uint8, ip *ebpf.IPAddr, port uint16) (sockInfo, bool) {
+	si.mt.RLock()
+	info, ok := lookup(si, si.sockets, proto, ip, port)
+	si.mt.RUnlock()
+	if !ok {
+		select {
+		case si.missed <- struct{}{}:
+		default:
+			// a refresh is already requested
+		}
+	}
+	return info, ok
+}
+
+// isServer returns true if the provided local address belongs to a listening socket
+// (or to a connection accepted from it)
+func (si *socketIndex) isServer(proto uint8, ip *ebpf.IPAddr, port uint16) bool {
+	si.mt.RLock()
+	defer si.mt.RUnlock()
+	_, ok := lookup(si, si.listens, proto, ip, port)
+	return ok
+}
+
+// refreshLoop refreshes the index when a lookup doesn't find a socket. As each refresh
+// walks the file descriptors of all the processes, the refreshes are rate-limited
+// to one per refresh period.
+func (si *socketIndex) refreshLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-si.missed:
+		}
+		si.refresh()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(si.refreshPeriod):
+		}
+	}
+}
+
+func lookup[T any](si *socketIndex, sockets map[sockKey]T, proto uint8, ip *ebpf.IPAddr, port uint16) (T, bool) {
+	if info, ok := sockets[sockKey{transport: proto, ip: *ip, port: port}]; ok {
+		return info, true
+	}
+	// sockets bound to any address only match the addresses of the local host
+	if _, ok := si.locals[*ip]; !ok {
+		var none T
+		return none, false
+	}
+	if info, ok := sockets[sockKey{transport: proto, ip: anyIPv4, port: port}]; ok {
+		return info, true
+	}
+	info, ok := sockets[sockKey{transport: proto, ip: ebpf.IPAddr{}, port: port}]
+	return info, ok
+}
+
+// IPv4 unspecified address, in the IPv6-mapped format used by the flows
+var anyIPv4 = ebpf.IPAddr{10: 0xff, 11: 0xff}
+
+func (si *socketIndex) refresh() {
+	log := plog()
+
+	locals := map[ebpf.IPAddr]struct{}{}
+	for _, ip := range si.localAddrs() {
+		if ip16 := ip.To16(); ip16 != nil {
+			locals[ebpf.IPAddr(ip16)] = struct{}{}
+		}
+	}
+
+	inodes := map[uint64]procNetEntry{}
+	for _, pnf := range procNetFiles {
+		if err := readProcNet(path.Join(si.procRoot, "net", pnf.file), uint8(pnf.transport), inodes); err != nil {
+			log.Debug("can't read sockets file", "file", pnf.file, "error", err)
+		}
+	}
+	listens := map[sockKey]struct{}{}
+	for _, entry := range inodes {
+		if entry.listening {
+			listens[entry.key] = struct{}{}
+		}
+	}
+
+	sockets := make(map[sockKey]sockInfo, len(inodes))
+	procs, err := os.ReadDir(si.procRoot)
+	if err != nil {
+		log.Debug("can't read processes", "error", err)
+	}
+	for _, proc := range procs {
+		pid, err := strconv.ParseUint(proc.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+		procDir := path.Join(si.procRoot, proc.Name())
+		fds, err := os.ReadDir(path.Join(procDir, "fd"))
+		if err != nil {
+			// process could have finished, or we don't have permissions
+			continue
+		}
+		name := ""
+		for _, fd := range fds {
+			link, err := os.Readlink(path.Join(procDir, "fd", fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]"), 10, 64)
+			if err != nil {
+				continue
+			}
+			entry, ok := inodes[inode]
+			if !ok {
+				continue
+			}
+			if name == "" {
+				name = commName(procDir)
+			}
+			sockets[entry.key] = sockInfo{pid: uint32(pid), name: name}
+		}
+	}
+	si.mt.Lock()
+	si.locals, si.listens, si.sockets = locals, listens, sockets
+	si.mt.Unlock()
+	log.Debug("refreshed local sockets index", "sockets", len(sockets))
+}
+
+func commName(procDir string) string {
+	comm, err := os.ReadFile(path.Join(procDir, "comm"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(comm))
+}
+
+// readProcNet parses a /proc/net/{tcp,udp}[6] file and stores the local address
+// of each socket, indexed by the socket inode.
+func readProcNet(file string, proto uint8, inodes map[uint64]procNetEntry) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	// skip header line
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		key, err := parseLocalAddr(fields[1])
+		if err != nil {
+			continue
+		}
+		inode, err := strconv.ParseUint(fields[9], 10, 64)
+		if err != nil || inode == 0 {
+			continue
+		}
+		key.transport = proto
+		inodes[inode] = procNetEntry{key: key, listening: isListening(proto, fields[2], fields[3])}
+	}
+	return scanner.Err()
+}
+
+func isListening(proto uint8, remoteAddr, state string) bool {
+	if proto == uint8(transport.TCP) {
+		return state == tcpListen
+	}
+	// unconnected UDP sockets
+	return strings.Trim(remoteAddr, "0:") == ""
+}
+
+// parseLocalAddr parses the hexadecimal IP:port address format of the /proc/net files.
+// IP addresses are stored as groups of 32-bit words in host byte order.
+func parseLocalAddr(addr string) (sockKey, error) {
+	key := sockKey{}
+	ipStr, portStr, ok := strings.Cut(addr, ":")
+	if !ok {
+		return key, fmt.Errorf("wrong address format: %s", addr)
+	}
+	port, err := strconv.ParseUint(portStr, 16, 16)
+	if err != nil {
+		return key, fmt.Errorf("wrong port format: %w", err)
+	}
+	key.port = uint16(port)
+	ipBytes, err := hex.DecodeString(ipStr)
+	if err != nil {
+		return key, fmt.Errorf("wrong IP format: %w", err)
+	}
+	var dst []byte
+	switch len(ipBytes) {
+	case net.IPv4len:
+		key.ip = anyIPv4
+		dst = key.ip[12:]
+	case net.IPv6len:
+		dst = key.ip[:]
+	default:
+		return key, fmt.Errorf("wrong IP length: %s", ipStr)
+	}
+	for i := 0; i < len(ipBytes); i += 4 {
+		binary.BigEndian.PutUint32(dst[i:], binary.NativeEndian.Uint32(ipBytes[i:]))
+	}
+	return key, nil
+}
@@ -0,0 +1,194 @@
+package process
+
+import (
+	"context"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
+	"github.com/grafana/beyla/pkg/internal/netolly/ebpf"
+	"github.com/grafana/beyla/pkg/internal/netolly/flow/transport"
+)
+
+const tcpFile = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1001 1 0000000000000000 100 0 0 10 0
+   1: 00000000:0050 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1002 1 0000000000000000 100 0 0 10 0
+   2: 0A00000A:C350 0B00000A:1F90 01 00000000:00000000 00:00000000 00000000     0        0 1003 1 0000000000000000 100 0 0 10 0
+`
+
+const udp6File = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+  0: 00000000000000000000000000000000:0035 00000000000000000000000000000000:0000 07 00000000:00000000 00:00000000 00000000     0        0 2001 2 0000000000000000 0
+`
+
+func fakeProc(t *testing.T) string {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(path.Join(root, "net"), 0o755))
+	require.NoError(t, os.WriteFile(path.Join(root, "net", "tcp"), []byte(tcpFile), 0o644))
+	require.NoError(t, os.WriteFile(path.Join(root, "net", "udp6"), []byte(udp6File), 0o644))
+	proc := func(pid, comm string, inodes ...string) {
+		require.NoError(t, os.MkdirAll(path.Join(root, pid, "fd"), 0o755))
+		require.NoError(t, os.WriteFile(path.Join(root, pid, "comm"), []byte(comm+"\n"), 0o644))
+		require.NoError(t, os.Symlink("/dev/null", path.Join(root, pid, "fd", "0")))
+		for i, inode := range inodes {
+			require.NoError(t, os.Symlink("socket:["+inode+"]", path.Join(root, pid, "fd", string(rune('3'+i)))))
+		}
+	}
+	proc("123", "java", "1001", "1003")
+	proc("456", "nginx", "1002")
+	proc("789", "dnsmasq", "2001")
+	return root
+}
+
+func ipAddr(ip string) *ebpf.IPAddr {
+	addr := ebpf.IPAddr(net.ParseIP(ip).To16())
+	return &addr
+}
+
+func TestSocketIndex(t *testing.T) {
+	si := newSocketIndex(fakeProc(t), time.Minute)
+	si.localAddrs = func() []net.IP {
+		return []net.IP{net.ParseIP("10.0.0.10"), net.ParseIP("fd00::10")}
+	}
+	si.refresh()
+	tcp, udp := uint8(transport.TCP), uint8(transport.UDP)
+
+	type testCase struct {
+		proto uint8
+		ip    string
+		port  uint16
+		name  string
+	}
+	for _, tc := range []testCase{
+		{proto: tcp, ip: "127.0.0.1", port: 8080, name: "java"},
+		{proto: tcp, ip: "10.0.0.10", port: 50000, name: "java"},
+		// sockets bound to any address
+		{proto: tcp, ip: "10.0.0.10", port: 80, name: "nginx"},
+		{proto: udp, ip: "fd00::10", port: 53, name: "dnsmasq"},
+		{proto: udp, ip: "10.0.0.10", port: 53, name: "dnsmasq"},
+		// the remote endpoint of a connection is not attributed
+		{proto: tcp, ip: "10.0.0.11", port: 8080},
+		// non-local addresses don't match sockets bound to any address
+		{proto: tcp, ip: "10.0.0.11", port: 80},
+		// different transport
+		{proto: udp, ip: "127.0.0.1", port: 8080},
+	} {
+		info, ok := si.socket(tc.proto, ipAddr(tc.ip), tc.port)
+		assert.Equalf(t, tc.name != "", ok, "%+v", tc)
+		assert.Equalf(t, tc.name, info.name, "%+v", tc)
+	}
+}
+
+func TestSocketIndex_RefreshPeriod(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	root := fakeProc(t)
+	si := newSocketIndex(root, 500*time.Millisecond)
+	si.localAddrs = func() []net.IP { return nil }
+	go si.refreshLoop(ctx)
+
+	// the first missed lookup triggers a background refresh
+	_, ok := si.socket(uint8(transport.TCP), ipAddr("127.0.0.2"), 9090)
+	require.False(t, ok)
+	require.Eventually(t, func() bool {
+		_, ok := si.socket(uint8(transport.TCP), ipAddr("127.0.0.1"), 8080)
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// a new process is created
+	require.NoError(t, os.WriteFile(path.Join(root, "net", "tcp"), []byte(tcpFile+
+		"   3: 0200007F:2382 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 3001 1 0000000000000000 100 0 0 10 0\n"),
+		0o644))
+	require.NoError(t, os.MkdirAll(path.Join(root, "321", "fd"), 0o755))
+	require.NoError(t, os.WriteFile(path.Join(root, "321", "comm"), []byte("prometheus\n"), 0o644))
+	require.NoError(t, os.Symlink("socket:[3001]", path.Join(root, "321", "fd", "3")))
+
+	// the lookups don't wait for the refresh, which doesn't happen until the refresh period passes
+	_, ok = si.socket(uint8(transport.TCP), ipAddr("127.0.0.2"), 9090)
+	require.False(t, ok)
+	_, ok = si.socket(uint8(transport.TCP), ipAddr("127.0.0.2"), 9090)
+	require.False(t, ok)
+
+	var info sockInfo
+	require.Eventually(t, func() bool {
+		info, ok = si.socket(uint8(transport.TCP), ipAddr("127.0.0.2"), 9090)
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "prometheus", info.name)
+	assert.EqualValues(t, 321, info.pid)
+}
+
+func tcpFlow(src string, srcPort uint16, dst string, dstPort uint16, direction uint8) *ebpf.Record {
+	flow := &ebpf.Record{NetFlowRecordT: ebpf.NetFlowRecordT{Id: ebpf.NetFlowId{
+		TransportProtocol: uint8(transport.TCP),
+		SrcPort:           srcPort,
+		DstPort:           dstPort,
+		Direction:         direction,
+	}}}
+	flow.Id.SrcIp.In6U.U6Addr8 = *ipAddr(src)
+	flow.Id.DstIp.In6U.U6Addr8 = *ipAddr(dst)
+	return flow
+}
+
+func TestDecorate(t *testing.T) {
+	si := newSocketIndex(fakeProc(t), time.Minute)
+	si.localAddrs = func() []net.IP { return []net.IP{net.ParseIP("10.0.0.10")} }
+	si.refresh()
+	dec := decorator{sockets: si}
+
+	flow := tcpFlow("10.0.0.10", 50000, "10.0.0.11", 8080, ebpf.DirectionIngress)
+	dec.decorate(flow)
+	assert.Equal(t, map[attr.Name]string{attr.SrcProcessName: "java"}, flow.Attrs.Metadata)
+	assert.EqualValues(t, 123, flow.Attrs.SrcPID)
+	assert.Zero(t, flow.Attrs.DstPID)
+	// direction is not overridden unless explicitly configured
+	assert.EqualValues(t, ebpf.DirectionIngress, flow.Id.Direction)
+}
+
+func TestDecorate_SocketDirection(t *testing.T) {
+	si := newSocketIndex(fakeProc(t), time.Minute)
+	si.localAddrs = func() []net.IP { return []net.IP{net.ParseIP("10.0.0.10")} }
+	si.refresh()
+	dec := decorator{sockets: si, socketDirection: true}
+
+	type testCase struct {
+		name      string
+		flow      *ebpf.Record
+		direction uint8
+	}
+	for _, tc := range []testCase{{
+		name:      "from local client",
+		flow:      tcpFlow("10.0.0.10", 50000, "10.0.0.11", 8080, ebpf.DirectionIngress),
+		direction: ebpf.DirectionEgress,
+	}, {
+		name:      "to local server",
+		flow:      tcpFlow("10.0.0.11", 40000, "10.0.0.10", 80, ebpf.DirectionEgress),
+		direction: ebpf.DirectionIngress,
+	}, {
+		name:      "both local: client to server",
+		flow:      tcpFlow("10.0.0.10", 50000, "10.0.0.10", 80, ebpf.DirectionIngress),
+		direction: ebpf.DirectionEgress,
+	}, {
+		name:      "both local: server to client",
+		flow:      tcpFlow("10.0.0.10", 80, "10.0.0.10", 50000, ebpf.DirectionEgress),
+		direction: ebpf.DirectionIngress,
+	}, {
+		name:      "unknown sockets keep their direction",
+		flow:      tcpFlow("10.0.0.11", 40000, "10.0.0.12", 80, ebpf.DirectionEgress),
+		direction: ebpf.DirectionEgress,
+	}, {
+		name:      "unset direction is not overridden",
+		flow:      tcpFlow("10.0.0.10", 50000, "10.0.0.11", 8080, ebpf.DirectionUnset),
+		direction: ebpf.DirectionUnset,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			dec.decorate(tc.flow)
+			assert.EqualValues(t, tc.direction, tc.flow.Id.Direction)
+		})
+	}
+}
@@ -1,10 +1,23 @@
 package global
 
 import (
+	"context"
+
+	"github.com/grafana/beyla/pkg/internal/capture"
 	"github.com/grafana/beyla/pkg/internal/connector"
+	"github.com/grafana/beyla/pkg/internal/ebpf/attachment"
+	"github.com/grafana/beyla/pkg/internal/ebpf/diagnostics"
+	"github.com/grafana/beyla/pkg/internal/export/alias"
 	"github.com/grafana/beyla/pkg/internal/export/metric"
+	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
+	"github.com/grafana/beyla/pkg/internal/health"
 	"github.com/grafana/beyla/pkg/internal/imetrics"
 	kube2 "github.com/grafana/beyla/pkg/internal/kube"
+	"github.com/grafana/beyla/pkg/internal/leader"
+	"github.com/grafana/beyla/pkg/internal/loadshed"
+	"github.com/grafana/beyla/pkg/internal/memlimit"
+	"github.com/grafana/beyla/pkg/internal/reload"
+	"github.com/grafana/beyla/pkg/internal/report"
 	"github.com/grafana/beyla/pkg/internal/transform/kube"
 )
 
@@ -13,6 +26,9 @@ import (
 type ContextInfo struct {
 	// K8sEnabled specifies whether kubernetes decoration and discovery is enabled
 	K8sEnabled bool
+	// K8sClusterName provides the name of the Kubernetes cluster to both the spans and the network
+	// flows decoration, so they report the same k8s.cluster.name. Nil if K8sEnabled is false.
+	K8sClusterName *kube2.ClusterName
 	// AppO11y stores context information that is only required for application observability.
 	// Its values must be initialized by the App O11y code and shouldn't be accessed from the
 	// NetO11y part.
@@ -22,9 +38,62 @@ type ContextInfo struct {
 	Metrics imetrics.Reporter
 	// Prometheus connection manager to coordinate metrics exposition from diverse nodes
 	Prometheus *connector.PrometheusManager
+	// Health reports the liveness and readiness conditions of the diverse components
+	Health *health.Reporter
+	// Reload registers the functions that apply the configuration changes at runtime. It is nil
+	// if the configuration reload is disabled.
+	Reload *reload.Appliers
+	// ExportCtx is canceled when the exporters must stop. On shutdown, it outlives the main context
+	// until the pipelines are drained or the shutdown timeout expires, so the exporters can flush
+	// their pending data. If nil, the exporters stop with the main context.
+	ExportCtx context.Context
+	// MemoryPressure notifies the components when the memory usage approaches the memory limit,
+	// so they can reduce it. It is nil if the memory is not limited.
+	MemoryPressure *memlimit.Pressure
+	// Leader runs the cluster-scoped responsibilities only while this Beyla instance is the leader.
+	// It is nil if the leader election is disabled, then the responsibilities run in every instance.
+	Leader *leader.Elector
+	// Probes registers the eBPF probes that are attached, for the runtime report. It can be nil.
+	Probes *report.Probes
+	// Attachments verifies periodically that the eBPF programs are still attached, re-attaching
+	// them if needed. It is nil if the verification is disabled.
+	Attachments *attachment.Watchdog
+	// Diagnostics reports the causes of the failures to load or attach the eBPF programs
+	Diagnostics *diagnostics.Reporter
 	// MetricAttributeGroups will selectively enable or disable diverse groups of attributes
 	// in the metric exporters
 	MetricAttributeGroups metric.AttrGroups
+	// MetricNamespaceLabels are the attributes of the Kubernetes namespace labels that are
+	// reported by the application metrics
+	MetricNamespaceLabels []attr.Name
+	// SemConv selects the semantic conventions of the HTTP and RPC attributes and metric names
+	// that are reported by the metrics and traces exporters
+	SemConv attr.SemConvStability
+	// Aliases reports the deprecated names of the renamed metrics and attributes. It is nil
+	// if the deprecated names are not reported.
+	Aliases *alias.Aliaser
+	// Build describes the features and the host of this Beyla instance, for the build
+	// information that is attached to the exported metrics and traces
+	Build BuildInfo
+}
+
+// BuildInfo complements the version and revision of Beyla with the information that is
+// required to triage issues across a fleet of Beyla instances. Its values must have a bounded
+// cardinality, as they are reported as metric labels.
+type BuildInfo struct {
+	// Features of Beyla that are enabled (application, network), sorted by name
+	Features []string
+	// KernelRelease of the host, as the instrumentation behaves differently in each kernel
+	KernelRelease string
+}
+
+// ExportContext returns the context that the exporters must use to send their data and
+// flush it on shutdown, defaulting to the provided main context.
+func (c *ContextInfo) ExportContext(ctx context.Context) context.Context {
+	if c.ExportCtx != nil {
+		return c.ExportCtx
+	}
+	return ctx
 }
 
 // AppO11y stores context information that is only required for application observability.
@@ -35,4 +104,10 @@ type AppO11y struct {
 	K8sInformer *kube2.Metadata
 	// K8sDatabase provides access to shared kubernetes metadata
 	K8sDatabase *kube.Database
+	// Replay is the recording of captured spans that is replayed instead of instrumenting the processes.
+	// Its Kubernetes metadata replaces the K8sDatabase. It is nil if there isn't any replay.
+	Replay *capture.Recording
+	// LoadShedding sheds the most expensive processing of the spans when Beyla can't keep the pace
+	// of the captured events. It is nil if the load shedding is disabled.
+	LoadShedding *loadshed.Shedder
 }
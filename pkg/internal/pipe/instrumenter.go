@@ -15,6 +15,9 @@ import (
 	"github.com/grafana/beyla/pkg/internal/filter"
 	"github.com/grafana/beyla/pkg/internal/imetrics"
 	"github.com/grafana/beyla/pkg/internal/pipe/global"
+	"github.com/grafana/beyla/pkg/internal/pipe/queue"
+	"github.com/grafana/beyla/pkg/internal/pipe/shard"
+	"github.com/grafana/beyla/pkg/internal/reload"
 	"github.com/grafana/beyla/pkg/internal/request"
 	"github.com/grafana/beyla/pkg/internal/traces"
 	"github.com/grafana/beyla/pkg/transform"
@@ -25,6 +28,10 @@ import (
 type nodesMap struct {
 	TracesReader pipe.Start[[]request.Span]
 
+	// Shards is an optional pipe. If enabled, it runs the Routes, Kubernetes, NameResolver and
+	// AttributeFilter stages separately for each shard, and those nodes are bypassed.
+	Shards pipe.Middle[[]request.Span, []request.Span]
+
 	// Routes is an optional pipe. If not enabled, data will be bypassed to the next stage in the pipeline.
 	Routes pipe.Middle[[]request.Span, []request.Span]
 
@@ -35,6 +42,9 @@ type nodesMap struct {
 
 	AttributeFilter pipe.Middle[[]request.Span, []request.Span]
 
+	// LoadShedder is an optional pipe. If the load shedding is disabled, data will be bypassed to the exporters.
+	LoadShedder pipe.Middle[[]request.Span, []request.Span]
+
 	AlloyTraces pipe.Final[[]request.Span]
 	Metrics     pipe.Final[[]request.Span]
 	Traces      pipe.Final[[]request.Span]
@@ -47,19 +57,23 @@ type nodesMap struct {
 // at build time will be Bypassed (e.g. if the Routes node is disabled, the pipes library
 // will directly connect TracesReader to Kubernetes node).
 func (n *nodesMap) Connect() {
-	n.TracesReader.SendTo(n.Routes)
+	n.TracesReader.SendTo(n.Shards)
+	n.Shards.SendTo(n.Routes)
 	n.Routes.SendTo(n.Kubernetes)
 	n.Kubernetes.SendTo(n.NameResolver)
 	n.NameResolver.SendTo(n.AttributeFilter)
-	n.AttributeFilter.SendTo(n.AlloyTraces, n.Metrics, n.Traces, n.Prometheus, n.Printer, n.Noop)
+	n.AttributeFilter.SendTo(n.LoadShedder)
+	n.LoadShedder.SendTo(n.AlloyTraces, n.Metrics, n.Traces, n.Prometheus, n.Printer, n.Noop)
 }
 
 // accessor functions to each field. Grouped here for code brevity during the pipeline build
 func tracesReader(n *nodesMap) *pipe.Start[[]request.Span]                  { return &n.TracesReader }
+func sharder(n *nodesMap) *pipe.Middle[[]request.Span, []request.Span]      { return &n.Shards }
 func router(n *nodesMap) *pipe.Middle[[]request.Span, []request.Span]       { return &n.Routes }
 func kubernetes(n *nodesMap) *pipe.Middle[[]request.Span, []request.Span]   { return &n.Kubernetes }
 func nameResolver(n *nodesMap) *pipe.Middle[[]request.Span, []request.Span] { return &n.NameResolver }
 func attrFilter(n *nodesMap) *pipe.Middle[[]request.Span, []request.Span]   { return &n.AttributeFilter }
+func loadShedder(n *nodesMap) *pipe.Middle[[]request.Span, []request.Span]  { return &n.LoadShedder }
 func alloyTraces(n *nodesMap) *pipe.Final[[]request.Span]                   { return &n.AlloyTraces }
 func otelMetrics(n *nodesMap) *pipe.Final[[]request.Span]                   { return &n.Metrics }
 func otelTraces(n *nodesMap) *pipe.Final[[]request.Span]                    { return &n.Traces }
@@ -100,21 +114,50 @@ func newGraphBuilder(ctx context.Context, config *beyla.Config, ctxInfo *global.
 		tracesCh: tracesCh,
 	}
 	// Second, we register providers for each pipe node.
-	pipe.AddStart(gnb, tracesReader, traces.ReadFromChannel(ctx, &traces.ReadDecorator{
-		InstanceID:  config.Attributes.InstanceID,
-		TracesInput: gb.tracesCh,
-	}))
-
-	pipe.AddMiddleProvider(gnb, router, transform.RoutesProvider(config.Routes))
-	pipe.AddMiddleProvider(gnb, kubernetes, transform.KubeDecoratorProvider(ctxInfo, &config.Attributes.Kubernetes))
-	pipe.AddMiddleProvider(gnb, nameResolver, transform.NameResolutionProvider(gb.ctxInfo, config.NameResolver))
-	pipe.AddMiddleProvider(gnb, attrFilter, filter.ByAttribute(config.Filters.Application, spanPtrPromGetters))
+	pipe.AddStart(gnb, tracesReader, imetrics.InstrumentStart(ctxInfo.Metrics, "appo11y.traces_reader",
+		traces.ReadFromChannel(ctx, &traces.ReadDecorator{
+			InstanceID:  config.Attributes.InstanceID,
+			TracesInput: gb.tracesCh,
+			Watchdog:    ctxInfo.Health.Watchdog("appo11y.pipeline"),
+		})))
+
+	// the internal metrics report the queue depth, throughput and processing latency of each stage
+	stages := queue.NewStages(config.PipelineQueues, config.ChannelBufferLen, ctxInfo.Metrics)
+	// the routes and the attribute filters can be updated when the configuration is reloaded
+	routes := transform.NewRouter(config.Routes)
+	reload.OnChange(ctxInfo.Reload, "routes", routes.Update)
+	attrs := filter.NewByAttribute(config.Filters.Application, spanPtrPromGetters)
+	reload.OnChange(ctxInfo.Reload, "filter.application", attrs.Update)
+	kubeDecorator := transform.KubeDecoratorProvider(ctxInfo, &config.Attributes.Kubernetes)
+	nameResolution := transform.NameResolutionProvider(gb.ctxInfo, config.NameResolver,
+		config.Attributes.Kubernetes.NamespaceLabels)
+	// if the pipeline is sharded, the processing stages run inside each shard, and are bypassed here
+	shards := &config.PipelineShards
+	pipe.AddMiddleProvider(gnb, sharder, shard.Spans(shards, config.ChannelBufferLen, ctxInfo.Metrics,
+		routes.Provide, kubeDecorator, nameResolution, attrs.Provide))
+	pipe.AddMiddleProvider(gnb, router, shard.Unsharded(shards,
+		queue.Middle(stages, "appo11y.routes", routes.Provide)))
+	pipe.AddMiddleProvider(gnb, kubernetes, shard.Unsharded(shards,
+		queue.Middle(stages, "appo11y.kubernetes", kubeDecorator)))
+	pipe.AddMiddleProvider(gnb, nameResolver, shard.Unsharded(shards,
+		queue.Middle(stages, "appo11y.name_resolver", nameResolution)))
+	pipe.AddMiddleProvider(gnb, attrFilter, shard.Unsharded(shards,
+		queue.Middle(stages, "appo11y.attribute_filter", attrs.Provide)))
+	pipe.AddMiddleProvider(gnb, loadShedder,
+		queue.Middle(stages, "appo11y.load_shedder", ctxInfo.AppO11y.LoadShedding.Provide))
+	// on shutdown, the exporters keep working until they flush their pending data
+	exportCtx := ctxInfo.ExportContext(ctx)
 	config.Metrics.Grafana = &gb.config.Grafana.OTLP
-	pipe.AddFinalProvider(gnb, otelMetrics, otel.ReportMetrics(ctx, gb.ctxInfo, &config.Metrics, config.Attributes.Select))
+	pipe.AddFinalProvider(gnb, otelMetrics, queue.Final(stages, "appo11y.otel_metrics",
+		otel.ReportMetrics(exportCtx, gb.ctxInfo, &config.Metrics, config.Attributes.Select)))
 	config.Traces.Grafana = &gb.config.Grafana.OTLP
-	pipe.AddFinalProvider(gnb, otelTraces, otel.TracesReceiver(ctx, config.Traces, gb.ctxInfo))
-	pipe.AddFinalProvider(gnb, prometheus, prom.PrometheusEndpoint(ctx, gb.ctxInfo, &config.Prometheus, config.Attributes.Select))
-	pipe.AddFinalProvider(gnb, alloyTraces, alloy.TracesReceiver(ctx, &config.TracesReceiver))
+	config.Traces.Shards = shards.Count
+	pipe.AddFinalProvider(gnb, otelTraces, queue.Final(stages, "appo11y.otel_traces",
+		otel.TracesReceiver(exportCtx, config.Traces, gb.ctxInfo)))
+	pipe.AddFinalProvider(gnb, prometheus, queue.Final(stages, "appo11y.prometheus",
+		prom.PrometheusEndpoint(ctx, gb.ctxInfo, &config.Prometheus, config.Attributes.Select)))
+	pipe.AddFinalProvider(gnb, alloyTraces, queue.Final(stages, "appo11y.alloy_traces",
+		alloy.TracesReceiver(exportCtx, &config.TracesReceiver, gb.ctxInfo)))
 
 	pipe.AddFinalProvider(gnb, noop, debug.NoopNode(config.Noop))
 	pipe.AddFinalProvider(gnb, printer, debug.PrinterNode(config.Printer))
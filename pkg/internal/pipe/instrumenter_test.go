@@ -2,7 +2,9 @@ package pipe
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
@@ -15,12 +17,14 @@ import (
 	semconv "go.opentelemetry.io/otel/semconv/v1.19.0"
 
 	"github.com/grafana/beyla/pkg/beyla"
+	"github.com/grafana/beyla/pkg/buildinfo"
 	"github.com/grafana/beyla/pkg/internal/export/metric"
 	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
 	"github.com/grafana/beyla/pkg/internal/export/otel"
 	"github.com/grafana/beyla/pkg/internal/filter"
 	"github.com/grafana/beyla/pkg/internal/imetrics"
 	"github.com/grafana/beyla/pkg/internal/pipe/global"
+	"github.com/grafana/beyla/pkg/internal/pipe/shard"
 	"github.com/grafana/beyla/pkg/internal/request"
 	"github.com/grafana/beyla/pkg/internal/svc"
 	"github.com/grafana/beyla/pkg/internal/testutil"
@@ -97,12 +101,55 @@ func TestBasicPipeline(t *testing.T) {
 			string(semconv.ServiceNameKey):          "foo-svc",
 			string(semconv.TelemetrySDKLanguageKey): "go",
 			string(semconv.TelemetrySDKNameKey):     "beyla",
+			string(semconv.TelemetrySDKVersionKey):  buildinfo.Version,
+			"beyla.revision":                        buildinfo.Revision,
+			"beyla.go.version":                      runtime.Version(),
 		},
 		Type: pmetric.MetricTypeHistogram,
 	}, event)
 
 }
 
+func TestBasicPipeline_OldSemConv(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tc, err := collector.Start(ctx)
+	require.NoError(t, err)
+
+	ctxInfo := gctx(0)
+	ctxInfo.SemConv = attr.SemConvOld
+	gb := newGraphBuilder(ctx, &beyla.Config{
+		Metrics: otel.MetricsConfig{
+			Features:        []string{otel.FeatureApplication},
+			MetricsEndpoint: tc.ServerEndpoint, Interval: 10 * time.Millisecond,
+			ReportersCacheLen: 16,
+		},
+		Attributes: beyla.Attributes{Select: allMetrics},
+	}, ctxInfo, make(<-chan []request.Span))
+
+	pipe.AddStart(gb.builder, tracesReader,
+		func(out chan<- []request.Span) {
+			out <- newRequest("foo-svc", 1, "GET", "/foo/bar", "1.1.1.1:3456", 404)
+			time.Sleep(testTimeout)
+		},
+	)
+	pipe, err := gb.buildGraph()
+	require.NoError(t, err)
+
+	go pipe.Run(ctx)
+
+	// the metric and its attributes are reported with the names from the old semantic conventions
+	event := testutil.ReadChannel(t, tc.Records, testTimeout)
+	assert.Equal(t, "http.server.duration", event.Name)
+	assert.Equal(t, map[string]string{
+		string(attr.OldHTTPMethod):      "GET",
+		string(attr.OldHTTPStatusCode):  "404",
+		string(attr.OldHTTPTarget):      "/foo/bar",
+		string(attr.OldNetSockPeerAddr): "1.1.1.1",
+	}, event.Attributes)
+}
+
 func TestTracerPipeline(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -289,6 +336,9 @@ func TestRouteConsolidation(t *testing.T) {
 			string(semconv.ServiceNameKey):          "svc-1",
 			string(semconv.TelemetrySDKLanguageKey): "go",
 			string(semconv.TelemetrySDKNameKey):     "beyla",
+			string(semconv.TelemetrySDKVersionKey):  buildinfo.Version,
+			"beyla.revision":                        buildinfo.Revision,
+			"beyla.go.version":                      runtime.Version(),
 		},
 		Type: pmetric.MetricTypeHistogram,
 	}, events["/user/{id}"])
@@ -305,6 +355,9 @@ func TestRouteConsolidation(t *testing.T) {
 			string(semconv.ServiceNameKey):          "svc-1",
 			string(semconv.TelemetrySDKLanguageKey): "go",
 			string(semconv.TelemetrySDKNameKey):     "beyla",
+			string(semconv.TelemetrySDKVersionKey):  buildinfo.Version,
+			"beyla.revision":                        buildinfo.Revision,
+			"beyla.go.version":                      runtime.Version(),
 		},
 		Type: pmetric.MetricTypeHistogram,
 	}, events["/products/{id}/push"])
@@ -321,11 +374,61 @@ func TestRouteConsolidation(t *testing.T) {
 			string(semconv.ServiceNameKey):          "svc-1",
 			string(semconv.TelemetrySDKLanguageKey): "go",
 			string(semconv.TelemetrySDKNameKey):     "beyla",
+			string(semconv.TelemetrySDKVersionKey):  buildinfo.Version,
+			"beyla.revision":                        buildinfo.Revision,
+			"beyla.go.version":                      runtime.Version(),
 		},
 		Type: pmetric.MetricTypeHistogram,
 	}, events["/**"])
 }
 
+func TestRouteConsolidation_Sharded(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tc, err := collector.Start(ctx)
+	require.NoError(t, err)
+
+	gb := newGraphBuilder(ctx, &beyla.Config{
+		Metrics: otel.MetricsConfig{
+			Features:        []string{otel.FeatureApplication},
+			MetricsEndpoint: tc.ServerEndpoint, Interval: 10 * time.Millisecond,
+			ReportersCacheLen: 16,
+		},
+		Routes:         &transform.RoutesConfig{Patterns: []string{"/user/{id}", "/products/{id}/push"}},
+		Attributes:     beyla.Attributes{Select: allMetricsBut("client.address", "url.path")},
+		PipelineShards: shard.Config{Count: 4},
+	}, gctx(metric.GroupHTTPRoutes), make(<-chan []request.Span))
+	// Override eBPF tracer to send some fake data from different services
+	pipe.AddStart(gb.builder, tracesReader,
+		func(out chan<- []request.Span) {
+			for i, path := range []string{"/user/1234", "/products/3210/push", "/attach"} {
+				spans := newRequest(fmt.Sprintf("svc-%d", i+1), uint64(i), "GET", path, "1.1.1.1:3456", 200)
+				spans[0].ServiceID.UID = svc.UID(spans[0].ServiceID.Name)
+				out <- spans
+			}
+			// closing prematurely the input node would finish the whole graph processing
+			// and OTEL exporters could be closed, so we wait.
+			time.Sleep(testTimeout)
+		})
+	pipe, err := gb.buildGraph()
+	require.NoError(t, err)
+
+	go pipe.Run(ctx)
+
+	// the routes are consolidated by the shards of each service
+	routes := map[string]string{}
+	for len(routes) < 3 {
+		ev := testutil.ReadChannel(t, tc.Records, testTimeout)
+		routes[ev.ResourceAttributes[string(semconv.ServiceNameKey)]] = ev.Attributes[string(semconv.HTTPRouteKey)]
+	}
+	assert.Equal(t, map[string]string{
+		"svc-1": "/user/{id}",
+		"svc-2": "/products/{id}/push",
+		"svc-3": "/**",
+	}, routes)
+}
+
 func TestGRPCPipeline(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -370,6 +473,9 @@ func TestGRPCPipeline(t *testing.T) {
 			string(semconv.ServiceNameKey):          "grpc-svc",
 			string(semconv.TelemetrySDKLanguageKey): "go",
 			string(semconv.TelemetrySDKNameKey):     "beyla",
+			string(semconv.TelemetrySDKVersionKey):  buildinfo.Version,
+			"beyla.revision":                        buildinfo.Revision,
+			"beyla.go.version":                      runtime.Version(),
 		},
 		Type: pmetric.MetricTypeHistogram,
 	}, event)
@@ -448,6 +554,9 @@ func TestBasicPipelineInfo(t *testing.T) {
 			string(semconv.ServiceNameKey):          "comm",
 			string(semconv.TelemetrySDKLanguageKey): "go",
 			string(semconv.TelemetrySDKNameKey):     "beyla",
+			string(semconv.TelemetrySDKVersionKey):  buildinfo.Version,
+			"beyla.revision":                        buildinfo.Revision,
+			"beyla.go.version":                      runtime.Version(),
 		},
 		Type: pmetric.MetricTypeHistogram,
 	}, event)
@@ -614,6 +723,9 @@ func matchTraceEvent(t require.TestingT, name string, event collector.TraceRecor
 			string(semconv.ServiceNameKey):          "bar-svc",
 			string(semconv.TelemetrySDKLanguageKey): "go",
 			string(semconv.TelemetrySDKNameKey):     "beyla",
+			string(semconv.TelemetrySDKVersionKey):  buildinfo.Version,
+			"beyla.revision":                        buildinfo.Revision,
+			"beyla.go.version":                      runtime.Version(),
 			string(semconv.OTelLibraryNameKey):      "github.com/grafana/beyla",
 		},
 		Kind: ptrace.SpanKindServer,
@@ -632,6 +744,9 @@ func matchInnerTraceEvent(t require.TestingT, name string, event collector.Trace
 			string(semconv.ServiceNameKey):          "bar-svc",
 			string(semconv.TelemetrySDKLanguageKey): "go",
 			string(semconv.TelemetrySDKNameKey):     "beyla",
+			string(semconv.TelemetrySDKVersionKey):  buildinfo.Version,
+			"beyla.revision":                        buildinfo.Revision,
+			"beyla.go.version":                      runtime.Version(),
 			string(semconv.OTelLibraryNameKey):      "github.com/grafana/beyla",
 		},
 		Kind: ptrace.SpanKindInternal,
@@ -655,6 +770,9 @@ func matchGRPCTraceEvent(t *testing.T, name string, event collector.TraceRecord)
 			string(semconv.ServiceNameKey):          "svc",
 			string(semconv.TelemetrySDKLanguageKey): "go",
 			string(semconv.TelemetrySDKNameKey):     "beyla",
+			string(semconv.TelemetrySDKVersionKey):  buildinfo.Version,
+			"beyla.revision":                        buildinfo.Revision,
+			"beyla.go.version":                      runtime.Version(),
 			string(semconv.OTelLibraryNameKey):      "github.com/grafana/beyla",
 		},
 		Kind: ptrace.SpanKindServer,
@@ -672,6 +790,9 @@ func matchInnerGRPCTraceEvent(t *testing.T, name string, event collector.TraceRe
 			string(semconv.ServiceNameKey):          "svc",
 			string(semconv.TelemetrySDKLanguageKey): "go",
 			string(semconv.TelemetrySDKNameKey):     "beyla",
+			string(semconv.TelemetrySDKVersionKey):  buildinfo.Version,
+			"beyla.revision":                        buildinfo.Revision,
+			"beyla.go.version":                      runtime.Version(),
 			string(semconv.OTelLibraryNameKey):      "github.com/grafana/beyla",
 		},
 		Kind: ptrace.SpanKindInternal,
@@ -724,6 +845,9 @@ func matchInfoEvent(t *testing.T, name string, event collector.TraceRecord) {
 			string(semconv.ServiceNameKey):          "comm",
 			string(semconv.TelemetrySDKLanguageKey): "go",
 			string(semconv.TelemetrySDKNameKey):     "beyla",
+			string(semconv.TelemetrySDKVersionKey):  buildinfo.Version,
+			"beyla.revision":                        buildinfo.Revision,
+			"beyla.go.version":                      runtime.Version(),
 			string(semconv.OTelLibraryNameKey):      "github.com/grafana/beyla",
 		},
 		Kind: ptrace.SpanKindServer,
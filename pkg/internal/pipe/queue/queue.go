@@ -0,0 +1,150 @@
+// Package queue provides configurable input queues for the pipeline stages, with an explicit
+// policy for the data that can't be enqueued when a stage can't keep the pace of its inputs.
+package queue
+
+import (
+	"fmt"
+
+	"github.com/mariomac/pipes/pipe"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+)
+
+// Overflow policy of a stage queue
+type Overflow string
+
+const (
+	// Block the previous stages until the stage queue has room for the new data
+	Block = Overflow("block")
+	// DropOldest discards the oldest data in the queue to make room for the new data
+	DropOldest = Overflow("drop_oldest")
+	// DropNewest discards the new data
+	DropNewest = Overflow("drop_newest")
+)
+
+// Config of the input queue of a pipeline stage
+type Config struct {
+	// Size of the queue, in batches of data. If 0, it defaults to the channel_buffer_len property.
+	Size int `yaml:"size"`
+	// Overflow policy when the queue is full. If empty, it defaults to block.
+	Overflow Overflow `yaml:"overflow"`
+}
+
+func (c *Config) Validate() error {
+	if c.Size < 0 {
+		return fmt.Errorf("size can't be negative. Got: %d", c.Size)
+	}
+	switch c.Overflow {
+	case "", Block, DropOldest, DropNewest:
+		return nil
+	}
+	return fmt.Errorf("unknown overflow policy %q, choices are [%s, %s, %s]",
+		c.Overflow, Block, DropOldest, DropNewest)
+}
+
+// Stages provides the input queues of the pipeline stages, according to their configuration.
+type Stages struct {
+	byStage map[string]Config
+	// defaultSize is the length of the channels between the stages
+	defaultSize int
+	metrics     imetrics.Reporter
+}
+
+// NewStages returns the stage queues for the provided configuration, indexed by stage name.
+// The defaultSize is the length of the channels between the stages of the pipeline.
+func NewStages(byStage map[string]Config, defaultSize int, metrics imetrics.Reporter) *Stages {
+	if metrics == nil {
+		metrics = imetrics.NoopReporter{}
+	}
+	return &Stages{byStage: byStage, defaultSize: defaultSize, metrics: metrics}
+}
+
+// queueFor returns the configuration of the queue for a stage. It returns false if the stage
+// does not require any other queue than the channel from the previous stage.
+func (s *Stages) queueFor(stage string) (Config, bool) {
+	cfg, ok := s.byStage[stage]
+	if !ok {
+		return cfg, false
+	}
+	if cfg.Overflow == "" {
+		cfg.Overflow = Block
+	}
+	if cfg.Size == 0 {
+		cfg.Size = s.defaultSize
+	}
+	return cfg, cfg.Overflow != Block || cfg.Size != s.defaultSize
+}
+
+// Middle wraps the provider of a middle pipeline stage to instrument it, and to read its inputs
+// through the configured queue.
+func Middle[IN, OUT any](s *Stages, stage string, provider pipe.MiddleProvider[IN, OUT]) pipe.MiddleProvider[IN, OUT] {
+	provider = imetrics.InstrumentMiddle(s.metrics, stage, provider)
+	cfg, ok := s.queueFor(stage)
+	if !ok {
+		return provider
+	}
+	return func() (pipe.MiddleFunc[IN, OUT], error) {
+		node, err := provider()
+		if err != nil || node == nil {
+			return node, err
+		}
+		return func(in <-chan IN, out chan<- OUT) {
+			node(enqueue(s.metrics, stage, &cfg, in), out)
+		}, nil
+	}
+}
+
+// Final wraps the provider of a final pipeline stage to instrument it, and to read its inputs
+// through the configured queue.
+func Final[IN any](s *Stages, stage string, provider pipe.FinalProvider[IN]) pipe.FinalProvider[IN] {
+	provider = imetrics.InstrumentFinal(s.metrics, stage, provider)
+	cfg, ok := s.queueFor(stage)
+	if !ok {
+		return provider
+	}
+	return func() (pipe.FinalFunc[IN], error) {
+		node, err := provider()
+		if err != nil || node == nil {
+			return node, err
+		}
+		return func(in <-chan IN) {
+			node(enqueue(s.metrics, stage, &cfg, in))
+		}, nil
+	}
+}
+
+// enqueue forwards the inputs to a queue with the configured size and overflow policy.
+// The queue is closed when the input channel is closed.
+func enqueue[IN any](metrics imetrics.Reporter, stage string, cfg *Config, in <-chan IN) <-chan IN {
+	queue := make(chan IN, cfg.Size)
+	go func() {
+		defer close(queue)
+		for i := range in {
+			switch cfg.Overflow {
+			case DropNewest:
+				select {
+				case queue <- i:
+				default:
+					metrics.PipelineQueueDrop(stage)
+				}
+			case DropOldest:
+				for sent := false; !sent; {
+					select {
+					case queue <- i:
+						sent = true
+					default:
+						// the stage might have taken the oldest input in the meantime
+						select {
+						case <-queue:
+							metrics.PipelineQueueDrop(stage)
+						default:
+						}
+					}
+				}
+			default:
+				queue <- i
+			}
+		}
+	}()
+	return queue
+}
@@ -0,0 +1,143 @@
+package queue
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mariomac/guara/pkg/test"
+	"github.com/mariomac/pipes/pipe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+	"github.com/grafana/beyla/pkg/internal/testutil"
+)
+
+const timeout = 5 * time.Second
+
+type queueMetrics struct {
+	imetrics.NoopReporter
+	mt    sync.Mutex
+	drops map[string]int
+}
+
+func (m *queueMetrics) PipelineQueueDrop(stage string) {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	m.drops[stage]++
+}
+
+func (m *queueMetrics) dropped(stage string) int {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	return m.drops[stage]
+}
+
+// stalledFinal returns a final stage that does not read its input until the returned channel is closed
+func stalledFinal(received chan<- int) (pipe.FinalProvider[int], chan struct{}) {
+	unblock := make(chan struct{})
+	return func() (pipe.FinalFunc[int], error) {
+		return func(in <-chan int) {
+			<-unblock
+			for i := range in {
+				received <- i
+			}
+			close(received)
+		}, nil
+	}, unblock
+}
+
+func TestEnqueue_Overflow(t *testing.T) {
+	type testCase struct {
+		overflow Overflow
+		expected []int
+	}
+	for _, tc := range []testCase{
+		{overflow: DropNewest, expected: []int{0, 1, 2}},
+		{overflow: DropOldest, expected: []int{7, 8, 9}},
+	} {
+		t.Run(string(tc.overflow), func(t *testing.T) {
+			metrics := &queueMetrics{drops: map[string]int{}}
+			in := make(chan int)
+			queue := enqueue[int](metrics, "stage", &Config{Size: 3, Overflow: tc.overflow}, in)
+
+			// WHEN the stage does not read its inputs
+			for i := 0; i < 10; i++ {
+				// THEN the previous stages are not blocked
+				select {
+				case in <- i:
+				case <-time.After(timeout):
+					require.Fail(t, "the input should not block")
+				}
+			}
+			close(in)
+			// AND the data that doesn't fit in the queue is dropped
+			test.Eventually(t, timeout, func(t require.TestingT) {
+				require.Equal(t, 7, metrics.dropped("stage"))
+			})
+			var got []int
+			for i := range queue {
+				got = append(got, i)
+			}
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestFinal_Block(t *testing.T) {
+	stages := NewStages(map[string]Config{"stage": {Size: 3}}, 10, imetrics.NoopReporter{})
+	received := make(chan int, 10)
+	provider, unblock := stalledFinal(received)
+	node, err := Final(stages, "stage", provider)()
+	require.NoError(t, err)
+
+	in := make(chan int)
+	go node(in)
+	// the queue accepts its size, plus the input that is waiting to be enqueued
+	for i := 0; i < 4; i++ {
+		in <- i
+	}
+	// WHEN the queue is full THEN the previous stages are blocked
+	select {
+	case in <- 4:
+		require.Fail(t, "the input should block")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(unblock)
+	in <- 4
+	close(in)
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, i, testutil.ReadChannel(t, received, timeout))
+	}
+}
+
+func TestMiddle_NoQueue(t *testing.T) {
+	stages := NewStages(map[string]Config{"stage": {Size: 10, Overflow: Block}}, 10, imetrics.NoopReporter{})
+	provider := func() (pipe.MiddleFunc[int, int], error) {
+		return func(in <-chan int, out chan<- int) {
+			for i := range in {
+				out <- i * 2
+			}
+		}, nil
+	}
+	_, ok := stages.queueFor("stage")
+	assert.False(t, ok)
+	_, ok = stages.queueFor("other")
+	assert.False(t, ok)
+
+	node, err := Middle(stages, "stage", provider)()
+	require.NoError(t, err)
+	in, out := make(chan int, 1), make(chan int, 1)
+	in <- 2
+	close(in)
+	node(in, out)
+	assert.Equal(t, 4, <-out)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.NoError(t, (&Config{}).Validate())
+	assert.NoError(t, (&Config{Size: 100, Overflow: DropOldest}).Validate())
+	assert.Error(t, (&Config{Size: -1}).Validate())
+	assert.Error(t, (&Config{Overflow: "drop_all"}).Validate())
+}
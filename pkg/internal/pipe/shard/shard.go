@@ -0,0 +1,235 @@
+// Package shard splits the processing of the application spans into independent shards, each of
+// them processing the spans of a subset of the instrumented services. This way, a service that
+// generates a huge volume of spans, or spans that are expensive to process, only slows down the
+// services in its own shard.
+package shard
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mariomac/pipes/pipe"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+	"github.com/grafana/beyla/pkg/internal/pipe/queue"
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+func shlog() *slog.Logger {
+	return slog.With("component", "shard.Spans")
+}
+
+var timeNow = time.Now
+
+// Config of the sharding of the application spans pipeline
+type Config struct {
+	// Count of shards. If 0 or 1, the pipeline is not sharded.
+	Count int `yaml:"count" env:"BEYLA_PIPELINE_SHARDS"`
+	// QueueSize of the input queue of each shard, in batches of spans. If 0, it defaults to the
+	// channel_buffer_len property.
+	QueueSize int `yaml:"queue_size" env:"BEYLA_PIPELINE_SHARD_QUEUE_SIZE"`
+	// Overflow policy when the input queue of a shard is full. If empty, it defaults to drop_oldest.
+	Overflow queue.Overflow `yaml:"overflow" env:"BEYLA_PIPELINE_SHARD_OVERFLOW"`
+}
+
+func (c *Config) Enabled() bool {
+	return c.Count > 1
+}
+
+func (c *Config) Validate() error {
+	if c.Count < 0 {
+		return fmt.Errorf("count can't be negative. Got: %d", c.Count)
+	}
+	return (&queue.Config{Size: c.QueueSize, Overflow: c.Overflow}).Validate()
+}
+
+// Of returns the shard, in the range [0, shards), that processes the spans of the given service.
+// The shard is calculated from the service UID, which is assigned when the spans are read, so
+// it doesn't change during the processing of the spans.
+func Of(id *svc.ID, shards int) int {
+	if shards <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	if id.UID != "" {
+		_, _ = h.Write([]byte(id.UID))
+	} else {
+		_, _ = h.Write([]byte(id.Namespace + "/" + id.Name))
+	}
+	return int(h.Sum32() % uint32(shards))
+}
+
+// Unsharded wraps the provider of a pipeline stage that is part of the sharded chain of stages, so it
+// is bypassed when the pipeline is sharded, as the stage already runs inside each shard.
+func Unsharded(cfg *Config, provider pipe.MiddleProvider[[]request.Span, []request.Span]) pipe.MiddleProvider[[]request.Span, []request.Span] {
+	if !cfg.Enabled() {
+		return provider
+	}
+	return func() (pipe.MiddleFunc[[]request.Span, []request.Span], error) {
+		return pipe.Bypass[[]request.Span](), nil
+	}
+}
+
+// Spans returns the provider of a pipeline stage that distributes the spans among the configured number
+// of shards, according to their service, and runs a separate instance of the provided chain of stages
+// for each shard. Each shard reads its spans from its own bounded queue, so a shard that can't keep the
+// pace of its input does not block the rest of shards unless the overflow policy is block.
+// The outputs of all the shards are merged into the output of the stage. The order of the spans is
+// kept for each service, but not between services in different shards.
+// If the sharding is disabled, the stage is bypassed.
+func Spans(
+	cfg *Config, defaultQueueSize int, metrics imetrics.Reporter,
+	chain ...pipe.MiddleProvider[[]request.Span, []request.Span],
+) pipe.MiddleProvider[[]request.Span, []request.Span] {
+	return func() (pipe.MiddleFunc[[]request.Span, []request.Span], error) {
+		if !cfg.Enabled() {
+			return pipe.Bypass[[]request.Span](), nil
+		}
+		if metrics == nil {
+			metrics = imetrics.NoopReporter{}
+		}
+		queueSize := cfg.QueueSize
+		if queueSize == 0 {
+			queueSize = defaultQueueSize
+		}
+		overflow := cfg.Overflow
+		if overflow == "" {
+			overflow = queue.DropOldest
+		}
+		shards := make([]*shard, cfg.Count)
+		for i := range shards {
+			sh := &shard{
+				label:    strconv.Itoa(i),
+				overflow: overflow,
+				queue:    make(chan []request.Span, queueSize),
+				bufLen:   defaultQueueSize,
+				metrics:  metrics,
+			}
+			for _, provider := range chain {
+				node, err := provider()
+				if err != nil {
+					return nil, fmt.Errorf("instantiating pipeline shard %d: %w", i, err)
+				}
+				// bypassed stages are not part of the shard chain
+				if node != nil {
+					sh.nodes = append(sh.nodes, node)
+				}
+			}
+			shards[i] = sh
+		}
+		return func(in <-chan []request.Span, out chan<- []request.Span) {
+			distribute(shards, in, out)
+		}, nil
+	}
+}
+
+// distribute forwards the spans from each input batch to the shards of their services, until
+// the input channel is closed and all the shards have processed their pending spans.
+func distribute(shards []*shard, in <-chan []request.Span, out chan<- []request.Span) {
+	wg := sync.WaitGroup{}
+	wg.Add(len(shards))
+	for _, sh := range shards {
+		go func() {
+			defer wg.Done()
+			sh.run(out)
+		}()
+	}
+	split := make([][]request.Span, len(shards))
+	for spans := range in {
+		for i := range spans {
+			n := Of(&spans[i].ServiceID, len(shards))
+			split[n] = append(split[n], spans[i])
+		}
+		for n := range split {
+			if len(split[n]) > 0 {
+				shards[n].push(split[n])
+				split[n] = nil
+			}
+		}
+	}
+	for _, sh := range shards {
+		close(sh.queue)
+	}
+	wg.Wait()
+}
+
+// shard runs its own instance of the chain of pipeline stages, reading from its own input queue
+type shard struct {
+	label    string
+	overflow queue.Overflow
+	queue    chan []request.Span
+	// bufLen is the length of the channels between the stages of the shard
+	bufLen  int
+	nodes   []pipe.MiddleFunc[[]request.Span, []request.Span]
+	metrics imetrics.Reporter
+}
+
+// push adds a batch of spans to the input queue of the shard, according to its overflow policy
+func (s *shard) push(spans []request.Span) {
+	s.metrics.PipelineShardThroughput(s.label, len(spans))
+	switch s.overflow {
+	case queue.DropNewest:
+		select {
+		case s.queue <- spans:
+		default:
+			s.drop(spans)
+		}
+	case queue.DropOldest:
+		for sent := false; !sent; {
+			select {
+			case s.queue <- spans:
+				sent = true
+			default:
+				// the shard might have taken the oldest batch in the meantime
+				select {
+				case oldest := <-s.queue:
+					s.drop(oldest)
+				default:
+				}
+			}
+		}
+	default:
+		s.queue <- spans
+	}
+}
+
+func (s *shard) drop(spans []request.Span) {
+	s.metrics.PipelineShardDrop(s.label, len(spans))
+	shlog().Debug("shard queue is full. Dropping spans", "shard", s.label, "spans", len(spans),
+		"service", spans[0].ServiceID.Name, "namespace", spans[0].ServiceID.Namespace)
+}
+
+// run processes the input queue of the shard through its chain of stages and forwards the
+// output to the passed channel, until the input queue is closed.
+func (s *shard) run(out chan<- []request.Span) {
+	// time when the shard took the batch that is being processed
+	var taken atomic.Int64
+	nodeIn := make(chan []request.Span)
+	go func() {
+		defer close(nodeIn)
+		for spans := range s.queue {
+			s.metrics.PipelineShardQueueDepth(s.label, len(s.queue))
+			nodeIn <- spans
+			taken.Store(timeNow().UnixNano())
+		}
+	}()
+	var chainOut <-chan []request.Span = nodeIn
+	for _, node := range s.nodes {
+		nodeOut := make(chan []request.Span, s.bufLen)
+		go func(in <-chan []request.Span) {
+			node(in, nodeOut)
+			close(nodeOut)
+		}(chainOut)
+		chainOut = nodeOut
+	}
+	for spans := range chainOut {
+		s.metrics.PipelineShardLatency(s.label, timeNow().Sub(time.Unix(0, taken.Load())))
+		out <- spans
+	}
+}
@@ -0,0 +1,208 @@
+package shard
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mariomac/pipes/pipe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+	"github.com/grafana/beyla/pkg/internal/pipe/queue"
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+const timeout = 5 * time.Second
+
+type shardMetrics struct {
+	imetrics.NoopReporter
+	mt      sync.Mutex
+	spans   map[string]int
+	dropped map[string]int
+}
+
+func newShardMetrics() *shardMetrics {
+	return &shardMetrics{spans: map[string]int{}, dropped: map[string]int{}}
+}
+
+func (m *shardMetrics) PipelineShardThroughput(shard string, spans int) {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	m.spans[shard] += spans
+}
+
+func (m *shardMetrics) PipelineShardDrop(shard string, spans int) {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	m.dropped[shard] += spans
+}
+
+func (m *shardMetrics) get(counter map[string]int, shard int) int {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	return counter[fmt.Sprint(shard)]
+}
+
+// servicesInShards returns services whose spans are processed by different shards
+func servicesInShards(t *testing.T, shards int) []svc.ID {
+	t.Helper()
+	services := make([]svc.ID, shards)
+	found := 0
+	for i := 0; found < shards && i < 1000; i++ {
+		id := svc.ID{Name: fmt.Sprintf("svc-%d", i), UID: svc.UID(fmt.Sprintf("host-%d", i))}
+		if n := Of(&id, shards); services[n].UID == "" {
+			services[n] = id
+			found++
+		}
+	}
+	require.Equal(t, shards, found, "can't find services for all the shards")
+	return services
+}
+
+func TestOf(t *testing.T) {
+	id := svc.ID{Name: "foo", Namespace: "bar", UID: "host-1234"}
+	shard := Of(&id, 8)
+	assert.GreaterOrEqual(t, shard, 0)
+	assert.Less(t, shard, 8)
+
+	// the shard only depends on the service UID
+	decorated := id
+	decorated.Name, decorated.Namespace = "foo-deployment", "production"
+	assert.Equal(t, shard, Of(&decorated, 8))
+
+	assert.Zero(t, Of(&id, 1))
+	assert.Zero(t, Of(&id, 0))
+}
+
+func TestSpans_Disabled(t *testing.T) {
+	for _, count := range []int{0, 1} {
+		node, err := Spans(&Config{Count: count}, 10, nil, passThrough)()
+		require.NoError(t, err)
+		assert.Nil(t, node, "the shards node should be bypassed")
+	}
+	// the sharded stages are only bypassed when the sharding is enabled
+	node, err := Unsharded(&Config{Count: 1}, passThrough)()
+	require.NoError(t, err)
+	assert.NotNil(t, node)
+	node, err = Unsharded(&Config{Count: 2}, passThrough)()
+	require.NoError(t, err)
+	assert.Nil(t, node)
+}
+
+func passThrough() (pipe.MiddleFunc[[]request.Span, []request.Span], error) {
+	return func(in <-chan []request.Span, out chan<- []request.Span) {
+		for spans := range in {
+			out <- spans
+		}
+	}, nil
+}
+
+func TestSpans_ChainPerShard(t *testing.T) {
+	// GIVEN a sharded stage whose chain contains a stage and a bypassed stage
+	instances := 0
+	counter := func() (pipe.MiddleFunc[[]request.Span, []request.Span], error) {
+		instances++
+		return passThrough()
+	}
+	bypassed := func() (pipe.MiddleFunc[[]request.Span, []request.Span], error) {
+		return pipe.Bypass[[]request.Span](), nil
+	}
+	node, err := Spans(&Config{Count: 3}, 10, nil, counter, bypassed)()
+	require.NoError(t, err)
+
+	// THEN each shard gets its own instance of the chain
+	assert.Equal(t, 3, instances)
+
+	// AND all the input spans are forwarded to the output
+	services := servicesInShards(t, 3)
+	in := make(chan []request.Span, 10)
+	out := make(chan []request.Span, 10)
+	in <- []request.Span{
+		{ServiceID: services[0], Path: "/a"},
+		{ServiceID: services[1], Path: "/b"},
+		{ServiceID: services[0], Path: "/c"},
+		{ServiceID: services[2], Path: "/d"},
+	}
+	close(in)
+	node(in, out)
+	close(out)
+	paths := map[string][]string{}
+	for spans := range out {
+		for _, s := range spans {
+			paths[s.ServiceID.Name] = append(paths[s.ServiceID.Name], s.Path)
+		}
+	}
+	// keeping the order of the spans of each service
+	assert.Equal(t, map[string][]string{
+		services[0].Name: {"/a", "/c"},
+		services[1].Name: {"/b"},
+		services[2].Name: {"/d"},
+	}, paths)
+}
+
+func TestSpans_NoisyNeighbor(t *testing.T) {
+	// GIVEN a sharded stage whose processing blocks for the spans of a given service
+	services := servicesInShards(t, 2)
+	noisy, quiet := services[0], services[1]
+	unblock := make(chan struct{})
+	blocker := func() (pipe.MiddleFunc[[]request.Span, []request.Span], error) {
+		return func(in <-chan []request.Span, out chan<- []request.Span) {
+			for spans := range in {
+				if spans[0].ServiceID.UID == noisy.UID {
+					<-unblock
+				}
+				out <- spans
+			}
+		}, nil
+	}
+	metrics := newShardMetrics()
+	node, err := Spans(&Config{Count: 2, QueueSize: 2, Overflow: queue.DropOldest}, 2, metrics, blocker)()
+	require.NoError(t, err)
+	in := make(chan []request.Span)
+	out := make(chan []request.Span, 100)
+	done := make(chan struct{})
+	go func() {
+		node(in, out)
+		close(done)
+	}()
+
+	// WHEN the noisy service generates more spans than its shard can process
+	for i := 0; i < 20; i++ {
+		in <- []request.Span{{ServiceID: noisy}, {ServiceID: quiet}}
+
+		// THEN the spans of the services in other shards keep being forwarded
+		select {
+		case spans := <-out:
+			require.Len(t, spans, 1)
+			assert.Equal(t, quiet.UID, spans[0].ServiceID.UID)
+		case <-time.After(timeout):
+			require.Fail(t, "the quiet service spans were not forwarded")
+		}
+	}
+
+	// AND the spans that exceed the budget of the noisy shard are dropped and accounted by shard
+	assert.Equal(t, 20, metrics.get(metrics.spans, 0))
+	assert.Equal(t, 20, metrics.get(metrics.spans, 1))
+	assert.Positive(t, metrics.get(metrics.dropped, 0))
+	assert.Zero(t, metrics.get(metrics.dropped, 1))
+
+	// AND the remaining spans of the noisy shard are forwarded when it is unblocked
+	close(unblock)
+	close(in)
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		require.Fail(t, "the shards did not end")
+	}
+	close(out)
+	forwarded := 0
+	for spans := range out {
+		assert.Equal(t, noisy.UID, spans[0].ServiceID.UID)
+		forwarded += len(spans)
+	}
+	assert.Equal(t, 20, forwarded+metrics.get(metrics.dropped, 0))
+}
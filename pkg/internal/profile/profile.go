@@ -0,0 +1,129 @@
+// Package profile provides the means to profile Beyla itself: the net/http/pprof
+// endpoints and the dump of heap profiles into files on demand.
+package profile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"runtime"
+	rpprof "runtime/pprof"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Path where the pprof endpoints are served
+const Path = "/debug/pprof/"
+
+func plog() *slog.Logger {
+	return slog.With("component", "profile.Profiler")
+}
+
+// Config for profiling Beyla. All the profiling features are disabled by default.
+type Config struct {
+	// Port of a separate HTTP listener for the pprof endpoints. It only listens in the localhost interface.
+	Port int `yaml:"port" env:"BEYLA_PROFILE_PORT"`
+	// InternalPort serves the pprof endpoints from the internal metrics Prometheus port
+	InternalPort bool `yaml:"internal_port" env:"BEYLA_PROFILE_INTERNAL_PORT"`
+	// MutexProfileFraction reports, on average, 1/n of the mutex contention events. 0 disables the mutex profile.
+	MutexProfileFraction int `yaml:"mutex_profile_fraction" env:"BEYLA_PROFILE_MUTEX_FRACTION"`
+	// BlockProfileRate samples, on average, one blocking event per each n nanoseconds spent blocked.
+	// 0 disables the block profile.
+	BlockProfileRate int `yaml:"block_profile_rate" env:"BEYLA_PROFILE_BLOCK_RATE"`
+	// HeapDumpDir is the folder where a heap profile is written each time Beyla receives the SIGUSR2 signal.
+	// If empty, the signal is ignored.
+	HeapDumpDir string `yaml:"heap_dump_dir" env:"BEYLA_PROFILE_HEAP_DUMP_DIR"`
+}
+
+// Handler returns the HTTP handler of the pprof endpoints, which must be registered under the Path
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(Path, pprof.Index)
+	mux.HandleFunc(path.Join(Path, "cmdline"), pprof.Cmdline)
+	mux.HandleFunc(path.Join(Path, "profile"), pprof.Profile)
+	mux.HandleFunc(path.Join(Path, "symbol"), pprof.Symbol)
+	mux.HandleFunc(path.Join(Path, "trace"), pprof.Trace)
+	return mux
+}
+
+// Start the profiling features that are enabled in the configuration, until the context is canceled.
+// The pprof endpoints of the internal metrics port are not started here, as they need to be registered
+// through the Prometheus manager.
+func Start(ctx context.Context, cfg *Config) {
+	if cfg.MutexProfileFraction > 0 {
+		runtime.SetMutexProfileFraction(cfg.MutexProfileFraction)
+	}
+	if cfg.BlockProfileRate > 0 {
+		runtime.SetBlockProfileRate(cfg.BlockProfileRate)
+	}
+	if cfg.Port != 0 {
+		go listenAndServe(ctx, cfg.Port)
+	}
+	if cfg.HeapDumpDir != "" {
+		// registering the signal before returning, so it does not terminate Beyla after Start
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGUSR2)
+		go dumpHeapOnSignal(ctx, cfg.HeapDumpDir, signals)
+	}
+}
+
+func listenAndServe(ctx context.Context, port int) {
+	log := plog().With("port", port)
+	server := http.Server{
+		Addr:              net.JoinHostPort("localhost", strconv.Itoa(port)),
+		Handler:           Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	log.Info("starting PProf HTTP listener")
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error("PProf HTTP listener stopped working", "error", err)
+	}
+}
+
+func dumpHeapOnSignal(ctx context.Context, dir string, signals chan os.Signal) {
+	log := plog().With("dir", dir)
+	defer signal.Stop(signals)
+	log.Debug("listening for SIGUSR2 to dump heap profiles")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			if file, err := dumpHeap(dir); err != nil {
+				log.Error("can't write heap profile", "error", err)
+			} else {
+				log.Info("heap profile written", "file", file)
+			}
+		}
+	}
+}
+
+// dumpHeap writes a heap profile into a new file of the provided folder, and returns the file path
+func dumpHeap(dir string) (string, error) {
+	file := filepath.Join(dir, fmt.Sprintf("beyla-heap-%d-%s.pprof",
+		os.Getpid(), time.Now().Format("20060102T150405.000")))
+	out, err := os.Create(file)
+	if err != nil {
+		return "", fmt.Errorf("creating heap profile file: %w", err)
+	}
+	defer out.Close()
+	// get up-to-date statistics about the live objects
+	runtime.GC()
+	if err := rpprof.WriteHeapProfile(out); err != nil {
+		return "", fmt.Errorf("writing heap profile: %w", err)
+	}
+	return file, nil
+}
@@ -0,0 +1,47 @@
+package profile
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+
+	for _, p := range []string{"", "heap", "goroutine", "mutex", "block", "cmdline", "symbol"} {
+		resp, err := http.Get(server.URL + Path + p)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equalf(t, http.StatusOK, resp.StatusCode, "path: %s", Path+p)
+	}
+}
+
+func TestDumpHeapOnSignal(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	Start(ctx, &Config{HeapDumpDir: dir})
+
+	// WHEN Beyla receives a SIGUSR2 signal
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR2))
+
+	// THEN a heap profile is written in the configured folder
+	assert.Eventually(t, func() bool {
+		files, _ := filepath.Glob(filepath.Join(dir, "beyla-heap-*.pprof"))
+		if len(files) == 0 {
+			return false
+		}
+		info, err := os.Stat(files[0])
+		return err == nil && info.Size() > 0
+	}, 5*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,220 @@
+package reload
+
+import (
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	yamlUnmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// maxHashDepth protects the hash function from cyclic data structures
+const maxHashDepth = 64
+
+// yamlField is a struct field that can be set from the YAML configuration
+type yamlField struct {
+	name   string
+	index  int
+	inline bool
+}
+
+func yamlFields(t reflect.Type) []yamlField {
+	var fields []yamlField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("yaml")
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			// default yaml.v3 naming for untagged fields
+			name = strings.ToLower(f.Name)
+		}
+		fields = append(fields, yamlField{name: name, index: i, inline: strings.Contains(opts, "inline")})
+	}
+	return fields
+}
+
+// isLeaf returns true if the value of the type must be compared as a whole, instead of
+// comparing each of its fields
+func isLeaf(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return true
+	}
+	ptr := reflect.PointerTo(t)
+	if ptr.Implements(yamlUnmarshalerType) || ptr.Implements(textUnmarshalerType) {
+		return true
+	}
+	return len(yamlFields(t)) == 0
+}
+
+// diff returns the dot-separated YAML paths of the configuration properties that
+// are different between the old and new configurations, which must be of the same type.
+func diff(old, new any) []string {
+	var changed []string
+	diffValue(reflect.ValueOf(old), reflect.ValueOf(new), "", &changed)
+	sort.Strings(changed)
+	return changed
+}
+
+func diffValue(old, new reflect.Value, path string, changed *[]string) {
+	if old.Kind() == reflect.Pointer {
+		if old.IsNil() || new.IsNil() {
+			if old.IsNil() != new.IsNil() {
+				*changed = append(*changed, path)
+			}
+			return
+		}
+		diffValue(old.Elem(), new.Elem(), path, changed)
+		return
+	}
+	if isLeaf(old.Type()) {
+		if !reflect.DeepEqual(old.Interface(), new.Interface()) {
+			*changed = append(*changed, path)
+		}
+		return
+	}
+	for _, f := range yamlFields(old.Type()) {
+		fieldPath := path
+		if !f.inline {
+			fieldPath = joinPath(path, f.name)
+		}
+		diffValue(old.Field(f.index), new.Field(f.index), fieldPath, changed)
+	}
+}
+
+func joinPath(parent, child string) string {
+	if parent == "" {
+		return child
+	}
+	return parent + "." + child
+}
+
+// affects returns true if the changed path is the provided key or any of its sub-properties
+func affects(key, changed string) bool {
+	return changed == key || strings.HasPrefix(changed, key+".")
+}
+
+// field returns the value of the property in the provided dot-separated YAML path
+func field(v reflect.Value, path string) (reflect.Value, error) {
+	if path == "" {
+		return v, nil
+	}
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return reflect.Value{}, fmt.Errorf("can't access %q: parent property is nil", path)
+		}
+		v = v.Elem()
+	}
+	name, rest, _ := strings.Cut(path, ".")
+	if v.Kind() == reflect.Struct {
+		for _, f := range yamlFields(v.Type()) {
+			if f.name == name {
+				return field(v.Field(f.index), rest)
+			}
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("unknown configuration property %q", name)
+}
+
+// setField copies the property in the provided dot-separated YAML path from the src
+// to the dst value. The pointers in the path are copied before being modified, so the
+// configuration where the dst value was copied from is not modified.
+func setField(dst, src reflect.Value, path string) error {
+	if path == "" {
+		dst.Set(src)
+		return nil
+	}
+	if dst.Kind() == reflect.Pointer {
+		if dst.IsNil() || src.IsNil() {
+			return fmt.Errorf("can't set %q: parent property is nil", path)
+		}
+		clone := reflect.New(dst.Type().Elem())
+		clone.Elem().Set(dst.Elem())
+		dst.Set(clone)
+		return setField(clone.Elem(), src.Elem(), path)
+	}
+	name, rest, _ := strings.Cut(path, ".")
+	if dst.Kind() == reflect.Struct {
+		for _, f := range yamlFields(dst.Type()) {
+			if f.name == name {
+				return setField(dst.Field(f.index), src.Field(f.index), rest)
+			}
+		}
+	}
+	return fmt.Errorf("unknown configuration property %q", name)
+}
+
+// configHash returns a hash of the whole configuration, including the internal values of
+// the properties that are only accessible through their unmarshallers (e.g. regular expressions)
+func configHash(cfg any) string {
+	h := sha256.New()
+	hashValue(h, reflect.ValueOf(cfg), 0)
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func hashValue(h hash.Hash, v reflect.Value, depth int) {
+	if depth > maxHashDepth {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			h.Write([]byte("nil;"))
+			return
+		}
+		hashValue(h, v.Elem(), depth+1)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if name, _, _ := strings.Cut(f.Tag.Get("yaml"), ","); f.IsExported() && name == "-" {
+				// runtime values that are not part of the configuration
+				continue
+			}
+			h.Write([]byte(f.Name + ":"))
+			hashValue(h, v.Field(i), depth+1)
+		}
+	case reflect.Slice, reflect.Array:
+		fmt.Fprintf(h, "[%d]", v.Len())
+		for i := 0; i < v.Len(); i++ {
+			hashValue(h, v.Index(i), depth+1)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+		})
+		fmt.Fprintf(h, "{%d}", len(keys))
+		for _, k := range keys {
+			hashValue(h, k, depth+1)
+			hashValue(h, v.MapIndex(k), depth+1)
+		}
+	case reflect.String:
+		fmt.Fprintf(h, "%q;", v.String())
+	case reflect.Bool:
+		fmt.Fprintf(h, "%t;", v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		fmt.Fprintf(h, "%d;", v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		fmt.Fprintf(h, "%d;", v.Uint())
+	case reflect.Float32, reflect.Float64:
+		fmt.Fprintf(h, "%g;", v.Float())
+	default:
+		// functions, channels... are not part of the configuration
+		h.Write([]byte("-;"))
+	}
+}
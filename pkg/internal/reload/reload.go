@@ -0,0 +1,238 @@
+// Package reload provides the reload of the configuration without restarting Beyla,
+// on SIGHUP or when the contents of the configuration file change.
+package reload
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+)
+
+func rlog() *slog.Logger {
+	return slog.With("component", "reload.Reloader")
+}
+
+// Appliers is a registry of the functions that apply, at runtime, the changes of the
+// configuration properties that can be updated without restarting Beyla.
+// A nil Appliers is valid and ignores any registered function.
+type Appliers struct {
+	mt    sync.Mutex
+	byKey map[string][]func(reflect.Value) error
+}
+
+func NewAppliers() *Appliers {
+	return &Appliers{byKey: map[string][]func(reflect.Value) error{}}
+}
+
+// OnChange registers a function that is invoked with the new value of the configuration property
+// in the provided dot-separated YAML path (e.g. filter.application), each time it changes.
+// If the function returns an error, the changes of the property are discarded, and reported as
+// requiring a restart of Beyla.
+func OnChange[T any](a *Appliers, key string, apply func(T) error) {
+	if a == nil {
+		return
+	}
+	a.mt.Lock()
+	defer a.mt.Unlock()
+	a.byKey[key] = append(a.byKey[key], func(v reflect.Value) error {
+		value, ok := v.Interface().(T)
+		if !ok {
+			return fmt.Errorf("property %q is of type %s", key, v.Type())
+		}
+		return apply(value)
+	})
+}
+
+// keys returns the registered keys, sorted
+func (a *Appliers) keys() []string {
+	if a == nil {
+		return nil
+	}
+	a.mt.Lock()
+	defer a.mt.Unlock()
+	keys := make([]string, 0, len(a.byKey))
+	for k := range a.byKey {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (a *Appliers) apply(key string, value reflect.Value) error {
+	a.mt.Lock()
+	appliers := a.byKey[key]
+	a.mt.Unlock()
+	var errs []error
+	for _, apply := range appliers {
+		if err := apply(value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Reloader keeps the active configuration, and replaces it by a new configuration when Reload is
+// invoked. Only the properties with registered Appliers are updated. The changes in the rest of
+// properties are logged as requiring a restart.
+type Reloader[C any] struct {
+	log      *slog.Logger
+	appliers *Appliers
+	metrics  imetrics.Reporter
+	// load must parse and validate the configuration
+	load func() (*C, error)
+
+	mt      sync.Mutex
+	current *C
+}
+
+// NewReloader loads the initial configuration, which becomes the active configuration.
+func NewReloader[C any](appliers *Appliers, metrics imetrics.Reporter, load func() (*C, error)) (*Reloader[C], error) {
+	current, err := load()
+	if err != nil {
+		return nil, fmt.Errorf("loading initial configuration: %w", err)
+	}
+	metrics.ConfigHash(configHash(current))
+	return &Reloader[C]{
+		log:      rlog(),
+		appliers: appliers,
+		metrics:  metrics,
+		load:     load,
+		current:  current,
+	}, nil
+}
+
+// Reload the configuration and apply the changed properties that can be updated at runtime.
+// If the new configuration can't be loaded, the active configuration remains unchanged.
+func (r *Reloader[C]) Reload() error {
+	r.mt.Lock()
+	defer r.mt.Unlock()
+	next, err := r.load()
+	if err != nil {
+		r.metrics.ConfigReload(false)
+		r.log.Error("can't reload configuration. Keeping the active configuration", "error", err)
+		return err
+	}
+	changed := diff(r.current, next)
+	if len(changed) == 0 {
+		r.metrics.ConfigReload(true)
+		r.log.Info("configuration reloaded without changes")
+		return nil
+	}
+	// the properties of the active configuration are replaced as long as they are applied
+	active := *r.current
+	activeVal := reflect.ValueOf(&active).Elem()
+	nextVal := reflect.ValueOf(next).Elem()
+	appliedChanges := map[string]struct{}{}
+	var applied []string
+	for _, key := range r.appliers.keys() {
+		if !anyAffected(key, changed) {
+			continue
+		}
+		value, err := field(nextVal, key)
+		if err == nil {
+			err = r.appliers.apply(key, value)
+		}
+		if err == nil {
+			err = setField(activeVal, nextVal, key)
+		}
+		if err != nil {
+			r.log.Warn("can't apply configuration change", "key", key, "error", err)
+			continue
+		}
+		applied = append(applied, key)
+		for _, c := range changed {
+			if affects(key, c) {
+				appliedChanges[c] = struct{}{}
+			}
+		}
+	}
+	var requireRestart []string
+	for _, c := range changed {
+		if _, ok := appliedChanges[c]; !ok {
+			requireRestart = append(requireRestart, c)
+		}
+	}
+	r.current = &active
+	hash := configHash(r.current)
+	r.metrics.ConfigReload(true)
+	r.metrics.ConfigHash(hash)
+	r.log.Info("configuration reloaded", "applied", applied, "hash", hash)
+	if len(requireRestart) > 0 {
+		r.log.Warn("some configuration changes require restarting Beyla to take effect",
+			"keys", requireRestart)
+	}
+	return nil
+}
+
+func anyAffected(key string, changed []string) bool {
+	for _, c := range changed {
+		if affects(key, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// Start reloading the configuration each time Beyla receives the SIGHUP signal, or each time
+// the contents of the provided file change. The file is checked with the provided period.
+// It returns immediately, after registering the SIGHUP signal.
+func (r *Reloader[C]) Start(ctx context.Context, file string, checkPeriod time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go r.watch(ctx, signals, file, checkPeriod)
+}
+
+func (r *Reloader[C]) watch(ctx context.Context, signals chan os.Signal, file string, checkPeriod time.Duration) {
+	defer signal.Stop(signals)
+	var ticks <-chan time.Time
+	var lastSum []byte
+	if file != "" && checkPeriod > 0 {
+		lastSum, _ = fileSum(file)
+		ticker := time.NewTicker(checkPeriod)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			r.log.Info("SIGHUP received. Reloading configuration")
+			_ = r.Reload()
+		case <-ticks:
+			sum, err := fileSum(file)
+			if err != nil {
+				r.log.Debug("can't check configuration file", "file", file, "error", err)
+				continue
+			}
+			if !bytes.Equal(sum, lastSum) {
+				lastSum = sum
+				r.log.Info("configuration file changed. Reloading configuration", "file", file)
+				_ = r.Reload()
+			}
+		}
+	}
+}
+
+// fileSum is used to detect changes in the configuration file. Comparing the contents instead of
+// the modification times also detects the atomic replacement of symlinks in Kubernetes ConfigMaps.
+func fileSum(file string) ([]byte, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(content)
+	return sum[:], nil
+}
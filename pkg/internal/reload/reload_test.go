@@ -0,0 +1,164 @@
+package reload
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+)
+
+type nested struct {
+	Patterns []string `yaml:"patterns"`
+	Unmatch  string   `yaml:"unmatched"`
+}
+
+type testConfig struct {
+	LogLevel string            `yaml:"log_level"`
+	Port     int               `yaml:"port"`
+	Routes   *nested           `yaml:"routes"`
+	Filter   map[string]string `yaml:"filter"`
+	Inline   inlined           `yaml:",inline"`
+	Runtime  chan struct{}     `yaml:"-"`
+	Untagged string
+}
+
+type inlined struct {
+	Sampling float64 `yaml:"sampling"`
+}
+
+type reloadMetrics struct {
+	imetrics.NoopReporter
+	mt      sync.Mutex
+	reloads []bool
+	hashes  []string
+}
+
+func (m *reloadMetrics) ConfigReload(success bool) {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	m.reloads = append(m.reloads, success)
+}
+
+func (m *reloadMetrics) ConfigHash(hash string) {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	m.hashes = append(m.hashes, hash)
+}
+
+func baseConfig() *testConfig {
+	return &testConfig{
+		LogLevel: "INFO",
+		Port:     8080,
+		Routes:   &nested{Patterns: []string{"/foo"}, Unmatch: "heuristic"},
+		Filter:   map[string]string{"a": "b"},
+	}
+}
+
+func TestDiff(t *testing.T) {
+	next := baseConfig()
+	next.LogLevel = "DEBUG"
+	next.Routes.Unmatch = "wildcard"
+	next.Inline.Sampling = 0.5
+	next.Untagged = "changed"
+	next.Runtime = make(chan struct{})
+	assert.Equal(t,
+		[]string{"log_level", "routes.unmatched", "sampling", "untagged"},
+		diff(baseConfig(), next))
+
+	assert.Empty(t, diff(baseConfig(), baseConfig()))
+
+	next = baseConfig()
+	next.Routes = nil
+	assert.Equal(t, []string{"routes"}, diff(baseConfig(), next))
+}
+
+func TestReload(t *testing.T) {
+	next := baseConfig()
+	load := func() (*testConfig, error) {
+		cfg := *next
+		return &cfg, nil
+	}
+
+	appliers := NewAppliers()
+	var levels []string
+	OnChange(appliers, "log_level", func(level string) error {
+		levels = append(levels, level)
+		return nil
+	})
+	var routes []*nested
+	OnChange(appliers, "routes", func(r *nested) error {
+		routes = append(routes, r)
+		return nil
+	})
+	OnChange(appliers, "filter", func(map[string]string) error {
+		return errors.New("can't update filter")
+	})
+
+	metrics := &reloadMetrics{}
+	r, err := NewReloader(appliers, metrics, load)
+	require.NoError(t, err)
+	initial := r.current
+	require.Len(t, metrics.hashes, 1)
+
+	// WHEN the configuration does not change
+	require.NoError(t, r.Reload())
+	// THEN nothing is applied
+	assert.Empty(t, levels)
+	assert.Empty(t, routes)
+
+	// WHEN the configuration changes in properties that can be applied and properties that can't
+	next = baseConfig()
+	next.LogLevel = "DEBUG"
+	next.Routes.Patterns = []string{"/foo", "/bar"}
+	next.Port = 9090
+	next.Filter = map[string]string{"c": "d"}
+	require.NoError(t, r.Reload())
+
+	// THEN only the applicable properties are applied
+	assert.Equal(t, []string{"DEBUG"}, levels)
+	require.Len(t, routes, 1)
+	assert.Equal(t, []string{"/foo", "/bar"}, routes[0].Patterns)
+
+	// AND the active configuration is only updated with the applied properties
+	assert.Equal(t, "DEBUG", r.current.LogLevel)
+	assert.Equal(t, []string{"/foo", "/bar"}, r.current.Routes.Patterns)
+	assert.Equal(t, 8080, r.current.Port)
+	assert.Equal(t, map[string]string{"a": "b"}, r.current.Filter)
+	// AND the previous active configuration is not modified
+	assert.Equal(t, "INFO", initial.LogLevel)
+	assert.Equal(t, []string{"/foo"}, initial.Routes.Patterns)
+
+	// AND the hash of the active configuration changes
+	require.Len(t, metrics.hashes, 2)
+	assert.NotEqual(t, metrics.hashes[0], metrics.hashes[1])
+
+	// WHEN the configuration can't be loaded
+	load = func() (*testConfig, error) {
+		return nil, errors.New("wrong config")
+	}
+	r.load = load
+	require.Error(t, r.Reload())
+	// THEN the active configuration is kept
+	assert.Equal(t, "DEBUG", r.current.LogLevel)
+
+	assert.Equal(t, []bool{true, true, false}, metrics.reloads)
+}
+
+func TestReload_NilAppliers(t *testing.T) {
+	next := baseConfig()
+	r, err := NewReloader(nil, imetrics.NoopReporter{}, func() (*testConfig, error) {
+		cfg := *next
+		return &cfg, nil
+	})
+	require.NoError(t, err)
+	OnChange(nil, "log_level", func(string) error { return nil })
+
+	next.LogLevel = "DEBUG"
+	require.NoError(t, r.Reload())
+	// no property is applied
+	assert.Equal(t, "INFO", r.current.LogLevel)
+}
@@ -0,0 +1,103 @@
+package report
+
+import (
+	"cmp"
+	"io"
+	"slices"
+	"sync"
+)
+
+// Types of the probes that are attached by Beyla
+const (
+	ProbeKprobe       = "kprobe"
+	ProbeKretprobe    = "kretprobe"
+	ProbeUprobe       = "uprobe"
+	ProbeUretprobe    = "uretprobe"
+	ProbeGoUprobe     = "go_uprobe"
+	ProbeGoReturn     = "go_return_uprobe"
+	ProbeTracepoint   = "tracepoint"
+	ProbeSocketFilter = "socket_filter"
+	ProbeTC           = "tc"
+)
+
+// Probe describes an eBPF program attached to the kernel or to an executable
+type Probe struct {
+	// Type of the probe (kprobe, uprobe, tracepoint...)
+	Type string `json:"type"`
+	// Function, or tracepoint, that is instrumented
+	Function string `json:"function,omitempty"`
+	// Target executable or library of the user-space probes
+	Target string `json:"target,omitempty"`
+}
+
+// AttachedProbe is a Probe and the number of times that it is currently attached
+// (e.g. a kprobe that is attached once for each instrumented executable)
+type AttachedProbe struct {
+	Probe
+	Count int `json:"count"`
+}
+
+// Probes keeps track of the eBPF probes that are currently attached.
+// A nil Probes is valid: it does not keep track of anything.
+type Probes struct {
+	mt       sync.Mutex
+	attached map[Probe]int
+}
+
+func NewProbes() *Probes {
+	return &Probes{attached: map[Probe]int{}}
+}
+
+// Attached records the provided probe as attached. It returns a closer that wraps the provided
+// link to the probe: when it is closed, the probe is also removed from the registry.
+func (p *Probes) Attached(probe Probe, link io.Closer) io.Closer {
+	if p == nil {
+		return link
+	}
+	p.mt.Lock()
+	defer p.mt.Unlock()
+	p.attached[probe]++
+	return &probeCloser{Closer: link, probes: p, probe: probe}
+}
+
+// List returns the currently attached probes, sorted by type, target and function
+func (p *Probes) List() []AttachedProbe {
+	if p == nil {
+		return nil
+	}
+	p.mt.Lock()
+	defer p.mt.Unlock()
+	list := make([]AttachedProbe, 0, len(p.attached))
+	for probe, count := range p.attached {
+		list = append(list, AttachedProbe{Probe: probe, Count: count})
+	}
+	slices.SortFunc(list, func(a, b AttachedProbe) int {
+		return cmp.Or(
+			cmp.Compare(a.Type, b.Type),
+			cmp.Compare(a.Target, b.Target),
+			cmp.Compare(a.Function, b.Function))
+	})
+	return list
+}
+
+func (p *Probes) detached(probe Probe) {
+	p.mt.Lock()
+	defer p.mt.Unlock()
+	if p.attached[probe] <= 1 {
+		delete(p.attached, probe)
+	} else {
+		p.attached[probe]--
+	}
+}
+
+type probeCloser struct {
+	io.Closer
+	probes *Probes
+	probe  Probe
+	once   sync.Once
+}
+
+func (c *probeCloser) Close() error {
+	c.once.Do(func() { c.probes.detached(c.probe) })
+	return c.Closer.Close()
+}
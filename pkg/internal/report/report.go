@@ -0,0 +1,130 @@
+// Package report describes what Beyla is actually doing in the host: its effective configuration,
+// the capabilities of the kernel, the eBPF probes that are attached, and the exporters in use.
+// The report is logged at startup and served, while Beyla runs, from the internal metrics port.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	ebpfcommon "github.com/grafana/beyla/pkg/internal/ebpf/common"
+)
+
+// Path where the report is served
+const Path = "/debug/report"
+
+// btfPath is the file that is exposed by the kernels with BTF information
+const btfPath = "/sys/kernel/btf/vmlinux"
+
+func rlog() *slog.Logger {
+	return slog.With("component", "report.Report")
+}
+
+type Report struct {
+	Timestamp time.Time `json:"timestamp"`
+	Version   string    `json:"version"`
+	Revision  string    `json:"revision"`
+	Kernel    Kernel    `json:"kernel"`
+	// Capabilities of the Beyla process, and the features that they don't permit
+	Capabilities Capabilities `json:"capabilities"`
+	// Features of Beyla that are enabled (application, network)
+	Features []string `json:"features"`
+	// Protocols that are decoded by the application observability instrumentation
+	Protocols []string `json:"protocols"`
+	// Exporters that are active
+	Exporters []Exporter `json:"exporters"`
+	// Discovery criteria in effect to select the instrumented processes
+	Discovery any `json:"discovery"`
+	// Probes that are currently attached
+	Probes []AttachedProbe `json:"probes"`
+	// Config is the effective configuration, with its secrets redacted
+	Config any `json:"config"`
+}
+
+// Kernel describes the capabilities of the running kernel that affect the instrumentation
+type Kernel struct {
+	Release string `json:"release"`
+	// Lockdown mode of the kernel: none, integrity, confidentiality or other
+	Lockdown string `json:"lockdown"`
+	// BTF specifies whether the kernel exposes its BTF information
+	BTF bool `json:"btf"`
+	// ContextPropagation specifies whether the kernel allows propagating the trace context
+	// into the instrumented applications
+	ContextPropagation bool `json:"context_propagation"`
+	// Loops specifies whether the kernel supports bounded loops in the eBPF programs
+	Loops bool `json:"loops"`
+}
+
+type Capabilities struct {
+	// Effective Linux capabilities of the Beyla process
+	Effective []string `json:"effective"`
+	// Disabled features, with the capabilities that they miss
+	Disabled map[string][]string `json:"disabled,omitempty"`
+}
+
+type Exporter struct {
+	Name     string   `json:"name"`
+	Endpoint string   `json:"endpoint,omitempty"`
+	Protocol string   `json:"protocol,omitempty"`
+	Features []string `json:"features,omitempty"`
+}
+
+// KernelInfo inspects the running kernel
+func KernelInfo() Kernel {
+	_, err := os.Stat(btfPath)
+	return Kernel{
+		Release:            ebpfcommon.KernelRelease(),
+		Lockdown:           lockdownName(ebpfcommon.KernelLockdownMode()),
+		BTF:                err == nil,
+		ContextPropagation: ebpfcommon.SupportsContextPropagation(rlog()),
+		Loops:              ebpfcommon.SupportsEBPFLoops(),
+	}
+}
+
+func lockdownName(mode ebpfcommon.KernelLockdown) string {
+	switch mode {
+	case ebpfcommon.KernelLockdownNone:
+		return "none"
+	case ebpfcommon.KernelLockdownIntegrity:
+		return "integrity"
+	case ebpfcommon.KernelLockdownConfidentiality:
+		return "confidentiality"
+	default:
+		return "other"
+	}
+}
+
+// FromYAML converts the provided YAML document into a value that can be marshalled as JSON,
+// so the sections of the report keep the same property names as the Beyla YAML configuration.
+func FromYAML(document []byte) (any, error) {
+	var value any
+	if err := yaml.Unmarshal(document, &value); err != nil {
+		return nil, fmt.Errorf("converting YAML into JSON: %w", err)
+	}
+	return value, nil
+}
+
+// Handler returns the HTTP handler that serves the report that is returned by the provided function,
+// which is invoked on each request
+func Handler(build func() (*Report, error)) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		report, err := build()
+		if err != nil {
+			rlog().Error("can't build report", "error", err)
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(rw)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			rlog().Debug("can't write report", "error", err)
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLink struct {
+	closed int
+}
+
+func (f *fakeLink) Close() error {
+	f.closed++
+	return nil
+}
+
+func TestProbes(t *testing.T) {
+	probes := NewProbes()
+	kprobe := Probe{Type: ProbeKprobe, Function: "tcp_connect"}
+	uprobe := Probe{Type: ProbeUprobe, Function: "SSL_read", Target: "/usr/lib/libssl.so.3"}
+
+	// WHEN probes are attached
+	kp1, kp2, up := &fakeLink{}, &fakeLink{}, &fakeLink{}
+	kpCloser1 := probes.Attached(kprobe, kp1)
+	kpCloser2 := probes.Attached(kprobe, kp2)
+	upCloser := probes.Attached(uprobe, up)
+
+	// THEN they are listed, with the number of times that they are attached
+	assert.Equal(t, []AttachedProbe{
+		{Probe: kprobe, Count: 2},
+		{Probe: uprobe, Count: 1},
+	}, probes.List())
+
+	// WHEN the probes are detached
+	require.NoError(t, kpCloser1.Close())
+	require.NoError(t, upCloser.Close())
+	// AND a probe is closed twice
+	require.NoError(t, kpCloser1.Close())
+
+	// THEN they are removed from the list
+	assert.Equal(t, []AttachedProbe{{Probe: kprobe, Count: 1}}, probes.List())
+	// AND the links are closed
+	assert.Equal(t, 2, kp1.closed)
+	assert.Equal(t, 0, kp2.closed)
+	assert.Equal(t, 1, up.closed)
+
+	require.NoError(t, kpCloser2.Close())
+	assert.Empty(t, probes.List())
+}
+
+func TestProbes_Nil(t *testing.T) {
+	var probes *Probes
+	link := &fakeLink{}
+	closer := probes.Attached(Probe{Type: ProbeKprobe, Function: "tcp_connect"}, link)
+	assert.Same(t, link, closer)
+	assert.Empty(t, probes.List())
+}
+
+func TestHandler(t *testing.T) {
+	config, err := FromYAML([]byte("discovery:\n  system_wide: true\n"))
+	require.NoError(t, err)
+	probes := NewProbes()
+	build := func() (*Report, error) {
+		return &Report{Config: config, Probes: probes.List()}, nil
+	}
+	server := httptest.NewServer(Handler(build))
+	defer server.Close()
+
+	// WHEN a probe is attached after the handler is created
+	probes.Attached(Probe{Type: ProbeTracepoint, Function: "syscalls/sys_enter_exit"}, &fakeLink{})
+
+	// THEN the served report contains it
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	var got map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	assert.Equal(t, []any{map[string]any{
+		"type": "tracepoint", "function": "syscalls/sys_enter_exit", "count": float64(1),
+	}}, got["probes"])
+	// AND the configuration keeps the YAML property names
+	assert.Equal(t, map[string]any{"discovery": map[string]any{"system_wide": true}}, got["config"])
+}
+
+func TestHandler_Error(t *testing.T) {
+	server := httptest.NewServer(Handler(func() (*Report, error) {
+		return nil, errors.New("boom")
+	}))
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
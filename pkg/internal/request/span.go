@@ -7,6 +7,7 @@ import (
 	"github.com/gavv/monotime"
 	trace2 "go.opentelemetry.io/otel/trace"
 
+	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
 	"github.com/grafana/beyla/pkg/internal/svc"
 )
 
@@ -75,6 +76,11 @@ type Span struct {
 	PeerName       string
 	HostName       string
 	OtherNamespace string
+	// OtherServiceAccount is the service account of the Kubernetes pod at the other side of the request
+	OtherServiceAccount string
+	// OtherNamespaceLabels are the selected labels of the namespace of the Kubernetes pod at the other
+	// side of the request, keyed by their attribute name
+	OtherNamespaceLabels map[attr.Name]string
 }
 
 func (s *Span) Inside(parent *Span) bool {
@@ -13,6 +13,21 @@ import (
 // SpanOTELGetters returns the metric.Getter function that returns the
 // OTEL attribute.KeyValue of a given attribute name.
 func SpanOTELGetters(name attr.Name) (metric.Getter[*Span, attribute.KeyValue], bool) {
+	if stable, ok := attr.StableName(name); ok {
+		// attributes from the old semantic conventions get the same value as their stable counterpart
+		stableGetter, ok := SpanOTELGetters(stable)
+		if !ok {
+			return nil, false
+		}
+		return func(s *Span) attribute.KeyValue {
+			return attribute.KeyValue{Key: name.OTEL(), Value: stableGetter(s).Value}
+		}, true
+	}
+	if attr.IsK8sPeerNamespaceLabel(name) {
+		return func(s *Span) attribute.KeyValue {
+			return name.OTEL().String(s.OtherNamespaceLabels[name])
+		}, true
+	}
 	var getter metric.Getter[*Span, attribute.KeyValue]
 	switch name {
 	case attr.HTTPRequestMethod:
@@ -37,6 +52,10 @@ func SpanOTELGetters(name attr.Name) (metric.Getter[*Span, attribute.KeyValue],
 		getter = func(s *Span) attribute.KeyValue { return semconv.RPCGRPCStatusCodeKey.Int(s.Status) }
 	case attr.DBOperation:
 		getter = func(span *Span) attribute.KeyValue { return semconv.DBOperation(span.Method) }
+	case attr.K8sPeerServiceAccount:
+		getter = func(s *Span) attribute.KeyValue {
+			return attr.K8sPeerServiceAccount.OTEL().String(s.OtherServiceAccount)
+		}
 	}
 	// default: unlike the Prometheus getters, we don't check here for service name nor k8s metadata
 	// because they are already attributes of the Resource instead of the metric.
@@ -47,6 +66,12 @@ func SpanOTELGetters(name attr.Name) (metric.Getter[*Span, attribute.KeyValue],
 // Prometheus string value of a given attribute name.
 // nolint:cyclop
 func SpanPromGetters(attrName attr.Name) (metric.Getter[*Span, string], bool) {
+	if stable, ok := attr.StableName(attrName); ok {
+		return SpanPromGetters(stable)
+	}
+	if attr.IsK8sPeerNamespaceLabel(attrName) {
+		return func(s *Span) string { return s.OtherNamespaceLabels[attrName] }, true
+	}
 	var getter metric.Getter[*Span, string]
 	switch attrName {
 	case attr.HTTPRequestMethod:
@@ -71,6 +96,8 @@ func SpanPromGetters(attrName attr.Name) (metric.Getter[*Span, string], bool) {
 		getter = func(s *Span) string { return strconv.Itoa(s.Status) }
 	case attr.DBOperation:
 		getter = func(span *Span) string { return span.Method }
+	case attr.K8sPeerServiceAccount:
+		getter = func(s *Span) string { return s.OtherServiceAccount }
 	// resource metadata values below. Unlike OTEL, they are included here because they
 	// belong to the metric, instead of the Resource
 	case attr.ServiceName:
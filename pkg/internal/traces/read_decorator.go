@@ -8,6 +8,7 @@ import (
 	lru "github.com/hashicorp/golang-lru/v2"
 	"github.com/mariomac/pipes/pipe"
 
+	"github.com/grafana/beyla/pkg/internal/health"
 	"github.com/grafana/beyla/pkg/internal/request"
 	"github.com/grafana/beyla/pkg/internal/svc"
 	"github.com/grafana/beyla/pkg/internal/traces/hostname"
@@ -48,6 +49,10 @@ type ReadDecorator struct {
 	TracesInput <-chan []request.Span
 
 	InstanceID InstanceIDConfig
+
+	// Watchdog is notified while the traces are being forwarded to the next stage,
+	// to detect a blocked pipeline. It can be nil.
+	Watchdog *health.Watchdog
 }
 
 // decorator modifies a []request.Span slice to fill it with extra information that is not provided
@@ -62,20 +67,36 @@ func ReadFromChannel(ctx context.Context, r *ReadDecorator) pipe.StartFunc[[]req
 			select {
 			case trace, ok := <-r.TracesInput:
 				if ok {
-					decorate(trace)
-					out <- trace
+					r.forward(decorate, trace, out)
 				} else {
 					rlog().Debug("input channel closed. Exiting traces input loop")
 					return
 				}
 			case <-cancelChan:
-				rlog().Debug("context canceled. Exiting traces input loop")
+				// forward the traces that were already submitted by the tracers, so they
+				// can be exported before Beyla stops
+				pending := len(r.TracesInput)
+				rlog().Debug("context canceled. Exiting traces input loop", "pending", pending)
+				for i := 0; i < pending; i++ {
+					trace, ok := <-r.TracesInput
+					if !ok {
+						return
+					}
+					r.forward(decorate, trace, out)
+				}
 				return
 			}
 		}
 	}
 }
 
+func (r *ReadDecorator) forward(decorate decorator, trace []request.Span, out chan<- []request.Span) {
+	decorate(trace)
+	r.Watchdog.Enter()
+	out <- trace
+	r.Watchdog.Exit()
+}
+
 func getDecorator(cfg *InstanceIDConfig) decorator {
 	hnPidDecorator := hostNamePIDDecorator(cfg)
 	if cfg.OverrideInstanceID == "" {
@@ -74,3 +74,32 @@ func TestReadDecorator(t *testing.T) {
 	}
 
 }
+
+func TestReadDecorator_ForwardsPendingOnCancel(t *testing.T) {
+	rawInput := make(chan []request.Span, 10)
+	decoratedOutput := make(chan []request.Span, 10)
+	cfg := ReadDecorator{
+		TracesInput: rawInput,
+		InstanceID:  InstanceIDConfig{OverrideInstanceID: "instance"},
+	}
+	// GIVEN some traces that were submitted before Beyla is stopped
+	rawInput <- []request.Span{{Path: "/foo"}}
+	rawInput <- []request.Span{{Path: "/bar"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// WHEN the read loop is stopped
+	done := make(chan struct{})
+	go func() {
+		ReadFromChannel(ctx, &cfg)(decoratedOutput)
+		close(done)
+	}()
+	testutil.ReadChannel(t, done, testTimeout)
+
+	// THEN the pending traces are decorated and forwarded before exiting
+	require.Len(t, decoratedOutput, 2)
+	assert.Equal(t, "/foo", (<-decoratedOutput)[0].Path)
+	bar := <-decoratedOutput
+	assert.Equal(t, "/bar", bar[0].Path)
+	assert.Equal(t, "instance", bar[0].ServiceID.Instance)
+}
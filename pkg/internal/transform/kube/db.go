@@ -1,157 +1,1857 @@
 package kube
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"hash/maphash"
 	"log/slog"
+	"maps"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/cache"
 
+	ebpfcommon "github.com/grafana/beyla/pkg/internal/ebpf/common"
 	"github.com/grafana/beyla/pkg/internal/helpers/container"
+	"github.com/grafana/beyla/pkg/internal/imetrics"
 	"github.com/grafana/beyla/pkg/internal/kube"
 )
 
+// names of the Database indexes, as reported by the internal metrics
+const (
+	indexContainerIDs  = "container_ids"
+	indexPIDNamespaces = "pid_namespaces"
+	indexProcesses     = "processes"
+	indexPodsByPIDNS   = "pods_by_pid_namespace"
+	indexPodsByIP      = "pods_by_ip"
+	indexPodsByIPPort  = "pods_by_ip_port"
+	indexServicesByIP  = "services_by_ip"
+	// the Services are indexed by selector if the informers watch them
+	indexServicesBySelector = "services_by_selector"
+	indexUnknownIPs         = "unknown_ips"
+)
+
+// names of the resources and event types, as reported by the informer events internal metrics
+const (
+	resourcePod           = "pod"
+	resourceEndpointSlice = "endpoint_slice"
+	resourceService       = "service"
+	resourceContainer     = "container"
+	eventAdd              = "add"
+	eventUpdate           = "update"
+	eventDelete           = "delete"
+)
+
+// numIPShards is the number of shards of the IP indexes. The IP lookups only contend with the
+// informer updates of the IPs in the same shard.
+const numIPShards = 64
+
+// injectable functions for testing
+var (
+	containerInfoForPID = container.InfoForPID
+	namespaceForPID     = ebpfcommon.FindNamespace
+	processStartTime    = container.StartTime
+	timeNow             = time.Now
+	inspectionRetryTime = 500 * time.Millisecond
+)
+
+// inspectionRetries is the number of times that the container information of a process is inspected
+// again, with exponential backoff, if it fails. The cgroup of a process might not be readable yet while
+// it is being created.
+const inspectionRetries = 3
+
+// reinspectionPeriod is the minimum time between two inspections of the processes of a PID namespace
+// whose container is not found in the informer, as it might have been replaced by a new container
+var reinspectionPeriod = 5 * time.Second
+
+// ownerFetchBackoff and maxOwnerFetchBackoff are the minimum and maximum times between two fetches of
+// the Deployment of a cached pod whose ReplicaSet information is not known yet. It might be received
+// late by the informer, or never if the ReplicaSet is not owned by a Deployment.
+var (
+	ownerFetchBackoff    = time.Second
+	maxOwnerFetchBackoff = 5 * time.Minute
+)
+
+// pendingInspectionsLen is the maximum number of failed inspections that can be waiting to be
+// received by the retries loop. The inspections that don't fit are not retried.
+const pendingInspectionsLen = 256
+
 func dblog() *slog.Logger {
 	return slog.With("component", "kube.Database")
 }
 
+// pidNamespace identifies a PID namespace. As the kernel can reuse the inode number of a destroyed
+// namespace for a new, unrelated namespace, the inode number is complemented with a generation:
+// the start time of the first process that was registered in the namespace.
+type pidNamespace struct {
+	inode      uint32
+	generation uint64
+}
+
+// nsGeneration is the current generation of a PID namespace inode, and the first process that
+// was registered in it
+type nsGeneration struct {
+	generation uint64
+	firstPID   uint32
+}
+
+// processContainer is the container of a process, as extracted from its cgroup, and the generation
+// of the PID namespace where the process was registered. The start time tells whether the process
+// is still alive.
+type processContainer struct {
+	ns          pidNamespace
+	containerID string
+	start       uint64
+}
+
+// cachedPod is a decorated pod, and the time it was stored in the pods cache
+type cachedPod struct {
+	pod      *kube.PodInfo
+	cachedAt time.Time
+	// ownerResolved is false while the Deployment of the pod must still be fetched. In that case,
+	// it is fetched again after ownerFetchAt, with exponential backoff.
+	ownerResolved bool
+	ownerFetchAt  time.Time
+	ownerBackoff  time.Duration
+}
+
+// inspection of the container information of a process, which is retried if it fails
+type inspection struct {
+	pid   uint32
+	start uint64
+	ns    pidNamespace
+	// attempt is the number of retries, and due is the time when the next retry can be done
+	attempt int
+	due     time.Time
+}
+
+// deletedPod is a pod that has been removed from the IPs index, and the time it was removed.
+// It is still returned by the IP lookups during the deleted pods grace period.
+type deletedPod struct {
+	pod       *kube.PodInfo
+	deletedAt time.Time
+}
+
+// deletedSlice is an EndpointSlice whose endpoint IP has been removed from the services index, and
+// the time it was removed
+type deletedSlice struct {
+	slice     *kube.EndpointSliceInfo
+	deletedAt time.Time
+}
+
+// ipPortKey identifies a Pod that receives the traffic addressed to its node by one of the node IPs
+// and one of its container ports (for the Pods in the host network) or host ports
+type ipPortKey struct {
+	ip   string
+	port uint16
+}
+
+// ipShard holds the entries of the IP indexes whose IP hashes to the shard. All the entries of the
+// same IP are in the same shard, so they are read and updated consistently under the shard lock.
+type ipShard struct {
+	mut sync.RWMutex
+	// ip to pod name matcher
+	podsByIP map[string]*kube.PodInfo
+	// the hostNetwork and hostPort pods receive the traffic addressed to their node, so they are indexed
+	// by IP and port
+	podsByIPPort map[ipPortKey]*kube.PodInfo
+	// the node IPs that have podsByIPPort entries
+	hostIPs map[string]nodeIP
+	// the pods that were removed from podsByIP during the last deletedPodsGrace period. The spans and
+	// network flows are decorated some time after their traffic happened, when their pod might have
+	// been already deleted.
+	deletedPodsByIP map[string]deletedPod
+	// endpoint IP to the EndpointSlices that contain it, by UID. An IP can belong to multiple
+	// slices if its pod backs multiple Services, or during the rollouts of a Service.
+	servicesByIP map[string]map[types.UID]*kube.EndpointSliceInfo
+	// the EndpointSlices whose endpoint IPs were removed during the last deletedPodsGrace period
+	deletedServicesByIP map[string]map[types.UID]deletedSlice
+}
+
+// nodeIP is an IP of a node that runs hostNetwork or hostPort pods
+type nodeIP struct {
+	// ports is the number of podsByIPPort entries of the IP
+	ports int
+	node  string
+}
+
+// reset must be invoked with the shard lock held
+func (sh *ipShard) reset() {
+	sh.podsByIP = map[string]*kube.PodInfo{}
+	sh.podsByIPPort = map[ipPortKey]*kube.PodInfo{}
+	sh.hostIPs = map[string]nodeIP{}
+	sh.deletedPodsByIP = map[string]deletedPod{}
+	sh.servicesByIP = map[string]map[types.UID]*kube.EndpointSliceInfo{}
+	sh.deletedServicesByIP = map[string]map[types.UID]deletedSlice{}
+}
+
+// Informer provides the Kubernetes metadata to the Database, and notifies it of the changes in
+// the cluster. It is implemented by kube.Metadata, and by kube.FakeMetadata in the tests.
+type Informer interface {
+	AddContainerEventHandler(eh kube.ContainerEventHandler)
+	RemoveContainerEventHandler(eh kube.ContainerEventHandler)
+	AddPodEventHandler(h cache.ResourceEventHandler) (*kube.EventHandlerRegistration, error)
+	AddEndpointSliceEventHandler(h cache.ResourceEventHandler) (*kube.EventHandlerRegistration, error)
+	AddServiceEventHandler(h cache.ResourceEventHandler) (*kube.EventHandlerRegistration, error)
+
+	GetContainerPod(containerID string) (*kube.PodInfo, bool)
+	GetPod(namespace, name string) (*kube.PodInfo, bool)
+	PodWithOwnerInfo(pod *kube.PodInfo) *kube.PodInfo
+	ListPods() []*kube.PodInfo
+	ListEndpointSlices() []*kube.EndpointSliceInfo
+	ListServices() []*kube.ServiceInfo
+	GetNamespaceLabels(name string) (map[string]string, bool)
+	GetNodeInfo(name string) (*kube.NodeInfo, bool)
+	GetClusterName() string
+	NamespaceFilter() *kube.NamespaceFilter
+	EndpointSlicesWatched() bool
+
+	WaitForCacheSync(ctx context.Context) error
+	ResyncPeriod() time.Duration
+	Relisted() bool
+}
+
 // Database aggregates Kubernetes information from multiple sources:
 // - the informer that keep an indexed copy of the existing pods and replicasets.
 // - the inspected container.Info objects, indexed either by container ID and PID namespace
 // - a cache of decorated PodInfo that would avoid reconstructing them on each trace decoration
 type Database struct {
-	informer *kube.Metadata
+	informer Informer
 
+	// value: the PID namespace of the container
 	cntMut       sync.Mutex
-	containerIDs map[string]*container.Info
+	containerIDs map[string]pidNamespace
 
 	// a single namespace will point to any container inside the pod
 	// but we don't care which one
 	nsMut      sync.RWMutex
-	namespaces map[uint32]*container.Info
+	namespaces map[pidNamespace]*container.Info
+	// key: PID namespace inode. The entries of the other maps whose generation is not the
+	// current generation of their inode are stale, and are removed when the generation changes
+	generations map[uint32]nsGeneration
+	// key: host PID. The pods that run with hostPID, as well as the processes in the host PID namespace,
+	// share a PID namespace with processes from other containers. Then the namespace does not identify
+	// a pod, and the pods of the processes in the namespaces that are listed in sharedNamespaces
+	// are looked up by the container of each process.
+	processes        map[uint32]processContainer
+	sharedNamespaces map[pidNamespace]struct{}
+	// last time that the processes of a namespace were inspected again by OwnerPodInfo
+	reinspections map[pidNamespace]time.Time
 
 	// key: pid namespace
 	podsCacheMut     sync.RWMutex
-	fetchedPodsCache map[uint32]*kube.PodInfo
+	fetchedPodsCache map[pidNamespace]cachedPod
+	// reverse index of fetchedPodsCache. Key: UID of the cached pod
+	podNamespaces map[types.UID]map[pidNamespace]struct{}
+	// podsCacheTTL is the time after which the cached pods are evicted. If 0, they are kept until
+	// their pod or namespace are removed.
+	podsCacheTTL time.Duration
 
-	// ip to pod name matcher
-	podsMut  sync.RWMutex
-	podsByIP map[string]*kube.PodInfo
+	// the IP indexes are sharded, as the network flows decoration looks them up at a high rate
+	// while the informers keep updating them
+	ipSeed   maphash.Seed
+	ipShards [numIPShards]*ipShard
+	// number of entries of the IP indexes, across all the shards
+	podIPsLen, podIPPortsLen, serviceIPsLen atomic.Int64
+
+	// IPs that were recently looked up without being found in any of the IP indexes. The lookups of
+	// the external IPs are answered from here, without contending for the locks of the indexes.
+	// An IP is removed as soon as it's added to any index. Nil if disabled.
+	unknownIPs *expirable.LRU[string, struct{}]
+
+	// deletedPodsGrace is the time during which the removed IPs are still resolved to their former
+	// pod or Service, unless another pod claims them. If 0, they are forgotten immediately.
+	deletedPodsGrace time.Duration
+
+	// namespaceOnlyExcluded returns the Pods and Services of the namespaces that are excluded from the
+	// decoration with only their namespace. Otherwise, they are not found.
+	namespaceOnlyExcluded bool
+
+	// remoteCluster ignores the local processes, which don't belong to the watched cluster
+	remoteCluster bool
+
+	metrics imetrics.Reporter
+	// containerDeletions is bound in advance, as OnDeletion is invoked for each deleted container
+	containerDeletions imetrics.EventRecorder
+
+	// inspections receives the processes whose container information must be retrieved again.
+	// Nil if the Database has not been started, so the failed inspections are not retried.
+	inspections     chan inspection
+	inspectionRetry time.Duration
+
+	// the ExternalName Services, whose hostnames are resolved every externalNamesRefresh period,
+	// and their IPs indexed in the services index. Empty if the Services are not watched.
+	externalNamesMut     sync.Mutex
+	externalNames        map[types.UID]*externalName
+	externalNamesRefresh time.Duration
+	externalNamesWake    chan struct{}
+	lookupHost           func(ctx context.Context, host string) ([]string, error)
+
+	// the Services with a selector, indexed by the first label of their selector. Empty if the
+	// Services are not watched.
+	selectorsMut        sync.RWMutex
+	servicesBySelector  map[selectorKey]map[types.UID]*kube.ServiceInfo
+	selectorServicesLen int
+
+	// pods of the restored snapshot by container ID, which are used until the informers are synced
+	restoredMut        sync.RWMutex
+	restoredContainers map[string]*kube.PodInfo
+
+	// registrations in the informers, and cancellation of the background tasks, that are released on Stop
+	registrations []*kube.EventHandlerRegistration
+	cancel        context.CancelFunc
+	stopped       atomic.Bool
 }
 
-func CreateDatabase(kubeMetadata *kube.Metadata) Database {
+func CreateDatabase(informer Informer) Database {
 	return Database{
-		fetchedPodsCache: map[uint32]*kube.PodInfo{},
-		containerIDs:     map[string]*container.Info{},
-		namespaces:       map[uint32]*container.Info{},
-		podsByIP:         map[string]*kube.PodInfo{},
-		informer:         kubeMetadata,
+		fetchedPodsCache:   map[pidNamespace]cachedPod{},
+		podNamespaces:      map[types.UID]map[pidNamespace]struct{}{},
+		containerIDs:       map[string]pidNamespace{},
+		namespaces:         map[pidNamespace]*container.Info{},
+		generations:        map[uint32]nsGeneration{},
+		processes:          map[uint32]processContainer{},
+		sharedNamespaces:   map[pidNamespace]struct{}{},
+		reinspections:      map[pidNamespace]time.Time{},
+		externalNames:      map[types.UID]*externalName{},
+		servicesBySelector: map[selectorKey]map[types.UID]*kube.ServiceInfo{},
+		ipSeed:             maphash.MakeSeed(),
+		ipShards:           newIPShards(),
+		informer:           informer,
+		metrics:            imetrics.NoopReporter{},
+		containerDeletions: imetrics.NoopReporter{}.KubeInformerEvents(resourceContainer, eventDelete),
 	}
 }
 
-func StartDatabase(kubeMetadata *kube.Metadata) (*Database, error) {
-	db := CreateDatabase(kubeMetadata)
-	db.informer.AddContainerEventHandler(&db)
+func newIPShards() [numIPShards]*ipShard {
+	var shards [numIPShards]*ipShard
+	for i := range shards {
+		shards[i] = &ipShard{}
+		shards[i].reset()
+	}
+	return shards
+}
+
+// DatabaseConfig holds the settings of the Database caches
+type DatabaseConfig struct {
+	// PodsCacheTTL is the time after which the cached pods are evicted in background. If 0, they are
+	// kept until their pod or namespace are removed.
+	PodsCacheTTL time.Duration
+	// DeletedPodsGrace is the time during which the IPs of the deleted pods and endpoints are still resolved.
+	DeletedPodsGrace time.Duration
+	// UnknownIPsCacheLen is the maximum number of IPs that are remembered as not found in any index.
+	// The least recently looked up IPs are evicted first. If 0, the unknown IPs are not cached.
+	UnknownIPsCacheLen int
+	// UnknownIPsCacheTTL is the time after which an unknown IP is looked up again in the indexes.
+	UnknownIPsCacheTTL time.Duration
+	// ExternalNamesRefresh is the period after which the hostnames of the ExternalName Services are
+	// resolved again. If 0, the ExternalName Services are ignored.
+	ExternalNamesRefresh time.Duration
+	// NamespaceOnlyExcluded returns the Pods and Services of the namespaces that are excluded by the
+	// kube.Metadata namespace filter with only their namespace, instead of not finding them.
+	NamespaceOnlyExcluded bool
+	// Snapshot persists the metadata to restore it after a restart. Disabled if its path is empty.
+	Snapshot SnapshotConfig
+	// ProcessesSweep is the period after which the processes that don't exist anymore, and the namespaces
+	// and containers without live processes, are forgotten. If 0, they are only forgotten when the informer
+	// notifies the deletion of their containers.
+	ProcessesSweep time.Duration
+	// RemoteCluster is set when the local host is not a node of the watched cluster. Then the local
+	// processes are not added, and the container deletions are not listened for, so only the IP
+	// indexes are populated.
+	RemoteCluster bool
+}
 
-	if err := db.informer.AddPodEventHandler(cache.ResourceEventHandlerFuncs{
+// StartDatabase creates a Database that listens for the events of the informers. Its background
+// tasks run until the context is canceled or the Database is stopped.
+func StartDatabase(
+	ctx context.Context, informer Informer, metrics imetrics.Reporter, cfg DatabaseConfig,
+) (*Database, error) {
+	db := CreateDatabase(informer)
+	db.metrics = metrics
+	db.containerDeletions = metrics.KubeInformerEvents(resourceContainer, eventDelete)
+	db.podsCacheTTL = cfg.PodsCacheTTL
+	db.deletedPodsGrace = cfg.DeletedPodsGrace
+	db.namespaceOnlyExcluded = cfg.NamespaceOnlyExcluded
+	if cfg.UnknownIPsCacheLen > 0 {
+		db.unknownIPs = expirable.NewLRU[string, struct{}](cfg.UnknownIPsCacheLen, nil, cfg.UnknownIPsCacheTTL)
+	}
+	ctx, db.cancel = context.WithCancel(ctx)
+	// the snapshot is restored before listening for the informer events, so they overwrite it
+	restored := cfg.Snapshot.Path != "" && db.restoreSnapshot(cfg.Snapshot.Path)
+	db.remoteCluster = cfg.RemoteCluster
+	if !db.remoteCluster {
+		db.informer.AddContainerEventHandler(&db)
+	}
+
+	podsReg, err := db.informer.AddPodEventHandler(instrumentedHandler(metrics, resourcePod, cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			db.UpdateNewPodsByIPIndex(obj.(*kube.PodInfo))
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
-			db.UpdateDeletedPodsByIPIndex(oldObj.(*kube.PodInfo))
-			db.UpdateNewPodsByIPIndex(newObj.(*kube.PodInfo))
+			db.UpdatePodsByIPIndex(oldObj.(*kube.PodInfo), newObj.(*kube.PodInfo))
+			db.OnPodUpdate(oldObj.(*kube.PodInfo), newObj.(*kube.PodInfo))
 		},
 		DeleteFunc: func(obj interface{}) {
-			db.UpdateDeletedPodsByIPIndex(obj.(*kube.PodInfo))
+			if pod, ok := kube.DeletedObject[*kube.PodInfo](obj); ok {
+				db.UpdateDeletedPodsByIPIndex(pod)
+				db.OnPodDeletion(pod)
+			}
 		},
-	}); err != nil {
+	}))
+	if err != nil {
+		db.Stop()
 		return nil, fmt.Errorf("can't register Database as Pod event handler: %w", err)
 	}
+	db.registrations = append(db.registrations, podsReg)
+	slicesReg, err := db.informer.AddEndpointSliceEventHandler(instrumentedHandler(metrics, resourceEndpointSlice, cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			db.UpdateNewServicesByIPIndex(obj.(*kube.EndpointSliceInfo))
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			db.UpdateServicesByIPIndex(oldObj.(*kube.EndpointSliceInfo), newObj.(*kube.EndpointSliceInfo))
+		},
+		DeleteFunc: func(obj interface{}) {
+			if es, ok := kube.DeletedObject[*kube.EndpointSliceInfo](obj); ok {
+				db.UpdateDeletedServicesByIPIndex(es)
+			}
+		},
+	}))
+	if err != nil {
+		db.Stop()
+		return nil, fmt.Errorf("can't register Database as EndpointSlice event handler: %w", err)
+	}
+	db.registrations = append(db.registrations, slicesReg)
+	externalNames := cfg.ExternalNamesRefresh > 0
+	if externalNames {
+		db.externalNamesRefresh = cfg.ExternalNamesRefresh
+		db.externalNamesWake = make(chan struct{}, 1)
+		db.lookupHost = lookupExternalName
+	}
+	servicesReg, err := db.informer.AddServiceEventHandler(instrumentedHandler(metrics, resourceService, cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			svc := obj.(*kube.ServiceInfo)
+			db.OnSelectorService(nil, svc)
+			if externalNames {
+				db.OnExternalNameService(svc)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			db.OnSelectorService(oldObj.(*kube.ServiceInfo), newObj.(*kube.ServiceInfo))
+			if externalNames {
+				db.OnExternalNameService(newObj.(*kube.ServiceInfo))
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if svc, ok := kube.DeletedObject[*kube.ServiceInfo](obj); ok {
+				db.OnSelectorService(svc, nil)
+				if externalNames {
+					db.OnExternalNameServiceDeletion(svc)
+				}
+			}
+		},
+	}))
+	if err != nil {
+		db.Stop()
+		return nil, fmt.Errorf("can't register Database as Service event handler: %w", err)
+	}
+	db.registrations = append(db.registrations, servicesReg)
 
+	if db.podsCacheTTL > 0 {
+		go db.evictPodsCacheLoop(ctx)
+	}
+	if !db.remoteCluster {
+		db.inspections = make(chan inspection, pendingInspectionsLen)
+		db.inspectionRetry = inspectionRetryTime
+		go db.retryInspectionsLoop(ctx)
+		if cfg.ProcessesSweep > 0 {
+			go db.sweepProcessesLoop(ctx, cfg.ProcessesSweep)
+		}
+	}
+	if db.deletedPodsGrace > 0 {
+		go db.purgeDeletedLoop(ctx)
+	}
+	if cfg.ExternalNamesRefresh > 0 {
+		go db.resolveExternalNamesLoop(ctx)
+	}
+	go db.reconcileLoop(ctx, relistCheckPeriod, db.informer.ResyncPeriod())
+	if cfg.Snapshot.Path != "" {
+		go db.snapshotLoop(ctx, cfg.Snapshot, restored)
+	}
 	return &db, nil
 }
 
-// OnDeletion implements ContainerEventHandler
+// instrumentedHandler wraps the informer event handler functions to account each event, and the time
+// that its handling takes, in the internal metrics. The recorders are bound before wrapping, so the
+// handling of the events doesn't allocate.
+func instrumentedHandler(
+	metrics imetrics.Reporter, resource string, handler cache.ResourceEventHandlerFuncs,
+) cache.ResourceEventHandlerFuncs {
+	adds := metrics.KubeInformerEvents(resource, eventAdd)
+	updates := metrics.KubeInformerEvents(resource, eventUpdate)
+	deletes := metrics.KubeInformerEvents(resource, eventDelete)
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			start := time.Now()
+			handler.AddFunc(obj)
+			adds.Record(time.Since(start))
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			start := time.Now()
+			handler.UpdateFunc(oldObj, newObj)
+			updates.Record(time.Since(start))
+		},
+		DeleteFunc: func(obj interface{}) {
+			start := time.Now()
+			handler.DeleteFunc(obj)
+			deletes.Record(time.Since(start))
+		},
+	}
+}
+
+// Stop removes the Database from the informer event handlers, stops its background tasks and releases
+// its indexes. After stopping, the lookups don't find anything. Stopping an already stopped Database
+// has no effect.
+func (id *Database) Stop() {
+	if !id.stopped.CompareAndSwap(false, true) {
+		return
+	}
+	if id.cancel != nil {
+		id.cancel()
+	}
+	if id.informer != nil {
+		id.informer.RemoveContainerEventHandler(id)
+	}
+	for _, reg := range id.registrations {
+		if err := reg.Remove(); err != nil {
+			dblog().Debug("can't remove the Database from the informer event handlers", "error", err)
+		}
+	}
+	id.registrations = nil
+
+	id.cntMut.Lock()
+	id.containerIDs = map[string]pidNamespace{}
+	id.cntMut.Unlock()
+	id.nsMut.Lock()
+	id.namespaces = map[pidNamespace]*container.Info{}
+	id.generations = map[uint32]nsGeneration{}
+	id.processes = map[uint32]processContainer{}
+	id.sharedNamespaces = map[pidNamespace]struct{}{}
+	id.reinspections = map[pidNamespace]time.Time{}
+	id.nsMut.Unlock()
+	id.podsCacheMut.Lock()
+	id.fetchedPodsCache = map[pidNamespace]cachedPod{}
+	id.podNamespaces = map[types.UID]map[pidNamespace]struct{}{}
+	id.podsCacheMut.Unlock()
+	id.restoredMut.Lock()
+	id.restoredContainers = nil
+	id.restoredMut.Unlock()
+	id.clearExternalNames()
+	id.clearSelectors()
+	for _, sh := range id.ipShards {
+		sh.mut.Lock()
+		sh.reset()
+		sh.mut.Unlock()
+	}
+	id.podIPsLen.Store(0)
+	id.podIPPortsLen.Store(0)
+	id.serviceIPsLen.Store(0)
+	if id.unknownIPs != nil {
+		id.unknownIPs.Purge()
+	}
+}
+
+// evictPodsCacheLoop periodically removes the expired entries of the pods cache. Otherwise, the
+// entries of the short-lived namespaces that are never looked up again would be kept while their
+// pod exists, which might be forever for the pods that frequently spawn new processes.
+func (id *Database) evictPodsCacheLoop(ctx context.Context) {
+	ticker := time.NewTicker(id.podsCacheTTL / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			id.evictExpiredPods()
+		}
+	}
+}
+
+// evictExpiredPods removes the cached pods that are older than the TTL, and returns how many were removed
+func (id *Database) evictExpiredPods() int {
+	id.podsCacheMut.Lock()
+	defer id.podsCacheMut.Unlock()
+	evicted := 0
+	for ns, entry := range id.fetchedPodsCache {
+		if id.expired(entry) {
+			id.uncachePod(ns)
+			evicted++
+		}
+	}
+	if evicted > 0 {
+		id.metrics.KubeDatabaseEvictions(indexPodsByPIDNS, evicted)
+		id.metrics.KubeDatabaseIndexSize(indexPodsByPIDNS, len(id.fetchedPodsCache))
+	}
+	return evicted
+}
+
+func (id *Database) expired(entry cachedPod) bool {
+	return id.podsCacheTTL > 0 && timeNow().Sub(entry.cachedAt) >= id.podsCacheTTL
+}
+
+// replaced returns whether the informer store contains a pod with the same namespace and name as the cached
+// pod, but with another UID. It happens when a pod is recreated with the same name (e.g. by a StatefulSet) and
+// the deletion event of the previous incarnation was missed. The pods that are not in the store are kept, as their
+// deletion is handled by the informer events.
+func (id *Database) replaced(entry cachedPod) bool {
+	if id.informer == nil || entry.pod == nil {
+		return false
+	}
+	current, ok := id.informer.GetPod(entry.pod.Namespace, entry.pod.Name)
+	return ok && current.UID != entry.pod.UID
+}
+
+// purgeDeletedLoop periodically forgets the deleted pods and endpoints whose grace period is over
+func (id *Database) purgeDeletedLoop(ctx context.Context) {
+	ticker := time.NewTicker(id.deletedPodsGrace / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			id.purgeDeleted()
+		}
+	}
+}
+
+// purgeDeleted removes the deleted pods and endpoints whose grace period is over, and returns how many
+// IP entries were removed
+func (id *Database) purgeDeleted() int {
+	purgedPods, purgedSvcs := 0, 0
+	for _, sh := range id.ipShards {
+		sh.mut.Lock()
+		for ip, dp := range sh.deletedPodsByIP {
+			if !id.inGracePeriod(dp.deletedAt) {
+				delete(sh.deletedPodsByIP, ip)
+				purgedPods++
+			}
+		}
+		for ip, ipSlices := range sh.deletedServicesByIP {
+			for uid, ds := range ipSlices {
+				if !id.inGracePeriod(ds.deletedAt) {
+					delete(ipSlices, uid)
+				}
+			}
+			if len(ipSlices) == 0 {
+				delete(sh.deletedServicesByIP, ip)
+				purgedSvcs++
+			}
+		}
+		sh.mut.Unlock()
+	}
+	if purgedPods > 0 {
+		id.metrics.KubeDatabaseEvictions(indexPodsByIP, purgedPods)
+	}
+	if purgedSvcs > 0 {
+		id.metrics.KubeDatabaseEvictions(indexServicesByIP, purgedSvcs)
+	}
+	return purgedPods + purgedSvcs
+}
+
+func (id *Database) inGracePeriod(deletedAt time.Time) bool {
+	return timeNow().Sub(deletedAt) < id.deletedPodsGrace
+}
+
+// OnDeletion implements ContainerEventHandler. Besides forgetting the containers, it removes the IPs of
+// their pods if they don't exist anymore, in case the deletion of a pod was missed by the IP indexes.
 func (id *Database) OnDeletion(containerID []string) {
+	start := time.Now()
+	defer func() { id.containerDeletions.Record(time.Since(start)) }()
+	pods := map[types.UID]*kube.PodInfo{}
 	for _, cid := range containerID {
 		id.cntMut.Lock()
-		info, ok := id.containerIDs[cid]
+		ns, ok := id.containerIDs[cid]
 		delete(id.containerIDs, cid)
+		id.metrics.KubeDatabaseIndexSize(indexContainerIDs, len(id.containerIDs))
 		id.cntMut.Unlock()
-		if ok {
-			id.podsCacheMut.Lock()
-			delete(id.fetchedPodsCache, info.PIDNamespace)
-			id.podsCacheMut.Unlock()
-			id.nsMut.Lock()
-			delete(id.namespaces, info.PIDNamespace)
-			id.nsMut.Unlock()
+		if pod, found := id.containerPod(cid, ns, ok); found {
+			pods[pod.UID] = pod
+		}
+		if !ok {
+			continue
+		}
+		// the namespace is still alive while other containers share it
+		if !id.forgetProcesses(ns, cid) {
+			id.forgetNamespace(ns)
+		}
+	}
+	for _, pod := range pods {
+		id.pruneDeletedPod(pod)
+	}
+}
+
+// containerPod returns the pod of the container from the informer or, if the informer already removed it,
+// from the pods cache of its namespace
+func (id *Database) containerPod(containerID string, ns pidNamespace, hasNamespace bool) (*kube.PodInfo, bool) {
+	if id.informer != nil {
+		if pod, ok := id.informer.GetContainerPod(containerID); ok {
+			return pod, true
+		}
+	}
+	if !hasNamespace {
+		return nil, false
+	}
+	id.podsCacheMut.RLock()
+	defer id.podsCacheMut.RUnlock()
+	entry, ok := id.fetchedPodsCache[ns]
+	return entry.pod, ok
+}
+
+// pruneDeletedPod removes the IPs of the pod if the informer confirms that the pod does not exist
+// anymore. The pods that just restarted a container keep their IPs.
+func (id *Database) pruneDeletedPod(pod *kube.PodInfo) {
+	if id.informer == nil {
+		return
+	}
+	if current, ok := id.informer.GetPod(pod.Namespace, pod.Name); ok && current.UID == pod.UID {
+		return
+	}
+	dblog().Debug("removing the IPs of a deleted pod", "namespace", pod.Namespace, "name", pod.Name, "uid", pod.UID)
+	id.UpdateDeletedPodsByIPIndex(pod)
+}
+
+// forgetProcesses removes the processes of the given container, and returns true if the namespace is
+// shared with other containers
+func (id *Database) forgetProcesses(ns pidNamespace, containerID string) bool {
+	id.nsMut.Lock()
+	defer id.nsMut.Unlock()
+	for pid, pc := range id.processes {
+		if pc.containerID == containerID {
+			delete(id.processes, pid)
+		}
+	}
+	id.metrics.KubeDatabaseIndexSize(indexProcesses, len(id.processes))
+	_, shared := id.sharedNamespaces[ns]
+	return shared
+}
+
+// forgetNamespace removes all the information about the given generation of a PID namespace
+func (id *Database) forgetNamespace(ns pidNamespace) {
+	id.podsCacheMut.Lock()
+	id.uncachePod(ns)
+	id.metrics.KubeDatabaseIndexSize(indexPodsByPIDNS, len(id.fetchedPodsCache))
+	id.podsCacheMut.Unlock()
+	id.nsMut.Lock()
+	id.removeNamespace(ns)
+	id.nsMut.Unlock()
+}
+
+// removeNamespace removes the PID namespace and its processes. It must be invoked with the nsMut lock held.
+func (id *Database) removeNamespace(ns pidNamespace) {
+	delete(id.namespaces, ns)
+	delete(id.sharedNamespaces, ns)
+	delete(id.reinspections, ns)
+	for pid, pc := range id.processes {
+		if pc.ns == ns {
+			delete(id.processes, pid)
+		}
+	}
+	id.metrics.KubeDatabaseIndexSize(indexProcesses, len(id.processes))
+	if gen, ok := id.generations[ns.inode]; ok && gen.generation == ns.generation {
+		delete(id.generations, ns.inode)
+	}
+	id.metrics.KubeDatabaseIndexSize(indexPIDNamespaces, len(id.namespaces))
+}
+
+// OnPodDeletion removes the cached information of the deleted pod, even if its PID namespaces
+// are still alive. For example, a static pod or a pod in some sandboxed runtimes can be deleted
+// and recreated while keeping its sandbox, and no container deletion would be notified. This way,
+// the next lookup fetches the information of the recreated pod.
+func (id *Database) OnPodDeletion(pod *kube.PodInfo) {
+	id.uncachePodUID(pod.UID)
+}
+
+// OnPodUpdate removes the cached information of the updated pod if any of the fields that are
+// reported by the decorator changed, so the next lookup fetches the updated pod.
+func (id *Database) OnPodUpdate(oldPod, newPod *kube.PodInfo) {
+	if oldPod.StartTimeStr != newPod.StartTimeStr ||
+		!maps.Equal(oldPod.ContainerRestarts, newPod.ContainerRestarts) ||
+		!maps.Equal(oldPod.Annotations, newPod.Annotations) ||
+		!sameOwner(oldPod.Owner, newPod.Owner) {
+		id.uncachePodUID(oldPod.UID)
+	}
+}
+
+func (id *Database) uncachePodUID(uid types.UID) {
+	id.podsCacheMut.Lock()
+	defer id.podsCacheMut.Unlock()
+	for ns := range id.podNamespaces[uid] {
+		id.uncachePod(ns)
+	}
+	id.metrics.KubeDatabaseIndexSize(indexPodsByPIDNS, len(id.fetchedPodsCache))
+}
+
+// uncachePod removes the cached pod of the given namespace. It must be invoked with the podsCacheMut lock held.
+func (id *Database) uncachePod(ns pidNamespace) {
+	entry, ok := id.fetchedPodsCache[ns]
+	if !ok {
+		return
+	}
+	delete(id.fetchedPodsCache, ns)
+	if namespaces := id.podNamespaces[entry.pod.UID]; namespaces != nil {
+		delete(namespaces, ns)
+		if len(namespaces) == 0 {
+			delete(id.podNamespaces, entry.pod.UID)
 		}
 	}
 }
 
 // AddProcess also searches for the container.Info of the passed PID
 func (id *Database) AddProcess(pid uint32) {
-	ifp, err := container.InfoForPID(pid)
+	if id.stopped.Load() || id.remoteCluster {
+		return
+	}
+	inode, err := namespaceForPID(int32(pid))
+	if err != nil {
+		dblog().Debug("failing to get PID namespace", "pid", pid, "error", err)
+		return
+	}
+	start, err := processStartTime(pid)
 	if err != nil {
-		dblog().Debug("failing to get container information", "pid", pid, "error", err)
+		dblog().Debug("failing to get process start time", "pid", pid, "error", err)
 		return
 	}
+	// the generation is registered even if the process does not belong to any container, so the
+	// information from a previous namespace with the same inode is not attributed to this process
+	ns := id.registerGeneration(inode, pid, start)
+	id.inspectContainer(inspection{pid: pid, start: start, ns: ns})
+}
+
+// inspectContainer indexes the container information of the process. If it fails, the inspection is
+// scheduled to be retried, if the retries are enabled and the maximum number of attempts is not reached.
+func (id *Database) inspectContainer(insp inspection) {
+	ifp, err := containerInfoForPID(insp.pid)
+	if err != nil {
+		if id.inspections == nil || insp.attempt >= inspectionRetries {
+			dblog().Debug("failing to get container information", "pid", insp.pid, "error", err)
+			// the processes that don't run in a container are not expected to be decorated
+			if id.inspections != nil && !errors.Is(err, container.ErrNoContainer) {
+				id.metrics.KubeDatabaseInspectionFailure()
+			}
+			return
+		}
+		delay := id.inspectionRetry << insp.attempt
+		dblog().Debug("failing to get container information. Retrying",
+			"pid", insp.pid, "error", err, "attempt", insp.attempt+1, "delay", delay)
+		insp.attempt++
+		insp.due = timeNow().Add(delay)
+		select {
+		case id.inspections <- insp:
+		default:
+			dblog().Debug("too many pending inspections. Giving up", "pid", insp.pid)
+			id.metrics.KubeDatabaseInspectionFailure()
+		}
+		return
+	}
+	id.indexContainer(insp.pid, insp.start, insp.ns, ifp)
+}
+
+// indexContainer stores the container of a process. If the namespace was already indexed with another
+// container, it is either shared with the other container, if any of its processes is alive, or the
+// other container was replaced (for example, it was restarted in a pod whose sandbox kept the namespace)
+// and its information is discarded.
+func (id *Database) indexContainer(pid uint32, start uint64, ns pidNamespace, ifp container.Info) {
+	id.nsMut.RLock()
+	previous, ok := id.namespaces[ns]
+	_, shared := id.sharedNamespaces[ns]
+	id.nsMut.RUnlock()
+	replaced := ""
+	if ok && !shared && previous.ContainerID != ifp.ContainerID {
+		if id.containerAlive(ns, previous.ContainerID, pid) {
+			dblog().Debug("PID namespace is shared by multiple containers. Looking up its pods by process",
+				"inode", ns.inode, "containerID", ifp.ContainerID, "otherContainerID", previous.ContainerID)
+			shared = true
+		} else {
+			dblog().Debug("container of PID namespace was replaced. Discarding its previous information",
+				"inode", ns.inode, "containerID", ifp.ContainerID, "previousContainerID", previous.ContainerID)
+			replaced = previous.ContainerID
+		}
+	}
+
 	id.nsMut.Lock()
-	id.namespaces[ifp.PIDNamespace] = &ifp
+	if shared {
+		id.sharedNamespaces[ns] = struct{}{}
+	}
+	if replaced != "" {
+		for p, pc := range id.processes {
+			if pc.ns == ns && pc.containerID == replaced {
+				delete(id.processes, p)
+			}
+		}
+	}
+	id.namespaces[ns] = &ifp
+	id.processes[pid] = processContainer{ns: ns, containerID: ifp.ContainerID, start: start}
+	id.metrics.KubeDatabaseIndexSize(indexPIDNamespaces, len(id.namespaces))
+	id.metrics.KubeDatabaseIndexSize(indexProcesses, len(id.processes))
 	id.nsMut.Unlock()
+
 	id.cntMut.Lock()
-	id.containerIDs[ifp.ContainerID] = &ifp
+	if replaced != "" && id.containerIDs[replaced] == ns {
+		delete(id.containerIDs, replaced)
+	}
+	id.containerIDs[ifp.ContainerID] = ns
+	id.metrics.KubeDatabaseIndexSize(indexContainerIDs, len(id.containerIDs))
 	id.cntMut.Unlock()
+
+	if replaced != "" {
+		// the cached pod belongs to the previous container
+		id.podsCacheMut.Lock()
+		id.uncachePod(ns)
+		id.metrics.KubeDatabaseIndexSize(indexPodsByPIDNS, len(id.fetchedPodsCache))
+		id.podsCacheMut.Unlock()
+	}
 }
 
-// OwnerPodInfo returns the information of the pod owning the passed namespace
-func (id *Database) OwnerPodInfo(pidNamespace uint32) (*kube.PodInfo, bool) {
+// containerAlive returns true if any of the registered processes of the container in the given
+// namespace, other than the passed PID, is still running
+func (id *Database) containerAlive(ns pidNamespace, containerID string, pid uint32) bool {
+	for _, pc := range id.namespaceProcesses(ns) {
+		if pc.containerID == containerID && pc.pid != pid {
+			if start, err := processStartTime(pc.pid); err == nil && start == pc.start {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type registeredProcess struct {
+	processContainer
+	pid uint32
+}
+
+// namespaceProcesses returns the registered processes of the given namespace
+func (id *Database) namespaceProcesses(ns pidNamespace) []registeredProcess {
+	id.nsMut.RLock()
+	defer id.nsMut.RUnlock()
+	var procs []registeredProcess
+	for pid, pc := range id.processes {
+		if pc.ns == ns {
+			procs = append(procs, registeredProcess{processContainer: pc, pid: pid})
+		}
+	}
+	return procs
+}
+
+// reinspectNamespace inspects again the live processes of a namespace whose container is not found in
+// the informer, and returns the pod of their current container. The container of a process might have
+// changed since it was registered, for example if its cgroup was read before the runtime moved the process
+// into the cgroup of its container. The namespace is inspected at most once per reinspectionPeriod.
+func (id *Database) reinspectNamespace(ns pidNamespace, containerID string) (*kube.PodInfo, bool) {
+	now := timeNow()
+	id.nsMut.Lock()
+	if last, ok := id.reinspections[ns]; ok && now.Sub(last) < reinspectionPeriod {
+		id.nsMut.Unlock()
+		return nil, false
+	}
+	id.reinspections[ns] = now
+	id.nsMut.Unlock()
+
+	for _, proc := range id.namespaceProcesses(ns) {
+		if start, err := processStartTime(proc.pid); err != nil || start != proc.start {
+			continue
+		}
+		ifp, err := containerInfoForPID(proc.pid)
+		if err != nil || ifp.ContainerID == containerID {
+			continue
+		}
+		id.indexContainer(proc.pid, proc.start, ns, ifp)
+		return id.informer.GetContainerPod(ifp.ContainerID)
+	}
+	return nil, false
+}
+
+// retryInspectionsLoop inspects again the processes whose container information could not be retrieved,
+// once their backoff time is due
+func (id *Database) retryInspectionsLoop(ctx context.Context) {
+	ticker := time.NewTicker(id.inspectionRetry)
+	defer ticker.Stop()
+	var pending []inspection
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case insp := <-id.inspections:
+			pending = append(pending, insp)
+		case <-ticker.C:
+			if len(pending) == 0 {
+				continue
+			}
+			now := timeNow()
+			notDue := pending[:0]
+			var due []inspection
+			for _, insp := range pending {
+				if insp.due.After(now) {
+					notDue = append(notDue, insp)
+				} else {
+					due = append(due, insp)
+				}
+			}
+			pending = notDue
+			// the failed retries are enqueued again, so they are received in the next iterations
+			for _, insp := range due {
+				id.retryInspection(insp)
+			}
+		}
+	}
+}
+
+// retryInspection inspects again the container information of the process, unless the process
+// ended, its PID was reused by another process, or its namespace started a new generation
+func (id *Database) retryInspection(insp inspection) {
+	if id.stopped.Load() {
+		return
+	}
+	if start, err := processStartTime(insp.pid); err != nil || start != insp.start {
+		dblog().Debug("process ended before its container information could be retrieved", "pid", insp.pid)
+		return
+	}
+	if current, ok := id.currentNamespace(insp.ns.inode); !ok || current != insp.ns {
+		return
+	}
+	id.inspectContainer(insp)
+}
+
+// registerGeneration returns the current generation of the namespace of the given process.
+// A namespace keeps its generation as long as the first process registered in it is alive, as a
+// namespace can't be destroyed, and its inode reused, while it has running processes. Otherwise,
+// the process starts a new generation and the information from the previous generation is removed.
+// If the first process ended but the namespace is still alive, the new generation just causes
+// its information to be inspected again.
+func (id *Database) registerGeneration(inode, pid uint32, start uint64) pidNamespace {
+	id.nsMut.RLock()
+	current, ok := id.generations[inode]
+	id.nsMut.RUnlock()
+	if ok {
+		if current.firstPID == pid && current.generation == start {
+			return pidNamespace{inode: inode, generation: current.generation}
+		}
+		if firstStart, err := processStartTime(current.firstPID); err == nil && firstStart == current.generation {
+			return pidNamespace{inode: inode, generation: current.generation}
+		}
+		dblog().Debug("PID namespace has a new generation. Discarding its previous information",
+			"inode", inode, "pid", pid, "previousFirstPID", current.firstPID)
+		id.forgetNamespace(pidNamespace{inode: inode, generation: current.generation})
+	}
+	id.nsMut.Lock()
+	id.generations[inode] = nsGeneration{generation: start, firstPID: pid}
+	id.nsMut.Unlock()
+	return pidNamespace{inode: inode, generation: start}
+}
+
+// OwnerPodInfo returns the information of the pod owning the passed namespace. If the namespace is
+// shared by multiple containers, the pod is looked up by the container of the process with the passed
+// host PID. It can be invoked concurrently from multiple goroutines, and the returned PodInfo
+// must not be modified, as it is shared between them.
+// Only the information of the current generation of the namespace inode is returned.
+// The pods of the namespaces that are excluded from the decoration are not found, or only contain
+// their namespace, according to the DatabaseConfig.
+func (id *Database) OwnerPodInfo(pidNamespace, hostPID uint32) (*kube.PodInfo, bool) {
+	pod, ok := id.ownerPodInfo(pidNamespace, hostPID)
+	if !ok {
+		return nil, false
+	}
+	pod = id.decoratedPod(pod)
+	return pod, pod != nil
+}
+
+// OwnerPodExcluded returns true if the pod owning the passed namespace exists, but its namespace is
+// excluded from the decoration, so its processes are not decorated even if the pod is found
+func (id *Database) OwnerPodExcluded(pidNamespace, hostPID uint32) bool {
+	pod, ok := id.ownerPodInfo(pidNamespace, hostPID)
+	return ok && pod.Excluded
+}
+
+// decoratedPod returns the pod, or what is decorated from it if its namespace is excluded from the
+// decoration. The exclusion was evaluated when the pod was stored by the informer.
+func (id *Database) decoratedPod(pod *kube.PodInfo) *kube.PodInfo {
+	if pod == nil || !pod.Excluded {
+		return pod
+	}
+	if id.namespaceOnlyExcluded {
+		return pod.NamespaceOnly()
+	}
+	return nil
+}
+
+// decoratedSlice is the same as decoratedPod, for the EndpointSlices of the Services
+func (id *Database) decoratedSlice(es *kube.EndpointSliceInfo) *kube.EndpointSliceInfo {
+	if es == nil || !es.Excluded {
+		return es
+	}
+	if id.namespaceOnlyExcluded {
+		return es.NamespaceOnly()
+	}
+	return nil
+}
+
+func (id *Database) ownerPodInfo(pidNamespace, hostPID uint32) (*kube.PodInfo, bool) {
+	ns, ok := id.currentNamespace(pidNamespace)
+	if !ok {
+		id.metrics.KubeDatabaseLookup(indexPodsByPIDNS, false)
+		return nil, false
+	}
+	if containerID, shared := id.sharedContainerID(ns, hostPID); shared {
+		return id.processPodInfo(containerID)
+	}
+	return id.namespacePodInfo(ns)
+}
+
+// namespacePodInfo returns the pod of the container that runs the processes of the namespace, from the
+// pods cache or, if it's not cached yet, from the informer
+func (id *Database) namespacePodInfo(ns pidNamespace) (*kube.PodInfo, bool) {
 	id.podsCacheMut.RLock()
-	pod, ok := id.fetchedPodsCache[pidNamespace]
+	entry, ok := id.fetchedPodsCache[ns]
 	id.podsCacheMut.RUnlock()
+	// an expired entry that has not yet been evicted, or whose pod was replaced by another pod
+	// with the same name, is fetched again from the informer
+	ok = ok && !id.expired(entry) && !id.replaced(entry)
+	id.metrics.KubeDatabaseLookup(indexPodsByPIDNS, ok)
+	cached := entry.pod
+	pod := cached
 	if !ok {
 		id.nsMut.RLock()
-		info, ok := id.namespaces[pidNamespace]
+		info, ok := id.namespaces[ns]
 		id.nsMut.RUnlock()
 		if !ok {
 			return nil, false
 		}
-		pod, ok = id.informer.GetContainerPod(info.ContainerID)
-		if !ok {
-			return nil, false
+		if pod, ok = id.informer.GetContainerPod(info.ContainerID); !ok {
+			// the restored pods are not cached, so they are replaced as soon as the informer knows the pod
+			if restored, ok := id.restoredPod(info.ContainerID); ok {
+				return restored, true
+			}
+			if pod, ok = id.reinspectNamespace(ns, info.ContainerID); !ok {
+				return nil, false
+			}
 		}
-		id.podsCacheMut.Lock()
-		id.fetchedPodsCache[pidNamespace] = pod
-		id.podsCacheMut.Unlock()
 	}
-	// we check DeploymentName after caching, as the replicasetInfo might be
-	// received late by the replicaset informer
-	id.informer.FetchPodOwnerInfo(pod)
+	if ok && (entry.ownerResolved || timeNow().Before(entry.ownerFetchAt)) {
+		return cached, true
+	}
+	// we check the Deployment owner after caching, as the replicasetInfo might be
+	// received late by the replicaset informer. The cached pod is never updated in place,
+	// but replaced by an updated copy, to avoid data races with the goroutines that are reading it.
+	pod = id.informer.PodWithOwnerInfo(pod)
+	if pod != cached || !ok {
+		pod = id.cachePod(ns, cached, pod)
+	} else {
+		id.backOffOwnerFetch(ns, cached)
+	}
 	return pod, true
 }
 
-func (id *Database) UpdateNewPodsByIPIndex(pod *kube.PodInfo) {
-	if len(pod.IPs) > 0 {
-		id.podsMut.Lock()
-		defer id.podsMut.Unlock()
-		for _, ip := range pod.IPs {
-			id.podsByIP[ip] = pod
+// ownerResolved returns true if the Deployment of the pod doesn't need to be fetched
+func ownerResolved(pod *kube.PodInfo) bool {
+	return pod.Owner == nil || pod.Owner.Type != kube.OwnerReplicaSet || pod.Owner.Owner != nil
+}
+
+// backOffOwnerFetch doubles the time until the next fetch of the Deployment of the cached pod,
+// unless it has been replaced in the meantime
+func (id *Database) backOffOwnerFetch(ns pidNamespace, pod *kube.PodInfo) {
+	id.podsCacheMut.Lock()
+	defer id.podsCacheMut.Unlock()
+	entry, ok := id.fetchedPodsCache[ns]
+	if !ok || entry.pod != pod {
+		return
+	}
+	entry.ownerBackoff = min(2*entry.ownerBackoff, maxOwnerFetchBackoff)
+	entry.ownerFetchAt = timeNow().Add(entry.ownerBackoff)
+	id.fetchedPodsCache[ns] = entry
+}
+
+// OwnerPodInfoForContainerID returns the pod of the container with the provided ID, for the callers that
+// know the container of a process but not its PID namespace. The ID can be provided in the raw or in the
+// runtime-prefixed form, and in its full or truncated form. The containers whose processes were added
+// with AddProcess are looked up through the pods cache of their namespace, and the rest in the informer.
+// As in OwnerPodInfo, the namespace filter is applied to the returned pod.
+func (id *Database) OwnerPodInfoForContainerID(containerID string) (*kube.PodInfo, bool) {
+	pod, ok := id.containerPodInfo(containerID)
+	if !ok {
+		return nil, false
+	}
+	pod = id.decoratedPod(pod)
+	return pod, pod != nil
+}
+
+func (id *Database) containerPodInfo(containerID string) (*kube.PodInfo, bool) {
+	containerID = kube.NormalizeContainerID(containerID)
+	if containerID == "" {
+		return nil, false
+	}
+	if len(containerID) == kube.ShortContainerIDLen {
+		containerID = id.fullContainerID(containerID)
+	}
+	id.cntMut.Lock()
+	ns, registered := id.containerIDs[containerID]
+	id.cntMut.Unlock()
+	if registered {
+		// the namespaces that are shared by multiple containers don't identify a pod
+		if current, ok := id.currentNamespace(ns.inode); ok && current == ns {
+			if _, shared := id.sharedContainerID(ns, 0); !shared {
+				if pod, ok := id.namespacePodInfo(ns); ok {
+					return pod, true
+				}
+			}
+		}
+	}
+	pod, ok := id.informer.GetContainerPod(containerID)
+	id.metrics.KubeDatabaseLookup(indexContainerIDs, ok)
+	if !ok {
+		return id.restoredPod(containerID)
+	}
+	return id.informer.PodWithOwnerInfo(pod), true
+}
+
+// fullContainerID returns the full ID of the container whose ID starts with the truncated ID, from the
+// registered containers or from the informer. If it's not found, it returns the truncated ID.
+func (id *Database) fullContainerID(short string) string {
+	id.cntMut.Lock()
+	for cid := range id.containerIDs {
+		if strings.HasPrefix(cid, short) {
+			id.cntMut.Unlock()
+			return cid
+		}
+	}
+	id.cntMut.Unlock()
+	if pod, ok := id.informer.GetContainerPod(short); ok {
+		if cid, ok := pod.FullContainerID(short); ok {
+			return cid
 		}
 	}
+	return short
+}
+
+// processPodInfo returns the pod of the given container. The pods of the shared namespaces are not
+// cached, as the pods cache is indexed by namespace.
+func (id *Database) processPodInfo(containerID string) (*kube.PodInfo, bool) {
+	if containerID == "" {
+		id.metrics.KubeDatabaseLookup(indexProcesses, false)
+		return nil, false
+	}
+	pod, ok := id.informer.GetContainerPod(containerID)
+	id.metrics.KubeDatabaseLookup(indexProcesses, ok)
+	if !ok {
+		return id.restoredPod(containerID)
+	}
+	return id.informer.PodWithOwnerInfo(pod), true
+}
+
+// sharedContainerID returns true if the namespace is shared by multiple containers, as well as the
+// container of the process with the passed host PID, or an empty string if it is not known
+func (id *Database) sharedContainerID(ns pidNamespace, hostPID uint32) (string, bool) {
+	id.nsMut.RLock()
+	defer id.nsMut.RUnlock()
+	if _, shared := id.sharedNamespaces[ns]; !shared {
+		return "", false
+	}
+	if pc, ok := id.processes[hostPID]; ok && pc.ns == ns {
+		return pc.containerID, true
+	}
+	return "", true
+}
+
+// ContainerID returns the ID of the container that runs the processes of the passed namespace.
+// If the pod shares the process namespace between its containers, it can be the ID of any of them.
+// If the namespace is shared by multiple pods, it is the container of the process with the passed host PID.
+func (id *Database) ContainerID(pidNamespace, hostPID uint32) (string, bool) {
+	ns, ok := id.currentNamespace(pidNamespace)
+	if !ok {
+		return "", false
+	}
+	if containerID, shared := id.sharedContainerID(ns, hostPID); shared {
+		return containerID, containerID != ""
+	}
+	id.nsMut.RLock()
+	defer id.nsMut.RUnlock()
+	info, ok := id.namespaces[ns]
+	if !ok {
+		return "", false
+	}
+	return info.ContainerID, true
+}
+
+// currentNamespace returns the current generation of the namespace with the given inode
+func (id *Database) currentNamespace(inode uint32) (pidNamespace, bool) {
+	id.nsMut.RLock()
+	defer id.nsMut.RUnlock()
+	gen, ok := id.generations[inode]
+	return pidNamespace{inode: inode, generation: gen.generation}, ok
+}
+
+// cachePod stores the pod for the given namespace, unless another goroutine replaced the
+// previously cached pod in the meantime (for example, during a storm of cache misses
+// for the same namespace). In that case, the pod stored by the other goroutine is returned.
+// The pod is not stored if the namespace generation changed in the meantime.
+func (id *Database) cachePod(ns pidNamespace, previous, pod *kube.PodInfo) *kube.PodInfo {
+	id.podsCacheMut.Lock()
+	defer id.podsCacheMut.Unlock()
+	if current, ok := id.fetchedPodsCache[ns]; ok && current.pod != previous {
+		return current.pod
+	}
+	if current, ok := id.currentNamespace(ns.inode); !ok || current != ns {
+		return pod
+	}
+	id.uncachePod(ns)
+	now := timeNow()
+	entry := cachedPod{pod: pod, cachedAt: now, ownerResolved: ownerResolved(pod)}
+	if !entry.ownerResolved {
+		entry.ownerBackoff = ownerFetchBackoff
+		entry.ownerFetchAt = now.Add(ownerFetchBackoff)
+	}
+	id.fetchedPodsCache[ns] = entry
+	namespaces, ok := id.podNamespaces[pod.UID]
+	if !ok {
+		namespaces = map[pidNamespace]struct{}{}
+		id.podNamespaces[pod.UID] = namespaces
+	}
+	namespaces[ns] = struct{}{}
+	id.metrics.KubeDatabaseIndexSize(indexPodsByPIDNS, len(id.fetchedPodsCache))
+	return pod
+}
+
+// NamespaceLabels returns the labels of the namespace with the provided name, if it is already known
+func (id *Database) NamespaceLabels(namespace string) (map[string]string, bool) {
+	return id.informer.GetNamespaceLabels(namespace)
+}
+
+// WaitForCacheSync blocks until the caches of the Kubernetes informers are synced, or returns an
+// error if the context is done before
+func (id *Database) WaitForCacheSync(ctx context.Context) error {
+	return id.informer.WaitForCacheSync(ctx)
+}
+
+// ClusterName returns the name of the cluster, or an empty string if it is not resolved yet
+func (id *Database) ClusterName() string {
+	return id.informer.GetClusterName()
+}
+
+// NodeInfo returns the topology of the node with the provided name, if it is already known
+func (id *Database) NodeInfo(name string) (*kube.NodeInfo, bool) {
+	return id.informer.GetNodeInfo(name)
 }
 
+// ClearPodsCache releases the pods that have been cached by OwnerPodInfo. They are fetched
+// again from the informer when they are required.
+func (id *Database) ClearPodsCache() {
+	id.podsCacheMut.Lock()
+	id.fetchedPodsCache = map[pidNamespace]cachedPod{}
+	id.podNamespaces = map[types.UID]map[pidNamespace]struct{}{}
+	id.metrics.KubeDatabaseIndexSize(indexPodsByPIDNS, 0)
+	id.podsCacheMut.Unlock()
+}
+
+// UpdateNewPodsByIPIndex indexes the pod by its IPs. As the informer events might be received out of
+// order during fast rollouts, an IP that is indexed for another pod is only overwritten if the
+// incoming pod was created later, so a dead pod never replaces the live pod that reuses its IP.
+func (id *Database) UpdateNewPodsByIPIndex(pod *kube.PodInfo) {
+	id.reindexPod(nil, pod)
+}
+
+// UpdateDeletedPodsByIPIndex removes the IPs of the pod from the index, unless they
+// have been already reassigned to another pod. During the deleted pods grace period,
+// the IPs are still resolved to the deleted pod.
 func (id *Database) UpdateDeletedPodsByIPIndex(pod *kube.PodInfo) {
-	if len(pod.IPs) > 0 {
-		id.podsMut.Lock()
-		defer id.podsMut.Unlock()
-		for _, ip := range pod.IPs {
-			delete(id.podsByIP, ip)
+	id.reindexPod(pod, nil)
+}
+
+// UpdatePodsByIPIndex reindexes an updated pod. The IPs that the pod doesn't have anymore are
+// removed as if the pod was deleted, while the IPs that it keeps are just pointed to the updated pod.
+// Most updates (readiness changes, conditions...) don't change the addresses of the pod, so they don't
+// take the write locks of the indexes unless any of the stored fields changed.
+func (id *Database) UpdatePodsByIPIndex(oldPod, newPod *kube.PodInfo) {
+	if oldPod.UID != newPod.UID || !sameAddresses(oldPod, newPod) {
+		id.reindexPod(oldPod, newPod)
+		return
+	}
+	if !samePodInfo(oldPod, newPod) {
+		id.refreshPod(newPod)
+	}
+}
+
+// samePodInfo returns whether the rest of the fields that the informer stores for the pod are equal
+func samePodInfo(oldPod, newPod *kube.PodInfo) bool {
+	return oldPod.Name == newPod.Name && oldPod.Namespace == newPod.Namespace &&
+		oldPod.CreationTimestamp.Equal(&newPod.CreationTimestamp) &&
+		oldPod.NodeName == newPod.NodeName &&
+		oldPod.ServiceAccount == newPod.ServiceAccount &&
+		oldPod.StartTimeStr == newPod.StartTimeStr &&
+		oldPod.Excluded == newPod.Excluded &&
+		sameOwner(oldPod.Owner, newPod.Owner) &&
+		maps.Equal(oldPod.Labels, newPod.Labels) &&
+		maps.Equal(oldPod.Annotations, newPod.Annotations) &&
+		slices.Equal(oldPod.ContainerIDs, newPod.ContainerIDs) &&
+		maps.Equal(oldPod.ContainerRestarts, newPod.ContainerRestarts) &&
+		maps.Equal(oldPod.Containers, newPod.Containers)
+}
+
+func sameOwner(a, b *kube.Owner) bool {
+	for ; a != nil && b != nil; a, b = a.Owner, b.Owner {
+		if a.Type != b.Type || a.Name != b.Name {
+			return false
+		}
+	}
+	return a == nil && b == nil
+}
+
+func sameAddresses(oldPod, newPod *kube.PodInfo) bool {
+	return slices.Equal(oldPod.IPs, newPod.IPs) &&
+		slices.Equal(oldPod.HostIPs, newPod.HostIPs) &&
+		slices.Equal(oldPod.HostPorts, newPod.HostPorts)
+}
+
+// refreshPod points the index entries of the pod to its updated copy, whose addresses didn't change.
+// The entries that are currently owned by other pods are kept.
+func (id *Database) refreshPod(pod *kube.PodInfo) {
+	for ip := range ipSet(pod.IPs) {
+		sh := id.shard(ip)
+		sh.mut.Lock()
+		if current, ok := sh.podsByIP[ip]; ok && current.UID == pod.UID {
+			sh.podsByIP[ip] = pod
+		}
+		sh.mut.Unlock()
+	}
+	for ip := range ipSet(pod.HostIPs) {
+		sh := id.shard(ip)
+		sh.mut.Lock()
+		for _, port := range pod.HostPorts {
+			key := ipPortKey{ip: ip, port: port}
+			if current, ok := sh.podsByIPPort[key]; ok && current.UID == pod.UID {
+				sh.podsByIPPort[key] = pod
+			}
+		}
+		sh.mut.Unlock()
+	}
+}
+
+// reindexPod updates the IP indexes for a pod that changed from oldPod to newPod. oldPod is nil for
+// the created pods, and newPod is nil for the deleted pods. Each IP is updated at once in its shard,
+// so the readers never miss the IPs that the pod keeps.
+func (id *Database) reindexPod(oldPod, newPod *kube.PodInfo) {
+	var oldIPs, newIPs, oldHostIPs, newHostIPs map[string]struct{}
+	if oldPod != nil {
+		oldIPs = ipSet(oldPod.IPs)
+		if len(oldPod.HostPorts) > 0 {
+			oldHostIPs = ipSet(oldPod.HostIPs)
+		}
+	}
+	if newPod != nil {
+		newIPs = ipSet(newPod.IPs)
+		if len(newPod.HostPorts) > 0 {
+			newHostIPs = ipSet(newPod.HostIPs)
+		}
+	}
+	now := timeNow()
+	for ip := range oldIPs {
+		if _, ok := newIPs[ip]; !ok {
+			sh := id.shard(ip)
+			sh.mut.Lock()
+			id.removePodIP(sh, ip, oldPod, now)
+			sh.mut.Unlock()
+		}
+	}
+	for ip := range newIPs {
+		sh := id.shard(ip)
+		sh.mut.Lock()
+		id.addPodIP(sh, ip, newPod)
+		sh.mut.Unlock()
+	}
+	for ip := range oldHostIPs {
+		if _, ok := newHostIPs[ip]; ok {
+			id.reindexPodPorts(ip, oldPod, newPod)
+		} else {
+			id.reindexPodPorts(ip, oldPod, nil)
+		}
+	}
+	for ip := range newHostIPs {
+		if _, ok := oldHostIPs[ip]; !ok {
+			id.reindexPodPorts(ip, nil, newPod)
+		}
+	}
+	if len(oldIPs) > 0 || len(newIPs) > 0 {
+		id.metrics.KubeDatabaseIndexSize(indexPodsByIP, int(id.podIPsLen.Load()))
+	}
+	if len(oldHostIPs) > 0 || len(newHostIPs) > 0 {
+		id.metrics.KubeDatabaseIndexSize(indexPodsByIPPort, int(id.podIPPortsLen.Load()))
+	}
+}
+
+// addPodIP must be invoked with the shard lock held
+func (id *Database) addPodIP(sh *ipShard, ip string, pod *kube.PodInfo) {
+	current, ok := sh.podsByIP[ip]
+	if ok && current.UID != pod.UID && pod.CreationTimestamp.Before(&current.CreationTimestamp) {
+		dblog().Debug("ignoring the IP of a pod that is older than the pod that currently owns it",
+			"ip", ip, "pod", pod.Namespace+"/"+pod.Name, "currentPod", current.Namespace+"/"+current.Name)
+		return
+	}
+	if !ok {
+		id.podIPsLen.Add(1)
+	}
+	sh.podsByIP[ip] = pod
+	// a live pod that claims the IP of a deleted pod immediately replaces it
+	delete(sh.deletedPodsByIP, ip)
+	id.forgetUnknownIP(ip)
+}
+
+// removePodIP removes the IP if it's still owned by the pod. It must be invoked with the shard lock held.
+func (id *Database) removePodIP(sh *ipShard, ip string, pod *kube.PodInfo, now time.Time) {
+	if current, ok := sh.podsByIP[ip]; ok && current.UID == pod.UID {
+		delete(sh.podsByIP, ip)
+		id.podIPsLen.Add(-1)
+		if id.deletedPodsGrace > 0 {
+			sh.deletedPodsByIP[ip] = deletedPod{pod: current, deletedAt: now}
 		}
 	}
 }
 
+// reindexPodPorts updates the entries of a node IP for the hostNetwork pods, which are indexed by each
+// of their container ports, and for the pods with hostPort mappings, which are indexed by each of their
+// host ports. oldPod or newPod are nil if they don't have the IP.
+func (id *Database) reindexPodPorts(ip string, oldPod, newPod *kube.PodInfo) {
+	sh := id.shard(ip)
+	sh.mut.Lock()
+	defer sh.mut.Unlock()
+	if oldPod != nil {
+		for _, port := range oldPod.HostPorts {
+			key := ipPortKey{ip: ip, port: port}
+			// the port might be claimed by another pod
+			if current, ok := sh.podsByIPPort[key]; ok && current.UID == oldPod.UID {
+				delete(sh.podsByIPPort, key)
+				id.podIPPortsLen.Add(-1)
+				if hip := sh.hostIPs[ip]; hip.ports > 1 {
+					hip.ports--
+					sh.hostIPs[ip] = hip
+				} else {
+					delete(sh.hostIPs, ip)
+				}
+			}
+		}
+	}
+	if newPod != nil {
+		for _, port := range newPod.HostPorts {
+			id.addPodPort(sh, ipPortKey{ip: ip, port: port}, newPod)
+		}
+	}
+}
+
+// addPodPort indexes the pod by the node IP and port. If two pods claim the same port in the same node,
+// the most recently started pod is kept. It must be invoked with the shard lock held.
+func (id *Database) addPodPort(sh *ipShard, key ipPortKey, pod *kube.PodInfo) {
+	current, ok := sh.podsByIPPort[key]
+	if ok && current.UID != pod.UID {
+		newest := pod
+		if current.StartTimeStr > pod.StartTimeStr {
+			newest = current
+		}
+		dblog().Warn("two pods claim the same port of the node. Keeping the newest",
+			"ip", key.ip, "port", key.port,
+			"pod", current.Namespace+"/"+current.Name, "otherPod", pod.Namespace+"/"+pod.Name,
+			"kept", newest.Namespace+"/"+newest.Name)
+		if newest == current {
+			return
+		}
+	}
+	if !ok {
+		id.podIPPortsLen.Add(1)
+		hip := sh.hostIPs[key.ip]
+		hip.ports++
+		hip.node = pod.NodeName
+		sh.hostIPs[key.ip] = hip
+		id.forgetUnknownIP(key.ip)
+	}
+	sh.podsByIPPort[key] = pod
+}
+
+// PodInfoForIP returns the Pod with the provided IP address. IPv4, IPv6 and IPv4-mapped
+// IPv6 addresses are accepted in any of their text representations.
+// If no live pod has the IP, it returns the pod that had it, if it was deleted during the
+// deleted pods grace period. The namespace filter is applied as in OwnerPodInfo.
 func (id *Database) PodInfoForIP(ip string) *kube.PodInfo {
-	id.podsMut.RLock()
-	defer id.podsMut.RUnlock()
-	return id.podsByIP[ip]
+	ip = kube.NormalizeIP(ip)
+	sh := id.shard(ip)
+	sh.mut.RLock()
+	pod, ok := id.podForIP(sh, ip)
+	sh.mut.RUnlock()
+	id.metrics.KubeDatabaseLookup(indexPodsByIP, ok)
+	return id.decoratedPod(pod)
+}
+
+// PodInfoForIPPort returns the Pod with the provided IP address and port. If the IP belongs to a node,
+// it returns the hostNetwork Pod that declares the port as a container port, or the Pod that maps the
+// port as a hostPort. Otherwise, it returns the same as PodInfoForIP.
+func (id *Database) PodInfoForIPPort(ip string, port uint16) *kube.PodInfo {
+	ip = kube.NormalizeIP(ip)
+	sh := id.shard(ip)
+	sh.mut.RLock()
+	var pod *kube.PodInfo
+	portOK, ipOK := false, false
+	if port != 0 {
+		pod, portOK = sh.podsByIPPort[ipPortKey{ip: ip, port: port}]
+	}
+	if !portOK {
+		pod, ipOK = id.podForIP(sh, ip)
+	}
+	sh.mut.RUnlock()
+	if port != 0 {
+		id.metrics.KubeDatabaseLookup(indexPodsByIPPort, portOK)
+	}
+	if !portOK {
+		id.metrics.KubeDatabaseLookup(indexPodsByIP, ipOK)
+	}
+	return id.decoratedPod(pod)
+}
+
+// podForIP must be invoked with the shard read lock held
+func (id *Database) podForIP(sh *ipShard, ip string) (*kube.PodInfo, bool) {
+	if pod, ok := sh.podsByIP[ip]; ok {
+		return pod, true
+	}
+	if dp, ok := sh.deletedPodsByIP[ip]; ok && id.inGracePeriod(dp.deletedAt) {
+		return dp.pod, true
+	}
+	return nil, false
+}
+
+// UpdateNewServicesByIPIndex indexes the endpoint IPs of the EndpointSlice. The slices that are
+// not owned by a Service are ignored.
+func (id *Database) UpdateNewServicesByIPIndex(es *kube.EndpointSliceInfo) {
+	id.reindexSlice(nil, es)
+}
+
+// UpdateDeletedServicesByIPIndex removes the endpoint IPs of the EndpointSlice, keeping the
+// entries of any other slice that contains the same IPs. During the deleted pods grace period,
+// the IPs are still resolved to the Service of the slice.
+func (id *Database) UpdateDeletedServicesByIPIndex(es *kube.EndpointSliceInfo) {
+	id.reindexSlice(es, nil)
+}
+
+// UpdateServicesByIPIndex reindexes an updated EndpointSlice. The endpoints that were removed from
+// the slice, for example because their pod terminated, are removed as if the slice was deleted.
+func (id *Database) UpdateServicesByIPIndex(oldES, newES *kube.EndpointSliceInfo) {
+	id.reindexSlice(oldES, newES)
+}
+
+// reindexSlice updates the services index for an EndpointSlice that changed from oldES to newES.
+// oldES is nil for the created slices, and newES is nil for the deleted slices.
+func (id *Database) reindexSlice(oldES, newES *kube.EndpointSliceInfo) {
+	var oldIPs, newIPs map[string]struct{}
+	if oldES != nil {
+		oldIPs = ipSet(oldES.IPs)
+	}
+	// if the slice is not owned by a Service, none of its IPs are indexed
+	if newES != nil && newES.ServiceName != "" {
+		newIPs = ipSet(newES.IPs)
+	}
+	if len(oldIPs) == 0 && len(newIPs) == 0 {
+		return
+	}
+	now := timeNow()
+	for ip := range oldIPs {
+		if _, ok := newIPs[ip]; !ok {
+			sh := id.shard(ip)
+			sh.mut.Lock()
+			id.removeSliceIP(sh, ip, oldES, now)
+			sh.mut.Unlock()
+		}
+	}
+	for ip := range newIPs {
+		sh := id.shard(ip)
+		sh.mut.Lock()
+		id.addSliceIP(sh, ip, newES)
+		sh.mut.Unlock()
+	}
+	id.metrics.KubeDatabaseIndexSize(indexServicesByIP, int(id.serviceIPsLen.Load()))
+}
+
+// addSliceIP must be invoked with the shard lock held
+func (id *Database) addSliceIP(sh *ipShard, ip string, es *kube.EndpointSliceInfo) {
+	ipSlices, ok := sh.servicesByIP[ip]
+	if !ok {
+		ipSlices = map[types.UID]*kube.EndpointSliceInfo{}
+		sh.servicesByIP[ip] = ipSlices
+		id.serviceIPsLen.Add(1)
+	}
+	ipSlices[es.UID] = es
+	if deleted, ok := sh.deletedServicesByIP[ip]; ok {
+		delete(deleted, es.UID)
+		if len(deleted) == 0 {
+			delete(sh.deletedServicesByIP, ip)
+		}
+	}
+	id.forgetUnknownIP(ip)
+}
+
+// removeSliceIP must be invoked with the shard lock held
+func (id *Database) removeSliceIP(sh *ipShard, ip string, es *kube.EndpointSliceInfo, now time.Time) {
+	ipSlices, ok := sh.servicesByIP[ip]
+	if !ok {
+		return
+	}
+	current, ok := ipSlices[es.UID]
+	if !ok {
+		return
+	}
+	delete(ipSlices, es.UID)
+	if len(ipSlices) == 0 {
+		delete(sh.servicesByIP, ip)
+		id.serviceIPsLen.Add(-1)
+	}
+	if id.deletedPodsGrace > 0 {
+		deleted, ok := sh.deletedServicesByIP[ip]
+		if !ok {
+			deleted = map[types.UID]deletedSlice{}
+			sh.deletedServicesByIP[ip] = deleted
+		}
+		deleted[es.UID] = deletedSlice{slice: current, deletedAt: now}
+	}
+}
+
+// ServiceForIP returns the EndpointSlice of the Service that is served by the endpoint with the
+// provided IP address. If the port is not 0, only the slices that expose it, or that don't restrict
+// their ports, are considered. If the IP serves multiple Services, the normal Services are preferred
+// over the headless ones, then the slices that explicitly expose the port, and the tie is broken by
+// the namespace and name of the Service, so the same Service is always returned.
+// If no live endpoint has the IP, the slices that removed it during the deleted pods grace period are
+// considered. The namespace filter is applied as in OwnerPodInfo.
+func (id *Database) ServiceForIP(ip string, port uint16) *kube.EndpointSliceInfo {
+	ip = kube.NormalizeIP(ip)
+	sh := id.shard(ip)
+	sh.mut.RLock()
+	found := id.serviceForIP(sh, ip, port)
+	sh.mut.RUnlock()
+	id.metrics.KubeDatabaseLookup(indexServicesByIP, found != nil)
+	return id.decoratedSlice(found)
+}
+
+// serviceForIP must be invoked with the shard read lock held
+func (id *Database) serviceForIP(sh *ipShard, ip string, port uint16) *kube.EndpointSliceInfo {
+	found := bestSliceForPort(sh.servicesByIP[ip], port)
+	if found == nil && len(sh.deletedServicesByIP[ip]) > 0 {
+		inGrace := map[types.UID]*kube.EndpointSliceInfo{}
+		for uid, ds := range sh.deletedServicesByIP[ip] {
+			if id.inGracePeriod(ds.deletedAt) {
+				inGrace[uid] = ds.slice
+			}
+		}
+		found = bestSliceForPort(inGrace, port)
+	}
+	return found
+}
+
+func bestSliceForPort(candidates map[types.UID]*kube.EndpointSliceInfo, port uint16) *kube.EndpointSliceInfo {
+	var found *kube.EndpointSliceInfo
+	foundPortMatch := false
+	for _, es := range candidates {
+		portMatch := port != 0 && slices.Contains(es.Ports, port)
+		if port != 0 && !portMatch && len(es.Ports) > 0 {
+			continue
+		}
+		if found == nil || betterSlice(es, portMatch, found, foundPortMatch) {
+			found, foundPortMatch = es, portMatch
+		}
+	}
+	return found
+}
+
+// betterSlice returns true if the candidate slice should be preferred over the current one
+func betterSlice(es *kube.EndpointSliceInfo, portMatch bool, found *kube.EndpointSliceInfo, foundPortMatch bool) bool {
+	if es.Headless != found.Headless {
+		return !es.Headless
+	}
+	if portMatch != foundPortMatch {
+		return portMatch
+	}
+	return serviceLess(es, found)
+}
+
+// IsUnknownIP returns true if the IP was recently looked up without being found in any
+// of the IP indexes, and no pod or endpoint has claimed it since then
+func (id *Database) IsUnknownIP(ip string) bool {
+	if id.unknownIPs == nil {
+		return false
+	}
+	_, ok := id.unknownIPs.Get(kube.NormalizeIP(ip))
+	id.metrics.KubeDatabaseLookup(indexUnknownIPs, ok)
+	return ok
+}
+
+// AddUnknownIP remembers that the IP could not be resolved, so it's not looked up again in the
+// indexes until it's claimed by a pod or endpoint, or the cache entry expires. The IP is not
+// remembered if it's present in any of the indexes, for example because it has been looked up
+// by a port that the pod does not expose.
+func (id *Database) AddUnknownIP(ip string) {
+	if id.unknownIPs == nil {
+		return
+	}
+	ip = kube.NormalizeIP(ip)
+	// the lock is held while the IP is stored, so it can't be added to the indexes in between
+	sh := id.shard(ip)
+	sh.mut.RLock()
+	defer sh.mut.RUnlock()
+	if _, ok := sh.podsByIP[ip]; ok {
+		return
+	}
+	if _, ok := sh.deletedPodsByIP[ip]; ok {
+		return
+	}
+	if _, ok := sh.hostIPs[ip]; ok {
+		return
+	}
+	if _, ok := sh.servicesByIP[ip]; ok {
+		return
+	}
+	if _, ok := sh.deletedServicesByIP[ip]; ok {
+		return
+	}
+	id.unknownIPs.Add(ip, struct{}{})
+	id.metrics.KubeDatabaseIndexSize(indexUnknownIPs, id.unknownIPs.Len())
+}
+
+// forgetUnknownIP must be invoked while holding the write lock of the shard that has just stored the IP
+func (id *Database) forgetUnknownIP(ip string) {
+	if id.unknownIPs != nil {
+		id.unknownIPs.Remove(ip)
+	}
+}
+
+// shard returns the shard of the IP indexes that holds the given normalized IP
+func (id *Database) shard(ip string) *ipShard {
+	return id.ipShards[maphash.String(id.ipSeed, ip)%numIPShards]
+}
+
+// ipSet returns the normalized IPs
+func ipSet(ips []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(ips))
+	for _, ip := range ips {
+		set[kube.NormalizeIP(ip)] = struct{}{}
+	}
+	return set
+}
+
+func serviceLess(a, b *kube.EndpointSliceInfo) bool {
+	if a.Namespace != b.Namespace {
+		return a.Namespace < b.Namespace
+	}
+	if a.ServiceName != b.ServiceName {
+		return a.ServiceName < b.ServiceName
+	}
+	// slices of the same service
+	return a.Name < b.Name
 }
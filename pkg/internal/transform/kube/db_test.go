@@ -0,0 +1,2430 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	fakek8sclientset "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/grafana/beyla/pkg/internal/helpers/container"
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+	"github.com/grafana/beyla/pkg/internal/kube"
+)
+
+func TestPodInfoForIP_DualStack(t *testing.T) {
+	db := CreateDatabase(nil)
+	pod := &kube.PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "dual-stack"},
+		IPs:        []string{"10.244.0.5", "fd00:10:244:0:0:0:0:5"},
+	}
+	db.UpdateNewPodsByIPIndex(pod)
+
+	for _, ip := range []string{
+		"10.244.0.5", "::ffff:10.244.0.5", "::FFFF:AF4:5",
+		"fd00:10:244::5", "FD00:10:244:0::5", "fd00:10:244::5%eth0",
+	} {
+		info := db.PodInfoForIP(ip)
+		require.NotNilf(t, info, "ip: %s", ip)
+		assert.Equal(t, "dual-stack", info.Name)
+	}
+
+	db.UpdateDeletedPodsByIPIndex(pod)
+	assert.Nil(t, db.PodInfoForIP("10.244.0.5"))
+	assert.Nil(t, db.PodInfoForIP("fd00:10:244::5"))
+}
+
+func TestPodInfoForIP_OutOfOrderEvents(t *testing.T) {
+	// a pod that is deleted during a rollout, and a new pod that reuses its IP
+	deadPod := &kube.PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "web-old", UID: "uid-old",
+		CreationTimestamp: metav1.NewTime(time.Date(2024, 5, 6, 7, 0, 0, 0, time.UTC))},
+		IPs: []string{"10.244.0.5"}}
+	livePod := &kube.PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "web-new", UID: "uid-new",
+		CreationTimestamp: metav1.NewTime(time.Date(2024, 5, 6, 7, 5, 0, 0, time.UTC))},
+		IPs: []string{"10.244.0.5"}}
+	updatedDeadPod := *deadPod
+	updatedDeadPod.Labels = map[string]string{"terminating": "true"}
+
+	type event func(db *Database)
+	add := func(pod *kube.PodInfo) event {
+		return func(db *Database) { db.UpdateNewPodsByIPIndex(pod) }
+	}
+	del := func(pod *kube.PodInfo) event {
+		return func(db *Database) { db.UpdateDeletedPodsByIPIndex(pod) }
+	}
+	update := func(oldPod, newPod *kube.PodInfo) event {
+		return func(db *Database) { db.UpdatePodsByIPIndex(oldPod, newPod) }
+	}
+	for _, tc := range []struct {
+		name   string
+		events []event
+	}{
+		{name: "in order", events: []event{add(deadPod), del(deadPod), add(livePod)}},
+		{name: "deletion after addition", events: []event{add(deadPod), add(livePod), del(deadPod)}},
+		{name: "dead pod addition after addition",
+			events: []event{add(livePod), add(deadPod), del(deadPod)}},
+		{name: "dead pod update after addition",
+			events: []event{add(deadPod), add(livePod), update(deadPod, &updatedDeadPod), del(&updatedDeadPod)}},
+		{name: "dead pod update without deletion",
+			events: []event{add(deadPod), add(livePod), update(deadPod, &updatedDeadPod)}},
+		{name: "live pod update", events: []event{add(deadPod), add(livePod), update(livePod, livePod)}},
+	} {
+		for _, grace := range []time.Duration{0, time.Minute} {
+			t.Run(fmt.Sprintf("%s (grace period %v)", tc.name, grace), func(t *testing.T) {
+				db := CreateDatabase(nil)
+				db.deletedPodsGrace = grace
+				// WHEN the informer events are received in any order
+				for _, ev := range tc.events {
+					ev(&db)
+				}
+				// THEN the IP is always mapped to the live pod, even if the dead pod is in its grace period
+				pod := db.PodInfoForIP("10.244.0.5")
+				require.NotNil(t, pod)
+				assert.Equal(t, "web-new", pod.Name)
+			})
+		}
+	}
+
+	// AND the IP is removed when the live pod is deleted
+	db := CreateDatabase(nil)
+	db.UpdateNewPodsByIPIndex(deadPod)
+	db.UpdateNewPodsByIPIndex(livePod)
+	db.UpdateDeletedPodsByIPIndex(livePod)
+	assert.Nil(t, db.PodInfoForIP("10.244.0.5"))
+}
+
+func TestUpdatePodsByIPIndex(t *testing.T) {
+	db := CreateDatabase(nil)
+	pod := &kube.PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "web", UID: "uid-web"},
+		IPs: []string{"10.244.0.5", "fd00::5"}}
+	db.UpdateNewPodsByIPIndex(pod)
+
+	// WHEN the pod is updated without changing any of its stored fields (e.g. a readiness change)
+	unchanged := *pod
+	db.UpdatePodsByIPIndex(pod, &unchanged)
+	// THEN the indexed entries are kept
+	assert.Same(t, pod, db.PodInfoForIP("10.244.0.5"))
+
+	// WHEN any other field of the pod changes
+	relabeled := unchanged
+	relabeled.Labels = map[string]string{"version": "2"}
+	db.UpdatePodsByIPIndex(&unchanged, &relabeled)
+	// THEN its IPs point to the updated pod
+	assert.Same(t, &relabeled, db.PodInfoForIP("10.244.0.5"))
+	assert.Same(t, &relabeled, db.PodInfoForIP("fd00::5"))
+
+	// WHEN the CNI reassigns one of the IPs of the pod
+	reassigned := relabeled
+	reassigned.IPs = []string{"10.244.0.9", "fd00::5"}
+	db.UpdatePodsByIPIndex(&relabeled, &reassigned)
+	// THEN the removed IP is forgotten, and the kept and new IPs point to the updated pod
+	assert.Nil(t, db.PodInfoForIP("10.244.0.5"))
+	assert.Same(t, &reassigned, db.PodInfoForIP("10.244.0.9"))
+	assert.Same(t, &reassigned, db.PodInfoForIP("fd00::5"))
+	assert.EqualValues(t, 2, db.podIPsLen.Load())
+
+	// AND WHEN an IP of the pod is claimed by a newer pod, and the old pod is updated
+	newer := &kube.PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "other", UID: "uid-other",
+		CreationTimestamp: metav1.NewTime(time.Date(2024, 5, 6, 7, 0, 0, 0, time.UTC))},
+		IPs: []string{"10.244.0.9"}}
+	db.UpdateNewPodsByIPIndex(newer)
+	terminating := reassigned
+	terminating.Labels = map[string]string{"terminating": "true"}
+	db.UpdatePodsByIPIndex(&reassigned, &terminating)
+	// THEN the IP keeps pointing to the newer pod
+	assert.Same(t, newer, db.PodInfoForIP("10.244.0.9"))
+	assert.Same(t, &terminating, db.PodInfoForIP("fd00::5"))
+}
+
+func TestUpdatePodsByIPIndex_HostPorts(t *testing.T) {
+	db := CreateDatabase(nil)
+	pod := &kube.PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "exporter", UID: "uid-exp"},
+		HostIPs: []string{"192.168.1.10"}, HostPorts: []uint16{9100}}
+	db.UpdateNewPodsByIPIndex(pod)
+
+	// WHEN a field of the hostPort pod changes
+	updated := *pod
+	updated.Labels = map[string]string{"version": "2"}
+	db.UpdatePodsByIPIndex(pod, &updated)
+	// THEN its node IP and port point to the updated pod
+	assert.Same(t, &updated, db.PodInfoForIPPort("192.168.1.10", 9100))
+
+	// WHEN its host port changes
+	moved := updated
+	moved.HostPorts = []uint16{9101}
+	db.UpdatePodsByIPIndex(&updated, &moved)
+	// THEN only the new port is indexed
+	assert.Nil(t, db.PodInfoForIPPort("192.168.1.10", 9100))
+	assert.Same(t, &moved, db.PodInfoForIPPort("192.168.1.10", 9101))
+	assert.EqualValues(t, 1, db.podIPPortsLen.Load())
+}
+
+type indexMetrics struct {
+	imetrics.NoopReporter
+	sizes     map[string]int
+	hits      map[string]int
+	misses    map[string]int
+	evictions map[string]int
+}
+
+func (m *indexMetrics) KubeDatabaseIndexSize(index string, size int) {
+	m.sizes[index] = size
+}
+
+func (m *indexMetrics) KubeDatabaseLookup(index string, hit bool) {
+	if hit {
+		m.hits[index]++
+	} else {
+		m.misses[index]++
+	}
+}
+
+func (m *indexMetrics) KubeDatabaseEvictions(index string, entries int) {
+	m.evictions[index] += entries
+}
+
+func TestPodInfoForIP_Metrics(t *testing.T) {
+	metrics := &indexMetrics{sizes: map[string]int{}, hits: map[string]int{}, misses: map[string]int{}}
+	db := CreateDatabase(nil)
+	db.metrics = metrics
+
+	pod := &kube.PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "dual-stack"},
+		IPs:        []string{"10.244.0.5", "fd00:10:244::5"},
+	}
+	db.UpdateNewPodsByIPIndex(pod)
+	assert.Equal(t, 2, metrics.sizes[indexPodsByIP])
+
+	assert.NotNil(t, db.PodInfoForIP("10.244.0.5"))
+	assert.NotNil(t, db.PodInfoForIP("fd00:10:244::5"))
+	assert.Nil(t, db.PodInfoForIP("10.244.0.6"))
+	assert.Equal(t, 2, metrics.hits[indexPodsByIP])
+	assert.Equal(t, 1, metrics.misses[indexPodsByIP])
+
+	db.UpdateDeletedPodsByIPIndex(pod)
+	assert.Equal(t, 0, metrics.sizes[indexPodsByIP])
+}
+
+func TestOwnerPodInfo_Metrics(t *testing.T) {
+	// GIVEN a database connected to the Kubernetes informers, which knows the pod of a container
+	client := fakek8sclientset.NewSimpleClientset()
+	informer := kube.Metadata{}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	db := CreateDatabase(&informer)
+	metrics := &indexMetrics{
+		sizes: map[string]int{}, hits: map[string]int{}, misses: map[string]int{}, evictions: map[string]int{},
+	}
+	db.metrics = metrics
+	_, err := client.CoreV1().Pods("the-ns").Create(context.Background(),
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "the-pod", Namespace: "the-ns"},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{ContainerID: "containerd://container-1"}}}},
+		metav1.CreateOptions{})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, ok := informer.GetContainerPod("container-1")
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// WHEN a process running in the container is added
+	fakeProcesses(t, map[uint32]fakeProcess{123: {namespace: 10, start: 1000, containerID: "container-1"}})
+	db.AddProcess(123)
+	// THEN the size of the container indexes is reported
+	assert.Equal(t, 1, metrics.sizes[indexContainerIDs])
+	assert.Equal(t, 1, metrics.sizes[indexPIDNamespaces])
+
+	// WHEN the pod of an unknown namespace is looked up
+	_, ok := db.OwnerPodInfo(99, 0)
+	require.False(t, ok)
+	// THEN a miss is reported
+	assert.Equal(t, 1, metrics.misses[indexPodsByPIDNS])
+	assert.Zero(t, metrics.hits[indexPodsByPIDNS])
+
+	// WHEN the pod of the process namespace is looked up twice
+	_, ok = db.OwnerPodInfo(10, 0)
+	require.True(t, ok)
+	_, ok = db.OwnerPodInfo(10, 0)
+	require.True(t, ok)
+	// THEN the first lookup is a miss that caches the pod, and the second is a hit
+	assert.Equal(t, 2, metrics.misses[indexPodsByPIDNS])
+	assert.Equal(t, 1, metrics.hits[indexPodsByPIDNS])
+	assert.Equal(t, 1, metrics.sizes[indexPodsByPIDNS])
+
+	// WHEN the container is deleted
+	db.OnDeletion([]string{"container-1"})
+	// THEN the indexes are reported as empty
+	assert.Zero(t, metrics.sizes[indexContainerIDs])
+	assert.Zero(t, metrics.sizes[indexPIDNamespaces])
+	assert.Zero(t, metrics.sizes[indexPodsByPIDNS])
+}
+
+func TestPodInfoForIPPort_HostNetwork(t *testing.T) {
+	db := CreateDatabase(nil)
+	hostNetworkPod := func(name, startTime string, ports ...uint16) *kube.PodInfo {
+		return &kube.PodInfo{
+			ObjectMeta:   metav1.ObjectMeta{Name: name, UID: types.UID(name)},
+			StartTimeStr: startTime,
+			HostIPs:      []string{"192.168.1.10"},
+			HostPorts:    ports,
+		}
+	}
+	// GIVEN several hostNetwork pods in the same node, and a regular pod
+	exporter := hostNetworkPod("node-exporter", "2024-01-01T00:00:00Z", 9100)
+	proxy := hostNetworkPod("kube-proxy", "2024-01-01T00:00:00Z", 10249, 10256)
+	noPorts := hostNetworkPod("cni-agent", "2024-01-01T00:00:00Z")
+	regular := &kube.PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "regular", UID: "regular"}, IPs: []string{"10.244.0.5"}}
+	for _, pod := range []*kube.PodInfo{exporter, proxy, noPorts, regular} {
+		db.UpdateNewPodsByIPIndex(pod)
+	}
+
+	// THEN each hostNetwork pod is found by the node IP and its own ports
+	assert.Equal(t, "node-exporter", db.PodInfoForIPPort("192.168.1.10", 9100).Name)
+	assert.Equal(t, "kube-proxy", db.PodInfoForIPPort("::ffff:192.168.1.10", 10256).Name)
+	// AND the node IP alone is not attributed to any of them
+	assert.Nil(t, db.PodInfoForIPPort("192.168.1.10", 8080))
+	assert.Nil(t, db.PodInfoForIP("192.168.1.10"))
+	// AND the lookup falls back to the pod IP for the regular pods
+	assert.Equal(t, "regular", db.PodInfoForIPPort("10.244.0.5", 8080).Name)
+
+	// WHEN a newer pod claims the same port
+	newer := hostNetworkPod("user-workload", "2024-02-01T00:00:00Z", 9100)
+	db.UpdateNewPodsByIPIndex(newer)
+	// THEN the newest pod is kept, even if the older pod is updated later
+	db.UpdateDeletedPodsByIPIndex(exporter)
+	db.UpdateNewPodsByIPIndex(exporter)
+	assert.Equal(t, "user-workload", db.PodInfoForIPPort("192.168.1.10", 9100).Name)
+
+	// WHEN the pod that lost the port is deleted
+	db.UpdateDeletedPodsByIPIndex(exporter)
+	// THEN the port is still attributed to the newest pod
+	assert.Equal(t, "user-workload", db.PodInfoForIPPort("192.168.1.10", 9100).Name)
+
+	// WHEN the hostNetwork pods are deleted
+	db.UpdateDeletedPodsByIPIndex(newer)
+	db.UpdateDeletedPodsByIPIndex(proxy)
+	// THEN they are not found anymore
+	assert.Nil(t, db.PodInfoForIPPort("192.168.1.10", 9100))
+	assert.Nil(t, db.PodInfoForIPPort("192.168.1.10", 10249))
+	assert.Zero(t, db.podIPPortsLen.Load())
+}
+
+func slice(uid, namespace, service string, ports []uint16, ips ...string) *kube.EndpointSliceInfo {
+	return &kube.EndpointSliceInfo{
+		ObjectMeta:  metav1.ObjectMeta{Name: service + "-" + uid, Namespace: namespace, UID: types.UID(uid)},
+		ServiceName: service,
+		IPs:         ips,
+		Ports:       ports,
+	}
+}
+
+func TestServiceForIP(t *testing.T) {
+	db := CreateDatabase(nil)
+	// GIVEN a pod that backs two Services in different ports
+	db.UpdateNewServicesByIPIndex(slice("a", "shop", "web", []uint16{8080}, "10.244.0.5", "10.244.0.6"))
+	db.UpdateNewServicesByIPIndex(slice("b", "shop", "admin", []uint16{9090}, "10.244.0.5"))
+	// AND a headless Service that does not restrict its ports
+	db.UpdateNewServicesByIPIndex(slice("c", "shop", "all", nil, "10.244.0.5"))
+	// AND an EndpointSlice that is not owned by a Service
+	db.UpdateNewServicesByIPIndex(slice("d", "shop", "", []uint16{8080}, "10.244.0.7"))
+
+	// THEN the Service that exposes the destination port is preferred
+	assert.Equal(t, "web", db.ServiceForIP("10.244.0.5", 8080).ServiceName)
+	assert.Equal(t, "admin", db.ServiceForIP("10.244.0.5", 9090).ServiceName)
+	assert.Equal(t, "web", db.ServiceForIP("10.244.0.6", 8080).ServiceName)
+	// AND the Services that don't restrict their ports match any other port
+	assert.Equal(t, "all", db.ServiceForIP("10.244.0.5", 1234).ServiceName)
+	assert.Nil(t, db.ServiceForIP("10.244.0.6", 1234))
+	// AND, without port, the first Service in alphabetical order is always returned
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, "admin", db.ServiceForIP("10.244.0.5", 0).ServiceName)
+	}
+	assert.Nil(t, db.ServiceForIP("10.244.0.7", 8080))
+
+	// WHEN a rollout moves the endpoint to a new EndpointSlice of the same Service
+	db.UpdateNewServicesByIPIndex(slice("e", "shop", "web", []uint16{8080}, "10.244.0.6", "10.244.0.8"))
+	db.UpdateDeletedServicesByIPIndex(slice("a", "shop", "web", []uint16{8080}, "10.244.0.5", "10.244.0.6"))
+	// THEN the IPs of the remaining slices are still attributed to their Service
+	assert.Equal(t, "web", db.ServiceForIP("10.244.0.6", 8080).ServiceName)
+	assert.Equal(t, "web", db.ServiceForIP("10.244.0.8", 8080).ServiceName)
+	assert.Equal(t, "all", db.ServiceForIP("10.244.0.5", 8080).ServiceName)
+
+	// AND WHEN all the slices of an IP are removed
+	db.UpdateDeletedServicesByIPIndex(slice("b", "shop", "admin", []uint16{9090}, "10.244.0.5"))
+	db.UpdateDeletedServicesByIPIndex(slice("c", "shop", "all", nil, "10.244.0.5"))
+	// THEN the IP is removed from the index
+	assert.Nil(t, db.ServiceForIP("10.244.0.5", 0))
+	assert.NotContains(t, db.shard("10.244.0.5").servicesByIP, "10.244.0.5")
+}
+
+func TestServiceForIP_Informer(t *testing.T) {
+	// GIVEN a database connected to the Kubernetes informers, which watch the EndpointSlices
+	client := fakek8sclientset.NewSimpleClientset()
+	informer := kube.Metadata{WatchEndpointSlices: true}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	db, err := StartDatabase(context.TODO(), &informer, imetrics.NoopReporter{}, DatabaseConfig{})
+	require.NoError(t, err)
+
+	// WHEN an EndpointSlice of a Service is created
+	port := int32(8080)
+	_, err = client.DiscoveryV1().EndpointSlices("shop").Create(context.Background(), &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-abcde", Namespace: "shop", UID: "slice-1",
+			Labels: map[string]string{discoveryv1.LabelServiceName: "web"}},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints:   []discoveryv1.Endpoint{{Addresses: []string{"10.244.0.5"}}},
+		Ports:       []discoveryv1.EndpointPort{{Port: &port}},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	// THEN its endpoint IPs are attributed to the Service
+	require.Eventually(t, func() bool {
+		es := db.ServiceForIP("10.244.0.5", 8080)
+		return es != nil && es.ServiceName == "web" && es.Namespace == "shop"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// AND WHEN the EndpointSlice is deleted
+	require.NoError(t, client.DiscoveryV1().EndpointSlices("shop").
+		Delete(context.Background(), "web-abcde", metav1.DeleteOptions{}))
+	// THEN the IPs are not attributed anymore
+	require.Eventually(t, func() bool {
+		return db.ServiceForIP("10.244.0.5", 8080) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+type eventMetrics struct {
+	imetrics.NoopReporter
+	mt     sync.Mutex
+	events map[string]int
+}
+
+func (m *eventMetrics) KubeInformerEvents(resource, event string) imetrics.EventRecorder {
+	return eventRecorder{metrics: m, key: resource + "/" + event}
+}
+
+func (m *eventMetrics) count(key string) int {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	return m.events[key]
+}
+
+type eventRecorder struct {
+	metrics *eventMetrics
+	key     string
+}
+
+func (r eventRecorder) Record(_ time.Duration) {
+	r.metrics.mt.Lock()
+	defer r.metrics.mt.Unlock()
+	r.metrics.events[r.key]++
+}
+
+func TestDatabase_InformerEventMetrics(t *testing.T) {
+	// GIVEN a database connected to the Kubernetes informers, which watch the Services
+	client := fakek8sclientset.NewSimpleClientset()
+	informer := kube.Metadata{WatchServices: true}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	metrics := &eventMetrics{events: map[string]int{}}
+	db, err := StartDatabase(context.TODO(), &informer, metrics, DatabaseConfig{})
+	require.NoError(t, err)
+	defer db.Stop()
+
+	// WHEN a pod is created, updated and deleted
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "shop", UID: "pod-1"},
+		Status:     corev1.PodStatus{PodIP: "10.244.0.5", PodIPs: []corev1.PodIP{{IP: "10.244.0.5"}}},
+	}
+	_, err = client.CoreV1().Pods("shop").Create(context.Background(), pod, metav1.CreateOptions{})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return metrics.count("pod/add") > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	pod.Labels = map[string]string{"app": "web"}
+	_, err = client.CoreV1().Pods("shop").Update(context.Background(), pod, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	require.NoError(t, client.CoreV1().Pods("shop").Delete(context.Background(), "web-0", metav1.DeleteOptions{}))
+	// AND a service is created
+	_, err = client.CoreV1().Services("shop").Create(context.Background(), &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop", UID: "svc-1"},
+		Spec:       corev1.ServiceSpec{ClusterIP: "10.96.0.10"},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	// THEN each event is accounted by resource and event type
+	require.Eventually(t, func() bool {
+		return metrics.count("pod/update") == 1 && metrics.count("pod/delete") == 1 &&
+			metrics.count("service/add") > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// AND WHEN a container is deleted
+	deletions := metrics.count("container/delete")
+	db.OnDeletion([]string{"container-1"})
+	// THEN the container deletion is accounted
+	assert.Equal(t, deletions+1, metrics.count("container/delete"))
+}
+
+func TestInstrumentedHandler_NoAllocs(t *testing.T) {
+	handler := instrumentedHandler(imetrics.NoopReporter{}, resourcePod, cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(_ interface{}) {},
+		UpdateFunc: func(_, _ interface{}) {},
+		DeleteFunc: func(_ interface{}) {},
+	})
+	pod := &kube.PodInfo{}
+	assert.Zero(t, testing.AllocsPerRun(100, func() {
+		handler.OnAdd(pod, false)
+		handler.OnUpdate(pod, pod)
+		handler.OnDelete(pod)
+	}))
+}
+
+// fakeDNS answers the lookups of the ExternalName Services from a map that can be modified by the tests
+type fakeDNS struct {
+	mut     sync.Mutex
+	answers map[string][]string
+	err     error
+}
+
+func (f *fakeDNS) set(host string, ips ...string) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.answers[host] = ips
+}
+
+func (f *fakeDNS) fail(err error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.err = err
+}
+
+func (f *fakeDNS) lookup(_ context.Context, host string) ([]string, error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	ips, ok := f.answers[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return ips, nil
+}
+
+func TestServiceForIP_ExternalName(t *testing.T) {
+	dns := &fakeDNS{answers: map[string][]string{"api.vendor.com": {"203.0.113.10", "203.0.113.11"}}}
+	lookupExternalName = dns.lookup
+	t.Cleanup(func() { lookupExternalName = net.DefaultResolver.LookupHost })
+
+	// GIVEN a database that watches the Services and resolves the ExternalName Services
+	client := fakek8sclientset.NewSimpleClientset()
+	informer := kube.Metadata{WatchServices: true}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	db, err := StartDatabase(context.TODO(), &informer, imetrics.NoopReporter{},
+		DatabaseConfig{ExternalNamesRefresh: 10 * time.Millisecond})
+	require.NoError(t, err)
+	t.Cleanup(db.Stop)
+
+	// WHEN an ExternalName Service is created, as well as a Service of another type
+	_, err = client.CoreV1().Services("shop").Create(context.Background(), &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "payments-gw", Namespace: "shop", UID: "svc-1"},
+		Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeExternalName, ExternalName: "api.vendor.com"},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = client.CoreV1().Services("shop").Create(context.Background(), &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop", UID: "svc-2"},
+		Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP, ClusterIP: "10.96.0.20"},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	// THEN the IPs of its hostname are attributed to the Service, for any port
+	require.Eventually(t, func() bool {
+		for _, ip := range []string{"203.0.113.10", "203.0.113.11"} {
+			es := db.ServiceForIP(ip, 443)
+			if es == nil || es.ServiceName != "payments-gw" || es.Namespace != "shop" {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Nil(t, db.ServiceForIP("10.96.0.20", 80))
+
+	// AND WHEN the DNS answer changes
+	dns.set("api.vendor.com", "203.0.113.11", "203.0.113.12")
+	// THEN the services index follows it
+	require.Eventually(t, func() bool {
+		return db.ServiceForIP("203.0.113.10", 443) == nil && db.ServiceForIP("203.0.113.12", 443) != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// AND WHEN the DNS lookups temporarily fail
+	dns.fail(errors.New("i/o timeout"))
+	time.Sleep(50 * time.Millisecond)
+	// THEN the IPs from the last resolution are kept
+	assert.NotNil(t, db.ServiceForIP("203.0.113.11", 443))
+	assert.NotNil(t, db.ServiceForIP("203.0.113.12", 443))
+	dns.fail(nil)
+
+	// AND WHEN the Service changes its hostname to another that is not found
+	_, err = client.CoreV1().Services("shop").Update(context.Background(), &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "payments-gw", Namespace: "shop", UID: "svc-1"},
+		Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeExternalName, ExternalName: "api.other-vendor.com"},
+	}, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	// THEN the IPs of the former hostname are not attributed anymore
+	require.Eventually(t, func() bool {
+		return db.ServiceForIP("203.0.113.11", 443) == nil && db.ServiceForIP("203.0.113.12", 443) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// AND WHEN the new hostname is resolved, and then the Service is deleted
+	dns.set("api.other-vendor.com", "198.51.100.7")
+	require.Eventually(t, func() bool {
+		return db.ServiceForIP("198.51.100.7", 443) != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, client.CoreV1().Services("shop").
+		Delete(context.Background(), "payments-gw", metav1.DeleteOptions{}))
+	// THEN its IPs are not attributed anymore
+	require.Eventually(t, func() bool {
+		return db.ServiceForIP("198.51.100.7", 443) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestServiceForIP_Headless(t *testing.T) {
+	db := CreateDatabase(nil)
+	// GIVEN a StatefulSet pod that is exposed by a headless Service
+	headless := slice("a", "db", "postgres-headless", []uint16{5432}, "10.244.0.5")
+	headless.Headless = true
+	db.UpdateNewServicesByIPIndex(headless)
+	// THEN its IP is attributed to the headless Service
+	assert.Equal(t, "postgres-headless", db.ServiceForIP("10.244.0.5", 5432).ServiceName)
+
+	// WHEN the pod is also exposed by a normal Service, even if it does not restrict its ports
+	db.UpdateNewServicesByIPIndex(slice("b", "db", "postgres", nil, "10.244.0.5"))
+	// THEN the normal Service is preferred
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, "postgres", db.ServiceForIP("10.244.0.5", 5432).ServiceName)
+		assert.Equal(t, "postgres", db.ServiceForIP("10.244.0.5", 0).ServiceName)
+	}
+
+	// AND WHEN the normal Service is removed
+	db.UpdateDeletedServicesByIPIndex(slice("b", "db", "postgres", nil, "10.244.0.5"))
+	// THEN the IP is attributed again to the headless Service
+	assert.Equal(t, "postgres-headless", db.ServiceForIP("10.244.0.5", 5432).ServiceName)
+}
+
+func TestServiceForIP_HeadlessInformer(t *testing.T) {
+	// GIVEN a database connected to the Kubernetes informers
+	client := fakek8sclientset.NewSimpleClientset()
+	informer := kube.Metadata{WatchEndpointSlices: true}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	db, err := StartDatabase(context.TODO(), &informer, imetrics.NoopReporter{}, DatabaseConfig{})
+	require.NoError(t, err)
+
+	// AND a StatefulSet pod that is created before its headless Service
+	_, err = client.CoreV1().Pods("db").Create(context.Background(), &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "postgres-0", Namespace: "db", UID: "pod-1",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "StatefulSet", Name: "postgres"}}},
+		Status: corev1.PodStatus{PodIP: "10.244.0.5", PodIPs: []corev1.PodIP{{IP: "10.244.0.5"}}},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return db.PodInfoForIP("10.244.0.5") != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Nil(t, db.ServiceForIP("10.244.0.5", 5432))
+
+	// WHEN the EndpointSlice of the headless Service is created
+	port := int32(5432)
+	_, err = client.DiscoveryV1().EndpointSlices("db").Create(context.Background(), &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{Name: "postgres-abcde", Namespace: "db", UID: "slice-1",
+			Labels: map[string]string{
+				discoveryv1.LabelServiceName: "postgres-headless",
+				corev1.IsHeadlessService:     "",
+			}},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints:   []discoveryv1.Endpoint{{Addresses: []string{"10.244.0.5"}}},
+		Ports:       []discoveryv1.EndpointPort{{Port: &port}},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	// THEN the already known pod IP is attributed to the headless Service
+	require.Eventually(t, func() bool {
+		es := db.ServiceForIP("10.244.0.5", 5432)
+		return es != nil && es.ServiceName == "postgres-headless" && es.Headless
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDatabase_NamespaceLabels(t *testing.T) {
+	// GIVEN a database that watches the labels of the namespaces
+	client := fakek8sclientset.NewSimpleClientset()
+	informer := kube.Metadata{WatchNamespaceLabels: true}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	db, err := StartDatabase(context.TODO(), &informer, imetrics.NoopReporter{}, DatabaseConfig{})
+	require.NoError(t, err)
+
+	// THEN the labels of unknown namespaces are not found
+	_, ok := db.NamespaceLabels("shop")
+	assert.False(t, ok)
+
+	// WHEN a namespace is created
+	_, err = client.CoreV1().Namespaces().Create(context.Background(), &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "shop", Labels: map[string]string{"team": "checkout"}},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	// THEN its labels are found
+	require.Eventually(t, func() bool {
+		labels, ok := db.NamespaceLabels("shop")
+		return ok && labels["team"] == "checkout"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// AND WHEN its labels are updated
+	_, err = client.CoreV1().Namespaces().Update(context.Background(), &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "shop", Labels: map[string]string{"team": "payments"}},
+	}, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	// THEN the updated labels are found
+	require.Eventually(t, func() bool {
+		labels, ok := db.NamespaceLabels("shop")
+		return ok && labels["team"] == "payments"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDatabase_NodeInfo(t *testing.T) {
+	// GIVEN a database that watches the Nodes, and is restricted to a namespace
+	client := fakek8sclientset.NewSimpleClientset()
+	informer := kube.Metadata{WatchNodes: true, Namespaces: []string{"shop"}}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	db, err := StartDatabase(context.TODO(), &informer, imetrics.NoopReporter{}, DatabaseConfig{})
+	require.NoError(t, err)
+
+	_, ok := db.NodeInfo("node-1")
+	assert.False(t, ok)
+
+	// WHEN a Node is created
+	_, err = client.CoreV1().Nodes().Create(context.Background(), &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{
+			corev1.LabelTopologyZone: "eu-west-1a", corev1.LabelTopologyRegion: "eu-west-1",
+		}},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	// THEN its topology is found, regardless of the watched namespaces
+	require.Eventually(t, func() bool {
+		node, ok := db.NodeInfo("node-1")
+		return ok && node.Zone == "eu-west-1a" && node.Region == "eu-west-1"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDatabase_WatchedNamespaces(t *testing.T) {
+	// GIVEN pods in three namespaces
+	client := fakek8sclientset.NewSimpleClientset()
+	for i, ns := range []string{"shop", "payments", "other"} {
+		_, err := client.CoreV1().Pods(ns).Create(context.Background(), &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod-" + ns, Namespace: ns, UID: types.UID("uid-" + ns)},
+			Status: corev1.PodStatus{
+				PodIP:             fmt.Sprintf("10.244.0.%d", i+1),
+				PodIPs:            []corev1.PodIP{{IP: fmt.Sprintf("10.244.0.%d", i+1)}},
+				ContainerStatuses: []corev1.ContainerStatus{{ContainerID: "containerd://container-" + ns}},
+			},
+		}, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	// WHEN the informers only watch two of the namespaces
+	informer := kube.Metadata{Namespaces: []string{"shop", " payments", "shop"}}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	db, err := StartDatabase(context.TODO(), &informer, imetrics.NoopReporter{}, DatabaseConfig{})
+	require.NoError(t, err)
+
+	// THEN the Database aggregates the pods of all the watched namespaces
+	require.Eventually(t, func() bool {
+		return db.PodInfoForIP("10.244.0.1") != nil && db.PodInfoForIP("10.244.0.2") != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "pod-shop", db.PodInfoForIP("10.244.0.1").Name)
+	assert.Equal(t, "pod-payments", db.PodInfoForIP("10.244.0.2").Name)
+	pod, ok := informer.GetContainerPod("container-payments")
+	require.True(t, ok)
+	assert.Equal(t, "pod-payments", pod.Name)
+	// AND it also receives the events of the pods created later
+	_, err = client.CoreV1().Pods("payments").Create(context.Background(), &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "new-pod", Namespace: "payments", UID: "uid-new"},
+		Status:     corev1.PodStatus{PodIP: "10.244.0.4", PodIPs: []corev1.PodIP{{IP: "10.244.0.4"}}},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return db.PodInfoForIP("10.244.0.4") != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// AND the pods of the other namespaces are not found
+	assert.Nil(t, db.PodInfoForIP("10.244.0.3"))
+	_, ok = informer.GetContainerPod("container-other")
+	assert.False(t, ok)
+	assert.NoError(t, informer.Synced(context.TODO()))
+}
+
+func TestDatabase_DecoratedNamespaces(t *testing.T) {
+	// GIVEN pods and Services in a decorated namespace and in namespaces that are excluded from the decoration
+	client := fakek8sclientset.NewSimpleClientset()
+	port := int32(8080)
+	for i, ns := range []string{"shop", "kube-system", "operator-certs"} {
+		_, err := client.CoreV1().Pods(ns).Create(context.Background(), &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod-" + ns, Namespace: ns, UID: types.UID("uid-" + ns)},
+			Status: corev1.PodStatus{
+				PodIPs:            []corev1.PodIP{{IP: fmt.Sprintf("10.244.0.%d", i+1)}},
+				ContainerStatuses: []corev1.ContainerStatus{{ContainerID: "containerd://container-" + ns}},
+			},
+		}, metav1.CreateOptions{})
+		require.NoError(t, err)
+		_, err = client.DiscoveryV1().EndpointSlices(ns).Create(context.Background(), &discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{Name: "svc-abcde", Namespace: ns, UID: types.UID("slice-" + ns),
+				Labels: map[string]string{discoveryv1.LabelServiceName: "svc"}},
+			AddressType: discoveryv1.AddressTypeIPv4,
+			Endpoints:   []discoveryv1.Endpoint{{Addresses: []string{fmt.Sprintf("10.244.0.%d", i+1)}}},
+			Ports:       []discoveryv1.EndpointPort{{Port: &port}},
+		}, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+	filter, err := kube.NewNamespaceFilter(nil, []string{"kube-system", "operator-*"})
+	require.NoError(t, err)
+	informer := kube.Metadata{WatchEndpointSlices: true, DecoratedNamespaces: filter}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	fakeProcesses(t, map[uint32]fakeProcess{
+		1: {namespace: 10, start: 1000, containerID: "container-shop"},
+		2: {namespace: 20, start: 1000, containerID: "container-kube-system"},
+	})
+
+	// WHEN the excluded namespaces are configured to be treated as misses
+	db, err := StartDatabase(context.TODO(), &informer, imetrics.NoopReporter{}, DatabaseConfig{})
+	require.NoError(t, err)
+	db.AddProcess(1)
+	db.AddProcess(2)
+	require.Eventually(t, func() bool {
+		return db.PodInfoForIP("10.244.0.1") != nil && db.ServiceForIP("10.244.0.1", 8080) != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// THEN the pods and Services of the decorated namespace are found
+	pod, ok := db.OwnerPodInfo(10, 1)
+	require.True(t, ok)
+	assert.Equal(t, "pod-shop", pod.Name)
+	assert.False(t, db.OwnerPodExcluded(10, 1))
+	// AND the ones of the excluded namespaces are not found
+	for _, ip := range []string{"10.244.0.2", "10.244.0.3"} {
+		assert.Nil(t, db.PodInfoForIP(ip))
+		assert.Nil(t, db.PodInfoForIPPort(ip, 8080))
+		assert.Nil(t, db.ServiceForIP(ip, 8080))
+	}
+	_, ok = db.OwnerPodInfo(20, 2)
+	assert.False(t, ok)
+	_, ok = db.OwnerPodInfoForContainerID("container-kube-system")
+	assert.False(t, ok)
+	// AND they are reported as excluded, so the decoration does not wait for them
+	assert.True(t, db.OwnerPodExcluded(20, 2))
+	assert.False(t, db.OwnerPodExcluded(30, 3))
+
+	// AND WHEN the excluded namespaces are configured to be decorated only with their namespace
+	db.Stop()
+	db, err = StartDatabase(context.TODO(), &informer, imetrics.NoopReporter{}, DatabaseConfig{NamespaceOnlyExcluded: true})
+	require.NoError(t, err)
+	db.AddProcess(2)
+	require.Eventually(t, func() bool {
+		return db.PodInfoForIP("10.244.0.2") != nil && db.ServiceForIP("10.244.0.2", 8080) != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// THEN the pods and Services of the excluded namespaces only contain their namespace
+	pod = db.PodInfoForIP("10.244.0.2")
+	assert.Equal(t, &kube.PodInfo{ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system"}, Excluded: true}, pod)
+	// AND the same copy is returned for each lookup, as it is built when the pod is stored
+	assert.Same(t, pod, db.PodInfoForIPPort("10.244.0.2", 8080))
+	ownerPod, ok := db.OwnerPodInfo(20, 2)
+	require.True(t, ok)
+	assert.Same(t, pod, ownerPod)
+	es := db.ServiceForIP("10.244.0.3", 8080)
+	require.NotNil(t, es)
+	assert.Equal(t, &kube.EndpointSliceInfo{ObjectMeta: metav1.ObjectMeta{Namespace: "operator-certs"}, Excluded: true}, es)
+	// AND the decorated namespace is not affected
+	assert.Equal(t, "pod-shop", db.PodInfoForIP("10.244.0.1").Name)
+	assert.Equal(t, "svc", db.ServiceForIP("10.244.0.1", 8080).ServiceName)
+}
+
+func TestServicesForPod(t *testing.T) {
+	svc := func(uid, namespace, name string, selector map[string]string) *kube.ServiceInfo {
+		return &kube.ServiceInfo{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, UID: types.UID(uid)},
+			Selector:   selector,
+		}
+	}
+	names := func(services []*kube.ServiceInfo) []string {
+		var n []string
+		for _, s := range services {
+			n = append(n, s.Name)
+		}
+		return n
+	}
+	db := CreateDatabase(nil)
+	// GIVEN Services that select the pods by different labels
+	web := svc("1", "shop", "web", map[string]string{"app": "web"})
+	db.OnSelectorService(nil, web)
+	db.OnSelectorService(nil, svc("2", "shop", "web-canary", map[string]string{"app": "web", "track": "canary"}))
+	db.OnSelectorService(nil, svc("3", "shop", "all-canaries", map[string]string{"track": "canary"}))
+	// AND Services that don't select any pod, or select the pods of other namespaces
+	db.OnSelectorService(nil, svc("4", "shop", "manual", nil))
+	db.OnSelectorService(nil, svc("5", "other", "web", map[string]string{"app": "web"}))
+
+	// THEN a pod is matched with all the Services whose whole selector matches its labels, sorted by name
+	pod := &kube.PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "shop",
+		Labels: map[string]string{"app": "web", "track": "stable"}}}
+	assert.Equal(t, []string{"web"}, names(db.ServicesForPod(pod)))
+	// AND the changed labels of a pod are taken into account
+	canary := &kube.PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "shop",
+		Labels: map[string]string{"app": "web", "track": "canary"}}}
+	assert.Equal(t, []string{"all-canaries", "web", "web-canary"}, names(db.ServicesForPod(canary)))
+	// AND the pods without labels are not selected
+	assert.Empty(t, db.ServicesForPod(&kube.PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "bare", Namespace: "shop"}}))
+
+	// WHEN a Service changes its selector, and another one is deleted
+	db.OnSelectorService(web, svc("1", "shop", "web", map[string]string{"app": "web", "track": "stable"}))
+	db.OnSelectorService(svc("3", "shop", "all-canaries", map[string]string{"track": "canary"}), nil)
+	// THEN the Services of the pods are updated
+	assert.Equal(t, []string{"web"}, names(db.ServicesForPod(pod)))
+	assert.Equal(t, []string{"web-canary"}, names(db.ServicesForPod(canary)))
+	assert.Equal(t, 3, db.selectorServicesLen)
+}
+
+func TestServicesForPod_Informer(t *testing.T) {
+	// GIVEN a database connected to the Kubernetes informers, which watch the Services
+	informer := kube.NewFakeMetadata()
+	db, err := StartDatabase(context.TODO(), informer, imetrics.NoopReporter{}, DatabaseConfig{})
+	require.NoError(t, err)
+	defer db.Stop()
+	pod := &kube.PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "shop",
+		Labels: map[string]string{"app": "web"}}}
+
+	// WHEN a Service with a selector is created
+	informer.AddService(&kube.ServiceInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop", UID: "svc-1"},
+		Selector:   map[string]string{"app": "web"},
+	})
+	// THEN it selects the matching pods
+	services := db.ServicesForPod(pod)
+	require.Len(t, services, 1)
+	assert.Equal(t, "web", services[0].Name)
+
+	// AND WHEN it is deleted
+	informer.DeleteService("shop", "web")
+	// THEN it doesn't select them anymore
+	assert.Empty(t, db.ServicesForPod(pod))
+}
+
+func TestPodInfoForIPPort_HostPort(t *testing.T) {
+	// GIVEN a database connected to the Kubernetes informers
+	client := fakek8sclientset.NewSimpleClientset()
+	informer := kube.Metadata{}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	db, err := StartDatabase(context.TODO(), &informer, imetrics.NoopReporter{}, DatabaseConfig{})
+	require.NoError(t, err)
+
+	// WHEN a pod that maps a hostPort is created in a node
+	_, err = client.CoreV1().Pods("ingress").Create(context.Background(), &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "ingress-controller", Namespace: "ingress", UID: "uid-ingress"},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Ports: []corev1.ContainerPort{{ContainerPort: 80, HostPort: 8080}},
+		}}},
+		Status: corev1.PodStatus{
+			HostIP: "192.168.1.10",
+			PodIPs: []corev1.PodIP{{IP: "10.244.0.5"}},
+		},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	// THEN the traffic addressed to the node IP and the host port is attributed to the pod
+	require.Eventually(t, func() bool {
+		pod := db.PodInfoForIPPort("192.168.1.10", 8080)
+		return pod != nil && pod.Name == "ingress-controller"
+	}, 5*time.Second, 10*time.Millisecond)
+	// AND the pod is still found by its own IP
+	assert.Equal(t, "ingress-controller", db.PodInfoForIPPort("10.244.0.5", 80).Name)
+	// AND the other ports of the node are not attributed to the pod
+	assert.Nil(t, db.PodInfoForIPPort("192.168.1.10", 80))
+
+	// AND WHEN the pod is deleted
+	require.NoError(t, client.CoreV1().Pods("ingress").
+		Delete(context.Background(), "ingress-controller", metav1.DeleteOptions{}))
+	// THEN its hostPort entries are removed
+	require.Eventually(t, func() bool {
+		return db.PodInfoForIPPort("192.168.1.10", 8080) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestOwnerPodInfo_Concurrent(t *testing.T) {
+	// GIVEN a database connected to the Kubernetes informers
+	client := fakek8sclientset.NewSimpleClientset()
+	informer := kube.Metadata{}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	db := CreateDatabase(&informer)
+	fakeProcesses(t, map[uint32]fakeProcess{123: {namespace: 123, start: 1000, containerID: "container-123"}})
+	db.AddProcess(123)
+
+	// AND a pod that is owned by a ReplicaSet whose information has not been received yet
+	_, err := client.CoreV1().Pods("the-ns").Create(context.Background(),
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name: "the-pod", Namespace: "the-ns",
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "the-rs"}},
+		}, Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{{ContainerID: "containerd://container-123"}},
+		}}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, ok := db.OwnerPodInfo(123, 0)
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// WHEN the pod owner is concurrently looked up while the ReplicaSet information is received
+	lookups := func() {
+		var wg sync.WaitGroup
+		for w := 0; w < 8; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 200; i++ {
+					pod, ok := db.OwnerPodInfo(123, 0)
+					if assert.True(t, ok) {
+						assert.Equal(t, "the-pod", pod.Name)
+						_ = pod.Owner.String()
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	}
+	_, err = client.AppsV1().ReplicaSets("the-ns").Create(context.Background(),
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+			Name: "the-rs", Namespace: "the-ns",
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "the-deployment"}},
+		}}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	lookups()
+
+	// THEN the pod is eventually decorated with its Deployment owner
+	require.Eventually(t, func() bool {
+		pod, _ := db.OwnerPodInfo(123, 0)
+		return pod.Owner.Owner != nil && pod.Owner.Owner.Name == "the-deployment"
+	}, 5*time.Second, 10*time.Millisecond)
+	lookups()
+
+	// AND the pod stored in the informer is not modified
+	informerPod, ok := informer.GetContainerPod("container-123")
+	require.True(t, ok)
+	assert.Nil(t, informerPod.Owner.Owner)
+
+	// AND the cached pod is reused once it is complete
+	pod1, _ := db.OwnerPodInfo(123, 0)
+	pod2, _ := db.OwnerPodInfo(123, 0)
+	assert.Same(t, pod1, pod2)
+}
+
+func TestOwnerPodInfo_OwnerFetchBackoff(t *testing.T) {
+	now := time.Unix(1000, 0)
+	origTimeNow := timeNow
+	t.Cleanup(func() { timeNow = origTimeNow })
+	timeNow = func() time.Time { return now }
+
+	// GIVEN a cached pod that is owned by a ReplicaSet whose information has not been received yet
+	informer := kube.NewFakeMetadata()
+	db := CreateDatabase(informer)
+	fakeProcesses(t, map[uint32]fakeProcess{123: {namespace: 123, start: 1000, containerID: "container-123"}})
+	db.AddProcess(123)
+	informer.AddPod(&kube.PodInfo{
+		ObjectMeta:   metav1.ObjectMeta{Name: "the-pod", Namespace: "the-ns"},
+		Owner:        &kube.Owner{Type: kube.OwnerReplicaSet, Name: "the-rs"},
+		ContainerIDs: []string{"container-123"},
+	})
+	_, ok := db.OwnerPodInfo(123, 0)
+	require.True(t, ok)
+
+	// WHEN the owner is fetched again after the first backoff, without finding the ReplicaSet
+	now = now.Add(ownerFetchBackoff)
+	pod, _ := db.OwnerPodInfo(123, 0)
+	assert.Nil(t, pod.Owner.Owner)
+
+	// AND the ReplicaSet information is received afterwards
+	informer.AddReplicaSet(&kube.ReplicaSetInfo{
+		ObjectMeta:     metav1.ObjectMeta{Name: "the-rs", Namespace: "the-ns"},
+		DeploymentName: "the-deployment",
+	})
+
+	// THEN the owner is not fetched again until the doubled backoff expires
+	now = now.Add(ownerFetchBackoff)
+	pod, _ = db.OwnerPodInfo(123, 0)
+	assert.Nil(t, pod.Owner.Owner)
+	now = now.Add(ownerFetchBackoff)
+	pod, _ = db.OwnerPodInfo(123, 0)
+	require.NotNil(t, pod.Owner.Owner)
+	assert.Equal(t, "the-deployment", pod.Owner.Owner.Name)
+
+	// AND the resolved owner is cached without further fetches
+	now = now.Add(time.Hour)
+	cached, _ := db.OwnerPodInfo(123, 0)
+	assert.Same(t, pod, cached)
+}
+
+func TestOwnerPodInfo_OwnerUpdate(t *testing.T) {
+	// GIVEN a cached pod of a process
+	db := CreateDatabase(nil)
+	fakeProcesses(t, map[uint32]fakeProcess{123: {namespace: 123, start: 1000, containerID: "container-123"}})
+	db.AddProcess(123)
+	ns, ok := db.currentNamespace(123)
+	require.True(t, ok)
+	pod := &kube.PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "the-pod", Namespace: "the-ns", UID: "the-uid"},
+		Owner:      &kube.Owner{Type: kube.OwnerReplicaSet, Name: "the-rs"},
+	}
+	db.cachePod(ns, nil, pod)
+	require.Len(t, db.fetchedPodsCache, 1)
+
+	// WHEN the pod is updated without changing its owner
+	updated := *pod
+	db.OnPodUpdate(pod, &updated)
+	// THEN the cached pod is kept
+	assert.Len(t, db.fetchedPodsCache, 1)
+
+	// AND WHEN the ownerReferences of the pod change
+	updated.Owner = &kube.Owner{Type: kube.OwnerReplicaSet, Name: "other-rs"}
+	db.OnPodUpdate(pod, &updated)
+	// THEN the cached pod is forgotten, so its owner is fetched again
+	assert.Empty(t, db.fetchedPodsCache)
+	assert.Empty(t, db.podNamespaces)
+}
+
+func TestOwnerPodInfoForContainerID(t *testing.T) {
+	const (
+		registeredID   = "40c03570b6f4c30bc8d69923d37ee698f5cfcced92c7b7df1c47f6f7887378a9"
+		unregisteredID = "8a2b4f6e0c1d3e5f7a9b0c2d4e6f8a1b3c5d7e9f0a2b4c6d8e0f1a3b5c7d9e1f"
+	)
+	// GIVEN a database connected to the Kubernetes informers
+	client := fakek8sclientset.NewSimpleClientset()
+	informer := kube.Metadata{}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	db := CreateDatabase(&informer)
+
+	// AND a pod, owned by a Deployment, whose containers are known by the informer
+	_, err := client.AppsV1().ReplicaSets("the-ns").Create(context.Background(),
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+			Name: "the-rs", Namespace: "the-ns",
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "the-deployment"}},
+		}}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = client.CoreV1().Pods("the-ns").Create(context.Background(),
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name: "the-pod", Namespace: "the-ns", UID: "the-uid",
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "the-rs"}},
+		}, Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "app", ContainerID: "containerd://" + registeredID},
+				{Name: "sidecar", ContainerID: "containerd://" + unregisteredID},
+			},
+		}}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		pod, ok := db.OwnerPodInfoForContainerID(unregisteredID)
+		return ok && pod.Owner.Owner != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// WHEN a container that has never been added with AddProcess is looked up
+	// THEN its pod is found in the informer, in any of the forms of its ID, with its Deployment owner
+	for _, cid := range []string{
+		unregisteredID,
+		"containerd://" + unregisteredID,
+		strings.ToUpper(unregisteredID),
+		unregisteredID[:kube.ShortContainerIDLen],
+	} {
+		pod, ok := db.OwnerPodInfoForContainerID(cid)
+		require.Truef(t, ok, "container %s", cid)
+		assert.Equal(t, "the-pod", pod.Name)
+		assert.Equal(t, "the-deployment", pod.Owner.Owner.Name)
+	}
+	// AND the pods looked up by unregistered containers are not cached, as the cache is indexed by namespace
+	assert.Empty(t, db.fetchedPodsCache)
+
+	// AND WHEN a process of the other container is added
+	fakeProcesses(t, map[uint32]fakeProcess{123: {namespace: 10, start: 1000, containerID: registeredID}})
+	db.AddProcess(123)
+	// THEN the lookups by its container ID and by its namespace share the cached pod
+	pod, ok := db.OwnerPodInfoForContainerID("cri-o://" + registeredID[:kube.ShortContainerIDLen])
+	require.True(t, ok)
+	assert.Equal(t, "the-deployment", pod.Owner.Owner.Name)
+	require.Len(t, db.fetchedPodsCache, 1)
+	nsPod, ok := db.OwnerPodInfo(10, 0)
+	require.True(t, ok)
+	assert.Same(t, pod, nsPod)
+	pod, ok = db.OwnerPodInfoForContainerID(registeredID)
+	require.True(t, ok)
+	assert.Same(t, nsPod, pod)
+
+	// AND the unknown containers are not found
+	_, ok = db.OwnerPodInfoForContainerID("0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+	assert.False(t, ok)
+	_, ok = db.OwnerPodInfoForContainerID("0123456789ab")
+	assert.False(t, ok)
+	_, ok = db.OwnerPodInfoForContainerID("")
+	assert.False(t, ok)
+}
+
+func TestOwnerPodInfo_NestedContainers(t *testing.T) {
+	const (
+		outerID = "8afe480d66074930353da456a1344caca810fe31c1e31f6e08c95a66887235d6"
+		innerID = "40c03570b6f4c30bc8d69923d37ee698f5cfcced92c7b7df1c47f6f7887378a9"
+	)
+	// cgroup entries captured from processes running in kind and Docker in Docker environments,
+	// whose paths contain the IDs of both the outer and the inner containers
+	cgroups := map[uint32]string{
+		// kind
+		1001: "0::/docker/" + outerID + "/kubelet.slice/kubelet-kubepods.slice/kubelet-kubepods-besteffort.slice" +
+			"/kubelet-kubepods-besteffort-pod44c76ce5_f953_4bd3_bc89_12621681af49.slice/cri-containerd-" + innerID + ".scope",
+		// Docker in Docker, inside a Kubernetes runner pod
+		1002: "0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-podc55ba69a_e39f_44af_925d_c4794fd57878.slice" +
+			"/cri-containerd-" + outerID + ".scope/docker/" + innerID,
+	}
+	procs := map[uint32]fakeProcess{}
+	for pid, cgroup := range cgroups {
+		id, ok := container.IDFromCgroup([]byte(cgroup))
+		require.True(t, ok)
+		procs[pid] = fakeProcess{namespace: pid, start: 1000, containerID: id}
+	}
+	fakeProcesses(t, procs)
+
+	// GIVEN a database connected to the Kubernetes informers
+	client := fakek8sclientset.NewSimpleClientset()
+	informer := kube.Metadata{}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	db := CreateDatabase(&informer)
+
+	// AND the pod of the outer container, as well as the pod of the inner container,
+	// whose ID is reported in the runtime-prefixed form
+	for name, cid := range map[string]string{"outer-pod": "docker://" + outerID, "workload-pod": "containerd://" + innerID} {
+		_, err := client.CoreV1().Pods("the-ns").Create(context.Background(),
+			&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "the-ns"},
+				Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{ContainerID: cid}}}},
+			metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	for pid := range cgroups {
+		// WHEN a process running in a nested container is added
+		db.AddProcess(pid)
+
+		// THEN it is associated to the pod of the innermost container
+		require.Eventually(t, func() bool {
+			pod, ok := db.OwnerPodInfo(pid, 0)
+			return ok && pod.Name == "workload-pod"
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+}
+
+func TestOwnerPodInfo_CacheEviction(t *testing.T) {
+	const namespaces = 5000
+	now := time.Unix(1000, 0)
+	origTimeNow := timeNow
+	t.Cleanup(func() { timeNow = origTimeNow })
+	timeNow = func() time.Time { return now }
+
+	// GIVEN a database whose cached pods expire after 5 minutes
+	client := fakek8sclientset.NewSimpleClientset()
+	informer := kube.Metadata{}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	db := CreateDatabase(&informer)
+	db.podsCacheTTL = 5 * time.Minute
+	metrics := &indexMetrics{
+		sizes: map[string]int{}, hits: map[string]int{}, misses: map[string]int{}, evictions: map[string]int{},
+	}
+	db.metrics = metrics
+	_, err := client.CoreV1().Pods("the-ns").Create(context.Background(),
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "the-pod", Namespace: "the-ns", UID: "the-uid"},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{ContainerID: "containerd://container-1"}}}},
+		metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	// AND a pod that spawns processes in thousands of distinct PID namespaces, whose pods are cached
+	procs := map[uint32]fakeProcess{}
+	for ns := uint32(1); ns <= namespaces; ns++ {
+		procs[ns] = fakeProcess{namespace: ns, start: 1000, containerID: "container-1"}
+	}
+	fakeProcesses(t, procs)
+	require.Eventually(t, func() bool {
+		_, ok := informer.GetContainerPod("container-1")
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+	for ns := uint32(1); ns <= namespaces; ns++ {
+		db.AddProcess(ns)
+		_, ok := db.OwnerPodInfo(ns, 0)
+		require.True(t, ok)
+	}
+	require.Len(t, db.fetchedPodsCache, namespaces)
+
+	// WHEN the TTL has not expired yet
+	now = now.Add(4 * time.Minute)
+	// THEN no entry is evicted
+	assert.Zero(t, db.evictExpiredPods())
+	assert.Len(t, db.fetchedPodsCache, namespaces)
+
+	// WHEN some entries are accessed after the TTL expires, before the eviction runs
+	now = now.Add(time.Minute)
+	misses := metrics.misses[indexPodsByPIDNS]
+	for ns := uint32(1); ns <= 10; ns++ {
+		pod, ok := db.OwnerPodInfo(ns, 0)
+		require.True(t, ok)
+		assert.Equal(t, "the-pod", pod.Name)
+	}
+	// THEN they are fetched again and their expiration is renewed
+	assert.Equal(t, misses+10, metrics.misses[indexPodsByPIDNS])
+
+	// AND WHEN the expired entries are evicted
+	evicted := db.evictExpiredPods()
+
+	// THEN only the renewed entries are kept, and the evictions are reported
+	assert.Equal(t, namespaces-10, evicted)
+	assert.Equal(t, namespaces-10, metrics.evictions[indexPodsByPIDNS])
+	assert.Len(t, db.fetchedPodsCache, 10)
+	assert.Equal(t, 10, metrics.sizes[indexPodsByPIDNS])
+	assert.Len(t, db.podNamespaces["the-uid"], 10)
+
+	// AND the evicted pods are fetched again from the informer on the next lookup
+	pod, ok := db.OwnerPodInfo(namespaces, 0)
+	require.True(t, ok)
+	assert.Equal(t, "the-pod", pod.Name)
+	assert.Len(t, db.fetchedPodsCache, 11)
+
+	// AND the deletion of the pod still removes all its cached entries
+	db.uncachePodUID("the-uid")
+	assert.Empty(t, db.fetchedPodsCache)
+	assert.Empty(t, db.podNamespaces)
+}
+
+// fakeProcess is an instrumented process, as it would be inspected from the /proc filesystem
+type fakeProcess struct {
+	namespace   uint32
+	start       uint64
+	containerID string
+}
+
+// fakeProcesses replaces the inspection of the processes by the passed processes, indexed by PID.
+// Processes can be added or removed from the map to simulate their creation or termination.
+func fakeProcesses(t testing.TB, procs map[uint32]fakeProcess) {
+	origInfoForPID, origNamespaceForPID, origStartTime := containerInfoForPID, namespaceForPID, processStartTime
+	t.Cleanup(func() {
+		containerInfoForPID, namespaceForPID, processStartTime = origInfoForPID, origNamespaceForPID, origStartTime
+	})
+	noProcess := errors.New("no such process")
+	namespaceForPID = func(pid int32) (uint32, error) {
+		if p, ok := procs[uint32(pid)]; ok {
+			return p.namespace, nil
+		}
+		return 0, noProcess
+	}
+	processStartTime = func(pid uint32) (uint64, error) {
+		if p, ok := procs[pid]; ok {
+			return p.start, nil
+		}
+		return 0, noProcess
+	}
+	containerInfoForPID = func(pid uint32) (container.Info, error) {
+		if p, ok := procs[pid]; ok && p.containerID != "" {
+			return container.Info{ContainerID: p.containerID, PIDNamespace: p.namespace}, nil
+		}
+		return container.Info{}, container.ErrNoContainer
+	}
+}
+
+func TestOwnerPodInfo_NamespaceInodeReuse(t *testing.T) {
+	// GIVEN a database connected to the Kubernetes informers
+	client := fakek8sclientset.NewSimpleClientset()
+	informer := kube.Metadata{}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	db := CreateDatabase(&informer)
+	for pod, cid := range map[string]string{"pod-a": "container-a", "pod-b": "container-b"} {
+		_, err := client.CoreV1().Pods("the-ns").Create(context.Background(),
+			&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: pod, Namespace: "the-ns"},
+				Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{ContainerID: "containerd://" + cid}}}},
+			metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	// AND a process in the PID namespace with inode 7, whose pod has been cached
+	procs := map[uint32]fakeProcess{100: {namespace: 7, start: 1000, containerID: "container-a"}}
+	fakeProcesses(t, procs)
+	db.AddProcess(100)
+	require.Eventually(t, func() bool {
+		pod, ok := db.OwnerPodInfo(7, 0)
+		return ok && pod.Name == "pod-a"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// WHEN the process ends, and the kernel reuses the inode 7 for the namespace of a new process in another pod
+	delete(procs, 100)
+	procs[200] = fakeProcess{namespace: 7, start: 5000, containerID: "container-b"}
+	db.AddProcess(200)
+
+	// THEN the new process is not decorated with the cached pod of the dead process
+	pod, ok := db.OwnerPodInfo(7, 0)
+	require.True(t, ok)
+	assert.Equal(t, "pod-b", pod.Name)
+
+	// AND if the first process of a namespace ends while other processes are still running in it,
+	// its pod information is kept
+	procs[201] = fakeProcess{namespace: 7, start: 6000, containerID: "container-b"}
+	delete(procs, 200)
+	db.AddProcess(201)
+	pod, ok = db.OwnerPodInfo(7, 0)
+	require.True(t, ok)
+	assert.Equal(t, "pod-b", pod.Name)
+
+	// AND if the inode is reused by a namespace whose processes don't belong to any container,
+	// they are not decorated with the pod of the previous namespace
+	delete(procs, 201)
+	procs[300] = fakeProcess{namespace: 7, start: 9000}
+	db.AddProcess(300)
+	_, ok = db.OwnerPodInfo(7, 0)
+	assert.False(t, ok)
+}
+
+func TestOwnerPodInfo_SharedNamespace(t *testing.T) {
+	// GIVEN a database connected to the Kubernetes informers
+	client := fakek8sclientset.NewSimpleClientset()
+	informer := kube.Metadata{}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	db := CreateDatabase(&informer)
+	for pod, cid := range map[string]string{"pod-a": "container-a", "pod-b": "container-b"} {
+		_, err := client.CoreV1().Pods("the-ns").Create(context.Background(),
+			&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: pod, Namespace: "the-ns"},
+				Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{ContainerID: "containerd://" + cid}}}},
+			metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	// AND a process of a hostPID pod in the PID namespace of the host
+	procs := map[uint32]fakeProcess{100: {namespace: 7, start: 1000, containerID: "container-a"}}
+	fakeProcesses(t, procs)
+	db.AddProcess(100)
+	require.Eventually(t, func() bool {
+		pod, ok := db.OwnerPodInfo(7, 100)
+		return ok && pod.Name == "pod-a"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// WHEN a process of another hostPID pod is added to the same PID namespace
+	procs[200] = fakeProcess{namespace: 7, start: 2000, containerID: "container-b"}
+	db.AddProcess(200)
+
+	// THEN each process is decorated with the pod of its own container
+	pod, ok := db.OwnerPodInfo(7, 100)
+	require.True(t, ok)
+	assert.Equal(t, "pod-a", pod.Name)
+	pod, ok = db.OwnerPodInfo(7, 200)
+	require.True(t, ok)
+	assert.Equal(t, "pod-b", pod.Name)
+	cid, ok := db.ContainerID(7, 100)
+	require.True(t, ok)
+	assert.Equal(t, "container-a", cid)
+	cid, ok = db.ContainerID(7, 200)
+	require.True(t, ok)
+	assert.Equal(t, "container-b", cid)
+
+	// AND the processes whose container is unknown are not decorated with the pod of another process
+	_, ok = db.OwnerPodInfo(7, 300)
+	assert.False(t, ok)
+	_, ok = db.ContainerID(7, 300)
+	assert.False(t, ok)
+
+	// AND WHEN one of the containers is deleted
+	db.OnDeletion([]string{"container-b"})
+
+	// THEN the namespace is kept for the processes of the other containers
+	pod, ok = db.OwnerPodInfo(7, 100)
+	require.True(t, ok)
+	assert.Equal(t, "pod-a", pod.Name)
+	_, ok = db.OwnerPodInfo(7, 200)
+	assert.False(t, ok)
+}
+
+func TestOwnerPodInfo_ContainerReplaced(t *testing.T) {
+	// GIVEN a database connected to the Kubernetes informers
+	client := fakek8sclientset.NewSimpleClientset()
+	informer := kube.Metadata{}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	db := CreateDatabase(&informer)
+	createPod := func(name, containerID string) {
+		_, err := client.CoreV1().Pods("the-ns").Create(context.Background(),
+			&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "the-ns", UID: types.UID(name)},
+				Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{ContainerID: "containerd://" + containerID}}}},
+			metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+	createPod("pod-a", "container-a")
+
+	// AND a PID namespace whose first process does not belong to any container, and a process of a
+	// container whose pod has been cached
+	procs := map[uint32]fakeProcess{
+		90:  {namespace: 7, start: 900},
+		100: {namespace: 7, start: 1000, containerID: "container-a"},
+	}
+	fakeProcesses(t, procs)
+	db.AddProcess(90)
+	db.AddProcess(100)
+	require.Eventually(t, func() bool {
+		pod, ok := db.OwnerPodInfo(7, 100)
+		return ok && pod.Name == "pod-a"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// WHEN the container is replaced by another one in the same namespace, which is not recreated
+	// as the first process is still alive
+	delete(procs, 100)
+	require.NoError(t, client.CoreV1().Pods("the-ns").Delete(context.Background(), "pod-a", metav1.DeleteOptions{}))
+	createPod("pod-b", "container-b")
+	procs[200] = fakeProcess{namespace: 7, start: 2000, containerID: "container-b"}
+	db.AddProcess(200)
+
+	// THEN the namespace is decorated with the pod of the new container
+	require.Eventually(t, func() bool {
+		pod, ok := db.OwnerPodInfo(7, 200)
+		return ok && pod.Name == "pod-b"
+	}, 5*time.Second, 10*time.Millisecond)
+	cid, ok := db.ContainerID(7, 200)
+	require.True(t, ok)
+	assert.Equal(t, "container-b", cid)
+	// AND the namespace is not considered as shared with the previous container
+	db.nsMut.RLock()
+	assert.Empty(t, db.sharedNamespaces)
+	db.nsMut.RUnlock()
+	db.cntMut.Lock()
+	assert.NotContains(t, db.containerIDs, "container-a")
+	db.cntMut.Unlock()
+}
+
+func TestOwnerPodInfo_Reinspection(t *testing.T) {
+	origPeriod := reinspectionPeriod
+	t.Cleanup(func() { reinspectionPeriod = origPeriod })
+	reinspectionPeriod = time.Hour
+	// GIVEN a database connected to the Kubernetes informers
+	client := fakek8sclientset.NewSimpleClientset()
+	informer := kube.Metadata{}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	db := CreateDatabase(&informer)
+
+	// AND a process whose cgroup was read before it was moved into its container
+	procs := map[uint32]fakeProcess{100: {namespace: 7, start: 1000, containerID: "runtime-container"}}
+	fakeProcesses(t, procs)
+	db.AddProcess(100)
+	_, ok := db.OwnerPodInfo(7, 100)
+	require.False(t, ok)
+
+	// WHEN the process is moved into its container, whose pod is indexed
+	procs[100] = fakeProcess{namespace: 7, start: 1000, containerID: "container-a"}
+	_, err := client.CoreV1().Pods("the-ns").Create(context.Background(),
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-a", Namespace: "the-ns"},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{ContainerID: "containerd://container-a"}}}},
+		metav1.CreateOptions{})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, ok := informer.GetContainerPod("container-a")
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// THEN the namespace is not inspected again until the reinspection period expires
+	_, ok = db.OwnerPodInfo(7, 100)
+	require.False(t, ok)
+	db.nsMut.Lock()
+	db.reinspections = map[pidNamespace]time.Time{}
+	db.nsMut.Unlock()
+
+	// AND after that, the live process is inspected again and decorated with the pod of its actual container
+	pod, ok := db.OwnerPodInfo(7, 100)
+	require.True(t, ok)
+	assert.Equal(t, "pod-a", pod.Name)
+	cid, ok := db.ContainerID(7, 100)
+	require.True(t, ok)
+	assert.Equal(t, "container-a", cid)
+}
+
+func TestStartDatabase_RemoteCluster(t *testing.T) {
+	// GIVEN a database that watches a cluster which the local host is not a node of
+	informer := kube.NewFakeMetadata()
+	db, err := StartDatabase(context.TODO(), informer, imetrics.NoopReporter{}, DatabaseConfig{RemoteCluster: true})
+	require.NoError(t, err)
+	defer db.Stop()
+	informer.AddPod(&kube.PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop", UID: "uid-1"},
+		IPs: []string{"10.244.0.5"}, ContainerIDs: []string{"container-a"}})
+
+	// WHEN a local process is added, even if its container ID matches a pod of the cluster
+	fakeProcesses(t, map[uint32]fakeProcess{100: {namespace: 7, start: 1000, containerID: "container-a"}})
+	db.AddProcess(100)
+
+	// THEN it is not decorated
+	_, ok := db.OwnerPodInfo(7, 100)
+	assert.False(t, ok)
+	assert.Empty(t, db.namespaces)
+	assert.Empty(t, db.containerIDs)
+
+	// AND the peers are still decorated from the IP indexes
+	pod := db.PodInfoForIP("10.244.0.5")
+	require.NotNil(t, pod)
+	assert.Equal(t, "web", pod.Name)
+	informer.DeletePod("shop", "web")
+	assert.Nil(t, db.PodInfoForIP("10.244.0.5"))
+}
+
+func TestOnDeletion(t *testing.T) {
+	informer := kube.NewFakeMetadata()
+	db := CreateDatabase(informer)
+	informer.AddPod(&kube.PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "the-pod", Namespace: "the-ns"},
+		ContainerIDs: []string{"container-a"}})
+	fakeProcesses(t, map[uint32]fakeProcess{100: {namespace: 7, start: 1000, containerID: "container-a"}})
+	db.AddProcess(100)
+	_, ok := db.OwnerPodInfo(7, 0)
+	require.True(t, ok)
+
+	// WHEN the container is deleted
+	db.OnDeletion([]string{"container-a"})
+
+	// THEN all the information about its namespace generation is removed
+	_, ok = db.OwnerPodInfo(7, 0)
+	assert.False(t, ok)
+	assert.Empty(t, db.namespaces)
+	assert.Empty(t, db.generations)
+	assert.Empty(t, db.fetchedPodsCache)
+	assert.Empty(t, db.containerIDs)
+}
+
+func TestOnDeletion_MissedPodDeletion(t *testing.T) {
+	informer := kube.NewFakeMetadata()
+	// GIVEN a database whose IPs index does not receive the pod deletions
+	db := CreateDatabase(informer)
+	for _, p := range []struct{ name, ip, cid string }{
+		{name: "pod-a", ip: "10.0.0.1", cid: "container-a"},
+		{name: "pod-b", ip: "10.0.0.2", cid: "container-b"},
+	} {
+		pod := &kube.PodInfo{
+			ObjectMeta:   metav1.ObjectMeta{Name: p.name, Namespace: "the-ns", UID: types.UID("uid-" + p.name)},
+			IPs:          []string{p.ip},
+			ContainerIDs: []string{p.cid},
+		}
+		informer.AddPod(pod)
+		db.UpdateNewPodsByIPIndex(pod)
+	}
+	// AND a process in the first pod, which has been decorated
+	fakeProcesses(t, map[uint32]fakeProcess{100: {namespace: 7, start: 1000, containerID: "container-a"}})
+	db.AddProcess(100)
+	_, ok := db.OwnerPodInfo(7, 100)
+	require.True(t, ok)
+
+	// WHEN the first pod is deleted, but only the deletion of its container is received
+	informer.DeletePod("the-ns", "pod-a")
+	require.NotNil(t, db.PodInfoForIP("10.0.0.1"))
+	db.OnDeletion([]string{"container-a"})
+
+	// THEN the IPs of the pod are removed
+	assert.Nil(t, db.PodInfoForIP("10.0.0.1"))
+
+	// AND WHEN the container of a pod that still exists is deleted, for example after being restarted
+	db.OnDeletion([]string{"container-b"})
+
+	// THEN the IPs of the pod are kept
+	pod := db.PodInfoForIP("10.0.0.2")
+	require.NotNil(t, pod)
+	assert.Equal(t, "pod-b", pod.Name)
+}
+
+func TestOwnerPodInfo_StaticPodRecreation(t *testing.T) {
+	// GIVEN a database connected to the Kubernetes informers
+	informer := kube.NewFakeMetadata()
+	db, err := StartDatabase(context.TODO(), informer, imetrics.NoopReporter{}, DatabaseConfig{})
+	require.NoError(t, err)
+	defer db.Stop()
+	staticPod := func(uid string, containerIDs ...string) *kube.PodInfo {
+		return &kube.PodInfo{
+			ObjectMeta:   metav1.ObjectMeta{Name: "etcd-node-1", Namespace: "kube-system", UID: types.UID(uid)},
+			ContainerIDs: containerIDs,
+		}
+	}
+	informer.AddPod(staticPod("uid-1", "container-a"))
+
+	// AND a process of the static pod, whose pod information has been cached
+	fakeProcesses(t, map[uint32]fakeProcess{100: {namespace: 7, start: 1000, containerID: "container-a"}})
+	db.AddProcess(100)
+	pod, ok := db.OwnerPodInfo(7, 0)
+	require.True(t, ok)
+	require.Equal(t, types.UID("uid-1"), pod.UID)
+
+	// WHEN the pod is deleted without notifying the deletion of its containers (its status
+	// does not report them anymore), and recreated while its sandbox keeps running
+	informer.AddPod(staticPod("uid-1"))
+	informer.DeletePod("kube-system", "etcd-node-1")
+	informer.AddPod(staticPod("uid-2", "container-a"))
+
+	// THEN the process is decorated with the information of the recreated pod
+	pod, ok = db.OwnerPodInfo(7, 0)
+	require.True(t, ok)
+	assert.Equal(t, types.UID("uid-2"), pod.UID)
+
+	// AND the information of the deleted pod is not kept in the reverse index
+	db.podsCacheMut.RLock()
+	defer db.podsCacheMut.RUnlock()
+	assert.NotContains(t, db.podNamespaces, types.UID("uid-1"))
+	assert.Contains(t, db.podNamespaces, types.UID("uid-2"))
+}
+
+func TestOwnerPodInfo_ReplacedPodName(t *testing.T) {
+	informer := kube.NewFakeMetadata()
+	// GIVEN a database that does not receive the pod events
+	db := CreateDatabase(informer)
+	statefulPod := func(uid string) *kube.PodInfo {
+		return &kube.PodInfo{
+			ObjectMeta:   metav1.ObjectMeta{Name: "web-0", Namespace: "the-ns", UID: types.UID(uid)},
+			ContainerIDs: []string{"container-a"},
+		}
+	}
+	informer.AddPod(statefulPod("uid-1"))
+
+	// AND a process whose pod information has been cached
+	fakeProcesses(t, map[uint32]fakeProcess{100: {namespace: 7, start: 1000, containerID: "container-a"}})
+	db.AddProcess(100)
+	pod, ok := db.OwnerPodInfo(7, 100)
+	require.True(t, ok)
+	require.Equal(t, types.UID("uid-1"), pod.UID)
+
+	// WHEN the pod is recreated with the same name, and its deletion is missed
+	informer.DeletePod("the-ns", "web-0")
+	informer.AddPod(statefulPod("uid-2"))
+
+	// THEN the cached pod is not returned, as the informer store contains another incarnation of it
+	pod, ok = db.OwnerPodInfo(7, 100)
+	require.True(t, ok)
+	assert.Equal(t, types.UID("uid-2"), pod.UID)
+}
+
+func TestOwnerPodInfo_InitAndEphemeralContainers(t *testing.T) {
+	// GIVEN a database connected to the Kubernetes informers
+	client := fakek8sclientset.NewSimpleClientset()
+	informer := kube.Metadata{}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	db, err := StartDatabase(context.TODO(), &informer, imetrics.NoopReporter{}, DatabaseConfig{})
+	require.NoError(t, err)
+
+	// AND a pod whose init container is running, while its main container waits for it
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "the-pod", Namespace: "the-ns", UID: "the-uid"},
+		Status: corev1.PodStatus{
+			InitContainerStatuses: []corev1.ContainerStatus{{Name: "migrations", ContainerID: "containerd://container-init",
+				State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}},
+			ContainerStatuses: []corev1.ContainerStatus{{Name: "app",
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "PodInitializing"}}}},
+		}}
+	_, err = client.CoreV1().Pods("the-ns").Create(context.Background(), pod, metav1.CreateOptions{})
+	require.NoError(t, err)
+	fakeProcesses(t, map[uint32]fakeProcess{
+		100: {namespace: 7, start: 1000, containerID: "container-init"},
+		200: {namespace: 8, start: 2000, containerID: "container-app"},
+		300: {namespace: 9, start: 3000, containerID: "container-debug"},
+	})
+
+	// WHEN a process runs in the init container
+	db.AddProcess(100)
+	// THEN it is attributed to the pod, and to the init container
+	require.Eventually(t, func() bool {
+		_, ok := db.OwnerPodInfo(7, 0)
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+	info, _ := db.OwnerPodInfo(7, 0)
+	ci, ok := info.Container("container-init")
+	require.True(t, ok)
+	assert.Equal(t, "migrations", ci.Name)
+
+	// AND WHEN the init container exits and the main container starts
+	pod.Status.InitContainerStatuses[0].State = corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}}
+	pod.Status.ContainerStatuses[0].ContainerID = "containerd://container-app"
+	pod.Status.ContainerStatuses[0].State = corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	_, err = client.CoreV1().Pods("the-ns").UpdateStatus(context.Background(), pod, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	db.OnDeletion([]string{"container-init"})
+	db.AddProcess(200)
+	// THEN the processes of the main container are attributed to the same pod
+	require.Eventually(t, func() bool {
+		info, ok := db.OwnerPodInfo(8, 0)
+		return ok && info.UID == "the-uid"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// AND WHEN an ephemeral container is attached to the running pod
+	pod.Status.EphemeralContainerStatuses = []corev1.ContainerStatus{{Name: "debugger",
+		ContainerID: "containerd://container-debug", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}}
+	_, err = client.CoreV1().Pods("the-ns").UpdateStatus(context.Background(), pod, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	db.AddProcess(300)
+	// THEN its processes are attributed to the pod, and to the ephemeral container
+	require.Eventually(t, func() bool {
+		info, ok := db.OwnerPodInfo(9, 0)
+		if !ok {
+			return false
+		}
+		ci, ok := info.Container("container-debug")
+		return ok && ci.Name == "debugger"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestOwnerPodInfo_ContainerStatusUpdate(t *testing.T) {
+	// GIVEN a database connected to the Kubernetes informers
+	client := fakek8sclientset.NewSimpleClientset()
+	informer := kube.Metadata{}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	db, err := StartDatabase(context.TODO(), &informer, imetrics.NoopReporter{}, DatabaseConfig{})
+	require.NoError(t, err)
+	startTime := metav1.NewTime(time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC))
+	podWithRestarts := func(restarts int32) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "the-pod", Namespace: "the-ns", UID: "the-uid",
+			Annotations: map[string]string{kube.ServiceNameAnnotation: "the-service", "unused": "annotation"}},
+			Status: corev1.PodStatus{
+				StartTime: &startTime,
+				ContainerStatuses: []corev1.ContainerStatus{
+					{ContainerID: "containerd://container-a", RestartCount: restarts, Name: "a", Image: "image-a:1.0"},
+					{ContainerID: "containerd://container-b", RestartCount: 7, Name: "b", Image: "image-b"},
+				},
+			}}
+	}
+	_, err = client.CoreV1().Pods("the-ns").Create(context.Background(), podWithRestarts(0), metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	// AND a process running in one of the containers of the pod
+	fakeProcesses(t, map[uint32]fakeProcess{100: {namespace: 7, start: 1000, containerID: "container-a"}})
+	db.AddProcess(100)
+	var pod *kube.PodInfo
+	require.Eventually(t, func() bool {
+		var ok bool
+		pod, ok = db.OwnerPodInfo(7, 0)
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "2024-05-06T07:08:09Z", pod.StartTimeStr)
+	assert.Equal(t, map[string]int32{"container-a": 0, "container-b": 7}, pod.ContainerRestarts)
+	assert.Equal(t, map[string]kube.ContainerInfo{
+		"container-a": {Name: "a", Image: "image-a:1.0"},
+		"container-b": {Name: "b", Image: "image-b"},
+	}, pod.Containers)
+	// only the annotations that are used by Beyla are kept
+	assert.Equal(t, map[string]string{kube.ServiceNameAnnotation: "the-service"}, pod.Annotations)
+	cid, ok := db.ContainerID(7, 0)
+	require.True(t, ok)
+	assert.Equal(t, "container-a", cid)
+
+	// WHEN the container restarts
+	_, err = client.CoreV1().Pods("the-ns").UpdateStatus(context.Background(), podWithRestarts(1), metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	// THEN the cached pod is updated with the new restart count
+	require.Eventually(t, func() bool {
+		pod, ok := db.OwnerPodInfo(7, 0)
+		return ok && pod.ContainerRestarts["container-a"] == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// AND WHEN the service annotations of the running pod are changed
+	annotated := podWithRestarts(1)
+	annotated.Annotations = map[string]string{
+		kube.ServiceNameAnnotation:      "renamed-service",
+		kube.ServiceNamespaceAnnotation: "the-service-ns",
+	}
+	_, err = client.CoreV1().Pods("the-ns").Update(context.Background(), annotated, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	// THEN the cached pod is updated with the new annotations
+	require.Eventually(t, func() bool {
+		pod, ok := db.OwnerPodInfo(7, 0)
+		return ok && pod.ServiceName() == "renamed-service" && pod.ServiceNamespace() == "the-service-ns"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestContainerID_Restart(t *testing.T) {
+	client := fakek8sclientset.NewSimpleClientset()
+	informer := kube.Metadata{}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	db := CreateDatabase(&informer)
+
+	// GIVEN a process running in a container
+	procs := map[uint32]fakeProcess{100: {namespace: 7, start: 1000, containerID: "container-a"}}
+	fakeProcesses(t, procs)
+	db.AddProcess(100)
+	cid, ok := db.ContainerID(7, 0)
+	require.True(t, ok)
+	assert.Equal(t, "container-a", cid)
+
+	// WHEN the container is restarted
+	delete(procs, 100)
+	procs[101] = fakeProcess{namespace: 7, start: 2000, containerID: "container-b"}
+	db.AddProcess(101)
+
+	// THEN the ID of the new container is returned
+	cid, ok = db.ContainerID(7, 0)
+	require.True(t, ok)
+	assert.Equal(t, "container-b", cid)
+
+	_, ok = db.ContainerID(8, 0)
+	assert.False(t, ok)
+}
+
+func TestDatabase_WaitForCacheSync(t *testing.T) {
+	// GIVEN a Kubernetes API that is slow to list the pods
+	release := make(chan struct{})
+	client := fakek8sclientset.NewSimpleClientset()
+	client.PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		<-release
+		return false, nil, nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// WHEN the informers don't sync before the timeout
+	informer := kube.Metadata{}
+	start := time.Now()
+	require.NoError(t, informer.InitFromClient(ctx, client, 50*time.Millisecond))
+	// THEN the initialization proceeds after the timeout instead of failing
+	assert.Less(t, time.Since(start), 5*time.Second)
+	db, err := StartDatabase(ctx, &informer, imetrics.NoopReporter{}, DatabaseConfig{})
+	require.NoError(t, err)
+	// AND the database reports that it is not synced yet
+	waitCtx, cancelWait := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancelWait()
+	require.Error(t, db.WaitForCacheSync(waitCtx))
+	require.Error(t, informer.Synced(ctx))
+
+	// AND WHEN the Kubernetes API finally answers
+	close(release)
+	// THEN the database is eventually synced
+	waitCtx, cancelWait = context.WithTimeout(ctx, 5*time.Second)
+	defer cancelWait()
+	require.NoError(t, db.WaitForCacheSync(waitCtx))
+	require.NoError(t, informer.Synced(ctx))
+}
+
+func TestDatabase_Stop(t *testing.T) {
+	// GIVEN two databases that share the same Kubernetes informers
+	client := fakek8sclientset.NewSimpleClientset()
+	informer := kube.Metadata{}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	stopped, err := StartDatabase(context.TODO(), &informer, imetrics.NoopReporter{}, DatabaseConfig{PodsCacheTTL: time.Minute})
+	require.NoError(t, err)
+	running, err := StartDatabase(context.TODO(), &informer, imetrics.NoopReporter{}, DatabaseConfig{PodsCacheTTL: time.Minute})
+	require.NoError(t, err)
+
+	// WHEN one of them is stopped
+	stopped.Stop()
+	// AND a pod is created afterwards
+	_, err = client.CoreV1().Pods("the-ns").Create(context.Background(), &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "the-pod", Namespace: "the-ns", UID: "the-uid"},
+		Status: corev1.PodStatus{
+			PodIP:  "10.244.0.5",
+			PodIPs: []corev1.PodIP{{IP: "10.244.0.5"}},
+		},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	// THEN the running database keeps receiving the informer events
+	require.Eventually(t, func() bool {
+		return running.PodInfoForIP("10.244.0.5") != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	// AND the stopped database doesn't index them anymore
+	assert.Nil(t, stopped.PodInfoForIP("10.244.0.5"))
+	assert.Zero(t, stopped.podIPsLen.Load())
+
+	// AND the lookups and process registration in the stopped database are safe no-ops
+	fakeProcesses(t, map[uint32]fakeProcess{100: {namespace: 7, start: 1000, containerID: "container-a"}})
+	stopped.AddProcess(100)
+	_, ok := stopped.ContainerID(7, 0)
+	assert.False(t, ok)
+	_, ok = stopped.OwnerPodInfo(7, 0)
+	assert.False(t, ok)
+	assert.Nil(t, stopped.ServiceForIP("10.244.0.5", 80))
+
+	// AND stopping it again has no effect
+	assert.NotPanics(t, stopped.Stop)
+	running.Stop()
+}
+
+// deletedEntries returns the number of IPs of the deleted pods and endpoints that are kept in the indexes
+func deletedEntries(db *Database) int {
+	entries := 0
+	for _, sh := range db.ipShards {
+		sh.mut.RLock()
+		entries += len(sh.deletedPodsByIP) + len(sh.deletedServicesByIP)
+		sh.mut.RUnlock()
+	}
+	return entries
+}
+
+func TestPodInfoForIP_DeletedPodsGracePeriod(t *testing.T) {
+	now := time.Unix(1000, 0)
+	origTimeNow := timeNow
+	t.Cleanup(func() { timeNow = origTimeNow })
+	timeNow = func() time.Time { return now }
+
+	// GIVEN a database that keeps the deleted pods for 30 seconds
+	metrics := &indexMetrics{
+		sizes: map[string]int{}, hits: map[string]int{}, misses: map[string]int{}, evictions: map[string]int{},
+	}
+	db := CreateDatabase(nil)
+	db.metrics = metrics
+	db.deletedPodsGrace = 30 * time.Second
+	pod := &kube.PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "web-1", UID: "uid-1"},
+		IPs: []string{"10.244.0.5", "10.244.0.6"}}
+	db.UpdateNewPodsByIPIndex(pod)
+
+	// WHEN the pod is updated without changing its IPs
+	updated := *pod
+	updated.Labels = map[string]string{"version": "2"}
+	db.UpdatePodsByIPIndex(pod, &updated)
+	// THEN the IPs are resolved to the updated pod, which is not considered deleted
+	assert.Same(t, &updated, db.PodInfoForIP("10.244.0.5"))
+	assert.Zero(t, deletedEntries(&db))
+
+	// AND WHEN an update removes one of the IPs
+	singleIP := updated
+	singleIP.IPs = []string{"10.244.0.6"}
+	db.UpdatePodsByIPIndex(&updated, &singleIP)
+	// THEN the removed IP is still resolved during the grace period
+	assert.Same(t, &updated, db.PodInfoForIP("10.244.0.5"))
+	assert.Same(t, &singleIP, db.PodInfoForIP("10.244.0.6"))
+
+	// AND WHEN the pod is deleted
+	db.UpdateDeletedPodsByIPIndex(&singleIP)
+	// THEN its IPs are still resolved during the grace period
+	now = now.Add(20 * time.Second)
+	assert.Equal(t, "web-1", db.PodInfoForIP("10.244.0.6").Name)
+	assert.Zero(t, db.podIPsLen.Load())
+
+	// AND WHEN a new pod claims one of the IPs
+	newPod := &kube.PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "web-2", UID: "uid-2"},
+		IPs: []string{"10.244.0.6"}}
+	db.UpdateNewPodsByIPIndex(newPod)
+	// THEN the new pod immediately replaces the deleted pod
+	assert.Same(t, newPod, db.PodInfoForIP("10.244.0.6"))
+
+	// AND WHEN the grace period is over
+	now = now.Add(15 * time.Second)
+	// THEN the deleted pod is not resolved anymore, even before being purged
+	assert.Nil(t, db.PodInfoForIP("10.244.0.5"))
+	// AND it's purged by the periodic sweep
+	assert.Equal(t, 1, db.purgeDeleted())
+	assert.Zero(t, deletedEntries(&db))
+	assert.Equal(t, 1, metrics.evictions[indexPodsByIP])
+	assert.Same(t, newPod, db.PodInfoForIP("10.244.0.6"))
+}
+
+func TestServiceForIP_DeletedPodsGracePeriod(t *testing.T) {
+	now := time.Unix(1000, 0)
+	origTimeNow := timeNow
+	t.Cleanup(func() { timeNow = origTimeNow })
+	timeNow = func() time.Time { return now }
+
+	// GIVEN a database that keeps the removed endpoints for 30 seconds
+	db := CreateDatabase(nil)
+	db.deletedPodsGrace = 30 * time.Second
+	web := slice("a", "shop", "web", nil, "10.244.0.5", "10.244.0.6")
+	db.UpdateNewServicesByIPIndex(web)
+
+	// WHEN one of the endpoints is removed from the slice
+	db.UpdateServicesByIPIndex(web, slice("a", "shop", "web", nil, "10.244.0.6"))
+	// THEN its IP is still attributed to the Service during the grace period
+	es := db.ServiceForIP("10.244.0.5", 0)
+	require.NotNil(t, es)
+	assert.Equal(t, "web", es.ServiceName)
+	assert.NotContains(t, db.shard("10.244.0.5").servicesByIP, "10.244.0.5")
+
+	// AND WHEN the IP is claimed by the endpoint of another Service
+	db.UpdateNewServicesByIPIndex(slice("b", "shop", "cart", nil, "10.244.0.5"))
+	// THEN the live endpoint is preferred
+	assert.Equal(t, "cart", db.ServiceForIP("10.244.0.5", 0).ServiceName)
+
+	// AND WHEN the slice is deleted
+	db.UpdateDeletedServicesByIPIndex(slice("a", "shop", "web", nil, "10.244.0.6"))
+	now = now.Add(20 * time.Second)
+	// THEN its remaining IP is still attributed during the grace period
+	assert.Equal(t, "web", db.ServiceForIP("10.244.0.6", 0).ServiceName)
+
+	// AND WHEN the grace period is over
+	now = now.Add(15 * time.Second)
+	// THEN the removed endpoints are forgotten
+	assert.Nil(t, db.ServiceForIP("10.244.0.6", 0))
+	assert.Equal(t, 2, db.purgeDeleted())
+	assert.Zero(t, deletedEntries(&db))
+}
+
+func TestUnknownIPs(t *testing.T) {
+	// GIVEN a database that remembers up to 3 unknown IPs
+	db := CreateDatabase(nil)
+	db.unknownIPs = expirable.NewLRU[string, struct{}](3, nil, time.Minute)
+	db.UpdateNewPodsByIPIndex(&kube.PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "web", UID: "uid-web"},
+		IPs: []string{"10.244.0.5"}})
+	db.UpdateNewPodsByIPIndex(&kube.PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "exporter", UID: "uid-exp"},
+		HostIPs: []string{"192.168.1.10"}, HostPorts: []uint16{9100}})
+
+	// WHEN IPs are not found in any index
+	for _, ip := range []string{"8.8.8.8", "::ffff:1.1.1.1", "10.244.0.99"} {
+		assert.False(t, db.IsUnknownIP(ip))
+		db.AddUnknownIP(ip)
+	}
+	// THEN they are remembered as unknown, in any of their text representations
+	assert.True(t, db.IsUnknownIP("8.8.8.8"))
+	assert.True(t, db.IsUnknownIP("1.1.1.1"))
+	assert.True(t, db.IsUnknownIP("10.244.0.99"))
+
+	// AND the IPs that are present in any index are never remembered as unknown,
+	// as they might be found when looked up by another port
+	db.AddUnknownIP("10.244.0.5")
+	db.AddUnknownIP("192.168.1.10")
+	assert.False(t, db.IsUnknownIP("10.244.0.5"))
+	assert.False(t, db.IsUnknownIP("192.168.1.10"))
+
+	// AND WHEN the unknown IPs are claimed by a pod, a hostPort pod, or an endpoint
+	db.UpdateNewPodsByIPIndex(&kube.PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "new", UID: "uid-new"},
+		IPs: []string{"10.244.0.99"}})
+	db.UpdateNewPodsByIPIndex(&kube.PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "proxy", UID: "uid-proxy"},
+		HostIPs: []string{"8.8.8.8"}, HostPorts: []uint16{53}})
+	db.UpdateNewServicesByIPIndex(slice("a", "shop", "web", nil, "1.1.1.1"))
+	// THEN they are not unknown anymore
+	assert.False(t, db.IsUnknownIP("10.244.0.99"))
+	assert.False(t, db.IsUnknownIP("8.8.8.8"))
+	assert.False(t, db.IsUnknownIP("1.1.1.1"))
+	assert.Zero(t, db.unknownIPs.Len())
+
+	// AND WHEN more unknown IPs than the cache size are looked up
+	for i := 1; i <= 4; i++ {
+		db.AddUnknownIP(fmt.Sprintf("203.0.113.%d", i))
+	}
+	// THEN the least recently used IPs are evicted
+	assert.Equal(t, 3, db.unknownIPs.Len())
+	assert.False(t, db.IsUnknownIP("203.0.113.1"))
+	assert.True(t, db.IsUnknownIP("203.0.113.4"))
+
+	// AND WHEN the hostPort pod is deleted
+	db.UpdateDeletedPodsByIPIndex(&kube.PodInfo{ObjectMeta: metav1.ObjectMeta{Name: "exporter", UID: "uid-exp"},
+		HostIPs: []string{"192.168.1.10"}, HostPorts: []uint16{9100}})
+	// THEN its node IP can be remembered as unknown
+	db.AddUnknownIP("192.168.1.10")
+	assert.True(t, db.IsUnknownIP("192.168.1.10"))
+}
+
+// BenchmarkIPIndexes_Churn measures the IP lookups of the network flows decoration while a writer
+// goroutine continuously replaces pods and endpoints, as during the rollouts of a busy cluster
+func BenchmarkIPIndexes_Churn(b *testing.B) {
+	const pods = 10000
+	ips := make([]string, pods)
+	for i := range ips {
+		ips[i] = fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff)
+	}
+	newPod := func(i, gen int) *kube.PodInfo {
+		return &kube.PodInfo{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("pod-%d", i), UID: types.UID(fmt.Sprintf("%d-%d", i, gen)),
+				CreationTimestamp: metav1.NewTime(time.Unix(int64(gen), 0))},
+			IPs: []string{ips[i]},
+		}
+	}
+	for _, readers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("readers=%dxGOMAXPROCS", readers), func(b *testing.B) {
+			db := CreateDatabase(nil)
+			current := make([]*kube.PodInfo, pods)
+			for i := range current {
+				current[i] = newPod(i, 0)
+				db.UpdateNewPodsByIPIndex(current[i])
+				if i%10 == 0 {
+					db.UpdateNewServicesByIPIndex(slice(fmt.Sprint(i), "ns", "svc", []uint16{8080}, ips[i]))
+				}
+			}
+			// the writer replaces the pods, one by one, until the benchmark ends
+			done := make(chan struct{})
+			writerDone := make(chan struct{})
+			go func() {
+				defer close(writerDone)
+				for gen := 1; ; gen++ {
+					for i := range current {
+						select {
+						case <-done:
+							return
+						default:
+						}
+						replacement := newPod(i, gen)
+						db.UpdateDeletedPodsByIPIndex(current[i])
+						db.UpdateNewPodsByIPIndex(replacement)
+						current[i] = replacement
+					}
+				}
+			}()
+			b.SetParallelism(readers)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					ip := ips[i*7919%pods]
+					db.ServiceForIP(ip, 8080)
+					db.PodInfoForIPPort(ip, 8080)
+					i++
+				}
+			})
+			b.StopTimer()
+			close(done)
+			<-writerDone
+		})
+	}
+}
+
+// BenchmarkUpdatePodsByIPIndex_StatusUpdates measures the pod updates received at a high rate, as the status
+// updates of a busy cluster, while the network flows are decorated. Most of them don't change the stored fields.
+func BenchmarkOwnerPodInfo_ResolvedOwner(b *testing.B) {
+	client := fakek8sclientset.NewSimpleClientset()
+	informer := kube.Metadata{}
+	require.NoError(b, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	db := CreateDatabase(&informer)
+	fakeProcesses(b, map[uint32]fakeProcess{123: {namespace: 123, start: 1000, containerID: "container-123"}})
+	db.AddProcess(123)
+	_, err := client.AppsV1().ReplicaSets("the-ns").Create(context.Background(),
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+			Name: "the-rs", Namespace: "the-ns",
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "the-deployment"}},
+		}}, metav1.CreateOptions{})
+	require.NoError(b, err)
+	_, err = client.CoreV1().Pods("the-ns").Create(context.Background(),
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name: "the-pod", Namespace: "the-ns",
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "the-rs"}},
+		}, Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{{ContainerID: "containerd://container-123"}},
+		}}, metav1.CreateOptions{})
+	require.NoError(b, err)
+	require.Eventually(b, func() bool {
+		pod, ok := db.OwnerPodInfo(123, 0)
+		return ok && pod.Owner.Owner != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, ok := db.OwnerPodInfo(123, 0); !ok {
+			b.Fatal("pod not found")
+		}
+	}
+}
+
+func BenchmarkUpdatePodsByIPIndex_StatusUpdates(b *testing.B) {
+	const pods = 10000
+	ips := make([]string, pods)
+	current := make([]*kube.PodInfo, pods)
+	db := CreateDatabase(nil)
+	for i := range current {
+		ips[i] = fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff)
+		current[i] = &kube.PodInfo{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("pod-%d", i), UID: types.UID(fmt.Sprint(i)),
+				Labels: map[string]string{"app": "web"}},
+			IPs: []string{ips[i]},
+		}
+		db.UpdateNewPodsByIPIndex(current[i])
+	}
+	done := make(chan struct{})
+	readersDone := make(chan struct{})
+	go func() {
+		defer close(readersDone)
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			db.PodInfoForIP(ips[i*7919%pods])
+		}
+	}()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		oldPod := current[i%pods]
+		newPod := *oldPod
+		db.UpdatePodsByIPIndex(oldPod, &newPod)
+		current[i%pods] = &newPod
+	}
+	b.StopTimer()
+	close(done)
+	<-readersDone
+}
+
+func TestReconcile(t *testing.T) {
+	// GIVEN a database connected to the Kubernetes informers
+	informer := kube.NewFakeMetadata()
+	metrics := &reconciliationMetrics{corrections: map[string]int{}}
+	db, err := StartDatabase(context.TODO(), informer, metrics, DatabaseConfig{})
+	require.NoError(t, err)
+	t.Cleanup(db.Stop)
+
+	// AND some pods and EndpointSlices that are indexed from the informer events
+	for i, name := range []string{"web", "db"} {
+		informer.AddPod(&kube.PodInfo{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "shop", UID: types.UID(name)},
+			IPs:        []string{fmt.Sprintf("10.0.0.%d", i+1)},
+		})
+	}
+	informer.AddEndpointSlice(&kube.EndpointSliceInfo{
+		ObjectMeta:  metav1.ObjectMeta{Name: "web-abcde", Namespace: "shop", UID: "slice-1"},
+		ServiceName: "web", IPs: []string{"10.0.0.1"}, Ports: []uint16{8080},
+	})
+	require.NotNil(t, db.PodInfoForIP("10.0.0.1"))
+	require.NotNil(t, db.PodInfoForIP("10.0.0.2"))
+	require.NotNil(t, db.ServiceForIP("10.0.0.1", 8080))
+	// nothing needs to be fixed while the database follows the informers
+	assert.Zero(t, db.reconcile())
+
+	// WHEN the database misses some events, as it happens while the informers are disconnected
+	// from the API server: the deletion of a pod and a slice, and the creation of another pod
+	db.UpdateNewPodsByIPIndex(&kube.PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "deleted", Namespace: "shop", UID: "deleted"},
+		IPs:        []string{"10.0.0.3"},
+	})
+	db.UpdateNewServicesByIPIndex(&kube.EndpointSliceInfo{
+		ObjectMeta:  metav1.ObjectMeta{Name: "deleted-abcde", Namespace: "shop", UID: "slice-2"},
+		ServiceName: "deleted", IPs: []string{"10.0.0.3"},
+	})
+	db.UpdateDeletedPodsByIPIndex(db.PodInfoForIP("10.0.0.2"))
+	require.Nil(t, db.PodInfoForIP("10.0.0.2"))
+
+	// THEN the reconciliation fixes the indexes
+	assert.Equal(t, 3, db.reconcile())
+	assert.Nil(t, db.PodInfoForIP("10.0.0.3"))
+	assert.Nil(t, db.ServiceForIP("10.0.0.3", 0))
+	pod := db.PodInfoForIP("10.0.0.2")
+	require.NotNil(t, pod)
+	assert.Equal(t, "db", pod.Name)
+	es := db.ServiceForIP("10.0.0.1", 8080)
+	require.NotNil(t, es)
+	assert.Equal(t, "web", es.ServiceName)
+	// AND the corrections are reported for each index
+	assert.Equal(t, map[string]int{indexPodsByIP: 2, indexServicesByIP: 1}, metrics.get())
+	assert.Zero(t, db.reconcile())
+}
+
+type reconciliationMetrics struct {
+	imetrics.NoopReporter
+	mut         sync.Mutex
+	corrections map[string]int
+}
+
+func (m *reconciliationMetrics) KubeDatabaseReconciliations(index string, corrections int) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.corrections[index] += corrections
+}
+
+func (m *reconciliationMetrics) get() map[string]int {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	return maps.Clone(m.corrections)
+}
+
+type inspectionMetrics struct {
+	imetrics.NoopReporter
+	failures atomic.Int32
+}
+
+func (m *inspectionMetrics) KubeDatabaseInspectionFailure() {
+	m.failures.Add(1)
+}
+
+// failingInspections makes the container inspection of the faked processes fail the first times
+// they are invoked, returning the number of invocations
+func failingInspections(t *testing.T, failures int) func() int {
+	origRetryTime := inspectionRetryTime
+	t.Cleanup(func() { inspectionRetryTime = origRetryTime })
+	inspectionRetryTime = 5 * time.Millisecond
+	mt := sync.Mutex{}
+	calls := 0
+	infoForPID := containerInfoForPID
+	containerInfoForPID = func(pid uint32) (container.Info, error) {
+		mt.Lock()
+		defer mt.Unlock()
+		calls++
+		if calls <= failures {
+			return container.Info{}, errors.New("can't read cgroup")
+		}
+		return infoForPID(pid)
+	}
+	return func() int {
+		mt.Lock()
+		defer mt.Unlock()
+		return calls
+	}
+}
+
+func TestAddProcess_RetryInspection(t *testing.T) {
+	containerIndexed := func(db *Database, cid string) bool {
+		db.cntMut.Lock()
+		defer db.cntMut.Unlock()
+		_, ok := db.containerIDs[cid]
+		return ok
+	}
+	startDB := func(t *testing.T) (*Database, *inspectionMetrics) {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		informer := kube.Metadata{}
+		require.NoError(t, informer.InitFromClient(ctx, fakek8sclientset.NewSimpleClientset(), 30*time.Minute))
+		metrics := &inspectionMetrics{}
+		db, err := StartDatabase(ctx, &informer, metrics, DatabaseConfig{})
+		require.NoError(t, err)
+		return db, metrics
+	}
+
+	t.Run("transient failure", func(t *testing.T) {
+		fakeProcesses(t, map[uint32]fakeProcess{100: {namespace: 7, start: 1000, containerID: "container-a"}})
+		calls := failingInspections(t, 2)
+		db, metrics := startDB(t)
+		// WHEN the container inspection of a new process fails twice
+		db.AddProcess(100)
+		// THEN the process is eventually indexed
+		require.Eventually(t, func() bool {
+			return containerIndexed(db, "container-a")
+		}, 5*time.Second, 5*time.Millisecond)
+		assert.Equal(t, 3, calls())
+		assert.Zero(t, metrics.failures.Load())
+	})
+
+	t.Run("permanent failure", func(t *testing.T) {
+		fakeProcesses(t, map[uint32]fakeProcess{100: {namespace: 7, start: 1000, containerID: "container-a"}})
+		calls := failingInspections(t, 1000)
+		db, metrics := startDB(t)
+		// WHEN the container inspection of a new process always fails
+		db.AddProcess(100)
+		// THEN the inspection is given up after the maximum number of retries
+		require.Eventually(t, func() bool {
+			return metrics.failures.Load() == 1
+		}, 5*time.Second, 5*time.Millisecond)
+		assert.Equal(t, inspectionRetries+1, calls())
+		assert.False(t, containerIndexed(db, "container-a"))
+	})
+
+	t.Run("process ended", func(t *testing.T) {
+		procs := map[uint32]fakeProcess{100: {namespace: 7, start: 1000, containerID: "container-a"}}
+		fakeProcesses(t, procs)
+		calls := failingInspections(t, 1000)
+		startTime := processStartTime
+		ended, checked := atomic.Bool{}, atomic.Bool{}
+		processStartTime = func(pid uint32) (uint64, error) {
+			if ended.Load() {
+				checked.Store(true)
+				return 0, errors.New("no such process")
+			}
+			return startTime(pid)
+		}
+		db, metrics := startDB(t)
+		// WHEN the container inspection of a new process fails
+		db.AddProcess(100)
+		require.Equal(t, 1, calls())
+		// AND the process ends before the inspection is retried
+		ended.Store(true)
+		require.Eventually(t, checked.Load, 5*time.Second, 5*time.Millisecond)
+		time.Sleep(10 * inspectionRetryTime)
+		// THEN the inspection is not retried, neither counted as a failure
+		assert.Equal(t, 1, calls())
+		assert.Zero(t, metrics.failures.Load())
+	})
+}
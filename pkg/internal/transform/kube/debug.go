@@ -0,0 +1,423 @@
+package kube
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/grafana/beyla/pkg/internal/kube"
+)
+
+// DebugPath where the snapshot of the Database indexes is served
+const DebugPath = "/debug/kube/db"
+
+// defaultDebugLimit is the maximum number of entries of each index that are dumped, unless
+// the limit query parameter is provided. It keeps the dumps of large clusters manageable.
+const defaultDebugLimit = 500
+
+// debugPod is the JSON representation of a kube.PodInfo in the debug dumps
+type debugPod struct {
+	Namespace      string            `json:"namespace"`
+	Name           string            `json:"name"`
+	UID            types.UID         `json:"uid"`
+	NodeName       string            `json:"node_name,omitempty"`
+	ServiceAccount string            `json:"service_account,omitempty"`
+	Owners         map[string]string `json:"owners,omitempty"`
+	ContainerIDs   []string          `json:"container_ids,omitempty"`
+	IPs            []string          `json:"ips,omitempty"`
+	HostIPs        []string          `json:"host_ips,omitempty"`
+	HostPorts      []uint16          `json:"host_ports,omitempty"`
+}
+
+// debugService is the JSON representation of a kube.EndpointSliceInfo in the debug dumps
+type debugService struct {
+	Namespace string   `json:"namespace"`
+	Service   string   `json:"service"`
+	Slice     string   `json:"slice"`
+	Headless  bool     `json:"headless,omitempty"`
+	Ports     []uint16 `json:"ports,omitempty"`
+}
+
+type debugNamespace struct {
+	ContainerID string `json:"container_id"`
+	// Current is false for the entries of a previous generation of the inode that are not removed yet
+	Current bool `json:"current"`
+	// Shared is true if the namespace is shared by multiple containers, so its pods are looked up by process
+	Shared bool `json:"shared,omitempty"`
+}
+
+type debugProcess struct {
+	PIDNamespace string `json:"pid_namespace"`
+	ContainerID  string `json:"container_id"`
+}
+
+type debugCachedPod struct {
+	Pod      *debugPod `json:"pod"`
+	CachedAt time.Time `json:"cached_at"`
+	Expired  bool      `json:"expired,omitempty"`
+}
+
+type debugDeletedPod struct {
+	Pod       *debugPod `json:"pod"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+type debugDeletedService struct {
+	debugService
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// debugIndex is a page of the entries of an index, sorted by key, and the total number of entries
+type debugIndex[V any] struct {
+	Total   int          `json:"total"`
+	Entries map[string]V `json:"entries"`
+}
+
+// debugSnapshot is the dump of the Database indexes. The PID namespaces are keyed as inode/generation.
+type debugSnapshot struct {
+	Offset              int                               `json:"offset"`
+	Limit               int                               `json:"limit"`
+	ContainerIDs        debugIndex[string]                `json:"container_ids"`
+	PIDNamespaces       debugIndex[debugNamespace]        `json:"pid_namespaces"`
+	Processes           debugIndex[debugProcess]          `json:"processes"`
+	FetchedPodsCache    debugIndex[debugCachedPod]        `json:"fetched_pods_cache"`
+	PodsByIP            debugIndex[*debugPod]             `json:"pods_by_ip"`
+	PodsByIPPort        debugIndex[*debugPod]             `json:"pods_by_ip_port"`
+	NodeIPs             debugIndex[int]                   `json:"node_ips"`
+	DeletedPodsByIP     debugIndex[debugDeletedPod]       `json:"deleted_pods_by_ip"`
+	ServicesByIP        debugIndex[[]debugService]        `json:"services_by_ip"`
+	DeletedServicesByIP debugIndex[[]debugDeletedService] `json:"deleted_services_by_ip"`
+	UnknownIPs          int                               `json:"unknown_ips"`
+}
+
+// debugStep is the result of each of the lookups that are run to resolve an IP or a PID namespace
+type debugStep struct {
+	Step   string `json:"step"`
+	Found  bool   `json:"found"`
+	Result any    `json:"result,omitempty"`
+}
+
+type debugLookup struct {
+	IP           string      `json:"ip,omitempty"`
+	Port         uint16      `json:"port,omitempty"`
+	PIDNamespace uint32      `json:"pid_namespace,omitempty"`
+	PID          uint32      `json:"pid,omitempty"`
+	Steps        []debugStep `json:"steps"`
+}
+
+// DebugHandler returns the HTTP handler that dumps the Database indexes as JSON. The dump is paginated
+// with the offset and limit query parameters, which apply to each index. If the ip (and, optionally, port)
+// or pid_namespace (and, optionally, pid) query parameters are provided, it runs the same lookups as the decoration does and
+// reports the result of each step instead of dumping the indexes.
+func (id *Database) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		var response any
+		var err error
+		switch {
+		case query.Has("ip"):
+			response, err = id.debugIPLookup(query.Get("ip"), query.Get("port"))
+		case query.Has("pid_namespace"):
+			response, err = id.debugNamespaceLookup(query.Get("pid_namespace"), query.Get("pid"))
+		default:
+			response, err = id.debugSnapshot(query.Get("offset"), query.Get("limit"))
+		}
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(rw)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(response); err != nil {
+			dblog().Debug("can't write debug response", "error", err)
+		}
+	})
+}
+
+func (id *Database) debugSnapshot(offsetStr, limitStr string) (*debugSnapshot, error) {
+	offset, limit := 0, defaultDebugLimit
+	var err error
+	if offsetStr != "" {
+		if offset, err = strconv.Atoi(offsetStr); err != nil || offset < 0 {
+			return nil, fmt.Errorf("invalid offset: %q", offsetStr)
+		}
+	}
+	if limitStr != "" {
+		if limit, err = strconv.Atoi(limitStr); err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid limit: %q", limitStr)
+		}
+	}
+
+	// the indexes are shallowly copied under their locks, and converted after releasing them,
+	// so the informers are not blocked while the dump is built. The pods and slices are never
+	// modified in place, so their pointers can be read without the locks.
+	id.cntMut.Lock()
+	containerIDs := maps.Clone(id.containerIDs)
+	id.cntMut.Unlock()
+
+	id.nsMut.RLock()
+	namespaces := maps.Clone(id.namespaces)
+	generations := maps.Clone(id.generations)
+	processes := maps.Clone(id.processes)
+	sharedNamespaces := maps.Clone(id.sharedNamespaces)
+	id.nsMut.RUnlock()
+
+	id.podsCacheMut.RLock()
+	fetchedPods := maps.Clone(id.fetchedPodsCache)
+	id.podsCacheMut.RUnlock()
+
+	podsByIP := map[string]*kube.PodInfo{}
+	podsByIPPort := map[string]*kube.PodInfo{}
+	hostIPs := map[string]nodeIP{}
+	deletedPods := map[string]deletedPod{}
+	servicesByIP := map[string][]*kube.EndpointSliceInfo{}
+	deletedServices := map[string][]deletedSlice{}
+	for _, sh := range id.ipShards {
+		sh.mut.RLock()
+		maps.Copy(podsByIP, sh.podsByIP)
+		for key, pod := range sh.podsByIPPort {
+			podsByIPPort[ipPortString(key)] = pod
+		}
+		maps.Copy(hostIPs, sh.hostIPs)
+		maps.Copy(deletedPods, sh.deletedPodsByIP)
+		for ip, byUID := range sh.servicesByIP {
+			for _, es := range byUID {
+				servicesByIP[ip] = append(servicesByIP[ip], es)
+			}
+		}
+		for ip, byUID := range sh.deletedServicesByIP {
+			for _, ds := range byUID {
+				deletedServices[ip] = append(deletedServices[ip], ds)
+			}
+		}
+		sh.mut.RUnlock()
+	}
+
+	snap := &debugSnapshot{Offset: offset, Limit: limit}
+	if id.unknownIPs != nil {
+		snap.UnknownIPs = id.unknownIPs.Len()
+	}
+	snap.ContainerIDs = debugPage(containerIDs, offset, limit, pidNamespace.String)
+	pidNamespaces := make(map[string]debugNamespace, len(namespaces))
+	for ns, info := range namespaces {
+		pidNamespaces[ns.String()] = debugNamespace{
+			ContainerID: info.ContainerID,
+			Current:     generations[ns.inode].generation == ns.generation,
+		}
+	}
+	for ns := range sharedNamespaces {
+		if dn, ok := pidNamespaces[ns.String()]; ok {
+			dn.Shared = true
+			pidNamespaces[ns.String()] = dn
+		}
+	}
+	snap.PIDNamespaces = debugPage(pidNamespaces, offset, limit, func(dn debugNamespace) debugNamespace { return dn })
+	snap.Processes = debugPage(mapKeys(processes, func(pid uint32) string { return strconv.Itoa(int(pid)) }), offset, limit,
+		func(pc processContainer) debugProcess {
+			return debugProcess{PIDNamespace: pc.ns.String(), ContainerID: pc.containerID}
+		})
+	snap.FetchedPodsCache = debugPage(mapKeys(fetchedPods, pidNamespace.String), offset, limit,
+		func(cp cachedPod) debugCachedPod {
+			return debugCachedPod{Pod: toDebugPod(cp.pod), CachedAt: cp.cachedAt, Expired: id.expired(cp)}
+		})
+	snap.PodsByIP = debugPage(podsByIP, offset, limit, toDebugPod)
+	snap.PodsByIPPort = debugPage(podsByIPPort, offset, limit, toDebugPod)
+	snap.NodeIPs = debugPage(hostIPs, offset, limit, func(hip nodeIP) int { return hip.ports })
+	snap.DeletedPodsByIP = debugPage(deletedPods, offset, limit, func(dp deletedPod) debugDeletedPod {
+		return debugDeletedPod{Pod: toDebugPod(dp.pod), DeletedAt: dp.deletedAt}
+	})
+	snap.ServicesByIP = debugPage(servicesByIP, offset, limit, func(ess []*kube.EndpointSliceInfo) []debugService {
+		out := make([]debugService, 0, len(ess))
+		for _, es := range ess {
+			out = append(out, toDebugService(es))
+		}
+		return sortedServices(out, func(ds debugService) debugService { return ds })
+	})
+	snap.DeletedServicesByIP = debugPage(deletedServices, offset, limit, func(dss []deletedSlice) []debugDeletedService {
+		out := make([]debugDeletedService, 0, len(dss))
+		for _, ds := range dss {
+			out = append(out, debugDeletedService{debugService: toDebugService(ds.slice), DeletedAt: ds.deletedAt})
+		}
+		return sortedServices(out, func(ds debugDeletedService) debugService { return ds.debugService })
+	})
+	return snap, nil
+}
+
+// debugIPLookup runs the same lookups as the name resolution of the span peers, without
+// remembering the IP as unknown if it is not found
+func (id *Database) debugIPLookup(ip, portStr string) (*debugLookup, error) {
+	var port uint16
+	if portStr != "" {
+		p, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port: %q", portStr)
+		}
+		port = uint16(p)
+	}
+	lookup := &debugLookup{IP: ip, Port: port}
+	normalized := kube.NormalizeIP(ip)
+	lookup.Steps = append(lookup.Steps,
+		debugStep{Step: "NormalizeIP", Found: true, Result: normalized},
+		debugStep{Step: "IsUnknownIP", Found: id.IsUnknownIP(normalized)})
+	if port != 0 {
+		step := debugStep{Step: "ServiceForIP"}
+		if es := id.ServiceForIP(normalized, port); es != nil {
+			step.Found, step.Result = true, toDebugService(es)
+		}
+		lookup.Steps = append(lookup.Steps, step)
+	}
+	step := debugStep{Step: "PodInfoForIPPort"}
+	if pod := id.PodInfoForIPPort(normalized, port); pod != nil {
+		step.Found, step.Result = true, toDebugPod(pod)
+	}
+	lookup.Steps = append(lookup.Steps, step)
+	return lookup, nil
+}
+
+// debugNamespaceLookup runs, one by one, the lookups of OwnerPodInfo, and finally OwnerPodInfo itself
+func (id *Database) debugNamespaceLookup(nsStr, pidStr string) (*debugLookup, error) {
+	inode, err := strconv.ParseUint(nsStr, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pid_namespace: %q", nsStr)
+	}
+	var pid uint64
+	if pidStr != "" {
+		if pid, err = strconv.ParseUint(pidStr, 10, 32); err != nil {
+			return nil, fmt.Errorf("invalid pid: %q", pidStr)
+		}
+	}
+	lookup := &debugLookup{PIDNamespace: uint32(inode), PID: uint32(pid)}
+	ns, ok := id.currentNamespace(uint32(inode))
+	lookup.Steps = append(lookup.Steps, debugStep{Step: "currentNamespace", Found: ok, Result: ns.String()})
+	if containerID, shared := id.sharedContainerID(ns, uint32(pid)); ok && shared {
+		// the pods of the shared namespaces are looked up by the container of the process
+		lookup.Steps = append(lookup.Steps, debugStep{Step: "processes", Found: containerID != "", Result: containerID})
+		if containerID != "" && id.informer != nil {
+			step := debugStep{Step: "GetContainerPod"}
+			if pod, ok := id.informer.GetContainerPod(containerID); ok {
+				step.Found, step.Result = true, toDebugPod(pod)
+			}
+			lookup.Steps = append(lookup.Steps, step)
+		}
+	} else if ok {
+		id.podsCacheMut.RLock()
+		entry, cached := id.fetchedPodsCache[ns]
+		id.podsCacheMut.RUnlock()
+		step := debugStep{Step: "fetchedPodsCache", Found: cached}
+		if cached {
+			step.Result = debugCachedPod{Pod: toDebugPod(entry.pod), CachedAt: entry.cachedAt, Expired: id.expired(entry)}
+		}
+		lookup.Steps = append(lookup.Steps, step)
+
+		id.nsMut.RLock()
+		info, found := id.namespaces[ns]
+		id.nsMut.RUnlock()
+		step = debugStep{Step: "namespaces", Found: found}
+		if found {
+			step.Result = debugNamespace{ContainerID: info.ContainerID, Current: true}
+		}
+		lookup.Steps = append(lookup.Steps, step)
+
+		if found && id.informer != nil {
+			step = debugStep{Step: "GetContainerPod"}
+			if pod, ok := id.informer.GetContainerPod(info.ContainerID); ok {
+				step.Found, step.Result = true, toDebugPod(pod)
+			}
+			lookup.Steps = append(lookup.Steps, step)
+		}
+	}
+	step := debugStep{Step: "OwnerPodInfo"}
+	if pod, ok := id.OwnerPodInfo(uint32(inode), uint32(pid)); ok {
+		step.Found, step.Result = true, toDebugPod(pod)
+	}
+	lookup.Steps = append(lookup.Steps, step)
+	return lookup, nil
+}
+
+func (ns pidNamespace) String() string {
+	return fmt.Sprintf("%d/%d", ns.inode, ns.generation)
+}
+
+func ipPortString(key ipPortKey) string {
+	return key.ip + ":" + strconv.Itoa(int(key.port))
+}
+
+// mapKeys converts the keys of the map to strings
+func mapKeys[K comparable, V any](in map[K]V, key func(K) string) map[string]V {
+	out := make(map[string]V, len(in))
+	for k, v := range in {
+		out[key(k)] = v
+	}
+	return out
+}
+
+// debugPage converts the entries whose sorted keys are in the [offset, offset+limit) range
+func debugPage[V, D any](entries map[string]V, offset, limit int, convert func(V) D) debugIndex[D] {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	page := debugIndex[D]{Total: len(keys), Entries: map[string]D{}}
+	if offset >= len(keys) {
+		return page
+	}
+	for _, key := range keys[offset:min(offset+limit, len(keys))] {
+		page.Entries[key] = convert(entries[key])
+	}
+	return page
+}
+
+// sortedServices sorts the services of the same IP, so successive dumps are comparable
+func sortedServices[S any](services []S, svc func(S) debugService) []S {
+	slices.SortFunc(services, func(a, b S) int {
+		sa, sb := svc(a), svc(b)
+		if sa.Namespace != sb.Namespace {
+			return cmp.Compare(sa.Namespace, sb.Namespace)
+		}
+		return cmp.Compare(sa.Slice, sb.Slice)
+	})
+	return services
+}
+
+func toDebugPod(pod *kube.PodInfo) *debugPod {
+	if pod == nil {
+		return nil
+	}
+	dp := &debugPod{
+		Namespace:      pod.Namespace,
+		Name:           pod.Name,
+		UID:            pod.UID,
+		NodeName:       pod.NodeName,
+		ServiceAccount: pod.ServiceAccount,
+		ContainerIDs:   pod.ContainerIDs,
+		IPs:            pod.IPs,
+		HostIPs:        pod.HostIPs,
+		HostPorts:      pod.HostPorts,
+	}
+	for owner := pod.Owner; owner != nil; owner = owner.Owner {
+		if dp.Owners == nil {
+			dp.Owners = map[string]string{}
+		}
+		dp.Owners[string(owner.Type.LabelName())] = owner.Name
+	}
+	return dp
+}
+
+func toDebugService(es *kube.EndpointSliceInfo) debugService {
+	return debugService{
+		Namespace: es.Namespace,
+		Service:   es.ServiceName,
+		Slice:     es.Name,
+		Headless:  es.Headless,
+		Ports:     es.Ports,
+	}
+}
@@ -0,0 +1,156 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakek8sclientset "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+	"github.com/grafana/beyla/pkg/internal/kube"
+)
+
+func debugGet(t *testing.T, db *Database, query string, response any) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	db.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, DebugPath+query, nil))
+	if rec.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), response))
+	}
+	return rec.Code
+}
+
+func TestDebugHandler_Snapshot(t *testing.T) {
+	db := CreateDatabase(nil)
+	// GIVEN a database with some pods and Services
+	owner := &kube.Owner{Type: kube.OwnerReplicaSet, Name: "web-123", Owner: &kube.Owner{Type: kube.OwnerDeployment, Name: "web"}}
+	for name, ip := range map[string]string{"pod-a": "10.244.0.1", "pod-b": "10.244.0.2", "pod-c": "10.244.0.3"} {
+		db.UpdateNewPodsByIPIndex(&kube.PodInfo{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "shop"},
+			Owner:      owner,
+			IPs:        []string{ip},
+		})
+	}
+	db.UpdateNewServicesByIPIndex(slice("s1", "shop", "web", []uint16{8080}, "10.244.0.1"))
+	db.UpdateNewServicesByIPIndex(slice("s2", "shop", "all", nil, "10.244.0.1"))
+
+	// WHEN the whole database is dumped
+	snap := debugSnapshot{}
+	require.Equal(t, http.StatusOK, debugGet(t, &db, "", &snap))
+	// THEN all the entries are reported
+	assert.Equal(t, 3, snap.PodsByIP.Total)
+	require.Len(t, snap.PodsByIP.Entries, 3)
+	pod := snap.PodsByIP.Entries["10.244.0.2"]
+	require.NotNil(t, pod)
+	assert.Equal(t, "pod-b", pod.Name)
+	assert.Equal(t, map[string]string{"k8s.replicaset.name": "web-123", "k8s.deployment.name": "web"}, pod.Owners)
+	services := snap.ServicesByIP.Entries["10.244.0.1"]
+	require.Len(t, services, 2)
+	assert.Equal(t, "all-s2", services[0].Slice)
+	assert.Equal(t, "web-s1", services[1].Slice)
+
+	// AND WHEN the dump is paginated
+	snap = debugSnapshot{}
+	require.Equal(t, http.StatusOK, debugGet(t, &db, "?offset=1&limit=1", &snap))
+	// THEN only the requested page of each index is reported, sorted by key
+	assert.Equal(t, 3, snap.PodsByIP.Total)
+	require.Len(t, snap.PodsByIP.Entries, 1)
+	assert.Equal(t, "pod-b", snap.PodsByIP.Entries["10.244.0.2"].Name)
+	assert.Equal(t, 1, snap.ServicesByIP.Total)
+	assert.Empty(t, snap.ServicesByIP.Entries)
+
+	// AND the invalid pagination is rejected
+	assert.Equal(t, http.StatusBadRequest, debugGet(t, &db, "?limit=0", &snap))
+	assert.Equal(t, http.StatusBadRequest, debugGet(t, &db, "?offset=-1", &snap))
+}
+
+func TestDebugHandler_IPLookup(t *testing.T) {
+	db := CreateDatabase(nil)
+	db.UpdateNewPodsByIPIndex(&kube.PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "shop"},
+		IPs:        []string{"10.244.0.5"},
+	})
+	db.UpdateNewServicesByIPIndex(slice("s1", "shop", "web", []uint16{8080}, "10.244.0.5"))
+
+	// WHEN an IP is looked up by a port that is exposed by a Service
+	lookup := debugLookup{}
+	require.Equal(t, http.StatusOK, debugGet(t, &db, "?ip=::ffff:10.244.0.5&port=8080", &lookup))
+	// THEN all the steps of the name resolution are reported
+	require.Len(t, lookup.Steps, 4)
+	assert.Equal(t, "NormalizeIP", lookup.Steps[0].Step)
+	assert.Equal(t, "10.244.0.5", lookup.Steps[0].Result)
+	assert.Equal(t, "IsUnknownIP", lookup.Steps[1].Step)
+	assert.False(t, lookup.Steps[1].Found)
+	assert.Equal(t, "ServiceForIP", lookup.Steps[2].Step)
+	assert.True(t, lookup.Steps[2].Found)
+	assert.Equal(t, "PodInfoForIPPort", lookup.Steps[3].Step)
+	assert.True(t, lookup.Steps[3].Found)
+
+	// AND an IP that is not known is not found
+	lookup = debugLookup{}
+	require.Equal(t, http.StatusOK, debugGet(t, &db, "?ip=1.2.3.4", &lookup))
+	require.Len(t, lookup.Steps, 3)
+	assert.False(t, lookup.Steps[2].Found)
+
+	assert.Equal(t, http.StatusBadRequest, debugGet(t, &db, "?ip=1.2.3.4&port=foo", &lookup))
+}
+
+func TestDebugHandler_PIDNamespaceLookup(t *testing.T) {
+	// GIVEN a database connected to the Kubernetes informers
+	client := fakek8sclientset.NewSimpleClientset()
+	informer := kube.Metadata{}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	db, err := StartDatabase(context.TODO(), &informer, imetrics.NoopReporter{}, DatabaseConfig{})
+	require.NoError(t, err)
+	_, err = client.CoreV1().Pods("the-ns").Create(context.Background(), &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "the-pod", Namespace: "the-ns", UID: "the-uid"},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+			{ContainerID: "containerd://container-a", Name: "a"},
+		}},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	// AND a process running in the container of the pod
+	fakeProcesses(t, map[uint32]fakeProcess{100: {namespace: 7, start: 1000, containerID: "container-a"}})
+	db.AddProcess(100)
+
+	// WHEN its PID namespace is looked up
+	lookup := debugLookup{}
+	require.Eventually(t, func() bool {
+		lookup = debugLookup{}
+		debugGet(t, db, "?pid_namespace=7", &lookup)
+		return len(lookup.Steps) > 0 && lookup.Steps[len(lookup.Steps)-1].Found
+	}, 5*time.Second, 10*time.Millisecond)
+	// THEN all the steps of the pod lookup are reported
+	steps := map[string]debugStep{}
+	for _, step := range lookup.Steps {
+		steps[step.Step] = step
+	}
+	assert.Equal(t, "7/1000", steps["currentNamespace"].Result)
+	assert.True(t, steps["namespaces"].Found)
+	assert.True(t, steps["GetContainerPod"].Found)
+	assert.True(t, steps["OwnerPodInfo"].Found)
+
+	// AND the pod is cached afterwards
+	snap := debugSnapshot{}
+	require.Equal(t, http.StatusOK, debugGet(t, db, "", &snap))
+	require.Contains(t, snap.FetchedPodsCache.Entries, "7/1000")
+	assert.Equal(t, "the-pod", snap.FetchedPodsCache.Entries["7/1000"].Pod.Name)
+	assert.Equal(t, "7/1000", snap.ContainerIDs.Entries["container-a"])
+	assert.Equal(t, debugNamespace{ContainerID: "container-a", Current: true}, snap.PIDNamespaces.Entries["7/1000"])
+
+	// AND an unknown PID namespace is not found
+	lookup = debugLookup{}
+	require.Equal(t, http.StatusOK, debugGet(t, db, "?pid_namespace=8", &lookup))
+	require.Len(t, lookup.Steps, 2)
+	assert.False(t, lookup.Steps[0].Found)
+	assert.False(t, lookup.Steps[1].Found)
+}
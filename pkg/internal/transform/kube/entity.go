@@ -0,0 +1,117 @@
+package kube
+
+import (
+	"github.com/grafana/beyla/pkg/internal/kube"
+)
+
+// EntityKind is the kind of the Kubernetes object that has an IP
+type EntityKind uint8
+
+const (
+	EntityPod EntityKind = iota + 1
+	EntityService
+	EntityNode
+)
+
+func (k EntityKind) String() string {
+	switch k {
+	case EntityPod:
+		return "Pod"
+	case EntityService:
+		return "Service"
+	case EntityNode:
+		return "Node"
+	default:
+		return "Unknown"
+	}
+}
+
+// Entity is the Kubernetes object that is found by EntityForIP
+type Entity struct {
+	Kind      EntityKind
+	Name      string
+	Namespace string
+	// OwnerName and OwnerKind are the top-level workload of a Pod (Deployment, StatefulSet...), or the
+	// Pod itself if it has no owner. They are empty for the Services and the Nodes.
+	OwnerName string
+	OwnerKind string
+	// NodeName is the node that runs the Pod, or the name of the Node
+	NodeName string
+	// Excluded is true if the namespace of the Pod or Service is excluded from the decoration, so
+	// the Entity only contains its namespace
+	Excluded bool
+
+	// Pod and Service are the objects that matched the IP, for the callers that need more attributes
+	Pod     *kube.PodInfo
+	Service *kube.EndpointSliceInfo
+}
+
+// EntityForIP returns the Kubernetes object with the provided IP address. The Pods are preferred,
+// including the ones that had the IP during the deleted pods grace period, then the Services whose
+// endpoints have the IP, as in ServiceForIP, and finally the Nodes. The IP of a Node is only known
+// if it runs hostNetwork or hostPort Pods.
+// The namespace filter is applied as in OwnerPodInfo.
+func (id *Database) EntityForIP(ip string) (Entity, bool) {
+	ip = kube.NormalizeIP(ip)
+	sh := id.shard(ip)
+	sh.mut.RLock()
+	pod, podOK := id.podForIP(sh, ip)
+	var es *kube.EndpointSliceInfo
+	var node nodeIP
+	nodeOK := false
+	if !podOK {
+		if es = id.serviceForIP(sh, ip, 0); es == nil {
+			node, nodeOK = sh.hostIPs[ip]
+		}
+	}
+	sh.mut.RUnlock()
+	id.metrics.KubeDatabaseLookup(indexPodsByIP, podOK)
+	if !podOK {
+		id.metrics.KubeDatabaseLookup(indexServicesByIP, es != nil)
+	}
+	switch {
+	case podOK:
+		return podEntity(id.decoratedPod(pod))
+	case es != nil:
+		return serviceEntity(id.decoratedSlice(es))
+	case nodeOK:
+		return Entity{Kind: EntityNode, Name: node.node, NodeName: node.node}, true
+	}
+	return Entity{}, false
+}
+
+func podEntity(pod *kube.PodInfo) (Entity, bool) {
+	if pod == nil {
+		return Entity{}, false
+	}
+	entity := Entity{
+		Kind:      EntityPod,
+		Name:      pod.Name,
+		Namespace: pod.Namespace,
+		NodeName:  pod.NodeName,
+		Excluded:  pod.Excluded,
+		Pod:       pod,
+	}
+	if pod.Excluded {
+		return entity, true
+	}
+	if owner := pod.TopOwner(); owner != nil {
+		entity.OwnerName, entity.OwnerKind = owner.Name, owner.Type.Kind()
+	} else {
+		entity.OwnerName, entity.OwnerKind = pod.Name, EntityPod.String()
+	}
+	return entity, true
+}
+
+func serviceEntity(es *kube.EndpointSliceInfo) (Entity, bool) {
+	if es == nil {
+		return Entity{}, false
+	}
+	return Entity{
+		Kind:      EntityService,
+		Name:      es.ServiceName,
+		Namespace: es.Namespace,
+		Excluded:  es.Excluded,
+		Service:   es,
+	}, true
+}
@@ -0,0 +1,147 @@
+package kube
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/grafana/beyla/pkg/internal/kube"
+)
+
+func TestEntityForIP_Pod(t *testing.T) {
+	db := CreateDatabase(nil)
+	// GIVEN a pod owned by a Deployment, whose IP is also the endpoint of a Service
+	pod := &kube.PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-7d4b9-x2x4z", Namespace: "shop", UID: "pod-1"},
+		NodeName:   "node-1",
+		IPs:        []string{"10.244.0.5"},
+		Owner: &kube.Owner{Type: kube.OwnerReplicaSet, Name: "web-7d4b9",
+			Owner: &kube.Owner{Type: kube.OwnerDeployment, Name: "web"}},
+	}
+	db.UpdateNewPodsByIPIndex(pod)
+	db.UpdateNewServicesByIPIndex(slice("a", "shop", "web", []uint16{8080}, "10.244.0.5"))
+
+	// WHEN its IP is looked up
+	entity, ok := db.EntityForIP("10.244.0.5")
+
+	// THEN the pod is preferred over the Service, and it is owned by the top-level workload
+	require.True(t, ok)
+	assert.Equal(t, Entity{
+		Kind:      EntityPod,
+		Name:      "web-7d4b9-x2x4z",
+		Namespace: "shop",
+		OwnerName: "web",
+		OwnerKind: "Deployment",
+		NodeName:  "node-1",
+		Pod:       pod,
+	}, entity)
+}
+
+func TestEntityForIP_PodWithoutOwner(t *testing.T) {
+	db := CreateDatabase(nil)
+	pod := &kube.PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "debug", Namespace: "default", UID: "pod-1"},
+		NodeName:   "node-1",
+		IPs:        []string{"10.244.0.7"},
+	}
+	db.UpdateNewPodsByIPIndex(pod)
+
+	entity, ok := db.EntityForIP("10.244.0.7")
+	require.True(t, ok)
+	assert.Equal(t, EntityPod, entity.Kind)
+	// the pod is its own owner
+	assert.Equal(t, "debug", entity.OwnerName)
+	assert.Equal(t, "Pod", entity.OwnerKind)
+}
+
+func TestEntityForIP_Service(t *testing.T) {
+	db := CreateDatabase(nil)
+	// GIVEN a Service endpoint whose IP does not belong to any known pod
+	db.UpdateNewServicesByIPIndex(slice("a", "shop", "web", []uint16{8080}, "10.244.0.5"))
+	db.UpdateNewServicesByIPIndex(slice("b", "shop", "admin", []uint16{9090}, "10.244.0.5"))
+
+	entity, ok := db.EntityForIP("10.244.0.5")
+
+	// THEN the Service is returned, with the same precedence as ServiceForIP
+	require.True(t, ok)
+	assert.Equal(t, EntityService, entity.Kind)
+	assert.Equal(t, "admin", entity.Name)
+	assert.Equal(t, "shop", entity.Namespace)
+	assert.Empty(t, entity.OwnerName)
+	assert.Same(t, db.ServiceForIP("10.244.0.5", 0), entity.Service)
+}
+
+func TestEntityForIP_Node(t *testing.T) {
+	db := CreateDatabase(nil)
+	// GIVEN a hostNetwork pod, whose IP is the IP of its node
+	db.UpdateNewPodsByIPIndex(&kube.PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-exporter", Namespace: "monitoring", UID: "pod-1"},
+		NodeName:   "node-1",
+		HostIPs:    []string{"192.168.1.10"},
+		HostPorts:  []uint16{9100},
+	})
+
+	// WHEN the node IP is looked up
+	entity, ok := db.EntityForIP("192.168.1.10")
+
+	// THEN the Node is returned
+	require.True(t, ok)
+	assert.Equal(t, Entity{Kind: EntityNode, Name: "node-1", NodeName: "node-1"}, entity)
+
+	// AND WHEN the pod is deleted
+	db.UpdateDeletedPodsByIPIndex(&kube.PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-exporter", Namespace: "monitoring", UID: "pod-1"},
+		NodeName:   "node-1",
+		HostIPs:    []string{"192.168.1.10"},
+		HostPorts:  []uint16{9100},
+	})
+	// THEN the node IP is not known anymore
+	_, ok = db.EntityForIP("192.168.1.10")
+	assert.False(t, ok)
+}
+
+func TestEntityForIP_NotFound(t *testing.T) {
+	db := CreateDatabase(nil)
+	db.UpdateNewPodsByIPIndex(&kube.PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop", UID: "pod-1"},
+		IPs:        []string{"10.244.0.5"},
+	})
+
+	entity, ok := db.EntityForIP("8.8.8.8")
+	assert.False(t, ok)
+	assert.Equal(t, Entity{}, entity)
+}
+
+func TestEntityForIP_Excluded(t *testing.T) {
+	// GIVEN a pod and a Service endpoint in an excluded namespace
+	pod := &kube.PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "kube-system", UID: "pod-1"},
+		IPs:        []string{"10.244.0.5"},
+		Owner:      &kube.Owner{Type: kube.OwnerDaemonSet, Name: "web"},
+	}
+	pod.Exclude()
+	es := slice("a", "kube-system", "dns", nil, "10.244.0.9")
+	es.Exclude()
+
+	// WHEN the excluded objects are not decorated
+	db := CreateDatabase(nil)
+	db.UpdateNewPodsByIPIndex(pod)
+	db.UpdateNewServicesByIPIndex(es)
+	// THEN their IPs are not found
+	_, ok := db.EntityForIP("10.244.0.5")
+	assert.False(t, ok)
+	_, ok = db.EntityForIP("10.244.0.9")
+	assert.False(t, ok)
+
+	// AND WHEN they are decorated only with their namespace
+	db.namespaceOnlyExcluded = true
+	// THEN only their kind and namespace are returned
+	entity, ok := db.EntityForIP("10.244.0.5")
+	require.True(t, ok)
+	assert.Equal(t, Entity{Kind: EntityPod, Namespace: "kube-system", Excluded: true, Pod: pod.NamespaceOnly()}, entity)
+	entity, ok = db.EntityForIP("10.244.0.9")
+	require.True(t, ok)
+	assert.Equal(t, Entity{Kind: EntityService, Namespace: "kube-system", Excluded: true, Service: es.NamespaceOnly()}, entity)
+}
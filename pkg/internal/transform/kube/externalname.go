@@ -0,0 +1,177 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/grafana/beyla/pkg/internal/kube"
+)
+
+// injectable function for testing. The resolver doesn't expose the TTL of the DNS records, so the
+// hostnames are resolved again after a fixed period, regardless of their TTL.
+var lookupExternalName = net.DefaultResolver.LookupHost
+
+// externalNameLookupTimeout is the maximum time that a hostname of an ExternalName Service is being resolved
+const externalNameLookupTimeout = 5 * time.Second
+
+// externalName is an ExternalName Service whose hostname is periodically resolved, so the traffic
+// to the resolved IPs is attributed to the Service
+type externalName struct {
+	svc *kube.ServiceInfo
+	// indexed is the entry of the services index for the last resolved IPs. Nil if the hostname has
+	// not been resolved yet, or it does not resolve to any IP.
+	indexed *kube.EndpointSliceInfo
+	// resolved is false until the first resolution of the current hostname is attempted
+	resolved bool
+}
+
+// OnExternalNameService updates the ExternalName Service, whose hostname is resolved in background.
+// The Services of any other type are forgotten, in case they were previously of ExternalName type.
+func (id *Database) OnExternalNameService(svc *kube.ServiceInfo) {
+	if svc.ExternalName == "" {
+		id.OnExternalNameServiceDeletion(svc)
+		return
+	}
+	id.externalNamesMut.Lock()
+	defer id.externalNamesMut.Unlock()
+	en, ok := id.externalNames[svc.UID]
+	if !ok {
+		id.externalNames[svc.UID] = &externalName{svc: svc}
+		id.wakeExternalNames()
+		return
+	}
+	previous := en.svc
+	en.svc = svc
+	if previous.ExternalName != svc.ExternalName {
+		// the IPs of the former hostname don't belong to the Service anymore
+		id.reindexExternalName(en, nil)
+		en.resolved = false
+		id.wakeExternalNames()
+	}
+}
+
+// OnExternalNameServiceDeletion removes the resolved IPs of the Service from the services index
+func (id *Database) OnExternalNameServiceDeletion(svc *kube.ServiceInfo) {
+	id.externalNamesMut.Lock()
+	defer id.externalNamesMut.Unlock()
+	if en, ok := id.externalNames[svc.UID]; ok {
+		id.reindexExternalName(en, nil)
+		delete(id.externalNames, svc.UID)
+	}
+}
+
+// wakeExternalNames makes the resolution loop resolve the hostnames that have not been resolved yet,
+// without waiting for the next refresh
+func (id *Database) wakeExternalNames() {
+	select {
+	case id.externalNamesWake <- struct{}{}:
+	default:
+	}
+}
+
+// resolveExternalNamesLoop resolves the hostnames of the ExternalName Services when they are added or
+// changed, and then every refresh period, so the services index follows the changes of their DNS records
+func (id *Database) resolveExternalNamesLoop(ctx context.Context) {
+	ticker := time.NewTicker(id.externalNamesRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-id.externalNamesWake:
+			id.resolveExternalNames(ctx, false)
+		case <-ticker.C:
+			id.resolveExternalNames(ctx, true)
+		}
+	}
+}
+
+// resolveExternalNames resolves the hostnames of all the ExternalName Services, or only of the
+// ones that have not been resolved yet, and reindexes the Services whose IPs changed
+func (id *Database) resolveExternalNames(ctx context.Context, all bool) {
+	id.externalNamesMut.Lock()
+	var pending []*kube.ServiceInfo
+	for _, en := range id.externalNames {
+		if all || !en.resolved {
+			pending = append(pending, en.svc)
+		}
+	}
+	id.externalNamesMut.Unlock()
+
+	// the lookups are done without holding the lock, so the informer handlers are not blocked
+	// by slow DNS servers
+	for _, svc := range pending {
+		ips, err := id.lookupExternalName(ctx, svc.ExternalName)
+		if err != nil {
+			var dnsErr *net.DNSError
+			if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+				// temporary failures keep the IPs from the last resolution
+				dblog().Debug("can't resolve the hostname of an ExternalName Service",
+					"namespace", svc.Namespace, "name", svc.Name, "externalName", svc.ExternalName, "error", err)
+				id.externalNamesMut.Lock()
+				if en, ok := id.externalNames[svc.UID]; ok && en.svc == svc {
+					en.resolved = true
+				}
+				id.externalNamesMut.Unlock()
+				continue
+			}
+			ips = nil
+		}
+		id.externalNamesMut.Lock()
+		// the Service might have been updated or deleted during the lookup
+		if en, ok := id.externalNames[svc.UID]; ok && en.svc == svc && !id.stopped.Load() {
+			en.resolved = true
+			id.reindexExternalName(en, ips)
+		}
+		id.externalNamesMut.Unlock()
+	}
+}
+
+func (id *Database) lookupExternalName(ctx context.Context, hostname string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, externalNameLookupTimeout)
+	defer cancel()
+	return id.lookupHost(ctx, hostname)
+}
+
+// reindexExternalName replaces the IPs of the ExternalName Service in the services index. The entry
+// does not restrict the ports, as the ports of an ExternalName Service don't limit how its clients
+// connect to the external host. It must be invoked with the externalNamesMut lock held.
+func (id *Database) reindexExternalName(en *externalName, ips []string) {
+	var normalized []string
+	for _, ip := range ips {
+		normalized = append(normalized, kube.NormalizeIP(ip))
+	}
+	slices.Sort(normalized)
+	normalized = slices.Compact(normalized)
+	if en.indexed != nil && slices.Equal(en.indexed.IPs, normalized) {
+		return
+	}
+	var indexed *kube.EndpointSliceInfo
+	if len(normalized) > 0 {
+		indexed = &kube.EndpointSliceInfo{
+			ObjectMeta:  en.svc.ObjectMeta,
+			ServiceName: en.svc.Name,
+			IPs:         normalized,
+		}
+		if en.svc.Excluded {
+			indexed.Exclude()
+		}
+	}
+	if en.indexed == nil && indexed == nil {
+		return
+	}
+	id.reindexSlice(en.indexed, indexed)
+	en.indexed = indexed
+}
+
+// clearExternalNames forgets the ExternalName Services. The services index is cleared separately.
+func (id *Database) clearExternalNames() {
+	id.externalNamesMut.Lock()
+	id.externalNames = map[types.UID]*externalName{}
+	id.externalNamesMut.Unlock()
+}
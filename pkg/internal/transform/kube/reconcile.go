@@ -0,0 +1,279 @@
+package kube
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/grafana/beyla/pkg/internal/kube"
+)
+
+// relistCheckPeriod is the period at which the Database checks whether the informers listed their
+// objects again after a watch failure
+var relistCheckPeriod = 5 * time.Second
+
+// reconcileLoop reconciles the IP indexes with the informers after they list their objects again, as the
+// objects that were deleted while their watch was failing are not always notified, and on each resync
+// of the informers, in case any event was missed for another reason
+func (id *Database) reconcileLoop(ctx context.Context, relistCheck, resync time.Duration) {
+	check := time.NewTicker(relistCheck)
+	defer check.Stop()
+	var resyncs <-chan time.Time
+	if resync > 0 {
+		ticker := time.NewTicker(resync)
+		defer ticker.Stop()
+		resyncs = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-check.C:
+			if id.informer.Relisted() {
+				dblog().Info("kubernetes informers listed the objects again after a watch failure. Reconciling")
+				id.reconcile()
+			}
+		case <-resyncs:
+			id.reconcile()
+		}
+	}
+}
+
+// reconcile removes from the IP indexes the pods and Services that don't exist anymore in the informers,
+// updates the outdated ones and adds the missing ones. It returns the number of corrections.
+func (id *Database) reconcile() int {
+	if id.stopped.Load() {
+		return 0
+	}
+	corrections := id.reconcilePods()
+	corrections[indexServicesByIP] = id.reconcileSlices() + id.reconcileExternalNames()
+	corrections[indexServicesBySelector] = id.reconcileSelectors()
+	total := 0
+	for index, count := range corrections {
+		if count > 0 {
+			dblog().Debug("reconciled index with the informers", "index", index, "corrections", count)
+			id.metrics.KubeDatabaseReconciliations(index, count)
+			total += count
+		}
+	}
+	return total
+}
+
+// podIndex returns the index where the corrections of a pod are accounted. The hostNetwork pods
+// are only indexed by IP and port.
+func podIndex(pod *kube.PodInfo) string {
+	if len(pod.IPs) == 0 && len(pod.HostPorts) > 0 {
+		return indexPodsByIPPort
+	}
+	return indexPodsByIP
+}
+
+// reconcilePods returns the number of corrected pods, by index
+func (id *Database) reconcilePods() map[string]int {
+	live := map[types.UID]*kube.PodInfo{}
+	for _, pod := range id.informer.ListPods() {
+		live[pod.UID] = pod
+	}
+	// indexed pods that don't exist anymore, and indexed pods whose informer version is newer. The
+	// updates that didn't change the stored fields are not reindexed, so their entries are still valid.
+	stale := map[types.UID]*kube.PodInfo{}
+	outdated := map[types.UID]*kube.PodInfo{}
+	check := func(pod *kube.PodInfo) {
+		if current, ok := live[pod.UID]; !ok {
+			stale[pod.UID] = pod
+		} else if current != pod && (!sameAddresses(current, pod) || !samePodInfo(current, pod)) {
+			outdated[pod.UID] = pod
+		}
+	}
+	for _, sh := range id.ipShards {
+		sh.mut.RLock()
+		for _, pod := range sh.podsByIP {
+			check(pod)
+		}
+		for _, pod := range sh.podsByIPPort {
+			check(pod)
+		}
+		sh.mut.RUnlock()
+	}
+	corrections := map[string]int{}
+	for _, pod := range stale {
+		id.reindexPod(pod, nil)
+		corrections[podIndex(pod)]++
+	}
+	for uid, pod := range outdated {
+		id.reindexPod(pod, live[uid])
+		corrections[podIndex(pod)]++
+	}
+	for uid, pod := range live {
+		if _, ok := outdated[uid]; ok {
+			continue
+		}
+		if id.podMissing(pod) {
+			id.reindexPod(nil, pod)
+			corrections[podIndex(pod)]++
+		}
+	}
+	return corrections
+}
+
+// podMissing returns whether any IP or host port of the pod is not indexed. The entries that are indexed
+// for another pod are not considered missing, as the Database already decided which pod owns them.
+func (id *Database) podMissing(pod *kube.PodInfo) bool {
+	for _, ip := range pod.IPs {
+		sh := id.shard(ip)
+		sh.mut.RLock()
+		_, ok := sh.podsByIP[ip]
+		sh.mut.RUnlock()
+		if !ok {
+			return true
+		}
+	}
+	if len(pod.HostPorts) == 0 {
+		return false
+	}
+	for _, ip := range pod.HostIPs {
+		sh := id.shard(ip)
+		sh.mut.RLock()
+		for _, port := range pod.HostPorts {
+			if _, ok := sh.podsByIPPort[ipPortKey{ip: ip, port: port}]; !ok {
+				sh.mut.RUnlock()
+				return true
+			}
+		}
+		sh.mut.RUnlock()
+	}
+	return false
+}
+
+// reconcileSlices returns the number of corrected EndpointSlices in the services index
+func (id *Database) reconcileSlices() int {
+	live := map[types.UID]*kube.EndpointSliceInfo{}
+	for _, es := range id.informer.ListEndpointSlices() {
+		// the slices that are not owned by a Service are not indexed
+		if es.ServiceName != "" {
+			live[es.UID] = es
+		}
+	}
+	// the entries of the ExternalName Services are not EndpointSlices, and are reconciled separately
+	id.externalNamesMut.Lock()
+	externalNames := make(map[types.UID]struct{}, len(id.externalNames))
+	for uid := range id.externalNames {
+		externalNames[uid] = struct{}{}
+	}
+	id.externalNamesMut.Unlock()
+
+	stale := map[types.UID]*kube.EndpointSliceInfo{}
+	outdated := map[types.UID]*kube.EndpointSliceInfo{}
+	indexed := map[types.UID]map[string]struct{}{}
+	for _, sh := range id.ipShards {
+		sh.mut.RLock()
+		for ip, ipSlices := range sh.servicesByIP {
+			for uid, es := range ipSlices {
+				if _, ok := externalNames[uid]; ok {
+					continue
+				}
+				if current, ok := live[uid]; !ok {
+					stale[uid] = es
+				} else if current != es {
+					outdated[uid] = es
+				}
+				if indexed[uid] == nil {
+					indexed[uid] = map[string]struct{}{}
+				}
+				indexed[uid][ip] = struct{}{}
+			}
+		}
+		sh.mut.RUnlock()
+	}
+	corrections := 0
+	for _, es := range stale {
+		id.reindexSlice(es, nil)
+		corrections++
+	}
+	for uid, es := range outdated {
+		id.reindexSlice(es, live[uid])
+		corrections++
+	}
+	for uid, es := range live {
+		if _, ok := outdated[uid]; ok {
+			continue
+		}
+		for _, ip := range es.IPs {
+			if _, ok := indexed[uid][ip]; !ok {
+				id.reindexSlice(nil, es)
+				corrections++
+				break
+			}
+		}
+	}
+	return corrections
+}
+
+// reconcileExternalNames returns the number of ExternalName Services that were added or removed.
+// Their IPs are indexed by the resolution loop.
+func (id *Database) reconcileExternalNames() int {
+	if id.externalNamesRefresh == 0 {
+		return 0
+	}
+	live := map[types.UID]*kube.ServiceInfo{}
+	for _, svc := range id.informer.ListServices() {
+		if svc.ExternalName != "" {
+			live[svc.UID] = svc
+		}
+	}
+	var stale []*kube.ServiceInfo
+	var missing []*kube.ServiceInfo
+	id.externalNamesMut.Lock()
+	for uid, en := range id.externalNames {
+		if _, ok := live[uid]; !ok {
+			stale = append(stale, en.svc)
+		}
+	}
+	for uid, svc := range live {
+		if en, ok := id.externalNames[uid]; !ok || en.svc.ExternalName != svc.ExternalName {
+			missing = append(missing, svc)
+		}
+	}
+	id.externalNamesMut.Unlock()
+	for _, svc := range stale {
+		id.OnExternalNameServiceDeletion(svc)
+	}
+	for _, svc := range missing {
+		id.OnExternalNameService(svc)
+	}
+	return len(stale) + len(missing)
+}
+
+// reconcileSelectors returns the number of corrected Services in the selectors index
+func (id *Database) reconcileSelectors() int {
+	live := map[types.UID]*kube.ServiceInfo{}
+	for _, svc := range id.informer.ListServices() {
+		if len(svc.Selector) > 0 {
+			live[svc.UID] = svc
+		}
+	}
+	indexed := map[types.UID]*kube.ServiceInfo{}
+	id.selectorsMut.RLock()
+	for _, services := range id.servicesBySelector {
+		for uid, svc := range services {
+			indexed[uid] = svc
+		}
+	}
+	id.selectorsMut.RUnlock()
+	corrections := 0
+	for uid, svc := range indexed {
+		if current := live[uid]; current != svc {
+			// removes the stale Services and replaces the outdated ones
+			id.OnSelectorService(svc, current)
+			corrections++
+		}
+	}
+	for uid, svc := range live {
+		if _, ok := indexed[uid]; !ok {
+			id.OnSelectorService(nil, svc)
+			corrections++
+		}
+	}
+	return corrections
+}
@@ -0,0 +1,104 @@
+package kube
+
+import (
+	"sort"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/grafana/beyla/pkg/internal/kube"
+)
+
+// selectorKey is a label of a Service selector, in the namespace of the Service
+type selectorKey struct {
+	namespace string
+	label     string
+	value     string
+}
+
+// indexKey returns the label of the selector by which the Service is indexed: the first one in
+// alphabetical order. A pod can only be selected by the Service if it has that label, so looking
+// up the labels of the pod finds all the Services that might select it.
+// It returns false if the Service doesn't select any pod.
+func indexKey(svc *kube.ServiceInfo) (selectorKey, bool) {
+	if svc == nil || len(svc.Selector) == 0 {
+		return selectorKey{}, false
+	}
+	first := ""
+	for label := range svc.Selector {
+		if first == "" || label < first {
+			first = label
+		}
+	}
+	return selectorKey{namespace: svc.Namespace, label: first, value: svc.Selector[first]}, true
+}
+
+// OnSelectorService reindexes a Service that changed from oldSvc to newSvc. oldSvc is nil for the
+// created Services, and newSvc is nil for the deleted Services.
+func (id *Database) OnSelectorService(oldSvc, newSvc *kube.ServiceInfo) {
+	id.selectorsMut.Lock()
+	defer id.selectorsMut.Unlock()
+	if key, ok := indexKey(oldSvc); ok {
+		if services := id.servicesBySelector[key]; services != nil {
+			if _, ok := services[oldSvc.UID]; ok {
+				delete(services, oldSvc.UID)
+				id.selectorServicesLen--
+			}
+			if len(services) == 0 {
+				delete(id.servicesBySelector, key)
+			}
+		}
+	}
+	if key, ok := indexKey(newSvc); ok {
+		services := id.servicesBySelector[key]
+		if services == nil {
+			services = map[types.UID]*kube.ServiceInfo{}
+			id.servicesBySelector[key] = services
+		}
+		if _, ok := services[newSvc.UID]; !ok {
+			id.selectorServicesLen++
+		}
+		services[newSvc.UID] = newSvc
+	}
+	id.metrics.KubeDatabaseIndexSize(indexServicesBySelector, id.selectorServicesLen)
+}
+
+// ServicesForPod returns the Services whose selector matches the labels of the pod, sorted by name.
+// The pod is matched with its current labels, so the label changes of the running pods are taken into
+// account without reindexing them. The Services are only known if the informers watch them.
+func (id *Database) ServicesForPod(pod *kube.PodInfo) []*kube.ServiceInfo {
+	if pod == nil || len(pod.Labels) == 0 {
+		return nil
+	}
+	var found []*kube.ServiceInfo
+	id.selectorsMut.RLock()
+	for label, value := range pod.Labels {
+		for _, svc := range id.servicesBySelector[selectorKey{namespace: pod.Namespace, label: label, value: value}] {
+			if selects(svc.Selector, pod.Labels) {
+				found = append(found, svc)
+			}
+		}
+	}
+	id.selectorsMut.RUnlock()
+	id.metrics.KubeDatabaseLookup(indexServicesBySelector, len(found) > 0)
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].Name < found[j].Name
+	})
+	return found
+}
+
+func selects(selector, labels map[string]string) bool {
+	for label, value := range selector {
+		if v, ok := labels[label]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// clearSelectors forgets the indexed Services
+func (id *Database) clearSelectors() {
+	id.selectorsMut.Lock()
+	id.servicesBySelector = map[selectorKey]map[types.UID]*kube.ServiceInfo{}
+	id.selectorServicesLen = 0
+	id.selectorsMut.Unlock()
+}
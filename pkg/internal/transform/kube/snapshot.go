@@ -0,0 +1,186 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/grafana/beyla/pkg/internal/kube"
+)
+
+// snapshotVersion must be increased on each incompatible change of the snapshot format, so the snapshots
+// written by previous Beyla versions are ignored instead of restoring wrong metadata
+const snapshotVersion = 1
+
+// snapshot of the Kubernetes metadata that is persisted to disk, so a restarted Beyla can decorate
+// the spans before its informers finish listing the objects of the cluster
+type snapshot struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	// Pods contain their owners, as the ReplicaSets are not persisted
+	Pods      []*kube.PodInfo           `json:"pods"`
+	Endpoints []*kube.EndpointSliceInfo `json:"endpoints"`
+}
+
+// SnapshotConfig enables the persistence of the Kubernetes metadata in a file
+type SnapshotConfig struct {
+	// Path of the file. The snapshot is disabled if it is empty.
+	Path string
+	// Period between two writes of the file, after the informers are synced
+	Period time.Duration
+	// Grace is the time after the informers are synced during which the restored entries are still
+	// used, while they are confirmed or replaced by the informer events. Then the rest are dropped.
+	Grace time.Duration
+}
+
+// restoreSnapshot pre-populates the indexes with the metadata of the snapshot file. It must be invoked
+// before the Database listens for the informer events, so they overwrite the restored entries. The restored
+// pods are also found by their container IDs until the informers are synced.
+// It returns false if there is no snapshot, or it can't be used.
+func (id *Database) restoreSnapshot(path string) bool {
+	log := dblog().With("path", path)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Warn("can't read the Kubernetes metadata snapshot. Ignoring it", "error", err)
+		}
+		return false
+	}
+	// the version is decoded first, as the rest of the format might have changed
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(content, &header); err != nil {
+		log.Warn("invalid Kubernetes metadata snapshot. Ignoring it", "error", err)
+		return false
+	}
+	if header.Version != snapshotVersion {
+		log.Info("the Kubernetes metadata snapshot was written with an incompatible format. Ignoring it",
+			"version", header.Version, "expected", snapshotVersion)
+		return false
+	}
+	var snap snapshot
+	if err := json.Unmarshal(content, &snap); err != nil {
+		log.Warn("invalid Kubernetes metadata snapshot. Ignoring it", "error", err)
+		return false
+	}
+	// the namespace filter might have changed since the snapshot was written
+	filter := id.informer.NamespaceFilter()
+	containers := map[string]*kube.PodInfo{}
+	for _, pod := range snap.Pods {
+		if pod.Excluded = false; !filter.Decorated(pod.Namespace) {
+			pod.Exclude()
+		}
+		for _, cid := range pod.ContainerIDs {
+			containers[cid] = pod
+		}
+		id.reindexPod(nil, pod)
+	}
+	// the EndpointSlices are only kept up to date if the informers watch them
+	if id.informer.EndpointSlicesWatched() {
+		for _, es := range snap.Endpoints {
+			if es.Excluded = false; !filter.Decorated(es.Namespace) {
+				es.Exclude()
+			}
+			id.reindexSlice(nil, es)
+		}
+	}
+	id.restoredMut.Lock()
+	id.restoredContainers = containers
+	id.restoredMut.Unlock()
+	log.Info("restored the Kubernetes metadata snapshot", "created", snap.Created,
+		"pods", len(snap.Pods), "endpointSlices", len(snap.Endpoints))
+	return true
+}
+
+// restoredPod returns the restored pod of the container, until the restored entries are dropped
+func (id *Database) restoredPod(containerID string) (*kube.PodInfo, bool) {
+	id.restoredMut.RLock()
+	defer id.restoredMut.RUnlock()
+	pod, ok := id.restoredContainers[containerID]
+	return pod, ok
+}
+
+// snapshotLoop waits for the informers to sync and, if a snapshot was restored, drops its entries that haven't
+// been confirmed by the informers after the grace period. Since the sync, it writes the snapshot periodically.
+func (id *Database) snapshotLoop(ctx context.Context, cfg SnapshotConfig, restored bool) {
+	if err := id.informer.WaitForCacheSync(ctx); err != nil {
+		return
+	}
+	id.writeSnapshot(cfg.Path)
+	var grace <-chan time.Time
+	if restored {
+		timer := time.NewTimer(cfg.Grace)
+		defer timer.Stop()
+		grace = timer.C
+	}
+	ticker := time.NewTicker(cfg.Period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-grace:
+			id.dropRestored()
+		case <-ticker.C:
+			id.writeSnapshot(cfg.Path)
+		}
+	}
+}
+
+// dropRestored stops finding the pods by the restored container IDs, and reconciles the indexes with the
+// informers, which removes the restored entries whose objects don't exist anymore
+func (id *Database) dropRestored() {
+	id.restoredMut.Lock()
+	id.restoredContainers = nil
+	id.restoredMut.Unlock()
+	corrections := id.reconcile()
+	dblog().Debug("dropped the unconfirmed entries of the Kubernetes metadata snapshot", "corrections", corrections)
+}
+
+// writeSnapshot writes the metadata of the informers to the file. The file is replaced atomically, so a
+// Beyla instance that is killed while writing it doesn't leave a corrupted snapshot.
+func (id *Database) writeSnapshot(path string) {
+	if id.stopped.Load() {
+		return
+	}
+	snap := snapshot{Version: snapshotVersion, Created: time.Now()}
+	for _, pod := range id.informer.ListPods() {
+		snap.Pods = append(snap.Pods, id.informer.PodWithOwnerInfo(pod))
+	}
+	for _, es := range id.informer.ListEndpointSlices() {
+		// the slices that are not owned by a Service are not indexed
+		if es.ServiceName != "" {
+			snap.Endpoints = append(snap.Endpoints, es)
+		}
+	}
+	if err := writeFileAtomically(path, snap); err != nil {
+		dblog().Warn("can't write the Kubernetes metadata snapshot", "path", path, "error", err)
+		return
+	}
+	dblog().Debug("written the Kubernetes metadata snapshot", "path", path,
+		"pods", len(snap.Pods), "endpointSlices", len(snap.Endpoints))
+}
+
+func writeFileAtomically(path string, snap snapshot) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := json.NewEncoder(tmp).Encode(snap); err != nil {
+		tmp.Close()
+		return fmt.Errorf("encoding snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing temporary file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replacing snapshot: %w", err)
+	}
+	return nil
+}
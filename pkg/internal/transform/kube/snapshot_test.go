@@ -0,0 +1,123 @@
+package kube
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	fakek8sclientset "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+	"github.com/grafana/beyla/pkg/internal/kube"
+)
+
+func snapshotPod(name, ip, containerID string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "shop", UID: types.UID("uid-" + name)},
+		Status: corev1.PodStatus{
+			PodIPs:            []corev1.PodIP{{IP: ip}},
+			ContainerStatuses: []corev1.ContainerStatus{{ContainerID: "containerd://" + containerID}},
+		},
+	}
+}
+
+func TestDatabase_Snapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kube-metadata.json")
+	snapshots := SnapshotConfig{Path: path, Period: time.Hour, Grace: time.Hour}
+
+	// GIVEN a Beyla instance that persists the metadata of its informers
+	client := fakek8sclientset.NewSimpleClientset(
+		snapshotPod("live-pod", "10.244.0.1", "container-live"),
+		snapshotPod("gone-pod", "10.244.0.2", "container-gone"),
+	)
+	port := int32(8080)
+	_, err := client.DiscoveryV1().EndpointSlices("shop").Create(context.Background(), &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-abcde", Namespace: "shop", UID: "slice-1",
+			Labels: map[string]string{discoveryv1.LabelServiceName: "web"}},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints:   []discoveryv1.Endpoint{{Addresses: []string{"10.244.0.2"}}},
+		Ports:       []discoveryv1.EndpointPort{{Port: &port}},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	informer := kube.Metadata{WatchEndpointSlices: true}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	db, err := StartDatabase(context.TODO(), &informer, imetrics.NoopReporter{}, DatabaseConfig{Snapshot: snapshots})
+	require.NoError(t, err)
+	// THEN the snapshot is written once the informers are synced
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	db.Stop()
+
+	// AND WHEN Beyla restarts, and its informers haven't listed the objects yet
+	fakeProcesses(t, map[uint32]fakeProcess{
+		1: {namespace: 10, start: 1000, containerID: "container-gone"},
+	})
+	restarted := CreateDatabase(&kube.Metadata{WatchEndpointSlices: true})
+	require.True(t, restarted.restoreSnapshot(path))
+	restarted.AddProcess(1)
+
+	// THEN the pods and Services are found from the snapshot
+	assert.Equal(t, "live-pod", restarted.PodInfoForIP("10.244.0.1").Name)
+	assert.Equal(t, "gone-pod", restarted.PodInfoForIP("10.244.0.2").Name)
+	assert.Equal(t, "web", restarted.ServiceForIP("10.244.0.2", 8080).ServiceName)
+	pod, ok := restarted.OwnerPodInfo(10, 1)
+	require.True(t, ok)
+	assert.Equal(t, "gone-pod", pod.Name)
+	// AND the restored pods are not cached, so they are replaced as soon as the informers know them
+	assert.Empty(t, restarted.fetchedPodsCache)
+
+	// AND WHEN the informers list the objects, after a pod and the EndpointSlice were deleted
+	// and the other pod was updated
+	updated := snapshotPod("live-pod", "10.244.0.1", "container-live")
+	updated.Labels = map[string]string{"version": "2"}
+	client = fakek8sclientset.NewSimpleClientset(updated)
+	informer = kube.Metadata{WatchEndpointSlices: true}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	snapshots.Grace = 0
+	db, err = StartDatabase(context.TODO(), &informer, imetrics.NoopReporter{}, DatabaseConfig{Snapshot: snapshots})
+	require.NoError(t, err)
+	defer db.Stop()
+	db.AddProcess(1)
+
+	// THEN the informer events replace the restored entries
+	require.Eventually(t, func() bool {
+		pod := db.PodInfoForIP("10.244.0.1")
+		return pod != nil && pod.Labels["version"] == "2"
+	}, 5*time.Second, 10*time.Millisecond)
+	// AND the entries that are not confirmed by the informers are dropped after the grace period
+	require.Eventually(t, func() bool {
+		_, ok := db.OwnerPodInfo(10, 1)
+		return !ok && db.PodInfoForIP("10.244.0.2") == nil && db.ServiceForIP("10.244.0.2", 8080) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDatabase_SnapshotVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kube-metadata.json")
+	db := CreateDatabase(&kube.Metadata{})
+
+	// the missing and corrupted snapshots are ignored
+	assert.False(t, db.restoreSnapshot(path))
+	require.NoError(t, os.WriteFile(path, []byte(`{"version": 1, "pods": [`), 0o600))
+	assert.False(t, db.restoreSnapshot(path))
+
+	// the snapshots written with another format are ignored, even if they can be decoded
+	require.NoError(t, os.WriteFile(path, []byte(`{"version": 2, "pods": [
+		{"name": "the-pod", "namespace": "shop", "IPs": ["10.244.0.1"]}]}`), 0o600))
+	assert.False(t, db.restoreSnapshot(path))
+	assert.Nil(t, db.PodInfoForIP("10.244.0.1"))
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"version": 1, "pods": [
+		{"name": "the-pod", "namespace": "shop", "IPs": ["10.244.0.1"]}]}`), 0o600))
+	assert.True(t, db.restoreSnapshot(path))
+	assert.Equal(t, "the-pod", db.PodInfoForIP("10.244.0.1").Name)
+}
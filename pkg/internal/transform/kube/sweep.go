@@ -0,0 +1,166 @@
+package kube
+
+import (
+	"context"
+	"time"
+)
+
+// maxSweptProcesses is the maximum number of processes whose liveness is checked in /proc on each
+// sweep. The processes that are not checked are considered alive until the next sweep.
+var maxSweptProcesses = 4096
+
+// sweepProcessesLoop periodically forgets the processes that don't exist anymore, and the PID namespaces
+// and containers that are left without processes. Their entries are otherwise only removed by the container
+// deletion events, which are missed while the informers restart, or never sent for the processes whose
+// container is not managed by Kubernetes.
+func (id *Database) sweepProcessesLoop(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			id.sweepProcesses()
+		}
+	}
+}
+
+// sweepProcesses removes the dead processes, and the namespaces and container IDs that don't have any live
+// process, unless the informer still reports their containers. It returns the number of evicted namespaces.
+func (id *Database) sweepProcesses() int {
+	if id.stopped.Load() {
+		return 0
+	}
+	// the container IDs are listed before the processes, as their processes are registered before them
+	id.cntMut.Lock()
+	containers := make(map[string]pidNamespace, len(id.containerIDs))
+	for containerID, ns := range id.containerIDs {
+		containers[containerID] = ns
+	}
+	id.cntMut.Unlock()
+	id.nsMut.RLock()
+	processes := make(map[uint32]processContainer, len(id.processes))
+	for pid, pc := range id.processes {
+		processes[pid] = pc
+	}
+	namespaces := make(map[pidNamespace]string, len(id.namespaces))
+	for ns, info := range id.namespaces {
+		namespaces[ns] = info.ContainerID
+	}
+	id.nsMut.RUnlock()
+
+	// the /proc lookups are done without holding the locks
+	checks := 0
+	dead := map[uint32]processContainer{}
+	// containers of each namespace that still have live, or unchecked, processes
+	alive := map[pidNamespace]map[string]struct{}{}
+	for pid, pc := range processes {
+		if checks < maxSweptProcesses {
+			checks++
+			if start, err := processStartTime(pid); err != nil || start != pc.start {
+				dead[pid] = pc
+				continue
+			}
+		}
+		if alive[pc.ns] == nil {
+			alive[pc.ns] = map[string]struct{}{}
+		}
+		alive[pc.ns][pc.containerID] = struct{}{}
+	}
+	id.forgetDeadProcesses(dead)
+
+	evicted := 0
+	for ns, containerID := range namespaces {
+		if _, ok := alive[ns]; ok || id.runningContainer(containerID) {
+			continue
+		}
+		if id.forgetSweptNamespace(ns, processes) {
+			dblog().Debug("forgot PID namespace without live processes", "inode", ns.inode, "containerID", containerID)
+			evicted++
+		}
+	}
+	if evicted > 0 {
+		id.metrics.KubeDatabaseEvictions(indexPIDNamespaces, evicted)
+	}
+
+	// a container ID is also forgotten if its namespace is alive, but shared with other containers.
+	// The nsMut lock is never held while acquiring cntMut, so it can be acquired here to keep the
+	// containers of the processes that have been registered during the sweep
+	id.cntMut.Lock()
+	id.nsMut.RLock()
+	for pid, pc := range id.processes {
+		if swept, ok := processes[pid]; !ok || swept != pc {
+			if alive[pc.ns] == nil {
+				alive[pc.ns] = map[string]struct{}{}
+			}
+			alive[pc.ns][pc.containerID] = struct{}{}
+		}
+	}
+	id.nsMut.RUnlock()
+	evictedContainers := 0
+	for containerID, ns := range containers {
+		if _, ok := alive[ns][containerID]; ok || id.runningContainer(containerID) {
+			continue
+		}
+		if current, ok := id.containerIDs[containerID]; ok && current == ns {
+			delete(id.containerIDs, containerID)
+			evictedContainers++
+		}
+	}
+	if evictedContainers > 0 {
+		id.metrics.KubeDatabaseEvictions(indexContainerIDs, evictedContainers)
+		id.metrics.KubeDatabaseIndexSize(indexContainerIDs, len(id.containerIDs))
+	}
+	id.cntMut.Unlock()
+	return evicted
+}
+
+// forgetDeadProcesses removes the passed processes, unless their PID has been registered again in the meantime
+func (id *Database) forgetDeadProcesses(dead map[uint32]processContainer) {
+	if len(dead) == 0 {
+		return
+	}
+	id.nsMut.Lock()
+	defer id.nsMut.Unlock()
+	removed := 0
+	for pid, pc := range dead {
+		if current, ok := id.processes[pid]; ok && current == pc {
+			delete(id.processes, pid)
+			removed++
+		}
+	}
+	if removed > 0 {
+		id.metrics.KubeDatabaseEvictions(indexProcesses, removed)
+		id.metrics.KubeDatabaseIndexSize(indexProcesses, len(id.processes))
+	}
+}
+
+// forgetSweptNamespace works as forgetNamespace, unless a process that is not in the swept snapshot of the
+// processes has been registered in the namespace in the meantime, as forgetDeadProcesses does for the PIDs.
+// It returns true if the namespace was forgotten.
+func (id *Database) forgetSweptNamespace(ns pidNamespace, swept map[uint32]processContainer) bool {
+	id.nsMut.Lock()
+	for pid, pc := range id.processes {
+		if snap, ok := swept[pid]; pc.ns == ns && (!ok || snap != pc) {
+			id.nsMut.Unlock()
+			return false
+		}
+	}
+	id.removeNamespace(ns)
+	id.nsMut.Unlock()
+	id.podsCacheMut.Lock()
+	id.uncachePod(ns)
+	id.metrics.KubeDatabaseIndexSize(indexPodsByPIDNS, len(id.fetchedPodsCache))
+	id.podsCacheMut.Unlock()
+	return true
+}
+
+// runningContainer returns true if the informer still knows the pod of the container
+func (id *Database) runningContainer(containerID string) bool {
+	if id.informer == nil || containerID == "" {
+		return false
+	}
+	_, ok := id.informer.GetContainerPod(containerID)
+	return ok
+}
@@ -0,0 +1,154 @@
+package kube
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/grafana/beyla/pkg/internal/kube"
+)
+
+func TestSweepProcesses(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		terminated []uint32
+		deletedPod bool
+		evicted    int
+		containers []string
+		cachedPods int
+	}{{
+		name:       "all the processes are alive",
+		containers: []string{"container-a", "docker-container", "container-c"},
+		cachedPods: 1,
+	}, {
+		name:       "a namespace keeps live processes",
+		terminated: []uint32{300},
+		containers: []string{"container-a", "docker-container", "container-c"},
+		cachedPods: 1,
+	}, {
+		name:       "container not managed by Kubernetes",
+		terminated: []uint32{200},
+		evicted:    1,
+		containers: []string{"container-a", "container-c"},
+		cachedPods: 1,
+	}, {
+		name:       "missed pod deletion",
+		terminated: []uint32{300, 301},
+		evicted:    1,
+		containers: []string{"container-a", "docker-container"},
+		cachedPods: 1,
+	}, {
+		name:       "container still reported by the informer",
+		terminated: []uint32{100},
+		containers: []string{"container-a", "docker-container", "container-c"},
+		cachedPods: 1,
+	}, {
+		name:       "container deleted from the informer",
+		terminated: []uint32{100},
+		deletedPod: true,
+		evicted:    1,
+		containers: []string{"docker-container", "container-c"},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			// GIVEN processes in a container of a pod, in a container that is not managed by Kubernetes,
+			// and in a pod whose deletion was missed by the database
+			procs := map[uint32]fakeProcess{
+				100: {namespace: 7, start: 1000, containerID: "container-a"},
+				200: {namespace: 8, start: 2000, containerID: "docker-container"},
+				300: {namespace: 9, start: 3000, containerID: "container-c"},
+				301: {namespace: 9, start: 3001, containerID: "container-c"},
+			}
+			informer, db := decoratedProcesses(t, procs, &kube.PodInfo{
+				ObjectMeta:   metav1.ObjectMeta{Name: "the-pod", Namespace: "the-ns", UID: "uid-1"},
+				ContainerIDs: []string{"container-a"},
+			})
+			_, ok := db.OwnerPodInfo(7, 100)
+			require.True(t, ok)
+
+			// WHEN some processes terminate
+			for _, pid := range tc.terminated {
+				delete(procs, pid)
+			}
+			if tc.deletedPod {
+				informer.DeletePod("the-ns", "the-pod")
+			}
+
+			// THEN only the namespaces and containers that are left without live processes are evicted,
+			// together with their cached pods, unless the informer still reports their containers
+			assert.Equal(t, tc.evicted, db.sweepProcesses())
+			assert.Len(t, db.containerIDs, len(tc.containers))
+			for _, containerID := range tc.containers {
+				assert.Contains(t, db.containerIDs, containerID)
+			}
+			assert.Len(t, db.fetchedPodsCache, tc.cachedPods)
+			for _, pid := range tc.terminated {
+				assert.NotContains(t, db.processes, pid)
+			}
+		})
+	}
+}
+
+func TestSweepProcesses_RateLimit(t *testing.T) {
+	defer func(orig int) { maxSweptProcesses = orig }(maxSweptProcesses)
+	maxSweptProcesses = 1
+	procs := map[uint32]fakeProcess{
+		100: {namespace: 7, start: 1000, containerID: "container-a"},
+		200: {namespace: 8, start: 2000, containerID: "container-b"},
+	}
+	_, db := decoratedProcesses(t, procs)
+
+	// WHEN both processes terminate, but only one process can be checked on each sweep
+	delete(procs, 100)
+	delete(procs, 200)
+
+	// THEN the unchecked process is evicted in the next sweep
+	assert.Equal(t, 1, db.sweepProcesses())
+	assert.Equal(t, 1, db.sweepProcesses())
+	assert.Empty(t, db.namespaces)
+}
+
+func TestSweepProcesses_ProcessAddedDuringSweep(t *testing.T) {
+	procs := map[uint32]fakeProcess{
+		100: {namespace: 7, start: 1000, containerID: "container-a"},
+		200: {namespace: 8, start: 2000, containerID: "container-b"},
+	}
+	_, db := decoratedProcesses(t, procs)
+
+	// WHEN a new process is registered in the namespace and container of another process, while the
+	// sweep is checking the other process, which terminates right after
+	startTime := processStartTime
+	processStartTime = func(pid uint32) (uint64, error) {
+		if _, added := procs[201]; pid == 200 && !added {
+			procs[201] = fakeProcess{namespace: 8, start: 2001, containerID: "container-b"}
+			db.AddProcess(201)
+			delete(procs, 200)
+		}
+		return startTime(pid)
+	}
+
+	// THEN neither the namespace nor the container of the new process are evicted
+	assert.Zero(t, db.sweepProcesses())
+	assert.Contains(t, db.processes, uint32(201))
+	assert.NotContains(t, db.processes, uint32(200))
+	assert.Len(t, db.namespaces, 2)
+	assert.Contains(t, db.containerIDs, "container-b")
+}
+
+// decoratedProcesses returns a database whose fake informer knows the passed pods, and to which the passed
+// processes have been added. The database does not receive the pod events from the informer.
+func decoratedProcesses(
+	t testing.TB, procs map[uint32]fakeProcess, pods ...*kube.PodInfo,
+) (*kube.FakeMetadata, *Database) {
+	informer := kube.NewFakeMetadata()
+	db := CreateDatabase(informer)
+	for _, pod := range pods {
+		informer.AddPod(pod)
+	}
+	fakeProcesses(t, procs)
+	for pid := range procs {
+		db.AddProcess(pid)
+	}
+	return informer, &db
+}
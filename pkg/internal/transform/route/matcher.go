@@ -1,6 +1,7 @@
 package route
 
 import (
+	"fmt"
 	"regexp"
 	"strings"
 )
@@ -43,6 +44,30 @@ func NewMatcher(routes []string) Matcher {
 	return m
 }
 
+// ValidatePattern returns an error if the provided route pattern is malformed: it does not start
+// with a slash, it contains unclosed wildcards, or it contains a '*' that is not its last folder.
+func ValidatePattern(route string) error {
+	if !strings.HasPrefix(route, "/") {
+		return fmt.Errorf("route pattern %q must start with '/'", route)
+	}
+	folders := tokenize(route)
+	for i, folder := range folders {
+		switch {
+		case folder == "*":
+			if i != len(folders)-1 {
+				return fmt.Errorf("route pattern %q: '*' must be the last folder", route)
+			}
+		case strings.HasPrefix(folder, ":") || strings.HasPrefix(folder, "{") || strings.HasSuffix(folder, "}"):
+			if !wildcard.MatchString(folder) {
+				return fmt.Errorf("route pattern %q: malformed wildcard %q", route, folder)
+			}
+		case strings.Contains(folder, "*"):
+			return fmt.Errorf("route pattern %q: '*' must be a whole folder", route)
+		}
+	}
+	return nil
+}
+
 // Find the router pattern that would match a given URL path, or empty if no pattern
 // matches it.
 func (rm *Matcher) Find(path string) string {
@@ -36,3 +36,12 @@ func TestFind(t *testing.T) {
 	assert.Equal(t, "/snow/mobile/*", m.Find("/snow/mobile"))
 	assert.Equal(t, "/snow/mobile/*", m.Find("/snow/mobile/long"))
 }
+
+func TestValidatePattern(t *testing.T) {
+	for _, valid := range []string{"/", "/users/:id", "/users/{id}/details", "/ski/*", "/users/:id/"} {
+		assert.NoError(t, ValidatePattern(valid), valid)
+	}
+	for _, invalid := range []string{"users/:id", "/users/{id", "/users/id}", "/users/:user-id", "/ski/*/doo", "/ski*"} {
+		assert.Error(t, ValidatePattern(invalid), invalid)
+	}
+}
@@ -171,6 +171,19 @@ func (p *PortEnum) UnmarshalText(text []byte) error {
 	return nil
 }
 
+// MarshalYAML returns the port enumeration in the same format as it is unmarshalled
+func (p PortEnum) MarshalYAML() (any, error) {
+	entries := make([]string, 0, len(p.Ranges))
+	for _, pr := range p.Ranges {
+		if pr.End == 0 {
+			entries = append(entries, strconv.Itoa(pr.Start))
+		} else {
+			entries = append(entries, strconv.Itoa(pr.Start)+"-"+strconv.Itoa(pr.End))
+		}
+	}
+	return strings.Join(entries, ","), nil
+}
+
 func (p *PortEnum) Matches(port int) bool {
 	for _, pr := range p.Ranges {
 		if pr.End == 0 && pr.Start == port ||
@@ -223,6 +236,14 @@ func (p *RegexpAttr) UnmarshalText(text []byte) error {
 	return nil
 }
 
+// MarshalYAML returns the source text of the regular expression
+func (p RegexpAttr) MarshalYAML() (any, error) {
+	if p.re == nil {
+		return "", nil
+	}
+	return p.re.String(), nil
+}
+
 func (p *RegexpAttr) MatchString(input string) bool {
 	// no regexp means "empty regexp", so anything will match it
 	if p.re == nil {
@@ -141,3 +141,28 @@ services:
 	assert.True(t, other["k8s_replicaset_name"].MatchString("bbc"))
 	assert.False(t, other["k8s_replicaset_name"].MatchString("aa"))
 }
+
+func TestYAMLMarshal(t *testing.T) {
+	inputFile := `
+services:
+  - name: foo
+    open_ports: 80,443,8000-8999
+    exe_path: "^abc$"
+    k8s_namespace: "^aaa$"
+`
+	yf := yamlFile{}
+	require.NoError(t, yaml.Unmarshal([]byte(inputFile), &yf))
+
+	out, err := yaml.Marshal(yf)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "open_ports: 80,443,8000-8999\n")
+	assert.Contains(t, string(out), "exe_path: ^abc$\n")
+	assert.Contains(t, string(out), "k8s_namespace: ^aaa$\n")
+
+	// the marshalled configuration can be unmarshalled again
+	reparsed := yamlFile{}
+	require.NoError(t, yaml.Unmarshal(out, &reparsed))
+	remarshalled, err := yaml.Marshal(reparsed)
+	require.NoError(t, err)
+	assert.Equal(t, string(out), string(remarshalled))
+}
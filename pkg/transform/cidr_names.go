@@ -0,0 +1,112 @@
+package transform
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/yl2chen/cidranger"
+)
+
+// NamedCIDRs names the peers that are not found in the cluster by the CIDR range that contains
+// their IP, for example 10.100.0.0/16: corp-db. If an IP is contained by multiple ranges, the
+// narrowest range names it, so 0.0.0.0/0 and ::/0 can name all the remaining IPs.
+type NamedCIDRs map[string]string
+
+func (nc NamedCIDRs) Validate() error {
+	_, err := newCIDRNames(nc, 1)
+	return err
+}
+
+// CIDRNamer names the IPs from the NamedCIDRs. Its ranges can be updated at runtime.
+type CIDRNamer struct {
+	cacheLen int
+	active   atomic.Pointer[cidrNames]
+}
+
+type cidrNames struct {
+	ranger cidranger.Ranger
+	// caches the name of each looked up IP, or the empty string if no range contains it
+	cache *lru.Cache[string, string]
+}
+
+type namedRange struct {
+	ipNet net.IPNet
+	name  string
+}
+
+func (nr *namedRange) Network() net.IPNet {
+	return nr.ipNet
+}
+
+// NewCIDRNamer caches the names of up to cacheLen IPs. The ranges must have been validated.
+func NewCIDRNamer(cidrs NamedCIDRs, cacheLen int) *CIDRNamer {
+	cn := &CIDRNamer{cacheLen: max(cacheLen, 1)}
+	if err := cn.Update(cidrs); err != nil {
+		// the configuration was validated
+		panic(err)
+	}
+	return cn
+}
+
+// Update replaces the ranges of a running CIDRNamer, forgetting the cached names. If any range is
+// invalid, the current ranges are kept.
+func (cn *CIDRNamer) Update(cidrs NamedCIDRs) error {
+	names, err := newCIDRNames(cidrs, cn.cacheLen)
+	if err != nil {
+		return err
+	}
+	cn.active.Store(names)
+	return nil
+}
+
+func newCIDRNames(cidrs NamedCIDRs, cacheLen int) (*cidrNames, error) {
+	names := &cidrNames{}
+	if len(cidrs) == 0 {
+		return names, nil
+	}
+	names.ranger = cidranger.NewPCTrieRanger()
+	for cidr, name := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("parsing CIDR %s: %w", cidr, err)
+		}
+		if name == "" {
+			return nil, fmt.Errorf("CIDR %s has an empty name", cidr)
+		}
+		if err := names.ranger.Insert(&namedRange{ipNet: *ipNet, name: name}); err != nil {
+			return nil, fmt.Errorf("inserting CIDR %s: %w", cidr, err)
+		}
+	}
+	var err error
+	if names.cache, err = lru.New[string, string](cacheLen); err != nil {
+		return nil, fmt.Errorf("creating CIDR names cache: %w", err)
+	}
+	return names, nil
+}
+
+// Name returns the name of the narrowest range that contains the IP, or the empty string if no
+// range contains it
+func (cn *CIDRNamer) Name(ip string) string {
+	if cn == nil {
+		return ""
+	}
+	names := cn.active.Load()
+	if names.ranger == nil {
+		return ""
+	}
+	if name, ok := names.cache.Get(ip); ok {
+		return name
+	}
+	name := ""
+	if parsed := net.ParseIP(ip); parsed != nil {
+		ranges, _ := names.ranger.ContainingNetworks(parsed)
+		if len(ranges) > 0 {
+			// the ranges are sorted from the widest to the narrowest
+			name = ranges[len(ranges)-1].(*namedRange).name
+		}
+	}
+	names.cache.Add(ip, name)
+	return name
+}
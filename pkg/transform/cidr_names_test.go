@@ -0,0 +1,92 @@
+package transform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kube2 "github.com/grafana/beyla/pkg/internal/kube"
+	"github.com/grafana/beyla/pkg/internal/svc"
+	"github.com/grafana/beyla/pkg/internal/transform/kube"
+)
+
+func TestCIDRNamer(t *testing.T) {
+	namer := NewCIDRNamer(NamedCIDRs{
+		"0.0.0.0/0":        "internet",
+		"10.0.0.0/8":       "corp",
+		"10.100.0.0/16":    "corp-db",
+		"::/0":             "internet-v6",
+		"2001:db8::/32":    "partner",
+		"2001:db8:aa::/48": "partner-api",
+	}, 10)
+
+	// the narrowest range wins
+	assert.Equal(t, "corp-db", namer.Name("10.100.3.4"))
+	assert.Equal(t, "corp", namer.Name("10.101.3.4"))
+	assert.Equal(t, "internet", namer.Name("8.8.8.8"))
+	assert.Equal(t, "partner-api", namer.Name("2001:db8:aa::1"))
+	assert.Equal(t, "partner", namer.Name("2001:db8:bb::1"))
+	assert.Equal(t, "internet-v6", namer.Name("2606:4700::1111"))
+	assert.Empty(t, namer.Name("not-an-ip"))
+	// the cached names are returned again
+	assert.Equal(t, "corp-db", namer.Name("10.100.3.4"))
+}
+
+func TestCIDRNamer_NoRanges(t *testing.T) {
+	assert.Empty(t, NewCIDRNamer(nil, 10).Name("10.100.3.4"))
+	var namer *CIDRNamer
+	assert.Empty(t, namer.Name("10.100.3.4"))
+}
+
+func TestCIDRNamer_Update(t *testing.T) {
+	namer := NewCIDRNamer(NamedCIDRs{"10.100.0.0/16": "corp-db"}, 10)
+	assert.Equal(t, "corp-db", namer.Name("10.100.3.4"))
+	assert.Empty(t, namer.Name("8.8.8.8"))
+
+	// WHEN the ranges are updated
+	require.NoError(t, namer.Update(NamedCIDRs{"10.100.3.0/24": "corp-cache", "0.0.0.0/0": "internet"}))
+	// THEN the cached names are forgotten
+	assert.Equal(t, "corp-cache", namer.Name("10.100.3.4"))
+	assert.Equal(t, "internet", namer.Name("8.8.8.8"))
+
+	// AND WHEN the new ranges are invalid
+	require.Error(t, namer.Update(NamedCIDRs{"10.100.0.0/99": "corp-db"}))
+	require.Error(t, namer.Update(NamedCIDRs{"10.100.0.0/16": ""}))
+	// THEN the current ranges are kept
+	assert.Equal(t, "corp-cache", namer.Name("10.100.3.4"))
+}
+
+func TestNameResolverConfig_ValidateCIDRs(t *testing.T) {
+	assert.NoError(t, (&NameResolverConfig{CIDRs: NamedCIDRs{"10.0.0.0/8": "corp", "::/0": "internet"}}).Validate())
+	assert.Error(t, (&NameResolverConfig{CIDRs: NamedCIDRs{"10.0.0.0": "corp"}}).Validate())
+}
+
+func TestResolve_CIDRNames(t *testing.T) {
+	// GIVEN a cluster with a pod in the range of a named CIDR
+	db := kube.CreateDatabase(nil)
+	db.UpdateNewPodsByIPIndex(&kube2.PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "cache", Namespace: "shop"},
+		IPs:        []string{"10.100.0.5"},
+	})
+	nr := NameResolver{
+		db:     &db,
+		sCache: expirable.NewLRU[string, svc.ID](10, nil, 5*time.Hour),
+		cidrs:  NewCIDRNamer(NamedCIDRs{"10.100.0.0/16": "corp-db", "0.0.0.0/0": "internet"}, 10),
+	}
+	client := svc.ID{Name: "frontend", Namespace: "shop"}
+
+	// THEN the Kubernetes objects are preferred over the CIDR names
+	name, ns := nr.resolve(&client, "10.100.0.5", 6379)
+	assert.Equal(t, "cache", name)
+	assert.Equal(t, "shop", ns)
+	// AND the peers that are not found in the cluster are named by their CIDR
+	name, ns = nr.resolve(&client, "10.100.7.8", 5432)
+	assert.Equal(t, "corp-db", name)
+	assert.Equal(t, "shop", ns)
+	name, _ = nr.resolve(&client, "203.0.113.10", 443)
+	assert.Equal(t, "internet", name)
+}
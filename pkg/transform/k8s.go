@@ -1,10 +1,16 @@
 package transform
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
+	"net"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/gobwas/glob"
 	"github.com/mariomac/pipes/pipe"
 
 	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
@@ -32,18 +38,331 @@ func klog() *slog.Logger {
 type KubernetesDecorator struct {
 	Enable KubeEnableFlag `yaml:"enable" env:"BEYLA_KUBE_METADATA_ENABLE"`
 
-	// ClusterName overrides cluster name. If empty, the NetO11y module will try to retrieve
-	// it from the Cloud Provider Metadata (EC2, GCP and Azure), and leave it empty if it fails to.
+	// ClusterName overrides cluster name. If empty, Beyla will try to retrieve it from the Cloud Provider
+	// Metadata (EC2, GCP and Azure), falling back to the UID of the kube-system namespace if it fails to.
 	ClusterName string `yaml:"cluster_name" env:"BEYLA_KUBE_CLUSTER_NAME"`
 
 	// KubeconfigPath is optional. If unset, it will look in the usual location.
 	KubeconfigPath string `yaml:"kubeconfig_path" env:"KUBECONFIG"`
+	// KubeconfigContext selects a context of the kubeconfig file, instead of its current context
+	KubeconfigContext string `yaml:"kubeconfig_context" env:"BEYLA_KUBE_KUBECONFIG_CONTEXT"`
 
+	// APIServerURL connects to the provided API server instead of loading a kubeconfig file. It is
+	// authenticated by the token in APIServerTokenPath, and verified by the CA in APIServerCAPath or,
+	// if empty, by the system CA certificates.
+	APIServerURL       string `yaml:"api_server_url" env:"BEYLA_KUBE_API_SERVER_URL"`
+	APIServerTokenPath string `yaml:"api_server_token_path" env:"BEYLA_KUBE_API_SERVER_TOKEN_PATH"`
+	APIServerCAPath    string `yaml:"api_server_ca_path" env:"BEYLA_KUBE_API_SERVER_CA_PATH"`
+
+	// RemoteCluster watches a cluster that the local host is not a node of, so only the peers of the
+	// instrumented applications are decorated. The local processes are not looked up in the cluster.
+	RemoteCluster bool `yaml:"remote_cluster" env:"BEYLA_KUBE_REMOTE_CLUSTER"`
+
+	// InformersSyncTimeout is the maximum time that the decoration waits, at startup, for the informers
+	// to sync. After it, the decoration starts anyway and the metadata is added as soon as it is available.
 	InformersSyncTimeout time.Duration `yaml:"informers_sync_timeout" env:"BEYLA_KUBE_INFORMERS_SYNC_TIMEOUT"`
 
+	// Namespaces restricts the Kubernetes informers to the provided namespaces, to reduce the memory
+	// usage in large clusters. The applications in other namespaces aren't decorated. If empty,
+	// the whole cluster is watched.
+	Namespaces []string `yaml:"namespaces" env:"BEYLA_KUBE_NAMESPACES" envSeparator:","`
+
 	// DropExternal will drop, in NetO11y component, any flow where the source or destination
 	// IPs are not matched to any kubernetes entity, assuming they are cluster-external
 	DropExternal bool `yaml:"drop_external" env:"BEYLA_NETWORK_DROP_EXTERNAL"`
+
+	// NetworkOwnerNames decorates the network flows of the Pods with the name of their owner, instead of
+	// the Pod name, so the flows are aggregated by workload and the Pod restarts don't create new series.
+	// The Pods without owner keep their name.
+	NetworkOwnerNames bool `yaml:"network_owner_names" env:"BEYLA_KUBE_NETWORK_OWNER_NAMES"`
+
+	// ServiceCIDRs are the ranges of the Service cluster IPs. The network flows to the IPs in these ranges are
+	// classified as internal to the cluster, even if their Service is not known.
+	ServiceCIDRs []string `yaml:"service_cidrs" env:"BEYLA_KUBE_SERVICE_CIDRS" envSeparator:","`
+
+	// DecorationWorkers is the number of goroutines that decorate, in parallel, the spans with the
+	// Kubernetes metadata. The spans are forwarded to the next pipeline stage in the same order as
+	// they were received, regardless of the number of workers.
+	DecorationWorkers int `yaml:"decoration_workers" env:"BEYLA_KUBE_DECORATION_WORKERS"`
+
+	// MetadataWait is the maximum time that the spans are delayed when the metadata of their pod is not
+	// yet available, for example because the pod has just been created. After that time, the spans are
+	// forwarded without Kubernetes metadata. If 0, the spans are never delayed.
+	MetadataWait time.Duration `yaml:"metadata_wait" env:"BEYLA_KUBE_METADATA_WAIT"`
+
+	// PodsCacheTTL is the time after which the decorated pods, which are cached by PID namespace, are
+	// evicted and fetched again from the informers. If 0, they are kept until their pod or namespace are removed.
+	PodsCacheTTL time.Duration `yaml:"pods_cache_ttl" env:"BEYLA_KUBE_PODS_CACHE_TTL"`
+
+	// DeletedPodsGracePeriod is the time during which the IPs of the deleted pods, and of the endpoints
+	// removed from a Service, are still resolved to them, so the spans and network flows that are
+	// decorated after the pod terminated still get their metadata. If 0, they are forgotten immediately.
+	DeletedPodsGracePeriod time.Duration `yaml:"deleted_pods_grace_period" env:"BEYLA_KUBE_DELETED_PODS_GRACE_PERIOD"`
+
+	// ProcessesSweepInterval is the period at which the instrumented processes that don't exist anymore, and
+	// their containers, are forgotten if their deletion was not notified by the informers. If 0, they are
+	// only forgotten when the informers notify it.
+	ProcessesSweepInterval time.Duration `yaml:"processes_sweep_interval" env:"BEYLA_KUBE_PROCESSES_SWEEP_INTERVAL"`
+
+	// UnknownIPsCacheLen is the maximum number of IPs, usually from outside the cluster, that are remembered
+	// as not belonging to any pod or Service, so they are not looked up again in the Kubernetes metadata.
+	// The least recently used entries are evicted when the cache is full. If 0, the unknown IPs are not cached.
+	UnknownIPsCacheLen int `yaml:"unknown_ips_cache_len" env:"BEYLA_KUBE_UNKNOWN_IPS_CACHE_LEN"`
+	// UnknownIPsCacheTTL is the time after which an unknown IP is looked up again
+	UnknownIPsCacheTTL time.Duration `yaml:"unknown_ips_cache_ttl" env:"BEYLA_KUBE_UNKNOWN_IPS_CACHE_TTL"`
+
+	// MetadataSource selects where the Kubernetes metadata is taken from
+	MetadataSource MetadataSource `yaml:"metadata_source" env:"BEYLA_KUBE_METADATA_SOURCE"`
+	// KubeletEndpoint is the kubelet API of the local node, from which the Pods are fetched with the kubelet
+	// metadata source
+	KubeletEndpoint string `yaml:"kubelet_endpoint" env:"BEYLA_KUBE_KUBELET_ENDPOINT"`
+	// KubeletRefresh is the period between two fetches of the Pods from the kubelet
+	KubeletRefresh time.Duration `yaml:"kubelet_refresh" env:"BEYLA_KUBE_KUBELET_REFRESH"`
+	// KubeletInsecureSkipVerify doesn't verify the serving certificate of the kubelet, which is self-signed
+	// in many clusters
+	KubeletInsecureSkipVerify bool `yaml:"kubelet_insecure_skip_verify" env:"BEYLA_KUBE_KUBELET_INSECURE_SKIP_VERIFY"`
+
+	// DeploymentsFromReplicaSetNames doesn't watch the ReplicaSets of the cluster, to reduce the memory usage,
+	// and derives the Deployment that owns the ReplicaSet of a pod from the ReplicaSet name and the
+	// pod-template-hash label of the pod.
+	DeploymentsFromReplicaSetNames bool `yaml:"deployments_from_replicaset_names" env:"BEYLA_KUBE_DEPLOYMENTS_FROM_REPLICASET_NAMES"`
+	// ReplicaSetLookupCacheLen is the number of ReplicaSets that are cached when, with DeploymentsFromReplicaSetNames,
+	// the Deployment can't be derived from the ReplicaSet name and the ReplicaSet is fetched from the API.
+	// If 0, the ReplicaSets are never fetched.
+	ReplicaSetLookupCacheLen int `yaml:"replicaset_lookup_cache_len" env:"BEYLA_KUBE_REPLICASET_LOOKUP_CACHE_LEN"`
+	// JobLookupCacheLen is the number of Jobs that are cached after fetching them from the API, to know the
+	// CronJob that owns them. If 0, the Jobs are never fetched and the CronJobs are not reported.
+	JobLookupCacheLen int `yaml:"job_lookup_cache_len" env:"BEYLA_KUBE_JOB_LOOKUP_CACHE_LEN"`
+
+	// ServicesFromEndpoints watches the EndpointSlices of the cluster, so the name resolver reports the
+	// Service that is served by the destination pod, instead of the pod owner. It requires permissions
+	// to list and watch the EndpointSlices.
+	ServicesFromEndpoints bool `yaml:"services_from_endpoints" env:"BEYLA_KUBE_SERVICES_FROM_ENDPOINTS"`
+
+	// ServicesFromSelectors watches the Services of the cluster and indexes them by their selectors, so the
+	// Service that selects a pod can be used as its service name, and the name resolver reports the Service
+	// that selects the destination pod, even without watching the EndpointSlices. It requires permissions to
+	// list and watch the Services.
+	ServicesFromSelectors bool `yaml:"services_from_selectors" env:"BEYLA_KUBE_SERVICES_FROM_SELECTORS"`
+
+	// ExternalNameServices watches the Services of the cluster and resolves the hostnames of the ExternalName
+	// Services, so the name resolver reports the traffic to the resolved IPs as traffic to the Service.
+	// It requires permissions to list and watch the Services, and performs DNS lookups from Beyla.
+	ExternalNameServices bool `yaml:"external_name_services" env:"BEYLA_KUBE_EXTERNAL_NAME_SERVICES"`
+	// ExternalNamesRefresh is the period after which the hostnames of the ExternalName Services are resolved again
+	// The TTL of the DNS records is ignored, as the Go resolver doesn't expose it.
+	ExternalNamesRefresh time.Duration `yaml:"external_names_refresh" env:"BEYLA_KUBE_EXTERNAL_NAMES_REFRESH"`
+
+	// ContainerRestartCount adds the k8s.container.restart_count attribute to the spans, with the
+	// number of restarts of the container that generated them, at the time they were captured.
+	ContainerRestartCount bool `yaml:"container_restart_count" env:"BEYLA_KUBE_CONTAINER_RESTART_COUNT"`
+
+	// ContainerImage adds the container.image.name and container.image.tag attributes to the spans,
+	// with the image of the container that generated them.
+	ContainerImage bool `yaml:"container_image" env:"BEYLA_KUBE_CONTAINER_IMAGE"`
+
+	// NodeTopology adds the cloud.availability_zone and cloud.region attributes to the spans, from the
+	// topology labels of the node where the pod is scheduled. It requires permissions to list and watch
+	// the Nodes.
+	NodeTopology bool `yaml:"node_topology" env:"BEYLA_KUBE_NODE_TOPOLOGY"`
+
+	// ServiceNameSources is the ordered chain of sources of the service name, for the applications whose
+	// name is not defined in the discovery criteria. The first source providing a non-empty name is taken.
+	// If none of them does, the executable name is used. If empty, it defaults to DefaultServiceNameSources.
+	ServiceNameSources []ServiceNameSource `yaml:"service_name_sources" env:"BEYLA_KUBE_SERVICE_NAME_SOURCES" envSeparator:","`
+
+	// NamespaceLabels selects, by glob patterns, the labels of the namespaces that are added to the spans
+	// as k8s.namespace.label.<key> attributes. The labels that are selected without wildcards are also
+	// added to the application metrics. It requires permissions to list and watch the Namespaces.
+	NamespaceLabels []string `yaml:"namespace_labels" env:"BEYLA_KUBE_NAMESPACE_LABELS" envSeparator:","`
+
+	// IncludeNamespaces restricts the decoration to the applications and peers of the namespaces that match
+	// any of the provided names or glob patterns. If empty, all the namespaces are decorated. Unlike Namespaces,
+	// the whole cluster is still watched, so the traffic to the other namespaces is still attributed to them.
+	IncludeNamespaces []string `yaml:"include_namespaces" env:"BEYLA_KUBE_INCLUDE_NAMESPACES" envSeparator:","`
+	// ExcludeNamespaces prevents the decoration of the applications and peers of the namespaces that match any
+	// of the provided names or glob patterns. It takes precedence over IncludeNamespaces.
+	ExcludeNamespaces []string `yaml:"exclude_namespaces" env:"BEYLA_KUBE_EXCLUDE_NAMESPACES" envSeparator:","`
+	// ExcludedNamespacesDecoration defines how the applications and peers of the excluded namespaces are decorated
+	ExcludedNamespacesDecoration ExcludedNamespacesDecoration `yaml:"excluded_namespaces_decoration" env:"BEYLA_KUBE_EXCLUDED_NAMESPACES_DECORATION"`
+
+	// MetadataSnapshotPath is the file where the Kubernetes metadata is periodically persisted, so after a
+	// restart the spans are decorated with the persisted metadata until the informers list the cluster objects.
+	// It should be in a volume that survives the restarts, such as a hostPath. If empty, it is not persisted.
+	MetadataSnapshotPath string `yaml:"metadata_snapshot_path" env:"BEYLA_KUBE_METADATA_SNAPSHOT_PATH"`
+	// MetadataSnapshotPeriod is the time between two writes of the metadata snapshot
+	MetadataSnapshotPeriod time.Duration `yaml:"metadata_snapshot_period" env:"BEYLA_KUBE_METADATA_SNAPSHOT_PERIOD"`
+	// MetadataSnapshotGrace is the time, after the informers are synced, during which the restored metadata
+	// that has not been confirmed by the informers is still used
+	MetadataSnapshotGrace time.Duration `yaml:"metadata_snapshot_grace" env:"BEYLA_KUBE_METADATA_SNAPSHOT_GRACE"`
+
+	// DebugEndpoint serves, from the internal metrics port, a JSON dump of the indexes of the Kubernetes
+	// metadata database, and the step-by-step lookups of IPs and PID namespaces, to troubleshoot the decoration.
+	DebugEndpoint bool `yaml:"debug_endpoint" env:"BEYLA_KUBE_DEBUG_ENDPOINT"`
+}
+
+// ExcludedNamespacesDecoration defines how the applications and peers of the namespaces that are excluded
+// from the decoration are decorated
+type ExcludedNamespacesDecoration string
+
+const (
+	// ExcludedDecorationNone doesn't decorate them, as if they weren't found in the cluster
+	ExcludedDecorationNone = ExcludedNamespacesDecoration("none")
+	// ExcludedDecorationNamespace only decorates them with their namespace
+	ExcludedDecorationNamespace = ExcludedNamespacesDecoration("namespace")
+)
+
+// MetadataSource defines where the Kubernetes metadata is taken from
+type MetadataSource string
+
+const (
+	// MetadataSourceInformers watches the objects of the cluster from the API server
+	MetadataSourceInformers = MetadataSource("informers")
+	// MetadataSourceKubelet periodically fetches the Pods of the local node from the kubelet, without
+	// accessing the API server. The traffic to the Pods of other nodes is not decorated.
+	MetadataSourceKubelet = MetadataSource("kubelet")
+)
+
+func (d *KubernetesDecorator) Validate() error {
+	for _, src := range d.ServiceNameSources {
+		if !src.valid() {
+			return fmt.Errorf("unknown service name source %q, choices are %v",
+				src, slices.Concat(DefaultServiceNameSources, []ServiceNameSource{ServiceNameFromService}))
+		}
+	}
+	if d.PodsCacheTTL < 0 {
+		return fmt.Errorf("pods_cache_ttl can't be negative. Got: %v", d.PodsCacheTTL)
+	}
+	if d.ProcessesSweepInterval < 0 {
+		return fmt.Errorf("processes_sweep_interval can't be negative. Got: %v", d.ProcessesSweepInterval)
+	}
+	for _, cidr := range d.ServiceCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid service_cidrs entry %q: %w", cidr, err)
+		}
+	}
+	if d.DeletedPodsGracePeriod < 0 {
+		return fmt.Errorf("deleted_pods_grace_period can't be negative. Got: %v", d.DeletedPodsGracePeriod)
+	}
+	if d.UnknownIPsCacheLen < 0 {
+		return fmt.Errorf("unknown_ips_cache_len can't be negative. Got: %v", d.UnknownIPsCacheLen)
+	}
+	if err := d.validateClient(); err != nil {
+		return err
+	}
+	switch d.MetadataSource {
+	case "", MetadataSourceInformers:
+	case MetadataSourceKubelet:
+		if err := d.validateKubelet(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown metadata_source %q, choices are %q and %q",
+			d.MetadataSource, MetadataSourceInformers, MetadataSourceKubelet)
+	}
+	if d.ReplicaSetLookupCacheLen < 0 {
+		return fmt.Errorf("replicaset_lookup_cache_len can't be negative. Got: %v", d.ReplicaSetLookupCacheLen)
+	}
+	if d.JobLookupCacheLen < 0 {
+		return fmt.Errorf("job_lookup_cache_len can't be negative. Got: %v", d.JobLookupCacheLen)
+	}
+	if d.ExternalNameServices && d.ExternalNamesRefresh <= 0 {
+		return fmt.Errorf("external_names_refresh must be positive. Got: %v", d.ExternalNamesRefresh)
+	}
+	for _, pattern := range d.NamespaceLabels {
+		if _, err := glob.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid namespace_labels pattern %q: %w", pattern, err)
+		}
+	}
+	if d.MetadataSnapshotPath != "" {
+		if d.MetadataSnapshotPeriod <= 0 {
+			return fmt.Errorf("metadata_snapshot_period must be positive. Got: %v", d.MetadataSnapshotPeriod)
+		}
+		if d.MetadataSnapshotGrace < 0 {
+			return fmt.Errorf("metadata_snapshot_grace can't be negative. Got: %v", d.MetadataSnapshotGrace)
+		}
+	}
+	if _, err := kube.NewNamespaceFilter(d.IncludeNamespaces, d.ExcludeNamespaces); err != nil {
+		return err
+	}
+	switch d.ExcludedNamespacesDecoration {
+	case "", ExcludedDecorationNone, ExcludedDecorationNamespace:
+	default:
+		return fmt.Errorf("unknown excluded_namespaces_decoration %q, choices are %q and %q",
+			d.ExcludedNamespacesDecoration, ExcludedDecorationNone, ExcludedDecorationNamespace)
+	}
+	return nil
+}
+
+// validateClient checks the options that select the API server
+func (d *KubernetesDecorator) validateClient() error {
+	if d.APIServerURL == "" {
+		if d.APIServerTokenPath != "" || d.APIServerCAPath != "" {
+			return errors.New("api_server_token_path and api_server_ca_path require api_server_url")
+		}
+	} else if d.KubeconfigContext != "" {
+		return errors.New("kubeconfig_context can't be combined with api_server_url")
+	}
+	if d.RemoteCluster && d.MetadataSource == MetadataSourceKubelet {
+		return errors.New("remote_cluster requires the informers metadata_source")
+	}
+	return nil
+}
+
+// ClientConfig returns the selection of the API server that the Kubernetes clients connect to
+func (d *KubernetesDecorator) ClientConfig() kube.ClientConfig {
+	return kube.ClientConfig{
+		KubeconfigPath: d.KubeconfigPath,
+		Context:        d.KubeconfigContext,
+		APIServerURL:   d.APIServerURL,
+		TokenPath:      d.APIServerTokenPath,
+		CAPath:         d.APIServerCAPath,
+	}
+}
+
+// validateKubelet checks the options of the kubelet metadata source, which can't be combined with the
+// options that watch other objects than the Pods
+func (d *KubernetesDecorator) validateKubelet() error {
+	if d.KubeletEndpoint == "" {
+		return errors.New("kubelet_endpoint is required by the kubelet metadata_source")
+	}
+	if d.KubeletRefresh <= 0 {
+		return fmt.Errorf("kubelet_refresh must be positive. Got: %v", d.KubeletRefresh)
+	}
+	for _, opt := range []struct {
+		name    string
+		enabled bool
+	}{
+		{name: "services_from_endpoints", enabled: d.ServicesFromEndpoints},
+		{name: "services_from_selectors", enabled: d.ServicesFromSelectors},
+		{name: "external_name_services", enabled: d.ExternalNameServices},
+		{name: "node_topology", enabled: d.NodeTopology},
+		{name: "namespace_labels", enabled: len(d.NamespaceLabels) > 0},
+	} {
+		if opt.enabled {
+			return fmt.Errorf("%s requires the informers metadata_source", opt.name)
+		}
+	}
+	return nil
+}
+
+// ExcludesNamespaces returns whether the decoration is restricted to a subset of the namespaces
+func (d *KubernetesDecorator) ExcludesNamespaces() bool {
+	return len(d.IncludeNamespaces) > 0 || len(d.ExcludeNamespaces) > 0
+}
+
+// NamespaceLabelAttributes returns the attributes of the namespace labels that are selected without
+// wildcards, so they can be reported by the metrics, whose attribute names must be known in advance.
+// They include the labels of the namespaces of the applications and of their peers.
+func (d *KubernetesDecorator) NamespaceLabelAttributes() []attr.Name {
+	var names, peerNames []attr.Name
+	for _, pattern := range d.NamespaceLabels {
+		if pattern != "" && !strings.ContainsAny(pattern, `*?[]{}\`) {
+			names = append(names, attr.K8sNamespaceLabel(pattern))
+			peerNames = append(peerNames, attr.K8sPeerNamespaceLabel(pattern))
+		}
+	}
+	return append(names, peerNames...)
 }
 
 func (d KubernetesDecorator) Enabled() bool {
@@ -54,7 +373,7 @@ func (d KubernetesDecorator) Enabled() bool {
 		return false
 	case string(EnabledAutodetect):
 		// We autodetect that we are in a kubernetes if we can properly load a K8s configuration file
-		_, err := kube.LoadConfig(d.KubeconfigPath)
+		_, err := d.ClientConfig().Load()
 		if err != nil {
 			klog().Debug("kubeconfig can't be detected. Assuming we are not in Kubernetes", "error", err)
 			return false
@@ -74,18 +393,76 @@ func KubeDecoratorProvider(
 			// if kubernetes decoration is disabled, we just bypass the node
 			return pipe.Bypass[[]request.Span](), nil
 		}
-		decorator := &metadataDecorator{db: ctxInfo.AppO11y.K8sDatabase}
-		return decorator.nodeLoop, nil
+		var db kubeDatabase = ctxInfo.AppO11y.K8sDatabase
+		replay := ctxInfo.AppO11y.Replay != nil
+		if replay {
+			// the replayed spans are decorated with the metadata that was recorded with them
+			db = ctxInfo.AppO11y.Replay.Snapshot
+		}
+		decorator := &metadataDecorator{
+			db:           db,
+			restartCount: kubeDecorator.ContainerRestartCount,
+			image:        kubeDecorator.ContainerImage,
+			names:        newServiceNamer(kubeDecorator.ServiceNameSources),
+		}
+		// the recordings don't contain the namespace labels, the nodes nor the cluster name
+		if len(kubeDecorator.NamespaceLabels) > 0 && !replay {
+			decorator.nsLabels = newNamespaceLabels(ctxInfo.AppO11y.K8sDatabase,
+				kubeDecorator.NamespaceLabels, attr.K8sNamespaceLabel)
+		}
+		if kubeDecorator.ServicesFromSelectors && !replay {
+			decorator.names.services = ctxInfo.AppO11y.K8sDatabase.ServicesForPod
+		}
+		if kubeDecorator.NodeTopology && !replay {
+			decorator.nodes = ctxInfo.AppO11y.K8sDatabase
+		}
+		if !replay {
+			decorator.cluster = ctxInfo.AppO11y.K8sDatabase
+		}
+		loop := decorator.nodeLoop
+		if kubeDecorator.DecorationWorkers > 1 {
+			decorator.workers = kubeDecorator.DecorationWorkers
+			loop = decorator.parallelLoop
+		}
+		// the recorded metadata doesn't change, so it is not worth waiting for it
+		if kubeDecorator.MetadataWait <= 0 || replay {
+			return loop, nil
+		}
+		delayed := newDelayedDecorator(decorator, kubeDecorator.MetadataWait, ctxInfo.Metrics)
+		if kubeDecorator.ExcludesNamespaces() {
+			delayed.excluded = ctxInfo.AppO11y.K8sDatabase.OwnerPodExcluded
+		}
+		return func(in <-chan []request.Span, out chan<- []request.Span) {
+			decorated := make(chan []request.Span, cap(out))
+			go func() {
+				loop(in, decorated)
+				close(decorated)
+			}()
+			delayed.loop(decorated, out)
+		}, nil
 	}
 }
 
 // production implementer: kube.Database
 type kubeDatabase interface {
-	OwnerPodInfo(pidNamespace uint32) (*kube.PodInfo, bool)
+	OwnerPodInfo(pidNamespace, hostPID uint32) (*kube.PodInfo, bool)
+	ContainerID(pidNamespace, hostPID uint32) (string, bool)
 }
 
 type metadataDecorator struct {
-	db kubeDatabase
+	db      kubeDatabase
+	workers int
+	// restartCount enables the decoration with the k8s.container.restart_count attribute
+	restartCount bool
+	// image enables the decoration with the container.image.name and container.image.tag attributes
+	image bool
+	names *serviceNamer
+	// nsLabels is nil if no namespace labels are selected
+	nsLabels *namespaceLabels
+	// nodes is nil if the node topology is not enabled
+	nodes nodeSource
+	// cluster is nil when the spans are replayed
+	cluster clusterNameSource
 }
 
 func (md *metadataDecorator) nodeLoop(in <-chan []request.Span, out chan<- []request.Span) {
@@ -100,24 +477,76 @@ func (md *metadataDecorator) nodeLoop(in <-chan []request.Span, out chan<- []req
 	klog().Debug("stopping kubernetes decoration loop")
 }
 
+// decorationJob is a batch of spans that is decorated by any of the workers of the parallelLoop.
+// The done channel is closed when the decoration finishes.
+type decorationJob struct {
+	spans []request.Span
+	done  chan struct{}
+}
+
+// parallelLoop decorates the batches of spans from a pool of workers, and forwards them in
+// the same order as they were received, so the ordering of the spans of the same connection
+// (required for some correlations in later stages) is preserved.
+func (md *metadataDecorator) parallelLoop(in <-chan []request.Span, out chan<- []request.Span) {
+	klog().Debug("starting parallel kubernetes decoration loop", "workers", md.workers)
+	jobs := make(chan *decorationJob, md.workers)
+	// the length of the ordered queue bounds the number of batches that are being decorated
+	// or waiting to be forwarded
+	ordered := make(chan *decorationJob, md.workers)
+	for i := 0; i < md.workers; i++ {
+		go func() {
+			for job := range jobs {
+				for i := range job.spans {
+					md.do(&job.spans[i])
+				}
+				close(job.done)
+			}
+		}()
+	}
+	forwarded := make(chan struct{})
+	go func() {
+		for job := range ordered {
+			<-job.done
+			out <- job.spans
+		}
+		close(forwarded)
+	}()
+	for spans := range in {
+		job := &decorationJob{spans: spans, done: make(chan struct{})}
+		ordered <- job
+		jobs <- job
+	}
+	close(jobs)
+	close(ordered)
+	<-forwarded
+	klog().Debug("stopping parallel kubernetes decoration loop")
+}
+
 func (md *metadataDecorator) do(span *request.Span) {
-	if podInfo, ok := md.db.OwnerPodInfo(span.Pid.Namespace); ok {
-		appendMetadata(span, podInfo)
+	if podInfo, ok := md.db.OwnerPodInfo(span.Pid.Namespace, span.Pid.HostPID); ok {
+		md.appendMetadata(span, podInfo)
 	} else {
 		// do not leave the service attributes map as nil
 		span.ServiceID.Metadata = map[attr.Name]string{}
 	}
 }
 
-func appendMetadata(span *request.Span, info *kube.PodInfo) {
+func (md *metadataDecorator) appendMetadata(span *request.Span, info *kube.PodInfo) {
+	// the container ID is looked up for each span, as it changes when the container is restarted
+	containerID, hasContainer := md.db.ContainerID(span.Pid.Namespace, span.Pid.HostPID)
 	// If the user has not defined criteria values for the reported
 	// service name and namespace, we will automatically set it from
 	// the kubernetes metadata
 	if span.ServiceID.AutoName {
-		span.ServiceID.Name = info.ServiceName()
+		span.ServiceID.Name = md.names.serviceName(span, info, containerID)
 	}
 	if span.ServiceID.Namespace == "" {
-		span.ServiceID.Namespace = info.Namespace
+		span.ServiceID.Namespace = info.ServiceNamespace()
+	}
+	if info.Excluded {
+		// the pods of the excluded namespaces are decorated only with their namespace, if configured so
+		span.ServiceID.Metadata = map[attr.Name]string{attr.K8sNamespaceName: info.Namespace}
+		return
 	}
 	span.ServiceID.UID = svc.UID(info.UID)
 
@@ -130,9 +559,119 @@ func appendMetadata(span *request.Span, info *kube.PodInfo) {
 		attr.K8sPodUID:        string(info.UID),
 		attr.K8sPodStartTime:  info.StartTimeStr,
 	}
+	if info.ServiceAccount != "" {
+		span.ServiceID.Metadata[attr.K8sPodServiceAccount] = info.ServiceAccount
+	}
+	// the cluster name is resolved in background, so it is missing in the first spans
+	if md.cluster != nil {
+		if name := md.cluster.ClusterName(); name != "" {
+			span.ServiceID.Metadata[attr.K8sClusterName] = name
+		}
+	}
 	owner := info.Owner
 	for owner != nil {
 		span.ServiceID.Metadata[owner.Type.LabelName()] = owner.Name
 		owner = owner.Owner
 	}
+	if md.nsLabels != nil {
+		md.nsLabels.decorate(span.ServiceID.Metadata, info.Namespace)
+	}
+	// the node is looked up for each span, so the spans of the pods whose node has not been observed
+	// yet get their topology as soon as it is
+	if md.nodes != nil && info.NodeName != "" {
+		if node, ok := md.nodes.NodeInfo(info.NodeName); ok {
+			if node.Zone != "" {
+				span.ServiceID.Metadata[attr.CloudAvailabilityZone] = node.Zone
+			}
+			if node.Region != "" {
+				span.ServiceID.Metadata[attr.CloudRegion] = node.Region
+			}
+		}
+	}
+	if !hasContainer {
+		return
+	}
+	span.ServiceID.Metadata[attr.ContainerID] = containerID
+	// the status of the containers might not have been reported yet, e.g. when the pod has just been created
+	if container, ok := info.Container(containerID); ok {
+		span.ServiceID.Metadata[attr.K8sContainerName] = container.Name
+		if md.image {
+			name, tag := splitImage(container.Image)
+			span.ServiceID.Metadata[attr.ContainerImageName] = name
+			if tag != "" {
+				span.ServiceID.Metadata[attr.ContainerImageTag] = tag
+			}
+		}
+	}
+	if md.restartCount {
+		// the restart count is read from the cached pod, which is updated with the pod status
+		if restarts, ok := info.ContainerRestarts[containerID]; ok {
+			span.ServiceID.Metadata[attr.K8sContainerRestartCount] = strconv.Itoa(int(restarts))
+		}
+	}
+}
+
+// splitImage returns the name and the tag of a container image reference, discarding its digest.
+// The name keeps the registry and the repository path.
+func splitImage(image string) (name, tag string) {
+	if at := strings.IndexByte(image, '@'); at >= 0 {
+		image = image[:at]
+	}
+	// a colon before the last slash belongs to the port of the registry
+	if colon := strings.LastIndexByte(image, ':'); colon > strings.LastIndexByte(image, '/') {
+		return image[:colon], image[colon+1:]
+	}
+	return image, ""
+}
+
+// production implementer: kube.Database
+type clusterNameSource interface {
+	ClusterName() string
+}
+
+// production implementer: kube.Database
+type nodeSource interface {
+	NodeInfo(name string) (*kube.NodeInfo, bool)
+}
+
+// production implementer: kube.Database
+type namespaceLabelsSource interface {
+	NamespaceLabels(namespace string) (map[string]string, bool)
+}
+
+// namespaceLabels adds the selected labels of the namespaces to the span attributes. The labels are
+// looked up for each span instead of being cached with the pod, so the changes in the namespace labels
+// are applied without restarting, and the namespaces that are not known yet are retried later.
+type namespaceLabels struct {
+	source namespaceLabelsSource
+	globs  []glob.Glob
+	// attrName returns the attribute of a label key, which is different for the namespaces of the
+	// instrumented applications and for the namespaces of their peers
+	attrName func(key string) attr.Name
+}
+
+// newNamespaceLabels expects that the patterns have been already validated
+func newNamespaceLabels(
+	source namespaceLabelsSource, patterns []string, attrName func(key string) attr.Name,
+) *namespaceLabels {
+	nl := &namespaceLabels{source: source, attrName: attrName}
+	for _, pattern := range patterns {
+		nl.globs = append(nl.globs, glob.MustCompile(pattern))
+	}
+	return nl
+}
+
+func (nl *namespaceLabels) decorate(metadata map[attr.Name]string, namespace string) {
+	labels, ok := nl.source.NamespaceLabels(namespace)
+	if !ok {
+		return
+	}
+	for key, value := range labels {
+		for _, g := range nl.globs {
+			if g.Match(key) {
+				metadata[nl.attrName(key)] = value
+				break
+			}
+		}
+	}
 }
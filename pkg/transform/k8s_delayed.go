@@ -0,0 +1,171 @@
+package transform
+
+import (
+	"time"
+
+	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+	"github.com/grafana/beyla/pkg/internal/request"
+)
+
+const (
+	// minimum and maximum time between two lookups of the metadata of a delayed PID namespace
+	minDelayedRetry = 100 * time.Millisecond
+	maxDelayedRetry = time.Second
+	// maxDelayedSpans bounds the memory used by the delayed spans. When the limit is reached,
+	// the spans are forwarded without waiting for their metadata.
+	maxDelayedSpans = 10_000
+)
+
+// delayedNamespace contains the spans of a PID namespace whose Kubernetes metadata is not yet available
+type delayedNamespace struct {
+	spans     []request.Span
+	deadline  time.Time
+	nextRetry time.Time
+	backoff   time.Duration
+}
+
+// delayedDecorator holds the spans that couldn't be decorated because the metadata of their PID
+// namespace was not yet available, usually because the Kubernetes informers haven't yet indexed
+// a recently created pod, or they are still being synchronized after Beyla starts.
+// It looks up the metadata again with an increasing backoff, and forwards the spans when it
+// is available, or undecorated when the wait time expires. Since then, the spans of a namespace
+// whose metadata couldn't be found are forwarded without waiting.
+// The order of the spans of the same PID namespace is preserved.
+type delayedDecorator struct {
+	md      *metadataDecorator
+	wait    time.Duration
+	metrics imetrics.Reporter
+
+	delayed map[uint32]*delayedNamespace
+	// total number of spans in the delayed map
+	delayedSpans int
+	// PID namespaces whose metadata wasn't found after waiting for it
+	unresolved map[uint32]struct{}
+	// excluded returns whether the pod of a PID namespace exists, but it isn't decorated because its
+	// namespace is excluded, so there is nothing to wait for. Nil if no namespace is excluded.
+	excluded func(pidNamespace, hostPID uint32) bool
+}
+
+func newDelayedDecorator(md *metadataDecorator, wait time.Duration, metrics imetrics.Reporter) *delayedDecorator {
+	if metrics == nil {
+		metrics = imetrics.NoopReporter{}
+	}
+	return &delayedDecorator{
+		md:         md,
+		wait:       wait,
+		metrics:    metrics,
+		delayed:    map[uint32]*delayedNamespace{},
+		unresolved: map[uint32]struct{}{},
+	}
+}
+
+// loop reads the spans that have been already decorated, and forwards them to the output, except
+// the spans that couldn't be decorated, which are delayed until their metadata is available.
+func (dd *delayedDecorator) loop(in <-chan []request.Span, out chan<- []request.Span) {
+	ticker := time.NewTicker(minDelayedRetry)
+	defer ticker.Stop()
+	for {
+		select {
+		case spans, ok := <-in:
+			if !ok {
+				// last chance to decorate the delayed spans before forwarding them
+				dd.retry(time.Now().Add(dd.wait), out)
+				return
+			}
+			if forward := dd.hold(spans, time.Now()); len(forward) > 0 {
+				out <- forward
+			}
+		case now := <-ticker.C:
+			dd.retry(now, out)
+		}
+	}
+}
+
+// hold delays the undecorated spans, as well as the spans of the namespaces that have already delayed spans,
+// and returns the spans that can be forwarded.
+func (dd *delayedDecorator) hold(spans []request.Span, now time.Time) []request.Span {
+	forward := make([]request.Span, 0, len(spans))
+	for i := range spans {
+		ns := spans[i].Pid.Namespace
+		if dn, ok := dd.delayed[ns]; ok {
+			if dd.delayedSpans >= maxDelayedSpans {
+				// stop waiting for this namespace, forwarding its spans in order
+				forward = append(forward, dn.spans...)
+				forward = append(forward, spans[i])
+				dd.release(ns, false)
+				continue
+			}
+			dn.spans = append(dn.spans, spans[i])
+			dd.delayedSpans++
+			continue
+		}
+		if decorated(&spans[i]) || dd.excludedPod(&spans[i]) {
+			delete(dd.unresolved, ns)
+			forward = append(forward, spans[i])
+			continue
+		}
+		if _, ok := dd.unresolved[ns]; ok || dd.delayedSpans >= maxDelayedSpans {
+			forward = append(forward, spans[i])
+			continue
+		}
+		dd.delayed[ns] = &delayedNamespace{
+			spans:     []request.Span{spans[i]},
+			deadline:  now.Add(dd.wait),
+			nextRetry: now.Add(minDelayedRetry),
+			backoff:   minDelayedRetry,
+		}
+		dd.delayedSpans++
+	}
+	return forward
+}
+
+// retry looks up again the metadata of the delayed namespaces whose backoff expired, and forwards
+// their spans if the metadata is found or the wait time expired.
+func (dd *delayedDecorator) retry(now time.Time, out chan<- []request.Span) {
+	var forward []request.Span
+	for ns, dn := range dd.delayed {
+		if now.Before(dn.nextRetry) {
+			continue
+		}
+		if _, ok := dd.md.db.OwnerPodInfo(ns, dn.spans[0].Pid.HostPID); ok || dd.excludedPod(&dn.spans[0]) {
+			// the spans are looked up one by one, as the processes of a namespace that is shared by
+			// multiple pods belong to different pods
+			for i := range dn.spans {
+				dd.md.do(&dn.spans[i])
+			}
+			forward = append(forward, dn.spans...)
+			dd.release(ns, true)
+			continue
+		}
+		if !now.Before(dn.deadline) {
+			klog().Debug("Kubernetes metadata not found. Forwarding undecorated spans",
+				"pidNamespace", ns, "spans", len(dn.spans))
+			forward = append(forward, dn.spans...)
+			dd.release(ns, false)
+			dd.unresolved[ns] = struct{}{}
+			continue
+		}
+		dn.backoff = min(2*dn.backoff, maxDelayedRetry)
+		dn.nextRetry = now.Add(dn.backoff)
+	}
+	if len(forward) > 0 {
+		out <- forward
+	}
+}
+
+func (dd *delayedDecorator) release(ns uint32, resolved bool) {
+	dd.delayedSpans -= len(dd.delayed[ns].spans)
+	delete(dd.delayed, ns)
+	dd.metrics.KubeDelayedDecoration(resolved)
+}
+
+// decorated returns whether the span has been decorated with the metadata of its pod
+func (dd *delayedDecorator) excludedPod(span *request.Span) bool {
+	return dd.excluded != nil && dd.excluded(span.Pid.Namespace, span.Pid.HostPID)
+}
+
+func decorated(span *request.Span) bool {
+	_, ok := span.ServiceID.Metadata[attr.K8sPodName]
+	return ok
+}
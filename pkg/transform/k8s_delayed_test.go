@@ -0,0 +1,206 @@
+package transform
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+	"github.com/grafana/beyla/pkg/internal/kube"
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/testutil"
+)
+
+// informerDatabase simulates a Kubernetes database whose pods are indexed while the test runs
+type informerDatabase struct {
+	mt   sync.Mutex
+	pods map[uint32]*kube.PodInfo
+}
+
+func (d *informerDatabase) OwnerPodInfo(pidNamespace, _ uint32) (*kube.PodInfo, bool) {
+	d.mt.Lock()
+	defer d.mt.Unlock()
+	pi, ok := d.pods[pidNamespace]
+	return pi, ok
+}
+
+func (d *informerDatabase) ContainerID(_, _ uint32) (string, bool) {
+	return "", false
+}
+
+func (d *informerDatabase) index(pidNamespace uint32, name string) {
+	d.mt.Lock()
+	defer d.mt.Unlock()
+	d.pods[pidNamespace] = &kube.PodInfo{ObjectMeta: v1.ObjectMeta{Name: name, Namespace: "the-ns", UID: types.UID("uid-" + name)}}
+}
+
+type delayedRecorder struct {
+	imetrics.NoopReporter
+	resolved, unresolved int
+}
+
+func (d *delayedRecorder) KubeDelayedDecoration(resolved bool) {
+	if resolved {
+		d.resolved++
+	} else {
+		d.unresolved++
+	}
+}
+
+// decoratedSpans simulates the output of the metadataDecorator stage
+func decoratedSpans(db kubeDatabase, spans ...request.Span) []request.Span {
+	md := metadataDecorator{db: db}
+	for i := range spans {
+		md.do(&spans[i])
+	}
+	return spans
+}
+
+func span(pidNamespace uint32, path string) request.Span {
+	return request.Span{Pid: request.PidInfo{Namespace: pidNamespace}, Path: path}
+}
+
+func paths(spans []request.Span) []string {
+	var p []string
+	for i := range spans {
+		p = append(p, spans[i].Path)
+	}
+	return p
+}
+
+func TestDelayedDecoration_LateMetadata(t *testing.T) {
+	// GIVEN a database that still doesn't contain the metadata of the pod in the PID namespace 34
+	db := &informerDatabase{pods: map[uint32]*kube.PodInfo{}}
+	db.index(12, "pod-12")
+	metrics := &delayedRecorder{}
+	dd := newDelayedDecorator(&metadataDecorator{db: db}, 5*time.Second, metrics)
+	out := make(chan []request.Span, 10)
+	start := time.Now()
+
+	// WHEN it receives spans from both PID namespaces
+	forward := dd.hold(decoratedSpans(db, span(12, "/a"), span(34, "/b"), span(12, "/c"), span(34, "/d")), start)
+
+	// THEN the spans with metadata are forwarded, and the rest are delayed
+	assert.Equal(t, []string{"/a", "/c"}, paths(forward))
+	dd.retry(start.Add(minDelayedRetry/2), out)
+	assert.Empty(t, out)
+
+	// AND the delayed spans are decorated and forwarded, in order, once the metadata is available
+	dd.retry(start.Add(minDelayedRetry), out)
+	assert.Empty(t, out)
+	db.index(34, "pod-34")
+	dd.retry(start.Add(3*minDelayedRetry), out)
+	late := testutil.ReadChannel(t, out, timeout)
+	assert.Equal(t, []string{"/b", "/d"}, paths(late))
+	for i := range late {
+		assert.Equal(t, "pod-34", late[i].ServiceID.Metadata["k8s.pod.name"])
+	}
+	assert.Equal(t, 1, metrics.resolved)
+	assert.Zero(t, metrics.unresolved)
+
+	// AND the later spans of the namespace are forwarded without delay
+	forward = dd.hold(decoratedSpans(db, span(34, "/e")), start.Add(time.Second))
+	assert.Equal(t, []string{"/e"}, paths(forward))
+	assert.Empty(t, dd.delayed)
+	assert.Zero(t, dd.delayedSpans)
+}
+
+func TestDelayedDecoration_Unresolved(t *testing.T) {
+	// GIVEN a database that never contains the metadata of the PID namespace 56
+	db := &informerDatabase{pods: map[uint32]*kube.PodInfo{}}
+	metrics := &delayedRecorder{}
+	dd := newDelayedDecorator(&metadataDecorator{db: db}, 5*time.Second, metrics)
+	out := make(chan []request.Span, 10)
+	start := time.Now()
+
+	// WHEN it receives spans from the namespace
+	assert.Empty(t, dd.hold(decoratedSpans(db, span(56, "/a")), start))
+	assert.Empty(t, dd.hold(decoratedSpans(db, span(56, "/b")), start.Add(time.Second)))
+
+	// THEN the spans are delayed until the wait time expires
+	dd.retry(start.Add(4*time.Second), out)
+	assert.Empty(t, out)
+	dd.retry(start.Add(5*time.Second), out)
+	// AND then forwarded undecorated
+	undecorated := testutil.ReadChannel(t, out, timeout)
+	assert.Equal(t, []string{"/a", "/b"}, paths(undecorated))
+	for i := range undecorated {
+		assert.Empty(t, undecorated[i].ServiceID.Metadata)
+	}
+	assert.Zero(t, metrics.resolved)
+	assert.Equal(t, 1, metrics.unresolved)
+
+	// AND the later spans of the namespace are forwarded without delay
+	assert.Equal(t, []string{"/c"}, paths(dd.hold(decoratedSpans(db, span(56, "/c")), start.Add(6*time.Second))))
+
+	// UNLESS its metadata is found again and then lost
+	db.index(56, "pod-56")
+	assert.Equal(t, []string{"/d"}, paths(dd.hold(decoratedSpans(db, span(56, "/d")), start.Add(7*time.Second))))
+	db.mt.Lock()
+	delete(db.pods, 56)
+	db.mt.Unlock()
+	assert.Empty(t, dd.hold(decoratedSpans(db, span(56, "/e")), start.Add(8*time.Second)))
+}
+
+func TestDelayedDecoration_ExcludedNamespaces(t *testing.T) {
+	// GIVEN a database whose pods of PID namespaces 34 and 56 belong to namespaces excluded from the
+	// decoration, the former being decorated only with its namespace and the latter not being found
+	db := &informerDatabase{pods: map[uint32]*kube.PodInfo{
+		34: {ObjectMeta: v1.ObjectMeta{Namespace: "kube-system"}, Excluded: true},
+	}}
+	db.index(12, "pod-12")
+	dd := newDelayedDecorator(&metadataDecorator{db: db}, 5*time.Second, nil)
+	dd.excluded = func(pidNamespace, _ uint32) bool {
+		return pidNamespace == 34 || pidNamespace == 56
+	}
+
+	// WHEN it receives spans from all the PID namespaces
+	forward := dd.hold(decoratedSpans(db, span(12, "/a"), span(34, "/b"), span(56, "/c")), time.Now())
+
+	// THEN the spans of the excluded namespaces are forwarded without waiting for their metadata
+	assert.Equal(t, []string{"/a", "/b", "/c"}, paths(forward))
+	assert.Empty(t, dd.delayed)
+	// AND they are only decorated with their namespace, if found
+	assert.Equal(t, "pod-12", forward[0].ServiceID.Metadata["k8s.pod.name"])
+	assert.Equal(t, map[attr.Name]string{attr.K8sNamespaceName: "kube-system"}, forward[1].ServiceID.Metadata)
+	assert.Empty(t, forward[2].ServiceID.Metadata)
+}
+
+func TestDelayedDecoration_Loop(t *testing.T) {
+	db := &informerDatabase{pods: map[uint32]*kube.PodInfo{}}
+	dd := newDelayedDecorator(&metadataDecorator{db: db}, time.Minute, nil)
+	in, out := make(chan []request.Span, 10), make(chan []request.Span, 10)
+	done := make(chan struct{})
+	go func() {
+		dd.loop(in, out)
+		close(done)
+	}()
+
+	// GIVEN some spans delayed because their metadata is not available
+	in <- decoratedSpans(db, span(34, "/a"), span(34, "/b"))
+	select {
+	case spans := <-out:
+		require.Failf(t, "spans should have been delayed", "got %v", paths(spans))
+	case <-time.After(3 * minDelayedRetry):
+	}
+
+	// WHEN the metadata is available
+	db.index(34, "pod-34")
+
+	// THEN the spans are forwarded
+	spans := testutil.ReadChannel(t, out, timeout)
+	assert.Equal(t, []string{"/a", "/b"}, paths(spans))
+
+	// AND the delayed spans are forwarded when the input channel is closed
+	in <- decoratedSpans(db, span(78, "/c"))
+	close(in)
+	spans = testutil.ReadChannel(t, out, timeout)
+	assert.Equal(t, []string{"/c"}, paths(spans))
+	testutil.ReadChannel(t, done, timeout)
+}
@@ -0,0 +1,177 @@
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/grafana/beyla/pkg/internal/kube"
+	"github.com/grafana/beyla/pkg/internal/request"
+)
+
+// ServiceNameSource is a source of the service name of the applications running in Kubernetes,
+// when the user didn't explicitly define it in the discovery criteria.
+type ServiceNameSource string
+
+const (
+	// ServiceNameFromAnnotation takes the value of the resource.opentelemetry.io/service.name Pod annotation
+	ServiceNameFromAnnotation = ServiceNameSource("annotation")
+	// ServiceNameFromEnv takes the OTEL_SERVICE_NAME or the service.name entry of the
+	// OTEL_RESOURCE_ATTRIBUTES environment variables of the instrumented process
+	ServiceNameFromEnv = ServiceNameSource("env")
+	// ServiceNameFromOwner takes the name of the topmost owner of the Pod (e.g. Deployment), or
+	// the name of the Pod if it doesn't have any owner
+	ServiceNameFromOwner = ServiceNameSource("owner")
+	// ServiceNameFromContainer takes the name of the container of the instrumented process
+	ServiceNameFromContainer = ServiceNameSource("container")
+	// ServiceNameFromImage takes the image name of the container of the instrumented process,
+	// without the registry, tag and digest
+	ServiceNameFromImage = ServiceNameSource("image")
+	// ServiceNameFromService takes the name of the first Service, in alphabetical order, whose selector
+	// matches the labels of the Pod. It requires watching the Services.
+	ServiceNameFromService = ServiceNameSource("service")
+
+	// serviceNameFromExecutable is the last fallback, when none of the configured sources
+	// provides a name. It can't be configured.
+	serviceNameFromExecutable = ServiceNameSource("executable")
+
+	// max number of processes whose resolved service name is cached
+	serviceNamesCacheLen = 1024
+)
+
+// DefaultServiceNameSources is the fallback chain of the service name when it isn't configured
+var DefaultServiceNameSources = []ServiceNameSource{
+	ServiceNameFromAnnotation,
+	ServiceNameFromEnv,
+	ServiceNameFromOwner,
+	ServiceNameFromContainer,
+	ServiceNameFromImage,
+}
+
+func (s ServiceNameSource) valid() bool {
+	return s == ServiceNameFromService || slices.Contains(DefaultServiceNameSources, s)
+}
+
+// procEnviron returns the environment variables of a process, separated by null characters
+var procEnviron = func(pid uint32) ([]byte, error) {
+	return os.ReadFile(fmt.Sprintf("/proc/%d/environ", pid))
+}
+
+// namedProcess identifies a process whose service name has been resolved. The name annotation is
+// part of the key, so a name is resolved again when the annotation of a running Pod changes.
+type namedProcess struct {
+	pid            uint32
+	podUID         types.UID
+	containerID    string
+	nameAnnotation string
+}
+
+// serviceNamer resolves the service name of the Kubernetes applications, taking it from the first of the
+// configured sources that provides a non-empty value. If none of them provides it, the executable name
+// that was set during the process discovery is kept.
+type serviceNamer struct {
+	sources []ServiceNameSource
+	// resolved names by process, as looking up the process environment for each span would be costly
+	resolved *lru.Cache[namedProcess, string]
+	// services returns the Services that select a Pod. Nil if they are not available.
+	services func(pod *kube.PodInfo) []*kube.ServiceInfo
+}
+
+func newServiceNamer(sources []ServiceNameSource) *serviceNamer {
+	if len(sources) == 0 {
+		sources = DefaultServiceNameSources
+	}
+	resolved, _ := lru.New[namedProcess, string](serviceNamesCacheLen)
+	return &serviceNamer{sources: sources, resolved: resolved}
+}
+
+func (sn *serviceNamer) serviceName(span *request.Span, info *kube.PodInfo, containerID string) string {
+	key := namedProcess{pid: span.Pid.HostPID, podUID: info.UID, containerID: containerID,
+		nameAnnotation: info.Annotations[kube.ServiceNameAnnotation]}
+	if name, ok := sn.resolved.Get(key); ok {
+		return name
+	}
+	name, source := span.ServiceID.Name, serviceNameFromExecutable
+	for _, src := range sn.sources {
+		if n := sn.fromSource(src, span, info, containerID); n != "" {
+			name, source = n, src
+			break
+		}
+	}
+	// the chosen source is only logged once per process, to help users understanding the service names
+	klog().Debug("resolved service name", "name", name, "source", source, "pid", span.Pid.HostPID,
+		"pod", info.Name, "namespace", info.Namespace, "containerID", containerID)
+	sn.resolved.Add(key, name)
+	return name
+}
+
+func (sn *serviceNamer) fromSource(src ServiceNameSource, span *request.Span, info *kube.PodInfo, containerID string) string {
+	switch src {
+	case ServiceNameFromAnnotation:
+		return info.Annotations[kube.ServiceNameAnnotation]
+	case ServiceNameFromEnv:
+		return serviceNameFromEnv(span.Pid.HostPID)
+	case ServiceNameFromOwner:
+		return info.OwnerName()
+	case ServiceNameFromContainer:
+		container, _ := info.Container(containerID)
+		return container.Name
+	case ServiceNameFromImage:
+		container, _ := info.Container(containerID)
+		return imageBaseName(container.Image)
+	case ServiceNameFromService:
+		if sn.services != nil {
+			if services := sn.services(info); len(services) > 0 {
+				return services[0].Name
+			}
+		}
+	}
+	return ""
+}
+
+// serviceNameFromEnv returns the service name as defined by the OpenTelemetry environment variables of
+// the process. OTEL_SERVICE_NAME takes precedence over the service.name resource attribute.
+func serviceNameFromEnv(pid uint32) string {
+	environ, err := procEnviron(pid)
+	if err != nil {
+		klog().Debug("can't read process environment", "pid", pid, "error", err)
+		return ""
+	}
+	resourceName := ""
+	for _, entry := range bytes.Split(environ, []byte{0}) {
+		key, value, _ := strings.Cut(string(entry), "=")
+		switch key {
+		case "OTEL_SERVICE_NAME":
+			if value != "" {
+				return value
+			}
+		case "OTEL_RESOURCE_ATTRIBUTES":
+			for _, attribute := range strings.Split(value, ",") {
+				if k, v, _ := strings.Cut(attribute, "="); strings.TrimSpace(k) == "service.name" {
+					resourceName = strings.TrimSpace(v)
+				}
+			}
+		}
+	}
+	return resourceName
+}
+
+// imageBaseName removes the registry, repository path, tag and digest from a container image.
+// For example, docker.io/library/nginx:1.25@sha256:abcd returns nginx.
+func imageBaseName(image string) string {
+	if at := strings.IndexByte(image, '@'); at >= 0 {
+		image = image[:at]
+	}
+	if slash := strings.LastIndexByte(image, '/'); slash >= 0 {
+		image = image[slash+1:]
+	}
+	if colon := strings.IndexByte(image, ':'); colon >= 0 {
+		image = image[:colon]
+	}
+	return image
+}
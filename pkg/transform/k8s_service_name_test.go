@@ -0,0 +1,152 @@
+package transform
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/grafana/beyla/pkg/internal/kube"
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+func fakeEnviron(t *testing.T, environs map[uint32]string) {
+	t.Helper()
+	origEnviron := procEnviron
+	t.Cleanup(func() { procEnviron = origEnviron })
+	procEnviron = func(pid uint32) ([]byte, error) {
+		if env, ok := environs[pid]; ok {
+			return []byte(env), nil
+		}
+		return nil, errors.New("no such process")
+	}
+}
+
+func TestServiceName_FallbackChain(t *testing.T) {
+	fakeEnviron(t, map[uint32]string{
+		1: "PATH=/bin\x00OTEL_SERVICE_NAME=from-env\x00OTEL_RESOURCE_ATTRIBUTES=service.name=from-resource",
+		2: "OTEL_RESOURCE_ATTRIBUTES=deployment.environment=prod, service.name=from-resource\x00HOME=/root",
+		3: "PATH=/bin\x00OTEL_SERVICE_NAME=",
+	})
+	annotated := &kube.PodInfo{
+		ObjectMeta: v1.ObjectMeta{Name: "the-pod", Namespace: "the-ns", UID: "uid-1",
+			Annotations: map[string]string{kube.ServiceNameAnnotation: "from-annotation"}},
+		Owner:      &kube.Owner{Type: kube.OwnerDeployment, Name: "the-deployment"},
+		Containers: map[string]kube.ContainerInfo{"cid": {Name: "the-container", Image: "registry:5000/org/the-image:1.2@sha256:abcd"}},
+	}
+	bare := &kube.PodInfo{
+		ObjectMeta: v1.ObjectMeta{Name: "the-pod", Namespace: "the-ns", UID: "uid-2"},
+		Containers: map[string]kube.ContainerInfo{"cid": {Name: "the-container", Image: "the-image"}},
+	}
+	type testCase struct {
+		name     string
+		sources  []ServiceNameSource
+		pid      uint32
+		pod      *kube.PodInfo
+		expected string
+	}
+	for _, tc := range []testCase{
+		{name: "annotation", pid: 1, pod: annotated, expected: "from-annotation"},
+		{name: "env", pid: 1, pod: bare, expected: "from-env"},
+		{name: "resource attributes", pid: 2, pod: bare, expected: "from-resource"},
+		{name: "empty env var", pid: 3, pod: bare, expected: "the-pod"},
+		{name: "owner", pid: 4, pod: annotated,
+			sources: []ServiceNameSource{ServiceNameFromEnv, ServiceNameFromOwner}, expected: "the-deployment"},
+		{name: "container", pid: 1, pod: annotated,
+			sources: []ServiceNameSource{ServiceNameFromContainer, ServiceNameFromOwner}, expected: "the-container"},
+		{name: "image", pid: 1, pod: annotated,
+			sources: []ServiceNameSource{ServiceNameFromImage}, expected: "the-image"},
+		{name: "executable", pid: 4, pod: bare,
+			sources: []ServiceNameSource{ServiceNameFromAnnotation, ServiceNameFromEnv}, expected: "java"},
+		{name: "service", pid: 4, pod: annotated,
+			sources: []ServiceNameSource{ServiceNameFromService, ServiceNameFromOwner}, expected: "the-service"},
+		{name: "no service", pid: 4, pod: bare,
+			sources: []ServiceNameSource{ServiceNameFromService, ServiceNameFromOwner}, expected: "the-pod"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sn := newServiceNamer(tc.sources)
+			// only the annotated pod is selected by Services
+			sn.services = func(pod *kube.PodInfo) []*kube.ServiceInfo {
+				if pod != annotated {
+					return nil
+				}
+				return []*kube.ServiceInfo{
+					{ObjectMeta: v1.ObjectMeta{Name: "the-service"}},
+					{ObjectMeta: v1.ObjectMeta{Name: "the-service-canary"}},
+				}
+			}
+			span := request.Span{Pid: request.PidInfo{HostPID: tc.pid}, ServiceID: svc.ID{Name: "java", AutoName: true}}
+			assert.Equal(t, tc.expected, sn.serviceName(&span, tc.pod, "cid"))
+		})
+	}
+}
+
+func TestServiceName_Cached(t *testing.T) {
+	// GIVEN a process whose service name is taken from its environment
+	environ := map[uint32]string{1: "OTEL_SERVICE_NAME=first"}
+	fakeEnviron(t, environ)
+	sn := newServiceNamer(nil)
+	pod := &kube.PodInfo{ObjectMeta: v1.ObjectMeta{Name: "the-pod", UID: "uid-1"}}
+	span := request.Span{Pid: request.PidInfo{HostPID: 1}, ServiceID: svc.ID{Name: "java", AutoName: true}}
+	assert.Equal(t, "first", sn.serviceName(&span, pod, "cid-1"))
+
+	// WHEN its environment is not accessible anymore
+	delete(environ, 1)
+
+	// THEN the resolved name is kept for the same process
+	assert.Equal(t, "first", sn.serviceName(&span, pod, "cid-1"))
+	// AND resolved again if the process runs in another container
+	assert.Equal(t, "the-pod", sn.serviceName(&span, pod, "cid-2"))
+
+	// AND WHEN the service name annotation is added to the running Pod
+	annotated := *pod
+	annotated.Annotations = map[string]string{kube.ServiceNameAnnotation: "from-annotation"}
+	// THEN the name is resolved again
+	assert.Equal(t, "from-annotation", sn.serviceName(&span, &annotated, "cid-1"))
+}
+
+func TestImageBaseName(t *testing.T) {
+	for image, expected := range map[string]string{
+		"nginx":                               "nginx",
+		"nginx:1.25":                          "nginx",
+		"docker.io/library/nginx:1.25":        "nginx",
+		"localhost:5000/team/api":             "api",
+		"localhost:5000/team/api:v2":          "api",
+		"ghcr.io/org/app@sha256:0123456789ab": "app",
+		"ghcr.io/org/app:1.0@sha256:0123456":  "app",
+		"":                                    "",
+	} {
+		assert.Equal(t, expected, imageBaseName(image), image)
+	}
+}
+
+func TestKubernetesDecorator_Validate(t *testing.T) {
+	assert.NoError(t, (&KubernetesDecorator{}).Validate())
+	assert.NoError(t, (&KubernetesDecorator{ServiceNameSources: []ServiceNameSource{"image", "owner"}}).Validate())
+	assert.Error(t, (&KubernetesDecorator{ServiceNameSources: []ServiceNameSource{"owner", "labels"}}).Validate())
+	assert.NoError(t, (&KubernetesDecorator{NamespaceLabels: []string{"team", "app.kubernetes.io/*"}}).Validate())
+	assert.Error(t, (&KubernetesDecorator{NamespaceLabels: []string{"team", "[environment"}}).Validate())
+
+	kubelet := KubernetesDecorator{MetadataSource: MetadataSourceKubelet,
+		KubeletEndpoint: "https://localhost:10250", KubeletRefresh: 10 * time.Second}
+	assert.NoError(t, kubelet.Validate())
+	noRefresh := kubelet
+	noRefresh.KubeletRefresh = 0
+	assert.Error(t, noRefresh.Validate())
+	withEndpoints := kubelet
+	withEndpoints.ServicesFromEndpoints = true
+	assert.ErrorContains(t, withEndpoints.Validate(), "services_from_endpoints")
+	assert.Error(t, (&KubernetesDecorator{MetadataSource: "apiserver"}).Validate())
+	remoteKubelet := kubelet
+	remoteKubelet.RemoteCluster = true
+	assert.ErrorContains(t, remoteKubelet.Validate(), "remote_cluster")
+
+	assert.NoError(t, (&KubernetesDecorator{KubeconfigContext: "prod", RemoteCluster: true}).Validate())
+	assert.NoError(t, (&KubernetesDecorator{APIServerURL: "https://10.0.0.1:6443",
+		APIServerTokenPath: "/etc/beyla/token", APIServerCAPath: "/etc/beyla/ca.crt"}).Validate())
+	assert.Error(t, (&KubernetesDecorator{APIServerURL: "https://10.0.0.1:6443", KubeconfigContext: "prod"}).Validate())
+	assert.Error(t, (&KubernetesDecorator{APIServerTokenPath: "/etc/beyla/token"}).Validate())
+}
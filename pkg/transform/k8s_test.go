@@ -1,12 +1,19 @@
 package transform
 
 import (
+	"context"
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	fakek8sclientset "k8s.io/client-go/kubernetes/fake"
 
 	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
 	"github.com/grafana/beyla/pkg/internal/kube"
@@ -18,14 +25,22 @@ import (
 const timeout = 5 * time.Second
 
 func TestDecoration(t *testing.T) {
+	testDecoration(t, 1)
+}
+
+func TestDecoration_Parallel(t *testing.T) {
+	testDecoration(t, 4)
+}
+
+func testDecoration(t *testing.T, workers int) {
 	// pre-populated kubernetes metadata database
-	dec := metadataDecorator{db: fakeDatabase{
+	dec := metadataDecorator{workers: workers, names: newServiceNamer(nil), db: fakeDatabase{
 		12: &kube.PodInfo{
 			ObjectMeta: v1.ObjectMeta{
 				Name: "pod-12", Namespace: "the-ns", UID: "uid-12",
 			},
 			NodeName:     "the-node",
-			StartTimeStr: "2020-01-02 12:12:56",
+			StartTimeStr: "2020-01-02T12:12:56Z",
 			Owner:        &kube.Owner{Type: kube.OwnerDeployment, Name: "deployment-12"},
 		},
 		34: &kube.PodInfo{
@@ -33,7 +48,7 @@ func TestDecoration(t *testing.T) {
 				Name: "pod-34", Namespace: "the-ns", UID: "uid-34",
 			},
 			NodeName:     "the-node",
-			StartTimeStr: "2020-01-02 12:34:56",
+			StartTimeStr: "2020-01-02T12:34:56Z",
 			Owner:        &kube.Owner{Type: kube.OwnerReplicaSet, Name: "rs-34"},
 		},
 		56: &kube.PodInfo{
@@ -41,12 +56,16 @@ func TestDecoration(t *testing.T) {
 				Name: "the-pod", Namespace: "the-ns", UID: "uid-56",
 			},
 			NodeName:     "the-node",
-			StartTimeStr: "2020-01-02 12:56:56",
+			StartTimeStr: "2020-01-02T12:56:56Z",
 		},
 	}}
 	inputCh, outputhCh := make(chan []request.Span, 10), make(chan []request.Span, 10)
 	defer close(inputCh)
-	go dec.nodeLoop(inputCh, outputhCh)
+	if workers > 1 {
+		go dec.parallelLoop(inputCh, outputhCh)
+	} else {
+		go dec.nodeLoop(inputCh, outputhCh)
+	}
 
 	t.Run("complete pod info should set deployment as name", func(t *testing.T) {
 		inputCh <- []request.Span{{
@@ -62,7 +81,8 @@ func TestDecoration(t *testing.T) {
 			"k8s.pod.name":        "pod-12",
 			"k8s.pod.uid":         "uid-12",
 			"k8s.deployment.name": "deployment-12",
-			"k8s.pod.start_time":  "2020-01-02 12:12:56",
+			"k8s.pod.start_time":  "2020-01-02T12:12:56Z",
+			"container.id":        "container-12",
 		}, deco[0].ServiceID.Metadata)
 	})
 	t.Run("pod info without deployment should set replicaset as name", func(t *testing.T) {
@@ -79,7 +99,8 @@ func TestDecoration(t *testing.T) {
 			"k8s.replicaset.name": "rs-34",
 			"k8s.pod.name":        "pod-34",
 			"k8s.pod.uid":         "uid-34",
-			"k8s.pod.start_time":  "2020-01-02 12:34:56",
+			"k8s.pod.start_time":  "2020-01-02T12:34:56Z",
+			"container.id":        "container-34",
 		}, deco[0].ServiceID.Metadata)
 	})
 	t.Run("pod info with only pod name should set pod name as name", func(t *testing.T) {
@@ -95,7 +116,8 @@ func TestDecoration(t *testing.T) {
 			"k8s.namespace.name": "the-ns",
 			"k8s.pod.name":       "the-pod",
 			"k8s.pod.uid":        "uid-56",
-			"k8s.pod.start_time": "2020-01-02 12:56:56",
+			"k8s.pod.start_time": "2020-01-02T12:56:56Z",
+			"container.id":       "container-56",
 		}, deco[0].ServiceID.Metadata)
 	})
 	t.Run("process without pod Info won't be decorated", func(t *testing.T) {
@@ -122,14 +144,391 @@ func TestDecoration(t *testing.T) {
 			"k8s.pod.name":        "pod-12",
 			"k8s.pod.uid":         "uid-12",
 			"k8s.deployment.name": "deployment-12",
-			"k8s.pod.start_time":  "2020-01-02 12:12:56",
+			"k8s.pod.start_time":  "2020-01-02T12:12:56Z",
+			"container.id":        "container-12",
 		}, deco[0].ServiceID.Metadata)
 	})
 }
 
 type fakeDatabase map[uint32]*kube.PodInfo
 
-func (f fakeDatabase) OwnerPodInfo(pidNamespace uint32) (*kube.PodInfo, bool) {
+func (f fakeDatabase) OwnerPodInfo(pidNamespace, _ uint32) (*kube.PodInfo, bool) {
 	pi, ok := f[pidNamespace]
 	return pi, ok
 }
+
+// the fake database runs each process in its own container, whose ID is derived from the PID namespace
+func (f fakeDatabase) ContainerID(pidNamespace, _ uint32) (string, bool) {
+	_, ok := f[pidNamespace]
+	return fmt.Sprintf("container-%d", pidNamespace), ok
+}
+
+func TestDecoration_ContainerRestartCount(t *testing.T) {
+	db := fakeDatabase{
+		12: &kube.PodInfo{
+			ObjectMeta:        v1.ObjectMeta{Name: "pod-12", Namespace: "the-ns"},
+			ContainerRestarts: map[string]int32{"container-12": 3, "other-container": 5},
+		},
+	}
+	// the restart count is only reported when it is enabled
+	sp := request.Span{Pid: request.PidInfo{Namespace: 12}}
+	(&metadataDecorator{db: db}).do(&sp)
+	assert.NotContains(t, sp.ServiceID.Metadata, attr.K8sContainerRestartCount)
+
+	sp = request.Span{Pid: request.PidInfo{Namespace: 12}}
+	(&metadataDecorator{db: db, restartCount: true}).do(&sp)
+	assert.Equal(t, "3", sp.ServiceID.Metadata[attr.K8sContainerRestartCount])
+}
+
+func TestDecoration_ContainerMetadata(t *testing.T) {
+	db := fakeDatabase{
+		12: &kube.PodInfo{
+			ObjectMeta: v1.ObjectMeta{Name: "pod-12", Namespace: "the-ns"},
+			Containers: map[string]kube.ContainerInfo{
+				"container-12":    {Name: "app", Image: "registry:5000/shop/app:1.2.3@sha256:abcd"},
+				"other-container": {Name: "istio-proxy", Image: "istio/proxyv2:1.20"},
+			},
+		},
+		// the status of the containers has not been reported yet
+		13: &kube.PodInfo{ObjectMeta: v1.ObjectMeta{Name: "pod-13", Namespace: "the-ns"}},
+	}
+	// the container name is reported for the container of the instrumented process
+	sp := request.Span{Pid: request.PidInfo{Namespace: 12}}
+	(&metadataDecorator{db: db}).do(&sp)
+	assert.Equal(t, "app", sp.ServiceID.Metadata[attr.K8sContainerName])
+	assert.NotContains(t, sp.ServiceID.Metadata, attr.ContainerImageName)
+
+	// the image is only reported when it is enabled
+	sp = request.Span{Pid: request.PidInfo{Namespace: 12}}
+	(&metadataDecorator{db: db, image: true}).do(&sp)
+	assert.Equal(t, "app", sp.ServiceID.Metadata[attr.K8sContainerName])
+	assert.Equal(t, "registry:5000/shop/app", sp.ServiceID.Metadata[attr.ContainerImageName])
+	assert.Equal(t, "1.2.3", sp.ServiceID.Metadata[attr.ContainerImageTag])
+
+	// pods without container statuses are decorated with the pod metadata only
+	sp = request.Span{Pid: request.PidInfo{Namespace: 13}}
+	(&metadataDecorator{db: db, image: true}).do(&sp)
+	assert.Equal(t, "pod-13", sp.ServiceID.Metadata[attr.K8sPodName])
+	assert.NotContains(t, sp.ServiceID.Metadata, attr.K8sContainerName)
+	assert.NotContains(t, sp.ServiceID.Metadata, attr.ContainerImageName)
+}
+
+type fakeNamespaces map[string]map[string]string
+
+func (f fakeNamespaces) NamespaceLabels(namespace string) (map[string]string, bool) {
+	labels, ok := f[namespace]
+	return labels, ok
+}
+
+func TestDecoration_NamespaceLabels(t *testing.T) {
+	db := fakeDatabase{
+		12: &kube.PodInfo{ObjectMeta: v1.ObjectMeta{Name: "pod-12", Namespace: "shop"}},
+	}
+	namespaces := fakeNamespaces{}
+	md := &metadataDecorator{db: db, nsLabels: newNamespaceLabels(namespaces, []string{"team", "cost-*"}, attr.K8sNamespaceLabel)}
+
+	// the spans of pods whose namespace is not known yet are decorated without labels
+	sp := request.Span{Pid: request.PidInfo{Namespace: 12}}
+	md.do(&sp)
+	assert.Equal(t, "pod-12", sp.ServiceID.Metadata[attr.K8sPodName])
+	assert.NotContains(t, sp.ServiceID.Metadata, attr.K8sNamespaceLabel("team"))
+
+	// but the labels are added as soon as the namespace is known
+	namespaces["shop"] = map[string]string{"team": "checkout", "cost-center": "cc-12", "environment": "prod"}
+	sp = request.Span{Pid: request.PidInfo{Namespace: 12}}
+	md.do(&sp)
+	assert.Equal(t, "checkout", sp.ServiceID.Metadata[attr.K8sNamespaceLabel("team")])
+	assert.Equal(t, "cc-12", sp.ServiceID.Metadata[attr.K8sNamespaceLabel("cost-center")])
+	assert.NotContains(t, sp.ServiceID.Metadata, attr.K8sNamespaceLabel("environment"))
+
+	// and the updates of the labels are applied to the next spans
+	namespaces["shop"] = map[string]string{"team": "payments"}
+	sp = request.Span{Pid: request.PidInfo{Namespace: 12}}
+	md.do(&sp)
+	assert.Equal(t, "payments", sp.ServiceID.Metadata[attr.K8sNamespaceLabel("team")])
+	assert.NotContains(t, sp.ServiceID.Metadata, attr.K8sNamespaceLabel("cost-center"))
+}
+
+type fakeNodes map[string]*kube.NodeInfo
+
+func (f fakeNodes) NodeInfo(name string) (*kube.NodeInfo, bool) {
+	node, ok := f[name]
+	return node, ok
+}
+
+func TestDecoration_NodeTopology(t *testing.T) {
+	db := fakeDatabase{
+		12: &kube.PodInfo{ObjectMeta: v1.ObjectMeta{Name: "pod-12", Namespace: "shop"}, NodeName: "node-1"},
+	}
+	nodes := fakeNodes{}
+	md := &metadataDecorator{db: db, nodes: nodes}
+
+	// the spans of pods whose node is not known yet are decorated without topology
+	sp := request.Span{Pid: request.PidInfo{Namespace: 12}}
+	md.do(&sp)
+	assert.Equal(t, "node-1", sp.ServiceID.Metadata[attr.K8sNodeName])
+	assert.NotContains(t, sp.ServiceID.Metadata, attr.CloudAvailabilityZone)
+
+	// but the topology is added as soon as the node is known
+	nodes["node-1"] = &kube.NodeInfo{Zone: "eu-west-1a", Region: "eu-west-1"}
+	sp = request.Span{Pid: request.PidInfo{Namespace: 12}}
+	md.do(&sp)
+	assert.Equal(t, "eu-west-1a", sp.ServiceID.Metadata[attr.CloudAvailabilityZone])
+	assert.Equal(t, "eu-west-1", sp.ServiceID.Metadata[attr.CloudRegion])
+
+	// and it is not added if the node topology is disabled
+	sp = request.Span{Pid: request.PidInfo{Namespace: 12}}
+	(&metadataDecorator{db: db}).do(&sp)
+	assert.NotContains(t, sp.ServiceID.Metadata, attr.CloudAvailabilityZone)
+}
+
+type fakeClusterName string
+
+func (f *fakeClusterName) ClusterName() string {
+	return string(*f)
+}
+
+func TestDecoration_ClusterName(t *testing.T) {
+	db := fakeDatabase{
+		12: &kube.PodInfo{ObjectMeta: v1.ObjectMeta{Name: "pod-12", Namespace: "shop"}},
+	}
+	cluster := fakeClusterName("")
+	md := &metadataDecorator{db: db, cluster: &cluster}
+
+	// the spans are decorated without the cluster name while it is not resolved
+	sp := request.Span{Pid: request.PidInfo{Namespace: 12}}
+	md.do(&sp)
+	assert.Equal(t, "pod-12", sp.ServiceID.Metadata[attr.K8sPodName])
+	assert.NotContains(t, sp.ServiceID.Metadata, attr.K8sClusterName)
+
+	// but it is added as soon as it is resolved
+	cluster = "the-cluster"
+	sp = request.Span{Pid: request.PidInfo{Namespace: 12}}
+	md.do(&sp)
+	assert.Equal(t, "the-cluster", sp.ServiceID.Metadata[attr.K8sClusterName])
+}
+
+func TestKubernetesDecorator_NamespaceLabelAttributes(t *testing.T) {
+	// only the labels that are selected without wildcards can be reported by the metrics
+	d := KubernetesDecorator{NamespaceLabels: []string{"team", "cost-*", "environment", "app.kubernetes.io/{name,part-of}"}}
+	assert.Equal(t, []attr.Name{
+		"k8s.namespace.label.team", "k8s.namespace.label.environment",
+		"k8s.peer.namespace.label.team", "k8s.peer.namespace.label.environment",
+	}, d.NamespaceLabelAttributes())
+}
+
+func TestSplitImage(t *testing.T) {
+	for _, tc := range []struct{ image, name, tag string }{
+		{image: "nginx", name: "nginx"},
+		{image: "nginx:1.25", name: "nginx", tag: "1.25"},
+		{image: "docker.io/library/nginx:1.25", name: "docker.io/library/nginx", tag: "1.25"},
+		{image: "registry:5000/shop/app", name: "registry:5000/shop/app"},
+		{image: "registry:5000/shop/app:v2@sha256:abcd", name: "registry:5000/shop/app", tag: "v2"},
+		{image: "shop/app@sha256:abcd", name: "shop/app"},
+	} {
+		t.Run(tc.image, func(t *testing.T) {
+			name, tag := splitImage(tc.image)
+			assert.Equal(t, tc.name, name)
+			assert.Equal(t, tc.tag, tag)
+		})
+	}
+}
+
+func TestDecoration_ServiceAccount(t *testing.T) {
+	db := fakeDatabase{
+		12: &kube.PodInfo{ObjectMeta: v1.ObjectMeta{Name: "pod-12", Namespace: "the-ns"}, ServiceAccount: "the-sa"},
+		13: &kube.PodInfo{ObjectMeta: v1.ObjectMeta{Name: "pod-13", Namespace: "the-ns"}},
+	}
+	sp := request.Span{Pid: request.PidInfo{Namespace: 12}}
+	(&metadataDecorator{db: db}).do(&sp)
+	assert.Equal(t, "the-sa", sp.ServiceID.Metadata[attr.K8sPodServiceAccount])
+
+	sp = request.Span{Pid: request.PidInfo{Namespace: 13}}
+	(&metadataDecorator{db: db}).do(&sp)
+	assert.NotContains(t, sp.ServiceID.Metadata, attr.K8sPodServiceAccount)
+}
+
+func TestDecoration_ServiceNamespaceAnnotation(t *testing.T) {
+	db := fakeDatabase{
+		12: &kube.PodInfo{ObjectMeta: v1.ObjectMeta{Name: "pod-12", Namespace: "the-ns",
+			Annotations: map[string]string{kube.ServiceNamespaceAnnotation: "the-service-ns"}}},
+	}
+	// the annotation takes precedence over the Kubernetes namespace
+	sp := request.Span{Pid: request.PidInfo{Namespace: 12}}
+	(&metadataDecorator{db: db}).do(&sp)
+	assert.Equal(t, "the-service-ns", sp.ServiceID.Namespace)
+	assert.Equal(t, "the-ns", sp.ServiceID.Metadata[attr.K8sNamespaceName])
+
+	// but not over the namespace that is defined in the discovery criteria
+	sp = request.Span{Pid: request.PidInfo{Namespace: 12}, ServiceID: svc.ID{Namespace: "from-config"}}
+	(&metadataDecorator{db: db}).do(&sp)
+	assert.Equal(t, "from-config", sp.ServiceID.Namespace)
+}
+
+// the Kubernetes attributes that are reported for a pod, according to the kind of the workload that owns it
+func TestDecoration_OwnerAttributesConformance(t *testing.T) {
+	// GIVEN the informers of a cluster
+	client := fakek8sclientset.NewSimpleClientset()
+	informer := kube.Metadata{JobLookupCacheLen: 10}
+	require.NoError(t, informer.InitFromClient(context.TODO(), client, 30*time.Minute))
+	_, err := client.BatchV1().Jobs("the-ns").Create(context.Background(), &batchv1.Job{
+		ObjectMeta: v1.ObjectMeta{Name: "backup-28475040", Namespace: "the-ns", OwnerReferences: []v1.OwnerReference{
+			{APIVersion: "batch/v1", Kind: "CronJob", Name: "backup"},
+		}},
+	}, v1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = client.AppsV1().ReplicaSets("the-ns").Create(context.Background(), &appsv1.ReplicaSet{
+		ObjectMeta: v1.ObjectMeta{Name: "frontend-5d4f7b", Namespace: "the-ns", OwnerReferences: []v1.OwnerReference{
+			{APIVersion: "apps/v1", Kind: "Deployment", Name: "frontend"},
+		}},
+	}, v1.CreateOptions{})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, ok := informer.GetReplicaSetInfo("the-ns", "frontend-5d4f7b")
+		return ok
+	}, timeout, 10*time.Millisecond)
+
+	for _, tc := range []struct {
+		kind, apiVersion, owner string
+		expected                map[attr.Name]string
+	}{
+		{kind: "ReplicaSet", apiVersion: "apps/v1", owner: "frontend-5d4f7b", expected: map[attr.Name]string{
+			attr.K8sReplicaSetName: "frontend-5d4f7b", attr.K8sDeploymentName: "frontend"}},
+		{kind: "ReplicaSet", apiVersion: "apps/v1", owner: "standalone-rs", expected: map[attr.Name]string{
+			attr.K8sReplicaSetName: "standalone-rs"}},
+		{kind: "StatefulSet", apiVersion: "apps/v1", owner: "database", expected: map[attr.Name]string{
+			attr.K8sStatefulSetName: "database"}},
+		{kind: "DaemonSet", apiVersion: "apps/v1", owner: "agent", expected: map[attr.Name]string{
+			attr.K8sDaemonSetName: "agent"}},
+		{kind: "Job", apiVersion: "batch/v1", owner: "migration", expected: map[attr.Name]string{
+			attr.K8sJobName: "migration"}},
+		{kind: "Job", apiVersion: "batch/v1", owner: "backup-28475040", expected: map[attr.Name]string{
+			attr.K8sJobName: "backup-28475040", attr.K8sCronJobName: "backup"}},
+		{kind: "Job", apiVersion: "batch/v1", owner: "manual-28475040", expected: map[attr.Name]string{
+			attr.K8sJobName: "manual-28475040"}},
+		{kind: "Node", apiVersion: "v1", owner: "static-pod-node", expected: map[attr.Name]string{}},
+	} {
+		t.Run(tc.kind+"/"+tc.owner, func(t *testing.T) {
+			// WHEN a pod owned by each kind of workload is created
+			cid := "container-" + tc.owner
+			_, err := client.CoreV1().Pods("the-ns").Create(context.Background(), &corev1.Pod{
+				ObjectMeta: v1.ObjectMeta{Name: "pod-" + tc.owner, Namespace: "the-ns", UID: types.UID("uid-" + tc.owner),
+					OwnerReferences: []v1.OwnerReference{{APIVersion: tc.apiVersion, Kind: tc.kind, Name: tc.owner}}},
+				Spec:   corev1.PodSpec{NodeName: "the-node"},
+				Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{ContainerID: "containerd://" + cid}}},
+			}, v1.CreateOptions{})
+			require.NoError(t, err)
+			var pod *kube.PodInfo
+			require.Eventually(t, func() bool {
+				var ok bool
+				pod, ok = informer.GetContainerPod(cid)
+				return ok
+			}, timeout, 10*time.Millisecond)
+
+			// THEN its spans are decorated with the attributes of the whole owners chain, and nothing else
+			span := request.Span{Pid: request.PidInfo{Namespace: 1}}
+			(&metadataDecorator{db: fakeDatabase{1: informer.PodWithOwnerInfo(pod)}}).do(&span)
+			expected := map[attr.Name]string{
+				attr.K8sNamespaceName: "the-ns",
+				attr.K8sPodName:       "pod-" + tc.owner,
+				attr.K8sNodeName:      "the-node",
+				attr.K8sPodUID:        "uid-" + tc.owner,
+				attr.K8sPodStartTime:  pod.StartTimeStr,
+				attr.ContainerID:      "container-1",
+			}
+			for name, value := range tc.expected {
+				expected[name] = value
+			}
+			assert.Equal(t, expected, span.ServiceID.Metadata)
+		})
+	}
+}
+
+func TestDecoration_ParallelOrdering(t *testing.T) {
+	dec := metadataDecorator{workers: 8, db: fakeDatabase{
+		12: &kube.PodInfo{ObjectMeta: v1.ObjectMeta{Name: "pod-12", Namespace: "the-ns"}},
+	}}
+	inputCh, outputhCh := make(chan []request.Span, 10), make(chan []request.Span, 10)
+	go func() {
+		dec.parallelLoop(inputCh, outputhCh)
+		// the pipes library closes the output when the node function returns
+		close(outputhCh)
+	}()
+
+	// WHEN many batches are submitted to the parallel decorator
+	const batches = 1000
+	go func() {
+		for i := 0; i < batches; i++ {
+			// batches of different sizes, so they take different times to be decorated
+			spans := make([]request.Span, 1+i%7)
+			for s := range spans {
+				spans[s] = request.Span{Pid: request.PidInfo{Namespace: 12}, RequestStart: int64(i)}
+			}
+			inputCh <- spans
+		}
+		close(inputCh)
+	}()
+
+	// THEN the batches are decorated and forwarded in the same order as they were received
+	for i := 0; i < batches; i++ {
+		deco := testutil.ReadChannel(t, outputhCh, timeout)
+		require.Len(t, deco, 1+i%7)
+		for s := range deco {
+			require.EqualValues(t, i, deco[s].RequestStart)
+			require.Equal(t, "pod-12", deco[s].ServiceID.Metadata[attr.K8sPodName])
+		}
+	}
+	// AND the loop ends after the input is closed
+	select {
+	case _, ok := <-outputhCh:
+		assert.False(t, ok)
+	case <-time.After(timeout):
+		assert.Fail(t, "the decoration loop did not end")
+	}
+}
+
+// BenchmarkDecoration measures the throughput of the Kubernetes decoration
+// for a varying number of workers
+func BenchmarkDecoration(b *testing.B) {
+	db := fakeDatabase{}
+	for ns := uint32(0); ns < 100; ns++ {
+		db[ns] = &kube.PodInfo{
+			ObjectMeta: v1.ObjectMeta{Name: "the-pod", Namespace: "the-ns", UID: "the-uid"},
+			NodeName:   "the-node",
+			Owner: &kube.Owner{Type: kube.OwnerReplicaSet, Name: "the-rs",
+				Owner: &kube.Owner{Type: kube.OwnerDeployment, Name: "the-deployment"}},
+		}
+	}
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			dec := metadataDecorator{workers: workers, names: newServiceNamer(nil), db: db}
+			in, out := make(chan []request.Span, 10), make(chan []request.Span, 10)
+			go func() {
+				if workers > 1 {
+					dec.parallelLoop(in, out)
+				} else {
+					dec.nodeLoop(in, out)
+				}
+				close(out)
+			}()
+			// batches of the default eBPF tracer batch length
+			batches := make([][]request.Span, b.N)
+			for i := range batches {
+				batches[i] = make([]request.Span, 100)
+				for s := range batches[i] {
+					batches[i][s].Pid.Namespace = uint32(s)
+					batches[i][s].ServiceID.AutoName = true
+				}
+			}
+			b.ResetTimer()
+			go func() {
+				for i := range batches {
+					in <- batches[i]
+				}
+				close(in)
+			}()
+			for range out {
+			}
+		})
+	}
+}
@@ -1,7 +1,7 @@
 package transform
 
 import (
-	"context"
+	"fmt"
 	"net"
 	"strings"
 	"time"
@@ -11,6 +11,7 @@ import (
 
 	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
 	"github.com/grafana/beyla/pkg/internal/pipe/global"
+	"github.com/grafana/beyla/pkg/internal/reload"
 	"github.com/grafana/beyla/pkg/internal/request"
 	"github.com/grafana/beyla/pkg/internal/svc"
 	kube2 "github.com/grafana/beyla/pkg/internal/transform/kube"
@@ -24,33 +25,102 @@ type NameResolverConfig struct {
 	// cached entry becomes older than this time, the IP->hostname entry will be looked
 	// up again.
 	CacheTTL time.Duration `yaml:"cache_expiry" env:"BEYLA_NAME_RESOLVER_CACHE_TTL"`
+	// Prefer selects which Kubernetes object names the peers that are found in the cluster.
+	// If empty, it defaults to PreferService.
+	Prefer PeerNamePreference `yaml:"prefer" env:"BEYLA_NAME_RESOLVER_PREFER"`
+	// CIDRs names the peers that are not found in the cluster, before looking up their names
+	// in the DNS. It can be updated when the configuration is reloaded.
+	CIDRs NamedCIDRs `yaml:"cidrs"`
+	// ReverseDNS configures the lookups of the names of the peers that are not found in the cluster
+	ReverseDNS ReverseDNSConfig `yaml:"reverse_dns"`
+}
+
+// PeerNamePreference selects the Kubernetes object whose name and namespace are reported for the
+// peers of the spans
+type PeerNamePreference string
+
+const (
+	// PreferService reports the Service of the peer, if the destination port is exposed by any Service
+	// that the peer backs. Otherwise, it reports the service name and namespace of the peer Pod, as set by
+	// its annotations, or the name of its topmost owner.
+	PreferService = PeerNamePreference("service")
+	// PreferWorkload reports the topmost owner of the peer Pod (for example, its Deployment), even if
+	// it backs any Service. This is useful when multiple Services front the same workload.
+	PreferWorkload = PeerNamePreference("workload")
+	// PreferPod reports the name of the peer Pod
+	PreferPod = PeerNamePreference("pod")
+)
+
+func (c *NameResolverConfig) Validate() error {
+	switch c.Prefer {
+	case "", PreferService, PreferWorkload, PreferPod:
+	default:
+		return fmt.Errorf("unknown preference %q, choices are %v",
+			c.Prefer, []PeerNamePreference{PreferService, PreferWorkload, PreferPod})
+	}
+	if err := c.CIDRs.Validate(); err != nil {
+		return fmt.Errorf("invalid cidrs: %w", err)
+	}
+	if err := c.ReverseDNS.Validate(); err != nil {
+		return fmt.Errorf("invalid reverse_dns: %w", err)
+	}
+	return nil
 }
 
 type NameResolver struct {
-	cache  *expirable.LRU[string, string]
+	dns    *reverseDNS
 	sCache *expirable.LRU[string, svc.ID]
 	cfg    *NameResolverConfig
 	db     *kube2.Database
+	prefer PeerNamePreference
+	cidrs  *CIDRNamer
+	// nsLabels is nil if no namespace labels are selected
+	nsLabels *namespaceLabels
+}
+
+// k8sPeer is the Kubernetes object that names an IP, and its kind (for example, Service, Pod or Deployment)
+type k8sPeer struct {
+	name      string
+	namespace string
+	kind      string
 }
 
-func NameResolutionProvider(ctxInfo *global.ContextInfo, cfg *NameResolverConfig) pipe.MiddleProvider[[]request.Span, []request.Span] {
+// NameResolutionProvider decorates the spans with the names of their peers. The namespaceLabels are the glob
+// patterns of the kubernetes.namespace_labels option, which also select the labels of the peer namespaces.
+func NameResolutionProvider(
+	ctxInfo *global.ContextInfo, cfg *NameResolverConfig, namespaceLabels []string,
+) pipe.MiddleProvider[[]request.Span, []request.Span] {
+	// the CIDR ranges are shared by the name resolvers of all the pipeline shards
+	var cidrs *CIDRNamer
+	if cfg != nil {
+		cidrs = NewCIDRNamer(cfg.CIDRs, cfg.CacheLen)
+		reload.OnChange(ctxInfo.Reload, "name_resolver.cidrs", cidrs.Update)
+	}
 	return func() (pipe.MiddleFunc[[]request.Span, []request.Span], error) {
 		if cfg == nil {
 			return pipe.Bypass[[]request.Span](), nil
 		}
-		return nameResolver(ctxInfo, cfg)
+		return nameResolver(ctxInfo, cfg, cidrs, namespaceLabels)
 	}
 }
 
-func nameResolver(ctxInfo *global.ContextInfo, cfg *NameResolverConfig) (pipe.MiddleFunc[[]request.Span, []request.Span], error) {
+func nameResolver(
+	ctxInfo *global.ContextInfo, cfg *NameResolverConfig, cidrs *CIDRNamer, namespaceLabels []string,
+) (pipe.MiddleFunc[[]request.Span, []request.Span], error) {
 	nr := NameResolver{
 		cfg:    cfg,
 		db:     ctxInfo.AppO11y.K8sDatabase,
-		cache:  expirable.NewLRU[string, string](cfg.CacheLen, nil, cfg.CacheTTL),
+		prefer: cfg.Prefer,
+		cidrs:  cidrs,
+		dns:    newReverseDNS(cfg, ctxInfo.Metrics),
 		sCache: expirable.NewLRU[string, svc.ID](cfg.CacheLen, nil, cfg.CacheTTL),
 	}
+	if len(namespaceLabels) > 0 && nr.db != nil {
+		nr.nsLabels = newNamespaceLabels(nr.db, namespaceLabels, attr.K8sPeerNamespaceLabel)
+	}
 
 	return func(in <-chan []request.Span, out chan<- []request.Span) {
+		defer nr.dns.stop()
 		for spans := range in {
 			for i := range spans {
 				s := &spans[i]
@@ -77,13 +147,18 @@ func trimPrefixIgnoreCase(s, prefix string) string {
 
 func (nr *NameResolver) resolveNames(span *request.Span) {
 	if span.IsClientSpan() {
-		span.HostName, span.OtherNamespace = nr.resolve(&span.ServiceID, span.Host)
+		span.HostName, span.OtherNamespace = nr.resolve(&span.ServiceID, span.Host, span.HostPort)
+		span.OtherServiceAccount = nr.serviceAccount(span.Host, span.HostPort)
+		span.OtherNamespaceLabels = nr.peerNamespaceLabels(span.Host, span.HostPort)
 		span.PeerName = span.ServiceID.Name
 		if len(span.Peer) > 0 {
 			nr.sCache.Add(span.Peer, span.ServiceID)
 		}
 	} else {
-		span.PeerName, span.OtherNamespace = nr.resolve(&span.ServiceID, span.Peer)
+		// the client port is ephemeral, so it does not identify the client
+		span.PeerName, span.OtherNamespace = nr.resolve(&span.ServiceID, span.Peer, 0)
+		span.OtherServiceAccount = nr.serviceAccount(span.Peer, 0)
+		span.OtherNamespaceLabels = nr.peerNamespaceLabels(span.Peer, 0)
 		span.HostName = span.ServiceID.Name
 		if len(span.Host) > 0 {
 			nr.sCache.Add(span.Host, span.ServiceID)
@@ -91,7 +166,9 @@ func (nr *NameResolver) resolveNames(span *request.Span) {
 	}
 }
 
-func (nr *NameResolver) resolve(svc *svc.ID, ip string) (string, string) {
+// resolve the name and namespace of the given IP. The port, if known, distinguishes the
+// hostNetwork pods that share the IP of their node.
+func (nr *NameResolver) resolve(svc *svc.ID, ip string, port int) (string, string) {
 	var name, ns string
 
 	if len(ip) > 0 {
@@ -101,7 +178,7 @@ func (nr *NameResolver) resolve(svc *svc.ID, ip string) (string, string) {
 			ns = peerSvc.Namespace
 		} else {
 			var peer string
-			peer, ns = nr.dnsResolve(svc, ip)
+			peer, ns = nr.dnsResolve(svc, ip, port)
 			if len(peer) > 0 {
 				name = peer
 			} else {
@@ -113,6 +190,50 @@ func (nr *NameResolver) resolve(svc *svc.ID, ip string) (string, string) {
 	return name, ns
 }
 
+// serviceAccount returns the service account of the pod with the given IP, if it is known. The
+// instrumented services are decorated with the service account of their pod.
+func (nr *NameResolver) serviceAccount(ip string, port int) string {
+	if ip == "" {
+		return ""
+	}
+	if peerSvc, ok := nr.sCache.Get(ip); ok {
+		return peerSvc.Metadata[attr.K8sPodServiceAccount]
+	}
+	if nr.db == nil || nr.db.IsUnknownIP(ip) {
+		return ""
+	}
+	if info := nr.db.PodInfoForIPPort(ip, uint16(port)); info != nil {
+		return info.ServiceAccount
+	}
+	return ""
+}
+
+// peerNamespaceLabels returns the selected labels of the namespace of the pod with the given IP, if the
+// pod and its namespace are known. Like the service account, the namespace of the instrumented services
+// is taken from their decorated metadata.
+func (nr *NameResolver) peerNamespaceLabels(ip string, port int) map[attr.Name]string {
+	if nr.nsLabels == nil || ip == "" {
+		return nil
+	}
+	var namespace string
+	if peerSvc, ok := nr.sCache.Get(ip); ok {
+		namespace = peerSvc.Metadata[attr.K8sNamespaceName]
+	} else if !nr.db.IsUnknownIP(ip) {
+		if info := nr.db.PodInfoForIPPort(ip, uint16(port)); info != nil {
+			namespace = info.Namespace
+		}
+	}
+	if namespace == "" {
+		return nil
+	}
+	labels := map[attr.Name]string{}
+	nr.nsLabels.decorate(labels, namespace)
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
+
 func (nr *NameResolver) cleanName(svc *svc.ID, ip, n string) string {
 	n = strings.TrimSuffix(n, ".")
 	n = trimSuffixIgnoreCase(n, ".svc.cluster.local")
@@ -129,62 +250,90 @@ func (nr *NameResolver) cleanName(svc *svc.ID, ip, n string) string {
 	return n
 }
 
-func (nr *NameResolver) dnsResolve(svc *svc.ID, ip string) (string, string) {
+func (nr *NameResolver) dnsResolve(svc *svc.ID, ip string, port int) (string, string) {
 	if ip == "" {
 		return "", ""
 	}
 
+	namespace := svc.Namespace
 	if nr.db != nil {
 		ipAddr := net.ParseIP(ip)
 
 		if ipAddr != nil && !ipAddr.IsLoopback() {
-			n, ns := nr.resolveFromK8s(ip)
-
-			if n != "" {
-				return n, ns
+			peer := nr.resolveFromK8s(ip, port)
+			if peer.name != "" {
+				return peer.name, peer.namespace
+			}
+			// the peers of the excluded namespaces might be decorated only with their namespace
+			if peer.namespace != "" {
+				namespace = peer.namespace
 			}
 		}
 	}
 
+	// the peers outside the cluster are preferably named by their CIDR range
+	if name := nr.cidrs.Name(ip); name != "" {
+		return name, namespace
+	}
+
 	n := nr.resolveIP(ip)
 	if n == ip {
-		return n, svc.Namespace
+		return n, namespace
 	}
 
 	n = nr.cleanName(svc, ip, n)
 
 	// fmt.Printf("%s -> %s\n", ip, n)
 
-	return n, svc.Namespace
+	return n, namespace
 }
 
-func (nr *NameResolver) resolveFromK8s(ip string) (string, string) {
-	info := nr.db.PodInfoForIP(ip)
+// resolveFromK8s returns the Kubernetes object that names the given IP, according to the configured
+// preference, or an empty name if the IP is not found in the cluster or its namespace is excluded
+func (nr *NameResolver) resolveFromK8s(ip string, port int) k8sPeer {
+	// the IPs from outside the cluster are remembered, so they don't need to be looked up in all the indexes
+	if nr.db.IsUnknownIP(ip) {
+		return k8sPeer{}
+	}
+	// the traffic that goes directly to the pod endpoints (headless Services, client-side load
+	// balancing...) is attributed to the Service that they serve
+	if port != 0 && (nr.prefer == "" || nr.prefer == PreferService) {
+		if es := nr.db.ServiceForIP(ip, uint16(port)); es != nil {
+			if es.Excluded {
+				return k8sPeer{namespace: es.Namespace}
+			}
+			return k8sPeer{name: es.ServiceName, namespace: es.Namespace, kind: "Service"}
+		}
+	}
+	info := nr.db.PodInfoForIPPort(ip, uint16(port))
 	if info == nil {
-		return "", ""
+		nr.db.AddUnknownIP(ip)
+		return k8sPeer{}
 	}
-
-	return info.ServiceName(), info.Namespace
+	if info.Excluded {
+		return k8sPeer{namespace: info.Namespace}
+	}
+	// the Services that select the pod are known even if the EndpointSlices are not watched
+	if nr.prefer == "" || nr.prefer == PreferService {
+		if services := nr.db.ServicesForPod(info); len(services) > 0 {
+			return k8sPeer{name: services[0].Name, namespace: services[0].Namespace, kind: "Service"}
+		}
+	}
+	switch nr.prefer {
+	case PreferPod:
+		return k8sPeer{name: info.Name, namespace: info.Namespace, kind: "Pod"}
+	case PreferWorkload:
+		if owner := info.TopOwner(); owner != nil {
+			return k8sPeer{name: owner.Name, namespace: info.Namespace, kind: owner.Type.Kind()}
+		}
+		return k8sPeer{name: info.Name, namespace: info.Namespace, kind: "Pod"}
+	}
+	return k8sPeer{name: info.ServiceName(), namespace: info.ServiceNamespace(), kind: "Pod"}
 }
 
 func (nr *NameResolver) resolveIP(ip string) string {
-	if host, ok := nr.cache.Get(ip); ok {
-		return host
-	}
-
-	var r *net.Resolver
-	addr, err := r.LookupAddr(context.Background(), ip)
-
-	if err != nil {
-		nr.cache.Add(ip, ip)
+	if nr.dns == nil {
 		return ip
 	}
-
-	for _, a := range addr {
-		nr.cache.Add(ip, a)
-		return a
-	}
-
-	nr.cache.Add(ip, ip)
-	return ip
+	return nr.dns.name(ip)
 }
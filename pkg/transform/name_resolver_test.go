@@ -1,14 +1,21 @@
 package transform
 
 import (
+	"context"
+	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/hashicorp/golang-lru/v2/expirable"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	fakek8sclientset "k8s.io/client-go/kubernetes/fake"
 
 	"github.com/grafana/beyla/pkg/internal/export/metric/attr"
+	"github.com/grafana/beyla/pkg/internal/imetrics"
 	kube2 "github.com/grafana/beyla/pkg/internal/kube"
 	"github.com/grafana/beyla/pkg/internal/request"
 	"github.com/grafana/beyla/pkg/internal/svc"
@@ -63,21 +70,12 @@ func TestResolveFromK8s(t *testing.T) {
 
 	nr := NameResolver{
 		db:     &db,
-		cache:  expirable.NewLRU[string, string](10, nil, 5*time.Hour),
 		sCache: expirable.NewLRU[string, svc.ID](10, nil, 5*time.Hour),
 	}
 
-	name, namespace := nr.resolveFromK8s("10.0.0.1")
-	assert.Equal(t, "pod1", name)
-	assert.Equal(t, "", namespace)
-
-	name, namespace = nr.resolveFromK8s("10.0.0.2")
-	assert.Equal(t, "pod2", name)
-	assert.Equal(t, "something", namespace)
-
-	name, namespace = nr.resolveFromK8s("10.0.0.3")
-	assert.Equal(t, "", name)
-	assert.Equal(t, "", namespace)
+	assert.Equal(t, k8sPeer{name: "pod1", kind: "Pod"}, nr.resolveFromK8s("10.0.0.1", 0))
+	assert.Equal(t, k8sPeer{name: "pod2", namespace: "something", kind: "Pod"}, nr.resolveFromK8s("10.0.0.2", 0))
+	assert.Equal(t, k8sPeer{}, nr.resolveFromK8s("10.0.0.3", 0))
 
 	clientSpan := request.Span{
 		Type: request.EventTypeHTTPClient,
@@ -114,6 +112,346 @@ func TestResolveFromK8s(t *testing.T) {
 	assert.Equal(t, "something", serverSpan.ServiceID.Namespace)
 }
 
+func TestResolveFromK8s_HostNetwork(t *testing.T) {
+	db := kube.CreateDatabase(nil)
+	for _, name := range []string{"node-exporter", "kube-proxy"} {
+		port := uint16(9100)
+		if name == "kube-proxy" {
+			port = 10249
+		}
+		db.UpdateNewPodsByIPIndex(&kube2.PodInfo{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "kube-system", UID: types.UID(name)},
+			HostIPs:    []string{"192.168.1.10"},
+			HostPorts:  []uint16{port},
+		})
+	}
+	nr := NameResolver{
+		db:     &db,
+		sCache: expirable.NewLRU[string, svc.ID](10, nil, 5*time.Hour),
+	}
+
+	// the client spans are attributed to the hostNetwork pod that listens in the server port
+	for port, name := range map[int]string{9100: "node-exporter", 10249: "kube-proxy"} {
+		span := request.Span{
+			Type:      request.EventTypeHTTPClient,
+			Peer:      "10.0.0.1",
+			Host:      "192.168.1.10",
+			HostPort:  port,
+			ServiceID: svc.ID{Name: "prometheus"},
+		}
+		nr.resolveNames(&span)
+		assert.Equal(t, name, span.HostName)
+		assert.Equal(t, "kube-system", span.OtherNamespace)
+	}
+}
+
+func TestResolveFromK8s_EndpointServices(t *testing.T) {
+	db := kube.CreateDatabase(nil)
+	db.UpdateNewPodsByIPIndex(&kube2.PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-6d4cf56db6-x2v9k", Namespace: "shop"},
+		Owner:      &kube2.Owner{Type: kube2.OwnerDeployment, Name: "web"},
+		IPs:        []string{"10.244.0.5"},
+	})
+	db.UpdateNewServicesByIPIndex(&kube2.EndpointSliceInfo{
+		ObjectMeta:  metav1.ObjectMeta{Name: "frontend-abcde", Namespace: "shop", UID: "slice-1"},
+		ServiceName: "frontend",
+		IPs:         []string{"10.244.0.5"},
+		Ports:       []uint16{8080},
+	})
+	nr := NameResolver{
+		db:     &db,
+		sCache: expirable.NewLRU[string, svc.ID](10, nil, 5*time.Hour),
+	}
+
+	// the client spans that go directly to a pod endpoint are attributed to its Service
+	span := request.Span{
+		Type:      request.EventTypeHTTPClient,
+		Peer:      "10.0.0.1",
+		Host:      "10.244.0.5",
+		HostPort:  8080,
+		ServiceID: svc.ID{Name: "checkout", Namespace: "payments"},
+	}
+	nr.resolveNames(&span)
+	assert.Equal(t, "frontend", span.HostName)
+	assert.Equal(t, "shop", span.OtherNamespace)
+
+	// unless the Service does not expose the destination port
+	span = request.Span{
+		Type:      request.EventTypeHTTPClient,
+		Peer:      "10.0.0.2",
+		Host:      "10.244.0.5",
+		HostPort:  9090,
+		ServiceID: svc.ID{Name: "checkout", Namespace: "payments"},
+	}
+	nr.sCache.Purge()
+	nr.resolveNames(&span)
+	assert.Equal(t, "web", span.HostName)
+	assert.Equal(t, "shop", span.OtherNamespace)
+}
+
+func TestResolveFromK8s_Prefer(t *testing.T) {
+	db := kube.CreateDatabase(nil)
+	db.UpdateNewPodsByIPIndex(&kube2.PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-6d4cf56db6-x2v9k", Namespace: "shop"},
+		Owner: &kube2.Owner{Type: kube2.OwnerReplicaSet, Name: "web-6d4cf56db6",
+			Owner: &kube2.Owner{Type: kube2.OwnerDeployment, Name: "web"}},
+		IPs: []string{"10.244.0.5"},
+	})
+	db.UpdateNewPodsByIPIndex(&kube2.PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "standalone", Namespace: "shop"},
+		IPs:        []string{"10.244.0.6"},
+	})
+	db.UpdateNewServicesByIPIndex(&kube2.EndpointSliceInfo{
+		ObjectMeta:  metav1.ObjectMeta{Name: "frontend-abcde", Namespace: "shop", UID: "slice-1"},
+		ServiceName: "frontend",
+		IPs:         []string{"10.244.0.5"},
+		Ports:       []uint16{8080},
+	})
+
+	for _, tc := range []struct {
+		prefer     PeerNamePreference
+		backed     k8sPeer
+		standalone k8sPeer
+	}{{
+		prefer:     "",
+		backed:     k8sPeer{name: "frontend", namespace: "shop", kind: "Service"},
+		standalone: k8sPeer{name: "standalone", namespace: "shop", kind: "Pod"},
+	}, {
+		prefer:     PreferService,
+		backed:     k8sPeer{name: "frontend", namespace: "shop", kind: "Service"},
+		standalone: k8sPeer{name: "standalone", namespace: "shop", kind: "Pod"},
+	}, {
+		prefer:     PreferWorkload,
+		backed:     k8sPeer{name: "web", namespace: "shop", kind: "Deployment"},
+		standalone: k8sPeer{name: "standalone", namespace: "shop", kind: "Pod"},
+	}, {
+		prefer:     PreferPod,
+		backed:     k8sPeer{name: "web-6d4cf56db6-x2v9k", namespace: "shop", kind: "Pod"},
+		standalone: k8sPeer{name: "standalone", namespace: "shop", kind: "Pod"},
+	}} {
+		t.Run(string(tc.prefer), func(t *testing.T) {
+			nr := NameResolver{db: &db, prefer: tc.prefer}
+			assert.Equal(t, tc.backed, nr.resolveFromK8s("10.244.0.5", 8080))
+			assert.Equal(t, tc.standalone, nr.resolveFromK8s("10.244.0.6", 8080))
+			assert.Equal(t, k8sPeer{}, nr.resolveFromK8s("192.168.0.1", 8080))
+		})
+	}
+}
+
+func TestResolveFromK8s_SelectorServices(t *testing.T) {
+	// GIVEN a pod that is selected by a Service whose EndpointSlices are not watched
+	db := kube.CreateDatabase(nil)
+	db.UpdateNewPodsByIPIndex(&kube2.PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-6d4cf56db6-x2v9k", Namespace: "shop",
+			Labels: map[string]string{"app": "web", "pod-template-hash": "6d4cf56db6"}},
+		Owner: &kube2.Owner{Type: kube2.OwnerReplicaSet, Name: "web-6d4cf56db6",
+			Owner: &kube2.Owner{Type: kube2.OwnerDeployment, Name: "web"}},
+		IPs: []string{"10.244.0.5"},
+	})
+	db.OnSelectorService(nil, &kube2.ServiceInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "shop", UID: "svc-1"},
+		Selector:   map[string]string{"app": "web"},
+	})
+
+	// THEN the Service names the pod, unless another object is preferred
+	nr := NameResolver{db: &db, prefer: PreferService}
+	assert.Equal(t, k8sPeer{name: "frontend", namespace: "shop", kind: "Service"}, nr.resolveFromK8s("10.244.0.5", 8080))
+	assert.Equal(t, k8sPeer{name: "frontend", namespace: "shop", kind: "Service"}, nr.resolveFromK8s("10.244.0.5", 0))
+	nr = NameResolver{db: &db, prefer: PreferWorkload}
+	assert.Equal(t, k8sPeer{name: "web", namespace: "shop", kind: "Deployment"}, nr.resolveFromK8s("10.244.0.5", 8080))
+}
+
+func TestResolveFromK8s_ExcludedNamespace(t *testing.T) {
+	// GIVEN a pod and a Service of a namespace that is excluded from the decoration
+	db := kube.CreateDatabase(nil)
+	pod := &kube2.PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "coredns-5d78c9869d-8xk2p", Namespace: "kube-system"},
+		IPs:        []string{"10.244.0.7"},
+	}
+	pod.Exclude()
+	db.UpdateNewPodsByIPIndex(pod)
+	es := &kube2.EndpointSliceInfo{
+		ObjectMeta:  metav1.ObjectMeta{Name: "kube-dns-abcde", Namespace: "kube-system", UID: "slice-2"},
+		ServiceName: "kube-dns",
+		IPs:         []string{"10.244.0.7"},
+	}
+	es.Exclude()
+	db.UpdateNewServicesByIPIndex(es)
+
+	// THEN they don't name the peer, as if they weren't in the cluster
+	for _, prefer := range []PeerNamePreference{PreferService, PreferWorkload, PreferPod} {
+		nr := NameResolver{db: &db, prefer: prefer}
+		assert.Equal(t, k8sPeer{}, nr.resolveFromK8s("10.244.0.7", 53))
+	}
+}
+
+func TestNameResolverConfig_Validate(t *testing.T) {
+	for _, prefer := range []PeerNamePreference{"", PreferService, PreferWorkload, PreferPod} {
+		assert.NoError(t, (&NameResolverConfig{Prefer: prefer}).Validate())
+	}
+	assert.Error(t, (&NameResolverConfig{Prefer: "deployment"}).Validate())
+}
+
+func TestResolveNames_PeerServiceAccount(t *testing.T) {
+	db := kube.CreateDatabase(nil)
+	db.UpdateNewPodsByIPIndex(&kube2.PodInfo{
+		ObjectMeta:     metav1.ObjectMeta{Name: "web-6d4cf56db6-x2v9k", Namespace: "shop"},
+		ServiceAccount: "web-sa",
+		IPs:            []string{"10.244.0.5"},
+	})
+	nr := NameResolver{
+		db:     &db,
+		sCache: expirable.NewLRU[string, svc.ID](10, nil, 5*time.Hour),
+	}
+
+	// the service account of the peer pods is resolved from their IP
+	span := request.Span{
+		Type:      request.EventTypeHTTP,
+		Peer:      "10.244.0.5",
+		Host:      "10.244.0.9",
+		ServiceID: svc.ID{Name: "checkout", Namespace: "payments"},
+	}
+	nr.resolveNames(&span)
+	assert.Equal(t, "web-sa", span.OtherServiceAccount)
+
+	// and from the decorated metadata of the instrumented peers
+	span = request.Span{
+		Type:     request.EventTypeHTTPClient,
+		Peer:     "10.244.0.5",
+		Host:     "10.244.0.9",
+		HostPort: 8080,
+		ServiceID: svc.ID{Name: "web", Namespace: "shop",
+			Metadata: map[attr.Name]string{attr.K8sPodServiceAccount: "web-sa"}},
+	}
+	nr.resolveNames(&span)
+	span = request.Span{
+		Type:      request.EventTypeHTTP,
+		Peer:      "10.244.0.5",
+		Host:      "10.244.0.9",
+		ServiceID: svc.ID{Name: "checkout", Namespace: "payments"},
+	}
+	db.UpdateDeletedPodsByIPIndex(&kube2.PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-6d4cf56db6-x2v9k", Namespace: "shop"},
+		IPs:        []string{"10.244.0.5"},
+	})
+	nr.resolveNames(&span)
+	assert.Equal(t, "web-sa", span.OtherServiceAccount)
+
+	// the service account is unknown for the IPs out of the cluster
+	span = request.Span{
+		Type:      request.EventTypeHTTPClient,
+		Peer:      "10.244.0.9",
+		Host:      "203.0.113.7",
+		HostPort:  443,
+		ServiceID: svc.ID{Name: "checkout", Namespace: "payments"},
+	}
+	nr.resolveNames(&span)
+	assert.Empty(t, span.OtherServiceAccount)
+}
+
+func TestResolveNames_PeerNamespaceLabels(t *testing.T) {
+	db := kube.CreateDatabase(nil)
+	db.UpdateNewPodsByIPIndex(&kube2.PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-6d4cf56db6-x2v9k", Namespace: "shop"},
+		IPs:        []string{"10.244.0.5"},
+	})
+	namespaces := fakeNamespaces{}
+	nr := NameResolver{
+		db:       &db,
+		sCache:   expirable.NewLRU[string, svc.ID](10, nil, 5*time.Hour),
+		nsLabels: newNamespaceLabels(namespaces, []string{"team", "cost-*"}, attr.K8sPeerNamespaceLabel),
+	}
+	serverSpan := func() *request.Span {
+		return &request.Span{
+			Type:      request.EventTypeHTTP,
+			Peer:      "10.244.0.5",
+			Host:      "10.244.0.9",
+			ServiceID: svc.ID{Name: "checkout", Namespace: "payments"},
+		}
+	}
+
+	// the peers whose namespace is not known yet are not labeled
+	span := serverSpan()
+	nr.resolveNames(span)
+	assert.Equal(t, "shop", span.OtherNamespace)
+	assert.Empty(t, span.OtherNamespaceLabels)
+
+	// but the labels of the namespace of the peer pod are added as soon as it is known
+	namespaces["shop"] = map[string]string{"team": "checkout", "cost-center": "cc-12", "environment": "prod"}
+	span = serverSpan()
+	nr.resolveNames(span)
+	assert.Equal(t, map[attr.Name]string{
+		attr.K8sPeerNamespaceLabel("team"):        "checkout",
+		attr.K8sPeerNamespaceLabel("cost-center"): "cc-12",
+	}, span.OtherNamespaceLabels)
+	// without mixing them with the labels of the namespace of the instrumented service
+	assert.NotContains(t, span.ServiceID.Metadata, attr.K8sNamespaceLabel("team"))
+
+	// and the updates of the labels are applied to the next spans
+	namespaces["shop"] = map[string]string{"team": "payments"}
+	span = serverSpan()
+	nr.resolveNames(span)
+	assert.Equal(t, map[attr.Name]string{attr.K8sPeerNamespaceLabel("team"): "payments"}, span.OtherNamespaceLabels)
+
+	// the namespace of the instrumented peers is taken from their decorated metadata
+	namespaces["backoffice"] = map[string]string{"team": "admin"}
+	nr.resolveNames(&request.Span{
+		Type:     request.EventTypeHTTPClient,
+		Peer:     "10.244.0.7",
+		Host:     "10.244.0.9",
+		HostPort: 8080,
+		ServiceID: svc.ID{Name: "admin", Namespace: "backoffice",
+			Metadata: map[attr.Name]string{attr.K8sNamespaceName: "backoffice"}},
+	})
+	span = &request.Span{
+		Type:      request.EventTypeHTTP,
+		Peer:      "10.244.0.7",
+		Host:      "10.244.0.9",
+		ServiceID: svc.ID{Name: "checkout", Namespace: "payments"},
+	}
+	nr.resolveNames(span)
+	assert.Equal(t, map[attr.Name]string{attr.K8sPeerNamespaceLabel("team"): "admin"}, span.OtherNamespaceLabels)
+
+	// the peers out of the cluster are not labeled
+	span = &request.Span{
+		Type:      request.EventTypeHTTPClient,
+		Peer:      "10.244.0.9",
+		Host:      "203.0.113.7",
+		HostPort:  443,
+		ServiceID: svc.ID{Name: "checkout", Namespace: "payments"},
+	}
+	nr.resolveNames(span)
+	assert.Empty(t, span.OtherNamespaceLabels)
+}
+
+func TestResolveFromK8s_Annotations(t *testing.T) {
+	db := kube.CreateDatabase(nil)
+	db.UpdateNewPodsByIPIndex(&kube2.PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-6d4cf56db6-x2v9k", Namespace: "shop",
+			Annotations: map[string]string{
+				kube2.ServiceNameAnnotation:      "storefront",
+				kube2.ServiceNamespaceAnnotation: "retail",
+			}},
+		Owner: &kube2.Owner{Type: kube2.OwnerDeployment, Name: "web"},
+		IPs:   []string{"10.244.0.5"},
+	})
+	nr := NameResolver{
+		db:     &db,
+		sCache: expirable.NewLRU[string, svc.ID](10, nil, 5*time.Hour),
+	}
+
+	// the peers are resolved by the service name and namespace annotations of their pods
+	span := request.Span{
+		Type:      request.EventTypeHTTP,
+		Peer:      "10.244.0.5",
+		Host:      "10.0.0.1",
+		ServiceID: svc.ID{Name: "checkout", Namespace: "payments"},
+	}
+	nr.resolveNames(&span)
+	assert.Equal(t, "storefront", span.PeerName)
+	assert.Equal(t, "retail", span.OtherNamespace)
+}
+
 func TestCleanName(t *testing.T) {
 	s := svc.ID{
 		Name:      "service",
@@ -132,3 +470,54 @@ func TestCleanName(t *testing.T) {
 	assert.Equal(t, "service", nr.cleanName(&s, "127.0.0.1", "service.special.namespace.svc.cluster.local."))
 	assert.Equal(t, "service", nr.cleanName(&s, "127.0.0.1", "service.k8snamespace.svc.cluster.local."))
 }
+
+// indexLookups counts the lookups in the Kubernetes database indexes, each of them acquiring the lock of an index
+type indexLookups struct {
+	imetrics.NoopReporter
+	count atomic.Int64
+}
+
+func (il *indexLookups) KubeDatabaseLookup(index string, _ bool) {
+	if index != "unknown_ips" {
+		il.count.Add(1)
+	}
+}
+
+// BenchmarkResolveFromK8s_ExternalIPs measures the resolution of IPs from outside the cluster,
+// reporting the number of index lookups per resolution
+func BenchmarkResolveFromK8s_ExternalIPs(b *testing.B) {
+	externalIPs := make([]string, 256)
+	for i := range externalIPs {
+		externalIPs[i] = fmt.Sprintf("203.0.%d.%d", i/100, i%100)
+	}
+	for _, cacheLen := range []int{0, 1024} {
+		b.Run(fmt.Sprintf("unknown_ips_cache_len=%d", cacheLen), func(b *testing.B) {
+			informer := kube2.Metadata{}
+			require.NoError(b, informer.InitFromClient(context.TODO(), fakek8sclientset.NewSimpleClientset(), time.Minute))
+			lookups := &indexLookups{}
+			db, err := kube.StartDatabase(context.TODO(), &informer, lookups, kube.DatabaseConfig{
+				UnknownIPsCacheLen: cacheLen, UnknownIPsCacheTTL: time.Hour,
+			})
+			require.NoError(b, err)
+			b.Cleanup(db.Stop)
+			for i := 0; i < 1000; i++ {
+				db.UpdateNewPodsByIPIndex(&kube2.PodInfo{
+					ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("pod-%d", i), UID: types.UID(fmt.Sprint(i))},
+					IPs:        []string{fmt.Sprintf("10.244.%d.%d", i/100, i%100)},
+				})
+			}
+			nr := NameResolver{db: db}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					if peer := nr.resolveFromK8s(externalIPs[i%len(externalIPs)], 443); peer.name != "" {
+						b.Fatalf("unexpected resolution of an external IP: %s", peer.name)
+					}
+					i++
+				}
+			})
+			b.ReportMetric(float64(lookups.count.Load())/float64(b.N), "index_lookups/op")
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package transform
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+)
+
+// results of the reverse DNS lookups, as reported by the internal metrics
+const (
+	dnsLookupSuccess = "success"
+	dnsLookupFailure = "failure"
+	dnsLookupDropped = "dropped"
+)
+
+// injectable function for testing
+var lookupAddr = net.DefaultResolver.LookupAddr
+
+// ReverseDNSConfig configures the reverse DNS lookups of the peers that are not found in the cluster
+type ReverseDNSConfig struct {
+	// Async looks up the names in background workers, so the spans are never delayed by the DNS. Until
+	// the lookup of an IP finishes, its peers are named by the IP.
+	Async bool `yaml:"async" env:"BEYLA_NAME_RESOLVER_REVERSE_DNS_ASYNC"`
+	// Workers is the number of concurrent lookups when Async is enabled
+	Workers int `yaml:"workers" env:"BEYLA_NAME_RESOLVER_REVERSE_DNS_WORKERS"`
+	// QueueLen is the number of IPs that can wait for a worker when Async is enabled. The IPs that
+	// don't fit in the queue are looked up again the next time that they are resolved.
+	QueueLen int `yaml:"queue_len" env:"BEYLA_NAME_RESOLVER_REVERSE_DNS_QUEUE_LEN"`
+	// SkipPrivate doesn't look up the private, loopback and link-local IPs, which rarely have PTR records
+	SkipPrivate bool `yaml:"skip_private" env:"BEYLA_NAME_RESOLVER_REVERSE_DNS_SKIP_PRIVATE"`
+}
+
+func (c *ReverseDNSConfig) Validate() error {
+	if c.Async && (c.Workers <= 0 || c.QueueLen <= 0) {
+		return errors.New("workers and queue_len must be positive when async is enabled")
+	}
+	return nil
+}
+
+// reverseDNS looks up the names of the IPs, caching the answers. The IPs without name are also
+// cached, so they aren't looked up again until their entry expires.
+type reverseDNS struct {
+	cfg     *ReverseDNSConfig
+	cache   *expirable.LRU[string, string]
+	metrics imetrics.Reporter
+
+	// pending receives the IPs to be looked up by the workers. Nil if the lookups are synchronous.
+	pending chan string
+	mt      sync.Mutex
+	// queued avoids queueing the IPs that are already waiting for, or being looked up by, a worker
+	queued map[string]struct{}
+}
+
+func newReverseDNS(cfg *NameResolverConfig, metrics imetrics.Reporter) *reverseDNS {
+	rd := &reverseDNS{
+		cfg:     &cfg.ReverseDNS,
+		cache:   expirable.NewLRU[string, string](cfg.CacheLen, nil, cfg.CacheTTL),
+		metrics: metrics,
+	}
+	if cfg.ReverseDNS.Async {
+		rd.pending = make(chan string, cfg.ReverseDNS.QueueLen)
+		rd.queued = map[string]struct{}{}
+		for i := 0; i < cfg.ReverseDNS.Workers; i++ {
+			go rd.worker()
+		}
+	}
+	return rd
+}
+
+// name returns the cached name of the IP or, if it's not cached, looks it up. The asynchronous lookups
+// return the IP, and the name is available in the next invocations once the lookup finishes.
+func (rd *reverseDNS) name(ip string) string {
+	if host, ok := rd.cache.Get(ip); ok {
+		return host
+	}
+	if rd.cfg.SkipPrivate && isPrivateIP(ip) {
+		return ip
+	}
+	if rd.pending == nil {
+		return rd.lookup(ip)
+	}
+	rd.enqueue(ip)
+	return ip
+}
+
+func (rd *reverseDNS) enqueue(ip string) {
+	rd.mt.Lock()
+	defer rd.mt.Unlock()
+	if _, ok := rd.queued[ip]; ok {
+		return
+	}
+	select {
+	case rd.pending <- ip:
+		rd.queued[ip] = struct{}{}
+	default:
+		rd.metrics.ReverseDNSLookup(dnsLookupDropped)
+	}
+}
+
+func (rd *reverseDNS) worker() {
+	for ip := range rd.pending {
+		rd.lookup(ip)
+		rd.mt.Lock()
+		delete(rd.queued, ip)
+		rd.mt.Unlock()
+	}
+}
+
+// lookup the name of the IP in the DNS, and caches it
+func (rd *reverseDNS) lookup(ip string) string {
+	host := ip
+	addr, err := lookupAddr(context.Background(), ip)
+	if err == nil && len(addr) > 0 {
+		host = addr[0]
+		rd.metrics.ReverseDNSLookup(dnsLookupSuccess)
+	} else {
+		rd.metrics.ReverseDNSLookup(dnsLookupFailure)
+	}
+	rd.cache.Add(ip, host)
+	return host
+}
+
+// stop the workers after they finish the pending lookups, without waiting for them. The name
+// function must not be invoked after stopping.
+func (rd *reverseDNS) stop() {
+	if rd.pending != nil {
+		close(rd.pending)
+	}
+}
+
+func isPrivateIP(ip string) bool {
+	parsed := net.ParseIP(ip)
+	return parsed != nil &&
+		(parsed.IsPrivate() || parsed.IsLoopback() || parsed.IsLinkLocalUnicast())
+}
@@ -0,0 +1,132 @@
+package transform
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+)
+
+type dnsMetrics struct {
+	imetrics.NoopReporter
+	mt      sync.Mutex
+	results map[string]int
+}
+
+func (m *dnsMetrics) ReverseDNSLookup(result string) {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	m.results[result]++
+}
+
+func (m *dnsMetrics) count(result string) int {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	return m.results[result]
+}
+
+// fakeDNS answers the reverse lookups from a map, counting the lookups of each IP. The lookups
+// wait until the release channel is closed.
+type fakeDNS struct {
+	mt      sync.Mutex
+	names   map[string]string
+	lookups map[string]int
+	release chan struct{}
+}
+
+func mockDNS(t *testing.T, names map[string]string) *fakeDNS {
+	dns := &fakeDNS{names: names, lookups: map[string]int{}, release: make(chan struct{})}
+	close(dns.release)
+	original := lookupAddr
+	lookupAddr = dns.lookupAddr
+	t.Cleanup(func() { lookupAddr = original })
+	return dns
+}
+
+func (f *fakeDNS) lookupAddr(_ context.Context, ip string) ([]string, error) {
+	<-f.release
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	f.lookups[ip]++
+	if name, ok := f.names[ip]; ok {
+		return []string{name}, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: ip, IsNotFound: true}
+}
+
+func (f *fakeDNS) count(ip string) int {
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	return f.lookups[ip]
+}
+
+func TestReverseDNS_Sync(t *testing.T) {
+	dns := mockDNS(t, map[string]string{"203.0.113.10": "api.vendor.com."})
+	metrics := &dnsMetrics{results: map[string]int{}}
+	rd := newReverseDNS(&NameResolverConfig{CacheLen: 10, CacheTTL: time.Hour}, metrics)
+
+	assert.Equal(t, "api.vendor.com.", rd.name("203.0.113.10"))
+	assert.Equal(t, "203.0.113.11", rd.name("203.0.113.11"))
+	// the positive and negative answers are cached
+	assert.Equal(t, "api.vendor.com.", rd.name("203.0.113.10"))
+	assert.Equal(t, "203.0.113.11", rd.name("203.0.113.11"))
+	assert.Equal(t, 1, dns.count("203.0.113.10"))
+	assert.Equal(t, 1, dns.count("203.0.113.11"))
+	assert.Equal(t, 1, metrics.count(dnsLookupSuccess))
+	assert.Equal(t, 1, metrics.count(dnsLookupFailure))
+}
+
+func TestReverseDNS_Async(t *testing.T) {
+	dns := mockDNS(t, map[string]string{"203.0.113.10": "api.vendor.com."})
+	dns.release = make(chan struct{})
+	metrics := &dnsMetrics{results: map[string]int{}}
+	rd := newReverseDNS(&NameResolverConfig{CacheLen: 10, CacheTTL: time.Hour, ReverseDNS: ReverseDNSConfig{
+		Async: true, Workers: 1, QueueLen: 1,
+	}}, metrics)
+	defer rd.stop()
+
+	// WHEN an IP is resolved while the DNS is not answering
+	// THEN the IP is returned without waiting for the lookup
+	assert.Equal(t, "203.0.113.10", rd.name("203.0.113.10"))
+	assert.Equal(t, "203.0.113.10", rd.name("203.0.113.10"))
+	// AND the lookups that don't fit in the queue are dropped
+	assert.Eventually(t, func() bool {
+		rd.name("203.0.113.11")
+		rd.name("203.0.113.12")
+		return metrics.count(dnsLookupDropped) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// AND WHEN the DNS answers
+	close(dns.release)
+	// THEN the name is returned once it is looked up
+	assert.Eventually(t, func() bool {
+		return rd.name("203.0.113.10") == "api.vendor.com."
+	}, 5*time.Second, 10*time.Millisecond)
+	// AND the IP was looked up only once
+	assert.Equal(t, 1, dns.count("203.0.113.10"))
+}
+
+func TestReverseDNS_SkipPrivate(t *testing.T) {
+	dns := mockDNS(t, map[string]string{"10.0.0.1": "router.corp.", "203.0.113.10": "api.vendor.com."})
+	rd := newReverseDNS(&NameResolverConfig{CacheLen: 10, CacheTTL: time.Hour, ReverseDNS: ReverseDNSConfig{
+		SkipPrivate: true,
+	}}, imetrics.NoopReporter{})
+
+	for _, ip := range []string{"10.0.0.1", "192.168.1.1", "127.0.0.1", "fd00::1", "fe80::1"} {
+		assert.Equal(t, ip, rd.name(ip))
+		assert.Zero(t, dns.count(ip))
+	}
+	assert.Equal(t, "api.vendor.com.", rd.name("203.0.113.10"))
+}
+
+func TestReverseDNSConfig_Validate(t *testing.T) {
+	assert.NoError(t, (&ReverseDNSConfig{}).Validate())
+	assert.NoError(t, (&ReverseDNSConfig{Async: true, Workers: 1, QueueLen: 1}).Validate())
+	assert.Error(t, (&ReverseDNSConfig{Async: true, QueueLen: 1}).Validate())
+	assert.Error(t, (&ReverseDNSConfig{Async: true, Workers: 1}).Validate())
+}
@@ -2,7 +2,9 @@
 package transform
 
 import (
+	"errors"
 	"log/slog"
+	"sync/atomic"
 
 	"github.com/mariomac/pipes/pipe"
 
@@ -52,62 +54,109 @@ type RoutesConfig struct {
 }
 
 func RoutesProvider(rc *RoutesConfig) pipe.MiddleProvider[[]request.Span, []request.Span] {
-	return (&routerNode{config: rc}).provideRoutes
+	return NewRouter(rc).Provide
 }
 
-type routerNode struct {
+// Router decorates the spans with the route of their path. Its configuration can be updated
+// at runtime.
+type Router struct {
 	config *RoutesConfig
+	active atomic.Pointer[router]
 }
 
-func (rn *routerNode) provideRoutes() (pipe.MiddleFunc[[]request.Span, []request.Span], error) {
-	rc := rn.config
-	if rc == nil {
-		// if no configuration is provided, we just bypass the node
-		return pipe.Bypass[[]request.Span](), nil
-	}
+// router stores the matchers for a given RoutesConfig
+type router struct {
+	unmatchAction func(span *request.Span)
+	matcher       route.Matcher
+	discarder     route.Matcher
+	routesEnabled bool
+	ignoreEnabled bool
+	ignoreMode    IgnoreMode
+}
 
+func NewRouter(rc *RoutesConfig) *Router {
+	return &Router{config: rc}
+}
+
+func newRouter(rc *RoutesConfig) (*router, error) {
 	// set default value for Unmatch action
 	unmatchAction, err := chooseUnmatchPolicy(rc)
 	if err != nil {
 		return nil, err
 	}
-	matcher := route.NewMatcher(rc.Patterns)
-	discarder := route.NewMatcher(rc.IgnorePatterns)
-	routesEnabled := len(rc.Patterns) > 0
-	ignoreEnabled := len(rc.IgnorePatterns) > 0
-
 	ignoreMode := rc.IgnoredEvents
 	if ignoreMode == "" {
 		ignoreMode = IgnoreDefault
 	}
+	return &router{
+		unmatchAction: unmatchAction,
+		matcher:       route.NewMatcher(rc.Patterns),
+		discarder:     route.NewMatcher(rc.IgnorePatterns),
+		routesEnabled: len(rc.Patterns) > 0,
+		ignoreEnabled: len(rc.IgnorePatterns) > 0,
+		ignoreMode:    ignoreMode,
+	}, nil
+}
+
+func (rn *Router) Provide() (pipe.MiddleFunc[[]request.Span, []request.Span], error) {
+	if rn.config == nil {
+		// if no configuration is provided, we just bypass the node
+		return pipe.Bypass[[]request.Span](), nil
+	}
+	r, err := newRouter(rn.config)
+	if err != nil {
+		return nil, err
+	}
+	rn.active.Store(r)
 
 	return func(in <-chan []request.Span, out chan<- []request.Span) {
 		for spans := range in {
-			filtered := make([]request.Span, 0, len(spans))
-			for i := range spans {
-				s := &spans[i]
-				if ignoreEnabled {
-					if discarder.Find(s.Path) != "" {
-						if ignoreMode == IgnoreAll {
-							continue
-						}
-						// we can't discard it here, ignoring is selective (metrics | traces)
-						setSpanIgnoreMode(ignoreMode, s)
-					}
-				}
-				if routesEnabled {
-					s.Route = matcher.Find(s.Path)
-				}
-				unmatchAction(s)
-				filtered = append(filtered, *s)
-			}
-			if len(filtered) > 0 {
+			if filtered := rn.active.Load().decorate(spans); len(filtered) > 0 {
 				out <- filtered
 			}
 		}
 	}, nil
 }
 
+// Update the routes configuration of a running Router. The Router must have been
+// provided with a non-nil configuration.
+func (rn *Router) Update(rc *RoutesConfig) error {
+	if rn.active.Load() == nil {
+		return errors.New("routes decorator was not enabled at startup")
+	}
+	if rc == nil {
+		return errors.New("routes decorator can't be disabled at runtime")
+	}
+	r, err := newRouter(rc)
+	if err != nil {
+		return err
+	}
+	rn.active.Store(r)
+	return nil
+}
+
+func (r *router) decorate(spans []request.Span) []request.Span {
+	filtered := make([]request.Span, 0, len(spans))
+	for i := range spans {
+		s := &spans[i]
+		if r.ignoreEnabled {
+			if r.discarder.Find(s.Path) != "" {
+				if r.ignoreMode == IgnoreAll {
+					continue
+				}
+				// we can't discard it here, ignoring is selective (metrics | traces)
+				setSpanIgnoreMode(r.ignoreMode, s)
+			}
+		}
+		if r.routesEnabled {
+			s.Route = r.matcher.Find(s.Path)
+		}
+		r.unmatchAction(s)
+		filtered = append(filtered, *s)
+	}
+	return filtered
+}
+
 func chooseUnmatchPolicy(rc *RoutesConfig) (func(span *request.Span), error) {
 	var unmatchAction func(span *request.Span)
 
@@ -167,3 +167,32 @@ func benchProvider(b *testing.B, unmatch UnmatchType) {
 		<-outCh
 	}
 }
+
+func TestRouterUpdate(t *testing.T) {
+	r := NewRouter(&RoutesConfig{Unmatch: UnmatchPath, Patterns: []string{"/user/:id"}})
+	router, err := r.Provide()
+	require.NoError(t, err)
+	in, out := make(chan []request.Span, 10), make(chan []request.Span, 10)
+	defer close(in)
+	go router(in, out)
+	in <- []request.Span{{Path: "/item/1234"}}
+	assert.Equal(t, []request.Span{{
+		Path:  "/item/1234",
+		Route: "/item/1234",
+	}}, testutil.ReadChannel(t, out, testTimeout))
+
+	// WHEN the routes configuration is updated
+	require.NoError(t, r.Update(&RoutesConfig{Unmatch: UnmatchPath, Patterns: []string{"/item/:id"}}))
+
+	// THEN the new routes are applied
+	in <- []request.Span{{Path: "/item/1234"}}
+	assert.Equal(t, []request.Span{{
+		Path:  "/item/1234",
+		Route: "/item/:id",
+	}}, testutil.ReadChannel(t, out, testTimeout))
+
+	// AND the routes can't be disabled at runtime
+	require.Error(t, r.Update(nil))
+	// AND a router that was not enabled at startup can't be updated
+	require.Error(t, NewRouter(nil).Update(&RoutesConfig{}))
+}
@@ -14,8 +14,8 @@ import (
 )
 
 const (
-	flushesMetricName            = "ebpf_tracer_flushes"
-	promRequestsMetricName       = "prometheus_http_requests"
+	flushesMetricName            = "beyla_ebpf_tracer_flushes"
+	promRequestsMetricName       = "beyla_prometheus_http_requests_total"
 	internalPrometheusMetricsURL = "http://localhost:8999/internal/metrics"
 )
 
@@ -25,7 +25,7 @@ const (
 	prometheusHostPort = "localhost:39090"
 
 	UUIDRegex = `^[0-9A-Fa-f]{8}-([0-9A-Fa-f]{4}-){3}[0-9A-Fa-f]{12}$`
-	TimeRegex = `^\d{4}-\d\d-\d\d \d\d:\d\d:\d\d`
+	TimeRegex = `^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\dZ$`
 )
 
 var (
@@ -101,18 +101,16 @@ func FeatureHTTPMetricsDecoration() features.Feature {
 			testMetricsDecoration(httpClientMetrics, `{k8s_pod_name="internal-pinger"}`, map[string]string{
 				"k8s_namespace_name": "^default$",
 				"k8s_node_name":      ".+-control-plane$",
-				"k8s_pod_uid":        UUIDRegex,
 				"k8s_pod_start_time": TimeRegex,
-			}, "k8s_deployment_name")).
+			}, "k8s_deployment_name", "k8s_pod_uid")).
 		Assess("all the server metrics are properly decorated",
 			testMetricsDecoration(httpServerMetrics, `{url_path="/iping",k8s_pod_name=~"testserver-.*"}`, map[string]string{
 				"k8s_namespace_name":  "^default$",
 				"k8s_node_name":       ".+-control-plane$",
-				"k8s_pod_uid":         UUIDRegex,
 				"k8s_pod_start_time":  TimeRegex,
 				"k8s_deployment_name": "^testserver$",
 				"k8s_replicaset_name": "^testserver-",
-			})).
+			}, "k8s_pod_uid")).
 		Assess("all the span graph metrics exist",
 			testMetricsDecoration(spanGraphMetrics, `{connection_type="virtual_node",server="testserver"}`, map[string]string{
 				"server_service_namespace": "integration-test",
@@ -136,18 +134,16 @@ func FeatureGRPCMetricsDecoration() features.Feature {
 			testMetricsDecoration(grpcClientMetrics, `{k8s_pod_name="internal-grpc-pinger"}`, map[string]string{
 				"k8s_namespace_name": "^default$",
 				"k8s_node_name":      ".+-control-plane$",
-				"k8s_pod_uid":        UUIDRegex,
 				"k8s_pod_start_time": TimeRegex,
-			}, "k8s_deployment_name")).
+			}, "k8s_deployment_name", "k8s_pod_uid")).
 		Assess("all the server metrics are properly decorated",
 			testMetricsDecoration(grpcServerMetrics, `{k8s_pod_name=~"testserver-.*"}`, map[string]string{
 				"k8s_namespace_name":  "^default$",
 				"k8s_node_name":       ".+-control-plane$",
-				"k8s_pod_uid":         UUIDRegex,
 				"k8s_pod_start_time":  TimeRegex,
 				"k8s_deployment_name": "^testserver$",
 				"k8s_replicaset_name": "^testserver-",
-			}),
+			}, "k8s_pod_uid"),
 		).Feature()
 }
 
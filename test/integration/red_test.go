@@ -662,4 +662,6 @@ func testPrometheusBeylaBuildInfo(t *testing.T) {
 		require.NoError(t, err)
 		require.NotEmpty(t, results)
 	})
+	assert.Contains(t, results[0].Metric["features"], "application")
+	assert.NotEmpty(t, results[0].Metric["kernel_release"])
 }
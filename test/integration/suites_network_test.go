@@ -3,9 +3,11 @@
 package integration
 
 import (
+	"fmt"
 	"net/http"
 	"path"
 	"regexp"
+	"strconv"
 	"testing"
 	"time"
 
@@ -90,6 +92,48 @@ func TestNetwork_AllowedAttributes(t *testing.T) {
 	require.NoError(t, compose.Close())
 }
 
+func TestNetwork_IPv6(t *testing.T) {
+	for _, source := range []string{"tc", "socket_filter"} {
+		t.Run(source, func(t *testing.T) {
+			compose, err := docker.ComposeSuite("docker-compose-netolly-ipv6.yml", path.Join(pathOutput, "test-suite-netolly-ipv6-"+source+".log"))
+			require.NoError(t, err)
+			compose.Env = append(compose.Env, "BEYLA_NETWORK_SOURCE="+source)
+			require.NoError(t, compose.Up())
+
+			pq := prom.Client{HostPort: prometheusHostPort}
+			var bytesV4, bytesV6 float64
+			test.Eventually(t, 4*testTimeout, func(t require.TestingT) {
+				// GIVEN the same HTTP traffic sent over IPv4 and over IPv6 (see the pinger4 and pinger6 services)
+				// THEN IPv6 flows are reported with their full, non-mangled addresses
+				bytesV6 = flowBytesRate(t, pq, "fd00:b00:1::20", "fd00:b00:1::10")
+				// AND the byte counts are similar to the IPv4 equivalent flows. IPv6 packets have
+				// larger headers, and the pingers are not started at the very same time,
+				// so we allow some error margin
+				bytesV4 = flowBytesRate(t, pq, "172.30.0.20", "172.30.0.10")
+				assert.InEpsilon(t, bytesV4, bytesV6, 0.3)
+				// AND the responses are also accounted
+				assert.InEpsilon(t,
+					flowBytesRate(t, pq, "172.30.0.10", "172.30.0.20"),
+					flowBytesRate(t, pq, "fd00:b00:1::10", "fd00:b00:1::20"), 0.3)
+			}, test.Interval(time.Second))
+
+			require.NoError(t, compose.Close())
+		})
+	}
+}
+
+// flowBytesRate returns the per-second rate of bytes of the flows between the provided addresses
+func flowBytesRate(t require.TestingT, pq prom.Client, src, dst string) float64 {
+	results, err := pq.Query(fmt.Sprintf(
+		`sum(rate(beyla_network_flow_bytes_total{src_address="%s",dst_address="%s"}[1m]))`, src, dst))
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	rate, err := strconv.ParseFloat(fmt.Sprint(results[0].Value[1]), 64)
+	require.NoError(t, err)
+	require.NotZero(t, rate)
+	return rate
+}
+
 func getNetFlows(t *testing.T) []prom.Result {
 	var results []prom.Result
 	pq := prom.Client{HostPort: prometheusHostPort}